@@ -0,0 +1,30 @@
+package config
+
+import (
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type Admin struct {
+	Users []string
+}
+
+func initAdmin() {
+	viper.SetDefault("admin.users", []string{"root"})
+	_ = viper.BindEnv("admin.users", "TAOS_ADAPTER_ADMIN_USERS")
+	pflag.StringArray("admin.users", []string{"root"}, `users allowed to access the admin api. Env "TAOS_ADAPTER_ADMIN_USERS"`)
+}
+
+func (a *Admin) setValue() {
+	a.Users = viper.GetStringSlice("admin.users")
+}
+
+// IsAdmin returns whether the user is allowed to access the admin api.
+func (a *Admin) IsAdmin(user string) bool {
+	for _, u := range a.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
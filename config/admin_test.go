@@ -0,0 +1,15 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin_IsAdmin(t *testing.T) {
+	admin := Admin{Users: []string{"root", "ops"}}
+	assert.True(t, admin.IsAdmin("root"))
+	assert.True(t, admin.IsAdmin("ops"))
+	assert.False(t, admin.IsAdmin("reader"))
+	assert.False(t, admin.IsAdmin(""))
+}
@@ -28,6 +28,10 @@ type Config struct {
 	Pool                Pool
 	Monitor             Monitor
 	UploadKeeper        UploadKeeper
+	SSL                 SSL
+	RestfulCursor       RestfulCursor
+	RestfulTMQ          RestfulTMQ
+	Admin               Admin
 }
 
 var (
@@ -92,6 +96,10 @@ func Init() {
 	Conf.Pool.setValue()
 	Conf.Monitor.setValue()
 	Conf.UploadKeeper.setValue()
+	Conf.SSL.setValue()
+	Conf.RestfulCursor.setValue()
+	Conf.RestfulTMQ.setValue()
+	Conf.Admin.setValue()
 	// set log level default value: info
 	if Conf.LogLevel == "" {
 		Conf.LogLevel = "info"
@@ -165,6 +173,10 @@ func init() {
 	initPool()
 	initMonitor()
 	initUploadKeeper()
+	initSSL()
+	initRestfulCursor()
+	initRestfulTMQ()
+	initAdmin()
 	err := viper.BindPFlags(pflag.CommandLine)
 	if err != nil {
 		panic(err)
@@ -81,6 +81,23 @@ func TestInit(t *testing.T) {
 					RetryTimes:    3,
 					RetryInterval: 5 * time.Second,
 				},
+				SSL: SSL{
+					Enable:         false,
+					CertFile:       "",
+					KeyFile:        "",
+					ClientCAFile:   "",
+					ReloadInterval: 10 * time.Second,
+				},
+				RestfulCursor: RestfulCursor{
+					TTL:       time.Minute,
+					MaxCount:  100,
+					FetchSize: 1000,
+				},
+				RestfulTMQ: RestfulTMQ{
+					TTL:               5 * time.Minute,
+					MaxCount:          100,
+					HeartbeatInterval: 15 * time.Second,
+				},
 			}, Conf)
 			corsC := Conf.Cors.GetConfig()
 			assert.Equal(
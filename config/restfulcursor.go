@@ -0,0 +1,34 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type RestfulCursor struct {
+	TTL       time.Duration
+	MaxCount  int
+	FetchSize int
+}
+
+func initRestfulCursor() {
+	viper.SetDefault("restfulCursor.ttl", time.Minute)
+	_ = viper.BindEnv("restfulCursor.ttl", "TAOS_ADAPTER_RESTFUL_CURSOR_TTL")
+	pflag.Duration("restfulCursor.ttl", time.Minute, `idle time after which a restful cursor is closed. Env "TAOS_ADAPTER_RESTFUL_CURSOR_TTL"`)
+
+	viper.SetDefault("restfulCursor.maxCount", 100)
+	_ = viper.BindEnv("restfulCursor.maxCount", "TAOS_ADAPTER_RESTFUL_CURSOR_MAX_COUNT")
+	pflag.Int("restfulCursor.maxCount", 100, `maximum number of open restful cursors, each cursor holds a connection. Env "TAOS_ADAPTER_RESTFUL_CURSOR_MAX_COUNT"`)
+
+	viper.SetDefault("restfulCursor.fetchSize", 1000)
+	_ = viper.BindEnv("restfulCursor.fetchSize", "TAOS_ADAPTER_RESTFUL_CURSOR_FETCH_SIZE")
+	pflag.Int("restfulCursor.fetchSize", 1000, `default number of rows returned per cursor page. Env "TAOS_ADAPTER_RESTFUL_CURSOR_FETCH_SIZE"`)
+}
+
+func (r *RestfulCursor) setValue() {
+	r.TTL = viper.GetDuration("restfulCursor.ttl")
+	r.MaxCount = viper.GetInt("restfulCursor.maxCount")
+	r.FetchSize = viper.GetInt("restfulCursor.fetchSize")
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type RestfulTMQ struct {
+	TTL               time.Duration
+	MaxCount          int
+	HeartbeatInterval time.Duration
+}
+
+func initRestfulTMQ() {
+	viper.SetDefault("restfulTMQ.ttl", 5*time.Minute)
+	_ = viper.BindEnv("restfulTMQ.ttl", "TAOS_ADAPTER_RESTFUL_TMQ_TTL")
+	pflag.Duration("restfulTMQ.ttl", 5*time.Minute, `idle time after which a restful tmq consumer is closed. Env "TAOS_ADAPTER_RESTFUL_TMQ_TTL"`)
+
+	viper.SetDefault("restfulTMQ.maxCount", 100)
+	_ = viper.BindEnv("restfulTMQ.maxCount", "TAOS_ADAPTER_RESTFUL_TMQ_MAX_COUNT")
+	pflag.Int("restfulTMQ.maxCount", 100, `maximum number of restful tmq consumers, each consumer holds a tmq thread. Env "TAOS_ADAPTER_RESTFUL_TMQ_MAX_COUNT"`)
+
+	viper.SetDefault("restfulTMQ.heartbeatInterval", 15*time.Second)
+	_ = viper.BindEnv("restfulTMQ.heartbeatInterval", "TAOS_ADAPTER_RESTFUL_TMQ_HEARTBEAT_INTERVAL")
+	pflag.Duration("restfulTMQ.heartbeatInterval", 15*time.Second, `interval of the comment lines sent on an idle restful tmq event stream. Env "TAOS_ADAPTER_RESTFUL_TMQ_HEARTBEAT_INTERVAL"`)
+}
+
+func (r *RestfulTMQ) setValue() {
+	r.TTL = viper.GetDuration("restfulTMQ.ttl")
+	r.MaxCount = viper.GetInt("restfulTMQ.maxCount")
+	r.HeartbeatInterval = viper.GetDuration("restfulTMQ.heartbeatInterval")
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type SSL struct {
+	Enable         bool
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ReloadInterval time.Duration
+}
+
+func initSSL() {
+	viper.SetDefault("ssl.enable", false)
+	_ = viper.BindEnv("ssl.enable", "TAOS_ADAPTER_SSL_ENABLE")
+	pflag.Bool("ssl.enable", false, `Enable ssl. Env "TAOS_ADAPTER_SSL_ENABLE"`)
+
+	viper.SetDefault("ssl.certFile", "")
+	_ = viper.BindEnv("ssl.certFile", "TAOS_ADAPTER_SSL_CERT_FILE")
+	pflag.String("ssl.certFile", "", `ssl cert file path. Env "TAOS_ADAPTER_SSL_CERT_FILE"`)
+
+	viper.SetDefault("ssl.keyFile", "")
+	_ = viper.BindEnv("ssl.keyFile", "TAOS_ADAPTER_SSL_KEY_FILE")
+	pflag.String("ssl.keyFile", "", `ssl key file path. Env "TAOS_ADAPTER_SSL_KEY_FILE"`)
+
+	viper.SetDefault("ssl.clientCAFile", "")
+	_ = viper.BindEnv("ssl.clientCAFile", "TAOS_ADAPTER_SSL_CLIENT_CA_FILE")
+	pflag.String("ssl.clientCAFile", "", `ssl client CA file path, client certificates are required and verified when set. Env "TAOS_ADAPTER_SSL_CLIENT_CA_FILE"`)
+
+	viper.SetDefault("ssl.reloadInterval", 10*time.Second)
+	_ = viper.BindEnv("ssl.reloadInterval", "TAOS_ADAPTER_SSL_RELOAD_INTERVAL")
+	pflag.Duration("ssl.reloadInterval", 10*time.Second, `interval for checking certificate file changes, 0 means only reload on SIGHUP. Env "TAOS_ADAPTER_SSL_RELOAD_INTERVAL"`)
+}
+
+func (s *SSL) setValue() {
+	s.Enable = viper.GetBool("ssl.enable")
+	s.CertFile = viper.GetString("ssl.certFile")
+	s.KeyFile = viper.GetString("ssl.keyFile")
+	s.ClientCAFile = viper.GetString("ssl.clientCAFile")
+	s.ReloadInterval = viper.GetDuration("ssl.reloadInterval")
+}
@@ -15,3 +15,17 @@ func AddController(controller WebController) {
 func GetControllers() []WebController {
 	return controllers
 }
+
+// Closer is implemented by the controllers that hold resources to release on shutdown.
+type Closer interface {
+	Close()
+}
+
+// Close closes the controllers that implement Closer.
+func Close() {
+	for _, c := range controllers {
+		if closer, ok := c.(Closer); ok {
+			closer.Close()
+		}
+	}
+}
@@ -21,3 +21,25 @@ func TestAddAndGetControllers(t *testing.T) {
 		t.Error("Expected the controller to be an instance of MockController")
 	}
 }
+
+type mockCloser struct {
+	MockController
+	closed bool
+}
+
+func (mc *mockCloser) Close() {
+	mc.closed = true
+}
+
+func TestClose(t *testing.T) {
+	saved := controllers
+	defer func() {
+		controllers = saved
+	}()
+	closer := &mockCloser{}
+	controllers = []WebController{MockController{}, closer}
+	Close()
+	if !closer.closed {
+		t.Error("Expected the controller to be closed")
+	}
+}
@@ -4,14 +4,21 @@ import (
 	"crypto/des"
 	"encoding/base64"
 	"errors"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	taoserrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
 	"github.com/taosdata/taosadapter/v3/httperror"
 	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
 	"github.com/taosdata/taosadapter/v3/tools/pool"
 )
 
@@ -155,3 +162,49 @@ type Message struct {
 	Code int    `json:"code"`
 	Desc string `json:"desc"`
 }
+
+// checkUser connects to the server to check the password of the user and whether the whitelist of the user allows
+// the client ip, it responds with the error and returns false if the check fails.
+func checkUser(c *gin.Context, logger *logrus.Entry, user, password string) bool {
+	conn, err := wrapper.TaosConnect("", user, password, "", 0)
+	if err != nil {
+		taosErr := err.(*taoserrors.TaosError)
+		ErrorResponse(c, logger, http.StatusUnauthorized, int(taosErr.Code), taosErr.ErrStr)
+		return false
+	}
+	defer func() {
+		wrapper.TaosClose(conn)
+	}()
+	whitelist, err := tool.GetWhitelist(conn)
+	if err != nil {
+		logger.Errorf("get whitelist failed, err: %s", err)
+		taosErr := err.(*taoserrors.TaosError)
+		InternalErrorResponse(c, logger, int(taosErr.Code), taosErr.ErrStr)
+		return false
+	}
+	valid := tool.CheckWhitelist(whitelist, iptool.GetRealIP(c.Request))
+	if !valid {
+		logger.Errorf("whitelist prohibits current IP access, ip:%s, whitelist:%s", iptool.GetRealIP(c.Request), tool.IpNetSliceToString(whitelist))
+		ForbiddenResponse(c, logger, commonpool.ErrWhitelistForbidden.Error())
+		return false
+	}
+	return true
+}
+
+// CheckAdmin allows the request only if the user set by CheckAuth is one of admin.users and the password is
+// accepted by the server.
+func CheckAdmin(c *gin.Context) {
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	user := c.MustGet(UserKey).(string)
+	if !config.Conf.Admin.IsAdmin(user) {
+		logger.Errorf("user is not admin, user:%s", user)
+		ForbiddenResponse(c, logger, "admin permission required")
+		return
+	}
+	checkUser(c, logger, user, c.MustGet(PasswordKey).(string))
+}
+
+// AdminHandlers returns the handlers to register before the handler of an admin api.
+func AdminHandlers() []gin.HandlerFunc {
+	return []gin.HandlerFunc{prepareCtx, CheckAuth, CheckAdmin}
+}
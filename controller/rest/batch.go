@@ -0,0 +1,352 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+const (
+	BatchModeStop     = "stop"
+	BatchModeContinue = "continue"
+)
+
+type BatchStatement struct {
+	SQL   string `json:"sql"`
+	DB    string `json:"db"`
+	ReqID int64  `json:"req_id"`
+	Tz    string `json:"tz"`
+}
+
+var (
+	BatchHeader         = []byte(`{"code":0,"results":[`)
+	BatchEnd            = []byte(`]}`)
+	BatchResultReqID    = []byte(`{"req_id":`)
+	BatchResultCode     = []byte(`,"code":`)
+	BatchResultDesc     = []byte(`,"desc":`)
+	BatchColumnMeta     = []byte(`,"code":0,"column_meta":[`)
+	BatchAffected       = []byte(`,"code":0,"column_meta":[["affected_rows","INT",4]],"data":[[`)
+	BatchAffectedObj    = []byte(`,"code":0,"column_meta":[["affected_rows","INT",4]],"data":[{"affected_rows":`)
+	BatchAffectedEnd    = []byte(`]],"rows":1`)
+	BatchAffectedObjEnd = []byte(`}],"rows":1`)
+)
+
+// @Tags rest
+// @Summary execute sql batch
+// @Description execute a JSON array of statements on one connection, time formatted as RFC3339Nano
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Param mode query string false "stop or continue on error"
+// @Success 200 {string} string "per statement results"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 500 {string} string "internal error"
+// @Router /rest/batch/:db [post]
+// @Router /rest/batch [post]
+func (ctl *Restful) batch(c *gin.Context) {
+	db := c.Param("db")
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	isDebug := log.IsDebug()
+	mode := c.DefaultQuery("mode", BatchModeStop)
+	if mode != BatchModeStop && mode != BatchModeContinue {
+		logger.Errorf("illegal param, mode must be stop or continue:%s", mode)
+		BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, mode must be %s or %s", BatchModeStop, BatchModeContinue))
+		return
+	}
+	var err error
+	var returnObj bool
+	if returnObjStr := c.Query("row_with_meta"); len(returnObjStr) != 0 {
+		if returnObj, err = strconv.ParseBool(returnObjStr); err != nil {
+			logger.Tracef("illegal param, row_with_meta must be boolean:%s", returnObjStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, row_with_meta must be boolean %s", err.Error()))
+			return
+		}
+	}
+	defaultLocation := time.UTC
+	if timezone, exists := c.GetQuery("tz"); exists {
+		if defaultLocation, err = time.LoadLocation(timezone); err != nil {
+			logger.Errorf("load tz location:%s fail, error:%s", timezone, err)
+			BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+			return
+		}
+	}
+	var statements []*BatchStatement
+	if err = c.ShouldBindJSON(&statements); err != nil {
+		logger.Errorf("get json request error, %s", err.Error())
+		BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+		return
+	}
+	if len(statements) == 0 {
+		logger.Error("no sql got")
+		BadRequestResponse(c, logger, httperror.HTTP_NO_SQL_INPUT)
+		return
+	}
+	// validate all statements before executing any of them
+	locations := make([]*time.Location, len(statements))
+	for i, statement := range statements {
+		statement.SQL = strings.TrimSpace(statement.SQL)
+		if len(statement.SQL) == 0 {
+			logger.Errorf("no sql got, index:%d", i)
+			BadRequestResponseWithMsg(c, logger, httperror.HTTP_NO_SQL_INPUT, fmt.Sprintf("no sql input, index:%d", i))
+			return
+		}
+		if len(statement.DB) == 0 {
+			statement.DB = db
+		}
+		if statement.ReqID == 0 {
+			statement.ReqID = generator.GetReqID()
+		}
+		locations[i] = defaultLocation
+		if len(statement.Tz) != 0 {
+			if locations[i], err = time.LoadLocation(statement.Tz); err != nil {
+				logger.Errorf("load tz location:%s fail, index:%d, error:%s", statement.Tz, i, err)
+				BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("index:%d, %s", i, err.Error()))
+				return
+			}
+		}
+	}
+
+	user := c.MustGet(UserKey).(string)
+	password := c.MustGet(PasswordKey).(string)
+	ip := iptool.GetRealIP(c.Request)
+	s := log.GetLogNow(isDebug)
+	taosConnect, err := commonpool.GetConnection(user, password, ip)
+	logger.Debugf("get connect, conn:%p, err:%v, cost:%s", taosConnect, err, log.GetLogDuration(isDebug, s))
+	if err != nil {
+		logger.Errorf("connect server error,ip:%s, err:%s", ip, err)
+		ConnectionErrorResponse(c, logger, err)
+		return
+	}
+	defer func() {
+		putErr := taosConnect.Put()
+		if putErr != nil {
+			logger.Errorf("put connection error, err:%s", putErr)
+		}
+	}()
+	if !trySetConnectionOptions(c, taosConnect.TaosConnection, logger, isDebug) {
+		return
+	}
+
+	w := c.Writer
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	builder := jsonbuilder.BorrowStream(w)
+	defer jsonbuilder.ReturnStream(builder)
+	builder.WritePure(BatchHeader)
+	handler := async.GlobalAsync.HandlerPool.Get()
+	defer async.GlobalAsync.HandlerPool.Put(handler)
+	currentDB := ""
+	for i, statement := range statements {
+		if i != 0 {
+			builder.WriteMore()
+		}
+		stmtLogger := logger.WithField(config.ReqIDKey, statement.ReqID)
+		if len(statement.DB) > 0 && statement.DB != currentDB {
+			stmtLogger.Tracef("select db %s", statement.DB)
+			err = async.GlobalAsync.TaosExecWithoutResult(taosConnect.TaosConnection, stmtLogger, isDebug, fmt.Sprintf("use `%s`", statement.DB), statement.ReqID)
+			if err != nil {
+				// the statement is not executed, the error is reported as its result
+				stmtLogger.Errorf("select db %s error, err:%s", statement.DB, err)
+				code := writeBatchUseDBError(builder, statement.ReqID, err)
+				if mode == BatchModeStop {
+					logger.Debugf("batch stopped at index %d, code:%d", i, code)
+					break
+				}
+				continue
+			}
+			currentDB = statement.DB
+		}
+		code, err := executeBatchStatement(w, builder, stmtLogger, isDebug, taosConnect.TaosConnection, statement, handler, returnObj, locations[i])
+		if err != nil {
+			logger.Errorf("write batch result error, err:%s", err)
+			return
+		}
+		if code != 0 && mode == BatchModeStop {
+			logger.Debugf("batch stopped at index %d, code:%d", i, code)
+			break
+		}
+	}
+	builder.WritePure(BatchEnd)
+	if err = forceFlush(w, builder); err != nil {
+		logger.Errorf("force flush error:%s", err)
+	}
+}
+
+func writeBatchError(builder *jsonbuilder.Stream, code int, desc string) {
+	builder.WritePure(BatchResultCode)
+	builder.WriteInt(code)
+	builder.WritePure(BatchResultDesc)
+	builder.WriteString(desc)
+	builder.WriteObjectEnd()
+}
+
+// writeBatchUseDBError writes the result object of a statement whose database can not be selected and returns its error code.
+func writeBatchUseDBError(builder *jsonbuilder.Stream, reqID int64, err error) int {
+	builder.WritePure(BatchResultReqID)
+	builder.WriteInt64(reqID)
+	code, desc := 0xffff, err.Error()
+	if tError, ok := err.(*tErrors.TaosError); ok {
+		code, desc = int(tError.Code)&0xffff, tError.ErrStr
+	}
+	writeBatchError(builder, code, desc)
+	return code
+}
+
+// executeBatchStatement writes the result object of one statement and returns its error code, the returned error is a write error.
+func executeBatchStatement(w gin.ResponseWriter, builder *jsonbuilder.Stream, logger *logrus.Entry, isDebug bool, taosConnect unsafe.Pointer, statement *BatchStatement, handler *async.Handler, returnObj bool, location *time.Location) (int, error) {
+	sql := statement.SQL
+	reqID := statement.ReqID
+	logger.Debugf("batch sql:%s", log.GetLogSql(sql))
+	builder.WritePure(BatchResultReqID)
+	builder.WriteInt64(reqID)
+	sqlType := monitor.RestRecordRequest(sql)
+	result := async.GlobalAsync.TaosQuery(taosConnect, logger, isDebug, sql, handler, reqID)
+	res := result.Res
+	defer func() {
+		if res != nil {
+			async.FreeResultAsync(res, logger, isDebug)
+		}
+	}()
+	code := wrapper.TaosError(res)
+	if code != httperror.SUCCESS {
+		monitor.RestRecordResult(sqlType, false)
+		errStr := wrapper.TaosErrorStr(res)
+		logger.Errorf("taos query error, QID:0x%x, code:%d, msg:%s, sql: %s", reqID, code, errStr, log.GetLogSql(sql))
+		code = code & 0xffff
+		writeBatchError(builder, code, errStr)
+		return code, nil
+	}
+	monitor.RestRecordResult(sqlType, true)
+	if wrapper.TaosIsUpdateQuery(res) {
+		affectRows := wrapper.TaosAffectedRows(res)
+		logger.Tracef("sql affectRows:%d", affectRows)
+		if returnObj {
+			builder.WritePure(BatchAffectedObj)
+			builder.WriteInt(affectRows)
+			builder.WritePure(BatchAffectedObjEnd)
+		} else {
+			builder.WritePure(BatchAffected)
+			builder.WriteInt(affectRows)
+			builder.WritePure(BatchAffectedEnd)
+		}
+		builder.WriteObjectEnd()
+		_, err := tryFlush(w, builder, false)
+		return 0, err
+	}
+	if monitor.QueryPaused() {
+		logger.Errorf("query memory exceeds threshold, QID:0x%x", reqID)
+		writeBatchError(builder, 0xffff, "query memory exceeds threshold")
+		return 0xffff, nil
+	}
+	fieldsCount := wrapper.TaosNumFields(res)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		logger.Errorf("read column error, error:%s, sql:%s", err, log.GetLogSql(sql))
+		tError, ok := err.(*tErrors.TaosError)
+		if ok {
+			code = int(tError.Code) & 0xffff
+			writeBatchError(builder, code, tError.ErrStr)
+			return code, nil
+		}
+		writeBatchError(builder, 0xffff, err.Error())
+		return 0xffff, nil
+	}
+	builder.WritePure(BatchColumnMeta)
+	for i := 0; i < fieldsCount; i++ {
+		builder.WriteArrayStart()
+		builder.WriteString(rowsHeader.ColNames[i])
+		builder.WriteMore()
+		builder.WriteString(rowsHeader.TypeDatabaseName(i))
+		builder.WriteMore()
+		builder.WriteInt64(rowsHeader.ColLength[i])
+		builder.WriteArrayEnd()
+		if i != fieldsCount-1 {
+			builder.WriteMore()
+		}
+	}
+	builder.WritePure(Query3)
+	precision := wrapper.TaosResultPrecision(res)
+	pHeaderList := make([]unsafe.Pointer, fieldsCount)
+	pStartList := make([]unsafe.Pointer, fieldsCount)
+	timeBuffer := make([]byte, 0, 30)
+	total := 0
+	fetchErrCode := 0
+	fetchErrStr := ""
+	for {
+		if config.Conf.RestfulRowLimit > -1 && total >= config.Conf.RestfulRowLimit {
+			break
+		}
+		result = async.GlobalAsync.TaosFetchRawBlockA(res, logger, isDebug, handler)
+		if result.N == 0 {
+			break
+		}
+		if result.N < 0 {
+			fetchErrCode = result.N & 0xffff
+			fetchErrStr = wrapper.TaosErrorStr(result.Res)
+			logger.Errorf("fetch raw block error, QID:0x%x, code:%d, msg:%s, rows fetched:%d, sql:%s", reqID, fetchErrCode, fetchErrStr, total, log.GetLogSql(sql))
+			break
+		}
+		res = result.Res
+		blockSize := result.N
+		block := wrapper.TaosGetRawBlock(res)
+		ctools.RawBlockColumnPointers(block, blockSize, rowsHeader.ColTypes, pHeaderList, pStartList)
+		for row := 0; row < blockSize; row++ {
+			if config.Conf.RestfulRowLimit > -1 && total >= config.Conf.RestfulRowLimit {
+				break
+			}
+			if total != 0 {
+				builder.WriteMore()
+			}
+			if returnObj {
+				builder.WriteObjectStart()
+			} else {
+				builder.WriteArrayStart()
+			}
+			for column := 0; column < fieldsCount; column++ {
+				if returnObj {
+					builder.WriteObjectField(rowsHeader.ColNames[column])
+				}
+				ctools.JsonWriteRawBlock(builder, rowsHeader.ColTypes[column], pHeaderList[column], pStartList[column], row, precision, location, timeBuffer, logger)
+				if column != fieldsCount-1 {
+					builder.WriteMore()
+				}
+			}
+			if returnObj {
+				builder.WriteObjectEnd()
+			} else {
+				builder.WriteArrayEnd()
+			}
+			total += 1
+			if _, err = tryFlush(w, builder, false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	builder.WritePure(Query4)
+	builder.WriteInt(total)
+	if fetchErrCode != 0 {
+		writeFetchError(builder, fetchErrCode, fetchErrStr)
+	}
+	builder.WriteObjectEnd()
+	_, err = tryFlush(w, builder, false)
+	return fetchErrCode, err
+}
@@ -8,12 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/taosdata/taosadapter/v3/controller"
-	"github.com/taosdata/taosadapter/v3/db/commonpool"
-	"github.com/taosdata/taosadapter/v3/db/tool"
-	taoserrors "github.com/taosdata/taosadapter/v3/driver/errors"
-	"github.com/taosdata/taosadapter/v3/driver/wrapper"
 	"github.com/taosdata/taosadapter/v3/log"
-	"github.com/taosdata/taosadapter/v3/tools/iptool"
 )
 
 type ConfigController struct {
@@ -50,26 +45,7 @@ func (ctl *ConfigController) changeConfig(c *gin.Context) {
 	defer unlock()
 	user := c.MustGet(UserKey).(string)
 	password := c.MustGet(PasswordKey).(string)
-	conn, err := wrapper.TaosConnect("", user, password, "", 0)
-	if err != nil {
-		taosErr := err.(*taoserrors.TaosError)
-		ErrorResponse(c, logger, http.StatusUnauthorized, int(taosErr.Code), taosErr.ErrStr)
-		return
-	}
-	defer func() {
-		wrapper.TaosClose(conn)
-	}()
-	whitelist, err := tool.GetWhitelist(conn)
-	if err != nil {
-		logger.Errorf("get whitelist failed, err: %s", err)
-		taosErr := err.(*taoserrors.TaosError)
-		InternalErrorResponse(c, logger, int(taosErr.Code), taosErr.ErrStr)
-		return
-	}
-	valid := tool.CheckWhitelist(whitelist, iptool.GetRealIP(c.Request))
-	if !valid {
-		logger.Errorf("whitelist prohibits current IP access, ip:%s, whitelist:%s", iptool.GetRealIP(c.Request), tool.IpNetSliceToString(whitelist))
-		ForbiddenResponse(c, logger, commonpool.ErrWhitelistForbidden.Error())
+	if !checkUser(c, logger, user, password) {
 		return
 	}
 	body, err := c.GetRawData()
@@ -0,0 +1,497 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+	"github.com/taosdata/taosadapter/v3/tools/sqltype"
+)
+
+var ErrTooManyCursors = errors.New("too many open cursors")
+
+var cursors *CursorHolder
+
+var (
+	CursorIDField        = []byte(`,"cursor_id":`)
+	CursorCompletedField = []byte(`,"completed":`)
+)
+
+// Cursor holds a query result and the connection it belongs to between paged requests.
+// The current raw block stays valid until the next fetch, so a page may end in the middle of a block.
+type Cursor struct {
+	id          uint64
+	user        string
+	reqID       int64
+	sql         string
+	conn        *commonpool.Conn
+	res         unsafe.Pointer
+	rowsHeader  *wrapper.RowsHeader
+	fieldsCount int
+	precision   int
+	location    *time.Location
+	returnObj   bool
+	block       unsafe.Pointer
+	blockSize   int
+	offset      int
+	pHeaderList []unsafe.Pointer
+	pStartList  []unsafe.Pointer
+	lastAccess  int64
+	sync.Mutex
+}
+
+func (cur *Cursor) touch() {
+	atomic.StoreInt64(&cur.lastAccess, time.Now().UnixNano())
+}
+
+func (cur *Cursor) free(logger *logrus.Entry) {
+	cur.Lock()
+	defer cur.Unlock()
+
+	cur.block = nil
+	if cur.res != nil {
+		logger.Tracef("free cursor result, cursor_id:%d", cur.id)
+		async.FreeResultAsync(cur.res, logger, log.IsDebug())
+		cur.res = nil
+	}
+	if cur.conn != nil {
+		logger.Tracef("put cursor connection, cursor_id:%d", cur.id)
+		if err := cur.conn.Put(); err != nil {
+			logger.Errorf("put cursor connection error, cursor_id:%d, err:%s", cur.id, err)
+		}
+		cur.conn = nil
+	}
+}
+
+// nextBlock fetches the next raw block, it returns 0 when the result is exhausted and a negative number on error.
+func (cur *Cursor) nextBlock(logger *logrus.Entry, isDebug bool, handler *async.Handler) (int, int, string) {
+	result := async.GlobalAsync.TaosFetchRawBlockA(cur.res, logger, isDebug, handler)
+	cur.block = nil
+	cur.blockSize = 0
+	cur.offset = 0
+	if result.N == 0 {
+		logger.Trace("fetch finished")
+		return 0, 0, ""
+	}
+	if result.N < 0 {
+		code := result.N & 0xffff
+		errStr := wrapper.TaosErrorStr(result.Res)
+		logger.Errorf("fetch raw block error, QID:0x%x, cursor_id:%d, code:%d, msg:%s, sql:%s", cur.reqID, cur.id, code, errStr, log.GetLogSql(cur.sql))
+		return result.N, code, errStr
+	}
+	cur.res = result.Res
+	cur.block = wrapper.TaosGetRawBlock(cur.res)
+	cur.blockSize = result.N
+	ctools.RawBlockColumnPointers(cur.block, cur.blockSize, cur.rowsHeader.ColTypes, cur.pHeaderList, cur.pStartList)
+	return result.N, 0, ""
+}
+
+// CursorHolder keeps the open cursors, cursors idle for longer than ttl are closed by the reaper.
+type CursorHolder struct {
+	index    uint64
+	maxCount int
+	ttl      time.Duration
+	cursors  map[uint64]*Cursor
+	exit     chan struct{}
+	sync.RWMutex
+}
+
+func NewCursorHolder(maxCount int, ttl time.Duration) *CursorHolder {
+	return &CursorHolder{
+		maxCount: maxCount,
+		ttl:      ttl,
+		cursors:  make(map[uint64]*Cursor),
+		exit:     make(chan struct{}),
+	}
+}
+
+func (h *CursorHolder) Add(cursor *Cursor) (uint64, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.maxCount > 0 && len(h.cursors) >= h.maxCount {
+		return 0, ErrTooManyCursors
+	}
+	cursor.id = atomic.AddUint64(&h.index, 1)
+	cursor.touch()
+	h.cursors[cursor.id] = cursor
+	return cursor.id, nil
+}
+
+func (h *CursorHolder) Get(id uint64) *Cursor {
+	h.RLock()
+	defer h.RUnlock()
+
+	cursor := h.cursors[id]
+	if cursor != nil {
+		cursor.touch()
+	}
+	return cursor
+}
+
+func (h *CursorHolder) Count() int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.cursors)
+}
+
+// Close removes the cursor and frees its result and connection, it returns false if the cursor does not exist.
+func (h *CursorHolder) Close(id uint64, logger *logrus.Entry) bool {
+	h.Lock()
+	cursor, exist := h.cursors[id]
+	delete(h.cursors, id)
+	h.Unlock()
+	if !exist {
+		return false
+	}
+	cursor.free(logger)
+	return true
+}
+
+func (h *CursorHolder) FreeExpired(now time.Time, logger *logrus.Entry) int {
+	deadline := now.Add(-h.ttl).UnixNano()
+	var expired []*Cursor
+	h.Lock()
+	for id, cursor := range h.cursors {
+		if atomic.LoadInt64(&cursor.lastAccess) < deadline {
+			expired = append(expired, cursor)
+			delete(h.cursors, id)
+		}
+	}
+	h.Unlock()
+	for _, cursor := range expired {
+		logger.Debugf("cursor expired, cursor_id:%d, QID:0x%x", cursor.id, cursor.reqID)
+		cursor.free(logger)
+	}
+	return len(expired)
+}
+
+func (h *CursorHolder) FreeAll(logger *logrus.Entry) {
+	h.Lock()
+	all := h.cursors
+	h.cursors = make(map[uint64]*Cursor)
+	h.Unlock()
+	for _, cursor := range all {
+		cursor.free(logger)
+	}
+}
+
+func (h *CursorHolder) StartReaper(logger *logrus.Entry) {
+	if h.ttl <= 0 {
+		return
+	}
+	interval := h.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.exit:
+				return
+			case now := <-ticker.C:
+				h.FreeExpired(now, logger)
+			}
+		}
+	}()
+}
+
+func (h *CursorHolder) Stop(logger *logrus.Entry) {
+	select {
+	case <-h.exit:
+	default:
+		close(h.exit)
+	}
+	h.FreeAll(logger)
+}
+
+func getFetchSize(c *gin.Context, logger *logrus.Entry) (int, bool) {
+	fetchSize := config.Conf.RestfulCursor.FetchSize
+	if fetchSizeStr := c.Query("fetch_size"); len(fetchSizeStr) != 0 {
+		var err error
+		if fetchSize, err = strconv.Atoi(fetchSizeStr); err != nil || fetchSize <= 0 {
+			logger.Errorf("illegal param, fetch_size must be a positive integer:%s", fetchSizeStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, fetch_size must be a positive integer %s", fetchSizeStr))
+			return 0, false
+		}
+	}
+	if config.Conf.RestfulRowLimit > 0 && fetchSize > config.Conf.RestfulRowLimit {
+		fetchSize = config.Conf.RestfulRowLimit
+	}
+	return fetchSize, true
+}
+
+// executeCursor runs the query and returns the first page together with a cursor id.
+// It returns true when the connection has been handed over to the cursor and must not be put back by the caller.
+func executeCursor(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect *commonpool.Conn, sql string, reqID int64, sqlType sqltype.SqlType, returnObj bool, location *time.Location, fetchSize int) bool {
+	handler := async.GlobalAsync.HandlerPool.Get()
+	defer async.GlobalAsync.HandlerPool.Put(handler)
+	result := async.GlobalAsync.TaosQuery(taosConnect.TaosConnection, logger, isDebug, sql, handler, reqID)
+	res := result.Res
+	code := wrapper.TaosError(res)
+	if code != httperror.SUCCESS {
+		monitor.RestRecordResult(sqlType, false)
+		errStr := wrapper.TaosErrorStr(res)
+		logger.Errorf("taos query error, QID:0x%x, code:%d, msg:%s, sql: %s", reqID, code, errStr, log.GetLogSql(sql))
+		async.FreeResultAsync(res, logger, isDebug)
+		TaosErrorResponse(c, logger, code, errStr)
+		return false
+	}
+	monitor.RestRecordResult(sqlType, true)
+	if wrapper.TaosIsUpdateQuery(res) {
+		writeAffectedRows(c, wrapper.TaosAffectedRows(res), returnObj)
+		async.FreeResultAsync(res, logger, isDebug)
+		return false
+	}
+	if monitor.QueryPaused() {
+		logger.Errorf("query memory exceeds threshold, QID:0x%x", reqID)
+		async.FreeResultAsync(res, logger, isDebug)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, "query memory exceeds threshold")
+		return false
+	}
+	fieldsCount := wrapper.TaosNumFields(res)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		logger.Errorf("read column error, error:%s, sql:%s", err, log.GetLogSql(sql))
+		async.FreeResultAsync(res, logger, isDebug)
+		tError, ok := err.(*tErrors.TaosError)
+		if ok {
+			TaosErrorResponse(c, logger, int(tError.Code), tError.ErrStr)
+		} else {
+			CommonErrorResponse(c, logger, err.Error())
+		}
+		return false
+	}
+	cursor := &Cursor{
+		user:        c.MustGet(UserKey).(string),
+		reqID:       reqID,
+		sql:         sql,
+		conn:        taosConnect,
+		res:         res,
+		rowsHeader:  rowsHeader,
+		fieldsCount: fieldsCount,
+		precision:   wrapper.TaosResultPrecision(res),
+		location:    location,
+		returnObj:   returnObj,
+		pHeaderList: make([]unsafe.Pointer, fieldsCount),
+		pStartList:  make([]unsafe.Pointer, fieldsCount),
+	}
+	id, err := cursors.Add(cursor)
+	if err != nil {
+		logger.Errorf("add cursor error, QID:0x%x, err:%s", reqID, err)
+		async.FreeResultAsync(res, logger, isDebug)
+		ServiceUnavailable(c, logger, err.Error())
+		return false
+	}
+	logger.Debugf("cursor created, cursor_id:%d", id)
+	cursor.Lock()
+	completed := writeCursorPage(c, logger, isDebug, cursor, fetchSize, handler)
+	cursor.Unlock()
+	if completed {
+		cursors.Close(id, logger)
+	}
+	return true
+}
+
+// writeCursorPage writes up to fetchSize rows, the cursor must be locked by the caller.
+// One block is read ahead when the page ends on a block boundary, so "completed" is accurate.
+func writeCursorPage(c *gin.Context, logger *logrus.Entry, isDebug bool, cursor *Cursor, fetchSize int, handler *async.Handler) bool {
+	_, calculateTiming := c.Get(RequireTiming)
+	st := c.MustGet(StartTimeKey)
+	flushTiming := int64(0)
+	w := c.Writer
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	builder := jsonbuilder.BorrowStream(w)
+	defer jsonbuilder.ReturnStream(builder)
+	builder.WritePure(Query2)
+	for i := 0; i < cursor.fieldsCount; i++ {
+		builder.WriteArrayStart()
+		builder.WriteString(cursor.rowsHeader.ColNames[i])
+		builder.WriteMore()
+		builder.WriteString(cursor.rowsHeader.TypeDatabaseName(i))
+		builder.WriteMore()
+		builder.WriteInt64(cursor.rowsHeader.ColLength[i])
+		builder.WriteArrayEnd()
+		if i != cursor.fieldsCount-1 {
+			builder.WriteMore()
+		}
+	}
+	builder.WritePure(Query3)
+	timeBuffer := make([]byte, 0, 30)
+	total := 0
+	completed := false
+	fetchErrCode := 0
+	fetchErrStr := ""
+	var tmpFlushTiming int64
+	var err error
+	for total < fetchSize {
+		if cursor.offset >= cursor.blockSize {
+			n, code, errStr := cursor.nextBlock(logger, isDebug, handler)
+			if n <= 0 {
+				completed = true
+				fetchErrCode, fetchErrStr = code, errStr
+				break
+			}
+		}
+		for ; cursor.offset < cursor.blockSize && total < fetchSize; cursor.offset++ {
+			if total != 0 {
+				builder.WriteMore()
+			}
+			if cursor.returnObj {
+				builder.WriteObjectStart()
+			} else {
+				builder.WriteArrayStart()
+			}
+			for column := 0; column < cursor.fieldsCount; column++ {
+				if cursor.returnObj {
+					builder.WriteObjectField(cursor.rowsHeader.ColNames[column])
+				}
+				ctools.JsonWriteRawBlock(builder, cursor.rowsHeader.ColTypes[column], cursor.pHeaderList[column], cursor.pStartList[column], cursor.offset, cursor.precision, cursor.location, timeBuffer, logger)
+				if column != cursor.fieldsCount-1 {
+					builder.WriteMore()
+				}
+			}
+			if cursor.returnObj {
+				builder.WriteObjectEnd()
+			} else {
+				builder.WriteArrayEnd()
+			}
+			total += 1
+			tmpFlushTiming, err = tryFlush(w, builder, calculateTiming)
+			if err != nil {
+				return true
+			}
+			flushTiming += tmpFlushTiming
+		}
+	}
+	if !completed && cursor.offset >= cursor.blockSize {
+		n, code, errStr := cursor.nextBlock(logger, isDebug, handler)
+		if n <= 0 {
+			completed = true
+			fetchErrCode, fetchErrStr = code, errStr
+		}
+	}
+	builder.WritePure(Query4)
+	builder.WriteInt(total)
+	builder.WritePure(CursorIDField)
+	builder.WriteUint64(cursor.id)
+	builder.WritePure(CursorCompletedField)
+	builder.WriteBool(completed)
+	if calculateTiming {
+		builder.WritePure(Timing)
+		builder.WriteInt64(time.Now().UnixNano() - st.(int64) - flushTiming)
+	}
+	if fetchErrCode != 0 {
+		writeFetchError(builder, fetchErrCode, fetchErrStr)
+	}
+	builder.WriteObjectEnd()
+	err = forceFlush(w, builder)
+	if err != nil {
+		logger.Errorf("force flush error:%s", err)
+	}
+	return completed
+}
+
+func getCursor(c *gin.Context, logger *logrus.Entry) (uint64, *Cursor) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		logger.Errorf("illegal param, cursor id must be numeric:%s", c.Param("id"))
+		BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, cursor id must be numeric %s", c.Param("id")))
+		return 0, nil
+	}
+	cursor := cursors.Get(id)
+	// cursors of other users are reported as not found
+	if cursor == nil || cursor.user != c.MustGet(UserKey).(string) {
+		logger.Errorf("cursor not found, cursor_id:%d", id)
+		ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "cursor not found")
+		return id, nil
+	}
+	return id, cursor
+}
+
+// @Tags rest
+// @Summary fetch cursor
+// @Description fetch the next page of a cursor created by /rest/sql?cursor=true
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Param fetch_size query int false "number of rows to fetch"
+// @Success 200 {object} TDEngineRestfulRespDoc
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "cursor not found"
+// @Router /rest/cursor/:id [get]
+func (ctl *Restful) fetchCursor(c *gin.Context) {
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	isDebug := log.IsDebug()
+	fetchSize, ok := getFetchSize(c, logger)
+	if !ok {
+		return
+	}
+	id, cursor := getCursor(c, logger)
+	if cursor == nil {
+		return
+	}
+	if monitor.QueryPaused() {
+		logger.Errorf("query memory exceeds threshold, cursor_id:%d", id)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, "query memory exceeds threshold")
+		return
+	}
+	cursor.Lock()
+	if cursor.res == nil {
+		cursor.Unlock()
+		logger.Errorf("cursor has been closed, cursor_id:%d", id)
+		ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "cursor not found")
+		return
+	}
+	handler := async.GlobalAsync.HandlerPool.Get()
+	defer async.GlobalAsync.HandlerPool.Put(handler)
+	completed := writeCursorPage(c, logger, isDebug, cursor, fetchSize, handler)
+	cursor.touch()
+	cursor.Unlock()
+	if completed {
+		cursors.Close(id, logger)
+	}
+}
+
+// @Tags rest
+// @Summary close cursor
+// @Description close a cursor and release its result
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Success 200 {object} Message
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "cursor not found"
+// @Router /rest/cursor/:id [delete]
+func (ctl *Restful) closeCursor(c *gin.Context) {
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	id, cursor := getCursor(c, logger)
+	if cursor == nil {
+		return
+	}
+	if !cursors.Close(id, logger) {
+		ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "cursor not found")
+		return
+	}
+	logger.Debugf("cursor closed, cursor_id:%d", id)
+	c.JSON(http.StatusOK, &Message{Code: 0})
+}
@@ -1,13 +1,17 @@
 package rest
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
 	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
 	"github.com/taosdata/taosadapter/v3/tools/web"
 )
 
@@ -94,6 +98,24 @@ func ServiceUnavailable(c *gin.Context, logger *logrus.Entry, msg string) {
 	errorResp(c, logger, http.StatusServiceUnavailable, 0xffff, msg)
 }
 
+// ConnectionErrorResponse responds with the error returned by commonpool.GetConnection.
+func ConnectionErrorResponse(c *gin.Context, logger *logrus.Entry, err error) {
+	if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+		ForbiddenResponse(c, logger, commonpool.ErrWhitelistForbidden.Error())
+		return
+	}
+	if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
+		ServiceUnavailable(c, logger, err.Error())
+		return
+	}
+	var tError *tErrors.TaosError
+	if errors.As(err, &tError) {
+		TaosErrorResponse(c, logger, int(tError.Code), tError.ErrStr)
+		return
+	}
+	CommonErrorResponse(c, logger, err.Error())
+}
+
 type MessageWithTiming struct {
 	Code   int    `json:"code"`
 	Desc   string `json:"desc"`
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/tools/exporter"
+)
+
+const (
+	TrailerCode = "X-Taos-Code"
+	TrailerDesc = "X-Taos-Desc"
+	TrailerRows = "X-Taos-Rows"
+)
+
+// exportResult streams the query result in csv, ndjson or arrow format.
+// The result code, error message and row count are sent as HTTP trailers since the body has no place for them.
+func exportResult(c *gin.Context, logger *logrus.Entry, isDebug bool, res unsafe.Pointer, handler *async.Handler, sql string, reqID int64, format string, location *time.Location) {
+	if monitor.QueryPaused() {
+		logger.Errorf("query memory exceeds threshold, QID:0x%x", reqID)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, "query memory exceeds threshold")
+		return
+	}
+	fieldsCount := wrapper.TaosNumFields(res)
+	logger.Tracef("get fieldsCount:%d", fieldsCount)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		logger.Errorf("read column error, error:%s, sql:%s", err, log.GetLogSql(sql))
+		tError, ok := err.(*tErrors.TaosError)
+		if ok {
+			TaosErrorResponse(c, logger, int(tError.Code), tError.ErrStr)
+		} else {
+			CommonErrorResponse(c, logger, err.Error())
+		}
+		return
+	}
+	columns := make([]exporter.Column, fieldsCount)
+	for i := 0; i < fieldsCount; i++ {
+		columns[i] = exporter.Column{
+			Name:   rowsHeader.ColNames[i],
+			Type:   rowsHeader.ColTypes[i],
+			Length: rowsHeader.ColLength[i],
+		}
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	logger.Tracef("get precision:%d", precision)
+	w := c.Writer
+	e, err := exporter.New(format, w, columns, precision, location, logger)
+	if err != nil {
+		logger.Errorf("create exporter error, format:%s, err:%s", format, err)
+		CommonErrorResponse(c, logger, err.Error())
+		return
+	}
+	defer e.Release()
+	c.Header("Content-Type", e.ContentType())
+	c.Header("Trailer", TrailerCode+", "+TrailerDesc+", "+TrailerRows)
+	w.WriteHeader(http.StatusOK)
+	if err = e.WriteHeader(); err != nil {
+		logger.Errorf("write export header error, err:%s", err)
+		return
+	}
+	total := 0
+	code := 0
+	desc := ""
+	for {
+		if config.Conf.RestfulRowLimit > -1 && total >= config.Conf.RestfulRowLimit {
+			break
+		}
+		result := async.GlobalAsync.TaosFetchRawBlockA(res, logger, isDebug, handler)
+		if result.N == 0 {
+			logger.Trace("fetch finished")
+			break
+		}
+		if result.N < 0 {
+			code = result.N & 0xffff
+			desc = wrapper.TaosErrorStr(result.Res)
+			logger.Errorf("fetch raw block error, QID:0x%x, code:%d, msg:%s, rows fetched:%d, sql:%s", reqID, code, desc, total, log.GetLogSql(sql))
+			break
+		}
+		res = result.Res
+		rows := result.N
+		if config.Conf.RestfulRowLimit > -1 && total+rows > config.Conf.RestfulRowLimit {
+			rows = config.Conf.RestfulRowLimit - total
+		}
+		block := wrapper.TaosGetRawBlock(res)
+		if err = e.WriteBlock(block, result.N, rows); err != nil {
+			logger.Errorf("write export block error, err:%s", err)
+			return
+		}
+		w.Flush()
+		total += rows
+	}
+	if err = e.Close(); err != nil {
+		logger.Errorf("close exporter error, err:%s", err)
+		return
+	}
+	w.Header().Set(TrailerCode, strconv.Itoa(code))
+	w.Header().Set(TrailerDesc, desc)
+	w.Header().Set(TrailerRows, strconv.Itoa(total))
+	w.Flush()
+	logger.Trace("send response finished")
+}
@@ -16,19 +16,19 @@ import (
 	"github.com/taosdata/taosadapter/v3/config"
 	"github.com/taosdata/taosadapter/v3/controller"
 	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
 	"github.com/taosdata/taosadapter/v3/db/commonpool"
 	"github.com/taosdata/taosadapter/v3/db/syncinterface"
 	"github.com/taosdata/taosadapter/v3/driver/common"
-	"github.com/taosdata/taosadapter/v3/driver/common/parser"
 	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
 	"github.com/taosdata/taosadapter/v3/driver/wrapper"
 	"github.com/taosdata/taosadapter/v3/httperror"
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
-	"github.com/taosdata/taosadapter/v3/tools"
 	"github.com/taosdata/taosadapter/v3/tools/connectpool"
 	"github.com/taosdata/taosadapter/v3/tools/csv"
 	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/exporter"
 	"github.com/taosdata/taosadapter/v3/tools/generator"
 	"github.com/taosdata/taosadapter/v3/tools/iptool"
 	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
@@ -65,6 +65,19 @@ func (ctl *Restful) Init(r gin.IRouter) {
 	api.POST("sql/:db/vgid", prepareCtx, CheckAuth, ctl.tableVgID)
 	api.GET("login/:user/:password", prepareCtx, ctl.des)
 	api.POST("upload", prepareCtx, CheckAuth, ctl.upload)
+	api.POST("batch", prepareCtx, CheckAuth, ctl.batch)
+	api.POST("batch/:db", prepareCtx, CheckAuth, ctl.batch)
+	api.POST("stmt", prepareCtx, CheckAuth, ctl.stmt)
+	api.POST("stmt/:db", prepareCtx, CheckAuth, ctl.stmt)
+	api.GET("cursor/:id", prepareCtx, CheckAuth, ctl.fetchCursor)
+	api.POST("cursor/:id", prepareCtx, CheckAuth, ctl.fetchCursor)
+	api.DELETE("cursor/:id", prepareCtx, CheckAuth, ctl.closeCursor)
+	cursors = NewCursorHolder(config.Conf.RestfulCursor.MaxCount, config.Conf.RestfulCursor.TTL)
+	cursors.StartReaper(logger)
+	api.GET("tmq/:group/:topic/events", prepareCtx, CheckAuth, ctl.tmqEvents)
+	api.POST("tmq/:group/:topic/commit", prepareCtx, CheckAuth, ctl.tmqCommit)
+	tmqConsumers = tmqconsumer.NewHolder(config.Conf.RestfulTMQ.MaxCount, config.Conf.RestfulTMQ.TTL)
+	tmqConsumers.StartReaper(logger)
 }
 
 func prepareCtx(c *gin.Context) {
@@ -112,17 +125,46 @@ type TDEngineRestfulRespDoc struct {
 // @Router /rest/sql [post]
 func (ctl *Restful) sql(c *gin.Context) {
 	db := c.Param("db")
-	var err error
 	logger := c.MustGet(LoggerKey).(*logrus.Entry)
 	reqID := c.MustGet(config.ReqIDKey).(int64)
+	location, returnObj, format, ok := parseResultOptions(c, logger)
+	if !ok {
+		return
+	}
+	fetchSize := 0
+	if cursorStr := c.Query("cursor"); len(cursorStr) != 0 {
+		useCursor, err := strconv.ParseBool(cursorStr)
+		if err != nil {
+			logger.Tracef("illegal param, cursor must be boolean:%s", cursorStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, cursor must be boolean %s", err.Error()))
+			return
+		}
+		if useCursor {
+			if format != exporter.FormatJSON {
+				logger.Errorf("illegal param, cursor only supports json format, format:%s", format)
+				BadRequestResponseWithMsg(c, logger, 0xffff, "illegal param, cursor only supports json format")
+				return
+			}
+			if fetchSize, ok = getFetchSize(c, logger); !ok {
+				return
+			}
+		}
+	}
+
+	DoQuery(c, db, location, reqID, returnObj, format, fetchSize, logger)
+}
+
+// parseResultOptions reads the query parameters that control how a result is returned.
+func parseResultOptions(c *gin.Context, logger *logrus.Entry) (location *time.Location, returnObj bool, format string, ok bool) {
+	var err error
 	connTimezone, exists := c.GetQuery("conn_tz")
-	location := time.UTC
+	location = time.UTC
 	if exists {
 		location, err = time.LoadLocation(connTimezone)
 		if err != nil {
 			logger.Errorf("load conn_tz location:%s fail, error:%s", connTimezone, err)
 			BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
-			return
+			return nil, false, "", false
 		}
 	} else {
 		timezone, exists := c.GetQuery("tz")
@@ -131,21 +173,26 @@ func (ctl *Restful) sql(c *gin.Context) {
 			if err != nil {
 				logger.Errorf("load tz location:%s fail, error:%s", timezone, err)
 				BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
-				return
+				return nil, false, "", false
 			}
 		}
 	}
 
-	var returnObj bool
 	if returnObjStr := c.Query("row_with_meta"); len(returnObjStr) != 0 {
 		if returnObj, err = strconv.ParseBool(returnObjStr); err != nil {
 			logger.Tracef("illegal param, row_with_meta must be boolean:%s", returnObjStr)
 			BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, row_with_meta must be boolean %s", err.Error()))
-			return
+			return nil, false, "", false
 		}
 	}
 
-	DoQuery(c, db, location, reqID, returnObj, logger)
+	format, err = exporter.Negotiate(c.Query("format"), c.GetHeader("Accept"))
+	if err != nil {
+		logger.Errorf("illegal param, format:%s, err:%s", c.Query("format"), err)
+		BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+		return nil, false, "", false
+	}
+	return location, returnObj, format, true
 }
 
 type TDEngineRestfulResp struct {
@@ -156,7 +203,8 @@ type TDEngineRestfulResp struct {
 	Rows       int              `json:"rows,omitempty"`
 }
 
-func DoQuery(c *gin.Context, db string, location *time.Location, reqID int64, returnObj bool, logger *logrus.Entry) {
+// DoQuery executes the sql in the request body, a positive fetchSize returns the first page of a cursor instead of the whole result.
+func DoQuery(c *gin.Context, db string, location *time.Location, reqID int64, returnObj bool, format string, fetchSize int, logger *logrus.Entry) {
 	var s time.Time
 	isDebug := log.IsDebug()
 	b, err := c.GetRawData()
@@ -206,7 +254,12 @@ func DoQuery(c *gin.Context, db string, location *time.Location, reqID int64, re
 		CommonErrorResponse(c, logger, err.Error())
 		return
 	}
+	held := false
 	defer func() {
+		if held {
+			logger.Trace("connection is held by cursor")
+			return
+		}
 		s = log.GetLogNow(isDebug)
 		logger.Trace("put connection")
 		err := taosConnect.Put()
@@ -227,7 +280,11 @@ func DoQuery(c *gin.Context, db string, location *time.Location, reqID int64, re
 		logger.Tracef("select db %s", db)
 		_ = async.GlobalAsync.TaosExecWithoutResult(taosConnect.TaosConnection, logger, isDebug, fmt.Sprintf("use `%s`", db), reqID)
 	}
-	execute(c, logger, isDebug, taosConnect.TaosConnection, sql, reqID, sqlType, returnObj, location)
+	if fetchSize > 0 {
+		held = executeCursor(c, logger, isDebug, taosConnect, sql, reqID, sqlType, returnObj, location, fetchSize)
+		return
+	}
+	execute(c, logger, isDebug, taosConnect.TaosConnection, sql, reqID, sqlType, returnObj, format, location)
 }
 
 func trySetConnectionOptions(c *gin.Context, conn unsafe.Pointer, logger *logrus.Entry, isDebug bool) bool {
@@ -259,12 +316,11 @@ var (
 	Query3               = []byte(`],"data":[`)
 	Query4               = []byte(`],"rows":`)
 	Timing               = []byte(`,"timing":`)
+	FetchErrorCode       = []byte(`,"code":`)
+	FetchErrorDesc       = []byte(`,"desc":`)
 )
 
-func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect unsafe.Pointer, sql string, reqID int64, sqlType sqltype.SqlType, returnObj bool, location *time.Location) {
-	_, calculateTiming := c.Get(RequireTiming)
-	st := c.MustGet(StartTimeKey)
-	flushTiming := int64(0)
+func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect unsafe.Pointer, sql string, reqID int64, sqlType sqltype.SqlType, returnObj bool, format string, location *time.Location) {
 	handler := async.GlobalAsync.HandlerPool.Get()
 	defer async.GlobalAsync.HandlerPool.Put(handler)
 	result := async.GlobalAsync.TaosQuery(taosConnect, logger, isDebug, sql, handler, reqID)
@@ -285,55 +341,22 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 	monitor.RestRecordResult(sqlType, true)
 	isUpdate := wrapper.TaosIsUpdateQuery(res)
 	logger.Tracef("sql isUpdate:%t", isUpdate)
-	w := c.Writer
-	c.Header("Content-Type", "application/json; charset=utf-8")
-	c.Header("Transfer-Encoding", "chunked")
-	w.WriteHeader(http.StatusOK)
 	if isUpdate {
 		affectRows := wrapper.TaosAffectedRows(res)
 		logger.Tracef("sql affectRows:%d", affectRows)
-		var err error
-		if returnObj {
-			_, err = w.Write(ExecObjHeader)
-		} else {
-			_, err = w.Write(ExecHeader)
-		}
-		if err != nil {
-			return
-		}
-		_, err = w.Write([]byte(strconv.Itoa(affectRows)))
-		if err != nil {
-			return
-		}
-		if calculateTiming {
-			if returnObj {
-				_, err = w.Write(ExecObjEndWithTiming)
-			} else {
-				_, err = w.Write(ExecEndWithTiming)
-			}
-			if err != nil {
-				return
-			}
-			_, err = w.Write([]byte(strconv.FormatInt(time.Now().UnixNano()-st.(int64), 10)))
-			if err != nil {
-				return
-			}
-			_, err = w.Write([]byte{'}'})
-			if err != nil {
-				return
-			}
-			w.Flush()
-		} else {
-			if returnObj {
-				_, err = w.Write(ExecObjEnd)
-			} else {
-				_, err = w.Write(ExecEnd)
-			}
-			if err != nil {
-				return
-			}
-			w.Flush()
-		}
+		writeAffectedRows(c, affectRows, returnObj)
+		return
+	}
+	writeQueryResult(c, logger, isDebug, res, handler, sql, reqID, returnObj, format, location)
+}
+
+// writeQueryResult streams the result set of res, the caller owns res and frees it afterwards.
+func writeQueryResult(c *gin.Context, logger *logrus.Entry, isDebug bool, res unsafe.Pointer, handler *async.Handler, sql string, reqID int64, returnObj bool, format string, location *time.Location) {
+	_, calculateTiming := c.Get(RequireTiming)
+	st := c.MustGet(StartTimeKey)
+	flushTiming := int64(0)
+	if format != exporter.FormatJSON {
+		exportResult(c, logger, isDebug, res, handler, sql, reqID, format, location)
 		return
 	}
 	if monitor.QueryPaused() {
@@ -354,6 +377,10 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 		}
 		return
 	}
+	w := c.Writer
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
 	builder := jsonbuilder.BorrowStream(w)
 	defer jsonbuilder.ReturnStream(builder)
 	builder.WritePure(Query2)
@@ -385,17 +412,21 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 	pHeaderList := make([]unsafe.Pointer, fieldsCount)
 	pStartList := make([]unsafe.Pointer, fieldsCount)
 	timeBuffer := make([]byte, 0, 30)
+	fetchErrCode := 0
+	fetchErrStr := ""
 	for {
 		if config.Conf.RestfulRowLimit > -1 && total == config.Conf.RestfulRowLimit {
 			break
 		}
-		result = async.GlobalAsync.TaosFetchRawBlockA(res, logger, isDebug, handler)
+		result := async.GlobalAsync.TaosFetchRawBlockA(res, logger, isDebug, handler)
 		if result.N == 0 {
 			logger.Trace("fetch finished")
 			break
 		}
 		if result.N < 0 {
-			logger.Tracef("fetch error, result.N:%d", result.N)
+			fetchErrCode = result.N & 0xffff
+			fetchErrStr = wrapper.TaosErrorStr(result.Res)
+			logger.Errorf("fetch raw block error, QID:0x%x, code:%d, msg:%s, rows fetched:%d, sql:%s", reqID, fetchErrCode, fetchErrStr, total, log.GetLogSql(sql))
 			break
 		}
 		res = result.Res
@@ -408,20 +439,7 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 		block := wrapper.TaosGetRawBlock(res)
 		logger.Trace("start parse block")
 		blockSize := result.N
-		nullBitMapOffset := uintptr(ctools.BitmapLen(blockSize))
-		lengthOffset := parser.RawBlockGetColumnLengthOffset(fieldsCount)
-		tmpPHeader := tools.AddPointer(block, parser.RawBlockGetColDataOffset(fieldsCount))
-		for column := 0; column < fieldsCount; column++ {
-			colLength := *((*int32)(unsafe.Pointer(uintptr(block) + lengthOffset + uintptr(column)*parser.Int32Size)))
-			if ctools.IsVarDataType(rowsHeader.ColTypes[column]) {
-				pHeaderList[column] = tmpPHeader
-				pStartList[column] = tools.AddPointer(tmpPHeader, uintptr(4*blockSize))
-			} else {
-				pHeaderList[column] = tmpPHeader
-				pStartList[column] = tools.AddPointer(tmpPHeader, nullBitMapOffset)
-			}
-			tmpPHeader = tools.AddPointer(pStartList[column], uintptr(colLength))
-		}
+		ctools.RawBlockColumnPointers(block, blockSize, rowsHeader.ColTypes, pHeaderList, pStartList)
 
 		for row := 0; row < result.N; row++ {
 			if returnObj {
@@ -467,6 +485,9 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 		builder.WritePure(Timing)
 		builder.WriteInt64(time.Now().UnixNano() - st.(int64) - flushTiming)
 	}
+	if fetchErrCode != 0 {
+		writeFetchError(builder, fetchErrCode, fetchErrStr)
+	}
 	builder.WriteObjectEnd()
 	err = forceFlush(w, builder)
 	if err != nil {
@@ -475,6 +496,68 @@ func execute(c *gin.Context, logger *logrus.Entry, isDebug bool, taosConnect uns
 	logger.Trace("send response finished")
 }
 
+// writeAffectedRows writes the affected rows of an update query.
+func writeAffectedRows(c *gin.Context, affectRows int, returnObj bool) {
+	_, calculateTiming := c.Get(RequireTiming)
+	st := c.MustGet(StartTimeKey)
+	w := c.Writer
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	var err error
+	if returnObj {
+		_, err = w.Write(ExecObjHeader)
+	} else {
+		_, err = w.Write(ExecHeader)
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.Write([]byte(strconv.Itoa(affectRows)))
+	if err != nil {
+		return
+	}
+	if calculateTiming {
+		if returnObj {
+			_, err = w.Write(ExecObjEndWithTiming)
+		} else {
+			_, err = w.Write(ExecEndWithTiming)
+		}
+		if err != nil {
+			return
+		}
+		_, err = w.Write([]byte(strconv.FormatInt(time.Now().UnixNano()-st.(int64), 10)))
+		if err != nil {
+			return
+		}
+		_, err = w.Write([]byte{'}'})
+		if err != nil {
+			return
+		}
+		w.Flush()
+	} else {
+		if returnObj {
+			_, err = w.Write(ExecObjEnd)
+		} else {
+			_, err = w.Write(ExecEnd)
+		}
+		if err != nil {
+			return
+		}
+		w.Flush()
+	}
+}
+
+// writeFetchError appends the fetch error after the rows. The header has already been sent with code 0,
+// the trailing "code" and "desc" override it for JSON decoders that keep the last duplicate key,
+// so a truncated result can be told apart from a complete one.
+func writeFetchError(builder *jsonbuilder.Stream, code int, desc string) {
+	builder.WritePure(FetchErrorCode)
+	builder.WriteInt(code)
+	builder.WritePure(FetchErrorDesc)
+	builder.WriteString(desc)
+}
+
 func tryFlush(w gin.ResponseWriter, builder *jsonbuilder.Stream, calculateTiming bool) (int64, error) {
 	if builder.Buffered() > 16352 {
 		err := builder.Flush()
@@ -764,6 +847,12 @@ func (ctl *Restful) des(c *gin.Context) {
 }
 
 func (ctl *Restful) Close() {
+	if cursors != nil {
+		cursors.Stop(logger)
+	}
+	if tmqConsumers != nil {
+		tmqConsumers.Stop()
+	}
 }
 
 func init() {
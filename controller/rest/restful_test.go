@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/apache/arrow/go/arrow/ipc"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -21,6 +22,7 @@ import (
 	"github.com/taosdata/taosadapter/v3/db"
 	"github.com/taosdata/taosadapter/v3/httperror"
 	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
 	"github.com/taosdata/taosadapter/v3/tools/layout"
 )
 
@@ -770,3 +772,112 @@ func checkResp(t *testing.T, w *httptest.ResponseRecorder) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, result.Code)
 }
+
+func TestWriteFetchError(t *testing.T) {
+	var buf bytes.Buffer
+	builder := jsonbuilder.BorrowStream(&buf)
+	defer jsonbuilder.ReturnStream(builder)
+	builder.WritePure(Query2)
+	builder.WritePure([]byte(`["ts","TIMESTAMP",8]`))
+	builder.WritePure(Query3)
+	builder.WritePure([]byte(`["2024-01-01T00:00:00.000Z"]`))
+	builder.WritePure(Query4)
+	builder.WriteInt(1)
+	writeFetchError(builder, 0x2603, "query killed")
+	builder.WriteObjectEnd()
+	assert.NoError(t, builder.Flush())
+	var result TDEngineRestfulRespDoc
+	err := json.Unmarshal(buf.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, 0x2603, result.Code)
+	assert.Equal(t, "query killed", result.Desc)
+	assert.Equal(t, 1, result.Rows)
+	assert.Equal(t, 1, len(result.Data))
+}
+
+func TestWrongFormat(t *testing.T) {
+	w := httptest.NewRecorder()
+	body := strings.NewReader("show databases")
+	req, _ := http.NewRequest(http.MethodPost, "/rest/sql?format=xml", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportFormat(t *testing.T) {
+	w := httptest.NewRecorder()
+	body := strings.NewReader("create database if not exists rest_test_export")
+	req, _ := http.NewRequest(http.MethodPost, "/rest/sql", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	checkResp(t, w)
+	defer func() {
+		w := httptest.NewRecorder()
+		body := strings.NewReader("drop database if exists rest_test_export")
+		req, _ := http.NewRequest(http.MethodPost, "/rest/sql", body)
+		req.RemoteAddr = "127.0.0.1:33333"
+		req.SetBasicAuth("root", "taosdata")
+		router.ServeHTTP(w, req)
+		checkResp(t, w)
+	}()
+	w = httptest.NewRecorder()
+	body = strings.NewReader("create table if not exists t1(ts timestamp, v1 int, v2 nchar(20))")
+	req, _ = http.NewRequest(http.MethodPost, "/rest/sql/rest_test_export", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	checkResp(t, w)
+	w = httptest.NewRecorder()
+	body = strings.NewReader("insert into t1 values('2024-01-01 00:00:00.000Z', 1, 'a')('2024-01-01 00:00:01.000Z', null, '中文')")
+	req, _ = http.NewRequest(http.MethodPost, "/rest/sql/rest_test_export", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	checkResp(t, w)
+
+	// csv
+	w = httptest.NewRecorder()
+	body = strings.NewReader("select * from t1 order by ts")
+	req, _ = http.NewRequest(http.MethodPost, "/rest/sql/rest_test_export?format=csv", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "ts,v1,v2\n2024-01-01T00:00:00.000Z,1,a\n2024-01-01T00:00:01.000Z,,中文\n", w.Body.String())
+	trailer := w.Result().Trailer
+	assert.Equal(t, "0", trailer.Get(TrailerCode))
+	assert.Equal(t, "2", trailer.Get(TrailerRows))
+
+	// ndjson by accept header
+	w = httptest.NewRecorder()
+	body = strings.NewReader("select * from t1 order by ts")
+	req, _ = http.NewRequest(http.MethodPost, "/rest/sql/rest_test_export", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	req.Header.Set("Accept", "application/x-ndjson")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"ts":"2024-01-01T00:00:00.000Z","v1":1,"v2":"a"}`+"\n"+`{"ts":"2024-01-01T00:00:01.000Z","v1":null,"v2":"中文"}`+"\n", w.Body.String())
+
+	// arrow
+	w = httptest.NewRecorder()
+	body = strings.NewReader("select * from t1 order by ts")
+	req, _ = http.NewRequest(http.MethodPost, "/rest/sql/rest_test_export?format=arrow", body)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apache.arrow.stream", w.Header().Get("Content-Type"))
+	reader, err := ipc.NewReader(w.Body)
+	assert.NoError(t, err)
+	rows := int64(0)
+	for reader.Next() {
+		rows += reader.Record().NumRows()
+	}
+	reader.Release()
+	assert.Equal(t, int64(2), rows)
+}
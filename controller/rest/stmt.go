@@ -0,0 +1,415 @@
+package rest
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+)
+
+type StmtRequest struct {
+	SQL    string          `json:"sql"`
+	Params json.RawMessage `json:"params"`
+}
+
+// StmtTableParams is the bind data of one table in an insert statement, rows are in row format.
+type StmtTableParams struct {
+	TableName string          `json:"table_name"`
+	Tags      []interface{}   `json:"tags"`
+	Rows      [][]interface{} `json:"rows"`
+}
+
+func decodeParams(data json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// parseQueryParams converts the params of a query statement, one value for each placeholder.
+func parseQueryParams(data json.RawMessage) ([]*stmt.TaosStmt2BindData, error) {
+	var params []interface{}
+	if err := decodeParams(data, &params); err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+	cols := make([][]driver.Value, len(params))
+	for i, param := range params {
+		switch v := param.(type) {
+		case nil:
+			return nil, fmt.Errorf("param %d: null is not allowed in query statement", i)
+		case bool, string:
+			cols[i] = []driver.Value{v}
+		case json.Number:
+			if intValue, err := v.Int64(); err == nil {
+				cols[i] = []driver.Value{intValue}
+			} else if floatValue, err := v.Float64(); err == nil {
+				cols[i] = []driver.Value{floatValue}
+			} else {
+				return nil, fmt.Errorf("param %d: invalid number %s", i, v)
+			}
+		default:
+			return nil, fmt.Errorf("param %d: unsupported type %T", i, param)
+		}
+	}
+	return []*stmt.TaosStmt2BindData{{Cols: cols}}, nil
+}
+
+// parseInsertParams converts the params of an insert statement according to the fields returned by taos_stmt2_get_fields.
+func parseInsertParams(data json.RawMessage, fields []*stmt.Stmt2AllField) ([]*stmt.TaosStmt2BindData, error) {
+	var tables []*StmtTableParams
+	if err := decodeParams(data, &tables); err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, errors.New("params is empty")
+	}
+	var colFields, tagFields []*stmt.Stmt2AllField
+	for _, field := range fields {
+		switch field.BindType {
+		case stmt.TAOS_FIELD_COL:
+			colFields = append(colFields, field)
+		case stmt.TAOS_FIELD_TAG:
+			tagFields = append(tagFields, field)
+		}
+	}
+	bindData := make([]*stmt.TaosStmt2BindData, len(tables))
+	for i, table := range tables {
+		if table == nil {
+			return nil, fmt.Errorf("table %d: params is null", i)
+		}
+		if len(table.Tags) != len(tagFields) {
+			return nil, fmt.Errorf("table %d: tag count not match, got %d, expect %d", i, len(table.Tags), len(tagFields))
+		}
+		data := &stmt.TaosStmt2BindData{TableName: table.TableName}
+		if len(tagFields) > 0 {
+			data.Tags = make([]driver.Value, len(tagFields))
+			for j, tag := range table.Tags {
+				v, err := convertStmtValue(tag, tagFields[j])
+				if err != nil {
+					return nil, fmt.Errorf("table %d, tag %s: %s", i, tagFields[j].Name, err)
+				}
+				data.Tags[j] = v
+			}
+		}
+		if len(colFields) > 0 {
+			if len(table.Rows) == 0 {
+				return nil, fmt.Errorf("table %d: rows is empty", i)
+			}
+			// rows are transposed to column format
+			data.Cols = make([][]driver.Value, len(colFields))
+			for j := range colFields {
+				data.Cols[j] = make([]driver.Value, len(table.Rows))
+			}
+			for rowIndex, row := range table.Rows {
+				if len(row) != len(colFields) {
+					return nil, fmt.Errorf("table %d, row %d: column count not match, got %d, expect %d", i, rowIndex, len(row), len(colFields))
+				}
+				for j, value := range row {
+					v, err := convertStmtValue(value, colFields[j])
+					if err != nil {
+						return nil, fmt.Errorf("table %d, row %d, column %s: %s", i, rowIndex, colFields[j].Name, err)
+					}
+					data.Cols[j][rowIndex] = v
+				}
+			}
+		}
+		bindData[i] = data
+	}
+	return bindData, nil
+}
+
+// convertStmtValue converts a JSON value to the Go type expected by wrapper.TaosStmt2BindParam for the field.
+func convertStmtValue(value interface{}, field *stmt.Stmt2AllField) (driver.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch field.FieldType {
+	case common.TSDB_DATA_TYPE_BOOL:
+		v, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expect bool, but got %v", value)
+		}
+		return v, nil
+	case common.TSDB_DATA_TYPE_TINYINT, common.TSDB_DATA_TYPE_SMALLINT, common.TSDB_DATA_TYPE_INT, common.TSDB_DATA_TYPE_BIGINT:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expect integer, but got %v", value)
+		}
+		v, err := number.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("expect integer, but got %s", number)
+		}
+		switch field.FieldType {
+		case common.TSDB_DATA_TYPE_TINYINT:
+			if v < math.MinInt8 || v > math.MaxInt8 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return int8(v), nil
+		case common.TSDB_DATA_TYPE_SMALLINT:
+			if v < math.MinInt16 || v > math.MaxInt16 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return int16(v), nil
+		case common.TSDB_DATA_TYPE_INT:
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return int32(v), nil
+		default:
+			return v, nil
+		}
+	case common.TSDB_DATA_TYPE_UTINYINT, common.TSDB_DATA_TYPE_USMALLINT, common.TSDB_DATA_TYPE_UINT, common.TSDB_DATA_TYPE_UBIGINT:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expect unsigned integer, but got %v", value)
+		}
+		v, err := strconv.ParseUint(number.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expect unsigned integer, but got %s", number)
+		}
+		switch field.FieldType {
+		case common.TSDB_DATA_TYPE_UTINYINT:
+			if v > math.MaxUint8 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return uint8(v), nil
+		case common.TSDB_DATA_TYPE_USMALLINT:
+			if v > math.MaxUint16 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return uint16(v), nil
+		case common.TSDB_DATA_TYPE_UINT:
+			if v > math.MaxUint32 {
+				return nil, fmt.Errorf("value %d out of range", v)
+			}
+			return uint32(v), nil
+		default:
+			return v, nil
+		}
+	case common.TSDB_DATA_TYPE_FLOAT, common.TSDB_DATA_TYPE_DOUBLE:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expect number, but got %v", value)
+		}
+		v, err := number.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("expect number, but got %s", number)
+		}
+		if field.FieldType == common.TSDB_DATA_TYPE_FLOAT {
+			return float32(v), nil
+		}
+		return v, nil
+	case common.TSDB_DATA_TYPE_TIMESTAMP:
+		switch v := value.(type) {
+		case json.Number:
+			// timestamp in the precision of the database
+			ts, err := v.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("expect integer timestamp, but got %s", v)
+			}
+			return ts, nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("expect RFC3339 timestamp, but got %s", v)
+			}
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expect timestamp, but got %v", value)
+		}
+	case common.TSDB_DATA_TYPE_BINARY, common.TSDB_DATA_TYPE_NCHAR:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expect string, but got %v", value)
+		}
+		return v, nil
+	case common.TSDB_DATA_TYPE_VARBINARY, common.TSDB_DATA_TYPE_GEOMETRY:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expect hex string, but got %v", value)
+		}
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("expect hex string, but got %s", v)
+		}
+		return b, nil
+	case common.TSDB_DATA_TYPE_JSON:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported field type %d", field.FieldType)
+}
+
+// @Tags rest
+// @Summary execute parameterized sql
+// @Description execute a statement with `?` placeholders, the params are bound through stmt2
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Success 200 {object} TDEngineRestfulRespDoc
+// @Failure 401 {string} string "unauthorized"
+// @Failure 500 {string} string "internal error"
+// @Router /rest/stmt/:db [post]
+// @Router /rest/stmt [post]
+func (ctl *Restful) stmt(c *gin.Context) {
+	db := c.Param("db")
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	reqID := c.MustGet(config.ReqIDKey).(int64)
+	isDebug := log.IsDebug()
+	location, returnObj, format, ok := parseResultOptions(c, logger)
+	if !ok {
+		return
+	}
+	var req StmtRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Errorf("get json request error, %s", err.Error())
+		BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+		return
+	}
+	if len(req.SQL) == 0 {
+		logger.Error("no sql got")
+		BadRequestResponse(c, logger, httperror.HTTP_NO_SQL_INPUT)
+		return
+	}
+	logger.Debugf("request stmt sql:%s", log.GetLogSql(req.SQL))
+	sqlType := monitor.RestRecordRequest(req.SQL)
+	c.Set("sql", req.SQL)
+	user := c.MustGet(UserKey).(string)
+	password := c.MustGet(PasswordKey).(string)
+	ip := iptool.GetRealIP(c.Request)
+	s := log.GetLogNow(isDebug)
+	taosConnect, err := commonpool.GetConnection(user, password, ip)
+	logger.Debugf("get connect, conn:%p, err:%v, cost:%s", taosConnect, err, log.GetLogDuration(isDebug, s))
+	if err != nil {
+		monitor.RestRecordResult(sqlType, false)
+		logger.Errorf("connect server error,ip:%s, err:%s", ip, err)
+		ConnectionErrorResponse(c, logger, err)
+		return
+	}
+	defer func() {
+		putErr := taosConnect.Put()
+		if putErr != nil {
+			logger.Errorf("put connection error, err:%s", putErr)
+		}
+	}()
+	if !trySetConnectionOptions(c, taosConnect.TaosConnection, logger, isDebug) {
+		monitor.RestRecordResult(sqlType, false)
+		return
+	}
+	if len(db) > 0 {
+		logger.Tracef("select db %s", db)
+		_ = async.GlobalAsync.TaosExecWithoutResult(taosConnect.TaosConnection, logger, isDebug, fmt.Sprintf("use `%s`", db), reqID)
+	}
+
+	handle, caller := async.GlobalStmt2CallBackCallerPool.Get()
+	stmt2 := syncinterface.TaosStmt2Init(taosConnect.TaosConnection, reqID, false, false, handle, logger, isDebug)
+	if stmt2 == nil {
+		async.GlobalStmt2CallBackCallerPool.Put(handle)
+		monitor.RestRecordResult(sqlType, false)
+		errStr := wrapper.TaosStmtErrStr(stmt2)
+		logger.Errorf("stmt2 init error, err:%s", errStr)
+		CommonErrorResponse(c, logger, errStr)
+		return
+	}
+	// the query result belongs to stmt2 and is freed on close
+	defer func() {
+		syncinterface.TaosStmt2Close(stmt2, logger, isDebug)
+		async.GlobalStmt2CallBackCallerPool.Put(handle)
+	}()
+	stmtErrorResponse := func(code int, errStr string) {
+		monitor.RestRecordResult(sqlType, false)
+		logger.Errorf("stmt2 error, QID:0x%x, code:%d, msg:%s, sql:%s", reqID, code, errStr, log.GetLogSql(req.SQL))
+		TaosErrorResponse(c, logger, code, errStr)
+	}
+	code := syncinterface.TaosStmt2Prepare(stmt2, req.SQL, logger, isDebug)
+	if code != 0 {
+		stmtErrorResponse(code, wrapper.TaosStmt2Error(stmt2))
+		return
+	}
+	isInsert, code := syncinterface.TaosStmt2IsInsert(stmt2, logger, isDebug)
+	if code != 0 {
+		stmtErrorResponse(code, wrapper.TaosStmt2Error(stmt2))
+		return
+	}
+	logger.Tracef("stmt2 is insert:%t", isInsert)
+	var bindData []*stmt.TaosStmt2BindData
+	var fields []*stmt.Stmt2AllField
+	if isInsert {
+		code, count, cFields := syncinterface.TaosStmt2GetFields(stmt2, logger, isDebug)
+		if code != 0 {
+			stmtErrorResponse(code, wrapper.TaosStmt2Error(stmt2))
+			return
+		}
+		fields = wrapper.Stmt2ParseAllFields(count, cFields)
+		wrapper.TaosStmt2FreeFields(stmt2, cFields)
+		bindData, err = parseInsertParams(req.Params, fields)
+	} else if len(req.Params) > 0 {
+		bindData, err = parseQueryParams(req.Params)
+	}
+	if err != nil {
+		monitor.RestRecordResult(sqlType, false)
+		logger.Errorf("parse params error, err:%s", err)
+		BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal params, %s", err.Error()))
+		return
+	}
+	if len(bindData) > 0 {
+		err = syncinterface.TaosStmt2BindParam(stmt2, isInsert, bindData, fields, -1, logger, isDebug)
+		if err != nil {
+			var tError *tErrors.TaosError
+			if errors.As(err, &tError) {
+				stmtErrorResponse(int(tError.Code), tError.ErrStr)
+				return
+			}
+			stmtErrorResponse(0xffff, err.Error())
+			return
+		}
+	}
+	code = syncinterface.TaosStmt2Exec(stmt2, logger, isDebug)
+	if code != 0 {
+		stmtErrorResponse(code, wrapper.TaosStmt2Error(stmt2))
+		return
+	}
+	s = log.GetLogNow(isDebug)
+	result := <-caller.ExecResult
+	logger.Debugf("stmt2 execute wait callback finish, affected:%d, res:%p, n:%d, cost:%s", result.Affected, result.Res, result.N, log.GetLogDuration(isDebug, s))
+	if result.N < 0 {
+		stmtErrorResponse(result.N, wrapper.TaosStmt2Error(stmt2))
+		return
+	}
+	monitor.RestRecordResult(sqlType, true)
+	if isInsert {
+		writeAffectedRows(c, result.Affected, returnObj)
+		return
+	}
+	handler := async.GlobalAsync.HandlerPool.Get()
+	defer async.GlobalAsync.HandlerPool.Put(handler)
+	writeQueryResult(c, logger, isDebug, result.Res, handler, req.SQL, reqID, returnObj, format, location)
+}
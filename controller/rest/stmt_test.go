@@ -0,0 +1,164 @@
+package rest
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+)
+
+func TestParseQueryParams(t *testing.T) {
+	params, err := parseQueryParams(json.RawMessage(`[1,1.5,"a",true,9223372036854775808]`))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(params))
+	assert.Equal(t, [][]driver.Value{{int64(1)}, {1.5}, {"a"}, {true}, {9223372036854775808.0}}, params[0].Cols)
+
+	params, err = parseQueryParams(json.RawMessage(`[]`))
+	require.NoError(t, err)
+	assert.Nil(t, params)
+
+	_, err = parseQueryParams(json.RawMessage(`[null]`))
+	assert.Error(t, err)
+	_, err = parseQueryParams(json.RawMessage(`[[1]]`))
+	assert.Error(t, err)
+	_, err = parseQueryParams(json.RawMessage(`{"a":1}`))
+	assert.Error(t, err)
+}
+
+func TestParseInsertParams(t *testing.T) {
+	fields := []*stmt.Stmt2AllField{
+		{Name: "tbname", FieldType: common.TSDB_DATA_TYPE_BINARY, BindType: stmt.TAOS_FIELD_TBNAME},
+		{Name: "ts", FieldType: common.TSDB_DATA_TYPE_TIMESTAMP, BindType: stmt.TAOS_FIELD_COL},
+		{Name: "v", FieldType: common.TSDB_DATA_TYPE_INT, BindType: stmt.TAOS_FIELD_COL},
+		{Name: "b", FieldType: common.TSDB_DATA_TYPE_VARBINARY, BindType: stmt.TAOS_FIELD_COL},
+		{Name: "t", FieldType: common.TSDB_DATA_TYPE_NCHAR, BindType: stmt.TAOS_FIELD_TAG},
+	}
+	params, err := parseInsertParams(json.RawMessage(`[
+{"table_name":"d1","tags":["a"],"rows":[[1704067200000,1,"0102"],["2024-01-01T00:00:01Z",null,null]]},
+{"table_name":"d2","tags":[null],"rows":[[1704067200000,2,"ff"]]}
+]`), fields)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(params))
+	assert.Equal(t, "d1", params[0].TableName)
+	assert.Equal(t, []driver.Value{"a"}, params[0].Tags)
+	assert.Equal(t, [][]driver.Value{
+		{int64(1704067200000), time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC)},
+		{int32(1), nil},
+		{[]byte{1, 2}, nil},
+	}, params[0].Cols)
+	assert.Equal(t, []driver.Value{nil}, params[1].Tags)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: `[]`},
+		{name: "tag count", data: `[{"table_name":"d1","tags":[],"rows":[[1,1,"01"]]}]`},
+		{name: "no rows", data: `[{"table_name":"d1","tags":["a"],"rows":[]}]`},
+		{name: "column count", data: `[{"table_name":"d1","tags":["a"],"rows":[[1,1]]}]`},
+		{name: "int range", data: `[{"table_name":"d1","tags":["a"],"rows":[[1,2147483648,"01"]]}]`},
+		{name: "timestamp", data: `[{"table_name":"d1","tags":["a"],"rows":[["wrong",1,"01"]]}]`},
+		{name: "hex", data: `[{"table_name":"d1","tags":["a"],"rows":[[1,1,"zz"]]}]`},
+		{name: "tag type", data: `[{"table_name":"d1","tags":[1],"rows":[[1,1,"01"]]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseInsertParams(json.RawMessage(tt.data), fields)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConvertStmtValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType int8
+		value     interface{}
+		want      driver.Value
+		wantErr   bool
+	}{
+		{name: "bool", fieldType: common.TSDB_DATA_TYPE_BOOL, value: true, want: true},
+		{name: "tinyint", fieldType: common.TSDB_DATA_TYPE_TINYINT, value: json.Number("-128"), want: int8(-128)},
+		{name: "tinyint overflow", fieldType: common.TSDB_DATA_TYPE_TINYINT, value: json.Number("128"), wantErr: true},
+		{name: "smallint", fieldType: common.TSDB_DATA_TYPE_SMALLINT, value: json.Number("1"), want: int16(1)},
+		{name: "bigint", fieldType: common.TSDB_DATA_TYPE_BIGINT, value: json.Number("1"), want: int64(1)},
+		{name: "bigint float", fieldType: common.TSDB_DATA_TYPE_BIGINT, value: json.Number("1.5"), wantErr: true},
+		{name: "utinyint", fieldType: common.TSDB_DATA_TYPE_UTINYINT, value: json.Number("255"), want: uint8(255)},
+		{name: "utinyint negative", fieldType: common.TSDB_DATA_TYPE_UTINYINT, value: json.Number("-1"), wantErr: true},
+		{name: "usmallint", fieldType: common.TSDB_DATA_TYPE_USMALLINT, value: json.Number("1"), want: uint16(1)},
+		{name: "uint", fieldType: common.TSDB_DATA_TYPE_UINT, value: json.Number("1"), want: uint32(1)},
+		{name: "ubigint", fieldType: common.TSDB_DATA_TYPE_UBIGINT, value: json.Number("18446744073709551615"), want: uint64(18446744073709551615)},
+		{name: "float", fieldType: common.TSDB_DATA_TYPE_FLOAT, value: json.Number("1.5"), want: float32(1.5)},
+		{name: "double", fieldType: common.TSDB_DATA_TYPE_DOUBLE, value: json.Number("1.5"), want: 1.5},
+		{name: "double string", fieldType: common.TSDB_DATA_TYPE_DOUBLE, value: "1.5", wantErr: true},
+		{name: "binary", fieldType: common.TSDB_DATA_TYPE_BINARY, value: "a", want: "a"},
+		{name: "geometry", fieldType: common.TSDB_DATA_TYPE_GEOMETRY, value: "01", want: []byte{1}},
+		{name: "json string", fieldType: common.TSDB_DATA_TYPE_JSON, value: `{"a":1}`, want: `{"a":1}`},
+		{name: "json object", fieldType: common.TSDB_DATA_TYPE_JSON, value: map[string]interface{}{"a": json.Number("1")}, want: []byte(`{"a":1}`)},
+		{name: "null", fieldType: common.TSDB_DATA_TYPE_INT, value: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertStmtValue(tt.value, &stmt.Stmt2AllField{FieldType: tt.fieldType})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWrongStmt(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{name: "not json", url: "/rest/stmt", body: `select 1`},
+		{name: "empty sql", url: "/rest/stmt", body: `{"params":[1]}`},
+		{name: "row_with_meta", url: "/rest/stmt?row_with_meta=wrong", body: `{"sql":"select ?","params":[1]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doBatch(tt.url, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestStmt(t *testing.T) {
+	w := doBatch("/rest/batch", `[
+{"sql":"create database if not exists test_rest_stmt"},
+{"sql":"create stable if not exists st(ts timestamp,v int,b varbinary(16)) tags(t nchar(16))","db":"test_rest_stmt"}
+]`)
+	defer doBatch("/rest/batch", `[{"sql":"drop database if exists test_rest_stmt"}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doBatch("/rest/stmt/test_rest_stmt", `{"sql":"insert into ? using st tags(?) values(?,?,?)","params":[
+{"table_name":"d1","tags":["a"],"rows":[[1704067200000,1,"0102"],[1704067201000,2,null]]},
+{"table_name":"d2","tags":["b"],"rows":[["2024-01-01T00:00:00Z",3,"ff"]]}
+]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp TDEngineRestfulRespDoc
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 0, resp.Code, resp.Desc)
+	assert.Equal(t, [][]interface{}{{float64(3)}}, resp.Data)
+
+	w = doBatch("/rest/stmt/test_rest_stmt", `{"sql":"select v from st where t = ? and v > ? order by ts","params":["a",1]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp = TDEngineRestfulRespDoc{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 0, resp.Code, resp.Desc)
+	assert.Equal(t, [][]interface{}{{float64(2)}}, resp.Data)
+
+	w = doBatch("/rest/stmt/test_rest_stmt", `{"sql":"insert into ? using st tags(?) values(?,?,?)","params":[{"table_name":"d1","tags":["a"],"rows":[[1,"wrong",null]]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
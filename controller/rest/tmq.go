@@ -0,0 +1,419 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+const (
+	TMQFormatSSE    = "sse"
+	TMQFormatNDJSON = "ndjson"
+	// tmqPollBlockingTime bounds each poll so that a closed client is noticed.
+	tmqPollBlockingTime = 500 * time.Millisecond
+)
+
+var tmqConsumers *tmqconsumer.Holder
+
+var (
+	sseRowEvent   = []byte("event: row\n")
+	sseErrorEvent = []byte("event: error\n")
+	sseHeartbeat  = []byte(": ping\n\n")
+)
+
+type tmqOptions struct {
+	format             string
+	clientID           string
+	offsetReset        string
+	autoCommit         bool
+	autoCommitInterval time.Duration
+	timeout            time.Duration
+	location           *time.Location
+}
+
+// negotiateTMQFormat returns the format of the query param, or sse if the client accepts event streams and
+// ndjson otherwise.
+func negotiateTMQFormat(format, accept string) (string, error) {
+	switch format {
+	case TMQFormatSSE, TMQFormatNDJSON:
+		return format, nil
+	case "":
+		if strings.Contains(accept, "text/event-stream") {
+			return TMQFormatSSE, nil
+		}
+		return TMQFormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported format %s, must be sse or ndjson", format)
+	}
+}
+
+func parseTMQOptions(c *gin.Context, logger *logrus.Entry) (*tmqOptions, bool) {
+	var err error
+	opts := &tmqOptions{
+		clientID:           c.Query("client_id"),
+		autoCommit:         true,
+		autoCommitInterval: 5 * time.Second,
+		timeout:            30 * time.Second,
+		location:           time.UTC,
+	}
+	opts.format, err = negotiateTMQFormat(c.Query("format"), c.GetHeader("Accept"))
+	if err != nil {
+		logger.Errorf("illegal param, format:%s, err:%s", c.Query("format"), err)
+		BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+		return nil, false
+	}
+	if opts.offsetReset = c.Query("offset_reset"); len(opts.offsetReset) != 0 {
+		switch opts.offsetReset {
+		case "earliest", "latest", "none":
+		default:
+			logger.Errorf("illegal param, offset_reset:%s", opts.offsetReset)
+			BadRequestResponseWithMsg(c, logger, 0xffff, "illegal param, offset_reset must be earliest, latest or none")
+			return nil, false
+		}
+	}
+	if autoCommitStr := c.Query("auto_commit"); len(autoCommitStr) != 0 {
+		if opts.autoCommit, err = strconv.ParseBool(autoCommitStr); err != nil {
+			logger.Errorf("illegal param, auto_commit must be boolean:%s", autoCommitStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal param, auto_commit must be boolean %s", err.Error()))
+			return nil, false
+		}
+	}
+	if intervalStr := c.Query("auto_commit_interval_ms"); len(intervalStr) != 0 {
+		interval, err := strconv.Atoi(intervalStr)
+		if err != nil || interval <= 0 {
+			logger.Errorf("illegal param, auto_commit_interval_ms must be positive integer:%s", intervalStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, "illegal param, auto_commit_interval_ms must be positive integer")
+			return nil, false
+		}
+		opts.autoCommitInterval = time.Duration(interval) * time.Millisecond
+	}
+	if timeoutStr := c.Query("timeout_ms"); len(timeoutStr) != 0 {
+		timeout, err := strconv.Atoi(timeoutStr)
+		if err != nil || timeout <= 0 {
+			logger.Errorf("illegal param, timeout_ms must be positive integer:%s", timeoutStr)
+			BadRequestResponseWithMsg(c, logger, 0xffff, "illegal param, timeout_ms must be positive integer")
+			return nil, false
+		}
+		opts.timeout = time.Duration(timeout) * time.Millisecond
+	}
+	if timezone, exists := c.GetQuery("tz"); exists {
+		opts.location, err = time.LoadLocation(timezone)
+		if err != nil {
+			logger.Errorf("load tz location:%s fail, error:%s", timezone, err)
+			BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+			return nil, false
+		}
+	}
+	return opts, true
+}
+
+// tmqErrorResponse responds with the error returned by the tmq consumer holder.
+func tmqErrorResponse(c *gin.Context, logger *logrus.Entry, err error) {
+	if errors.Is(err, tmqconsumer.ErrWhitelistForbidden) || errors.Is(err, tmqconsumer.ErrNotOwner) {
+		ForbiddenResponse(c, logger, err.Error())
+		return
+	}
+	if errors.Is(err, tmqconsumer.ErrTooManyConsumers) {
+		ServiceUnavailable(c, logger, err.Error())
+		return
+	}
+	if errors.Is(err, tmqconsumer.ErrClosed) {
+		ErrorResponse(c, logger, http.StatusNotFound, 0xffff, err.Error())
+		return
+	}
+	var tError *tErrors.TaosError
+	if errors.As(err, &tError) {
+		TaosErrorResponse(c, logger, int(tError.Code), tError.ErrStr)
+		return
+	}
+	CommonErrorResponse(c, logger, err.Error())
+}
+
+// @Tags rest
+// @Summary subscribe topic
+// @Description stream the rows of the topic as server-sent events or ndjson, the consumer is kept by group, client_id and topic between requests
+// @Produce text/event-stream
+// @Produce application/x-ndjson
+// @Param Authorization header string true "authorization token"
+// @Param client_id query string false "client id of the consumer"
+// @Param offset_reset query string false "earliest, latest or none"
+// @Param auto_commit query bool false "commit the polled offsets automatically, default true"
+// @Param auto_commit_interval_ms query int false "auto commit interval in milliseconds, default 5000"
+// @Param format query string false "sse or ndjson"
+// @Param timeout_ms query int false "ndjson long-poll timeout in milliseconds, default 30000"
+// @Param tz query string false "timezone of the timestamps"
+// @Success 200 {string} string "event stream"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 409 {string} string "consumer is being read"
+// @Failure 500 {string} string "internal error"
+// @Router /rest/tmq/{group}/{topic}/events [get]
+func (ctl *Restful) tmqEvents(c *gin.Context) {
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	opts, ok := parseTMQOptions(c, logger)
+	if !ok {
+		return
+	}
+	group := c.Param("group")
+	topic := c.Param("topic")
+	key := tmqconsumer.Key(group, opts.clientID, []string{topic})
+	conf := &tmqconsumer.Config{
+		User:               c.MustGet(UserKey).(string),
+		Password:           c.MustGet(PasswordKey).(string),
+		GroupID:            group,
+		ClientID:           opts.clientID,
+		Topics:             []string{topic},
+		OffsetReset:        opts.offsetReset,
+		AutoCommit:         opts.autoCommit,
+		AutoCommitInterval: opts.autoCommitInterval,
+		IP:                 iptool.GetRealIP(c.Request),
+		App:                c.Query("app"),
+	}
+	consumer, created, err := tmqConsumers.GetOrCreate(key, conf, logger.WithField("tmq_consumer", key))
+	if err != nil {
+		logger.Errorf("get tmq consumer error, group:%s, client_id:%s, topic:%s, err:%s", group, opts.clientID, topic, err)
+		tmqErrorResponse(c, logger, err)
+		return
+	}
+	if created {
+		logger.Infof("tmq consumer created, group:%s, client_id:%s, topic:%s", group, opts.clientID, topic)
+	} else if !consumer.CheckWhitelist(conf.IP) {
+		logger.Errorf("ip not in whitelist, ip:%s", conf.IP)
+		ForbiddenResponse(c, logger, tmqconsumer.ErrWhitelistForbidden.Error())
+		return
+	}
+	if !consumer.Acquire() {
+		logger.Errorf("tmq consumer is being read by another request, group:%s, client_id:%s, topic:%s", group, opts.clientID, topic)
+		ErrorResponse(c, logger, http.StatusConflict, 0xffff, "tmq consumer is being read by another request")
+		return
+	}
+	defer consumer.Release()
+	if opts.format == TMQFormatSSE {
+		streamTMQEvents(c, logger, consumer, opts)
+	} else {
+		longPollTMQEvents(c, logger, consumer, opts)
+	}
+}
+
+// streamTMQEvents writes a row event for every row polled until the client goes away or the consumer is closed,
+// a comment line is written when nothing was written for the heartbeat interval.
+func streamTMQEvents(c *gin.Context, logger *logrus.Entry, consumer *tmqconsumer.Consumer, opts *tmqOptions) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	builder := jsonbuilder.BorrowStream(c.Writer)
+	defer jsonbuilder.ReturnStream(builder)
+	ctx := c.Request.Context()
+	lastWrite := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("tmq event stream closed by client")
+			return
+		case <-consumer.Done():
+			writeSSEError(builder, 0xffff, tmqconsumer.ErrClosed.Error())
+			_ = builder.Flush()
+			c.Writer.Flush()
+			return
+		default:
+		}
+		message, err := consumer.Poll(tmqPollBlockingTime, opts.location)
+		if err != nil {
+			logger.Errorf("poll tmq message error, err:%s", err)
+			code := 0xffff
+			var tError *tErrors.TaosError
+			if errors.As(err, &tError) {
+				code = int(tError.Code)
+			}
+			writeSSEError(builder, code, err.Error())
+			_ = builder.Flush()
+			c.Writer.Flush()
+			return
+		}
+		if message == nil || len(message.Blocks) == 0 {
+			if time.Since(lastWrite) >= config.Conf.RestfulTMQ.HeartbeatInterval {
+				builder.Write(sseHeartbeat)
+				if err = builder.Flush(); err != nil {
+					logger.Debugf("write tmq heartbeat error, err:%s", err)
+					return
+				}
+				c.Writer.Flush()
+				lastWrite = time.Now()
+			}
+			continue
+		}
+		id := strconv.Itoa(int(message.VgroupID)) + ":" + strconv.FormatInt(message.Offset, 10)
+		for _, block := range message.Blocks {
+			for _, row := range block.Rows {
+				writeSSERow(builder, id, message, block.TableName, row)
+				if builder.Buffered() > 16352 {
+					if err = builder.Flush(); err != nil {
+						logger.Debugf("write tmq event error, err:%s", err)
+						return
+					}
+				}
+			}
+		}
+		if err = builder.Flush(); err != nil {
+			logger.Debugf("write tmq event error, err:%s", err)
+			return
+		}
+		c.Writer.Flush()
+		lastWrite = time.Now()
+	}
+}
+
+// longPollTMQEvents waits up to the timeout for a message with rows and writes its rows as ndjson, nothing is
+// written if the timeout passed.
+func longPollTMQEvents(c *gin.Context, logger *logrus.Entry, consumer *tmqconsumer.Consumer, opts *tmqOptions) {
+	ctx := c.Request.Context()
+	deadline := time.Now().Add(opts.timeout)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("tmq long-poll closed by client")
+			return
+		default:
+		}
+		blockingTime := time.Until(deadline)
+		if blockingTime <= 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		if blockingTime > tmqPollBlockingTime {
+			blockingTime = tmqPollBlockingTime
+		}
+		message, err := consumer.Poll(blockingTime, opts.location)
+		if err != nil {
+			logger.Errorf("poll tmq message error, err:%s", err)
+			tmqErrorResponse(c, logger, err)
+			return
+		}
+		if message == nil || len(message.Blocks) == 0 {
+			continue
+		}
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		builder := jsonbuilder.BorrowStream(c.Writer)
+		defer jsonbuilder.ReturnStream(builder)
+		for _, block := range message.Blocks {
+			for _, row := range block.Rows {
+				tmqconsumer.WriteRow(builder, message, block.TableName, row)
+				builder.WriteRaw("\n")
+			}
+		}
+		if err = builder.Flush(); err != nil {
+			logger.Debugf("write tmq rows error, err:%s", err)
+		}
+		return
+	}
+}
+
+// writeSSERow writes the row as a server-sent event row with the id of the message position.
+func writeSSERow(builder *jsonbuilder.Stream, id string, message *tmqconsumer.Message, tableName string, row []byte) {
+	builder.WriteRaw("id: ")
+	builder.WriteRaw(id)
+	builder.WriteRaw("\n")
+	builder.Write(sseRowEvent)
+	builder.WriteRaw("data: ")
+	tmqconsumer.WriteRow(builder, message, tableName, row)
+	builder.WriteRaw("\n\n")
+}
+
+func writeSSEError(builder *jsonbuilder.Stream, code int, msg string) {
+	builder.Write(sseErrorEvent)
+	builder.WriteRaw("data: ")
+	builder.WriteObjectStart()
+	builder.WriteObjectField("code")
+	builder.WriteInt(code)
+	builder.WriteMore()
+	builder.WriteObjectField("desc")
+	builder.WriteString(msg)
+	builder.WriteObjectEnd()
+	builder.WriteRaw("\n\n")
+}
+
+type TMQCommitOffset struct {
+	VgroupID int32 `json:"vgroup_id"`
+	Offset   int64 `json:"offset"`
+}
+
+type TMQCommitRequest struct {
+	Offsets []*TMQCommitOffset `json:"offsets"`
+}
+
+// @Tags rest
+// @Summary commit topic offsets
+// @Description commit the offsets of the consumer kept by group, client_id and topic, without offsets in the body the polled offsets are committed
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Param client_id query string false "client id of the consumer"
+// @Success 200 {object} Message
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "consumer not found"
+// @Failure 500 {string} string "internal error"
+// @Router /rest/tmq/{group}/{topic}/commit [post]
+func (ctl *Restful) tmqCommit(c *gin.Context) {
+	logger := c.MustGet(LoggerKey).(*logrus.Entry)
+	group := c.Param("group")
+	topic := c.Param("topic")
+	clientID := c.Query("client_id")
+	var req TMQCommitRequest
+	if c.Request.ContentLength != 0 {
+		b, err := c.GetRawData()
+		if err != nil {
+			logger.Errorf("get request body error, err:%s", err)
+			BadRequestResponseWithMsg(c, logger, 0xffff, err.Error())
+			return
+		}
+		if len(b) != 0 {
+			if err = json.Unmarshal(b, &req); err != nil {
+				logger.Errorf("unmarshal commit request error, body:%s, err:%s", b, err)
+				BadRequestResponseWithMsg(c, logger, 0xffff, fmt.Sprintf("illegal commit request %s", err.Error()))
+				return
+			}
+		}
+	}
+	key := tmqconsumer.Key(group, clientID, []string{topic})
+	consumer, err := tmqConsumers.Get(key, c.MustGet(UserKey).(string), c.MustGet(PasswordKey).(string))
+	if err != nil {
+		tmqErrorResponse(c, logger, err)
+		return
+	}
+	if consumer == nil {
+		ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "tmq consumer not found")
+		return
+	}
+	if len(req.Offsets) == 0 {
+		err = consumer.Commit()
+	} else {
+		for _, offset := range req.Offsets {
+			if err = consumer.CommitOffset(topic, offset.VgroupID, offset.Offset); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.Errorf("commit tmq offset error, group:%s, client_id:%s, topic:%s, err:%s", group, clientID, topic, err)
+		tmqErrorResponse(c, logger, err)
+		return
+	}
+	logger.Debugf("tmq offset committed, group:%s, client_id:%s, topic:%s", group, clientID, topic)
+	c.JSON(http.StatusOK, &Message{Code: 0})
+}
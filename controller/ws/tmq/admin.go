@@ -0,0 +1,375 @@
+package tmq
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/controller/rest"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+// sessions holds the tmq of the connected websocket sessions by session id.
+var sessions = struct {
+	sync.RWMutex
+	m map[int64]*TMQ
+}{m: make(map[int64]*TMQ)}
+
+func addSession(t *TMQ) {
+	sessions.Lock()
+	sessions.m[t.sessionID] = t
+	sessions.Unlock()
+}
+
+func removeSession(t *TMQ) {
+	sessions.Lock()
+	if sessions.m[t.sessionID] == t {
+		delete(sessions.m, t.sessionID)
+	}
+	sessions.Unlock()
+}
+
+func getSession(id int64) *TMQ {
+	sessions.RLock()
+	defer sessions.RUnlock()
+	return sessions.m[id]
+}
+
+// listSessions returns the tmq of the connected sessions ordered by session id.
+func listSessions() []*TMQ {
+	sessions.RLock()
+	result := make([]*TMQ, 0, len(sessions.m))
+	for _, t := range sessions.m {
+		result = append(result, t)
+	}
+	sessions.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].sessionID < result[j].sessionID
+	})
+	return result
+}
+
+// consumerState is the subscription of the session and the progress of the consumer, it is kept apart from the
+// consumer so that it can be read without waiting for the tmq calls of the session.
+type consumerState struct {
+	subscribed            bool
+	user                  string
+	db                    string
+	groupID               string
+	clientID              string
+	topics                []string
+	autoCommit            bool
+	subscribeTime         time.Time
+	lastPollTime          time.Time
+	lastCommitTime        time.Time
+	uncommittedMessages   uint64
+	unacknowledgedMessage *UnacknowledgedMessage
+}
+
+func (t *TMQ) setSubscription(req *TMQSubscribeReq) {
+	t.stateLock.Lock()
+	defer t.stateLock.Unlock()
+	t.state.subscribed = true
+	t.state.user = req.User
+	t.state.db = req.DB
+	t.state.groupID = req.GroupID
+	t.state.clientID = req.ClientID
+	t.state.topics = append([]string(nil), req.Topics...)
+	t.state.autoCommit = t.isAutoCommit
+	t.state.subscribeTime = time.Now()
+}
+
+func (t *TMQ) setUnsubscribed() {
+	t.stateLock.Lock()
+	defer t.stateLock.Unlock()
+	t.state.subscribed = false
+	t.state.uncommittedMessages = 0
+	t.state.unacknowledgedMessage = nil
+}
+
+func (t *TMQ) setPolled(now time.Time) {
+	t.stateLock.Lock()
+	t.state.lastPollTime = now
+	t.stateLock.Unlock()
+}
+
+// setMessage records the message returned by poll, the message is unacknowledged until the next poll.
+func (t *TMQ) setMessage(message *Message) {
+	t.stateLock.Lock()
+	defer t.stateLock.Unlock()
+	t.state.uncommittedMessages++
+	t.state.unacknowledgedMessage = &UnacknowledgedMessage{
+		MessageID: message.Index,
+		Topic:     message.Topic,
+		VgroupID:  message.VGroupID,
+		Offset:    message.Offset,
+		Type:      message.Type,
+	}
+}
+
+func (t *TMQ) setCommitted() {
+	t.stateLock.Lock()
+	t.state.lastCommitTime = time.Now()
+	t.state.uncommittedMessages = 0
+	t.stateLock.Unlock()
+}
+
+type UnacknowledgedMessage struct {
+	MessageID uint64 `json:"message_id"`
+	Topic     string `json:"topic"`
+	VgroupID  int32  `json:"vgroup_id"`
+	Offset    int64  `json:"offset"`
+	Type      int32  `json:"type"`
+}
+
+type ConsumerInfo struct {
+	SessionID             int64                  `json:"session_id"`
+	ClientIP              string                 `json:"client_ip"`
+	ConnectTime           time.Time              `json:"connect_time"`
+	Subscribed            bool                   `json:"subscribed"`
+	User                  string                 `json:"user"`
+	DB                    string                 `json:"db"`
+	GroupID               string                 `json:"group_id"`
+	ClientID              string                 `json:"client_id"`
+	Topics                []string               `json:"topics"`
+	AutoCommit            bool                   `json:"auto_commit"`
+	SubscribeTime         *time.Time             `json:"subscribe_time"`
+	LastPollTime          *time.Time             `json:"last_poll_time"`
+	LastCommitTime        *time.Time             `json:"last_commit_time"`
+	UncommittedMessages   uint64                 `json:"uncommitted_messages"`
+	UnacknowledgedMessage *UnacknowledgedMessage `json:"unacknowledged_message"`
+}
+
+// VgroupOffset is the progress of the consumer on a vgroup of a topic, committed is null if no offset was committed.
+type VgroupOffset struct {
+	Topic     string `json:"topic"`
+	VgroupID  int32  `json:"vgroup_id"`
+	Begin     int64  `json:"begin"`
+	End       int64  `json:"end"`
+	Committed *int64 `json:"committed"`
+	Position  int64  `json:"position"`
+}
+
+type ConsumerDetail struct {
+	ConsumerInfo
+	Offsets []*VgroupOffset `json:"offsets"`
+}
+
+type ListConsumersResp struct {
+	Code      int             `json:"code"`
+	Consumers []*ConsumerInfo `json:"consumers"`
+}
+
+type GetConsumerResp struct {
+	Code     int             `json:"code"`
+	Consumer *ConsumerDetail `json:"consumer"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (t *TMQ) info() *ConsumerInfo {
+	t.stateLock.RLock()
+	defer t.stateLock.RUnlock()
+	info := &ConsumerInfo{
+		SessionID:           t.sessionID,
+		ClientIP:            t.ipStr,
+		ConnectTime:         t.connectTime,
+		Subscribed:          t.state.subscribed,
+		User:                t.state.user,
+		DB:                  t.state.db,
+		GroupID:             t.state.groupID,
+		ClientID:            t.state.clientID,
+		Topics:              t.state.topics,
+		AutoCommit:          t.state.autoCommit,
+		SubscribeTime:       optionalTime(t.state.subscribeTime),
+		LastPollTime:        optionalTime(t.state.lastPollTime),
+		LastCommitTime:      optionalTime(t.state.lastCommitTime),
+		UncommittedMessages: t.state.uncommittedMessages,
+	}
+	if t.state.unacknowledgedMessage != nil {
+		message := *t.state.unacknowledgedMessage
+		info.UnacknowledgedMessage = &message
+	}
+	if info.Topics == nil {
+		info.Topics = []string{}
+	}
+	return info
+}
+
+// offsets returns the offsets of the vgroups assigned to the consumer, the calls wait for the running tmq call of
+// the session. It returns closed true if the session is closed.
+func (t *TMQ) offsets(logger *logrus.Entry, topics []string) (offsets []*VgroupOffset, code int32, closed bool) {
+	isDebug := log.IsDebug()
+	t.lock(logger, isDebug)
+	defer t.Unlock()
+	if t.isClosed() {
+		return nil, 0, true
+	}
+	offsets = []*VgroupOffset{}
+	if t.consumer == nil || t.unsubscribed {
+		return offsets, 0, false
+	}
+	for _, topic := range topics {
+		result, closed := t.wrapperGetTopicAssignment(logger, isDebug, topic)
+		if closed {
+			return nil, 0, true
+		}
+		if result.Code != 0 {
+			logger.Errorf("tmq assignment error, topic:%s, code:%d, msg:%s", topic, result.Code, wrapper.TMQErr2Str(result.Code))
+			return nil, result.Code, false
+		}
+		for _, assignment := range result.Assignment {
+			offset := &VgroupOffset{
+				Topic:    topic,
+				VgroupID: assignment.VGroupID,
+				Begin:    assignment.Begin,
+				End:      assignment.End,
+			}
+			committed, closed := t.wrapperCommitted(logger, isDebug, topic, assignment.VGroupID)
+			if closed {
+				return nil, 0, true
+			}
+			if committed < 0 && committed != OffsetInvalid {
+				logger.Errorf("tmq get committed error, topic:%s, vgroup_id:%d, code:%d, msg:%s", topic, assignment.VGroupID, committed, wrapper.TMQErr2Str(int32(committed)))
+				return nil, int32(committed), false
+			}
+			if committed != OffsetInvalid {
+				offset.Committed = &committed
+			}
+			position, closed := t.wrapperPosition(logger, isDebug, topic, assignment.VGroupID)
+			if closed {
+				return nil, 0, true
+			}
+			if position < 0 && position != OffsetInvalid {
+				logger.Errorf("tmq get position error, topic:%s, vgroup_id:%d, code:%d, msg:%s", topic, assignment.VGroupID, position, wrapper.TMQErr2Str(int32(position)))
+				return nil, int32(position), false
+			}
+			offset.Position = position
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets, 0, false
+}
+
+// getAdminSession returns the tmq of the session id param, it responds with the error and returns nil if the
+// session is not found.
+func getAdminSession(c *gin.Context, logger *logrus.Entry) *TMQ {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Errorf("illegal param, id must be numeric:%s, err:%s", idStr, err)
+		rest.BadRequestResponseWithMsg(c, logger, 0xffff, "illegal param, id must be numeric")
+		return nil
+	}
+	t := getSession(id)
+	if t == nil {
+		rest.ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "tmq session not found")
+		return nil
+	}
+	return t
+}
+
+// @Tags admin
+// @Summary list tmq consumers
+// @Description list the tmq consumers of the websocket sessions
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Param group_id query string false "only list the consumers of the group"
+// @Param topic query string false "only list the consumers subscribing the topic"
+// @Success 200 {object} ListConsumersResp
+// @Failure 401 {string} string "unauthorized"
+// @Failure 403 {string} string "forbidden"
+// @Router /admin/tmq/consumers [get]
+func (s *TMQController) listConsumers(c *gin.Context) {
+	groupID, filterGroup := c.GetQuery("group_id")
+	topic, filterTopic := c.GetQuery("topic")
+	consumers := []*ConsumerInfo{}
+	for _, t := range listSessions() {
+		info := t.info()
+		if filterGroup && info.GroupID != groupID {
+			continue
+		}
+		if filterTopic && !containsTopic(info.Topics, topic) {
+			continue
+		}
+		consumers = append(consumers, info)
+	}
+	c.JSON(http.StatusOK, &ListConsumersResp{Code: 0, Consumers: consumers})
+}
+
+func containsTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// @Tags admin
+// @Summary get tmq consumer
+// @Description get the tmq consumer of the websocket session with the committed offset and position of each vgroup
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Success 200 {object} GetConsumerResp
+// @Failure 401 {string} string "unauthorized"
+// @Failure 403 {string} string "forbidden"
+// @Failure 404 {string} string "session not found"
+// @Router /admin/tmq/consumers/{id} [get]
+func (s *TMQController) getConsumer(c *gin.Context) {
+	logger := c.MustGet(rest.LoggerKey).(*logrus.Entry)
+	t := getAdminSession(c, logger)
+	if t == nil {
+		return
+	}
+	info := t.info()
+	offsets, code, closed := t.offsets(t.logger.WithField("action", "admin_offsets"), info.Topics)
+	if closed {
+		rest.ErrorResponse(c, logger, http.StatusNotFound, 0xffff, "tmq session closed")
+		return
+	}
+	if code != 0 {
+		rest.TaosErrorResponse(c, logger, int(code), wrapper.TMQErr2Str(code))
+		return
+	}
+	c.JSON(http.StatusOK, &GetConsumerResp{
+		Code: 0,
+		Consumer: &ConsumerDetail{
+			ConsumerInfo: *info,
+			Offsets:      offsets,
+		},
+	})
+}
+
+// @Tags admin
+// @Summary close tmq consumer
+// @Description close the websocket session and its tmq consumer
+// @Produce json
+// @Param Authorization header string true "authorization token"
+// @Success 200 {object} rest.Message
+// @Failure 401 {string} string "unauthorized"
+// @Failure 403 {string} string "forbidden"
+// @Failure 404 {string} string "session not found"
+// @Router /admin/tmq/consumers/{id} [delete]
+func (s *TMQController) closeConsumer(c *gin.Context) {
+	logger := c.MustGet(rest.LoggerKey).(*logrus.Entry)
+	t := getAdminSession(c, logger)
+	if t == nil {
+		return
+	}
+	sessionLogger := t.logger.WithField("action", "admin_close")
+	sessionLogger.Infof("close tmq session by admin, user:%s", c.MustGet(rest.UserKey))
+	_ = t.session.Close()
+	t.Close(sessionLogger)
+	c.JSON(http.StatusOK, &rest.Message{Code: 0})
+}
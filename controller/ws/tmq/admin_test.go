@@ -0,0 +1,157 @@
+package tmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doAdminRequest(method, url, user, password string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, nil)
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTMQAdmin(t *testing.T) {
+	dbName := "test_ws_tmq_admin"
+	topic := "test_ws_tmq_admin_topic"
+	groupID := "test_ws_tmq_admin_group"
+
+	before(t, dbName, topic)
+
+	s := httptest.NewServer(router)
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/rest/tmq", nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = ws.Close()
+		doHttpSql(fmt.Sprintf("drop topic if exists %s", topic))
+		doHttpSql(fmt.Sprintf("drop database if exists %s", dbName))
+	}()
+
+	// subscribe
+	b, _ := json.Marshal(TMQSubscribeReq{
+		User:        "root",
+		Password:    "taosdata",
+		DB:          dbName,
+		GroupID:     groupID,
+		ClientID:    "admin_client",
+		Topics:      []string{topic},
+		AutoCommit:  "false",
+		OffsetReset: "earliest",
+	})
+	msg, err := doWebSocket(ws, TMQSubscribe, b)
+	require.NoError(t, err)
+	var subscribeResp TMQSubscribeResp
+	err = json.Unmarshal(msg, &subscribeResp)
+	require.NoError(t, err)
+	require.Equal(t, 0, subscribeResp.Code, subscribeResp.Message)
+
+	// poll
+	b, _ = json.Marshal(TMQPollReq{ReqID: 0, BlockingTime: 500})
+	msg, err = doWebSocket(ws, TMQPoll, b)
+	require.NoError(t, err)
+	var pollResp TMQPollResp
+	err = json.Unmarshal(msg, &pollResp)
+	require.NoError(t, err)
+	require.Equal(t, 0, pollResp.Code, pollResp.Message)
+	require.True(t, pollResp.HaveMessage)
+
+	// auth
+	w := doAdminRequest(http.MethodGet, "/admin/tmq/consumers", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers", "root", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers", "not_admin", "taosdata")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// list
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers?group_id="+groupID, "root", "taosdata")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listResp ListConsumersResp
+	err = json.Unmarshal(w.Body.Bytes(), &listResp)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(listResp.Consumers))
+	consumer := listResp.Consumers[0]
+	assert.True(t, consumer.Subscribed)
+	assert.Equal(t, "root", consumer.User)
+	assert.Equal(t, dbName, consumer.DB)
+	assert.Equal(t, "admin_client", consumer.ClientID)
+	assert.Equal(t, []string{topic}, consumer.Topics)
+	assert.False(t, consumer.AutoCommit)
+	assert.NotNil(t, consumer.SubscribeTime)
+	assert.NotNil(t, consumer.LastPollTime)
+	assert.Nil(t, consumer.LastCommitTime)
+	assert.Equal(t, uint64(1), consumer.UncommittedMessages)
+	require.NotNil(t, consumer.UnacknowledgedMessage)
+	assert.Equal(t, pollResp.MessageID, consumer.UnacknowledgedMessage.MessageID)
+	assert.Equal(t, topic, consumer.UnacknowledgedMessage.Topic)
+	assert.Equal(t, pollResp.VgroupID, consumer.UnacknowledgedMessage.VgroupID)
+	assert.Equal(t, pollResp.Offset, consumer.UnacknowledgedMessage.Offset)
+
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers?topic=not_exist_topic", "root", "taosdata")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	err = json.Unmarshal(w.Body.Bytes(), &listResp)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(listResp.Consumers))
+
+	// commit
+	b, _ = json.Marshal(TMQCommitReq{ReqID: 0, MessageID: pollResp.MessageID})
+	msg, err = doWebSocket(ws, TMQCommit, b)
+	require.NoError(t, err)
+	var commitResp TMQCommitResp
+	err = json.Unmarshal(msg, &commitResp)
+	require.NoError(t, err)
+	require.Equal(t, 0, commitResp.Code, commitResp.Message)
+
+	// detail
+	sessionURL := fmt.Sprintf("/admin/tmq/consumers/%d", consumer.SessionID)
+	w = doAdminRequest(http.MethodGet, sessionURL, "root", "taosdata")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var getResp GetConsumerResp
+	err = json.Unmarshal(w.Body.Bytes(), &getResp)
+	require.NoError(t, err)
+	detail := getResp.Consumer
+	assert.NotNil(t, detail.LastCommitTime)
+	assert.Equal(t, uint64(0), detail.UncommittedMessages)
+	require.NotEqual(t, 0, len(detail.Offsets))
+	found := false
+	for _, offset := range detail.Offsets {
+		assert.Equal(t, topic, offset.Topic)
+		if offset.VgroupID == pollResp.VgroupID {
+			found = true
+			require.NotNil(t, offset.Committed)
+			assert.True(t, *offset.Committed > 0)
+			assert.True(t, offset.Position > 0)
+		}
+	}
+	assert.True(t, found)
+
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers/abc", "root", "taosdata")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doAdminRequest(http.MethodGet, "/admin/tmq/consumers/-1", "root", "taosdata")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// close
+	w = doAdminRequest(http.MethodDelete, sessionURL, "root", "taosdata")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doAdminRequest(http.MethodGet, sessionURL, "root", "taosdata")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doAdminRequest(http.MethodDelete, sessionURL, "root", "taosdata")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, _, err = ws.ReadMessage()
+	assert.Error(t, err)
+}
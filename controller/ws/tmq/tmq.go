@@ -17,6 +17,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/taosdata/taosadapter/v3/config"
 	"github.com/taosdata/taosadapter/v3/controller"
+	"github.com/taosdata/taosadapter/v3/controller/rest"
 	"github.com/taosdata/taosadapter/v3/controller/ws/wstool"
 	"github.com/taosdata/taosadapter/v3/db/asynctmq"
 	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqhandle"
@@ -49,7 +50,9 @@ func NewTMQController() *TMQController {
 	tmqM.HandleConnect(func(session *melody.Session) {
 		logger := wstool.GetLogger(session)
 		logger.Debug("ws connect")
-		session.Set(TaosTMQKey, NewTaosTMQ(session))
+		t := NewTaosTMQ(session)
+		session.Set(TaosTMQKey, t)
+		addSession(t)
 	})
 
 	tmqM.HandleMessage(func(session *melody.Session, data []byte) {
@@ -238,8 +241,12 @@ func (s *TMQController) Init(ctl gin.IRouter) {
 		sessionID := generator.GetSessionID()
 		logger := log.GetLogger("TMQ").WithFields(logrus.Fields{
 			config.SessionIDKey: sessionID})
-		_ = s.tmqM.HandleRequestWithKeys(c.Writer, c.Request, map[string]interface{}{"logger": logger})
+		_ = s.tmqM.HandleRequestWithKeys(c.Writer, c.Request, map[string]interface{}{"logger": logger, config.SessionIDKey: sessionID})
 	})
+	admin := ctl.Group("admin/tmq", rest.AdminHandlers()...)
+	admin.GET("consumers", s.listConsumers)
+	admin.GET("consumers/:id", s.getConsumer)
+	admin.DELETE("consumers/:id", s.closeConsumer)
 }
 
 type TMQ struct {
@@ -266,6 +273,11 @@ type TMQ struct {
 	conn                  unsafe.Pointer
 	whitelistChangeHandle cgo.Handle
 	dropUserHandle        cgo.Handle
+	sessionID             int64
+	connectTime           time.Time
+	// state is the state of the consumer shown by the admin api
+	state     consumerState
+	stateLock sync.RWMutex
 	sync.Mutex
 }
 
@@ -291,6 +303,10 @@ func NewTaosTMQ(session *melody.Session) *TMQ {
 	ipAddr := iptool.GetRealIP(session.Request)
 	whitelistChangeChan, whitelistChangeHandle := tool.GetRegisterChangeWhiteListHandle()
 	dropUserChan, dropUserHandle := tool.GetRegisterDropUserHandle()
+	var sessionID int64
+	if id, exists := session.Get(config.SessionIDKey); exists {
+		sessionID = id.(int64)
+	}
 	return &TMQ{
 		tmpMessage:            &Message{},
 		handler:               tmqhandle.GlobalTMQHandlerPoll.Get(),
@@ -306,6 +322,8 @@ func NewTaosTMQ(session *melody.Session) *TMQ {
 		ip:                    ipAddr,
 		ipStr:                 ipAddr.String(),
 		logger:                logger,
+		sessionID:             sessionID,
+		connectTime:           time.Now(),
 	}
 }
 
@@ -446,6 +464,7 @@ func (t *TMQ) subscribe(ctx context.Context, session *melody.Session, req *TMQSu
 				return
 			}
 			t.unsubscribed = false
+			t.setSubscription(req)
 			wstool.WSWriteJson(session, logger, &TMQSubscribeResp{
 				Action: action,
 				ReqID:  req.ReqID,
@@ -617,6 +636,7 @@ func (t *TMQ) subscribe(ctx context.Context, session *melody.Session, req *TMQSu
 
 	t.conn = conn
 	t.consumer = cPointer
+	t.setSubscription(req)
 	logger.Trace("start to wait signal")
 	go t.waitSignal(t.logger)
 	wstool.WSWriteJson(session, logger, &TMQSubscribeResp{
@@ -681,6 +701,7 @@ func (t *TMQ) commit(ctx context.Context, session *melody.Session, req *TMQCommi
 		wsTMQErrorMsg(ctx, session, logger, int(errCode), errStr, action, req.ReqID, nil)
 		return
 	}
+	t.setCommitted()
 	resp := &TMQCommitResp{
 		Action:    action,
 		ReqID:     req.ReqID,
@@ -730,6 +751,8 @@ func (t *TMQ) poll(ctx context.Context, session *melody.Session, req *TMQPollReq
 		if errCode != 0 {
 			errStr := wrapper.TMQErr2Str(errCode)
 			logger.Errorf("tmq autocommit error:%s", taoserrors.NewError(int(errCode), errStr))
+		} else {
+			t.setCommitted()
 		}
 		t.nextTime = now.Add(t.autocommitInterval)
 	}
@@ -737,6 +760,7 @@ func (t *TMQ) poll(ctx context.Context, session *melody.Session, req *TMQPollReq
 	if closed {
 		logger.Trace("server closed")
 	}
+	t.setPolled(now)
 	resp := &TMQPollResp{
 		Action: action,
 		ReqID:  req.ReqID,
@@ -772,6 +796,7 @@ func (t *TMQ) poll(ctx context.Context, session *melody.Session, req *TMQPollReq
 			resp.MessageID = t.tmpMessage.Index
 			resp.MessageType = messageType
 			resp.Offset = t.tmpMessage.Offset
+			t.setMessage(t.tmpMessage)
 			logger.Tracef("get message %d, topic:%s, vgroup:%d, offset:%d, db:%s", uintptr(message), t.tmpMessage.Topic, t.tmpMessage.VGroupID, t.tmpMessage.Offset, resp.Database)
 		} else {
 			logger.Errorf("unavailable tmq type:%d", messageType)
@@ -1167,6 +1192,7 @@ func (t *TMQ) unsubscribe(ctx context.Context, session *melody.Session, req *TMQ
 	t.freeMessage(false)
 	logger.Trace("free all result finished")
 	t.unsubscribed = true
+	t.setUnsubscribed()
 	wstool.WSWriteJson(session, logger, &TMQUnsubscribeResp{
 		Action: action,
 		ReqID:  req.ReqID,
@@ -1268,6 +1294,7 @@ func (t *TMQ) Close(logger *logrus.Entry) {
 	t.closedLock.Lock()
 	t.closed = true
 	t.closedLock.Unlock()
+	removeSession(t)
 	start := time.Now()
 	logger.Info("tmq close")
 	defer func() {
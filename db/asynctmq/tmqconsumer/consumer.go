@@ -0,0 +1,626 @@
+package tmqconsumer
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqhandle"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	taoserrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper/cgo"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+var (
+	ErrClosed             = errors.New("tmq consumer closed")
+	ErrWhitelistForbidden = errors.New("whitelist prohibits current IP access")
+)
+
+// Config is the subscription of a server managed consumer.
+type Config struct {
+	User               string
+	Password           string
+	GroupID            string
+	ClientID           string
+	Topics             []string
+	OffsetReset        string
+	AutoCommit         bool
+	AutoCommitInterval time.Duration
+	IP                 net.IP
+	App                string
+	// RawValues fills Block.Values with the typed values instead of Block.Rows
+	RawValues bool
+}
+
+// Consumer is a TMQ consumer kept by taosAdapter between requests, every call runs on its own tmq thread
+// through the asynctmq handlers like the websocket consumer.
+type Consumer struct {
+	conf                  Config
+	logger                *logrus.Entry
+	thread                unsafe.Pointer
+	handler               *tmqhandle.TMQHandler
+	consumer              unsafe.Pointer
+	conn                  unsafe.Pointer
+	asyncLocker           sync.Mutex
+	closed                bool
+	closedLock            sync.RWMutex
+	nextCommit            time.Time
+	whitelist             []*net.IPNet
+	whitelistLock         sync.RWMutex
+	whitelistChangeChan   chan int64
+	whitelistChangeHandle cgo.Handle
+	dropUserChan          chan struct{}
+	dropUserHandle        cgo.Handle
+	exit                  chan struct{}
+	onClose               func()
+	created               time.Time
+	lastAccess            int64
+	active                int32
+	messages              uint64
+	rows                  uint64
+}
+
+// Message is a polled data message, the rows are json objects keyed by column name encoded the same as /rest/sql.
+type Message struct {
+	Topic    string
+	Database string
+	VgroupID int32
+	Offset   int64
+	Blocks   []*Block
+}
+
+type Block struct {
+	TableName string
+	Rows      [][]byte
+	Fields    []string
+	Types     []uint8
+	Precision int
+	Values    [][]driver.Value
+}
+
+// OffsetInvalid is the offset of a vgroup without committed offset.
+const OffsetInvalid = -2147467247
+
+// New creates the consumer and subscribes the topics, the connection ip is checked against the user whitelist.
+func New(conf *Config, logger *logrus.Entry) (*Consumer, error) {
+	isDebug := log.IsDebug()
+	whitelistChangeChan, whitelistChangeHandle := tool.GetRegisterChangeWhiteListHandle()
+	dropUserChan, dropUserHandle := tool.GetRegisterDropUserHandle()
+	c := &Consumer{
+		conf:                  *conf,
+		logger:                logger,
+		thread:                asynctmq.InitTMQThread(),
+		handler:               tmqhandle.GlobalTMQHandlerPoll.Get(),
+		whitelistChangeChan:   whitelistChangeChan,
+		whitelistChangeHandle: whitelistChangeHandle,
+		dropUserChan:          dropUserChan,
+		dropUserHandle:        dropUserHandle,
+		exit:                  make(chan struct{}),
+		created:               time.Now(),
+	}
+	c.touch()
+	if err := c.subscribe(logger, isDebug); err != nil {
+		c.release(logger, isDebug)
+		tool.PutRegisterChangeWhiteListHandle(whitelistChangeHandle)
+		tool.PutRegisterDropUserHandle(dropUserHandle)
+		return nil, err
+	}
+	go c.waitSignal()
+	return c, nil
+}
+
+func (c *Consumer) subscribe(logger *logrus.Entry, isDebug bool) error {
+	tmqConfig := wrapper.TMQConfNew()
+	defer wrapper.TMQConfDestroy(tmqConfig)
+	options := map[string]string{
+		"td.connect.user":     c.conf.User,
+		"td.connect.pass":     c.conf.Password,
+		"msg.with.table.name": "true",
+		// commit is driven by the consumer
+		"enable.auto.commit": "false",
+	}
+	if len(c.conf.GroupID) != 0 {
+		options["group.id"] = c.conf.GroupID
+	}
+	if len(c.conf.ClientID) != 0 {
+		options["client.id"] = c.conf.ClientID
+	}
+	if len(c.conf.OffsetReset) != 0 {
+		options["auto.offset.reset"] = c.conf.OffsetReset
+	}
+	for k, v := range options {
+		code := wrapper.TMQConfSet(tmqConfig, k, v)
+		if code != 0 {
+			return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+		}
+	}
+	c.asyncLocker.Lock()
+	asynctmq.TaosaTMQNewConsumerA(c.thread, tmqConfig, c.handler.Handler)
+	result := <-c.handler.Caller.NewConsumerResult
+	c.asyncLocker.Unlock()
+	if len(result.ErrStr) > 0 {
+		return taoserrors.NewError(-1, result.ErrStr)
+	}
+	if result.Consumer == nil {
+		return taoserrors.NewError(-1, "new consumer return nil")
+	}
+	c.consumer = result.Consumer
+	topicList := wrapper.TMQListNew()
+	defer wrapper.TMQListDestroy(topicList)
+	for _, topic := range c.conf.Topics {
+		code := wrapper.TMQListAppend(topicList, topic)
+		if code != 0 {
+			return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+		}
+	}
+	c.asyncLocker.Lock()
+	asynctmq.TaosaTMQSubscribeA(c.thread, c.consumer, topicList, c.handler.Handler)
+	code := <-c.handler.Caller.SubscribeResult
+	c.asyncLocker.Unlock()
+	if code != 0 {
+		return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+	}
+	c.conn = wrapper.TMQGetConnect(c.consumer)
+	whitelist, err := tool.GetWhitelist(c.conn)
+	if err != nil {
+		return err
+	}
+	c.whitelist = whitelist
+	if !c.CheckWhitelist(c.conf.IP) {
+		logger.Errorf("ip not in whitelist, ip:%s, whitelist:%s", c.conf.IP, tool.IpNetSliceToString(whitelist))
+		return ErrWhitelistForbidden
+	}
+	if err = tool.RegisterChangeWhitelist(c.conn, c.whitelistChangeHandle); err != nil {
+		return err
+	}
+	if err = tool.RegisterDropUser(c.conn, c.dropUserHandle); err != nil {
+		return err
+	}
+	ip := c.conf.IP.String()
+	if code := syncinterface.TaosOptionsConnection(c.conn, common.TSDB_OPTION_CONNECTION_USER_IP, &ip, logger, isDebug); code != 0 {
+		return taoserrors.NewError(code, wrapper.TaosErrorStr(nil))
+	}
+	if len(c.conf.App) != 0 {
+		if code := syncinterface.TaosOptionsConnection(c.conn, common.TSDB_OPTION_CONNECTION_USER_APP, &c.conf.App, logger, isDebug); code != 0 {
+			return taoserrors.NewError(code, wrapper.TaosErrorStr(nil))
+		}
+	}
+	return nil
+}
+
+// waitSignal closes the consumer when the user is dropped and refreshes the whitelist when it changes.
+func (c *Consumer) waitSignal() {
+	defer func() {
+		tool.PutRegisterChangeWhiteListHandle(c.whitelistChangeHandle)
+		tool.PutRegisterDropUserHandle(c.dropUserHandle)
+	}()
+	for {
+		select {
+		case <-c.dropUserChan:
+			c.logger.Info("user dropped, close tmq consumer")
+			go c.Close()
+			return
+		case <-c.whitelistChangeChan:
+			if c.IsClosed() {
+				return
+			}
+			whitelist, err := tool.GetWhitelist(c.conn)
+			if err != nil {
+				c.logger.Errorf("get whitelist error, close tmq consumer, err:%s", err)
+				go c.Close()
+				return
+			}
+			c.whitelistLock.Lock()
+			c.whitelist = whitelist
+			c.whitelistLock.Unlock()
+		case <-c.exit:
+			return
+		}
+	}
+}
+
+func (c *Consumer) CheckWhitelist(ip net.IP) bool {
+	c.whitelistLock.RLock()
+	defer c.whitelistLock.RUnlock()
+	return tool.CheckWhitelist(c.whitelist, ip)
+}
+
+// Poll waits up to blockingTime for a message, it returns nil if there is no message. Timestamps are formatted in
+// the location. With auto commit the offsets of the messages polled before are committed every auto commit interval.
+func (c *Consumer) Poll(blockingTime time.Duration, location *time.Location) (*Message, error) {
+	isDebug := log.IsDebug()
+	c.touch()
+	if c.conf.AutoCommit {
+		now := time.Now()
+		if now.After(c.nextCommit) {
+			if err := c.Commit(); err != nil {
+				c.logger.Errorf("tmq auto commit error, err:%s", err)
+			}
+			c.nextCommit = now.Add(c.conf.AutoCommitInterval)
+		}
+	}
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return nil, ErrClosed
+	}
+	asynctmq.TaosaTMQPollA(c.thread, c.consumer, blockingTime.Milliseconds(), c.handler.Handler)
+	res := <-c.handler.Caller.PollResult
+	c.asyncLocker.Unlock()
+	if res == nil {
+		return nil, nil
+	}
+	defer c.freeResult(res)
+	message := &Message{
+		Topic:    wrapper.TMQGetTopicName(res),
+		Database: wrapper.TMQGetDBName(res),
+		VgroupID: wrapper.TMQGetVgroupID(res),
+		Offset:   wrapper.TMQGetVgroupOffset(res),
+	}
+	messageType := wrapper.TMQGetResType(res)
+	if messageType != common.TMQ_RES_DATA && messageType != common.TMQ_RES_METADATA {
+		c.logger.Tracef("skip tmq message, type:%d, topic:%s, vgroup_id:%d, offset:%d", messageType, message.Topic, message.VgroupID, message.Offset)
+		return message, nil
+	}
+	for {
+		c.asyncLocker.Lock()
+		if c.IsClosed() {
+			c.asyncLocker.Unlock()
+			return nil, ErrClosed
+		}
+		asynctmq.TaosaTMQFetchRawBlockA(c.thread, res, c.handler.Handler)
+		rawBlock := <-c.handler.Caller.FetchRawBlockResult
+		c.asyncLocker.Unlock()
+		if rawBlock.Code != 0 {
+			return nil, taoserrors.NewError(rawBlock.Code, wrapper.TMQErr2Str(int32(rawBlock.Code)))
+		}
+		if rawBlock.BlockSize == 0 {
+			break
+		}
+		var block *Block
+		var err error
+		if c.conf.RawValues {
+			block, err = readBlock(res, rawBlock.Block, rawBlock.BlockSize)
+		} else {
+			block, err = encodeBlock(res, rawBlock.Block, rawBlock.BlockSize, location, c.logger)
+		}
+		if err != nil {
+			return nil, err
+		}
+		message.Blocks = append(message.Blocks, block)
+		atomic.AddUint64(&c.rows, uint64(rawBlock.BlockSize))
+	}
+	atomic.AddUint64(&c.messages, 1)
+	if isDebug {
+		c.logger.Debugf("poll tmq message, topic:%s, vgroup_id:%d, offset:%d, blocks:%d", message.Topic, message.VgroupID, message.Offset, len(message.Blocks))
+	}
+	return message, nil
+}
+
+// encodeBlock encodes the rows of the raw block as json objects keyed by column name.
+func encodeBlock(res, block unsafe.Pointer, blockSize int, location *time.Location, logger *logrus.Entry) (*Block, error) {
+	fieldsCount := wrapper.TaosNumFields(res)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		return nil, err
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	pHeaderList := make([]unsafe.Pointer, fieldsCount)
+	pStartList := make([]unsafe.Pointer, fieldsCount)
+	ctools.RawBlockColumnPointers(block, blockSize, rowsHeader.ColTypes, pHeaderList, pStartList)
+	result := &Block{
+		TableName: wrapper.TMQGetTableName(res),
+		Rows:      make([][]byte, blockSize),
+	}
+	builder := jsonbuilder.BorrowStream(nil)
+	defer jsonbuilder.ReturnStream(builder)
+	timeBuffer := make([]byte, 0, 30)
+	for row := 0; row < blockSize; row++ {
+		builder.SetBuffer(builder.Buffer()[:0])
+		builder.WriteObjectStart()
+		for column := 0; column < fieldsCount; column++ {
+			builder.WriteObjectField(rowsHeader.ColNames[column])
+			ctools.JsonWriteRawBlock(builder, rowsHeader.ColTypes[column], pHeaderList[column], pStartList[column], row, precision, location, timeBuffer, logger)
+			if column != fieldsCount-1 {
+				builder.WriteMore()
+			}
+		}
+		builder.WriteObjectEnd()
+		result.Rows[row] = append([]byte(nil), builder.Buffer()...)
+	}
+	return result, nil
+}
+
+// readBlock reads the typed values of the raw block, the strings are copied since the block is freed with the
+// message.
+func readBlock(res, block unsafe.Pointer, blockSize int) (*Block, error) {
+	fieldsCount := wrapper.TaosNumFields(res)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		return nil, err
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	values := parser.ReadBlock(block, blockSize, rowsHeader.ColTypes, precision)
+	for _, row := range values {
+		for i, v := range row {
+			switch value := v.(type) {
+			case string:
+				row[i] = string([]byte(value))
+			case []byte:
+				row[i] = append([]byte(nil), value...)
+			}
+		}
+	}
+	return &Block{
+		TableName: wrapper.TMQGetTableName(res),
+		Fields:    rowsHeader.ColNames,
+		Types:     rowsHeader.ColTypes,
+		Precision: precision,
+		Values:    values,
+	}, nil
+}
+
+// WriteRow writes the row with the position of the message and the table name as a json object.
+func WriteRow(builder *jsonbuilder.Stream, message *Message, tableName string, row []byte) {
+	builder.WriteObjectStart()
+	builder.WriteObjectField("topic")
+	builder.WriteString(message.Topic)
+	builder.WriteMore()
+	builder.WriteObjectField("database")
+	builder.WriteString(message.Database)
+	builder.WriteMore()
+	builder.WriteObjectField("vgroup_id")
+	builder.WriteInt32(message.VgroupID)
+	builder.WriteMore()
+	builder.WriteObjectField("offset")
+	builder.WriteInt64(message.Offset)
+	builder.WriteMore()
+	builder.WriteObjectField("table_name")
+	builder.WriteString(tableName)
+	builder.WriteMore()
+	builder.WriteObjectField("data")
+	builder.Write(row)
+	builder.WriteObjectEnd()
+}
+
+// freeResult frees the message on the tmq thread, or directly if the consumer was closed during the poll and the
+// thread and the handler are released.
+func (c *Consumer) freeResult(res unsafe.Pointer) {
+	c.asyncLocker.Lock()
+	defer c.asyncLocker.Unlock()
+	if c.IsClosed() || c.handler == nil {
+		syncinterface.FreeResult(res, c.logger, log.IsDebug())
+		return
+	}
+	asynctmq.TaosaTMQFreeResultA(c.thread, res, c.handler.Handler)
+	<-c.handler.Caller.FreeResult
+}
+
+// Commit commits the offsets of all the messages polled.
+func (c *Consumer) Commit() error {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return ErrClosed
+	}
+	asynctmq.TaosaTMQCommitA(c.thread, c.consumer, nil, c.handler.Handler)
+	code := <-c.handler.Caller.CommitResult
+	c.asyncLocker.Unlock()
+	if code != 0 {
+		return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+	}
+	return nil
+}
+
+// CommitOffset commits the offset of the vgroup of the topic.
+func (c *Consumer) CommitOffset(topic string, vgroupID int32, offset int64) error {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return ErrClosed
+	}
+	asynctmq.TaosaTMQCommitOffset(c.thread, c.consumer, topic, vgroupID, offset, c.handler.Handler)
+	code := <-c.handler.Caller.CommitResult
+	c.asyncLocker.Unlock()
+	if code != 0 {
+		return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+	}
+	return nil
+}
+
+// Assignment returns the vgroups of the topic assigned to the consumer.
+func (c *Consumer) Assignment(topic string) ([]*tmqhandle.Assignment, error) {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return nil, ErrClosed
+	}
+	asynctmq.TaosaTMQGetTopicAssignmentA(c.thread, c.consumer, topic, c.handler.Handler)
+	result := <-c.handler.Caller.GetTopicAssignmentResult
+	c.asyncLocker.Unlock()
+	if result.Code != 0 {
+		return nil, taoserrors.NewError(int(result.Code), wrapper.TMQErr2Str(result.Code))
+	}
+	return result.Assignment, nil
+}
+
+// Seek sets the offset of the vgroup of the topic that the next poll starts from.
+func (c *Consumer) Seek(topic string, vgroupID int32, offset int64) error {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return ErrClosed
+	}
+	asynctmq.TaosaTMQOffsetSeekA(c.thread, c.consumer, topic, vgroupID, offset, c.handler.Handler)
+	code := <-c.handler.Caller.OffsetSeekResult
+	c.asyncLocker.Unlock()
+	if code != 0 {
+		return taoserrors.NewError(int(code), wrapper.TMQErr2Str(code))
+	}
+	return nil
+}
+
+// Committed returns the committed offset of the vgroup of the topic, OffsetInvalid if nothing was committed.
+func (c *Consumer) Committed(topic string, vgroupID int32) (int64, error) {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return 0, ErrClosed
+	}
+	asynctmq.TaosaTMQCommitted(c.thread, c.consumer, topic, vgroupID, c.handler.Handler)
+	offset := <-c.handler.Caller.CommittedResult
+	c.asyncLocker.Unlock()
+	if offset < 0 && offset != OffsetInvalid {
+		return 0, taoserrors.NewError(int(offset), wrapper.TMQErr2Str(int32(offset)))
+	}
+	return offset, nil
+}
+
+// Position returns the offset of the vgroup of the topic that the next poll starts from.
+func (c *Consumer) Position(topic string, vgroupID int32) (int64, error) {
+	c.asyncLocker.Lock()
+	if c.IsClosed() {
+		c.asyncLocker.Unlock()
+		return 0, ErrClosed
+	}
+	asynctmq.TaosaTMQPosition(c.thread, c.consumer, topic, vgroupID, c.handler.Handler)
+	offset := <-c.handler.Caller.PositionResult
+	c.asyncLocker.Unlock()
+	if offset < 0 && offset != OffsetInvalid {
+		return 0, taoserrors.NewError(int(offset), wrapper.TMQErr2Str(int32(offset)))
+	}
+	return offset, nil
+}
+
+func (c *Consumer) IsClosed() bool {
+	c.closedLock.RLock()
+	defer c.closedLock.RUnlock()
+	return c.closed
+}
+
+// Done is closed when the consumer is closed.
+func (c *Consumer) Done() <-chan struct{} {
+	return c.exit
+}
+
+// Close unsubscribes and closes the consumer, then releases the tmq thread and the handler.
+func (c *Consumer) Close() {
+	c.closedLock.Lock()
+	if c.closed {
+		c.closedLock.Unlock()
+		return
+	}
+	c.closed = true
+	c.closedLock.Unlock()
+	start := time.Now()
+	c.release(c.logger, log.IsDebug())
+	c.logger.Infof("tmq consumer closed, cost:%s", time.Since(start))
+	if c.onClose != nil {
+		c.onClose()
+	}
+}
+
+func (c *Consumer) release(logger *logrus.Entry, isDebug bool) {
+	c.asyncLocker.Lock()
+	defer c.asyncLocker.Unlock()
+	if c.consumer != nil {
+		asynctmq.TaosaTMQUnsubscribeA(c.thread, c.consumer, c.handler.Handler)
+		if code := <-c.handler.Caller.UnsubscribeResult; code != 0 {
+			logger.Errorf("tmq unsubscribe error, code:%d, msg:%s", code, wrapper.TMQErr2Str(code))
+		}
+		asynctmq.TaosaTMQConsumerCloseA(c.thread, c.consumer, c.handler.Handler)
+		if code := <-c.handler.Caller.ConsumerCloseResult; code != 0 {
+			logger.Errorf("tmq close consumer error, code:%d, msg:%s", code, wrapper.TMQErr2Str(code))
+		}
+		c.consumer = nil
+	}
+	if c.thread != nil {
+		s := log.GetLogNow(isDebug)
+		asynctmq.DestroyTMQThread(c.thread)
+		logger.Debugf("destroy tmq thread cost:%s", log.GetLogDuration(isDebug, s))
+		c.thread = nil
+	}
+	if c.handler != nil {
+		tmqhandle.GlobalTMQHandlerPoll.Put(c.handler)
+		c.handler = nil
+	}
+	close(c.exit)
+}
+
+func (c *Consumer) touch() {
+	atomic.StoreInt64(&c.lastAccess, time.Now().UnixNano())
+}
+
+// Acquire marks the consumer in use by a stream, only one stream is allowed at a time.
+func (c *Consumer) Acquire() bool {
+	return atomic.CompareAndSwapInt32(&c.active, 0, 1)
+}
+
+func (c *Consumer) Release() {
+	c.touch()
+	atomic.StoreInt32(&c.active, 0)
+}
+
+// Owner returns true if the consumer was created by the user with the password.
+func (c *Consumer) Owner(user, password string) bool {
+	return c.conf.User == user && c.conf.Password == password
+}
+
+// Info is the state of the consumer.
+type Info struct {
+	GroupID    string    `json:"group_id"`
+	ClientID   string    `json:"client_id"`
+	Topics     []string  `json:"topics"`
+	User       string    `json:"user"`
+	IP         string    `json:"ip"`
+	AutoCommit bool      `json:"auto_commit"`
+	Active     bool      `json:"active"`
+	Created    time.Time `json:"created"`
+	LastAccess time.Time `json:"last_access"`
+	Messages   uint64    `json:"messages"`
+	Rows       uint64    `json:"rows"`
+}
+
+func (c *Consumer) Info() *Info {
+	return &Info{
+		GroupID:    c.conf.GroupID,
+		ClientID:   c.conf.ClientID,
+		Topics:     c.conf.Topics,
+		User:       c.conf.User,
+		IP:         c.conf.IP.String(),
+		AutoCommit: c.conf.AutoCommit,
+		Active:     atomic.LoadInt32(&c.active) == 1,
+		Created:    c.created,
+		LastAccess: time.Unix(0, atomic.LoadInt64(&c.lastAccess)),
+		Messages:   atomic.LoadUint64(&c.messages),
+		Rows:       atomic.LoadUint64(&c.rows),
+	}
+}
+
+// Key identifies a consumer by group, client id and topics.
+func Key(groupID, clientID string, topics []string) string {
+	key := strconv.Quote(groupID) + "/" + strconv.Quote(clientID)
+	for _, topic := range topics {
+		key += "/" + strconv.Quote(topic)
+	}
+	return key
+}
+
+func (c *Consumer) String() string {
+	return fmt.Sprintf("group:%s, client_id:%s, topics:%v", c.conf.GroupID, c.conf.ClientID, c.conf.Topics)
+}
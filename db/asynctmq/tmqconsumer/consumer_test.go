@@ -0,0 +1,36 @@
+package tmqconsumer
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqhandle"
+	"github.com/taosdata/taosadapter/v3/thread"
+)
+
+func TestConsumer_CloseDuringPoll(t *testing.T) {
+	if thread.SyncLocker == nil {
+		thread.SyncLocker = thread.NewLocker(1)
+	}
+	c := &Consumer{
+		logger:  logger,
+		thread:  asynctmq.InitTMQThread(),
+		handler: tmqhandle.GlobalTMQHandlerPoll.Get(),
+		exit:    make(chan struct{}),
+		created: time.Now(),
+	}
+	// the consumer is closed by another goroutine after poll returned a message
+	c.Close()
+	require.True(t, c.IsClosed())
+	assert.Nil(t, c.handler)
+	var message int
+	assert.NotPanics(t, func() {
+		c.freeResult(unsafe.Pointer(&message))
+	})
+	_, err := c.Poll(time.Millisecond, time.UTC)
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,191 @@
+package tmqconsumer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTooManyConsumers = errors.New("too many tmq consumers")
+	ErrNotOwner         = errors.New("tmq consumer belongs to another user")
+)
+
+// Holder keeps the server managed consumers by key, consumers idle for longer than ttl are closed by the reaper.
+// A consumer is idle when no stream is reading it.
+type Holder struct {
+	maxCount  int
+	ttl       time.Duration
+	consumers map[string]*Consumer
+	exit      chan struct{}
+	newFunc   func(conf *Config, logger *logrus.Entry) (*Consumer, error)
+	sync.RWMutex
+}
+
+func NewHolder(maxCount int, ttl time.Duration) *Holder {
+	return &Holder{
+		maxCount:  maxCount,
+		ttl:       ttl,
+		consumers: make(map[string]*Consumer),
+		exit:      make(chan struct{}),
+		newFunc:   New,
+	}
+}
+
+// GetOrCreate returns the consumer of the key, the consumer is created if it does not exist. The consumer is
+// created without holding the lock, if another request created the same consumer meanwhile the new one is closed.
+func (h *Holder) GetOrCreate(key string, conf *Config, logger *logrus.Entry) (*Consumer, bool, error) {
+	consumer, err := h.Get(key, conf.User, conf.Password)
+	if err != nil || consumer != nil {
+		return consumer, false, err
+	}
+	if h.maxCount > 0 && h.Count() >= h.maxCount {
+		return nil, false, ErrTooManyConsumers
+	}
+	consumer, err = h.newFunc(conf, logger)
+	if err != nil {
+		return nil, false, err
+	}
+	h.Lock()
+	exist := h.consumers[key]
+	if exist == nil && h.maxCount > 0 && len(h.consumers) >= h.maxCount {
+		err = ErrTooManyConsumers
+	}
+	if exist == nil && err == nil {
+		consumer.onClose = func() {
+			h.remove(key, consumer)
+		}
+		h.consumers[key] = consumer
+	}
+	h.Unlock()
+	if exist != nil || err != nil {
+		consumer.Close()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if exist != nil {
+		if !exist.Owner(conf.User, conf.Password) {
+			return nil, false, ErrNotOwner
+		}
+		exist.touch()
+		return exist, false, nil
+	}
+	return consumer, true, nil
+}
+
+// Get returns the consumer of the key or nil if it does not exist, the consumer must be owned by the user.
+func (h *Holder) Get(key string, user, password string) (*Consumer, error) {
+	h.RLock()
+	consumer := h.consumers[key]
+	h.RUnlock()
+	if consumer == nil {
+		return nil, nil
+	}
+	if !consumer.Owner(user, password) {
+		return nil, ErrNotOwner
+	}
+	consumer.touch()
+	return consumer, nil
+}
+
+func (h *Holder) Count() int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.consumers)
+}
+
+// List returns a copy of the consumers by key.
+func (h *Holder) List() map[string]*Consumer {
+	h.RLock()
+	defer h.RUnlock()
+	result := make(map[string]*Consumer, len(h.consumers))
+	for key, consumer := range h.consumers {
+		result[key] = consumer
+	}
+	return result
+}
+
+// Close removes and closes the consumer, it returns false if the consumer does not exist.
+func (h *Holder) Close(key string) bool {
+	h.Lock()
+	consumer, exist := h.consumers[key]
+	delete(h.consumers, key)
+	h.Unlock()
+	if !exist {
+		return false
+	}
+	consumer.Close()
+	return true
+}
+
+func (h *Holder) remove(key string, consumer *Consumer) {
+	h.Lock()
+	if h.consumers[key] == consumer {
+		delete(h.consumers, key)
+	}
+	h.Unlock()
+}
+
+// FreeExpired closes the consumers that are not read by a stream and not accessed since ttl.
+func (h *Holder) FreeExpired(now time.Time, logger *logrus.Entry) int {
+	deadline := now.Add(-h.ttl).UnixNano()
+	var expired []*Consumer
+	h.Lock()
+	for key, consumer := range h.consumers {
+		if atomic.LoadInt32(&consumer.active) == 0 && atomic.LoadInt64(&consumer.lastAccess) < deadline {
+			expired = append(expired, consumer)
+			delete(h.consumers, key)
+		}
+	}
+	h.Unlock()
+	for _, consumer := range expired {
+		logger.Debugf("tmq consumer expired, %s", consumer)
+		consumer.Close()
+	}
+	return len(expired)
+}
+
+func (h *Holder) FreeAll() {
+	h.Lock()
+	all := h.consumers
+	h.consumers = make(map[string]*Consumer)
+	h.Unlock()
+	for _, consumer := range all {
+		consumer.Close()
+	}
+}
+
+func (h *Holder) StartReaper(logger *logrus.Entry) {
+	if h.ttl <= 0 {
+		return
+	}
+	interval := h.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.exit:
+				return
+			case now := <-ticker.C:
+				h.FreeExpired(now, logger)
+			}
+		}
+	}()
+}
+
+func (h *Holder) Stop() {
+	select {
+	case <-h.exit:
+	default:
+		close(h.exit)
+	}
+	h.FreeAll()
+}
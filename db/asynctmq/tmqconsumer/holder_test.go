@@ -0,0 +1,89 @@
+package tmqconsumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+var logger = log.GetLogger("TST")
+
+func newTestHolder(maxCount int, ttl time.Duration) *Holder {
+	h := NewHolder(maxCount, ttl)
+	h.newFunc = func(conf *Config, logger *logrus.Entry) (*Consumer, error) {
+		c := &Consumer{conf: *conf, logger: logger, exit: make(chan struct{}), created: time.Now()}
+		c.touch()
+		return c, nil
+	}
+	return h
+}
+
+func TestHolder(t *testing.T) {
+	h := newTestHolder(2, time.Minute)
+	conf := &Config{User: "root", Password: "taosdata", GroupID: "g1", ClientID: "c1", Topics: []string{"t1"}}
+	key1 := Key(conf.GroupID, conf.ClientID, conf.Topics)
+	c1, created, err := h.GetOrCreate(key1, conf, logger)
+	require.NoError(t, err)
+	assert.True(t, created)
+	c, created, err := h.GetOrCreate(key1, conf, logger)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, c1, c)
+
+	other := *conf
+	other.Password = "wrong"
+	_, _, err = h.GetOrCreate(key1, &other, logger)
+	assert.ErrorIs(t, err, ErrNotOwner)
+	_, err = h.Get(key1, "root", "wrong")
+	assert.ErrorIs(t, err, ErrNotOwner)
+
+	conf2 := *conf
+	conf2.ClientID = "c2"
+	key2 := Key(conf2.GroupID, conf2.ClientID, conf2.Topics)
+	assert.NotEqual(t, key1, key2)
+	_, _, err = h.GetOrCreate(key2, &conf2, logger)
+	require.NoError(t, err)
+	conf3 := *conf
+	conf3.ClientID = "c3"
+	_, _, err = h.GetOrCreate(Key(conf3.GroupID, conf3.ClientID, conf3.Topics), &conf3, logger)
+	assert.ErrorIs(t, err, ErrTooManyConsumers)
+	assert.Equal(t, 2, h.Count())
+	assert.Len(t, h.List(), 2)
+
+	assert.True(t, h.Close(key2))
+	assert.False(t, h.Close(key2))
+	c, err = h.Get(key2, "root", "taosdata")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	// a consumer read by a stream is not reaped
+	require.True(t, c1.Acquire())
+	assert.False(t, c1.Acquire())
+	assert.Equal(t, 0, h.FreeExpired(time.Now().Add(2*time.Minute), logger))
+	c1.Release()
+	assert.Equal(t, 0, h.FreeExpired(time.Now(), logger))
+	assert.Equal(t, 1, h.FreeExpired(time.Now().Add(2*time.Minute), logger))
+	assert.Equal(t, 0, h.Count())
+	select {
+	case <-c1.Done():
+	default:
+		t.Fatal("expired consumer not closed")
+	}
+
+	// a consumer closed by itself is removed
+	c, _, err = h.GetOrCreate(key1, conf, logger)
+	require.NoError(t, err)
+	c.Close()
+	assert.Equal(t, 0, h.Count())
+	assert.True(t, c.IsClosed())
+	assert.ErrorIs(t, c.Commit(), ErrClosed)
+
+	_, _, err = h.GetOrCreate(key1, conf, logger)
+	require.NoError(t, err)
+	h.Stop()
+	assert.Equal(t, 0, h.Count())
+}
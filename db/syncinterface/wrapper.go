@@ -6,6 +6,7 @@ import (
 	"unsafe"
 
 	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
 	"github.com/taosdata/taosadapter/v3/driver/types"
 	"github.com/taosdata/taosadapter/v3/driver/wrapper"
 	"github.com/taosdata/taosadapter/v3/driver/wrapper/cgo"
@@ -410,6 +411,18 @@ func TaosStmt2BindBinary(stmt2 unsafe.Pointer, data []byte, colIdx int32, logger
 	return err
 }
 
+func TaosStmt2BindParam(stmt2 unsafe.Pointer, isInsert bool, params []*stmt.TaosStmt2BindData, fields []*stmt.Stmt2AllField, colIdx int32, logger *logrus.Entry, isDebug bool) error {
+	logger.Tracef("call taos_stmt2_bind_param, stmt2:%p, isInsert:%t, count:%d, colIdx:%d", stmt2, isInsert, len(params), colIdx)
+	s := log.GetLogNow(isDebug)
+	thread.SyncLocker.Lock()
+	logger.Debugf("get thread lock for taos_stmt2_bind_param cost:%s", log.GetLogDuration(isDebug, s))
+	s = log.GetLogNow(isDebug)
+	err := wrapper.TaosStmt2BindParam(stmt2, isInsert, params, fields, colIdx)
+	logger.Debugf("taos_stmt2_bind_param finish, err:%v, cost:%s", err, log.GetLogDuration(isDebug, s))
+	thread.SyncLocker.Unlock()
+	return err
+}
+
 func TaosOptionsConnection(conn unsafe.Pointer, option int, value *string, logger *logrus.Entry, isDebug bool) int {
 	if value == nil {
 		logger.Tracef("call taos_options_connection, conn:%p, option:%d, value:<nil>", conn, option)
@@ -0,0 +1,38 @@
+package tool
+
+import (
+	"errors"
+	"net"
+
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+)
+
+// IsConnectionError reports whether the error is caused by the connection to the server, such as a connection pool
+// timeout, a network failure or a disconnected client, rather than by the request. The request may succeed when
+// retried, other errors fail again with the same data.
+func IsConnectionError(err error) bool {
+	if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) || errors.Is(err, connectpool.ErrClosed) {
+		return true
+	}
+	var taosError *tErrors.TaosError
+	if errors.As(err, &taosError) {
+		switch taosError.Code {
+		case httperror.RPC_NETWORK_UNAVAIL,
+			httperror.RPC_BROKEN_LINK,
+			httperror.RPC_TIMEOUT,
+			httperror.RPC_SOMENODE_NOT_CONNECTED,
+			httperror.RPC_MAX_SESSIONS,
+			httperror.RPC_NETWORK_ERROR,
+			httperror.RPC_NETWORK_BUSY,
+			httperror.RPC_MODULE_QUIT,
+			httperror.TSDB_CODE_TSC_DISCONNECTED,
+			httperror.TSDB_CODE_TSC_INVALID_CONNECTION:
+			return true
+		}
+		return false
+	}
+	var netError net.Error
+	return errors.As(err, &netError)
+}
@@ -0,0 +1,26 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, IsConnectionError(connectpool.ErrTimeout))
+	assert.True(t, IsConnectionError(fmt.Errorf("get connection: %w", connectpool.ErrMaxWait)))
+	assert.True(t, IsConnectionError(tErrors.NewError(httperror.RPC_NETWORK_UNAVAIL, "Unable to establish connection")))
+	assert.True(t, IsConnectionError(tErrors.NewError(httperror.RPC_TIMEOUT, "Conn read timeout")))
+	assert.True(t, IsConnectionError(tErrors.NewError(httperror.TSDB_CODE_TSC_DISCONNECTED, "Disconnected from server")))
+	assert.True(t, IsConnectionError(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}))
+	assert.False(t, IsConnectionError(tErrors.NewError(0x3002, "Invalid data format")))
+	assert.False(t, IsConnectionError(tErrors.NewError(httperror.TSDB_CODE_MND_DB_NOT_EXIST, "Database not exist")))
+	assert.False(t, IsConnectionError(tErrors.NewError(httperror.TSDB_CODE_MND_AUTH_FAILURE, "Authentication failure")))
+	assert.False(t, IsConnectionError(errors.New("whitelist prohibits current IP access")))
+}
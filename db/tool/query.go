@@ -0,0 +1,33 @@
+package tool
+
+import (
+	"database/sql/driver"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+// QueryExecutor executes the sql of the query api of a plugin on the connection, timestamp values are time.Time.
+type QueryExecutor struct {
+	TaosConn unsafe.Pointer
+	Logger   *logrus.Entry
+	IsDebug  bool
+	ReqID    int64
+}
+
+// Query returns the column names and the rows of the sql.
+func (e *QueryExecutor) Query(sql string) ([]string, [][]driver.Value, error) {
+	e.Logger.Debugf("execute sql: %s", sql)
+	result, err := async.GlobalAsync.TaosExec(e.TaosConn, e.Logger, e.IsDebug, sql, func(ts int64, precision int) driver.Value {
+		return common.TimestampConvertToTime(ts, precision)
+	}, e.ReqID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result.Header == nil {
+		return nil, nil, nil
+	}
+	return result.Header.ColNames, result.Data, nil
+}
@@ -0,0 +1,75 @@
+package tool
+
+import (
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+// IsTableNotExist reports whether the error code means the table of the sql does not exist.
+func IsTableNotExist(code int32) bool {
+	return code == httperror.PAR_TABLE_NOT_EXIST || code == httperror.MND_INVALID_TABLE_NAME || code == httperror.TSC_INVALID_TABLE_NAME
+}
+
+// Stmt2Insert executes the insert sql through stmt2, generate returns the bind data in the timestamp precision of the
+// table, or an error to abort the insert.
+func Stmt2Insert(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, sql string, generate func(precision int) ([]*stmt.TaosStmt2BindData, error)) error {
+	handle, caller := async.GlobalStmt2CallBackCallerPool.Get()
+	defer async.GlobalStmt2CallBackCallerPool.Put(handle)
+	stmt2 := syncinterface.TaosStmt2Init(taosConn, reqID, true, false, handle, logger, isDebug)
+	if stmt2 == nil {
+		errNo := wrapper.TaosError(nil)
+		return tErrors.NewError(errNo, wrapper.TaosErrorStr(nil))
+	}
+	defer syncinterface.TaosStmt2Close(stmt2, logger, isDebug)
+	code := syncinterface.TaosStmt2Prepare(stmt2, sql, logger, isDebug)
+	if code != 0 {
+		return tErrors.NewError(code, wrapper.TaosStmt2Error(stmt2))
+	}
+	code, count, cFields := syncinterface.TaosStmt2GetFields(stmt2, logger, isDebug)
+	if code != 0 {
+		return tErrors.NewError(code, wrapper.TaosStmt2Error(stmt2))
+	}
+	fields := wrapper.Stmt2ParseAllFields(count, cFields)
+	wrapper.TaosStmt2FreeFields(stmt2, cFields)
+	precision := common.PrecisionMilliSecond
+	for _, field := range fields {
+		if field.BindType == stmt.TAOS_FIELD_COL && field.FieldType == common.TSDB_DATA_TYPE_TIMESTAMP {
+			precision = int(field.Precision)
+			break
+		}
+	}
+	start := log.GetLogNow(isDebug)
+	bindData, err := generate(precision)
+	if err != nil {
+		return err
+	}
+	data, err := stmt.MarshalStmt2Binary(bindData, true, fields)
+	logger.Debug("stmt2 insert generate bind data cost:", log.GetLogDuration(isDebug, start))
+	if err != nil {
+		return err
+	}
+	err = syncinterface.TaosStmt2BindBinary(stmt2, data, -1, logger, isDebug)
+	if err != nil {
+		return err
+	}
+	code = syncinterface.TaosStmt2Exec(stmt2, logger, isDebug)
+	if code != 0 {
+		return tErrors.NewError(code, wrapper.TaosStmt2Error(stmt2))
+	}
+	start = log.GetLogNow(isDebug)
+	result := <-caller.ExecResult
+	logger.Debugf("stmt2 insert wait callback finish, affected:%d, n:%d, cost:%s", result.Affected, result.N, log.GetLogDuration(isDebug, start))
+	if result.N < 0 {
+		return tErrors.NewError(result.N&0xffff, wrapper.TaosStmt2Error(stmt2))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package tool
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+func TestStmt2Insert(t *testing.T) {
+	conn, err := wrapper.TaosConnect("", "root", "taosdata", "", 0)
+	require.NoError(t, err)
+	defer wrapper.TaosClose(conn)
+	exec := func(sql string) {
+		r := wrapper.TaosQuery(conn, sql)
+		defer wrapper.TaosFreeResult(r)
+		code := wrapper.TaosError(r)
+		require.Equal(t, 0, code, wrapper.TaosErrorStr(r))
+	}
+	exec("create database if not exists test_stmt2_insert precision 'us'")
+	defer exec("drop database if exists test_stmt2_insert")
+	exec("use test_stmt2_insert")
+	logger := log.GetLogger("test").WithField("test", "TestStmt2Insert")
+	var precision int
+	generate := func(p int) ([]*stmt.TaosStmt2BindData, error) {
+		precision = p
+		return []*stmt.TaosStmt2BindData{{
+			TableName: "ct",
+			Tags:      []driver.Value{int32(1)},
+			Cols:      [][]driver.Value{{int64(1000), int64(2000)}, {1.5, nil}},
+		}}, nil
+	}
+	err = Stmt2Insert(conn, logger, false, 0, "insert into ? using st tags(?) values(?,?)", generate)
+	tErr, is := err.(*tErrors.TaosError)
+	require.True(t, is, err)
+	assert.True(t, IsTableNotExist(tErr.Code), err)
+
+	exec("create stable st(ts timestamp,v double) tags(t int)")
+	err = Stmt2Insert(conn, logger, false, 0, "insert into ? using st tags(?) values(?,?)", generate)
+	require.NoError(t, err)
+	assert.Equal(t, common.PrecisionMicroSecond, precision)
+	data, err := async.GlobalAsync.TaosExec(conn, logger, false, "select count(*) from st", func(ts int64, precision int) driver.Value {
+		return ts
+	}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]driver.Value{{int64(2)}}, data.Data)
+
+	// the insert is aborted when generate fails
+	errGenerate := errors.New("generate error")
+	err = Stmt2Insert(conn, logger, false, 0, "insert into ? using st tags(?) values(?,?)", func(int) ([]*stmt.TaosStmt2BindData, error) {
+		return nil, errGenerate
+	})
+	assert.ErrorIs(t, err, errGenerate)
+}
@@ -1,4 +1,5 @@
 package httperror
+
 // Code generated from TDengine. DO NOT EDIT.
 
 const (
@@ -128,11 +129,30 @@ const (
 	TSDB_CODE_PAR_INVALID_FILL_TIME_RANGE = 0x263B
 )
 
+// 403
+const (
+	TSDB_CODE_MND_NO_RIGHTS         = 0x0303
+	TSDB_CODE_PAR_PERMISSION_DENIED = 0x2644
+)
+
 // RPC_NETWORK_UNAVAIL return 502 status code
 const (
 	RPC_NETWORK_UNAVAIL = 0x000B
 )
 
+// connection errors, the request may succeed when retried
+const (
+	RPC_BROKEN_LINK                  = 0x0018
+	RPC_TIMEOUT                      = 0x0019
+	RPC_SOMENODE_NOT_CONNECTED       = 0x0020
+	RPC_MAX_SESSIONS                 = 0x0022
+	RPC_NETWORK_ERROR                = 0x0023
+	RPC_NETWORK_BUSY                 = 0x0024
+	RPC_MODULE_QUIT                  = 0x0025
+	TSDB_CODE_TSC_DISCONNECTED       = 0x0213
+	TSDB_CODE_TSC_INVALID_CONNECTION = 0x020B
+)
+
 // ErrorMsgMap is the map of error code and error message.
 var ErrorMsgMap = map[int]string{
 	TSDB_CODE_RPC_AUTH_FAILURE:   "Authentication failure",
@@ -24,7 +24,12 @@ func main() {
 		if err != nil {
 			logger.Fatalf("listen: %s", err)
 		}
-		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("listen: %s", err)
 		}
 	})
@@ -0,0 +1,104 @@
+package batch
+
+import (
+	"math"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	batchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "write_batches_total",
+			Help:      "Number of batches written by the plugin",
+		},
+		[]string{"plugin"},
+	)
+	rowsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "write_rows_total",
+			Help:      "Number of rows written by the plugin",
+		},
+		[]string{"plugin"},
+	)
+	failuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "write_failures_total",
+			Help:      "Number of batches failed to write by the plugin",
+		},
+		[]string{"plugin"},
+	)
+)
+
+// Batcher caches metrics and writes them in batches.
+// It is not safe for concurrent use, each worker owns a Batcher.
+type Batcher struct {
+	size     int
+	interval time.Duration
+	write    func(metrics []telegraf.Metric) error
+	cache    []telegraf.Metric
+	batches  prometheus.Counter
+	rows     prometheus.Counter
+	failures prometheus.Counter
+}
+
+// NewBatcher returns a Batcher of the plugin which calls write when the cache reaches size.
+// Size less than 1 is treated as 1.
+func NewBatcher(plugin string, size int, interval time.Duration, write func(metrics []telegraf.Metric) error) *Batcher {
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher{
+		size:     size,
+		interval: interval,
+		write:    write,
+		cache:    make([]telegraf.Metric, 0, size),
+		batches:  batchesTotal.WithLabelValues(plugin),
+		rows:     rowsTotal.WithLabelValues(plugin),
+		failures: failuresTotal.WithLabelValues(plugin),
+	}
+}
+
+// Add caches the metrics and flushes the cache when it is full.
+func (b *Batcher) Add(metrics ...telegraf.Metric) {
+	b.cache = append(b.cache, metrics...)
+	if len(b.cache) >= b.size {
+		b.Flush()
+	}
+}
+
+// Flush writes the cached metrics.
+func (b *Batcher) Flush() {
+	if len(b.cache) == 0 {
+		return
+	}
+	err := b.write(b.cache)
+	b.batches.Inc()
+	if err != nil {
+		b.failures.Inc()
+	} else {
+		b.rows.Add(float64(len(b.cache)))
+	}
+	for i := range b.cache {
+		b.cache[i] = nil
+	}
+	b.cache = b.cache[:0]
+}
+
+// NewTicker returns a ticker of the flush interval, the ticker never fires if the interval is not greater than 0.
+func (b *Batcher) NewTicker() *time.Ticker {
+	interval := b.interval
+	if interval <= 0 {
+		interval = math.MaxInt64
+	}
+	return time.NewTicker(interval)
+}
@@ -0,0 +1,64 @@
+package batch
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMetric(value int) telegraf.Metric {
+	return metric.New("m", map[string]string{"host": "a"}, map[string]interface{}{"value": value}, time.Unix(0, 0))
+}
+
+func TestBatcher(t *testing.T) {
+	var batches [][]telegraf.Metric
+	var writeErr error
+	b := NewBatcher("test_batcher", 3, 0, func(metrics []telegraf.Metric) error {
+		batches = append(batches, append([]telegraf.Metric{}, metrics...))
+		return writeErr
+	})
+	b.Add(newMetric(1))
+	b.Add(newMetric(2))
+	assert.Len(t, batches, 0)
+	b.Add(newMetric(3), newMetric(4))
+	assert.Len(t, batches, 1)
+	assert.Len(t, batches[0], 4)
+	b.Flush()
+	assert.Len(t, batches, 1)
+
+	writeErr = errors.New("write error")
+	b.Add(newMetric(5))
+	b.Flush()
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[1], 1)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(batchesTotal.WithLabelValues("test_batcher")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(rowsTotal.WithLabelValues("test_batcher")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(failuresTotal.WithLabelValues("test_batcher")))
+}
+
+func TestBatcherTicker(t *testing.T) {
+	b := NewBatcher("test_ticker", 0, time.Millisecond, func(metrics []telegraf.Metric) error { return nil })
+	assert.Equal(t, 1, b.size)
+	ticker := b.NewTicker()
+	select {
+	case <-ticker.C:
+	case <-time.After(time.Second):
+		t.Fatal("ticker not fired")
+	}
+	ticker.Stop()
+
+	b = NewBatcher("test_ticker", 1, 0, func(metrics []telegraf.Metric) error { return nil })
+	ticker = b.NewTicker()
+	select {
+	case <-ticker.C:
+		t.Fatal("ticker fired")
+	case <-time.After(10 * time.Millisecond):
+	}
+	ticker.Stop()
+}
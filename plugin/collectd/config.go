@@ -1,19 +1,23 @@
 package collectd
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/taosdata/taosadapter/v3/driver/common"
 )
 
 type Config struct {
-	Enable   bool
-	Port     int
-	DB       string
-	User     string
-	Password string
-	Worker   int
-	TTL      int
+	Enable        bool
+	Port          int
+	DB            string
+	User          string
+	Password      string
+	Worker        int
+	TTL           int
+	BatchSize     int
+	FlushInterval time.Duration
 }
 
 func (c *Config) setValue() {
@@ -24,6 +28,11 @@ func (c *Config) setValue() {
 	c.Password = viper.GetString("collectd.password")
 	c.Worker = viper.GetInt("collectd.worker")
 	c.TTL = viper.GetInt("collectd.ttl")
+	c.BatchSize = viper.GetInt("collectd.batchSize")
+	c.FlushInterval = viper.GetDuration("collectd.flushInterval")
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
 }
 
 func init() {
@@ -54,4 +63,12 @@ func init() {
 	_ = viper.BindEnv("collectd.ttl", "TAOS_ADAPTER_COLLECTD_TTL")
 	pflag.Int("collectd.ttl", 0, `collectd data ttl. Env "TAOS_ADAPTER_COLLECTD_TTL"`)
 	viper.SetDefault("collectd.ttl", 0)
+
+	_ = viper.BindEnv("collectd.batchSize", "TAOS_ADAPTER_COLLECTD_BATCH_SIZE")
+	pflag.Int("collectd.batchSize", 1, `collectd batch size. Env "TAOS_ADAPTER_COLLECTD_BATCH_SIZE"`)
+	viper.SetDefault("collectd.batchSize", 1)
+
+	_ = viper.BindEnv("collectd.flushInterval", "TAOS_ADAPTER_COLLECTD_FLUSH_INTERVAL")
+	pflag.Duration("collectd.flushInterval", time.Duration(0), `collectd flush interval (0s means not valid) . Env "TAOS_ADAPTER_COLLECTD_FLUSH_INTERVAL"`)
+	viper.SetDefault("collectd.flushInterval", time.Duration(0))
 }
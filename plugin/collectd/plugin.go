@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +17,8 @@ import (
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
 	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/batch"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
 	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
 	"github.com/taosdata/taosadapter/v3/tools/generator"
 )
@@ -31,7 +34,9 @@ type Plugin struct {
 	conn       *net.UDPConn
 	parser     *collectd.CollectdParser
 	metricChan chan *MetricWithClientIP
-	closeChan  chan struct{}
+	listenDone chan struct{}
+	workerWG   sync.WaitGroup
+	spool      *spool.Spool
 }
 
 func (p *Plugin) Init(_ gin.IRouter) error {
@@ -51,7 +56,7 @@ func (p *Plugin) Start() error {
 		return nil
 	}
 	if p.conn != nil {
-		err := p.conn.Close()
+		err := p.Stop()
 		if err != nil {
 			return err
 		}
@@ -60,23 +65,24 @@ func (p *Plugin) Start() error {
 	if err != nil {
 		return err
 	}
-	p.closeChan = make(chan struct{})
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			return p.insertLines(r.ClientIP, r.DB, r.Data)
+		})
+	}
+	p.listenDone = make(chan struct{})
 	p.metricChan = make(chan *MetricWithClientIP, 2*p.conf.Worker)
+	p.workerWG.Add(p.conf.Worker)
 	for i := 0; i < p.conf.Worker; i++ {
-		go func() {
-			serializer := influx.NewSerializer()
-			for {
-				select {
-				case metric := <-p.metricChan:
-					p.HandleMetrics(serializer, metric.ClientIP, metric.Metric)
-				case <-p.closeChan:
-					return
-				}
-			}
-		}()
+		go p.work()
 	}
 	p.conn = conn
-	go p.listen()
+	go p.listen(conn)
 	return nil
 }
 
@@ -84,11 +90,21 @@ func (p *Plugin) Stop() error {
 	if !p.conf.Enable {
 		return nil
 	}
-	if p.conn != nil {
-		return p.conn.Close()
+	if p.conn == nil {
+		return nil
 	}
-	close(p.closeChan)
-	return nil
+	err := p.conn.Close()
+	p.conn = nil
+	// flush the cached metrics after the listener exits
+	<-p.listenDone
+	close(p.metricChan)
+	p.workerWG.Wait()
+	if p.spool != nil {
+		if spoolErr := p.spool.Close(); err == nil {
+			err = spoolErr
+		}
+	}
+	return err
 }
 
 func (p *Plugin) String() string {
@@ -99,9 +115,38 @@ func (p *Plugin) Version() string {
 	return "v1"
 }
 
-func (p *Plugin) HandleMetrics(serializer *influx.Serializer, clientIP net.IP, metrics []telegraf.Metric) {
+// work writes the metrics in batches, the batch is flushed when the client IP changes since the connection is
+// checked against the whitelist of the client IP.
+func (p *Plugin) work() {
+	defer p.workerWG.Done()
+	serializer := influx.NewSerializer()
+	var clientIP net.IP
+	batcher := batch.NewBatcher(p.String(), p.conf.BatchSize, p.conf.FlushInterval, func(metrics []telegraf.Metric) error {
+		return p.HandleMetrics(serializer, clientIP, metrics)
+	})
+	ticker := batcher.NewTicker()
+	defer ticker.Stop()
+	for {
+		select {
+		case metric, ok := <-p.metricChan:
+			if !ok {
+				batcher.Flush()
+				return
+			}
+			if !clientIP.Equal(metric.ClientIP) {
+				batcher.Flush()
+				clientIP = metric.ClientIP
+			}
+			batcher.Add(metric.Metric...)
+		case <-ticker.C:
+			batcher.Flush()
+		}
+	}
+}
+
+func (p *Plugin) HandleMetrics(serializer *influx.Serializer, clientIP net.IP, metrics []telegraf.Metric) error {
 	if len(metrics) == 0 {
-		return
+		return nil
 	}
 
 	for _, metric := range metrics {
@@ -112,16 +157,22 @@ func (p *Plugin) HandleMetrics(serializer *influx.Serializer, clientIP net.IP, m
 	data, err := serializer.SerializeBatch(metrics)
 	if err != nil {
 		logger.Errorf("serialize collectd error, err:%s", err)
-		return
+		return err
 	}
+	err = p.insertLines(clientIP, p.conf.DB, data)
+	p.spool.AppendFailed(&spool.Record{DB: p.conf.DB, ClientIP: clientIP, Data: data}, err)
+	return err
+}
+
+func (p *Plugin) insertLines(clientIP net.IP, db string, data []byte) error {
 	taosConn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, clientIP)
 	if err != nil {
 		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
 			logger.Errorf("whitelist forbidden, user:%s, clientIP:%s", p.conf.User, clientIP.String())
-			return
+			return err
 		}
 		logger.Errorf("connect server error, err:%s", err)
-		return
+		return err
 	}
 	defer func() {
 		logger.Tracef("put connection")
@@ -133,29 +184,31 @@ func (p *Plugin) HandleMetrics(serializer *influx.Serializer, clientIP net.IP, m
 	isDebug := log.IsDebug()
 	reqID := generator.GetReqID()
 	execLogger := logger.WithField(config.ReqIDKey, reqID)
-	execLogger.Debugf("insert lines, data:%s, db:%s, ttl:%d", data, p.conf.DB, p.conf.TTL)
+	execLogger.Debugf("insert lines, data:%s, db:%s, ttl:%d", data, db, p.conf.TTL)
 	start := log.GetLogNow(isDebug)
-	err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, p.conf.DB, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
+	err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, db, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
 	logger.Debugf("insert lines finish, cost:%s", log.GetLogDuration(isDebug, start))
 	if err != nil {
 		logger.Errorf("insert lines error, err:%s, data:%s", err, data)
-		return
+		return err
 	}
+	return nil
 }
 
-func (p *Plugin) listen() {
+func (p *Plugin) listen(conn *net.UDPConn) {
+	defer close(p.listenDone)
 	buf := make([]byte, 64*1024) // 64kb - maximum size of IP packet
 	for {
-		n, addr, err := p.conn.ReadFrom(buf)
-		if monitor.AllPaused() {
-			continue
-		}
+		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
 			if !strings.HasSuffix(err.Error(), ": use of closed network connection") {
 				logger.Error(err.Error())
 			}
 			break
 		}
+		if monitor.AllPaused() {
+			continue
+		}
 		if addr == nil {
 			logger.Error("addr is nil,ignore data")
 			continue
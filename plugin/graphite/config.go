@@ -0,0 +1,107 @@
+package graphite
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+type Config struct {
+	Enable            bool
+	Port              int
+	PicklePort        int
+	DB                string
+	User              string
+	Password          string
+	Worker            int
+	MaxTCPConnections int
+	TCPKeepAlive      bool
+	Separator         string
+	Templates         []string
+	BatchSize         int
+	FlushInterval     time.Duration
+	TTL               int
+}
+
+func (c *Config) setValue() {
+	c.Enable = viper.GetBool("graphite.enable")
+	c.Port = viper.GetInt("graphite.port")
+	c.PicklePort = viper.GetInt("graphite.picklePort")
+	c.DB = viper.GetString("graphite.db")
+	c.User = viper.GetString("graphite.user")
+	c.Password = viper.GetString("graphite.password")
+	c.Worker = viper.GetInt("graphite.worker")
+	c.MaxTCPConnections = viper.GetInt("graphite.maxTCPConnections")
+	c.TCPKeepAlive = viper.GetBool("graphite.tcpKeepAlive")
+	c.Separator = viper.GetString("graphite.separator")
+	c.Templates = viper.GetStringSlice("graphite.templates")
+	c.BatchSize = viper.GetInt("graphite.batchSize")
+	c.FlushInterval = viper.GetDuration("graphite.flushInterval")
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.Worker < 1 {
+		c.Worker = 1
+	}
+	c.TTL = viper.GetInt("graphite.ttl")
+}
+
+func init() {
+	_ = viper.BindEnv("graphite.enable", "TAOS_ADAPTER_GRAPHITE_ENABLE")
+	pflag.Bool("graphite.enable", false, `enable graphite,warning: without auth info(default false). Env "TAOS_ADAPTER_GRAPHITE_ENABLE"`)
+	viper.SetDefault("graphite.enable", false)
+
+	_ = viper.BindEnv("graphite.port", "TAOS_ADAPTER_GRAPHITE_PORT")
+	pflag.Int("graphite.port", 2003, `graphite plaintext tcp port. Env "TAOS_ADAPTER_GRAPHITE_PORT"`)
+	viper.SetDefault("graphite.port", 2003)
+
+	_ = viper.BindEnv("graphite.picklePort", "TAOS_ADAPTER_GRAPHITE_PICKLE_PORT")
+	pflag.Int("graphite.picklePort", 2004, `graphite pickle tcp port (0 means disabled). Env "TAOS_ADAPTER_GRAPHITE_PICKLE_PORT"`)
+	viper.SetDefault("graphite.picklePort", 2004)
+
+	_ = viper.BindEnv("graphite.db", "TAOS_ADAPTER_GRAPHITE_DB")
+	pflag.String("graphite.db", "graphite", `graphite db name. Env "TAOS_ADAPTER_GRAPHITE_DB"`)
+	viper.SetDefault("graphite.db", "graphite")
+
+	_ = viper.BindEnv("graphite.user", "TAOS_ADAPTER_GRAPHITE_USER")
+	pflag.String("graphite.user", common.DefaultUser, `graphite user. Env "TAOS_ADAPTER_GRAPHITE_USER"`)
+	viper.SetDefault("graphite.user", common.DefaultUser)
+
+	_ = viper.BindEnv("graphite.password", "TAOS_ADAPTER_GRAPHITE_PASSWORD")
+	pflag.String("graphite.password", common.DefaultPassword, `graphite password. Env "TAOS_ADAPTER_GRAPHITE_PASSWORD"`)
+	viper.SetDefault("graphite.password", common.DefaultPassword)
+
+	_ = viper.BindEnv("graphite.worker", "TAOS_ADAPTER_GRAPHITE_WORKER")
+	pflag.Int("graphite.worker", 10, `graphite write worker. Env "TAOS_ADAPTER_GRAPHITE_WORKER"`)
+	viper.SetDefault("graphite.worker", 10)
+
+	_ = viper.BindEnv("graphite.maxTCPConnections", "TAOS_ADAPTER_GRAPHITE_MAX_TCP_CONNECTIONS")
+	pflag.Int("graphite.maxTCPConnections", 250, `graphite max tcp connections. Env "TAOS_ADAPTER_GRAPHITE_MAX_TCP_CONNECTIONS"`)
+	viper.SetDefault("graphite.maxTCPConnections", 250)
+
+	_ = viper.BindEnv("graphite.tcpKeepAlive", "TAOS_ADAPTER_GRAPHITE_TCP_KEEP_ALIVE")
+	pflag.Bool("graphite.tcpKeepAlive", false, `enable tcp keep alive. Env "TAOS_ADAPTER_GRAPHITE_TCP_KEEP_ALIVE"`)
+	viper.SetDefault("graphite.tcpKeepAlive", false)
+
+	_ = viper.BindEnv("graphite.separator", "TAOS_ADAPTER_GRAPHITE_SEPARATOR")
+	pflag.String("graphite.separator", "_", `graphite separator to join the measurement and field parts of templates. Env "TAOS_ADAPTER_GRAPHITE_SEPARATOR"`)
+	viper.SetDefault("graphite.separator", "_")
+
+	_ = viper.BindEnv("graphite.templates", "TAOS_ADAPTER_GRAPHITE_TEMPLATES")
+	pflag.StringSlice("graphite.templates", nil, `graphite templates to map metric paths to measurement and tags, e.g. "servers.* .host.measurement*". Env "TAOS_ADAPTER_GRAPHITE_TEMPLATES"`)
+	viper.SetDefault("graphite.templates", []string{})
+
+	_ = viper.BindEnv("graphite.batchSize", "TAOS_ADAPTER_GRAPHITE_BATCH_SIZE")
+	pflag.Int("graphite.batchSize", 1, `graphite batch size. Env "TAOS_ADAPTER_GRAPHITE_BATCH_SIZE"`)
+	viper.SetDefault("graphite.batchSize", 1)
+
+	_ = viper.BindEnv("graphite.flushInterval", "TAOS_ADAPTER_GRAPHITE_FLUSH_INTERVAL")
+	pflag.Duration("graphite.flushInterval", time.Duration(0), `graphite flush interval (0s means not valid) . Env "TAOS_ADAPTER_GRAPHITE_FLUSH_INTERVAL"`)
+	viper.SetDefault("graphite.flushInterval", time.Duration(0))
+
+	_ = viper.BindEnv("graphite.ttl", "TAOS_ADAPTER_GRAPHITE_TTL")
+	pflag.Int("graphite.ttl", 0, `graphite data ttl. Env "TAOS_ADAPTER_GRAPHITE_TTL"`)
+	viper.SetDefault("graphite.ttl", 0)
+}
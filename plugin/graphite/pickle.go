@@ -0,0 +1,453 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPickleSize is the max size of a pickle frame, the same as carbon
+const maxPickleSize = 1 << 20
+
+// the pickle opcodes used by the carbon senders
+const (
+	opMark           = '('
+	opStop           = '.'
+	opPop            = '0'
+	opPopMark        = '1'
+	opDup            = '2'
+	opFloat          = 'F'
+	opInt            = 'I'
+	opBinInt         = 'J'
+	opBinInt1        = 'K'
+	opLong           = 'L'
+	opBinInt2        = 'M'
+	opNone           = 'N'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opUnicode        = 'V'
+	opBinUnicode     = 'X'
+	opAppend         = 'a'
+	opAppends        = 'e'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opLongBinGet     = 'j'
+	opList           = 'l'
+	opEmptyList      = ']'
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opTuple          = 't'
+	opEmptyTuple     = ')'
+	opBinFloat       = 'G'
+	opBinBytes       = 'B'
+	opShortBinBytes  = 'C'
+	opProto          = 0x80
+	opTuple1         = 0x85
+	opTuple2         = 0x86
+	opTuple3         = 0x87
+	opNewTrue        = 0x88
+	opNewFalse       = 0x89
+	opLong1          = 0x8a
+	opShortBinUni    = 0x8c
+	opMemoize        = 0x94
+	opFrame          = 0x95
+)
+
+// pickleMark marks the start of the items of a list or a tuple on the stack
+type pickleMark struct{}
+
+type pickleList struct {
+	items []interface{}
+}
+
+// unpickle decodes the pickle data of a list of tuples sent by carbon senders. Only the opcodes of the basic types,
+// lists and tuples are supported, objects are not allowed.
+func unpickle(data []byte) (interface{}, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	var stack []interface{}
+	memo := map[int]interface{}{}
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	popMark := func() ([]interface{}, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, is := stack[i].(pickleMark); is {
+				items := append([]interface{}{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, errors.New("pickle mark not found")
+	}
+	top := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle stack underflow")
+		}
+		return stack[len(stack)-1], nil
+	}
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected end of pickle: %w", err)
+		}
+		switch op {
+		case opProto:
+			if _, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case opFrame:
+			if _, err = readN(r, 8); err != nil {
+				return nil, err
+			}
+		case opStop:
+			return pop()
+		case opMark:
+			stack = append(stack, pickleMark{})
+		case opPop:
+			if _, err = pop(); err != nil {
+				return nil, err
+			}
+		case opPopMark:
+			if _, err = popMark(); err != nil {
+				return nil, err
+			}
+		case opDup:
+			v, err := top()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case opNone:
+			stack = append(stack, nil)
+		case opNewTrue:
+			stack = append(stack, true)
+		case opNewFalse:
+			stack = append(stack, false)
+		case opInt, opLong:
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			line = strings.TrimSuffix(line, "L")
+			switch line {
+			case "00":
+				stack = append(stack, false)
+			case "01":
+				stack = append(stack, true)
+			default:
+				v, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				stack = append(stack, v)
+			}
+		case opBinInt:
+			b, err := readN(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(int32(binary.LittleEndian.Uint32(b))))
+		case opBinInt1:
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(b))
+		case opBinInt2:
+			b, err := readN(r, 2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(binary.LittleEndian.Uint16(b)))
+		case opLong1:
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := readN(r, int(n))
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeLong(b)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case opFloat:
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case opBinFloat:
+			b, err := readN(r, 8)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case opString:
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.Unquote(convertQuote(line))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case opUnicode:
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, line)
+		case opShortBinString, opShortBinBytes, opShortBinUni:
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := readN(r, int(n))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(b))
+		case opBinString, opBinBytes, opBinUnicode:
+			b, err := readN(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			n := binary.LittleEndian.Uint32(b)
+			if n > maxPickleSize {
+				return nil, errors.New("pickle string too long")
+			}
+			b, err = readN(r, int(n))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(b))
+		case opEmptyList:
+			stack = append(stack, &pickleList{})
+		case opList:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &pickleList{items: items})
+		case opAppend:
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			if err = appendToList(stack, v); err != nil {
+				return nil, err
+			}
+		case opAppends:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			if err = appendToList(stack, items...); err != nil {
+				return nil, err
+			}
+		case opEmptyTuple:
+			stack = append(stack, []interface{}{})
+		case opTuple:
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case opTuple1, opTuple2, opTuple3:
+			n := int(op-opTuple1) + 1
+			if len(stack) < n {
+				return nil, errors.New("pickle stack underflow")
+			}
+			items := append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], items)
+		case opPut:
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			id, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, err
+			}
+			if memo[id], err = top(); err != nil {
+				return nil, err
+			}
+		case opBinPut:
+			id, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if memo[int(id)], err = top(); err != nil {
+				return nil, err
+			}
+		case opLongBinPut:
+			b, err := readN(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			if memo[int(binary.LittleEndian.Uint32(b))], err = top(); err != nil {
+				return nil, err
+			}
+		case opMemoize:
+			if memo[len(memo)], err = top(); err != nil {
+				return nil, err
+			}
+		case opGet, opBinGet, opLongBinGet:
+			var id int
+			switch op {
+			case opGet:
+				line, err := readLine(r)
+				if err != nil {
+					return nil, err
+				}
+				if id, err = strconv.Atoi(line); err != nil {
+					return nil, err
+				}
+			case opBinGet:
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				id = int(b)
+			default:
+				b, err := readN(r, 4)
+				if err != nil {
+					return nil, err
+				}
+				id = int(binary.LittleEndian.Uint32(b))
+			}
+			v, exist := memo[id]
+			if !exist {
+				return nil, fmt.Errorf("pickle memo %d not found", id)
+			}
+			stack = append(stack, v)
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%x", op)
+		}
+	}
+}
+
+func appendToList(stack []interface{}, items ...interface{}) error {
+	if len(stack) == 0 {
+		return errors.New("pickle stack underflow")
+	}
+	list, is := stack[len(stack)-1].(*pickleList)
+	if !is {
+		return errors.New("pickle append to a non-list")
+	}
+	list.items = append(list.items, items...)
+	return nil
+}
+
+func readN(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return line[:len(line)-1], nil
+}
+
+// convertQuote converts the single quoted python string to a double quoted go string.
+func convertQuote(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		s = strings.ReplaceAll(s[1:len(s)-1], `"`, `\"`)
+		s = strings.ReplaceAll(s, `\'`, `'`)
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// decodeLong decodes the little-endian two's complement integer of LONG1.
+func decodeLong(b []byte) (int64, error) {
+	if len(b) > 8 {
+		return 0, errors.New("pickle long overflow")
+	}
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	if len(b) > 0 && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		v -= 1 << (8 * uint(len(b)))
+	}
+	return int64(v), nil
+}
+
+// pickleLines converts the pickled list of (path, (timestamp, value)) to plaintext lines.
+func pickleLines(data []byte) ([]string, error) {
+	v, err := unpickle(data)
+	if err != nil {
+		return nil, err
+	}
+	list, is := v.(*pickleList)
+	if !is {
+		return nil, errors.New("pickle data is not a list")
+	}
+	lines := make([]string, 0, len(list.items))
+	for _, item := range list.items {
+		tuple, is := item.([]interface{})
+		if !is || len(tuple) != 2 {
+			return nil, errors.New("pickle item is not a (path, (timestamp, value)) tuple")
+		}
+		path, is := tuple[0].(string)
+		if !is {
+			return nil, errors.New("pickle metric path is not a string")
+		}
+		point, is := tuple[1].([]interface{})
+		if !is || len(point) != 2 {
+			return nil, errors.New("pickle datapoint is not a (timestamp, value) tuple")
+		}
+		ts, err := pickleNumber(point[0])
+		if err != nil {
+			return nil, err
+		}
+		value, err := pickleNumber(point[1])
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, path+" "+value+" "+ts)
+	}
+	return lines, nil
+}
+
+func pickleNumber(v interface{}) (string, error) {
+	switch n := v.(type) {
+	case int64:
+		return strconv.FormatInt(n, 10), nil
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case string:
+		if _, err := strconv.ParseFloat(n, 64); err != nil {
+			return "", fmt.Errorf("invalid pickle number %q", n)
+		}
+		return n, nil
+	default:
+		return "", fmt.Errorf("invalid pickle number %v", v)
+	}
+}
@@ -0,0 +1,51 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickleLines(t *testing.T) {
+	expect := []string{"servers.web01.cpu.load 1.5 1700000000", "servers.web02.cpu.load 2 1700000001.5"}
+	for name, data := range map[string]string{
+		"protocol 0":     "(lp0\n(Vservers.web01.cpu.load\np1\n(I1700000000\nF1.5\ntp2\ntp3\na(Vservers.web02.cpu.load\np4\n(F1700000001.5\nI2\ntp5\ntp6\na.",
+		"protocol 0 str": "(lp0\n(S'servers.web01.cpu.load'\np1\n(L1700000000L\nS'1.5'\ntp2\ntp3\na(S'servers.web02.cpu.load'\np4\n(F1700000001.5\nI2\ntp5\ntp6\na.",
+		"protocol 2": "\x80\x02]q\x00(X\x16\x00\x00\x00servers.web01.cpu.loadq\x01J\x00\xf1SeG?\xf8\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03" +
+			"X\x16\x00\x00\x00servers.web02.cpu.loadq\x04GA\xd9T\xfc@`\x00\x00K\x02\x86q\x05\x86q\x06e.",
+		"protocol 4": "\x80\x04\x95X\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x16servers.web01.cpu.load\x94J\x00\xf1SeG?\xf8\x00\x00\x00\x00\x00\x00\x86\x94\x86\x94" +
+			"\x8c\x16servers.web02.cpu.load\x94GA\xd9T\xfc@`\x00\x00K\x02\x86\x94\x86\x94e.",
+	} {
+		lines, err := pickleLines([]byte(data))
+		require.NoError(t, err, name)
+		assert.Equal(t, expect, lines, name)
+	}
+
+	for name, data := range map[string]string{
+		"object":    "\x80\x02cos\nsystem\nq\x00.",
+		"truncated": "\x80\x02]q\x00(X\x16\x00\x00",
+		"not list":  "\x80\x02K\x01.",
+		"bad item":  "\x80\x02]q\x00K\x01a.",
+		"bad value": "\x80\x02](X\x01\x00\x00\x00aK\x01X\x01\x00\x00\x00x\x86\x86e.",
+	} {
+		_, err := pickleLines([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDecodeLong(t *testing.T) {
+	for b, expect := range map[string]int64{
+		"":                 0,
+		"\x01":             1,
+		"\xff":             -1,
+		"\x00\xf1Se":       1700000000,
+		"\x00\x01":         256,
+		"\x00\x80":         -32768,
+		"\xff\xff\xff\x7f": 2147483647,
+	} {
+		v, err := decodeLong([]byte(b))
+		require.NoError(t, err)
+		assert.Equal(t, expect, v)
+	}
+}
@@ -0,0 +1,414 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/batch"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
+	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/joinerror"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "graphite")
+
+const (
+	protocolPlaintext = "plaintext"
+	protocolPickle    = "pickle"
+)
+
+type metricWithClientIP struct {
+	clientIP net.IP
+	metrics  []telegraf.Metric
+}
+
+type Plugin struct {
+	conf       Config
+	parser     *graphite.GraphiteParser
+	wg         sync.WaitGroup
+	listeners  []*TCPListener
+	metricChan chan *metricWithClientIP
+	workerWG   sync.WaitGroup
+	spool      *spool.Spool
+}
+
+type TCPListener struct {
+	plugin    *Plugin
+	protocol  string
+	listener  *net.TCPListener
+	id        uint64
+	connList  map[uint64]*Connection
+	accept    chan bool
+	keepalive bool
+	cleanup   sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewTCPListener(plugin *Plugin, protocol string, listener *net.TCPListener, maxConnections int, keepalive bool) *TCPListener {
+	l := &TCPListener{plugin: plugin, protocol: protocol, listener: listener, keepalive: keepalive}
+	l.done = make(chan struct{})
+	l.connList = make(map[uint64]*Connection)
+	l.accept = make(chan bool, maxConnections)
+	for i := 0; i < maxConnections; i++ {
+		l.accept <- true
+	}
+	return l
+}
+
+func (l *TCPListener) start() error {
+	for {
+		conn, err := l.listener.AcceptTCP()
+		if err != nil {
+			select {
+			case <-l.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+		_, valid, poolExists := commonpool.VerifyClientIP(l.plugin.conf.User, l.plugin.conf.Password, clientIP)
+		if poolExists && !valid {
+			logger.WithField("user", l.plugin.conf.User).WithField("clientIP", clientIP.String()).Error("forbidden clientIP")
+			_ = conn.Close()
+			continue
+		}
+		if l.keepalive {
+			if err = conn.SetKeepAlive(true); err != nil {
+				_ = conn.Close()
+				return err
+			}
+		}
+		select {
+		case <-l.accept:
+			l.wg.Add(1)
+			id := atomic.AddUint64(&l.id, 1)
+			connection := &Connection{l: l, conn: conn, id: id, clientIP: clientIP}
+			l.remember(id, connection)
+			go connection.handle()
+		default:
+			l.refuser(conn)
+		}
+	}
+}
+
+func (l *TCPListener) forget(id uint64) {
+	l.cleanup.Lock()
+	defer l.cleanup.Unlock()
+	delete(l.connList, id)
+}
+
+func (l *TCPListener) remember(id uint64, conn *Connection) {
+	l.cleanup.Lock()
+	defer l.cleanup.Unlock()
+	l.connList[id] = conn
+}
+
+func (l *TCPListener) refuser(conn *net.TCPConn) {
+	_ = conn.Close()
+	logger.Infof("Refused TCP Connection from %s", conn.RemoteAddr())
+	logger.Warn("Maximum TCP Connections reached")
+}
+
+func (l *TCPListener) stop() error {
+	close(l.done)
+	err := l.listener.Close()
+	var tcpConnList []*Connection
+	l.cleanup.Lock()
+	for _, conn := range l.connList {
+		tcpConnList = append(tcpConnList, conn)
+	}
+	l.cleanup.Unlock()
+	for _, conn := range tcpConnList {
+		conn.close()
+	}
+	l.wg.Wait()
+	return err
+}
+
+type Connection struct {
+	l        *TCPListener
+	conn     *net.TCPConn
+	id       uint64
+	clientIP net.IP
+	once     sync.Once
+}
+
+func (c *Connection) handle() {
+	defer func() {
+		c.l.wg.Done()
+		c.close()
+		c.l.accept <- true
+		c.l.forget(c.id)
+	}()
+	var err error
+	if c.l.protocol == protocolPickle {
+		err = c.readPickle()
+	} else {
+		err = c.readPlaintext()
+	}
+	if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+		logger.WithError(err).Errorf("read %s connection from %s error", c.l.protocol, c.clientIP)
+	}
+}
+
+// readPlaintext reads the lines of "metric.path value timestamp", the lines read at once are sent in one batch.
+func (c *Connection) readPlaintext() error {
+	reader := bufio.NewReader(c.conn)
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			c.handleLines(lines)
+			return err
+		}
+		if reader.Buffered() == 0 || len(lines) >= c.l.plugin.conf.BatchSize {
+			c.handleLines(lines)
+			lines = lines[:0]
+		}
+	}
+}
+
+// readPickle reads the pickle frames, each frame is a 4-byte big-endian length followed by the pickled list.
+func (c *Connection) readPickle() error {
+	reader := bufio.NewReader(c.conn)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxPickleSize {
+			return fmt.Errorf("pickle frame size %d exceeds %d", size, maxPickleSize)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return err
+		}
+		lines, err := pickleLines(data)
+		if err != nil {
+			logger.WithError(err).Errorf("unpickle data from %s error", c.clientIP)
+			continue
+		}
+		c.handleLines(lines)
+	}
+}
+
+func (c *Connection) handleLines(lines []string) {
+	if len(lines) == 0 || monitor.AllPaused() {
+		return
+	}
+	metrics := make([]telegraf.Metric, 0, len(lines))
+	for _, line := range lines {
+		m, err := c.l.plugin.parser.ParseLine(strings.TrimSpace(line))
+		if err != nil {
+			logger.WithError(err).Errorf("parse graphite line error, line:%s", line)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) > 0 {
+		c.l.plugin.metricChan <- &metricWithClientIP{clientIP: c.clientIP, metrics: metrics}
+	}
+}
+
+func (c *Connection) close() {
+	c.once.Do(func() {
+		_ = c.conn.Close()
+	})
+}
+
+func (p *Plugin) Init(_ gin.IRouter) error {
+	p.conf.setValue()
+	if !p.conf.Enable {
+		logger.Info("graphite disabled")
+		return nil
+	}
+	var err error
+	p.parser, err = graphite.NewGraphiteParser(p.conf.Separator, p.conf.Templates, nil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) Start() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	var err error
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			return p.insertLines(r.ClientIP, r.DB, r.Data)
+		})
+	}
+	p.metricChan = make(chan *metricWithClientIP, 2*p.conf.Worker)
+	p.workerWG.Add(p.conf.Worker)
+	for i := 0; i < p.conf.Worker; i++ {
+		go p.work()
+	}
+	p.listeners = nil
+	err = p.tcp(p.conf.Port, protocolPlaintext)
+	if err != nil {
+		return err
+	}
+	if p.conf.PicklePort > 0 {
+		err = p.tcp(p.conf.PicklePort, protocolPickle)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) Stop() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	var errs []error
+	for _, listener := range p.listeners {
+		err := listener.stop()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.wg.Wait()
+	// flush the cached metrics after all connections are closed
+	close(p.metricChan)
+	p.workerWG.Wait()
+	if p.spool != nil {
+		err := p.spool.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return joinerror.Join(errs...)
+	}
+	return nil
+}
+
+func (p *Plugin) String() string {
+	return "graphite"
+}
+
+func (p *Plugin) Version() string {
+	return "v1"
+}
+
+func (p *Plugin) tcp(port int, protocol string) error {
+	address, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	listener, err := net.ListenTCP("tcp4", address)
+	if err != nil {
+		return err
+	}
+	logger.Infof("graphite %s TCP listening on %q", protocol, listener.Addr().String())
+	tcpListener := NewTCPListener(p, protocol, listener, p.conf.MaxTCPConnections, p.conf.TCPKeepAlive)
+	p.listeners = append(p.listeners, tcpListener)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if err := tcpListener.start(); err != nil {
+			logger.WithError(err).Errorf("graphite %s listener error", protocol)
+		}
+	}()
+	return nil
+}
+
+// work writes the metrics in batches, the batch is flushed when the client IP changes since the connection is
+// checked against the whitelist of the client IP.
+func (p *Plugin) work() {
+	defer p.workerWG.Done()
+	serializer := influx.NewSerializer()
+	var clientIP net.IP
+	batcher := batch.NewBatcher(p.String(), p.conf.BatchSize, p.conf.FlushInterval, func(metrics []telegraf.Metric) error {
+		return p.handleMetrics(serializer, clientIP, metrics)
+	})
+	ticker := batcher.NewTicker()
+	defer ticker.Stop()
+	for {
+		select {
+		case metric, ok := <-p.metricChan:
+			if !ok {
+				batcher.Flush()
+				return
+			}
+			if !clientIP.Equal(metric.clientIP) {
+				batcher.Flush()
+				clientIP = metric.clientIP
+			}
+			batcher.Add(metric.metrics...)
+		case <-ticker.C:
+			batcher.Flush()
+		}
+	}
+}
+
+func (p *Plugin) handleMetrics(serializer *influx.Serializer, clientIP net.IP, metrics []telegraf.Metric) error {
+	data, err := serializer.SerializeBatch(metrics)
+	if err != nil {
+		logger.WithError(err).Error("serialize graphite error")
+		return err
+	}
+	err = p.insertLines(clientIP, p.conf.DB, data)
+	p.spool.AppendFailed(&spool.Record{DB: p.conf.DB, ClientIP: clientIP, Data: data}, err)
+	return err
+}
+
+func (p *Plugin) insertLines(clientIP net.IP, db string, data []byte) error {
+	taosConn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, clientIP)
+	if err != nil {
+		logger.WithError(err).Error("connect server error")
+		return err
+	}
+	defer func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}()
+	isDebug := log.IsDebug()
+	start := log.GetLogNow(isDebug)
+	reqID := generator.GetReqID()
+	execLogger := logger.WithField(config.ReqIDKey, reqID)
+	execLogger.Debugf("insert lines, data:%s, db:%s, ttl:%d", data, db, p.conf.TTL)
+	err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, db, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
+	execLogger.Debugf("insert lines finish, cost:%s", log.GetLogDuration(isDebug, start))
+	if err != nil {
+		execLogger.WithError(err).Errorf("insert lines error, data:%s", data)
+		return err
+	}
+	return nil
+}
+
+func init() {
+	plugin.Register(&Plugin{})
+}
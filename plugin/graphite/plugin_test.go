@@ -0,0 +1,176 @@
+package graphite
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/influxdata/telegraf/plugins/parsers/graphite"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	"github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+func TestListener(t *testing.T) {
+	graphiteParser, err := graphite.NewGraphiteParser("_", []string{"servers.* .host.measurement*"}, nil)
+	require.NoError(t, err)
+	p := &Plugin{
+		conf:       Config{BatchSize: 10, MaxTCPConnections: 1},
+		parser:     graphiteParser,
+		metricChan: make(chan *metricWithClientIP, 10),
+	}
+	require.NoError(t, p.tcp(0, protocolPlaintext))
+	require.NoError(t, p.tcp(0, protocolPickle))
+	defer func() {
+		for _, l := range p.listeners {
+			assert.NoError(t, l.stop())
+		}
+		p.wg.Wait()
+	}()
+
+	c, err := net.Dial("tcp", p.listeners[0].listener.Addr().String())
+	require.NoError(t, err)
+	_, err = c.Write([]byte("servers.web01.cpu.load 1.5 1700000000\nbad line\nservers.web02.cpu.load;dc=sjc 2\n"))
+	require.NoError(t, err)
+	var names, hosts []string
+	for len(names) < 2 {
+		select {
+		case m := <-p.metricChan:
+			assert.True(t, m.clientIP.IsLoopback())
+			for _, metric := range m.metrics {
+				names = append(names, metric.Name())
+				hosts = append(hosts, metric.Tags()["host"])
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("plaintext metrics not received")
+		}
+	}
+	assert.Equal(t, []string{"cpu_load", "cpu_load"}, names)
+	assert.Equal(t, []string{"web01", "web02"}, hosts)
+	require.NoError(t, c.Close())
+
+	c, err = net.Dial("tcp", p.listeners[1].listener.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		_ = c.Close()
+	}()
+	data := []byte("\x80\x02](X\x16\x00\x00\x00servers.web03.mem.freeJ\x00\xf1SeK\x02\x86\x86e.")
+	frame := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	_, err = c.Write(append(frame, data...))
+	require.NoError(t, err)
+	select {
+	case m := <-p.metricChan:
+		require.Len(t, m.metrics, 1)
+		assert.Equal(t, "mem_free", m.metrics[0].Name())
+		assert.Equal(t, "web03", m.metrics[0].Tags()["host"])
+		assert.Equal(t, map[string]interface{}{"value": float64(2)}, m.metrics[0].Fields())
+		assert.Equal(t, int64(1700000000), m.metrics[0].Time().Unix())
+	case <-time.After(time.Second * 5):
+		t.Fatal("pickle metrics not received")
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	//nolint:staticcheck
+	rand.Seed(time.Now().UnixNano())
+	p := &Plugin{}
+	config.Init()
+	log.ConfigLog()
+	db.PrepareConnection()
+	viper.Set("graphite.enable", true)
+	viper.Set("graphite.ttl", 1000)
+	viper.Set("graphite.templates", []string{"servers.* .host.measurement*"})
+	conn, err := wrapper.TaosConnect("", "root", "taosdata", "", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() {
+		wrapper.TaosClose(conn)
+	}()
+	err = exec(conn, "create database if not exists graphite")
+	assert.NoError(t, err)
+	err = p.Init(nil)
+	assert.NoError(t, err)
+	err = p.Start()
+	assert.NoError(t, err)
+	defer func() {
+		err = p.Stop()
+		assert.NoError(t, err)
+	}()
+	number := rand.Int31()
+	c, err := net.Dial("tcp", "127.0.0.1:2003")
+	assert.NoError(t, err)
+	_, err = c.Write([]byte(fmt.Sprintf("servers.web01.cpu.load %d %d\n", number, time.Now().Unix())))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+	time.Sleep(time.Second)
+
+	defer func() {
+		err = exec(conn, "drop database if exists graphite")
+		assert.NoError(t, err)
+	}()
+	values, err := query(conn, "select last(`value`), last(`host`) from graphite.`cpu_load`")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(number), values[0][0])
+	assert.Equal(t, "web01", values[0][1])
+	values, err = query(conn, "select `ttl` from information_schema.ins_tables "+
+		" where db_name='graphite' and stable_name='cpu_load'")
+	assert.NoError(t, err)
+	if values[0][0].(int32) != 1000 {
+		t.Fatal("ttl miss")
+	}
+}
+
+func exec(conn unsafe.Pointer, sql string) error {
+	res := wrapper.TaosQuery(conn, sql)
+	defer wrapper.TaosFreeResult(res)
+	code := wrapper.TaosError(res)
+	if code != 0 {
+		errStr := wrapper.TaosErrorStr(res)
+		return errors.NewError(code, errStr)
+	}
+	return nil
+}
+
+func query(conn unsafe.Pointer, sql string) ([][]driver.Value, error) {
+	res := wrapper.TaosQuery(conn, sql)
+	defer wrapper.TaosFreeResult(res)
+	code := wrapper.TaosError(res)
+	if code != 0 {
+		errStr := wrapper.TaosErrorStr(res)
+		return nil, errors.NewError(code, errStr)
+	}
+	fileCount := wrapper.TaosNumFields(res)
+	rh, err := wrapper.ReadColumn(res, fileCount)
+	if err != nil {
+		return nil, err
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	var result [][]driver.Value
+	for {
+		columns, errCode, block := wrapper.TaosFetchRawBlock(res)
+		if errCode != 0 {
+			errStr := wrapper.TaosErrorStr(res)
+			return nil, errors.NewError(errCode, errStr)
+		}
+		if columns == 0 {
+			break
+		}
+		r := parser.ReadBlock(block, columns, rh.ColTypes, precision)
+		result = append(result, r...)
+	}
+	return result, nil
+}
@@ -1,20 +1,47 @@
 package influxdb
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	Enable bool
+	// BucketMapping maps the bucket of the v2 write api to a database, each item is `[org/]bucket=database`
+	BucketMapping []string
 }
 
 func (c *Config) setValue() {
 	c.Enable = viper.GetBool("influxdb.enable")
+	c.BucketMapping = viper.GetStringSlice("influxdb.bucketMapping")
+}
+
+// bucketMap parses the bucket mapping, the keys are `org/bucket` or `bucket`.
+func (c *Config) bucketMap() (map[string]string, error) {
+	result := make(map[string]string, len(c.BucketMapping))
+	for _, item := range c.BucketMapping {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		index := strings.LastIndexByte(item, '=')
+		if index <= 0 || index == len(item)-1 {
+			return nil, fmt.Errorf("invalid influxdb.bucketMapping %s, should be [org/]bucket=database", item)
+		}
+		result[item[:index]] = item[index+1:]
+	}
+	return result, nil
 }
 
 func init() {
 	_ = viper.BindEnv("influxdb.enable", "TAOS_ADAPTER_INFLUXDB_ENABLE")
 	pflag.Bool("influxdb.enable", true, `enable influxdb. Env "TAOS_ADAPTER_INFLUXDB_ENABLE"`)
 	viper.SetDefault("influxdb.enable", true)
+
+	_ = viper.BindEnv("influxdb.bucketMapping", "TAOS_ADAPTER_INFLUXDB_BUCKET_MAPPING")
+	pflag.StringSlice("influxdb.bucketMapping", nil, `influxdb v2 write bucket to database mapping, each item is [org/]bucket=database, unmapped bucket is written to the database of the same name without the retention policy. Env "TAOS_ADAPTER_INFLUXDB_BUCKET_MAPPING"`)
+	viper.SetDefault("influxdb.bucketMapping", []string{})
 }
@@ -0,0 +1,828 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token kinds of the influxql lexer
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenRegex
+	tokenSymbol
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "EOF"
+	case tokenString:
+		return "'" + t.value + "'"
+	case tokenQuotedIdent:
+		return `"` + t.value + `"`
+	case tokenRegex:
+		return "/" + t.value + "/"
+	default:
+		return t.value
+	}
+}
+
+// durationUnits are the units of influxql duration literals
+var durationUnits = []string{"ns", "ms", "u", "µ", "s", "m", "h", "d", "w"}
+
+// lexInfluxQL splits the query into tokens, a slash after =~ or !~ starts a regular expression.
+func lexInfluxQL(q string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(q) {
+		r, size := utf8.DecodeRuneInString(q[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '-' && strings.HasPrefix(q[i:], "--"):
+			// comment to the end of line
+			end := strings.IndexByte(q[i:], '\n')
+			if end < 0 {
+				i = len(q)
+			} else {
+				i += end + 1
+			}
+		case r == '\'' || r == '"':
+			value, n, err := lexQuoted(q[i:], byte(r))
+			if err != nil {
+				return nil, fmt.Errorf("%s at position %d", err, i)
+			}
+			kind := tokenString
+			if r == '"' {
+				kind = tokenQuotedIdent
+			}
+			tokens = append(tokens, token{kind: kind, value: value, pos: i})
+			i += n
+		case r == '/' && len(tokens) > 0 && tokens[len(tokens)-1].kind == tokenSymbol &&
+			(tokens[len(tokens)-1].value == "=~" || tokens[len(tokens)-1].value == "!~"):
+			value, n, err := lexRegex(q[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at position %d", err, i)
+			}
+			tokens = append(tokens, token{kind: tokenRegex, value: value, pos: i})
+			i += n
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+			start := i
+			for i < len(q) && (q[i] >= '0' && q[i] <= '9' || q[i] == '.') {
+				i++
+			}
+			kind := tokenNumber
+			for _, unit := range durationUnits {
+				if strings.HasPrefix(q[i:], unit) {
+					next := i + len(unit)
+					if next < len(q) && isIdentChar(rune(q[next])) {
+						continue
+					}
+					kind = tokenDuration
+					i = next
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: kind, value: q[start:i], pos: start})
+		case isIdentStart(r):
+			start := i
+			for i < len(q) {
+				r, size = utf8.DecodeRuneInString(q[i:])
+				if !isIdentChar(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: q[start:i], pos: start})
+		default:
+			symbol := ""
+			for _, s := range []string{"::", "=~", "!~", "!=", "<>", "<=", ">=", "=", "<", ">", "+", "-", "*", "/", "%", ",", "(", ")", ";", "."} {
+				if strings.HasPrefix(q[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, value: symbol, pos: i})
+			i += len(symbol)
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(q)})
+	return tokens, nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func lexQuoted(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(s[i])
+				}
+			}
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
+
+func lexRegex(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '/' {
+				i++
+				b.WriteByte('/')
+			} else {
+				b.WriteByte('\\')
+			}
+		case '/':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated regular expression")
+}
+
+// influxExpr is an expression of the influxql subset.
+type influxExpr interface{}
+
+type identExpr struct {
+	name string
+}
+
+type wildcardExpr struct{}
+
+type stringLiteral struct {
+	value string
+}
+
+type numberLiteral struct {
+	value string
+}
+
+type durationLiteral struct {
+	value string
+}
+
+type regexLiteral struct {
+	value string
+}
+
+type boolLiteral struct {
+	value bool
+}
+
+type callExpr struct {
+	name string
+	args []influxExpr
+}
+
+type binaryExpr struct {
+	op  string
+	lhs influxExpr
+	rhs influxExpr
+}
+
+type parenExpr struct {
+	expr influxExpr
+}
+
+type selectField struct {
+	expr  influxExpr
+	alias string
+}
+
+type selectStatement struct {
+	fields      []*selectField
+	measurement string
+	condition   influxExpr
+	// interval and intervalOffset are the duration literals of GROUP BY time()
+	interval       string
+	intervalOffset string
+	groupTags      []string
+	// fill is null, none, previous, linear or a number, empty means the default
+	fill       string
+	descending bool
+	limit      int
+	offset     int
+	sLimit     int
+	sOffset    int
+}
+
+type showDatabasesStatement struct{}
+
+type showMeasurementsStatement struct {
+	// op is =, != , =~ or !~ of WITH MEASUREMENT, empty means all
+	op     string
+	value  string
+	limit  int
+	offset int
+}
+
+type showTagKeysStatement struct {
+	measurement string
+}
+
+type showFieldKeysStatement struct {
+	measurement string
+}
+
+type showTagValuesStatement struct {
+	measurement string
+	// keyOp is =, !=, =~, !~ or IN
+	keyOp     string
+	keys      []string
+	condition influxExpr
+}
+
+type influxParser struct {
+	tokens []token
+	pos    int
+}
+
+// parseInfluxQL parses the statements separated by semicolons.
+func parseInfluxQL(q string) ([]interface{}, error) {
+	tokens, err := lexInfluxQL(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &influxParser{tokens: tokens}
+	var statements []interface{}
+	for {
+		for p.acceptSymbol(";") {
+		}
+		if p.peek().kind == tokenEOF {
+			break
+		}
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+		if !p.acceptSymbol(";") && p.peek().kind != tokenEOF {
+			return nil, p.unexpected("; or EOF")
+		}
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("empty query")
+	}
+	return statements, nil
+}
+
+func (p *influxParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *influxParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *influxParser) unexpected(expected string) error {
+	t := p.peek()
+	return fmt.Errorf("found %s, expected %s at position %d", t, expected, t.pos)
+}
+
+func (p *influxParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.value, keyword)
+}
+
+func (p *influxParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *influxParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.unexpected(keyword)
+	}
+	return nil
+}
+
+func (p *influxParser) acceptSymbol(symbol string) bool {
+	t := p.peek()
+	if t.kind == tokenSymbol && t.value == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *influxParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected(symbol)
+	}
+	return nil
+}
+
+// parseIdent parses a bare or double-quoted identifier and drops the ::tag or ::field cast.
+func (p *influxParser) parseIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdent && t.kind != tokenQuotedIdent {
+		return "", p.unexpected("identifier")
+	}
+	p.pos++
+	p.skipCast()
+	return t.value, nil
+}
+
+func (p *influxParser) skipCast() {
+	if p.acceptSymbol("::") {
+		p.next()
+	}
+}
+
+func (p *influxParser) parseInt() (int, error) {
+	t := p.peek()
+	if t.kind != tokenNumber {
+		return 0, p.unexpected("integer")
+	}
+	p.pos++
+	return strconv.Atoi(t.value)
+}
+
+func (p *influxParser) parseStatement() (interface{}, error) {
+	switch {
+	case p.acceptKeyword("SELECT"):
+		return p.parseSelect()
+	case p.acceptKeyword("SHOW"):
+		return p.parseShow()
+	default:
+		return nil, p.unexpected("SELECT or SHOW")
+	}
+}
+
+func (p *influxParser) parseShow() (interface{}, error) {
+	switch {
+	case p.acceptKeyword("DATABASES"):
+		return &showDatabasesStatement{}, nil
+	case p.acceptKeyword("MEASUREMENTS"):
+		return p.parseShowMeasurements()
+	case p.acceptKeyword("TAG"):
+		if p.acceptKeyword("KEYS") {
+			stmt := &showTagKeysStatement{}
+			var err error
+			stmt.measurement, err = p.parseOptionalFrom()
+			if err != nil {
+				return nil, err
+			}
+			return stmt, p.skipLimits()
+		}
+		if p.acceptKeyword("VALUES") {
+			return p.parseShowTagValues()
+		}
+		return nil, p.unexpected("KEYS or VALUES")
+	case p.acceptKeyword("FIELD"):
+		if err := p.expectKeyword("KEYS"); err != nil {
+			return nil, err
+		}
+		stmt := &showFieldKeysStatement{}
+		var err error
+		stmt.measurement, err = p.parseOptionalFrom()
+		if err != nil {
+			return nil, err
+		}
+		return stmt, p.skipLimits()
+	default:
+		return nil, p.unexpected("DATABASES, MEASUREMENTS, TAG KEYS, TAG VALUES or FIELD KEYS")
+	}
+}
+
+func (p *influxParser) parseShowMeasurements() (interface{}, error) {
+	stmt := &showMeasurementsStatement{}
+	if p.acceptKeyword("ON") {
+		if _, err := p.parseIdent(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("WITH") {
+		if err := p.expectKeyword("MEASUREMENT"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		if t.kind != tokenSymbol || (t.value != "=" && t.value != "!=" && t.value != "<>" && t.value != "=~" && t.value != "!~") {
+			p.pos--
+			return nil, p.unexpected("=, !=, =~ or !~")
+		}
+		stmt.op = t.value
+		if stmt.op == "<>" {
+			stmt.op = "!="
+		}
+		v := p.next()
+		switch {
+		case (stmt.op == "=~" || stmt.op == "!~") && v.kind == tokenRegex:
+		case (stmt.op == "=" || stmt.op == "!=") && (v.kind == tokenIdent || v.kind == tokenQuotedIdent):
+		default:
+			p.pos--
+			return nil, p.unexpected("measurement name or regular expression")
+		}
+		stmt.value = v.value
+	}
+	if p.acceptKeyword("LIMIT") {
+		var err error
+		if stmt.limit, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		var err error
+		if stmt.offset, err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *influxParser) parseShowTagValues() (interface{}, error) {
+	stmt := &showTagValuesStatement{}
+	var err error
+	if stmt.measurement, err = p.parseOptionalFrom(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("WITH"); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("KEY"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("IN") {
+		stmt.keyOp = "IN"
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		for {
+			key, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.keys = append(stmt.keys, key)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		t := p.next()
+		if t.kind != tokenSymbol || (t.value != "=" && t.value != "!=" && t.value != "<>" && t.value != "=~" && t.value != "!~") {
+			p.pos--
+			return nil, p.unexpected("=, !=, =~, !~ or IN")
+		}
+		stmt.keyOp = t.value
+		if stmt.keyOp == "<>" {
+			stmt.keyOp = "!="
+		}
+		if stmt.keyOp == "=~" || stmt.keyOp == "!~" {
+			v := p.next()
+			if v.kind != tokenRegex {
+				p.pos--
+				return nil, p.unexpected("regular expression")
+			}
+			stmt.keys = []string{v.value}
+		} else {
+			key, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.keys = []string{key}
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.condition, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, p.skipLimits()
+}
+
+// skipLimits ignores LIMIT and OFFSET of the SHOW statements that return all the keys.
+func (p *influxParser) skipLimits() error {
+	for _, keyword := range []string{"LIMIT", "OFFSET"} {
+		if p.acceptKeyword(keyword) {
+			if _, err := p.parseInt(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *influxParser) parseOptionalFrom() (string, error) {
+	if p.acceptKeyword("ON") {
+		if _, err := p.parseIdent(); err != nil {
+			return "", err
+		}
+	}
+	if !p.acceptKeyword("FROM") {
+		return "", nil
+	}
+	return p.parseMeasurement()
+}
+
+// parseMeasurement parses [db.][rp.]measurement and returns the measurement.
+func (p *influxParser) parseMeasurement() (string, error) {
+	if p.peek().kind == tokenRegex || p.peek().kind == tokenSymbol && p.peek().value == "/" {
+		return "", errors.New("regular expression measurement is not supported")
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", err
+	}
+	for p.acceptSymbol(".") {
+		// db..measurement uses the default retention policy
+		p.acceptSymbol(".")
+		name, err = p.parseIdent()
+		if err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+func (p *influxParser) parseSelect() (interface{}, error) {
+	stmt := &selectStatement{}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		field := &selectField{expr: expr}
+		if p.acceptKeyword("AS") {
+			if field.alias, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		}
+		stmt.fields = append(stmt.fields, field)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.measurement, err = p.parseMeasurement(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.condition, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if err = p.parseDimensions(stmt); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("FILL") {
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		switch {
+		case t.kind == tokenIdent && (strings.EqualFold(t.value, "null") || strings.EqualFold(t.value, "none") ||
+			strings.EqualFold(t.value, "previous") || strings.EqualFold(t.value, "linear")):
+			stmt.fill = strings.ToLower(t.value)
+		case t.kind == tokenNumber:
+			stmt.fill = t.value
+		case t.kind == tokenSymbol && t.value == "-" && p.peek().kind == tokenNumber:
+			stmt.fill = "-" + p.next().value
+		default:
+			p.pos--
+			return nil, p.unexpected("null, none, previous, linear or number")
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("time"); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("DESC") {
+			stmt.descending = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+	}
+	for _, item := range []struct {
+		keyword string
+		value   *int
+	}{{"LIMIT", &stmt.limit}, {"OFFSET", &stmt.offset}, {"SLIMIT", &stmt.sLimit}, {"SOFFSET", &stmt.sOffset}} {
+		if p.acceptKeyword(item.keyword) {
+			if *item.value, err = p.parseInt(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.isKeyword("tz") {
+		return nil, errors.New("tz() is not supported")
+	}
+	return stmt, nil
+}
+
+func (p *influxParser) parseDimensions(stmt *selectStatement) error {
+	for {
+		if p.isKeyword("time") && p.tokens[p.pos+1].kind == tokenSymbol && p.tokens[p.pos+1].value == "(" {
+			p.pos += 2
+			t := p.next()
+			if t.kind != tokenDuration {
+				p.pos--
+				return p.unexpected("duration")
+			}
+			stmt.interval = t.value
+			if p.acceptSymbol(",") {
+				t = p.next()
+				if t.kind != tokenDuration {
+					p.pos--
+					return p.unexpected("duration")
+				}
+				stmt.intervalOffset = t.value
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return err
+			}
+		} else if p.acceptSymbol("*") {
+			return errors.New("GROUP BY * is not supported")
+		} else {
+			tag, err := p.parseIdent()
+			if err != nil {
+				return err
+			}
+			stmt.groupTags = append(stmt.groupTags, tag)
+		}
+		if !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+var binaryPrecedence = map[string]int{
+	"OR":  1,
+	"AND": 2,
+	"=":   3, "!=": 3, "<>": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "=~": 3, "!~": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+// binaryOperator returns the binary operator of the next token.
+func (p *influxParser) binaryOperator() (string, int) {
+	t := p.peek()
+	var op string
+	switch t.kind {
+	case tokenSymbol:
+		op = t.value
+	case tokenIdent:
+		op = strings.ToUpper(t.value)
+	default:
+		return "", 0
+	}
+	precedence, ok := binaryPrecedence[op]
+	if !ok {
+		return "", 0
+	}
+	return op, precedence
+}
+
+func (p *influxParser) parseExpr() (influxExpr, error) {
+	return p.parseBinary(1)
+}
+
+func (p *influxParser) parseBinary(minPrecedence int) (influxExpr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, precedence := p.binaryOperator()
+		if precedence == 0 || precedence < minPrecedence {
+			return lhs, nil
+		}
+		p.pos++
+		rhs, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &binaryExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *influxParser) parseUnary() (influxExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenSymbol:
+		switch t.value {
+		case "(":
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return &parenExpr{expr: expr}, nil
+		case "*":
+			return &wildcardExpr{}, nil
+		case "-":
+			n := p.peek()
+			if n.kind == tokenNumber || n.kind == tokenDuration {
+				p.pos++
+				if n.kind == tokenNumber {
+					return &numberLiteral{value: "-" + n.value}, nil
+				}
+				return &durationLiteral{value: "-" + n.value}, nil
+			}
+		}
+	case tokenString:
+		return &stringLiteral{value: t.value}, nil
+	case tokenNumber:
+		return &numberLiteral{value: t.value}, nil
+	case tokenDuration:
+		return &durationLiteral{value: t.value}, nil
+	case tokenRegex:
+		return &regexLiteral{value: t.value}, nil
+	case tokenQuotedIdent:
+		p.skipCast()
+		return &identExpr{name: t.value}, nil
+	case tokenIdent:
+		if p.acceptSymbol("(") {
+			call := &callExpr{name: strings.ToLower(t.value)}
+			if !p.acceptSymbol(")") {
+				for {
+					arg, err := p.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					call.args = append(call.args, arg)
+					if !p.acceptSymbol(",") {
+						break
+					}
+				}
+				if err := p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+			}
+			return call, nil
+		}
+		switch strings.ToLower(t.value) {
+		case "true":
+			return &boolLiteral{value: true}, nil
+		case "false":
+			return &boolLiteral{value: false}, nil
+		}
+		p.skipCast()
+		return &identExpr{name: t.value}, nil
+	}
+	p.pos--
+	return nil, p.unexpected("expression")
+}
@@ -0,0 +1,153 @@
+package influxdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInfluxQL(t *testing.T) {
+	statements, err := parseInfluxQL(`SELECT mean("value") AS "avg", max(value) FROM "telegraf"."autogen"."cpu" WHERE ("host" =~ /^a$/) AND time >= now() - 1h GROUP BY time(1m, 10s), "host" fill(none) ORDER BY time DESC LIMIT 10 SLIMIT 2; SHOW DATABASES`)
+	require.NoError(t, err)
+	require.Len(t, statements, 2)
+	stmt := statements[0].(*selectStatement)
+	assert.Equal(t, "cpu", stmt.measurement)
+	require.Len(t, stmt.fields, 2)
+	assert.Equal(t, "avg", stmt.fields[0].alias)
+	assert.Equal(t, &callExpr{name: "mean", args: []influxExpr{&identExpr{name: "value"}}}, stmt.fields[0].expr)
+	assert.Equal(t, "1m", stmt.interval)
+	assert.Equal(t, "10s", stmt.intervalOffset)
+	assert.Equal(t, []string{"host"}, stmt.groupTags)
+	assert.Equal(t, "none", stmt.fill)
+	assert.True(t, stmt.descending)
+	assert.Equal(t, 10, stmt.limit)
+	assert.Equal(t, 2, stmt.sLimit)
+	condition := stmt.condition.(*binaryExpr)
+	assert.Equal(t, "AND", condition.op)
+	assert.Equal(t, &parenExpr{expr: &binaryExpr{op: "=~", lhs: &identExpr{name: "host"}, rhs: &regexLiteral{value: "^a$"}}}, condition.lhs)
+	assert.IsType(t, &showDatabasesStatement{}, statements[1])
+
+	statements, err = parseInfluxQL(`SHOW MEASUREMENTS WITH MEASUREMENT =~ /cpu.*/ LIMIT 100`)
+	require.NoError(t, err)
+	assert.Equal(t, &showMeasurementsStatement{op: "=~", value: "cpu.*", limit: 100}, statements[0])
+
+	statements, err = parseInfluxQL(`SHOW TAG VALUES FROM "cpu" WITH KEY IN ("host", "region") WHERE "region" = 'us'`)
+	require.NoError(t, err)
+	tagValues := statements[0].(*showTagValuesStatement)
+	assert.Equal(t, "cpu", tagValues.measurement)
+	assert.Equal(t, "IN", tagValues.keyOp)
+	assert.Equal(t, []string{"host", "region"}, tagValues.keys)
+	assert.NotNil(t, tagValues.condition)
+
+	statements, err = parseInfluxQL(`SHOW FIELD KEYS FROM cpu; SHOW TAG KEYS`)
+	require.NoError(t, err)
+	assert.Equal(t, &showFieldKeysStatement{measurement: "cpu"}, statements[0])
+	assert.Equal(t, &showTagKeysStatement{}, statements[1])
+
+	for _, q := range []string{
+		`SELECT`,
+		`SELECT value FROM`,
+		`SELECT mean(value) FROM cpu GROUP BY *`,
+		`SELECT value FROM cpu tz('Asia/Shanghai')`,
+		`SELECT value FROM cpu fill(abc)`,
+		`DROP DATABASE test`,
+		`SELECT 'abc FROM cpu`,
+	} {
+		_, err = parseInfluxQL(q)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestTranslateSelect(t *testing.T) {
+	now := time.Date(2022, 1, 1, 1, 0, 0, 0, time.UTC)
+	tests := []struct {
+		q       string
+		sql     string
+		columns []string
+		hasTime bool
+		tags    []string
+	}{
+		{
+			q:       `SELECT mean("value") FROM "cpu" WHERE ("host" = 'a') AND time >= now() - 1h and time <= now() GROUP BY time(1m), "host" fill(null)`,
+			sql:     "select _wstart,avg(`value`),`host` from `cpu` where (`host` = 'a') and _ts >= '2022-01-01T00:00:00Z' and _ts <= '2022-01-01T01:00:00Z' partition by `host` interval(1m) fill(null) order by _wstart",
+			columns: []string{"mean"},
+			hasTime: true,
+			tags:    []string{"host"},
+		},
+		{
+			q:       `SELECT "value", value * 2 AS "double" FROM cpu WHERE host !~ /b/ AND region = '' ORDER BY time DESC LIMIT 5 OFFSET 1`,
+			sql:     "select _ts,`value`,`value` * 2 from `cpu` where `host` nmatch 'b' and (`region` = '' or `region` is null) order by _ts desc limit 5 offset 1",
+			columns: []string{"value", "double"},
+			hasTime: true,
+		},
+		{
+			q:       `SELECT value FROM cpu WHERE time > now() - 1h`,
+			sql:     "select _ts,`value` from `cpu` where _ts > '2022-01-01T00:00:00Z' order by _ts",
+			columns: []string{"value"},
+			hasTime: true,
+		},
+		{
+			q:       `SELECT count(value), median(value), percentile(value, 95), max(value), max(value) FROM cpu WHERE time > '2022-01-01T00:00:00Z'`,
+			sql:     "select count(`value`),apercentile(`value`, 50),apercentile(`value`, 95),max(`value`),max(`value`) from `cpu` where _ts > '2022-01-01T00:00:00Z'",
+			columns: []string{"count", "median", "percentile", "max", "max_1"},
+		},
+		{
+			q:       `SELECT last(value) FROM cpu WHERE time >= 1640995200000000000 GROUP BY time(500ms) fill(previous) SLIMIT 1`,
+			sql:     "select _wstart,last(`value`) from `cpu` where _ts >= '2022-01-01T00:00:00Z' interval(500a) fill(prev) order by _wstart slimit 1",
+			columns: []string{"last"},
+			hasTime: true,
+		},
+		{
+			q:       `SELECT sum(a), sum(b) FROM m WHERE name = 'it\'s' GROUP BY time(1h) fill(0)`,
+			sql:     "select _wstart,sum(`a`),sum(`b`) from `m` where `name` = 'it\\'s' interval(1h) fill(value,0,0) order by _wstart",
+			columns: []string{"sum", "sum_1"},
+			hasTime: true,
+		},
+		{
+			q:       `SELECT * FROM cpu GROUP BY host`,
+			sql:     "select *,`host` from `cpu` partition by `host` order by _ts",
+			hasTime: true,
+			tags:    []string{"host"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			statements, err := parseInfluxQL(tt.q)
+			require.NoError(t, err)
+			plan, err := translateSelect(statements[0].(*selectStatement), now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.sql, plan.sql)
+			assert.Equal(t, tt.columns, plan.columns)
+			assert.Equal(t, tt.hasTime, plan.hasTime)
+			assert.Equal(t, tt.tags, plan.tags)
+		})
+	}
+
+	for _, q := range []string{
+		`SELECT mean(value), value FROM cpu`,
+		`SELECT value FROM cpu GROUP BY time(1m)`,
+		`SELECT derivative(value) FROM cpu`,
+		`SELECT *, value FROM cpu`,
+		`SELECT value FROM cpu WHERE time =~ /1/`,
+		`SELECT value FROM cpu WHERE 'a' = host`,
+		`SELECT value FROM cpu WHERE time > 'yesterday'`,
+	} {
+		statements, err := parseInfluxQL(q)
+		require.NoError(t, err, q)
+		_, err = translateSelect(statements[0].(*selectStatement), now)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestTranslateShowMeasurements(t *testing.T) {
+	assert.Equal(t,
+		"select stable_name from information_schema.ins_stables where db_name = 'test' order by stable_name",
+		translateShowMeasurements("test", &showMeasurementsStatement{}),
+	)
+	assert.Equal(t,
+		"select stable_name from information_schema.ins_stables where db_name = 'test' and stable_name match '^cpu' order by stable_name limit 10 offset 5",
+		translateShowMeasurements("test", &showMeasurementsStatement{op: "=~", value: "^cpu", limit: 10, offset: 5}),
+	)
+}
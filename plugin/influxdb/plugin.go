@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"github.com/taosdata/taosadapter/v3/config"
 	"github.com/taosdata/taosadapter/v3/db/commonpool"
 	"github.com/taosdata/taosadapter/v3/db/syncinterface"
@@ -27,7 +28,8 @@ import (
 var logger = log.GetLogger("PLG").WithField("mod", "influxdb")
 
 type Influxdb struct {
-	conf Config
+	conf    Config
+	buckets map[string]string
 }
 
 func (p *Influxdb) String() string {
@@ -44,6 +46,11 @@ func (p *Influxdb) Init(r gin.IRouter) error {
 		logger.Info("influxdb disabled")
 		return nil
 	}
+	buckets, err := p.conf.bucketMap()
+	if err != nil {
+		return err
+	}
+	p.buckets = buckets
 	r.Use(func(c *gin.Context) {
 		if monitor.AllPaused() {
 			c.Header("Retry-After", "120")
@@ -52,6 +59,16 @@ func (p *Influxdb) Init(r gin.IRouter) error {
 		}
 	})
 	r.POST("write", getAuth, p.write)
+	r.POST("api/v2/write", getV2Auth, p.writeV2)
+	queryPaused := func(c *gin.Context) {
+		if monitor.QueryPaused() {
+			c.Header("Retry-After", "120")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, &influxResponse{Error: "query memory exceeds threshold"})
+			return
+		}
+	}
+	r.GET("query", queryPaused, getAuth, p.query)
+	r.POST("query", queryPaused, getAuth, p.query)
 	return nil
 }
 
@@ -161,27 +178,34 @@ func (p *Influxdb) write(c *gin.Context) {
 		return
 	}
 	logger.Debugf("request data:%s", data)
+	code, err := p.insert(c, logger, isDebug, user, password, data, db, precision, ttl, reqID, tableNameKey)
+	if err != nil {
+		switch code {
+		case http.StatusUnauthorized:
+			p.commonResponse(c, code, &message{Code: "forbidden", Message: err.Error()})
+		default:
+			p.commonResponse(c, code, &message{Code: "internal error", Message: err.Error()})
+		}
+		return
+	}
+	logger.Debugf("insert line success")
+	c.Status(http.StatusNoContent)
+}
+
+// insert writes the line protocol data with the connection of the user, it returns the http status code on error.
+func (p *Influxdb) insert(c *gin.Context, logger *logrus.Entry, isDebug bool, user, password string, data []byte, db, precision string, ttl int, reqID uint64, tableNameKey string) (int, error) {
 	s := log.GetLogNow(isDebug)
 	taosConn, err := commonpool.GetConnection(user, password, iptool.GetRealIP(c.Request))
 	logger.Debugf("get connection finish, cost:%s", log.GetLogDuration(isDebug, s))
 	if err != nil {
 		logger.Errorf("connect server error, err:%s", err)
 		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
-			p.commonResponse(c, http.StatusUnauthorized, &message{
-				Code:    "forbidden",
-				Message: err.Error(),
-			})
-			return
+			return http.StatusUnauthorized, err
 		}
 		if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
-			p.commonResponse(c, http.StatusServiceUnavailable, &message{
-				Code:    "internal error",
-				Message: err.Error(),
-			})
-			return
+			return http.StatusServiceUnavailable, err
 		}
-		p.commonResponse(c, http.StatusInternalServerError, &message{Code: "internal error", Message: err.Error()})
-		return
+		return http.StatusInternalServerError, err
 	}
 	defer func() {
 		logger.Tracef("put connection")
@@ -208,11 +232,9 @@ func (p *Influxdb) write(c *gin.Context) {
 		if is {
 			web.SetTaosErrorCode(c, int(taosError.Code))
 		}
-		p.commonResponse(c, http.StatusInternalServerError, &message{Code: "internal error", Message: err.Error()})
-		return
+		return http.StatusInternalServerError, err
 	}
-	logger.Debugf("insert line success")
-	c.Status(http.StatusNoContent)
+	return 0, nil
 }
 
 type badRequest struct {
@@ -2,10 +2,12 @@ package influxdb
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -101,6 +103,63 @@ func TestInfluxdb(t *testing.T) {
 	if values[0][0].(int32) != 1000 {
 		t.Fatal("ttl miss")
 	}
+
+	// v2 write api
+	w = httptest.NewRecorder()
+	reader = strings.NewReader(fmt.Sprintf("measurement_v2,host=host1 field1=%di %d", number, time.Now().UnixNano()/1e6))
+	req, _ = http.NewRequest("POST", "/api/v2/write?org=test&bucket=test_plugin_influxdb/autogen&precision=ms", reader)
+	req.Header.Set("Authorization", "Token root:taosdata")
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 204, w.Code)
+	values, err = query(conn, "select field1 from test_plugin_influxdb.measurement_v2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(number), values[0][0])
+
+	w = httptest.NewRecorder()
+	reader = strings.NewReader("measurement_v2,host=host1 field1=a1")
+	req, _ = http.NewRequest("POST", "/api/v2/write?org=test&bucket=test_plugin_influxdb", reader)
+	req.Header.Set("Authorization", "Token root:taosdata")
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"invalid"`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v2/write?org=test&bucket=test_plugin_influxdb&precision=h", strings.NewReader(""))
+	req.Header.Set("Authorization", "Token root:taosdata")
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v2/write?org=test&bucket=test_plugin_influxdb", strings.NewReader(""))
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+
+	// influxql query
+	w = httptest.NewRecorder()
+	q := url.Values{"q": {"SELECT field1 FROM measurement_v2; SHOW TAG KEYS FROM measurement_v2"}, "db": {"test_plugin_influxdb"}, "epoch": {"ms"}}
+	req, _ = http.NewRequest("GET", "/query?u=root&p=taosdata&"+q.Encode(), nil)
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var resp influxResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results, 2)
+	assert.Equal(t, "measurement_v2", resp.Results[0].Series[0].Name)
+	assert.Equal(t, []string{"time", "field1"}, resp.Results[0].Series[0].Columns)
+	assert.Equal(t, float64(number), resp.Results[0].Series[0].Values[0][1])
+	assert.Equal(t, []interface{}{"host"}, resp.Results[1].Series[0].Values[0])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/query?u=root&p=taosdata&db=test_plugin_influxdb&q=SELECT", nil)
+	req.RemoteAddr = "127.0.0.1:33333"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
 }
 
 func exec(conn unsafe.Pointer, sql string) error {
@@ -0,0 +1,986 @@
+package influxdb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"github.com/taosdata/taosadapter/v3/tools/web"
+)
+
+// timeColumn is the timestamp column of the supertables created by schemaless line protocol
+const timeColumn = "_ts"
+
+// influxQueryExecutor executes the translated sql, timestamp values are time.Time. Tests use a stub.
+type influxQueryExecutor interface {
+	Query(sql string) (columns []string, rows [][]driver.Value, err error)
+}
+
+type influxSeries struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+type influxResult struct {
+	StatementID int             `json:"statement_id"`
+	Series      []*influxSeries `json:"series,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+type influxResponse struct {
+	Results []*influxResult `json:"results,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// aggregateFunctions maps the influxql aggregate functions to TDengine functions
+var aggregateFunctions = map[string]string{
+	"mean":   "avg",
+	"count":  "count",
+	"sum":    "sum",
+	"min":    "min",
+	"max":    "max",
+	"first":  "first",
+	"last":   "last",
+	"spread": "spread",
+	"stddev": "stddev",
+}
+
+// tdDurationUnits maps the influxql duration units to TDengine duration units
+var tdDurationUnits = map[string]string{
+	"ns": "b",
+	"u":  "u",
+	"µ":  "u",
+	"ms": "a",
+	"s":  "s",
+	"m":  "m",
+	"h":  "h",
+	"d":  "d",
+	"w":  "w",
+}
+
+var influxUnitDurations = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"µ":  time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// splitDuration returns the number and the unit of a duration literal.
+func splitDuration(s string) (int64, string, error) {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && !(i == 0 && s[i] == '-') {
+			n, err := strconv.ParseInt(s[:i], 10, 64)
+			if err != nil {
+				return 0, "", fmt.Errorf("invalid duration %s", s)
+			}
+			if _, ok := influxUnitDurations[s[i:]]; !ok {
+				return 0, "", fmt.Errorf("invalid duration %s", s)
+			}
+			return n, s[i:], nil
+		}
+	}
+	return 0, "", fmt.Errorf("invalid duration %s", s)
+}
+
+func parseInfluxDuration(s string) (time.Duration, error) {
+	n, unit, err := splitDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n) * influxUnitDurations[unit], nil
+}
+
+// tdDuration converts a duration literal to TDengine, for example 10ms to 10a.
+func tdDuration(s string) (string, error) {
+	n, unit, err := splitDuration(s)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n, 10) + tdDurationUnits[unit], nil
+}
+
+func formatTime(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339Nano) + "'"
+}
+
+// selectPlan is the sql of a select statement and how the rows are split into series.
+type selectPlan struct {
+	sql  string
+	name string
+	// columns are the output columns without time, nil means the columns of the result
+	columns []string
+	// hasTime reports whether the first column of the result is the time
+	hasTime bool
+	// startTime is the time of the rows of an aggregation without GROUP BY time()
+	startTime time.Time
+	// tags are the GROUP BY tags, they are the last columns of the result
+	tags []string
+}
+
+// conditionTranslator translates the WHERE clause, time literals are relative to now.
+type conditionTranslator struct {
+	now   time.Time
+	start time.Time
+}
+
+func (t *conditionTranslator) timeValue(expr influxExpr) (time.Time, error) {
+	switch e := expr.(type) {
+	case *parenExpr:
+		return t.timeValue(e.expr)
+	case *callExpr:
+		if e.name == "now" && len(e.args) == 0 {
+			return t.now, nil
+		}
+	case *binaryExpr:
+		if e.op == "+" || e.op == "-" {
+			base, err := t.timeValue(e.lhs)
+			if err != nil {
+				return time.Time{}, err
+			}
+			d, ok := e.rhs.(*durationLiteral)
+			if !ok {
+				return time.Time{}, errors.New("invalid time expression")
+			}
+			duration, err := parseInfluxDuration(d.value)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if e.op == "-" {
+				duration = -duration
+			}
+			return base.Add(duration), nil
+		}
+	case *stringLiteral:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+			if ts, err := time.Parse(layout, e.value); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid time %s", e.value)
+	case *numberLiteral:
+		ns, err := strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %s", e.value)
+		}
+		return time.Unix(0, ns), nil
+	case *durationLiteral:
+		n, unit, err := splitDuration(e.value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, n*int64(influxUnitDurations[unit])), nil
+	}
+	return time.Time{}, errors.New("invalid time expression")
+}
+
+// translate returns the sql condition, top is true for the comparisons joined by AND at the top level.
+func (t *conditionTranslator) translate(expr influxExpr, top bool) (string, error) {
+	switch e := expr.(type) {
+	case *parenExpr:
+		sql, err := t.translate(e.expr, top)
+		if err != nil {
+			return "", err
+		}
+		return "(" + sql + ")", nil
+	case *binaryExpr:
+		switch e.op {
+		case "AND", "OR":
+			top = top && e.op == "AND"
+			lhs, err := t.translate(e.lhs, top)
+			if err != nil {
+				return "", err
+			}
+			rhs, err := t.translate(e.rhs, top)
+			if err != nil {
+				return "", err
+			}
+			return lhs + " " + strings.ToLower(e.op) + " " + rhs, nil
+		case "=", "!=", "<>", "<", "<=", ">", ">=", "=~", "!~":
+			return t.comparison(e, top)
+		}
+	}
+	return "", errors.New("unsupported condition")
+}
+
+func (t *conditionTranslator) comparison(e *binaryExpr, top bool) (string, error) {
+	ident, ok := e.lhs.(*identExpr)
+	if !ok {
+		return "", errors.New("the left side of a condition must be a tag, field or time")
+	}
+	op := e.op
+	if op == "<>" {
+		op = "!="
+	}
+	if strings.EqualFold(ident.name, "time") {
+		if op == "=~" || op == "!~" {
+			return "", errors.New("invalid time condition")
+		}
+		ts, err := t.timeValue(e.rhs)
+		if err != nil {
+			return "", err
+		}
+		if top && (op == ">" || op == ">=") && ts.After(t.start) {
+			t.start = ts
+		}
+		return timeColumn + " " + op + " " + formatTime(ts), nil
+	}
+	column, err := tools.QuoteIdentifier(ident.name)
+	if err != nil {
+		return "", err
+	}
+	switch v := e.rhs.(type) {
+	case *regexLiteral:
+		switch op {
+		case "=~":
+			return column + " match '" + tools.EscapeString(v.value) + "'", nil
+		case "!~":
+			return column + " nmatch '" + tools.EscapeString(v.value) + "'", nil
+		}
+	case *stringLiteral:
+		if op == "=~" || op == "!~" {
+			break
+		}
+		if op == "=" && len(v.value) == 0 {
+			// a tag that is not set is null
+			return "(" + column + " = '' or " + column + " is null)", nil
+		}
+		return column + " " + op + " '" + tools.EscapeString(v.value) + "'", nil
+	case *numberLiteral:
+		if op == "=~" || op == "!~" {
+			break
+		}
+		return column + " " + op + " " + v.value, nil
+	case *boolLiteral:
+		if op == "=" || op == "!=" {
+			return column + " " + op + " " + strconv.FormatBool(v.value), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported condition on %s", ident.name)
+}
+
+// fieldTranslator translates the select fields.
+type fieldTranslator struct {
+	aggregate bool
+	raw       bool
+}
+
+// translate returns the sql and the influxdb column name of a select expression.
+func (t *fieldTranslator) translate(expr influxExpr) (string, string, error) {
+	switch e := expr.(type) {
+	case *identExpr:
+		t.raw = true
+		column, err := tools.QuoteIdentifier(e.name)
+		return column, e.name, err
+	case *numberLiteral:
+		return e.value, "", nil
+	case *parenExpr:
+		sql, name, err := t.translate(e.expr)
+		return "(" + sql + ")", name, err
+	case *binaryExpr:
+		switch e.op {
+		case "+", "-", "*", "/", "%":
+			lhs, lhsName, err := t.translate(e.lhs)
+			if err != nil {
+				return "", "", err
+			}
+			rhs, rhsName, err := t.translate(e.rhs)
+			if err != nil {
+				return "", "", err
+			}
+			name := lhsName
+			if len(name) == 0 {
+				name = rhsName
+			}
+			return lhs + " " + e.op + " " + rhs, name, nil
+		}
+	case *callExpr:
+		return t.call(e)
+	}
+	return "", "", errors.New("unsupported select expression")
+}
+
+func (t *fieldTranslator) call(e *callExpr) (string, string, error) {
+	t.aggregate = true
+	if len(e.args) == 0 {
+		return "", "", fmt.Errorf("invalid number of arguments for %s", e.name)
+	}
+	var column string
+	switch arg := e.args[0].(type) {
+	case *identExpr:
+		var err error
+		if column, err = tools.QuoteIdentifier(arg.name); err != nil {
+			return "", "", err
+		}
+	case *wildcardExpr:
+		if e.name != "count" {
+			return "", "", fmt.Errorf("unsupported wildcard in %s", e.name)
+		}
+		column = "*"
+	default:
+		return "", "", fmt.Errorf("expected field argument in %s()", e.name)
+	}
+	switch e.name {
+	case "median":
+		if len(e.args) != 1 {
+			return "", "", fmt.Errorf("invalid number of arguments for %s", e.name)
+		}
+		return "apercentile(" + column + ", 50)", e.name, nil
+	case "percentile":
+		if len(e.args) != 2 {
+			return "", "", fmt.Errorf("invalid number of arguments for %s", e.name)
+		}
+		n, ok := e.args[1].(*numberLiteral)
+		if !ok {
+			return "", "", errors.New("expected number argument in percentile()")
+		}
+		return "apercentile(" + column + ", " + n.value + ")", e.name, nil
+	}
+	function, ok := aggregateFunctions[e.name]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported function %s()", e.name)
+	}
+	if len(e.args) != 1 {
+		return "", "", fmt.Errorf("invalid number of arguments for %s", e.name)
+	}
+	return function + "(" + column + ")", e.name, nil
+}
+
+// translateSelect translates a select statement to sql over the supertable of the measurement.
+func translateSelect(stmt *selectStatement, now time.Time) (*selectPlan, error) {
+	stable, err := tools.QuoteIdentifier(stmt.measurement)
+	if err != nil {
+		return nil, err
+	}
+	plan := &selectPlan{name: stmt.measurement, tags: stmt.groupTags}
+	ft := &fieldTranslator{}
+	var fields []string
+	wildcard := false
+	used := map[string]int{}
+	for _, field := range stmt.fields {
+		if ident, ok := field.expr.(*identExpr); ok && strings.EqualFold(ident.name, "time") {
+			// time is always the first column
+			continue
+		}
+		if _, ok := field.expr.(*wildcardExpr); ok {
+			wildcard = true
+			ft.raw = true
+			fields = append(fields, "*")
+			continue
+		}
+		sql, name, err := ft.translate(field.expr)
+		if err != nil {
+			return nil, err
+		}
+		if len(field.alias) > 0 {
+			name = field.alias
+		}
+		// the same as influxdb, duplicate names have a suffix
+		if n, exist := used[name]; exist {
+			used[name] = n + 1
+			name = name + "_" + strconv.Itoa(n+1)
+		} else {
+			used[name] = 0
+		}
+		fields = append(fields, sql)
+		plan.columns = append(plan.columns, name)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("at least 1 non-time field must be queried")
+	}
+	if ft.aggregate && ft.raw {
+		return nil, errors.New("mixing aggregate and non-aggregate queries is not supported")
+	}
+	if wildcard {
+		if len(fields) > 1 {
+			return nil, errors.New("wildcard can not be used with other fields")
+		}
+		plan.columns = nil
+	}
+	if len(stmt.interval) > 0 && !ft.aggregate {
+		return nil, errors.New("GROUP BY requires at least one aggregate function")
+	}
+	var b strings.Builder
+	b.WriteString("select ")
+	if ft.aggregate {
+		if len(stmt.interval) > 0 {
+			plan.hasTime = true
+			b.WriteString("_wstart,")
+		}
+	} else if !wildcard {
+		plan.hasTime = true
+		b.WriteString(timeColumn)
+		b.WriteByte(',')
+	} else {
+		// the first column of the supertable is the time
+		plan.hasTime = true
+	}
+	b.WriteString(strings.Join(fields, ","))
+	tags := make([]string, len(stmt.groupTags))
+	for i, tag := range stmt.groupTags {
+		if tags[i], err = tools.QuoteIdentifier(tag); err != nil {
+			return nil, err
+		}
+		b.WriteByte(',')
+		b.WriteString(tags[i])
+	}
+	b.WriteString(" from ")
+	b.WriteString(stable)
+	if stmt.condition != nil {
+		ct := &conditionTranslator{now: now}
+		condition, err := ct.translate(stmt.condition, true)
+		if err != nil {
+			return nil, err
+		}
+		plan.startTime = ct.start
+		b.WriteString(" where ")
+		b.WriteString(condition)
+	}
+	if plan.startTime.IsZero() {
+		plan.startTime = time.Unix(0, 0)
+	}
+	if len(tags) > 0 {
+		b.WriteString(" partition by ")
+		b.WriteString(strings.Join(tags, ","))
+	}
+	if len(stmt.interval) > 0 {
+		interval, err := tdDuration(stmt.interval)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(" interval(")
+		b.WriteString(interval)
+		if len(stmt.intervalOffset) > 0 {
+			offset, err := tdDuration(stmt.intervalOffset)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(',')
+			b.WriteString(offset)
+		}
+		b.WriteByte(')')
+		switch stmt.fill {
+		case "", "null":
+			// the default of influxdb is null
+			b.WriteString(" fill(null)")
+		case "none":
+		case "previous":
+			b.WriteString(" fill(prev)")
+		case "linear":
+			b.WriteString(" fill(linear)")
+		default:
+			b.WriteString(" fill(value")
+			for range fields {
+				b.WriteByte(',')
+				b.WriteString(stmt.fill)
+			}
+			b.WriteByte(')')
+		}
+	}
+	if plan.hasTime {
+		// the rows of a supertable are not sorted by time without order by
+		if len(stmt.interval) > 0 {
+			b.WriteString(" order by _wstart")
+		} else {
+			b.WriteString(" order by " + timeColumn)
+		}
+		if stmt.descending {
+			b.WriteString(" desc")
+		}
+	}
+	if stmt.sLimit > 0 {
+		b.WriteString(" slimit ")
+		b.WriteString(strconv.Itoa(stmt.sLimit))
+		if stmt.sOffset > 0 {
+			b.WriteString(" soffset ")
+			b.WriteString(strconv.Itoa(stmt.sOffset))
+		}
+	}
+	if stmt.limit > 0 {
+		b.WriteString(" limit ")
+		b.WriteString(strconv.Itoa(stmt.limit))
+		if stmt.offset > 0 {
+			b.WriteString(" offset ")
+			b.WriteString(strconv.Itoa(stmt.offset))
+		}
+	}
+	plan.sql = b.String()
+	return plan, nil
+}
+
+// translateShowMeasurements returns the sql of the supertables of the database.
+func translateShowMeasurements(db string, stmt *showMeasurementsStatement) string {
+	var b strings.Builder
+	b.WriteString("select stable_name from information_schema.ins_stables where db_name = '")
+	b.WriteString(tools.EscapeString(db))
+	b.WriteByte('\'')
+	switch stmt.op {
+	case "=", "!=":
+		b.WriteString(" and stable_name " + stmt.op + " '")
+		b.WriteString(tools.EscapeString(stmt.value))
+		b.WriteByte('\'')
+	case "=~":
+		b.WriteString(" and stable_name match '")
+		b.WriteString(tools.EscapeString(stmt.value))
+		b.WriteByte('\'')
+	case "!~":
+		b.WriteString(" and stable_name nmatch '")
+		b.WriteString(tools.EscapeString(stmt.value))
+		b.WriteByte('\'')
+	}
+	b.WriteString(" order by stable_name")
+	if stmt.limit > 0 {
+		b.WriteString(" limit ")
+		b.WriteString(strconv.Itoa(stmt.limit))
+		if stmt.offset > 0 {
+			b.WriteString(" offset ")
+			b.WriteString(strconv.Itoa(stmt.offset))
+		}
+	}
+	return b.String()
+}
+
+// influxFieldType returns the influxdb field type of a TDengine column type.
+func influxFieldType(columnType string) string {
+	columnType = strings.ToUpper(columnType)
+	switch {
+	case columnType == "DOUBLE" || columnType == "FLOAT":
+		return "float"
+	case columnType == "BOOL":
+		return "boolean"
+	case strings.HasPrefix(columnType, "VARCHAR") || strings.HasPrefix(columnType, "NCHAR") || strings.HasPrefix(columnType, "BINARY"):
+		return "string"
+	default:
+		return "integer"
+	}
+}
+
+type column struct {
+	name       string
+	columnType string
+	tag        bool
+}
+
+// influxStatementExecutor executes influxql statements on a database.
+type influxStatementExecutor struct {
+	executor influxQueryExecutor
+	db       string
+	now      time.Time
+	// epoch is the precision of the returned timestamps, empty means RFC3339
+	epoch string
+}
+
+func (e *influxStatementExecutor) execute(stmt interface{}) ([]*influxSeries, error) {
+	if _, ok := stmt.(*showDatabasesStatement); !ok && len(e.db) == 0 {
+		return nil, errors.New("database name required")
+	}
+	switch s := stmt.(type) {
+	case *selectStatement:
+		return e.executeSelect(s)
+	case *showDatabasesStatement:
+		return e.showDatabases()
+	case *showMeasurementsStatement:
+		return e.showMeasurements(s)
+	case *showTagKeysStatement:
+		return e.showKeys(s.measurement, true)
+	case *showFieldKeysStatement:
+		return e.showKeys(s.measurement, false)
+	case *showTagValuesStatement:
+		return e.showTagValues(s)
+	}
+	return nil, errors.New("unsupported statement")
+}
+
+func (e *influxStatementExecutor) formatTime(v driver.Value) interface{} {
+	ts, ok := v.(time.Time)
+	if !ok {
+		return v
+	}
+	switch e.epoch {
+	case "ns":
+		return ts.UnixNano()
+	case "u", "µ":
+		return ts.UnixNano() / int64(time.Microsecond)
+	case "ms":
+		return ts.UnixNano() / int64(time.Millisecond)
+	case "s":
+		return ts.Unix()
+	case "m":
+		return ts.Unix() / 60
+	case "h":
+		return ts.Unix() / 3600
+	default:
+		return ts.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func (e *influxStatementExecutor) executeSelect(stmt *selectStatement) ([]*influxSeries, error) {
+	plan, err := translateSelect(stmt, e.now)
+	if err != nil {
+		return nil, err
+	}
+	columns, rows, err := e.executor.Query(plan.sql)
+	if err != nil {
+		return nil, err
+	}
+	tagCount := len(plan.tags)
+	outputColumns := append([]string{"time"}, plan.columns...)
+	if plan.columns == nil {
+		// select *
+		outputColumns = append([]string{"time"}, columns[1:len(columns)-tagCount]...)
+	}
+	group := map[string]*influxSeries{}
+	var result []*influxSeries
+	keys := map[*influxSeries]string{}
+	for _, row := range rows {
+		if len(row) < tagCount {
+			continue
+		}
+		var b strings.Builder
+		tags := make(map[string]string, tagCount)
+		for i, tag := range plan.tags {
+			value, _ := row[len(row)-tagCount+i].(string)
+			tags[tag] = value
+			b.WriteString(value)
+			b.WriteByte(0)
+		}
+		key := b.String()
+		series, exist := group[key]
+		if !exist {
+			series = &influxSeries{Name: plan.name, Columns: outputColumns, Values: [][]interface{}{}}
+			if tagCount > 0 {
+				series.Tags = tags
+			}
+			group[key] = series
+			keys[series] = key
+			result = append(result, series)
+		}
+		values := make([]interface{}, 0, len(outputColumns))
+		data := row[:len(row)-tagCount]
+		if !plan.hasTime {
+			values = append(values, e.formatTime(plan.startTime))
+		}
+		for _, v := range data {
+			switch value := v.(type) {
+			case time.Time:
+				values = append(values, e.formatTime(value))
+			case []byte:
+				values = append(values, string(value))
+			default:
+				values = append(values, value)
+			}
+		}
+		series.Values = append(series.Values, values)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return keys[result[i]] < keys[result[j]]
+	})
+	return result, nil
+}
+
+func (e *influxStatementExecutor) queryStrings(sql string) ([]string, error) {
+	_, rows, err := e.executor.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		switch v := row[0].(type) {
+		case string:
+			result = append(result, v)
+		case []byte:
+			result = append(result, string(v))
+		}
+	}
+	return result, nil
+}
+
+func (e *influxStatementExecutor) showDatabases() ([]*influxSeries, error) {
+	names, err := e.queryStrings("show databases")
+	if err != nil {
+		return nil, err
+	}
+	series := &influxSeries{Name: "databases", Columns: []string{"name"}, Values: [][]interface{}{}}
+	for _, name := range names {
+		if name == "information_schema" || name == "performance_schema" {
+			continue
+		}
+		series.Values = append(series.Values, []interface{}{name})
+	}
+	return []*influxSeries{series}, nil
+}
+
+func (e *influxStatementExecutor) showMeasurements(stmt *showMeasurementsStatement) ([]*influxSeries, error) {
+	names, err := e.queryStrings(translateShowMeasurements(e.db, stmt))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	series := &influxSeries{Name: "measurements", Columns: []string{"name"}}
+	for _, name := range names {
+		series.Values = append(series.Values, []interface{}{name})
+	}
+	return []*influxSeries{series}, nil
+}
+
+// measurements returns the measurement or all the measurements of the database.
+func (e *influxStatementExecutor) measurements(measurement string) ([]string, error) {
+	if len(measurement) > 0 {
+		return []string{measurement}, nil
+	}
+	return e.queryStrings(translateShowMeasurements(e.db, &showMeasurementsStatement{}))
+}
+
+// describe returns the columns of the supertable, the first column is the time.
+func (e *influxStatementExecutor) describe(measurement string) ([]*column, error) {
+	stable, err := tools.QuoteIdentifier(measurement)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := e.executor.Query("describe " + stable)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]*column, 0, len(rows))
+	// field type length note
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		name, _ := row[0].(string)
+		columnType, _ := row[1].(string)
+		note, _ := row[3].(string)
+		columns = append(columns, &column{name: name, columnType: columnType, tag: note == "TAG"})
+	}
+	return columns, nil
+}
+
+func (e *influxStatementExecutor) showKeys(measurement string, tag bool) ([]*influxSeries, error) {
+	measurements, err := e.measurements(measurement)
+	if err != nil {
+		return nil, err
+	}
+	var result []*influxSeries
+	for _, m := range measurements {
+		columns, err := e.describe(m)
+		if err != nil {
+			return nil, err
+		}
+		series := &influxSeries{Name: m, Columns: []string{"fieldKey", "fieldType"}}
+		if tag {
+			series.Columns = []string{"tagKey"}
+		}
+		for i, c := range columns {
+			if i == 0 || c.tag != tag {
+				continue
+			}
+			if tag {
+				series.Values = append(series.Values, []interface{}{c.name})
+			} else {
+				series.Values = append(series.Values, []interface{}{c.name, influxFieldType(c.columnType)})
+			}
+		}
+		if len(series.Values) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+// matchKey reports whether the tag key matches the WITH KEY clause.
+func matchKey(stmt *showTagValuesStatement, key string) (bool, error) {
+	switch stmt.keyOp {
+	case "=":
+		return key == stmt.keys[0], nil
+	case "!=":
+		return key != stmt.keys[0], nil
+	case "=~", "!~":
+		re, err := regexp.Compile(stmt.keys[0])
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(key) == (stmt.keyOp == "=~"), nil
+	case "IN":
+		for _, k := range stmt.keys {
+			if k == key {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (e *influxStatementExecutor) showTagValues(stmt *showTagValuesStatement) ([]*influxSeries, error) {
+	measurements, err := e.measurements(stmt.measurement)
+	if err != nil {
+		return nil, err
+	}
+	condition := ""
+	if stmt.condition != nil {
+		ct := &conditionTranslator{now: e.now}
+		if condition, err = ct.translate(stmt.condition, true); err != nil {
+			return nil, err
+		}
+		condition = " where " + condition
+	}
+	var result []*influxSeries
+	for _, m := range measurements {
+		columns, err := e.describe(m)
+		if err != nil {
+			return nil, err
+		}
+		stable, err := tools.QuoteIdentifier(m)
+		if err != nil {
+			return nil, err
+		}
+		series := &influxSeries{Name: m, Columns: []string{"key", "value"}}
+		for _, c := range columns {
+			if !c.tag {
+				continue
+			}
+			matched, err := matchKey(stmt, c.name)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+			tag, err := tools.QuoteIdentifier(c.name)
+			if err != nil {
+				return nil, err
+			}
+			values, err := e.queryStrings("select distinct " + tag + " from " + stable + condition)
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(values)
+			for _, v := range values {
+				series.Values = append(series.Values, []interface{}{c.name, v})
+			}
+		}
+		if len(series.Values) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result, nil
+}
+
+// executeInfluxQL executes the statements in order, the execution stops at the first error.
+func executeInfluxQL(executor *influxStatementExecutor, statements []interface{}) *influxResponse {
+	resp := &influxResponse{Results: make([]*influxResult, 0, len(statements))}
+	for i, stmt := range statements {
+		series, err := executor.execute(stmt)
+		result := &influxResult{StatementID: i, Series: series}
+		if err != nil {
+			result.Error = err.Error()
+			resp.Results = append(resp.Results, result)
+			break
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp
+}
+
+// @Tags influxdb
+// @Summary influxdb query
+// @Description influxql query https://docs.influxdata.com/influxdb/v1.8/tools/api/#query-http-endpoint
+// @Produce json
+// @Param Authorization header string false "basic authorization"
+// @Param u query string false "username to authenticate the request"
+// @Param p query string false "password to authenticate the request"
+// @Param db query string false "the database to query"
+// @Param q query string true "influxql statements separated by semicolons"
+// @Param epoch query string false "return timestamps in the precision, ns, u, ms, s, m or h"
+// @Success 200 {object} influxResponse
+// @Failure 400 {object} influxResponse
+// @Failure 401 {object} influxResponse
+// @Failure 500 {object} influxResponse
+// @Router /influxdb/v1/query [get]
+func (p *Influxdb) query(c *gin.Context) {
+	reqID := uint64(generator.GetReqID())
+	c.Set(config.ReqIDKey, reqID)
+	logger := logger.WithField(config.ReqIDKey, reqID)
+	isDebug := log.IsDebug()
+	q := c.Request.FormValue("q")
+	logger.Debugf("request query:%s", q)
+	statements, err := parseInfluxQL(q)
+	if err != nil {
+		logger.Errorf("parse query error, err:%s", err)
+		c.JSON(http.StatusBadRequest, &influxResponse{Error: "error parsing query: " + err.Error()})
+		return
+	}
+	user, password, err := plugin.GetAuth(c)
+	if err != nil {
+		logger.Errorf("get user and password error:%s", err.Error())
+		c.JSON(http.StatusUnauthorized, &influxResponse{Error: err.Error()})
+		return
+	}
+	taosConn, err := commonpool.GetConnection(user, password, iptool.GetRealIP(c.Request))
+	if err != nil {
+		logger.Errorf("connect server error, err:%s", err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+			code = http.StatusUnauthorized
+		} else if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, &influxResponse{Error: err.Error()})
+		return
+	}
+	defer func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.Errorf("connect pool put error, err:%s", putErr)
+		}
+	}()
+	db := c.Request.FormValue("db")
+	if len(db) > 0 {
+		code := syncinterface.TaosSelectDB(taosConn.TaosConnection, db, logger, isDebug)
+		if code != 0 {
+			err = tErrors.NewError(code, wrapper.TaosErrorStr(nil))
+			web.SetTaosErrorCode(c, code&0xffff)
+			c.JSON(http.StatusOK, &influxResponse{Results: []*influxResult{{Error: err.Error()}}})
+			return
+		}
+	}
+	executor := &influxStatementExecutor{
+		executor: &tool.QueryExecutor{TaosConn: taosConn.TaosConnection, Logger: logger, IsDebug: isDebug, ReqID: int64(reqID)},
+		db:       db,
+		now:      time.Now(),
+		epoch:    c.Request.FormValue("epoch"),
+	}
+	s := log.GetLogNow(isDebug)
+	resp := executeInfluxQL(executor, statements)
+	logger.Debugf("execute influxql finish, cost:%s", log.GetLogDuration(isDebug, s))
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,111 @@
+package influxdb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubQueryExecutor struct {
+	results map[string][][]driver.Value
+	columns map[string][]string
+	sqls    []string
+}
+
+func (e *stubQueryExecutor) Query(sql string) ([]string, [][]driver.Value, error) {
+	e.sqls = append(e.sqls, sql)
+	for prefix, rows := range e.results {
+		if strings.HasPrefix(sql, prefix) {
+			return e.columns[prefix], rows, nil
+		}
+	}
+	return nil, nil, errors.New("table not exist")
+}
+
+func executeTestInfluxQL(t *testing.T, executor *stubQueryExecutor, epoch string, q string) string {
+	statements, err := parseInfluxQL(q)
+	require.NoError(t, err)
+	resp := executeInfluxQL(&influxStatementExecutor{
+		executor: executor,
+		db:       "test",
+		now:      time.Unix(3600, 0),
+		epoch:    epoch,
+	}, statements)
+	b, err := json.Marshal(resp)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestExecuteSelect(t *testing.T) {
+	executor := &stubQueryExecutor{results: map[string][][]driver.Value{
+		"select _wstart,avg(`value`),`host`": {
+			{time.Unix(60, 0), 2.5, "b"},
+			{time.Unix(0, 0), 1.5, "a"},
+			{time.Unix(60, 0), nil, "a"},
+		},
+		"select count(`value`)": {
+			{int64(3)},
+		},
+		"select *": {
+			{time.Unix(1, 0), 1.5, []byte("a")},
+		},
+	}, columns: map[string][]string{
+		"select *": {"_ts", "value", "host"},
+	}}
+	assert.JSONEq(t, `{"results":[{"statement_id":0,"series":[
+		{"name":"cpu","tags":{"host":"a"},"columns":["time","mean"],"values":[["1970-01-01T00:00:00Z",1.5],["1970-01-01T00:01:00Z",null]]},
+		{"name":"cpu","tags":{"host":"b"},"columns":["time","mean"],"values":[["1970-01-01T00:01:00Z",2.5]]}
+	]}]}`, executeTestInfluxQL(t, executor, "", `SELECT mean(value) FROM cpu WHERE time > now() - 1h GROUP BY time(1m), host`))
+
+	assert.JSONEq(t, `{"results":[{"statement_id":0,"series":[
+		{"name":"cpu","columns":["time","count"],"values":[[1800000,3]]}
+	]}]}`, executeTestInfluxQL(t, executor, "ms", `SELECT count(value) FROM cpu WHERE time > now() - 30m`))
+
+	assert.JSONEq(t, `{"results":[{"statement_id":0,"series":[
+		{"name":"cpu","columns":["time","value","host"],"values":[[1,1.5,"a"]]}
+	]}]}`, executeTestInfluxQL(t, executor, "s", `SELECT * FROM cpu`))
+
+	assert.Equal(t, []string{
+		"select _wstart,avg(`value`),`host` from `cpu` where _ts > '1970-01-01T00:00:00Z' partition by `host` interval(1m) fill(null) order by _wstart",
+		"select count(`value`) from `cpu` where _ts > '1970-01-01T00:30:00Z'",
+		"select * from `cpu` order by _ts",
+	}, executor.sqls)
+
+	assert.JSONEq(t, `{"results":[{"statement_id":0,"error":"table not exist"}]}`,
+		executeTestInfluxQL(t, executor, "", `SELECT value FROM mem; SELECT count(value) FROM cpu`))
+}
+
+func TestExecuteShow(t *testing.T) {
+	executor := &stubQueryExecutor{results: map[string][][]driver.Value{
+		"show databases": {{"information_schema"}, {"performance_schema"}, {"test"}},
+		"select stable_name from information_schema.ins_stables": {{"cpu"}},
+		"describe `cpu`": {
+			{"_ts", "TIMESTAMP", int32(8), ""},
+			{"usage", "DOUBLE", int32(8), ""},
+			{"cores", "BIGINT", int32(8), ""},
+			{"host", "NCHAR(16)", int32(16), "TAG"},
+			{"region", "NCHAR(16)", int32(16), "TAG"},
+		},
+		"select distinct `host`":   {{"b"}, {"a"}, {nil}},
+		"select distinct `region`": {{"us"}},
+	}}
+	assert.JSONEq(t, `{"results":[
+		{"statement_id":0,"series":[{"name":"databases","columns":["name"],"values":[["test"]]}]},
+		{"statement_id":1,"series":[{"name":"measurements","columns":["name"],"values":[["cpu"]]}]},
+		{"statement_id":2,"series":[{"name":"cpu","columns":["tagKey"],"values":[["host"],["region"]]}]},
+		{"statement_id":3,"series":[{"name":"cpu","columns":["fieldKey","fieldType"],"values":[["usage","float"],["cores","integer"]]}]},
+		{"statement_id":4,"series":[{"name":"cpu","columns":["key","value"],"values":[["host","a"],["host","b"]]}]}
+	]}`, executeTestInfluxQL(t, executor, "", `SHOW DATABASES; SHOW MEASUREMENTS; SHOW TAG KEYS; SHOW FIELD KEYS FROM cpu; SHOW TAG VALUES WITH KEY =~ /^h/ WHERE region = 'us'`))
+	assert.Equal(t, "select distinct `host` from `cpu` where `region` = 'us'", executor.sqls[len(executor.sqls)-1])
+
+	statements, err := parseInfluxQL(`SHOW MEASUREMENTS`)
+	require.NoError(t, err)
+	resp := executeInfluxQL(&influxStatementExecutor{executor: executor}, statements)
+	assert.Equal(t, "database name required", resp.Results[0].Error)
+}
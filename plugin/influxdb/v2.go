@@ -0,0 +1,182 @@
+package influxdb
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taosadapter/v3/config"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+)
+
+// error codes of the influxdb v2 api
+const (
+	v2CodeInvalid      = "invalid"
+	v2CodeUnauthorized = "unauthorized"
+	v2CodeNotFound     = "not found"
+	v2CodeInternal     = "internal error"
+	v2CodeUnavailable  = "unavailable"
+)
+
+// v2Precisions maps the precision of the v2 write api to the schemaless precision
+var v2Precisions = map[string]string{
+	"ns": "ns",
+	"us": "u",
+	"ms": "ms",
+	"s":  "s",
+}
+
+var errTokenFormat = errors.New("token must be in the format username:password")
+
+// getV2Auth sets the user and password of the `Authorization: Token username:password` header, the same as the
+// influxdb 1.8 v2 compatibility api. Basic authorization is also accepted.
+func getV2Auth(c *gin.Context) {
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	switch {
+	case strings.HasPrefix(auth, "Token "):
+		token := strings.TrimSpace(auth[6:])
+		index := strings.IndexByte(token, ':')
+		if index <= 0 {
+			return
+		}
+		c.Set(plugin.UserKey, token[:index])
+		c.Set(plugin.PasswordKey, token[index+1:])
+	case strings.HasPrefix(auth, "Basic ") && len(auth) > 6:
+		user, password, err := tools.DecodeBasic(auth[6:])
+		if err == nil {
+			c.Set(plugin.UserKey, user)
+			c.Set(plugin.PasswordKey, password)
+		}
+	}
+}
+
+// bucketDB returns the database of the bucket, an unmapped `db/rp` bucket is written to db.
+func (p *Influxdb) bucketDB(org, bucket string) string {
+	if len(org) > 0 {
+		if db, exist := p.buckets[org+"/"+bucket]; exist {
+			return db
+		}
+	}
+	if db, exist := p.buckets[bucket]; exist {
+		return db
+	}
+	if index := strings.IndexByte(bucket, '/'); index > 0 {
+		return bucket[:index]
+	}
+	return bucket
+}
+
+// isInvalidData reports whether the error is caused by the data, the schemaless error codes are from 0x3000 to 0x30ff.
+func isInvalidData(err error) bool {
+	taosError, is := err.(*tErrors.TaosError)
+	return is && taosError.Code >= 0x3000 && taosError.Code <= 0x30ff
+}
+
+func (p *Influxdb) v2Response(c *gin.Context, code int, errCode string, msg string) {
+	c.JSON(code, &message{Code: errCode, Message: msg})
+}
+
+// @Tags influxdb
+// @Summary influxdb v2 write
+// @Description influxdb write v2 https://docs.influxdata.com/influxdb/v2.0/api/#operation/PostWrite
+// @Accept plain
+// @Produce json
+// @Param Authorization header string true "Token username:password"
+// @Param org query string false "the organization of the bucket"
+// @Param bucket query string true "the bucket to write data to"
+// @Param precision query string false "the precision of Unix timestamps in the line protocol, ns, us, ms or s"
+// @Success 204 {string} string "no content"
+// @Failure 400 {object} message
+// @Failure 401 {object} message
+// @Failure 500 {object} message
+// @Failure 503 {object} message
+// @Router /influxdb/v1/api/v2/write [post]
+func (p *Influxdb) writeV2(c *gin.Context) {
+	reqID := uint64(generator.GetReqID())
+	c.Set(config.ReqIDKey, reqID)
+	logger := logger.WithField(config.ReqIDKey, reqID)
+	isDebug := log.IsDebug()
+	user, password, err := plugin.GetAuth(c)
+	if err != nil {
+		logger.Errorf("get user and password error:%s", err.Error())
+		p.v2Response(c, http.StatusUnauthorized, v2CodeUnauthorized, errTokenFormat.Error())
+		return
+	}
+	org := c.Query("org")
+	if len(org) == 0 {
+		org = c.Query("orgID")
+	}
+	bucket := c.Query("bucket")
+	if len(bucket) == 0 {
+		logger.Error("bucket required")
+		p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, "bucket required")
+		return
+	}
+	db := p.bucketDB(org, bucket)
+	logger.Tracef("request org:%s, bucket:%s, db:%s", org, bucket, db)
+	if len(db) == 0 {
+		p.v2Response(c, http.StatusNotFound, v2CodeNotFound, "bucket \""+bucket+"\" not found")
+		return
+	}
+	precision := c.DefaultQuery("precision", "ns")
+	smlPrecision, ok := v2Precisions[precision]
+	if !ok {
+		logger.Errorf("invalid precision %s", precision)
+		p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, "invalid precision \""+precision+"\", precision must be one of: ns, us, ms, s")
+		return
+	}
+	var ttl int
+	if ttlStr := c.Query("ttl"); len(ttlStr) > 0 {
+		ttl, err = strconv.Atoi(ttlStr)
+		if err != nil {
+			logger.Errorf("illegal param, ttl must be numeric %s, ttl:%s", err, ttlStr)
+			p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, "ttl must be numeric")
+			return
+		}
+	}
+	var body io.Reader = c.Request.Body
+	// the gzip middleware removes the header after decompressing
+	if c.GetHeader("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			logger.Errorf("create gzip reader error, err:%s", err)
+			p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, err.Error())
+			return
+		}
+		defer func() {
+			_ = gr.Close()
+		}()
+		body = gr
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		logger.Errorf("read line error, err:%s", err)
+		p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, err.Error())
+		return
+	}
+	logger.Debugf("request data:%s", data)
+	code, err := p.insert(c, logger, isDebug, user, password, data, db, smlPrecision, ttl, reqID, c.Query("table_name_key"))
+	if err != nil {
+		switch {
+		case code == http.StatusUnauthorized:
+			p.v2Response(c, code, v2CodeUnauthorized, err.Error())
+		case code == http.StatusServiceUnavailable:
+			p.v2Response(c, code, v2CodeUnavailable, err.Error())
+		case isInvalidData(err):
+			p.v2Response(c, http.StatusBadRequest, v2CodeInvalid, err.Error())
+		default:
+			p.v2Response(c, code, v2CodeInternal, err.Error())
+		}
+		return
+	}
+	logger.Debugf("insert line success")
+	c.Status(http.StatusNoContent)
+}
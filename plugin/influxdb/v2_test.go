@@ -0,0 +1,66 @@
+package influxdb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/plugin"
+)
+
+func TestBucketDB(t *testing.T) {
+	conf := Config{BucketMapping: []string{"telegraf=telegraf_db", "my-org/metrics=org_metrics", " "}}
+	buckets, err := conf.bucketMap()
+	require.NoError(t, err)
+	p := &Influxdb{buckets: buckets}
+	assert.Equal(t, "telegraf_db", p.bucketDB("", "telegraf"))
+	assert.Equal(t, "telegraf_db", p.bucketDB("my-org", "telegraf"))
+	assert.Equal(t, "org_metrics", p.bucketDB("my-org", "metrics"))
+	assert.Equal(t, "metrics", p.bucketDB("other", "metrics"))
+	assert.Equal(t, "mydb", p.bucketDB("", "mydb/autogen"))
+
+	for _, item := range []string{"telegraf", "=db", "telegraf="} {
+		conf = Config{BucketMapping: []string{item}}
+		_, err = conf.bucketMap()
+		assert.Error(t, err, item)
+	}
+}
+
+func TestGetV2Auth(t *testing.T) {
+	tests := []struct {
+		auth     string
+		user     string
+		password string
+		ok       bool
+	}{
+		{auth: "Token root:taosdata", user: "root", password: "taosdata", ok: true},
+		{auth: "Token root:pass:word", user: "root", password: "pass:word", ok: true},
+		{auth: "Basic cm9vdDp0YW9zZGF0YQ==", user: "root", password: "taosdata", ok: true},
+		{auth: "Token abcdef", ok: false},
+		{auth: "", ok: false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v2/write", nil)
+		c.Request.Header.Set("Authorization", tt.auth)
+		getV2Auth(c)
+		user, password, err := plugin.GetAuth(c)
+		if !tt.ok {
+			assert.Error(t, err, tt.auth)
+			continue
+		}
+		require.NoError(t, err, tt.auth)
+		assert.Equal(t, tt.user, user)
+		assert.Equal(t, tt.password, password)
+	}
+}
+
+func TestIsInvalidData(t *testing.T) {
+	assert.True(t, isInvalidData(tErrors.NewError(0x3002, "Invalid data format")))
+	assert.False(t, isInvalidData(tErrors.NewError(0x0357, "Authentication failure")))
+	assert.False(t, isInvalidData(assert.AnError))
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+const (
+	ValueFormatJSON = "json"
+	ValueFormatAvro = "avro"
+)
+
+type Config struct {
+	Enable         bool
+	Port           int
+	User           string
+	Password       string
+	AdvertisedHost string
+	ValueFormat    string
+	MaxConnections int
+	// IdleTimeout closes the consumers used for offset commit and fetch that are not used within the timeout
+	IdleTimeout time.Duration
+	// MaxBufferedMessages is the number of messages buffered for each partition between fetch requests
+	MaxBufferedMessages int
+}
+
+func (c *Config) setValue() {
+	c.Enable = viper.GetBool("kafka.enable")
+	c.Port = viper.GetInt("kafka.port")
+	c.User = viper.GetString("kafka.user")
+	c.Password = viper.GetString("kafka.password")
+	c.AdvertisedHost = viper.GetString("kafka.advertisedHost")
+	c.ValueFormat = viper.GetString("kafka.valueFormat")
+	c.MaxConnections = viper.GetInt("kafka.maxConnections")
+	c.IdleTimeout = viper.GetDuration("kafka.idleTimeout")
+	c.MaxBufferedMessages = viper.GetInt("kafka.maxBufferedMessages")
+}
+
+func (c *Config) check() error {
+	if c.ValueFormat != ValueFormatJSON && c.ValueFormat != ValueFormatAvro {
+		return fmt.Errorf("kafka.valueFormat must be %s or %s, got %s", ValueFormatJSON, ValueFormatAvro, c.ValueFormat)
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid kafka.port %d", c.Port)
+	}
+	if c.MaxConnections < 1 {
+		c.MaxConnections = 1
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 5 * time.Minute
+	}
+	if c.MaxBufferedMessages < 1 {
+		c.MaxBufferedMessages = 1
+	}
+	return nil
+}
+
+func init() {
+	_ = viper.BindEnv("kafka.enable", "TAOS_ADAPTER_KAFKA_ENABLE")
+	pflag.Bool("kafka.enable", false, `enable kafka protocol consumer facade for tmq topics. Env "TAOS_ADAPTER_KAFKA_ENABLE"`)
+	viper.SetDefault("kafka.enable", false)
+
+	_ = viper.BindEnv("kafka.port", "TAOS_ADAPTER_KAFKA_PORT")
+	pflag.Int("kafka.port", 9092, `kafka protocol tcp port. Env "TAOS_ADAPTER_KAFKA_PORT"`)
+	viper.SetDefault("kafka.port", 9092)
+
+	_ = viper.BindEnv("kafka.user", "TAOS_ADAPTER_KAFKA_USER")
+	pflag.String("kafka.user", common.DefaultUser, `kafka user to subscribe tmq topics. Env "TAOS_ADAPTER_KAFKA_USER"`)
+	viper.SetDefault("kafka.user", common.DefaultUser)
+
+	_ = viper.BindEnv("kafka.password", "TAOS_ADAPTER_KAFKA_PASSWORD")
+	pflag.String("kafka.password", common.DefaultPassword, `kafka password. Env "TAOS_ADAPTER_KAFKA_PASSWORD"`)
+	viper.SetDefault("kafka.password", common.DefaultPassword)
+
+	_ = viper.BindEnv("kafka.advertisedHost", "TAOS_ADAPTER_KAFKA_ADVERTISED_HOST")
+	pflag.String("kafka.advertisedHost", "", `kafka broker host returned to clients, the local address of the connection is used if empty. Env "TAOS_ADAPTER_KAFKA_ADVERTISED_HOST"`)
+	viper.SetDefault("kafka.advertisedHost", "")
+
+	_ = viper.BindEnv("kafka.valueFormat", "TAOS_ADAPTER_KAFKA_VALUE_FORMAT")
+	pflag.String("kafka.valueFormat", ValueFormatJSON, `kafka record value format, json or avro. Env "TAOS_ADAPTER_KAFKA_VALUE_FORMAT"`)
+	viper.SetDefault("kafka.valueFormat", ValueFormatJSON)
+
+	_ = viper.BindEnv("kafka.maxConnections", "TAOS_ADAPTER_KAFKA_MAX_CONNECTIONS")
+	pflag.Int("kafka.maxConnections", 250, `kafka max tcp connections. Env "TAOS_ADAPTER_KAFKA_MAX_CONNECTIONS"`)
+	viper.SetDefault("kafka.maxConnections", 250)
+
+	_ = viper.BindEnv("kafka.idleTimeout", "TAOS_ADAPTER_KAFKA_IDLE_TIMEOUT")
+	pflag.Duration("kafka.idleTimeout", 5*time.Minute, `kafka idle timeout of the group consumers used for offset commit. Env "TAOS_ADAPTER_KAFKA_IDLE_TIMEOUT"`)
+	viper.SetDefault("kafka.idleTimeout", 5*time.Minute)
+
+	_ = viper.BindEnv("kafka.maxBufferedMessages", "TAOS_ADAPTER_KAFKA_MAX_BUFFERED_MESSAGES")
+	pflag.Int("kafka.maxBufferedMessages", 1000, `kafka max tmq messages buffered for each partition between fetch requests. Env "TAOS_ADAPTER_KAFKA_MAX_BUFFERED_MESSAGES"`)
+	viper.SetDefault("kafka.maxBufferedMessages", 1000)
+}
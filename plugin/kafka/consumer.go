@@ -0,0 +1,321 @@
+package kafka
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqhandle"
+)
+
+// assignmentTTL is how long the begin and end offsets of the vgroups are cached for the high watermark.
+const assignmentTTL = time.Second
+
+var errVgroupNotAssigned = errors.New("vgroup not assigned to the tmq consumer")
+
+var localhost = net.IPv4(127, 0, 0, 1)
+
+type tmqConsumer interface {
+	Poll(blockingTime time.Duration, location *time.Location) (*tmqconsumer.Message, error)
+	Assignment(topic string) ([]*tmqhandle.Assignment, error)
+	Seek(topic string, vgroupID int32, offset int64) error
+	CommitOffset(topic string, vgroupID int32, offset int64) error
+	Committed(topic string, vgroupID int32) (int64, error)
+	Close()
+}
+
+var newConsumer = func(conf *tmqconsumer.Config, logger *logrus.Entry) (tmqConsumer, error) {
+	consumer, err := tmqconsumer.New(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+type vgroupState struct {
+	// next is the offset the client fetches next, -1 means the vgroup is seeked by the next fetch
+	next    int64
+	records []*record
+}
+
+// topicConsumer is a tmq consumer of a topic, the messages polled are buffered for each vgroup until the client
+// fetches them. A fetch at an offset other than the next offset of the vgroup seeks the vgroup to the offset.
+type topicConsumer struct {
+	topic       string
+	groupID     string
+	consumer    tmqConsumer
+	valueFormat string
+	maxBuffered int
+	logger      *logrus.Entry
+	lock        sync.Mutex
+	vgroups     map[int32]*vgroupState
+	assignment  map[int32]*tmqhandle.Assignment
+	expires     time.Time
+	lastUsed    int64
+}
+
+func openTopicConsumer(conf *Config, groupID, clientID, topic string, ip net.IP) (*topicConsumer, error) {
+	l := logger.WithField("group", groupID).WithField("topic", topic)
+	consumer, err := newConsumer(&tmqconsumer.Config{
+		User:        conf.User,
+		Password:    conf.Password,
+		GroupID:     groupID,
+		ClientID:    clientID,
+		Topics:      []string{topic},
+		OffsetReset: "earliest",
+		IP:          ip,
+		App:         "kafka",
+		RawValues:   conf.ValueFormat == ValueFormatAvro,
+	}, l)
+	if err != nil {
+		return nil, err
+	}
+	t := &topicConsumer{
+		topic:       topic,
+		groupID:     groupID,
+		consumer:    consumer,
+		valueFormat: conf.ValueFormat,
+		maxBuffered: conf.MaxBufferedMessages,
+		logger:      l,
+		vgroups:     map[int32]*vgroupState{},
+	}
+	t.touch()
+	return t, nil
+}
+
+func (t *topicConsumer) touch() {
+	atomic.StoreInt64(&t.lastUsed, time.Now().UnixNano())
+}
+
+func (t *topicConsumer) idle(now time.Time, timeout time.Duration) bool {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&t.lastUsed))) > timeout
+}
+
+// read returns the buffered records of the vgroup from the offset within maxBytes, the first record is returned
+// even if it exceeds maxBytes when atLeastOne is set.
+func (t *topicConsumer) read(vgroupID int32, offset int64, maxBytes int, atLeastOne bool) ([]*record, error) {
+	t.touch()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state := t.vgroups[vgroupID]
+	if state == nil {
+		state = &vgroupState{next: -1}
+		t.vgroups[vgroupID] = state
+	}
+	if state.next != offset {
+		if err := t.consumer.Seek(t.topic, vgroupID, offset); err != nil {
+			return nil, err
+		}
+		state.next = offset
+		state.records = nil
+	}
+	size := 0
+	n := 0
+	for ; n < len(state.records); n++ {
+		recordSize := state.records[n].size()
+		if size+recordSize > maxBytes && !(atLeastOne && n == 0) {
+			break
+		}
+		size += recordSize
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	result := state.records[:n:n]
+	state.records = append([]*record(nil), state.records[n:]...)
+	state.next = result[n-1].offset + 1
+	return result, nil
+}
+
+// poll polls a message and buffers it as a record if the vgroup is fetched from an offset before the message, the
+// messages of the other vgroups are dropped and polled again after the seek of the first fetch of the vgroup.
+func (t *topicConsumer) poll(blockingTime time.Duration) error {
+	t.touch()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	message, err := t.consumer.Poll(blockingTime, time.Local)
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		return nil
+	}
+	state := t.vgroups[message.VgroupID]
+	if state == nil || state.next < 0 || message.Offset < state.next {
+		return nil
+	}
+	if n := len(state.records); n > 0 && message.Offset <= state.records[n-1].offset {
+		return nil
+	}
+	if len(state.records) >= t.maxBuffered {
+		t.logger.Debugf("vgroup %d buffer full, seek at next fetch", message.VgroupID)
+		state.next = -1
+		state.records = nil
+		return nil
+	}
+	r, err := t.record(message)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		state.records = append(state.records, r)
+	}
+	return nil
+}
+
+// record encodes the rows of the message as the record value, it returns nil if the message has no rows.
+func (t *topicConsumer) record(message *tmqconsumer.Message) (*record, error) {
+	if len(message.Blocks) == 0 {
+		return nil, nil
+	}
+	r := &record{offset: message.Offset, timestamp: time.Now().UnixNano() / 1e6}
+	if t.valueFormat == ValueFormatAvro {
+		value, schema, err := encodeAvro(message)
+		if err != nil {
+			return nil, err
+		}
+		r.value = value
+		r.headers = []*recordHeader{{key: AvroSchemaHeader, value: schema}}
+	} else {
+		r.value = encodeJSON(message)
+	}
+	return r, nil
+}
+
+// watermarks returns the begin and end offsets of the vgroup.
+func (t *topicConsumer) watermarks(vgroupID int32) (int64, int64, error) {
+	t.touch()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	if now.After(t.expires) {
+		assignment, err := t.consumer.Assignment(t.topic)
+		if err != nil {
+			return 0, 0, err
+		}
+		t.assignment = make(map[int32]*tmqhandle.Assignment, len(assignment))
+		for _, a := range assignment {
+			t.assignment[a.VGroupID] = a
+		}
+		t.expires = now.Add(assignmentTTL)
+	}
+	a := t.assignment[vgroupID]
+	if a == nil {
+		return 0, 0, errVgroupNotAssigned
+	}
+	return a.Begin, a.End, nil
+}
+
+func (t *topicConsumer) commit(vgroupID int32, offset int64) error {
+	t.touch()
+	return t.consumer.CommitOffset(t.topic, vgroupID, offset)
+}
+
+// committed returns the committed offset of the vgroup, -1 if nothing was committed.
+func (t *topicConsumer) committed(vgroupID int32) (int64, error) {
+	t.touch()
+	offset, err := t.consumer.Committed(t.topic, vgroupID)
+	if err != nil {
+		return 0, err
+	}
+	if offset == tmqconsumer.OffsetInvalid {
+		return -1, nil
+	}
+	return offset, nil
+}
+
+func (t *topicConsumer) close() {
+	t.consumer.Close()
+}
+
+// groupConsumers are the consumers of the kafka groups for OffsetCommit and OffsetFetch, the tmq group is the kafka
+// group. They are closed when not used within the idle timeout.
+type groupConsumers struct {
+	conf      *Config
+	lock      sync.Mutex
+	consumers map[string]*topicConsumer
+}
+
+func newGroupConsumers(conf *Config) *groupConsumers {
+	return &groupConsumers{conf: conf, consumers: map[string]*topicConsumer{}}
+}
+
+func (g *groupConsumers) get(groupID, clientID, topic string, ip net.IP) (*topicConsumer, error) {
+	key := tmqconsumer.Key(groupID, "", []string{topic})
+	g.lock.Lock()
+	t, exists := g.consumers[key]
+	g.lock.Unlock()
+	if exists {
+		return t, nil
+	}
+	t, err := openTopicConsumer(g.conf, groupID, clientID, topic, ip)
+	if err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	if current, exists := g.consumers[key]; exists {
+		g.lock.Unlock()
+		t.close()
+		return current, nil
+	}
+	g.consumers[key] = t
+	g.lock.Unlock()
+	return t, nil
+}
+
+// do runs f with the consumer of the group and topic, the consumer is opened again and f is retried once if f
+// fails, since the vgroups of a consumer not polling may be assigned to the other consumers of the group.
+func (g *groupConsumers) do(groupID, clientID, topic string, ip net.IP, f func(t *topicConsumer) error) error {
+	for retry := 0; ; retry++ {
+		t, err := g.get(groupID, clientID, topic, ip)
+		if err != nil {
+			return err
+		}
+		err = f(t)
+		if err == nil || retry > 0 {
+			return err
+		}
+		t.logger.WithError(err).Warn("group consumer error, retry with a new consumer")
+		g.remove(t)
+	}
+}
+
+func (g *groupConsumers) remove(t *topicConsumer) {
+	key := tmqconsumer.Key(t.groupID, "", []string{t.topic})
+	g.lock.Lock()
+	if g.consumers[key] == t {
+		delete(g.consumers, key)
+	}
+	g.lock.Unlock()
+	t.close()
+}
+
+func (g *groupConsumers) closeIdle(now time.Time) {
+	var idle []*topicConsumer
+	g.lock.Lock()
+	for key, t := range g.consumers {
+		if t.idle(now, g.conf.IdleTimeout) {
+			delete(g.consumers, key)
+			idle = append(idle, t)
+		}
+	}
+	g.lock.Unlock()
+	for _, t := range idle {
+		t.logger.Info("close idle group consumer")
+		t.close()
+	}
+}
+
+func (g *groupConsumers) closeAll() {
+	g.lock.Lock()
+	consumers := g.consumers
+	g.consumers = map[string]*topicConsumer{}
+	g.lock.Unlock()
+	for _, t := range consumers {
+		t.close()
+	}
+}
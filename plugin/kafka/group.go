@@ -0,0 +1,470 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	stateEmpty = iota
+	statePreparingRebalance
+	stateCompletingRebalance
+	stateStable
+)
+
+const (
+	minSessionTimeout = 6 * time.Second
+	maxSessionTimeout = 30 * time.Minute
+)
+
+type protocol struct {
+	name     string
+	metadata []byte
+}
+
+type member struct {
+	id               string
+	clientID         string
+	clientHost       string
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	protocols        []*protocol
+	assignment       []byte
+	lastHeartbeat    time.Time
+	joinCh           chan *joinResult
+	syncCh           chan *syncResult
+}
+
+func (m *member) metadata(name string) []byte {
+	for _, p := range m.protocols {
+		if p.name == name {
+			return p.metadata
+		}
+	}
+	return nil
+}
+
+type joinRequest struct {
+	groupID          string
+	memberID         string
+	clientID         string
+	clientHost       string
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	protocolType     string
+	protocols        []*protocol
+}
+
+type joinMember struct {
+	id       string
+	metadata []byte
+}
+
+type joinResult struct {
+	errorCode  int16
+	generation int32
+	protocol   string
+	leader     string
+	memberID   string
+	members    []*joinMember
+}
+
+type syncResult struct {
+	errorCode  int16
+	assignment []byte
+}
+
+// group is a consumer group kept in memory, the rebalance follows the kafka group coordinator: the members join
+// again when a member joins or leaves, the join completes when all the members joined or the rebalance timeout
+// expires, then the leader sends the assignments of all the members with SyncGroup.
+type group struct {
+	id           string
+	lock         sync.Mutex
+	state        int
+	generation   int32
+	protocolType string
+	protocol     string
+	leader       string
+	members      map[string]*member
+	pending      map[string]*member
+	timer        *time.Timer
+	// removed is set when the empty group is removed from the coordinator
+	removed bool
+}
+
+// coordinator holds the groups, every group is coordinated by this node.
+type coordinator struct {
+	lock    sync.Mutex
+	groups  map[string]*group
+	counter uint64
+	exit    chan struct{}
+}
+
+func newCoordinator() *coordinator {
+	return &coordinator{
+		groups: map[string]*group{},
+		exit:   make(chan struct{}),
+	}
+}
+
+func (c *coordinator) group(id string, create bool) *group {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	g, exists := c.groups[id]
+	if !exists && create {
+		g = &group{id: id, members: map[string]*member{}, pending: map[string]*member{}}
+		c.groups[id] = g
+	}
+	return g
+}
+
+// join adds the member to the group and waits for the rebalance to complete.
+func (c *coordinator) join(req *joinRequest) *joinResult {
+	if req.sessionTimeout < minSessionTimeout || req.sessionTimeout > maxSessionTimeout {
+		return &joinResult{errorCode: errInvalidSessionTimeout, generation: -1}
+	}
+	if len(req.groupID) == 0 || len(req.protocols) == 0 {
+		return &joinResult{errorCode: errInconsistentProtocol, generation: -1}
+	}
+	g := c.group(req.groupID, true)
+	g.lock.Lock()
+	if g.removed {
+		g.lock.Unlock()
+		return c.join(req)
+	}
+	if len(g.members) != 0 && (g.protocolType != req.protocolType || !g.supportsAny(req.protocols)) {
+		g.lock.Unlock()
+		return &joinResult{errorCode: errInconsistentProtocol, generation: -1}
+	}
+	m, exists := g.members[req.memberID]
+	if len(req.memberID) != 0 && !exists {
+		g.lock.Unlock()
+		return &joinResult{errorCode: errUnknownMemberID, generation: -1}
+	}
+	if !exists {
+		m = &member{id: fmt.Sprintf("%s-%d", req.clientID, atomic.AddUint64(&c.counter, 1))}
+		g.members[m.id] = m
+	}
+	m.clientID = req.clientID
+	m.clientHost = req.clientHost
+	m.sessionTimeout = req.sessionTimeout
+	m.rebalanceTimeout = req.rebalanceTimeout
+	m.protocols = req.protocols
+	m.lastHeartbeat = time.Now()
+	ch := make(chan *joinResult, 1)
+	m.joinCh = ch
+	g.protocolType = req.protocolType
+	if g.state != statePreparingRebalance {
+		g.prepareRebalance()
+	}
+	g.pending[m.id] = m
+	if len(g.pending) == len(g.members) {
+		g.completeJoin()
+	}
+	timeout := m.rebalanceTimeout + m.sessionTimeout
+	g.lock.Unlock()
+	select {
+	case result := <-ch:
+		return result
+	case <-time.After(timeout):
+		return &joinResult{errorCode: errRebalanceInProgress, generation: -1, memberID: m.id}
+	case <-c.exit:
+		return &joinResult{errorCode: errCoordinatorNotAvailable, generation: -1, memberID: m.id}
+	}
+}
+
+// supports returns true if all the members support the protocol.
+func (g *group) supports(name string) bool {
+	for _, m := range g.members {
+		if !hasProtocol(m, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareRebalance starts a rebalance, the members waiting for the assignment are told to join again.
+func (g *group) prepareRebalance() {
+	for _, m := range g.members {
+		if m.syncCh != nil {
+			m.syncCh <- &syncResult{errorCode: errRebalanceInProgress}
+			m.syncCh = nil
+		}
+	}
+	g.state = statePreparingRebalance
+	g.pending = map[string]*member{}
+	var timeout time.Duration
+	for _, m := range g.members {
+		if m.rebalanceTimeout > timeout {
+			timeout = m.rebalanceTimeout
+		}
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.timer = time.AfterFunc(timeout, func() {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		if g.state == statePreparingRebalance {
+			g.completeJoin()
+		}
+	})
+}
+
+// completeJoin removes the members not joined, starts a new generation and responds the joined members.
+func (g *group) completeJoin() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	for id := range g.members {
+		if _, joined := g.pending[id]; !joined {
+			delete(g.members, id)
+		}
+	}
+	g.pending = map[string]*member{}
+	g.generation++
+	if len(g.members) == 0 {
+		g.state = stateEmpty
+		g.leader = ""
+		g.protocol = ""
+		return
+	}
+	ids := make([]string, 0, len(g.members))
+	for id := range g.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if _, exists := g.members[g.leader]; !exists {
+		g.leader = ids[0]
+	}
+	g.protocol = ""
+	for _, p := range g.members[g.leader].protocols {
+		if g.supports(p.name) {
+			g.protocol = p.name
+			break
+		}
+	}
+	g.state = stateCompletingRebalance
+	var members []*joinMember
+	for _, id := range ids {
+		members = append(members, &joinMember{id: id, metadata: g.members[id].metadata(g.protocol)})
+	}
+	for _, id := range ids {
+		m := g.members[id]
+		m.assignment = nil
+		m.lastHeartbeat = time.Now()
+		result := &joinResult{
+			generation: g.generation,
+			protocol:   g.protocol,
+			leader:     g.leader,
+			memberID:   id,
+		}
+		if id == g.leader {
+			result.members = members
+		}
+		if m.joinCh != nil {
+			m.joinCh <- result
+			m.joinCh = nil
+		}
+	}
+}
+
+func (g *group) supportsAny(protocols []*protocol) bool {
+	for _, p := range protocols {
+		if g.supports(p.name) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasProtocol(m *member, name string) bool {
+	for _, p := range m.protocols {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sync waits for the assignment of the member, the leader sends the assignments of all the members.
+func (c *coordinator) sync(groupID, memberID string, generation int32, assignments map[string][]byte) *syncResult {
+	g := c.group(groupID, false)
+	if g == nil {
+		return &syncResult{errorCode: errUnknownMemberID}
+	}
+	g.lock.Lock()
+	m, exists := g.members[memberID]
+	if !exists {
+		g.lock.Unlock()
+		return &syncResult{errorCode: errUnknownMemberID}
+	}
+	if generation != g.generation {
+		g.lock.Unlock()
+		return &syncResult{errorCode: errIllegalGeneration}
+	}
+	m.lastHeartbeat = time.Now()
+	switch g.state {
+	case statePreparingRebalance:
+		g.lock.Unlock()
+		return &syncResult{errorCode: errRebalanceInProgress}
+	case stateStable:
+		result := &syncResult{assignment: m.assignment}
+		g.lock.Unlock()
+		return result
+	}
+	ch := make(chan *syncResult, 1)
+	m.syncCh = ch
+	if memberID == g.leader {
+		for id, member := range g.members {
+			member.assignment = assignments[id]
+			if member.syncCh != nil {
+				member.syncCh <- &syncResult{assignment: member.assignment}
+				member.syncCh = nil
+			}
+		}
+		g.state = stateStable
+	}
+	timeout := m.sessionTimeout
+	g.lock.Unlock()
+	select {
+	case result := <-ch:
+		return result
+	case <-time.After(timeout):
+		return &syncResult{errorCode: errRebalanceInProgress}
+	case <-c.exit:
+		return &syncResult{errorCode: errCoordinatorNotAvailable}
+	}
+}
+
+func (c *coordinator) heartbeat(groupID, memberID string, generation int32) int16 {
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	m, exists := g.members[memberID]
+	if !exists {
+		return errUnknownMemberID
+	}
+	if generation != g.generation {
+		return errIllegalGeneration
+	}
+	m.lastHeartbeat = time.Now()
+	if g.state != stateStable {
+		return errRebalanceInProgress
+	}
+	return errNone
+}
+
+func (c *coordinator) leave(groupID, memberID string) int16 {
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, exists := g.members[memberID]; !exists {
+		return errUnknownMemberID
+	}
+	g.remove(memberID)
+	return errNone
+}
+
+// remove removes the member and starts a rebalance for the members left.
+func (g *group) remove(memberID string) {
+	m := g.members[memberID]
+	delete(g.members, memberID)
+	delete(g.pending, memberID)
+	if m.joinCh != nil {
+		m.joinCh <- &joinResult{errorCode: errUnknownMemberID, generation: -1}
+		m.joinCh = nil
+	}
+	if m.syncCh != nil {
+		m.syncCh <- &syncResult{errorCode: errUnknownMemberID}
+		m.syncCh = nil
+	}
+	if len(g.members) == 0 {
+		if g.timer != nil {
+			g.timer.Stop()
+			g.timer = nil
+		}
+		g.state = stateEmpty
+		g.leader = ""
+		g.protocol = ""
+		return
+	}
+	if g.state != statePreparingRebalance {
+		g.prepareRebalance()
+	}
+	if len(g.pending) == len(g.members) {
+		g.completeJoin()
+	}
+}
+
+// validate checks the member and the generation of an offset commit, the commits out of a group use generation -1.
+func (c *coordinator) validate(groupID, memberID string, generation int32) int16 {
+	if generation < 0 && len(memberID) == 0 {
+		return errNone
+	}
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, exists := g.members[memberID]; !exists {
+		return errUnknownMemberID
+	}
+	if generation != g.generation {
+		return errIllegalGeneration
+	}
+	if g.state == statePreparingRebalance {
+		return errRebalanceInProgress
+	}
+	return errNone
+}
+
+// expire removes the members without heartbeat within the session timeout, the members joining are kept since they
+// are waiting for the other members, and the empty groups are removed.
+func (c *coordinator) expire(now time.Time) {
+	c.lock.Lock()
+	groups := make([]*group, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, g)
+	}
+	c.lock.Unlock()
+	for _, g := range groups {
+		g.lock.Lock()
+		for id, m := range g.members {
+			if m.joinCh != nil {
+				continue
+			}
+			if now.Sub(m.lastHeartbeat) > m.sessionTimeout {
+				logger.Infof("member %s of group %s expired", id, g.id)
+				g.remove(id)
+			}
+		}
+		empty := len(g.members) == 0
+		g.lock.Unlock()
+		if empty {
+			c.lock.Lock()
+			g.lock.Lock()
+			if len(g.members) == 0 && c.groups[g.id] == g {
+				delete(c.groups, g.id)
+				g.removed = true
+			}
+			g.lock.Unlock()
+			c.lock.Unlock()
+		}
+	}
+}
+
+func (c *coordinator) stop() {
+	close(c.exit)
+}
@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "kafka")
+
+// Plugin serves the consumer subset of the kafka protocol, the kafka topics are the tmq topics and the partitions
+// are the vgroups of the topics.
+type Plugin struct {
+	conf   Config
+	server *server
+}
+
+func (p *Plugin) Init(_ gin.IRouter) error {
+	p.conf.setValue()
+	if !p.conf.Enable {
+		logger.Info("kafka disabled")
+		return nil
+	}
+	return p.conf.check()
+}
+
+func (p *Plugin) Start() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	p.server = newServer(&p.conf, &sqlCatalog{user: p.conf.User, password: p.conf.Password})
+	return p.server.start(p.conf.Port)
+}
+
+func (p *Plugin) Stop() error {
+	if !p.conf.Enable || p.server == nil {
+		return nil
+	}
+	return p.server.stop()
+}
+
+func (p *Plugin) String() string {
+	return "kafka"
+}
+
+func (p *Plugin) Version() string {
+	return "v1"
+}
+
+func init() {
+	plugin.Register(&Plugin{})
+}
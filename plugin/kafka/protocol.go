@@ -0,0 +1,244 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// api keys of the consumer subset of the kafka protocol
+const (
+	apiFetch           int16 = 1
+	apiListOffsets     int16 = 2
+	apiMetadata        int16 = 3
+	apiOffsetCommit    int16 = 8
+	apiOffsetFetch     int16 = 9
+	apiFindCoordinator int16 = 10
+	apiJoinGroup       int16 = 11
+	apiHeartbeat       int16 = 12
+	apiLeaveGroup      int16 = 13
+	apiSyncGroup       int16 = 14
+	apiApiVersions     int16 = 18
+)
+
+// kafka error codes
+const (
+	errNone                    int16 = 0
+	errUnknownServerError      int16 = -1
+	errUnknownTopicOrPartition int16 = 3
+	errLeaderNotAvailable      int16 = 5
+	errNotLeaderOrFollower     int16 = 6
+	errCoordinatorNotAvailable int16 = 15
+	errIllegalGeneration       int16 = 22
+	errInconsistentProtocol    int16 = 23
+	errUnknownMemberID         int16 = 25
+	errInvalidSessionTimeout   int16 = 26
+	errRebalanceInProgress     int16 = 27
+	errUnsupportedVersion      int16 = 35
+)
+
+// versionRange is the versions of an api, none of them is a flexible version.
+type versionRange struct {
+	key int16
+	min int16
+	max int16
+}
+
+var supportedVersions = []versionRange{
+	{key: apiFetch, min: 4, max: 11},
+	{key: apiListOffsets, min: 1, max: 5},
+	{key: apiMetadata, min: 0, max: 8},
+	{key: apiOffsetCommit, min: 0, max: 7},
+	{key: apiOffsetFetch, min: 1, max: 5},
+	{key: apiFindCoordinator, min: 0, max: 2},
+	{key: apiJoinGroup, min: 0, max: 5},
+	{key: apiHeartbeat, min: 0, max: 3},
+	{key: apiLeaveGroup, min: 0, max: 2},
+	{key: apiSyncGroup, min: 0, max: 3},
+	{key: apiApiVersions, min: 0, max: 2},
+}
+
+func isSupported(key, version int16) bool {
+	for _, v := range supportedVersions {
+		if v.key == key {
+			return version >= v.min && version <= v.max
+		}
+	}
+	return false
+}
+
+var errShortBuffer = errors.New("kafka request too short")
+
+// decoder reads the big-endian primitives of a request, the first error is kept and the reads after it return zero
+// values.
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf)-d.off < n {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.read(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) int16() int16 {
+	b := d.read(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.read(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.read(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	s, _ := d.nullableString()
+	return s
+}
+
+// nullableString returns false if the string is null.
+func (d *decoder) nullableString() (string, bool) {
+	n := d.int16()
+	if n < 0 {
+		return "", false
+	}
+	return string(d.read(int(n))), d.err == nil
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	b := d.read(int(n))
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// arrayLen returns -1 if the array is null, the length is checked against the remaining bytes.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return -1
+	}
+	if int(n) > len(d.buf)-d.off {
+		d.err = errShortBuffer
+		return 0
+	}
+	return int(n)
+}
+
+// requestHeader is the request header v1, the tagged fields of the header v2 are not read since no flexible version
+// is supported.
+type requestHeader struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+}
+
+func readRequestHeader(d *decoder) (*requestHeader, error) {
+	header := &requestHeader{
+		apiKey:        d.int16(),
+		apiVersion:    d.int16(),
+		correlationID: d.int32(),
+	}
+	header.clientID = d.string()
+	if d.err != nil {
+		return nil, fmt.Errorf("read request header error: %w", d.err)
+	}
+	return header, nil
+}
+
+// encoder appends the big-endian primitives of a response.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = append(e.buf, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(v []byte) {
+	if v == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) arrayLen(n int) {
+	e.int32(int32(n))
+}
+
+// putInt32 overwrites the int32 at the offset, it is used for the sizes known after the content is written.
+func (e *encoder) putInt32(offset int, v int32) {
+	binary.BigEndian.PutUint32(e.buf[offset:], uint32(v))
+}
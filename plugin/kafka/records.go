@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type recordHeader struct {
+	key   string
+	value []byte
+}
+
+// record is a kafka record made from a tmq message, the offset is the offset of the message in the vgroup.
+type record struct {
+	offset    int64
+	timestamp int64
+	value     []byte
+	headers   []*recordHeader
+}
+
+// size is the approximate size of the record in a batch.
+func (r *record) size() int {
+	n := 24 + len(r.value)
+	for _, h := range r.headers {
+		n += 10 + len(h.key) + len(h.value)
+	}
+	return n
+}
+
+// encodeRecordBatch encodes the records in one record batch of magic 2. The offsets of the messages of a vgroup are
+// not contiguous, so the records use the offset delta to the first record like a compacted log.
+func encodeRecordBatch(records []*record) []byte {
+	if len(records) == 0 {
+		return nil
+	}
+	first := records[0]
+	last := records[len(records)-1]
+	maxTimestamp := first.timestamp
+	for _, r := range records {
+		if r.timestamp > maxTimestamp {
+			maxTimestamp = r.timestamp
+		}
+	}
+	e := &encoder{}
+	e.int64(first.offset)
+	// batch length
+	e.int32(0)
+	// partition leader epoch
+	e.int32(0)
+	// magic
+	e.int8(2)
+	// crc
+	e.int32(0)
+	crcStart := len(e.buf)
+	// attributes, no compression and not transactional
+	e.int16(0)
+	e.int32(int32(last.offset - first.offset))
+	e.int64(first.timestamp)
+	e.int64(maxTimestamp)
+	// producer id, producer epoch and base sequence
+	e.int64(-1)
+	e.int16(-1)
+	e.int32(-1)
+	e.arrayLen(len(records))
+	body := make([]byte, 0, 64)
+	for _, r := range records {
+		body = body[:0]
+		// attributes
+		body = append(body, 0)
+		body = appendVarint(body, r.timestamp-first.timestamp)
+		body = appendVarint(body, r.offset-first.offset)
+		// null key
+		body = appendVarint(body, -1)
+		body = appendVarint(body, int64(len(r.value)))
+		body = append(body, r.value...)
+		body = appendVarint(body, int64(len(r.headers)))
+		for _, h := range r.headers {
+			body = appendVarint(body, int64(len(h.key)))
+			body = append(body, h.key...)
+			body = appendVarint(body, int64(len(h.value)))
+			body = append(body, h.value...)
+		}
+		e.buf = appendVarint(e.buf, int64(len(body)))
+		e.buf = append(e.buf, body...)
+	}
+	e.putInt32(8, int32(len(e.buf)-12))
+	e.putInt32(crcStart-4, int32(crc32.Checksum(e.buf[crcStart:], castagnoli)))
+	return e.buf
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
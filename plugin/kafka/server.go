@@ -0,0 +1,999 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+)
+
+const (
+	// nodeID is the broker id of taosAdapter, it is the leader of all the partitions and the coordinator of all the
+	// groups.
+	nodeID    int32 = 0
+	clusterID       = "taosadapter"
+	// maxRequestSize limits the size of a request frame
+	maxRequestSize = 100 * 1024 * 1024
+	// unknownOperations is the authorized operations not computed
+	unknownOperations int32 = -2147483648
+	// minPollBlockingTime is the min blocking time of each poll while waiting for the fetch max wait
+	minPollBlockingTime = 10 * time.Millisecond
+)
+
+type server struct {
+	conf        *Config
+	listener    *net.TCPListener
+	port        int
+	coordinator *coordinator
+	catalog     catalog
+	topics      *topicCache
+	groups      *groupConsumers
+	started     time.Time
+	id          uint64
+	accept      chan bool
+	lock        sync.Mutex
+	conns       map[uint64]*connection
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func newServer(conf *Config, catalog catalog) *server {
+	s := &server{
+		conf:        conf,
+		coordinator: newCoordinator(),
+		catalog:     catalog,
+		topics:      &topicCache{catalog: catalog},
+		groups:      newGroupConsumers(conf),
+		started:     time.Now(),
+		accept:      make(chan bool, conf.MaxConnections),
+		conns:       map[uint64]*connection{},
+		done:        make(chan struct{}),
+	}
+	for i := 0; i < conf.MaxConnections; i++ {
+		s.accept <- true
+	}
+	return s
+}
+
+func (s *server) start(port int) error {
+	address, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	s.listener, err = net.ListenTCP("tcp4", address)
+	if err != nil {
+		return err
+	}
+	s.port = s.listener.Addr().(*net.TCPAddr).Port
+	logger.Infof("kafka TCP listening on %q", s.listener.Addr().String())
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		if err := s.serve(); err != nil {
+			logger.WithError(err).Error("kafka listener error")
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.run()
+	}()
+	return nil
+}
+
+// run expires the group members and closes the idle group consumers.
+func (s *server) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.coordinator.expire(now)
+			s.groups.closeIdle(now)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *server) serve() error {
+	for {
+		conn, err := s.listener.AcceptTCP()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+		_, valid, poolExists := commonpool.VerifyClientIP(s.conf.User, s.conf.Password, clientIP)
+		if poolExists && !valid {
+			logger.WithField("user", s.conf.User).WithField("clientIP", clientIP.String()).Error("forbidden clientIP")
+			_ = conn.Close()
+			continue
+		}
+		select {
+		case <-s.accept:
+			s.wg.Add(1)
+			id := atomic.AddUint64(&s.id, 1)
+			c := &connection{
+				s:         s,
+				conn:      conn,
+				id:        id,
+				clientIP:  clientIP,
+				groupID:   fmt.Sprintf("kafka_%x_%d", s.started.UnixNano(), id),
+				consumers: map[string]*topicConsumer{},
+			}
+			s.lock.Lock()
+			s.conns[id] = c
+			s.lock.Unlock()
+			go c.handle()
+		default:
+			_ = conn.Close()
+			logger.Infof("Refused TCP Connection from %s", conn.RemoteAddr())
+			logger.Warn("Maximum TCP Connections reached")
+		}
+	}
+}
+
+func (s *server) stop() error {
+	close(s.done)
+	s.coordinator.stop()
+	err := s.listener.Close()
+	s.lock.Lock()
+	conns := make([]*connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.lock.Unlock()
+	for _, c := range conns {
+		_ = c.conn.Close()
+	}
+	s.wg.Wait()
+	s.groups.closeAll()
+	return err
+}
+
+// connection handles the requests of a client one by one in order. The fetch requests of the connection are served
+// by the tmq consumers of the connection with an unique tmq group, the consumers are closed and the groups are
+// dropped when the connection is closed.
+type connection struct {
+	s         *server
+	conn      *net.TCPConn
+	id        uint64
+	clientIP  net.IP
+	groupID   string
+	consumers map[string]*topicConsumer
+}
+
+func (c *connection) handle() {
+	defer func() {
+		_ = c.conn.Close()
+		c.closeConsumers()
+		c.s.lock.Lock()
+		delete(c.s.conns, c.id)
+		c.s.lock.Unlock()
+		c.s.accept <- true
+		c.s.wg.Done()
+	}()
+	if err := c.serve(); err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+		logger.WithError(err).Errorf("kafka connection from %s error", c.clientIP)
+	}
+}
+
+func (c *connection) serve() error {
+	reader := bufio.NewReader(c.conn)
+	sizeBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, sizeBuf); err != nil {
+			return err
+		}
+		size := binary.BigEndian.Uint32(sizeBuf)
+		if size > maxRequestSize {
+			return fmt.Errorf("request size %d exceeds %d", size, maxRequestSize)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return err
+		}
+		d := &decoder{buf: data}
+		header, err := readRequestHeader(d)
+		if err != nil {
+			return err
+		}
+		e := &encoder{buf: make([]byte, 8, 64)}
+		if err = c.handleRequest(header, d, e); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+		binary.BigEndian.PutUint32(e.buf[4:], uint32(header.correlationID))
+		if _, err = c.conn.Write(e.buf); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *connection) handleRequest(header *requestHeader, d *decoder, e *encoder) error {
+	if !isSupported(header.apiKey, header.apiVersion) {
+		if header.apiKey == apiApiVersions {
+			// the client sends ApiVersions again with a supported version
+			c.writeApiVersions(0, errUnsupportedVersion, e)
+			return nil
+		}
+		return fmt.Errorf("unsupported api key %d version %d", header.apiKey, header.apiVersion)
+	}
+	version := header.apiVersion
+	var err error
+	switch header.apiKey {
+	case apiApiVersions:
+		c.writeApiVersions(version, errNone, e)
+	case apiMetadata:
+		err = c.metadata(version, d, e)
+	case apiFindCoordinator:
+		err = c.findCoordinator(version, d, e)
+	case apiJoinGroup:
+		err = c.joinGroup(header, d, e)
+	case apiSyncGroup:
+		err = c.syncGroup(version, d, e)
+	case apiHeartbeat:
+		err = c.heartbeat(version, d, e)
+	case apiLeaveGroup:
+		err = c.leaveGroup(version, d, e)
+	case apiListOffsets:
+		err = c.listOffsets(header, d, e)
+	case apiFetch:
+		err = c.fetch(header, d, e)
+	case apiOffsetCommit:
+		err = c.offsetCommit(header, d, e)
+	case apiOffsetFetch:
+		err = c.offsetFetch(header, d, e)
+	}
+	if err != nil {
+		return fmt.Errorf("api key %d version %d error: %w", header.apiKey, header.apiVersion, err)
+	}
+	return nil
+}
+
+func (c *connection) host() string {
+	if len(c.s.conf.AdvertisedHost) != 0 {
+		return c.s.conf.AdvertisedHost
+	}
+	return c.conn.LocalAddr().(*net.TCPAddr).IP.String()
+}
+
+func (c *connection) writeApiVersions(version int16, errorCode int16, e *encoder) {
+	e.int16(errorCode)
+	e.arrayLen(len(supportedVersions))
+	for _, v := range supportedVersions {
+		e.int16(v.key)
+		e.int16(v.min)
+		e.int16(v.max)
+	}
+	if version >= 1 {
+		e.int32(0)
+	}
+}
+
+func (c *connection) metadata(version int16, d *decoder, e *encoder) error {
+	n := d.arrayLen()
+	all := n < 0 || (version == 0 && n == 0)
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, d.string())
+	}
+	if version >= 4 {
+		// allow auto topic creation
+		d.bool()
+	}
+	if version >= 8 {
+		// include cluster and topic authorized operations
+		d.bool()
+		d.bool()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	topics, err := c.s.topics.get()
+	if err != nil {
+		logger.WithError(err).Error("get tmq topics error")
+	}
+	if all {
+		for name := range topics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if version >= 3 {
+		e.int32(0)
+	}
+	e.arrayLen(1)
+	e.int32(nodeID)
+	e.string(c.host())
+	e.int32(int32(c.s.port))
+	if version >= 1 {
+		// rack
+		e.nullString()
+	}
+	if version >= 2 {
+		e.string(clusterID)
+	}
+	if version >= 1 {
+		// controller id
+		e.int32(nodeID)
+	}
+	e.arrayLen(len(names))
+	for _, name := range names {
+		topic := topics[name]
+		switch {
+		case err != nil:
+			e.int16(errLeaderNotAvailable)
+		case topic == nil:
+			e.int16(errUnknownTopicOrPartition)
+		default:
+			e.int16(errNone)
+		}
+		e.string(name)
+		if version >= 1 {
+			// is internal
+			e.bool(false)
+		}
+		if topic == nil {
+			e.arrayLen(0)
+		} else {
+			e.arrayLen(len(topic.vgroups))
+			for i := range topic.vgroups {
+				e.int16(errNone)
+				e.int32(int32(i))
+				e.int32(nodeID)
+				if version >= 7 {
+					// leader epoch
+					e.int32(0)
+				}
+				// replicas and in-sync replicas
+				e.arrayLen(1)
+				e.int32(nodeID)
+				e.arrayLen(1)
+				e.int32(nodeID)
+				if version >= 5 {
+					// offline replicas
+					e.arrayLen(0)
+				}
+			}
+		}
+		if version >= 8 {
+			e.int32(unknownOperations)
+		}
+	}
+	if version >= 8 {
+		e.int32(unknownOperations)
+	}
+	return nil
+}
+
+func (c *connection) findCoordinator(version int16, d *decoder, e *encoder) error {
+	d.string()
+	keyType := int8(0)
+	if version >= 1 {
+		keyType = d.int8()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if version >= 1 {
+		e.int32(0)
+	}
+	// only the group coordinator is supported, not the transaction coordinator
+	if keyType != 0 {
+		e.int16(errCoordinatorNotAvailable)
+	} else {
+		e.int16(errNone)
+	}
+	if version >= 1 {
+		e.nullString()
+	}
+	e.int32(nodeID)
+	e.string(c.host())
+	e.int32(int32(c.s.port))
+	return nil
+}
+
+func (c *connection) joinGroup(header *requestHeader, d *decoder, e *encoder) error {
+	version := header.apiVersion
+	req := &joinRequest{
+		clientID:   header.clientID,
+		clientHost: "/" + c.clientIP.String(),
+	}
+	req.groupID = d.string()
+	req.sessionTimeout = time.Duration(d.int32()) * time.Millisecond
+	req.rebalanceTimeout = req.sessionTimeout
+	if version >= 1 {
+		req.rebalanceTimeout = time.Duration(d.int32()) * time.Millisecond
+	}
+	req.memberID = d.string()
+	if version >= 5 {
+		// group instance id, static membership is not supported
+		d.nullableString()
+	}
+	req.protocolType = d.string()
+	n := d.arrayLen()
+	for i := 0; i < n; i++ {
+		req.protocols = append(req.protocols, &protocol{name: d.string(), metadata: d.bytes()})
+	}
+	if d.err != nil {
+		return d.err
+	}
+	result := c.s.coordinator.join(req)
+	if version >= 2 {
+		e.int32(0)
+	}
+	e.int16(result.errorCode)
+	e.int32(result.generation)
+	e.string(result.protocol)
+	e.string(result.leader)
+	e.string(result.memberID)
+	e.arrayLen(len(result.members))
+	for _, m := range result.members {
+		e.string(m.id)
+		if version >= 5 {
+			e.nullString()
+		}
+		e.bytes(nonNull(m.metadata))
+	}
+	return nil
+}
+
+func (c *connection) syncGroup(version int16, d *decoder, e *encoder) error {
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	if version >= 3 {
+		d.nullableString()
+	}
+	n := d.arrayLen()
+	assignments := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		id := d.string()
+		assignments[id] = d.bytes()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	result := c.s.coordinator.sync(groupID, memberID, generation, assignments)
+	if version >= 1 {
+		e.int32(0)
+	}
+	e.int16(result.errorCode)
+	e.bytes(nonNull(result.assignment))
+	return nil
+}
+
+func (c *connection) heartbeat(version int16, d *decoder, e *encoder) error {
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	if version >= 3 {
+		d.nullableString()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if version >= 1 {
+		e.int32(0)
+	}
+	e.int16(c.s.coordinator.heartbeat(groupID, memberID, generation))
+	return nil
+}
+
+func (c *connection) leaveGroup(version int16, d *decoder, e *encoder) error {
+	groupID := d.string()
+	memberID := d.string()
+	if d.err != nil {
+		return d.err
+	}
+	if version >= 1 {
+		e.int32(0)
+	}
+	e.int16(c.s.coordinator.leave(groupID, memberID))
+	return nil
+}
+
+// consumer returns the consumer of the connection for the topic.
+func (c *connection) consumer(clientID, topic string) (*topicConsumer, error) {
+	if t, exists := c.consumers[topic]; exists {
+		return t, nil
+	}
+	t, err := openTopicConsumer(c.s.conf, c.groupID, clientID, topic, c.clientIP)
+	if err != nil {
+		return nil, err
+	}
+	c.consumers[topic] = t
+	return t, nil
+}
+
+// removeConsumer closes the consumer after an error, the next request opens a new one.
+func (c *connection) removeConsumer(t *topicConsumer) {
+	if c.consumers[t.topic] == t {
+		delete(c.consumers, t.topic)
+	}
+	t.close()
+}
+
+func (c *connection) closeConsumers() {
+	for topic, t := range c.consumers {
+		t.close()
+		if err := c.s.catalog.dropGroup(c.groupID, topic); err != nil {
+			t.logger.WithError(err).Warn("drop tmq consumer group error")
+		}
+	}
+	c.consumers = nil
+}
+
+// partition resolves the vgroup of the partition of the topic.
+func (c *connection) partition(name string, partition int32) (*topicMeta, int32, int16) {
+	topic, err := c.s.topics.topic(name)
+	if err != nil {
+		logger.WithError(err).Error("get tmq topics error")
+		return nil, 0, errLeaderNotAvailable
+	}
+	if topic == nil {
+		return nil, 0, errUnknownTopicOrPartition
+	}
+	vgroupID, ok := topic.vgroup(partition)
+	if !ok {
+		return nil, 0, errUnknownTopicOrPartition
+	}
+	return topic, vgroupID, errNone
+}
+
+func (c *connection) listOffsets(header *requestHeader, d *decoder, e *encoder) error {
+	version := header.apiVersion
+	// replica id
+	d.int32()
+	if version >= 2 {
+		// isolation level
+		d.int8()
+	}
+	type listOffsetsPartition struct {
+		index     int32
+		timestamp int64
+	}
+	type listOffsetsTopic struct {
+		name       string
+		partitions []*listOffsetsPartition
+	}
+	n := d.arrayLen()
+	topics := make([]*listOffsetsTopic, 0, n)
+	for i := 0; i < n; i++ {
+		topic := &listOffsetsTopic{name: d.string()}
+		m := d.arrayLen()
+		for j := 0; j < m; j++ {
+			p := &listOffsetsPartition{index: d.int32()}
+			if version >= 4 {
+				// current leader epoch
+				d.int32()
+			}
+			p.timestamp = d.int64()
+			topic.partitions = append(topic.partitions, p)
+		}
+		topics = append(topics, topic)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if version >= 2 {
+		e.int32(0)
+	}
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic.name)
+		e.arrayLen(len(topic.partitions))
+		for _, p := range topic.partitions {
+			offset := int64(-1)
+			_, vgroupID, errorCode := c.partition(topic.name, p.index)
+			if errorCode == errNone && (p.timestamp == -1 || p.timestamp == -2) {
+				begin, end, err := c.watermarks(header.clientID, topic.name, vgroupID)
+				if err != nil {
+					errorCode = errNotLeaderOrFollower
+				} else if p.timestamp == -2 {
+					offset = begin
+				} else {
+					offset = end
+				}
+			}
+			// the offsets of timestamps are not supported and not found
+			e.int32(p.index)
+			e.int16(errorCode)
+			e.int64(-1)
+			e.int64(offset)
+			if version >= 4 {
+				e.int32(0)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *connection) watermarks(clientID, topic string, vgroupID int32) (int64, int64, error) {
+	t, err := c.consumer(clientID, topic)
+	if err != nil {
+		logger.WithError(err).Errorf("open tmq consumer of topic %s error", topic)
+		return 0, 0, err
+	}
+	begin, end, err := t.watermarks(vgroupID)
+	if err != nil {
+		t.logger.WithError(err).Errorf("get assignment of vgroup %d error", vgroupID)
+		if err != errVgroupNotAssigned {
+			c.removeConsumer(t)
+		}
+		return 0, 0, err
+	}
+	return begin, end, nil
+}
+
+type fetchPartition struct {
+	index         int32
+	offset        int64
+	maxBytes      int32
+	errorCode     int16
+	vgroupID      int32
+	consumer      *topicConsumer
+	records       []*record
+	highWatermark int64
+	logStart      int64
+}
+
+type fetchTopic struct {
+	name       string
+	partitions []*fetchPartition
+}
+
+// fetch reads the records buffered of the partitions and polls the consumers until min bytes are read or the max
+// wait expires.
+func (c *connection) fetch(header *requestHeader, d *decoder, e *encoder) error {
+	version := header.apiVersion
+	// replica id
+	d.int32()
+	maxWait := time.Duration(d.int32()) * time.Millisecond
+	minBytes := int(d.int32())
+	maxBytes := int(d.int32())
+	// isolation level
+	d.int8()
+	if version >= 7 {
+		// session id and epoch, fetch sessions are not supported so every fetch is a full fetch
+		d.int32()
+		d.int32()
+	}
+	n := d.arrayLen()
+	topics := make([]*fetchTopic, 0, n)
+	for i := 0; i < n; i++ {
+		topic := &fetchTopic{name: d.string()}
+		m := d.arrayLen()
+		for j := 0; j < m; j++ {
+			p := &fetchPartition{index: d.int32()}
+			if version >= 9 {
+				// current leader epoch
+				d.int32()
+			}
+			p.offset = d.int64()
+			if version >= 5 {
+				// log start offset
+				d.int64()
+			}
+			p.maxBytes = d.int32()
+			topic.partitions = append(topic.partitions, p)
+		}
+		topics = append(topics, topic)
+	}
+	if version >= 7 {
+		// forgotten topics
+		m := d.arrayLen()
+		for i := 0; i < m; i++ {
+			d.string()
+			k := d.arrayLen()
+			for j := 0; j < k; j++ {
+				d.int32()
+			}
+		}
+	}
+	if version >= 11 {
+		// rack id
+		d.string()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	deadline := time.Now().Add(maxWait)
+	var consumers []*topicConsumer
+	for _, topic := range topics {
+		for _, p := range topic.partitions {
+			_, p.vgroupID, p.errorCode = c.partition(topic.name, p.index)
+			if p.errorCode != errNone {
+				continue
+			}
+			t, err := c.consumer(header.clientID, topic.name)
+			if err != nil {
+				logger.WithError(err).Errorf("open tmq consumer of topic %s error", topic.name)
+				p.errorCode = errLeaderNotAvailable
+				continue
+			}
+			p.consumer = t
+			if !containsConsumer(consumers, t) {
+				consumers = append(consumers, t)
+			}
+		}
+	}
+	for {
+		size := 0
+		for _, topic := range topics {
+			for _, p := range topic.partitions {
+				if p.consumer == nil || p.errorCode != errNone {
+					continue
+				}
+				if len(p.records) != 0 {
+					size += recordsSize(p.records)
+					continue
+				}
+				limit := int(p.maxBytes)
+				if maxBytes-size < limit {
+					limit = maxBytes - size
+				}
+				records, err := p.consumer.read(p.vgroupID, p.offset, limit, size == 0)
+				if err != nil {
+					p.consumer.logger.WithError(err).Errorf("seek vgroup %d to %d error", p.vgroupID, p.offset)
+					p.errorCode = errNotLeaderOrFollower
+					continue
+				}
+				p.records = records
+				size += recordsSize(records)
+			}
+		}
+		remaining := time.Until(deadline)
+		if (size > 0 && size >= minBytes) || minBytes <= 0 || remaining <= 0 || len(consumers) == 0 {
+			break
+		}
+		blockingTime := remaining / time.Duration(len(consumers))
+		if blockingTime < minPollBlockingTime {
+			blockingTime = minPollBlockingTime
+		}
+		for i := 0; i < len(consumers); i++ {
+			t := consumers[i]
+			if err := t.poll(blockingTime); err != nil {
+				t.logger.WithError(err).Error("poll tmq message error")
+				c.removeConsumer(t)
+				consumers = append(consumers[:i], consumers[i+1:]...)
+				i--
+				for _, topic := range topics {
+					for _, p := range topic.partitions {
+						if p.consumer == t {
+							p.consumer = nil
+							p.errorCode = errNotLeaderOrFollower
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, topic := range topics {
+		for _, p := range topic.partitions {
+			if p.consumer == nil || p.errorCode != errNone {
+				continue
+			}
+			begin, end, err := p.consumer.watermarks(p.vgroupID)
+			if err != nil {
+				p.consumer.logger.WithError(err).Errorf("get assignment of vgroup %d error", p.vgroupID)
+			}
+			p.logStart = begin
+			p.highWatermark = end
+			if len(p.records) != 0 {
+				if next := p.records[len(p.records)-1].offset + 1; next > p.highWatermark {
+					p.highWatermark = next
+				}
+			} else if p.offset > p.highWatermark {
+				p.highWatermark = p.offset
+			}
+		}
+	}
+	c.writeFetch(version, topics, e)
+	return nil
+}
+
+func (c *connection) writeFetch(version int16, topics []*fetchTopic, e *encoder) {
+	e.int32(0)
+	if version >= 7 {
+		// error code and session id
+		e.int16(errNone)
+		e.int32(0)
+	}
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic.name)
+		e.arrayLen(len(topic.partitions))
+		for _, p := range topic.partitions {
+			e.int32(p.index)
+			e.int16(p.errorCode)
+			e.int64(p.highWatermark)
+			// last stable offset
+			e.int64(p.highWatermark)
+			if version >= 5 {
+				e.int64(p.logStart)
+			}
+			// aborted transactions
+			e.arrayLen(0)
+			if version >= 11 {
+				// preferred read replica
+				e.int32(-1)
+			}
+			e.bytes(nonNull(encodeRecordBatch(p.records)))
+		}
+	}
+}
+
+func containsConsumer(consumers []*topicConsumer, t *topicConsumer) bool {
+	for _, consumer := range consumers {
+		if consumer == t {
+			return true
+		}
+	}
+	return false
+}
+
+func recordsSize(records []*record) int {
+	size := 0
+	for _, r := range records {
+		size += r.size()
+	}
+	return size
+}
+
+func (c *connection) offsetCommit(header *requestHeader, d *decoder, e *encoder) error {
+	version := header.apiVersion
+	groupID := d.string()
+	generation := int32(-1)
+	memberID := ""
+	if version >= 1 {
+		generation = d.int32()
+		memberID = d.string()
+	}
+	if version >= 7 {
+		d.nullableString()
+	}
+	if version >= 2 && version <= 4 {
+		// retention time
+		d.int64()
+	}
+	type commitPartition struct {
+		index  int32
+		offset int64
+	}
+	type commitTopic struct {
+		name       string
+		partitions []*commitPartition
+	}
+	n := d.arrayLen()
+	topics := make([]*commitTopic, 0, n)
+	for i := 0; i < n; i++ {
+		topic := &commitTopic{name: d.string()}
+		m := d.arrayLen()
+		for j := 0; j < m; j++ {
+			p := &commitPartition{index: d.int32(), offset: d.int64()}
+			if version == 1 {
+				// commit timestamp
+				d.int64()
+			}
+			if version >= 6 {
+				// committed leader epoch
+				d.int32()
+			}
+			// committed metadata
+			d.nullableString()
+			topic.partitions = append(topic.partitions, p)
+		}
+		topics = append(topics, topic)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	groupError := c.s.coordinator.validate(groupID, memberID, generation)
+	if version >= 3 {
+		e.int32(0)
+	}
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic.name)
+		e.arrayLen(len(topic.partitions))
+		for _, p := range topic.partitions {
+			errorCode := groupError
+			if errorCode == errNone {
+				var vgroupID int32
+				_, vgroupID, errorCode = c.partition(topic.name, p.index)
+				if errorCode == errNone {
+					err := c.s.groups.do(groupID, header.clientID, topic.name, c.clientIP, func(t *topicConsumer) error {
+						return t.commit(vgroupID, p.offset)
+					})
+					if err != nil {
+						logger.WithError(err).Errorf("commit offset %d of vgroup %d of topic %s for group %s error", p.offset, vgroupID, topic.name, groupID)
+						errorCode = errUnknownServerError
+					}
+				}
+			}
+			e.int32(p.index)
+			e.int16(errorCode)
+		}
+	}
+	return nil
+}
+
+func (c *connection) offsetFetch(header *requestHeader, d *decoder, e *encoder) error {
+	version := header.apiVersion
+	groupID := d.string()
+	type offsetFetchTopic struct {
+		name       string
+		partitions []int32
+	}
+	// the offsets of all the topics are requested with null topics, they are not kept so none is returned
+	n := d.arrayLen()
+	topics := make([]*offsetFetchTopic, 0)
+	for i := 0; i < n; i++ {
+		topic := &offsetFetchTopic{name: d.string()}
+		m := d.arrayLen()
+		for j := 0; j < m; j++ {
+			topic.partitions = append(topic.partitions, d.int32())
+		}
+		topics = append(topics, topic)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if version >= 3 {
+		e.int32(0)
+	}
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic.name)
+		e.arrayLen(len(topic.partitions))
+		for _, index := range topic.partitions {
+			offset := int64(-1)
+			_, vgroupID, errorCode := c.partition(topic.name, index)
+			if errorCode == errNone {
+				err := c.s.groups.do(groupID, header.clientID, topic.name, c.clientIP, func(t *topicConsumer) error {
+					var err error
+					offset, err = t.committed(vgroupID)
+					return err
+				})
+				if err != nil {
+					logger.WithError(err).Errorf("get committed offset of vgroup %d of topic %s for group %s error", vgroupID, topic.name, groupID)
+					errorCode = errUnknownServerError
+				}
+			}
+			e.int32(index)
+			e.int64(offset)
+			if version >= 5 {
+				// committed leader epoch
+				e.int32(-1)
+			}
+			// metadata
+			e.string("")
+			e.int16(errorCode)
+		}
+	}
+	if version >= 2 {
+		e.int16(errNone)
+	}
+	return nil
+}
+
+func nonNull(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
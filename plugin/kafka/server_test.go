@@ -0,0 +1,668 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqhandle"
+)
+
+type fakeCatalog struct {
+	lock    sync.Mutex
+	dropped []string
+}
+
+func (c *fakeCatalog) topics() (map[string]*topicMeta, error) {
+	return map[string]*topicMeta{
+		"t1": {name: "t1", database: "db1", vgroups: []int32{2, 3}},
+	}, nil
+}
+
+func (c *fakeCatalog) dropGroup(groupID, topic string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dropped = append(c.dropped, groupID+"/"+topic)
+	return nil
+}
+
+// fakeConsumer delivers the messages of each vgroup from the position, the offsets of a vgroup step by 10.
+type fakeConsumer struct {
+	lock      sync.Mutex
+	conf      *tmqconsumer.Config
+	end       map[int32]int64
+	position  map[int32]int64
+	committed map[int32]int64
+	closed    bool
+}
+
+var (
+	fakeLock      sync.Mutex
+	fakeCommitted = map[string]map[int32]int64{}
+)
+
+func newFakeConsumer(conf *tmqconsumer.Config, _ *logrus.Entry) (tmqConsumer, error) {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	committed := fakeCommitted[conf.GroupID]
+	if committed == nil {
+		committed = map[int32]int64{}
+		fakeCommitted[conf.GroupID] = committed
+	}
+	return &fakeConsumer{
+		conf:      conf,
+		end:       map[int32]int64{2: 50, 3: 100},
+		position:  map[int32]int64{},
+		committed: committed,
+	}, nil
+}
+
+func (c *fakeConsumer) Poll(blockingTime time.Duration, _ *time.Location) (*tmqconsumer.Message, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, vgroupID := range []int32{2, 3} {
+		position, exists := c.position[vgroupID]
+		offset := (position + 9) / 10 * 10
+		if !exists || offset >= c.end[vgroupID] {
+			continue
+		}
+		c.position[vgroupID] = offset + 1
+		return &tmqconsumer.Message{
+			Topic:    "t1",
+			Database: "db1",
+			VgroupID: vgroupID,
+			Offset:   offset,
+			Blocks: []*tmqconsumer.Block{{
+				TableName: "d0",
+				Rows:      [][]byte{[]byte(fmt.Sprintf(`{"v":%d}`, offset))},
+			}},
+		}, nil
+	}
+	time.Sleep(blockingTime)
+	return nil, nil
+}
+
+func (c *fakeConsumer) Assignment(_ string) ([]*tmqhandle.Assignment, error) {
+	return []*tmqhandle.Assignment{
+		{VGroupID: 2, Begin: 0, End: c.end[2]},
+		{VGroupID: 3, Begin: 0, End: c.end[3]},
+	}, nil
+}
+
+func (c *fakeConsumer) Seek(_ string, vgroupID int32, offset int64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.position[vgroupID] = offset
+	return nil
+}
+
+func (c *fakeConsumer) CommitOffset(_ string, vgroupID int32, offset int64) error {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	c.committed[vgroupID] = offset
+	return nil
+}
+
+func (c *fakeConsumer) Committed(_ string, vgroupID int32) (int64, error) {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	offset, exists := c.committed[vgroupID]
+	if !exists {
+		return tmqconsumer.OffsetInvalid, nil
+	}
+	return offset, nil
+}
+
+func (c *fakeConsumer) Close() {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	c.closed = true
+}
+
+type client struct {
+	t             *testing.T
+	conn          net.Conn
+	clientID      string
+	correlationID int32
+}
+
+func newClient(t *testing.T, port int, clientID string) *client {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	require.NoError(t, err)
+	return &client{t: t, conn: conn, clientID: clientID}
+}
+
+// request sends the request and returns the response body after the correlation id.
+func (c *client) request(apiKey, version int16, body func(e *encoder)) *decoder {
+	c.correlationID++
+	e := &encoder{}
+	e.int32(0)
+	e.int16(apiKey)
+	e.int16(version)
+	e.int32(c.correlationID)
+	e.string(c.clientID)
+	body(e)
+	e.putInt32(0, int32(len(e.buf)-4))
+	_, err := c.conn.Write(e.buf)
+	require.NoError(c.t, err)
+	size := make([]byte, 4)
+	_, err = io.ReadFull(c.conn, size)
+	require.NoError(c.t, err)
+	data := make([]byte, binary.BigEndian.Uint32(size))
+	_, err = io.ReadFull(c.conn, data)
+	require.NoError(c.t, err)
+	d := &decoder{buf: data}
+	require.Equal(c.t, c.correlationID, d.int32())
+	return d
+}
+
+type decodedRecord struct {
+	offset  int64
+	value   []byte
+	headers map[string][]byte
+}
+
+func readVarint(t *testing.T, b []byte, off *int) int64 {
+	v, n := binary.Varint(b[*off:])
+	require.Greater(t, n, 0)
+	*off += n
+	return v
+}
+
+// decodeRecordBatch decodes the record batch and checks the length and the crc.
+func decodeRecordBatch(t *testing.T, b []byte) []*decodedRecord {
+	if len(b) == 0 {
+		return nil
+	}
+	d := &decoder{buf: b}
+	baseOffset := d.int64()
+	length := d.int32()
+	require.Equal(t, len(b)-12, int(length))
+	d.int32()
+	require.Equal(t, int8(2), d.int8())
+	crc := uint32(d.int32())
+	assert.Equal(t, crc32.Checksum(b[d.off:], castagnoli), crc)
+	d.int16()
+	lastOffsetDelta := d.int32()
+	d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	count := int(d.int32())
+	require.NoError(t, d.err)
+	off := d.off
+	var records []*decodedRecord
+	for i := 0; i < count; i++ {
+		size := readVarint(t, b, &off)
+		end := off + int(size)
+		off++
+		readVarint(t, b, &off)
+		r := &decodedRecord{offset: baseOffset + readVarint(t, b, &off), headers: map[string][]byte{}}
+		assert.Equal(t, int64(-1), readVarint(t, b, &off))
+		n := int(readVarint(t, b, &off))
+		r.value = b[off : off+n]
+		off += n
+		headers := int(readVarint(t, b, &off))
+		for j := 0; j < headers; j++ {
+			n = int(readVarint(t, b, &off))
+			key := string(b[off : off+n])
+			off += n
+			n = int(readVarint(t, b, &off))
+			r.headers[key] = b[off : off+n]
+			off += n
+		}
+		require.Equal(t, end, off)
+		records = append(records, r)
+	}
+	require.Equal(t, len(b), off)
+	require.Equal(t, baseOffset+int64(lastOffsetDelta), records[len(records)-1].offset)
+	return records
+}
+
+func startTestServer(t *testing.T) (*server, *fakeCatalog) {
+	newConsumer = newFakeConsumer
+	fakeLock.Lock()
+	fakeCommitted = map[string]map[int32]int64{}
+	fakeLock.Unlock()
+	catalog := &fakeCatalog{}
+	conf := &Config{
+		ValueFormat:         ValueFormatJSON,
+		MaxConnections:      10,
+		IdleTimeout:         time.Minute,
+		MaxBufferedMessages: 10,
+	}
+	s := newServer(conf, catalog)
+	require.NoError(t, s.start(0))
+	return s, catalog
+}
+
+func TestApiVersionsAndMetadata(t *testing.T) {
+	s, _ := startTestServer(t)
+	defer func() {
+		assert.NoError(t, s.stop())
+	}()
+	c := newClient(t, s.port, "test")
+	defer func() {
+		_ = c.conn.Close()
+	}()
+	// unsupported version is answered in version 0
+	d := c.request(apiApiVersions, 3, func(e *encoder) {})
+	assert.Equal(t, errUnsupportedVersion, d.int16())
+	assert.Equal(t, len(supportedVersions), d.arrayLen())
+
+	d = c.request(apiApiVersions, 2, func(e *encoder) {})
+	assert.Equal(t, errNone, d.int16())
+	n := d.arrayLen()
+	versions := map[int16][2]int16{}
+	for i := 0; i < n; i++ {
+		versions[d.int16()] = [2]int16{d.int16(), d.int16()}
+	}
+	assert.Equal(t, int32(0), d.int32())
+	require.NoError(t, d.err)
+	assert.Equal(t, [2]int16{4, 11}, versions[apiFetch])
+
+	d = c.request(apiMetadata, 8, func(e *encoder) {
+		e.arrayLen(2)
+		e.string("t1")
+		e.string("t2")
+		e.bool(false)
+		e.bool(false)
+		e.bool(false)
+	})
+	d.int32()
+	require.Equal(t, 1, d.arrayLen())
+	assert.Equal(t, nodeID, d.int32())
+	assert.Equal(t, "127.0.0.1", d.string())
+	assert.Equal(t, int32(s.port), d.int32())
+	d.nullableString()
+	assert.Equal(t, clusterID, d.string())
+	assert.Equal(t, nodeID, d.int32())
+	require.Equal(t, 2, d.arrayLen())
+	assert.Equal(t, errNone, d.int16())
+	assert.Equal(t, "t1", d.string())
+	assert.False(t, d.bool())
+	require.Equal(t, 2, d.arrayLen())
+	for i := int32(0); i < 2; i++ {
+		assert.Equal(t, errNone, d.int16())
+		assert.Equal(t, i, d.int32())
+		assert.Equal(t, nodeID, d.int32())
+		d.int32()
+		assert.Equal(t, 1, d.arrayLen())
+		d.int32()
+		assert.Equal(t, 1, d.arrayLen())
+		d.int32()
+		assert.Equal(t, 0, d.arrayLen())
+	}
+	d.int32()
+	assert.Equal(t, errUnknownTopicOrPartition, d.int16())
+	assert.Equal(t, "t2", d.string())
+	d.bool()
+	assert.Equal(t, 0, d.arrayLen())
+	d.int32()
+	d.int32()
+	require.NoError(t, d.err)
+	assert.Equal(t, len(d.buf), d.off)
+
+	d = c.request(apiFindCoordinator, 2, func(e *encoder) {
+		e.string("g1")
+		e.int8(0)
+	})
+	d.int32()
+	assert.Equal(t, errNone, d.int16())
+	d.nullableString()
+	assert.Equal(t, nodeID, d.int32())
+	assert.Equal(t, "127.0.0.1", d.string())
+	assert.Equal(t, int32(s.port), d.int32())
+	require.NoError(t, d.err)
+}
+
+func TestFetch(t *testing.T) {
+	s, catalog := startTestServer(t)
+	defer func() {
+		assert.NoError(t, s.stop())
+	}()
+	c := newClient(t, s.port, "test")
+
+	listOffsets := func(timestamp int64) int64 {
+		d := c.request(apiListOffsets, 5, func(e *encoder) {
+			e.int32(-1)
+			e.int8(0)
+			e.arrayLen(1)
+			e.string("t1")
+			e.arrayLen(1)
+			e.int32(1)
+			e.int32(-1)
+			e.int64(timestamp)
+		})
+		d.int32()
+		require.Equal(t, 1, d.arrayLen())
+		assert.Equal(t, "t1", d.string())
+		require.Equal(t, 1, d.arrayLen())
+		assert.Equal(t, int32(1), d.int32())
+		assert.Equal(t, errNone, d.int16())
+		d.int64()
+		offset := d.int64()
+		d.int32()
+		require.NoError(t, d.err)
+		return offset
+	}
+	assert.Equal(t, int64(0), listOffsets(-2))
+	assert.Equal(t, int64(100), listOffsets(-1))
+
+	fetch := func(offset int64, maxBytes int32) (int16, int64, []*decodedRecord) {
+		d := c.request(apiFetch, 11, func(e *encoder) {
+			e.int32(-1)
+			e.int32(500)
+			e.int32(1)
+			e.int32(maxBytes)
+			e.int8(0)
+			e.int32(0)
+			e.int32(-1)
+			e.arrayLen(1)
+			e.string("t1")
+			e.arrayLen(1)
+			e.int32(1)
+			e.int32(-1)
+			e.int64(offset)
+			e.int64(-1)
+			e.int32(maxBytes)
+			e.arrayLen(0)
+			e.string("")
+		})
+		d.int32()
+		assert.Equal(t, errNone, d.int16())
+		d.int32()
+		require.Equal(t, 1, d.arrayLen())
+		assert.Equal(t, "t1", d.string())
+		require.Equal(t, 1, d.arrayLen())
+		assert.Equal(t, int32(1), d.int32())
+		errorCode := d.int16()
+		highWatermark := d.int64()
+		d.int64()
+		d.int64()
+		assert.Equal(t, 0, d.arrayLen())
+		d.int32()
+		records := d.bytes()
+		require.NoError(t, d.err)
+		return errorCode, highWatermark, decodeRecordBatch(t, records)
+	}
+	errorCode, highWatermark, records := fetch(15, 1024*1024)
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int64(100), highWatermark)
+	require.NotEmpty(t, records)
+	assert.Equal(t, int64(20), records[0].offset)
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(records[0].value, &rows))
+	assert.Equal(t, []map[string]interface{}{{
+		"topic":      "t1",
+		"database":   "db1",
+		"vgroup_id":  float64(3),
+		"offset":     float64(20),
+		"table_name": "d0",
+		"data":       map[string]interface{}{"v": float64(20)},
+	}}, rows)
+
+	// the next fetch continues without seek
+	next := records[len(records)-1].offset + 1
+	var offsets []int64
+	for _, r := range records {
+		offsets = append(offsets, r.offset)
+	}
+	for {
+		// the max wait expires without records after the end
+		_, _, records = fetch(next, 1)
+		if len(records) == 0 {
+			break
+		}
+		require.Len(t, records, 1)
+		offsets = append(offsets, records[0].offset)
+		next = records[0].offset + 1
+	}
+	assert.Equal(t, []int64{20, 30, 40, 50, 60, 70, 80, 90}, offsets)
+
+	// fetch from an earlier offset seeks the vgroup
+	_, _, records = fetch(0, 1)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(0), records[0].offset)
+
+	// unknown partition
+	d := c.request(apiFetch, 4, func(e *encoder) {
+		e.int32(-1)
+		e.int32(0)
+		e.int32(0)
+		e.int32(1024)
+		e.int8(0)
+		e.arrayLen(1)
+		e.string("t1")
+		e.arrayLen(1)
+		e.int32(5)
+		e.int64(0)
+		e.int32(1024)
+	})
+	d.int32()
+	d.arrayLen()
+	d.string()
+	d.arrayLen()
+	d.int32()
+	assert.Equal(t, errUnknownTopicOrPartition, d.int16())
+
+	require.NoError(t, c.conn.Close())
+	assert.Eventually(t, func() bool {
+		catalog.lock.Lock()
+		defer catalog.lock.Unlock()
+		return len(catalog.dropped) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGroup(t *testing.T) {
+	s, _ := startTestServer(t)
+	defer func() {
+		assert.NoError(t, s.stop())
+	}()
+	join := func(c *client, memberID string) (int16, int32, string, string, int) {
+		d := c.request(apiJoinGroup, 5, func(e *encoder) {
+			e.string("g1")
+			e.int32(10000)
+			e.int32(1000)
+			e.string(memberID)
+			e.nullString()
+			e.string("consumer")
+			e.arrayLen(1)
+			e.string("range")
+			e.bytes([]byte("metadata_" + c.clientID))
+		})
+		d.int32()
+		errorCode := d.int16()
+		generation := d.int32()
+		assert.Equal(t, "range", d.string())
+		leader := d.string()
+		id := d.string()
+		members := d.arrayLen()
+		for i := 0; i < members; i++ {
+			d.string()
+			d.nullableString()
+			assert.Contains(t, string(d.bytes()), "metadata_")
+		}
+		require.NoError(t, d.err)
+		return errorCode, generation, leader, id, members
+	}
+	sync := func(c *client, memberID string, generation int32, assignments map[string]string) (int16, string) {
+		d := c.request(apiSyncGroup, 3, func(e *encoder) {
+			e.string("g1")
+			e.int32(generation)
+			e.string(memberID)
+			e.nullString()
+			e.arrayLen(len(assignments))
+			for id, assignment := range assignments {
+				e.string(id)
+				e.bytes([]byte(assignment))
+			}
+		})
+		d.int32()
+		errorCode := d.int16()
+		assignment := d.bytes()
+		require.NoError(t, d.err)
+		return errorCode, string(assignment)
+	}
+	heartbeat := func(c *client, memberID string, generation int32) int16 {
+		d := c.request(apiHeartbeat, 3, func(e *encoder) {
+			e.string("g1")
+			e.int32(generation)
+			e.string(memberID)
+			e.nullString()
+		})
+		d.int32()
+		return d.int16()
+	}
+
+	c1 := newClient(t, s.port, "c1")
+	errorCode, generation, leader, member1, members := join(c1, "")
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int32(1), generation)
+	assert.Equal(t, member1, leader)
+	assert.Equal(t, 1, members)
+	errorCode, assignment := sync(c1, member1, generation, map[string]string{member1: "all"})
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, "all", assignment)
+	assert.Equal(t, errNone, heartbeat(c1, member1, generation))
+
+	// the second member triggers a rebalance, the first one joins again after the heartbeat
+	c2 := newClient(t, s.port, "c2")
+	done := make(chan struct{})
+	var member2 string
+	var generation2 int32
+	go func() {
+		defer close(done)
+		var code int16
+		code, generation2, _, member2, _ = join(c2, "")
+		assert.Equal(t, errNone, code)
+	}()
+	assert.Eventually(t, func() bool {
+		return heartbeat(c1, member1, generation) == errRebalanceInProgress
+	}, 5*time.Second, 10*time.Millisecond)
+	errorCode, generation, leader, _, members = join(c1, member1)
+	<-done
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int32(2), generation)
+	assert.Equal(t, generation, generation2)
+	assert.Equal(t, member1, leader)
+	assert.Equal(t, 2, members)
+
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		code, assignment := sync(c2, member2, generation, nil)
+		assert.Equal(t, errNone, code)
+		assert.Equal(t, "p1", assignment)
+	}()
+	errorCode, assignment = sync(c1, member1, generation, map[string]string{member1: "p0", member2: "p1"})
+	<-done
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, "p0", assignment)
+	assert.Equal(t, errIllegalGeneration, heartbeat(c1, member1, 1))
+	assert.Equal(t, errUnknownMemberID, heartbeat(c1, "unknown", generation))
+
+	// commit with the generation of the group
+	commit := func(c *client, memberID string, generation int32, offset int64) int16 {
+		d := c.request(apiOffsetCommit, 7, func(e *encoder) {
+			e.string("g1")
+			e.int32(generation)
+			e.string(memberID)
+			e.nullString()
+			e.arrayLen(1)
+			e.string("t1")
+			e.arrayLen(1)
+			e.int32(1)
+			e.int64(offset)
+			e.int32(-1)
+			e.nullString()
+		})
+		d.int32()
+		d.arrayLen()
+		d.string()
+		d.arrayLen()
+		d.int32()
+		return d.int16()
+	}
+	offsetFetch := func(c *client) (int64, int16) {
+		d := c.request(apiOffsetFetch, 5, func(e *encoder) {
+			e.string("g1")
+			e.arrayLen(1)
+			e.string("t1")
+			e.arrayLen(1)
+			e.int32(1)
+		})
+		d.int32()
+		require.Equal(t, 1, d.arrayLen())
+		d.string()
+		require.Equal(t, 1, d.arrayLen())
+		d.int32()
+		offset := d.int64()
+		d.int32()
+		d.nullableString()
+		errorCode := d.int16()
+		assert.Equal(t, errNone, d.int16())
+		require.NoError(t, d.err)
+		return offset, errorCode
+	}
+	offset, errorCode := offsetFetch(c1)
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int64(-1), offset)
+	assert.Equal(t, errIllegalGeneration, commit(c1, member1, 1, 30))
+	assert.Equal(t, errNone, commit(c1, member1, generation, 30))
+	// commit out of the group
+	assert.Equal(t, errNone, commit(c2, "", -1, 40))
+	offset, errorCode = offsetFetch(c2)
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int64(40), offset)
+
+	// the leave of the second member triggers a rebalance
+	d := c2.request(apiLeaveGroup, 2, func(e *encoder) {
+		e.string("g1")
+		e.string(member2)
+	})
+	d.int32()
+	assert.Equal(t, errNone, d.int16())
+	assert.Equal(t, errRebalanceInProgress, heartbeat(c1, member1, generation))
+	errorCode, generation, _, _, members = join(c1, member1)
+	assert.Equal(t, errNone, errorCode)
+	assert.Equal(t, int32(3), generation)
+	assert.Equal(t, 1, members)
+}
+
+func TestCoordinatorExpire(t *testing.T) {
+	c := newCoordinator()
+	defer c.stop()
+	result := c.join(&joinRequest{
+		groupID:          "g1",
+		clientID:         "c1",
+		sessionTimeout:   minSessionTimeout,
+		rebalanceTimeout: time.Second,
+		protocolType:     "consumer",
+		protocols:        []*protocol{{name: "range", metadata: []byte{}}},
+	})
+	require.Equal(t, errNone, result.errorCode)
+	assert.Equal(t, errInvalidSessionTimeout, c.join(&joinRequest{groupID: "g1", sessionTimeout: time.Second}).errorCode)
+	assert.Equal(t, errInconsistentProtocol, c.join(&joinRequest{
+		groupID:        "g1",
+		sessionTimeout: minSessionTimeout,
+		protocolType:   "consumer",
+		protocols:      []*protocol{{name: "roundrobin"}},
+	}).errorCode)
+	c.expire(time.Now())
+	assert.Equal(t, errRebalanceInProgress, c.heartbeat("g1", result.memberID, result.generation))
+	c.expire(time.Now().Add(minSessionTimeout + time.Second))
+	assert.Equal(t, errUnknownMemberID, c.heartbeat("g1", result.memberID, result.generation))
+	assert.Nil(t, c.group("g1", false))
+}
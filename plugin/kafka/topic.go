@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+)
+
+// topicMetadataTTL is how long the topics read from the server are cached.
+const topicMetadataTTL = 5 * time.Second
+
+// topicMeta is a tmq topic as a kafka topic, the partitions are the vgroups of the database of the topic ordered by
+// vgroup id.
+type topicMeta struct {
+	name     string
+	database string
+	vgroups  []int32
+}
+
+func (t *topicMeta) vgroup(partition int32) (int32, bool) {
+	if partition < 0 || int(partition) >= len(t.vgroups) {
+		return 0, false
+	}
+	return t.vgroups[partition], true
+}
+
+type catalog interface {
+	// topics returns the topics by name
+	topics() (map[string]*topicMeta, error)
+	// dropGroup drops the consumer group of the topic
+	dropGroup(groupID, topic string) error
+}
+
+// sqlCatalog reads the topics and the vgroups from information_schema.
+type sqlCatalog struct {
+	user     string
+	password string
+}
+
+func (c *sqlCatalog) query(sql string) ([][]driver.Value, error) {
+	taosConn, err := commonpool.GetConnection(c.user, c.password, localhost)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}()
+	result, err := async.GlobalAsync.TaosExec(taosConn.TaosConnection, logger, log.IsDebug(), sql, func(ts int64, precision int) driver.Value {
+		return ts
+	}, generator.GetReqID())
+	if err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+func (c *sqlCatalog) topics() (map[string]*topicMeta, error) {
+	rows, err := c.query("select topic_name, db_name from information_schema.ins_topics")
+	if err != nil {
+		return nil, err
+	}
+	topics := make(map[string]*topicMeta, len(rows))
+	for _, row := range rows {
+		name, _ := row[0].(string)
+		database, _ := row[1].(string)
+		topics[name] = &topicMeta{name: name, database: database}
+	}
+	if len(topics) == 0 {
+		return topics, nil
+	}
+	rows, err = c.query("select vgroup_id, db_name from information_schema.ins_vgroups")
+	if err != nil {
+		return nil, err
+	}
+	vgroups := map[string][]int32{}
+	for _, row := range rows {
+		vgroupID, _ := row[0].(int32)
+		database, _ := row[1].(string)
+		vgroups[database] = append(vgroups[database], vgroupID)
+	}
+	for _, ids := range vgroups {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	for _, topic := range topics {
+		topic.vgroups = vgroups[topic.database]
+	}
+	return topics, nil
+}
+
+func (c *sqlCatalog) dropGroup(groupID, topic string) error {
+	_, err := c.query(fmt.Sprintf("drop consumer group if exists `%s` on `%s`", escapeIdentifier(groupID), escapeIdentifier(topic)))
+	return err
+}
+
+func escapeIdentifier(name string) string {
+	return strings.ReplaceAll(name, "`", "``")
+}
+
+// topicCache caches the topics of the catalog.
+type topicCache struct {
+	catalog catalog
+	lock    sync.Mutex
+	topics  map[string]*topicMeta
+	expires time.Time
+}
+
+func (c *topicCache) get() (map[string]*topicMeta, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	if c.topics != nil && now.Before(c.expires) {
+		return c.topics, nil
+	}
+	topics, err := c.catalog.topics()
+	if err != nil {
+		return nil, err
+	}
+	c.topics = topics
+	c.expires = now.Add(topicMetadataTTL)
+	return topics, nil
+}
+
+func (c *topicCache) topic(name string) (*topicMeta, error) {
+	topics, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	return topics[name], nil
+}
@@ -0,0 +1,242 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+// AvroSchemaHeader is the record header with the avro schema of the record value.
+const AvroSchemaHeader = "avro.schema"
+
+// encodeJSON encodes the rows of the message as a json array, each row is the same object as /rest/tmq events.
+func encodeJSON(message *tmqconsumer.Message) []byte {
+	builder := jsonbuilder.BorrowStream(nil)
+	defer jsonbuilder.ReturnStream(builder)
+	builder.WriteArrayStart()
+	first := true
+	for _, block := range message.Blocks {
+		for _, row := range block.Rows {
+			if !first {
+				builder.WriteMore()
+			}
+			first = false
+			tmqconsumer.WriteRow(builder, message, block.TableName, row)
+		}
+	}
+	builder.WriteArrayEnd()
+	return append([]byte(nil), builder.Buffer()...)
+}
+
+type avroField struct {
+	Name    string      `json:"name"`
+	Type    interface{} `json:"type"`
+	Default interface{} `json:"default"`
+}
+
+type avroFieldNoDefault struct {
+	Name string      `json:"name"`
+	Type interface{} `json:"type"`
+}
+
+type avroRecord struct {
+	Type   string        `json:"type"`
+	Name   string        `json:"name"`
+	Fields []interface{} `json:"fields"`
+}
+
+type avroLogical struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType"`
+}
+
+type avroArray struct {
+	Type  string        `json:"type"`
+	Items []interface{} `json:"items"`
+}
+
+// encodeAvro encodes the rows of the message as an avro array in binary encoding and returns it with the schema.
+// The items of the array are a union of one record for each column layout of the message, the record has the
+// table name and the data record, every column is nullable.
+func encodeAvro(message *tmqconsumer.Message) (value []byte, schema []byte, err error) {
+	var items []interface{}
+	layouts := map[string]int{}
+	index := make([]int, len(message.Blocks))
+	for i, block := range message.Blocks {
+		key := blockLayout(block)
+		n, exists := layouts[key]
+		if !exists {
+			n = len(items)
+			layouts[key] = n
+			items = append(items, rowSchema(block, n))
+		}
+		index[i] = n
+	}
+	schema, err = json.Marshal(&avroArray{Type: "array", Items: items})
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := 0
+	for _, block := range message.Blocks {
+		rows += len(block.Values)
+	}
+	var b []byte
+	if rows > 0 {
+		b = appendVarint(b, int64(rows))
+		for i, block := range message.Blocks {
+			for _, row := range block.Values {
+				b = appendVarint(b, int64(index[i]))
+				b = appendAvroString(b, block.TableName)
+				for column, v := range row {
+					b, err = appendAvroValue(b, block.Types[column], block.Precision, v)
+					if err != nil {
+						return nil, nil, err
+					}
+				}
+			}
+		}
+	}
+	// end of the array blocks
+	b = appendVarint(b, 0)
+	return b, schema, nil
+}
+
+func blockLayout(block *tmqconsumer.Block) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(block.Precision))
+	for i, field := range block.Fields {
+		b.WriteByte(',')
+		b.WriteString(strconv.Quote(field))
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(int(block.Types[i])))
+	}
+	return b.String()
+}
+
+func rowSchema(block *tmqconsumer.Block, n int) *avroRecord {
+	fields := make([]interface{}, 0, len(block.Fields))
+	for i, field := range block.Fields {
+		fields = append(fields, &avroField{
+			Name:    avroName(field),
+			Type:    []interface{}{"null", avroType(block.Types[i], block.Precision)},
+			Default: nil,
+		})
+	}
+	return &avroRecord{
+		Type: "record",
+		Name: fmt.Sprintf("row_%d", n),
+		Fields: []interface{}{
+			&avroFieldNoDefault{Name: "table_name", Type: "string"},
+			&avroFieldNoDefault{Name: "data", Type: &avroRecord{Type: "record", Name: fmt.Sprintf("data_%d", n), Fields: fields}},
+		},
+	}
+}
+
+func avroType(colType uint8, precision int) interface{} {
+	switch colType {
+	case common.TSDB_DATA_TYPE_BOOL:
+		return "boolean"
+	case common.TSDB_DATA_TYPE_TINYINT, common.TSDB_DATA_TYPE_SMALLINT, common.TSDB_DATA_TYPE_INT,
+		common.TSDB_DATA_TYPE_UTINYINT, common.TSDB_DATA_TYPE_USMALLINT:
+		return "int"
+	case common.TSDB_DATA_TYPE_BIGINT, common.TSDB_DATA_TYPE_UINT:
+		return "long"
+	case common.TSDB_DATA_TYPE_FLOAT:
+		return "float"
+	case common.TSDB_DATA_TYPE_DOUBLE:
+		return "double"
+	case common.TSDB_DATA_TYPE_TIMESTAMP:
+		switch precision {
+		case common.PrecisionMicroSecond:
+			return &avroLogical{Type: "long", LogicalType: "timestamp-micros"}
+		case common.PrecisionNanoSecond:
+			return &avroLogical{Type: "long", LogicalType: "timestamp-nanos"}
+		default:
+			return &avroLogical{Type: "long", LogicalType: "timestamp-millis"}
+		}
+	case common.TSDB_DATA_TYPE_VARBINARY, common.TSDB_DATA_TYPE_GEOMETRY:
+		return "bytes"
+	default:
+		// strings, json and unsigned bigint which does not fit in long
+		return "string"
+	}
+}
+
+// avroName replaces the characters not allowed in avro names with underscores.
+func avroName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		b[i] = '_'
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = appendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
+
+// appendAvroValue appends the nullable union of the value.
+func appendAvroValue(b []byte, colType uint8, precision int, v interface{}) ([]byte, error) {
+	if v == nil {
+		return appendVarint(b, 0), nil
+	}
+	b = appendVarint(b, 1)
+	switch value := v.(type) {
+	case bool:
+		if value {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case int8:
+		return appendVarint(b, int64(value)), nil
+	case int16:
+		return appendVarint(b, int64(value)), nil
+	case int32:
+		return appendVarint(b, int64(value)), nil
+	case int64:
+		return appendVarint(b, value), nil
+	case uint8:
+		return appendVarint(b, int64(value)), nil
+	case uint16:
+		return appendVarint(b, int64(value)), nil
+	case uint32:
+		return appendVarint(b, int64(value)), nil
+	case uint64:
+		return appendAvroString(b, strconv.FormatUint(value, 10)), nil
+	case float32:
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(value))
+		return append(b, buf[:]...), nil
+	case float64:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(value))
+		return append(b, buf[:]...), nil
+	case time.Time:
+		return appendVarint(b, common.TimeToTimestamp(value, precision)), nil
+	case string:
+		return appendAvroString(b, value), nil
+	case []byte:
+		if colType == common.TSDB_DATA_TYPE_VARBINARY || colType == common.TSDB_DATA_TYPE_GEOMETRY {
+			b = appendVarint(b, int64(len(value)))
+			return append(b, value...), nil
+		}
+		return appendAvroString(b, string(value)), nil
+	default:
+		return nil, fmt.Errorf("unsupported avro value type %T of column type %d", v, colType)
+	}
+}
@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+func TestEncodeAvro(t *testing.T) {
+	ts := time.Unix(1700000000, 123000000)
+	message := &tmqconsumer.Message{
+		Topic:    "t1",
+		Database: "db1",
+		VgroupID: 2,
+		Offset:   10,
+		Blocks: []*tmqconsumer.Block{
+			{
+				TableName: "d0",
+				Fields:    []string{"ts", "v", "u", "f", "name", "bin", "1b"},
+				Types: []uint8{
+					common.TSDB_DATA_TYPE_TIMESTAMP,
+					common.TSDB_DATA_TYPE_BOOL,
+					common.TSDB_DATA_TYPE_UBIGINT,
+					common.TSDB_DATA_TYPE_FLOAT,
+					common.TSDB_DATA_TYPE_NCHAR,
+					common.TSDB_DATA_TYPE_VARBINARY,
+					common.TSDB_DATA_TYPE_INT,
+				},
+				Precision: common.PrecisionMilliSecond,
+				Values: [][]driver.Value{
+					{ts, true, uint64(math.MaxUint64), float32(1.5), "a", []byte{1, 2}, int32(-3)},
+					{ts, nil, nil, nil, nil, nil, nil},
+				},
+			},
+			{
+				TableName: "d1",
+				Fields:    []string{"ts", "v"},
+				Types:     []uint8{common.TSDB_DATA_TYPE_TIMESTAMP, common.TSDB_DATA_TYPE_DOUBLE},
+				Precision: common.PrecisionMicroSecond,
+				Values:    [][]driver.Value{{ts, 2.5}},
+			},
+		},
+	}
+	value, schema, err := encodeAvro(message)
+	require.NoError(t, err)
+
+	var s map[string]interface{}
+	require.NoError(t, json.Unmarshal(schema, &s))
+	assert.Equal(t, "array", s["type"])
+	items := s["items"].([]interface{})
+	require.Len(t, items, 2)
+	row := items[0].(map[string]interface{})
+	assert.Equal(t, "row_0", row["name"])
+	data := row["fields"].([]interface{})[1].(map[string]interface{})["type"].(map[string]interface{})
+	fields := data["fields"].([]interface{})
+	require.Len(t, fields, 7)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "ts",
+		"type":    []interface{}{"null", map[string]interface{}{"type": "long", "logicalType": "timestamp-millis"}},
+		"default": nil,
+	}, fields[0])
+	assert.Equal(t, []interface{}{"null", "string"}, fields[2].(map[string]interface{})["type"])
+	assert.Equal(t, "_b", fields[6].(map[string]interface{})["name"])
+
+	off := 0
+	long := func() int64 {
+		v, n := binary.Varint(value[off:])
+		require.Greater(t, n, 0)
+		off += n
+		return v
+	}
+	str := func() string {
+		n := int(long())
+		s := string(value[off : off+n])
+		off += n
+		return s
+	}
+	assert.Equal(t, int64(3), long())
+	// first row
+	assert.Equal(t, int64(0), long())
+	assert.Equal(t, "d0", str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, ts.UnixNano()/1e6, long())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, byte(1), value[off])
+	off++
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, "18446744073709551615", str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, float32(1.5), math.Float32frombits(binary.LittleEndian.Uint32(value[off:])))
+	off += 4
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, "a", str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, string([]byte{1, 2}), str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, int64(-3), long())
+	// second row with nulls
+	assert.Equal(t, int64(0), long())
+	assert.Equal(t, "d0", str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, ts.UnixNano()/1e6, long())
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, int64(0), long())
+	}
+	// third row of the second layout
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, "d1", str())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, ts.UnixNano()/1e3, long())
+	assert.Equal(t, int64(1), long())
+	assert.Equal(t, 2.5, math.Float64frombits(binary.LittleEndian.Uint64(value[off:])))
+	off += 8
+	assert.Equal(t, int64(0), long())
+	assert.Equal(t, len(value), off)
+}
+
+func TestEncodeJSON(t *testing.T) {
+	message := &tmqconsumer.Message{
+		Topic:    "t1",
+		Database: "db1",
+		VgroupID: 2,
+		Offset:   10,
+		Blocks: []*tmqconsumer.Block{
+			{TableName: "d0", Rows: [][]byte{[]byte(`{"v":1}`), []byte(`{"v":2}`)}},
+			{TableName: "d1", Rows: [][]byte{[]byte(`{"v":3}`)}},
+		},
+	}
+	assert.JSONEq(t, `[
+{"topic":"t1","database":"db1","vgroup_id":2,"offset":10,"table_name":"d0","data":{"v":1}},
+{"topic":"t1","database":"db1","vgroup_id":2,"offset":10,"table_name":"d0","data":{"v":2}},
+{"topic":"t1","database":"db1","vgroup_id":2,"offset":10,"table_name":"d1","data":{"v":3}}
+]`, string(encodeJSON(message)))
+}
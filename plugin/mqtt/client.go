@@ -0,0 +1,223 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// sessionExpiry is the session expiry interval of 5 if the session is not clean, the broker keeps the session for a
+// day after taosAdapter disconnects.
+const sessionExpiry = 24 * 60 * 60
+
+const subscribePacketID = 1
+
+var localhost = net.IPv4(127, 0, 0, 1)
+
+// client subscribes the topics of the routes from an external broker, it reconnects at the reconnect interval after
+// the connection is lost.
+type client struct {
+	conf    *Config
+	router  *router
+	writer  *writer
+	lock    sync.Mutex
+	session *session
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newClient(conf *Config, router *router, writer *writer) *client {
+	return &client{conf: conf, router: router, writer: writer, done: make(chan struct{})}
+}
+
+func (c *client) start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+func (c *client) run() {
+	defer c.wg.Done()
+	for {
+		err := c.connectAndServe()
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		if err != nil {
+			logger.WithError(err).Errorf("mqtt client of broker %s error", c.conf.Broker)
+		}
+		timer := time.NewTimer(c.conf.ReconnectInterval)
+		select {
+		case <-c.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *client) dial() (net.Conn, error) {
+	u, err := url.Parse(c.conf.Broker)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	if u.Scheme == "tcp" {
+		return dialer.Dial("tcp", u.Host)
+	}
+	return tls.DialWithDialer(dialer, "tcp", u.Host, &tls.Config{ServerName: u.Hostname()})
+}
+
+func (c *client) connectAndServe() error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	version := byte(c.conf.ProtocolVersion)
+	s := newSession(conn, version, false, localhost, c.conf.MaxInflight, c.router, c.writer, logger.WithField("broker", c.conf.Broker))
+	c.lock.Lock()
+	select {
+	case <-c.done:
+		c.lock.Unlock()
+		_ = conn.Close()
+		return nil
+	default:
+	}
+	c.session = s
+	c.lock.Unlock()
+	defer s.close()
+
+	connect := &connectPacket{
+		version:           version,
+		cleanStart:        c.conf.CleanSession,
+		keepAlive:         uint16(c.conf.KeepAlive / time.Second),
+		clientID:          c.conf.ClientID,
+		username:          c.conf.BrokerUser,
+		password:          []byte(c.conf.BrokerPassword),
+		hasUsername:       len(c.conf.BrokerUser) > 0,
+		hasPassword:       len(c.conf.BrokerPassword) > 0,
+		receiveMaximum:    uint16(c.conf.MaxInflight),
+		maximumPacketSize: uint32(c.conf.MaxPacketSize),
+	}
+	if !c.conf.CleanSession {
+		connect.sessionExpiry = sessionExpiry
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(connectTimeout)); err != nil {
+		return err
+	}
+	if err = s.write(connect.encode()); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	header, body, err := readPacket(reader, maxRemainingLength)
+	if err != nil {
+		return err
+	}
+	if header>>4 != packetConnack {
+		return fmt.Errorf("unexpected %s packet before CONNACK", packetName(header>>4))
+	}
+	connack, err := decodeConnack(version, body)
+	if err != nil {
+		return err
+	}
+	if connack.code != codeSuccess {
+		return fmt.Errorf("connection refused by broker, code:0x%02x", connack.code)
+	}
+	logger.Infof("mqtt client connected to broker %s, session present:%t", c.conf.Broker, connack.sessionPresent)
+
+	filters := make([]string, len(c.conf.Routes))
+	qos := make([]byte, len(c.conf.Routes))
+	for i, route := range c.conf.Routes {
+		filters[i] = route.Topic
+		qos[i] = byte(route.QoS)
+	}
+	if err = s.write(encodeSubscribe(version, subscribePacketID, filters, qos)); err != nil {
+		return err
+	}
+	go c.ping(s)
+	go s.sendAcks()
+	return c.read(s, reader, filters)
+}
+
+// ping sends the ping request at the keep alive interval until the session is closed.
+func (c *client) ping(s *session) {
+	ticker := time.NewTicker(c.conf.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write(newPacket(packetPingreq<<4, nil)); err != nil {
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// read reads the packets from the broker, the packets larger than maxPacketSize are dropped since a broker of 3.1.1
+// does not know the limit. The connection is closed if no packet is received in one and a half times the keep alive.
+func (c *client) read(s *session, reader *bufio.Reader, filters []string) error {
+	for {
+		if err := s.conn.SetReadDeadline(time.Now().Add(c.conf.KeepAlive * 3 / 2)); err != nil {
+			return err
+		}
+		header, body, err := readPacket(reader, maxRemainingLength)
+		if err != nil {
+			return err
+		}
+		switch header >> 4 {
+		case packetPublish:
+			if len(body) > c.conf.MaxPacketSize {
+				s.logger.Errorf("drop the message larger than max packet size %d", c.conf.MaxPacketSize)
+				continue
+			}
+			p, err := decodePublish(s.version, header, body)
+			if err != nil {
+				return err
+			}
+			if err = s.handlePublish(p); err != nil {
+				return err
+			}
+		case packetSuback:
+			_, codes, err := decodeSuback(s.version, body)
+			if err != nil {
+				return err
+			}
+			for i, code := range codes {
+				if i >= len(filters) {
+					break
+				}
+				if code >= codeUnspecifiedError {
+					s.logger.Errorf("subscribe %s failed, code:0x%02x", filters[i], code)
+				} else {
+					s.logger.Infof("subscribed %s, qos:%d", filters[i], code)
+				}
+			}
+		case packetPingresp:
+		case packetDisconnect:
+			if len(body) > 0 {
+				return fmt.Errorf("disconnected by broker, code:0x%02x", body[0])
+			}
+			return errors.New("disconnected by broker")
+		default:
+			return fmt.Errorf("unexpected %s packet", packetName(header>>4))
+		}
+	}
+}
+
+func (c *client) stop() {
+	close(c.done)
+	c.lock.Lock()
+	if c.session != nil {
+		c.session.close()
+	}
+	c.lock.Unlock()
+	c.wg.Wait()
+}
@@ -0,0 +1,261 @@
+package mqtt
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+const (
+	// ModeListener accepts the connections of the mqtt clients
+	ModeListener = "listener"
+	// ModeClient subscribes the topics of an external broker
+	ModeClient = "client"
+)
+
+// payload formats of the routes
+const (
+	FormatInflux       = "influx"
+	FormatOpentsdbJSON = "opentsdb_json"
+	FormatJSON         = "json"
+)
+
+type Config struct {
+	Enable            bool
+	Mode              string
+	Port              int
+	MaxConnections    int
+	MaxInflight       int
+	MaxPacketSize     int
+	Broker            string
+	ClientID          string
+	BrokerUser        string
+	BrokerPassword    string
+	ProtocolVersion   int
+	CleanSession      bool
+	KeepAlive         time.Duration
+	ReconnectInterval time.Duration
+	User              string
+	Password          string
+	Worker            int
+	BatchSize         int
+	FlushInterval     time.Duration
+	TTL               int
+	// Routes map the topics to the databases and payload parsers, the first matched route is used
+	Routes []*RouteConfig
+}
+
+// RouteConfig maps the messages of a topic filter to a database.
+type RouteConfig struct {
+	Topic     string
+	DB        string
+	Format    string
+	QoS       int
+	Precision string
+	// STable, Timestamp, TimestampPrecision, Rows, Tags, TopicTags and Columns are the json format mapping, the
+	// values of Timestamp, Rows, Tags and Columns are gjson paths.
+	STable             string
+	Timestamp          string
+	TimestampPrecision string
+	Rows               string
+	Tags               map[string]string
+	TopicTags          map[string]int
+	Columns            map[string]string
+}
+
+func (c *Config) setValue() error {
+	c.Enable = viper.GetBool("mqtt.enable")
+	c.Mode = viper.GetString("mqtt.mode")
+	c.Port = viper.GetInt("mqtt.port")
+	c.MaxConnections = viper.GetInt("mqtt.maxConnections")
+	c.MaxInflight = viper.GetInt("mqtt.maxInflight")
+	c.MaxPacketSize = viper.GetInt("mqtt.maxPacketSize")
+	c.Broker = viper.GetString("mqtt.broker")
+	c.ClientID = viper.GetString("mqtt.clientID")
+	c.BrokerUser = viper.GetString("mqtt.brokerUser")
+	c.BrokerPassword = viper.GetString("mqtt.brokerPassword")
+	c.ProtocolVersion = viper.GetInt("mqtt.protocolVersion")
+	c.CleanSession = viper.GetBool("mqtt.cleanSession")
+	c.KeepAlive = viper.GetDuration("mqtt.keepAlive")
+	c.ReconnectInterval = viper.GetDuration("mqtt.reconnectInterval")
+	c.User = viper.GetString("mqtt.user")
+	c.Password = viper.GetString("mqtt.password")
+	c.Worker = viper.GetInt("mqtt.worker")
+	c.BatchSize = viper.GetInt("mqtt.batchSize")
+	c.FlushInterval = viper.GetDuration("mqtt.flushInterval")
+	c.TTL = viper.GetInt("mqtt.ttl")
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.Worker < 1 {
+		c.Worker = 1
+	}
+	if c.MaxInflight < 1 {
+		c.MaxInflight = 1
+	}
+	c.Routes = nil
+	return viper.UnmarshalKey("mqtt.routes", &c.Routes)
+}
+
+func (c *Config) check() error {
+	switch c.Mode {
+	case ModeListener:
+		if c.Port <= 0 || c.Port > 65535 {
+			return fmt.Errorf("invalid mqtt port %d", c.Port)
+		}
+	case ModeClient:
+		u, err := url.Parse(c.Broker)
+		if err != nil || (u.Scheme != "tcp" && u.Scheme != "ssl" && u.Scheme != "tls") || len(u.Host) == 0 {
+			return fmt.Errorf("invalid mqtt broker %s", c.Broker)
+		}
+		if c.ProtocolVersion != 4 && c.ProtocolVersion != 5 {
+			return fmt.Errorf("invalid mqtt protocolVersion %d, should be 4 or 5", c.ProtocolVersion)
+		}
+		if len(c.ClientID) == 0 {
+			return fmt.Errorf("mqtt clientID required")
+		}
+		if c.KeepAlive < time.Second || c.KeepAlive > 65535*time.Second {
+			return fmt.Errorf("invalid mqtt keepAlive %s", c.KeepAlive)
+		}
+	default:
+		return fmt.Errorf("invalid mqtt mode %s, should be %s or %s", c.Mode, ModeListener, ModeClient)
+	}
+	if c.MaxInflight > 65535 {
+		return fmt.Errorf("mqtt maxInflight should not be greater than 65535")
+	}
+	if c.MaxPacketSize < minPacketSize || c.MaxPacketSize > maxRemainingLength {
+		return fmt.Errorf("invalid mqtt maxPacketSize %d", c.MaxPacketSize)
+	}
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("mqtt routes required")
+	}
+	for i, route := range c.Routes {
+		if route == nil || len(route.Topic) == 0 {
+			return fmt.Errorf("mqtt.routes[%d] topic required", i)
+		}
+		if !validFilter(route.Topic) {
+			return fmt.Errorf("mqtt route invalid topic %s", route.Topic)
+		}
+		if len(route.DB) == 0 {
+			return fmt.Errorf("mqtt route %s db required", route.Topic)
+		}
+		if route.QoS < 0 || route.QoS > 1 {
+			return fmt.Errorf("mqtt route %s invalid qos %d, should be 0 or 1", route.Topic, route.QoS)
+		}
+		switch route.Format {
+		case "", FormatInflux:
+			route.Format = FormatInflux
+			switch route.Precision {
+			case "":
+				route.Precision = "ns"
+			case "ns", "u", "ms", "s", "m", "h":
+			default:
+				return fmt.Errorf("mqtt route %s invalid precision %s", route.Topic, route.Precision)
+			}
+		case FormatOpentsdbJSON:
+		case FormatJSON:
+			if len(route.STable) == 0 {
+				return fmt.Errorf("mqtt route %s stable required", route.Topic)
+			}
+			if len(route.Columns) == 0 {
+				return fmt.Errorf("mqtt route %s columns required", route.Topic)
+			}
+			switch route.TimestampPrecision {
+			case "":
+				route.TimestampPrecision = "ms"
+			case "ns", "us", "ms", "s":
+			default:
+				return fmt.Errorf("mqtt route %s invalid timestampPrecision %s", route.Topic, route.TimestampPrecision)
+			}
+		default:
+			return fmt.Errorf("mqtt route %s invalid format %s", route.Topic, route.Format)
+		}
+	}
+	return nil
+}
+
+func init() {
+	_ = viper.BindEnv("mqtt.enable", "TAOS_ADAPTER_MQTT_ENABLE")
+	pflag.Bool("mqtt.enable", false, `enable mqtt,warning: the listener is without auth info(default false). Env "TAOS_ADAPTER_MQTT_ENABLE"`)
+	viper.SetDefault("mqtt.enable", false)
+
+	_ = viper.BindEnv("mqtt.mode", "TAOS_ADAPTER_MQTT_MODE")
+	pflag.String("mqtt.mode", ModeListener, `mqtt mode, listener to accept mqtt clients or client to subscribe an external broker. Env "TAOS_ADAPTER_MQTT_MODE"`)
+	viper.SetDefault("mqtt.mode", ModeListener)
+
+	_ = viper.BindEnv("mqtt.port", "TAOS_ADAPTER_MQTT_PORT")
+	pflag.Int("mqtt.port", 1883, `mqtt listener tcp port. Env "TAOS_ADAPTER_MQTT_PORT"`)
+	viper.SetDefault("mqtt.port", 1883)
+
+	_ = viper.BindEnv("mqtt.maxConnections", "TAOS_ADAPTER_MQTT_MAX_CONNECTIONS")
+	pflag.Int("mqtt.maxConnections", 1000, `mqtt listener max tcp connections. Env "TAOS_ADAPTER_MQTT_MAX_CONNECTIONS"`)
+	viper.SetDefault("mqtt.maxConnections", 1000)
+
+	_ = viper.BindEnv("mqtt.maxInflight", "TAOS_ADAPTER_MQTT_MAX_INFLIGHT")
+	pflag.Int("mqtt.maxInflight", 100, `mqtt max unacknowledged qos 1 messages of each connection. Env "TAOS_ADAPTER_MQTT_MAX_INFLIGHT"`)
+	viper.SetDefault("mqtt.maxInflight", 100)
+
+	_ = viper.BindEnv("mqtt.maxPacketSize", "TAOS_ADAPTER_MQTT_MAX_PACKET_SIZE")
+	pflag.Int("mqtt.maxPacketSize", 1<<20, `mqtt max packet size in bytes. Env "TAOS_ADAPTER_MQTT_MAX_PACKET_SIZE"`)
+	viper.SetDefault("mqtt.maxPacketSize", 1<<20)
+
+	_ = viper.BindEnv("mqtt.broker", "TAOS_ADAPTER_MQTT_BROKER")
+	pflag.String("mqtt.broker", "tcp://127.0.0.1:1883", `mqtt external broker address of the client mode, tcp://host:port or ssl://host:port. Env "TAOS_ADAPTER_MQTT_BROKER"`)
+	viper.SetDefault("mqtt.broker", "tcp://127.0.0.1:1883")
+
+	_ = viper.BindEnv("mqtt.clientID", "TAOS_ADAPTER_MQTT_CLIENT_ID")
+	pflag.String("mqtt.clientID", "taosadapter", `mqtt client id of the client mode. Env "TAOS_ADAPTER_MQTT_CLIENT_ID"`)
+	viper.SetDefault("mqtt.clientID", "taosadapter")
+
+	_ = viper.BindEnv("mqtt.brokerUser", "TAOS_ADAPTER_MQTT_BROKER_USER")
+	pflag.String("mqtt.brokerUser", "", `mqtt external broker user of the client mode. Env "TAOS_ADAPTER_MQTT_BROKER_USER"`)
+	viper.SetDefault("mqtt.brokerUser", "")
+
+	_ = viper.BindEnv("mqtt.brokerPassword", "TAOS_ADAPTER_MQTT_BROKER_PASSWORD")
+	pflag.String("mqtt.brokerPassword", "", `mqtt external broker password of the client mode. Env "TAOS_ADAPTER_MQTT_BROKER_PASSWORD"`)
+	viper.SetDefault("mqtt.brokerPassword", "")
+
+	_ = viper.BindEnv("mqtt.protocolVersion", "TAOS_ADAPTER_MQTT_PROTOCOL_VERSION")
+	pflag.Int("mqtt.protocolVersion", 4, `mqtt protocol version of the client mode, 4 for 3.1.1 or 5. Env "TAOS_ADAPTER_MQTT_PROTOCOL_VERSION"`)
+	viper.SetDefault("mqtt.protocolVersion", 4)
+
+	_ = viper.BindEnv("mqtt.cleanSession", "TAOS_ADAPTER_MQTT_CLEAN_SESSION")
+	pflag.Bool("mqtt.cleanSession", false, `mqtt clean session of the client mode, the unacknowledged messages are lost after reconnecting if true. Env "TAOS_ADAPTER_MQTT_CLEAN_SESSION"`)
+	viper.SetDefault("mqtt.cleanSession", false)
+
+	_ = viper.BindEnv("mqtt.keepAlive", "TAOS_ADAPTER_MQTT_KEEP_ALIVE")
+	pflag.Duration("mqtt.keepAlive", 30*time.Second, `mqtt keep alive of the client mode. Env "TAOS_ADAPTER_MQTT_KEEP_ALIVE"`)
+	viper.SetDefault("mqtt.keepAlive", 30*time.Second)
+
+	_ = viper.BindEnv("mqtt.reconnectInterval", "TAOS_ADAPTER_MQTT_RECONNECT_INTERVAL")
+	pflag.Duration("mqtt.reconnectInterval", 5*time.Second, `mqtt reconnect interval of the client mode. Env "TAOS_ADAPTER_MQTT_RECONNECT_INTERVAL"`)
+	viper.SetDefault("mqtt.reconnectInterval", 5*time.Second)
+
+	_ = viper.BindEnv("mqtt.user", "TAOS_ADAPTER_MQTT_USER")
+	pflag.String("mqtt.user", common.DefaultUser, `mqtt user. Env "TAOS_ADAPTER_MQTT_USER"`)
+	viper.SetDefault("mqtt.user", common.DefaultUser)
+
+	_ = viper.BindEnv("mqtt.password", "TAOS_ADAPTER_MQTT_PASSWORD")
+	pflag.String("mqtt.password", common.DefaultPassword, `mqtt password. Env "TAOS_ADAPTER_MQTT_PASSWORD"`)
+	viper.SetDefault("mqtt.password", common.DefaultPassword)
+
+	_ = viper.BindEnv("mqtt.worker", "TAOS_ADAPTER_MQTT_WORKER")
+	pflag.Int("mqtt.worker", 10, `mqtt write worker. Env "TAOS_ADAPTER_MQTT_WORKER"`)
+	viper.SetDefault("mqtt.worker", 10)
+
+	_ = viper.BindEnv("mqtt.batchSize", "TAOS_ADAPTER_MQTT_BATCH_SIZE")
+	pflag.Int("mqtt.batchSize", 1000, `mqtt batch size in messages. Env "TAOS_ADAPTER_MQTT_BATCH_SIZE"`)
+	viper.SetDefault("mqtt.batchSize", 1000)
+
+	_ = viper.BindEnv("mqtt.flushInterval", "TAOS_ADAPTER_MQTT_FLUSH_INTERVAL")
+	pflag.Duration("mqtt.flushInterval", 100*time.Millisecond, `mqtt flush interval (0s means not valid). Env "TAOS_ADAPTER_MQTT_FLUSH_INTERVAL"`)
+	viper.SetDefault("mqtt.flushInterval", 100*time.Millisecond)
+
+	_ = viper.BindEnv("mqtt.ttl", "TAOS_ADAPTER_MQTT_TTL")
+	pflag.Int("mqtt.ttl", 0, `mqtt data ttl. Env "TAOS_ADAPTER_MQTT_TTL"`)
+	viper.SetDefault("mqtt.ttl", 0)
+}
@@ -0,0 +1,276 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+)
+
+const connectTimeout = 10 * time.Second
+
+// listener accepts the connections of the mqtt clients, the clients can only publish messages.
+type listener struct {
+	conf     *Config
+	router   *router
+	writer   *writer
+	ln       *net.TCPListener
+	id       uint64
+	accept   chan bool
+	lock     sync.Mutex
+	sessions map[uint64]*session
+	conns    map[uint64]net.Conn
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newListener(conf *Config, router *router, writer *writer) *listener {
+	l := &listener{
+		conf:     conf,
+		router:   router,
+		writer:   writer,
+		accept:   make(chan bool, conf.MaxConnections),
+		sessions: make(map[uint64]*session),
+		conns:    make(map[uint64]net.Conn),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < conf.MaxConnections; i++ {
+		l.accept <- true
+	}
+	return l
+}
+
+func (l *listener) start(port int) error {
+	address, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	l.ln, err = net.ListenTCP("tcp4", address)
+	if err != nil {
+		return err
+	}
+	logger.Infof("mqtt TCP listening on %q", l.ln.Addr().String())
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		if err := l.serve(); err != nil {
+			logger.WithError(err).Error("mqtt listener error")
+		}
+	}()
+	return nil
+}
+
+func (l *listener) serve() error {
+	for {
+		conn, err := l.ln.AcceptTCP()
+		if err != nil {
+			select {
+			case <-l.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+		_, valid, poolExists := commonpool.VerifyClientIP(l.conf.User, l.conf.Password, clientIP)
+		if poolExists && !valid {
+			logger.WithField("user", l.conf.User).WithField("clientIP", clientIP.String()).Error("forbidden clientIP")
+			_ = conn.Close()
+			continue
+		}
+		select {
+		case <-l.accept:
+			id := atomic.AddUint64(&l.id, 1)
+			l.lock.Lock()
+			l.conns[id] = conn
+			l.lock.Unlock()
+			l.wg.Add(1)
+			go l.handle(id, conn, clientIP)
+		default:
+			_ = conn.Close()
+			logger.Infof("Refused TCP Connection from %s", conn.RemoteAddr())
+			logger.Warn("Maximum TCP Connections reached")
+		}
+	}
+}
+
+func (l *listener) handle(id uint64, conn *net.TCPConn, clientIP net.IP) {
+	defer func() {
+		l.lock.Lock()
+		delete(l.conns, id)
+		delete(l.sessions, id)
+		l.lock.Unlock()
+		_ = conn.Close()
+		l.accept <- true
+		l.wg.Done()
+	}()
+	reader := bufio.NewReader(conn)
+	s, keepAlive, err := l.connect(id, conn, reader, clientIP)
+	if err != nil {
+		if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			logger.WithError(err).Errorf("mqtt connect from %s error", clientIP)
+		}
+		return
+	}
+	defer s.close()
+	go s.sendAcks()
+	err = l.read(s, reader, keepAlive)
+	if err != nil && err != io.EOF && err != errSessionClosed && !errors.Is(err, net.ErrClosed) {
+		s.logger.WithError(err).Error("read mqtt connection error")
+	}
+}
+
+// connect reads the connect packet and returns the session of the connection.
+func (l *listener) connect(id uint64, conn *net.TCPConn, reader *bufio.Reader, clientIP net.IP) (*session, time.Duration, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(connectTimeout)); err != nil {
+		return nil, 0, err
+	}
+	header, body, err := readPacket(reader, l.conf.MaxPacketSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if header>>4 != packetConnect {
+		return nil, 0, fmt.Errorf("the first packet is %s", packetName(header>>4))
+	}
+	p, err := decodeConnect(body)
+	if err == errUnacceptableVersion {
+		_, _ = conn.Write((&connackPacket{code: codeUnacceptableVersion}).encode(version311))
+		return nil, 0, fmt.Errorf("unacceptable protocol version %d", p.version)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	clientID := p.clientID
+	var props encoder
+	if len(clientID) == 0 {
+		if p.version != version5 && !p.cleanStart {
+			_, _ = conn.Write((&connackPacket{code: codeIdentifierRejected}).encode(p.version))
+			return nil, 0, errors.New("empty client id without clean session")
+		}
+		clientID = fmt.Sprintf("taosadapter-%d", id)
+		if p.version == version5 {
+			props.byte(propAssignedClientIdentifier)
+			props.string(clientID)
+		}
+	}
+	props.byte(propReceiveMaximum)
+	props.uint16(uint16(l.conf.MaxInflight))
+	props.byte(propMaximumQoS)
+	props.byte(1)
+	props.byte(propMaximumPacketSize)
+	props.uint32(uint32(l.conf.MaxPacketSize))
+	props.byte(propWildcardSubscription)
+	props.byte(0)
+	props.byte(propSubscriptionIdentifiers)
+	props.byte(0)
+	props.byte(propSharedSubscriptionSupport)
+	props.byte(0)
+	sessionLogger := logger.WithField("clientIP", clientIP.String()).WithField("clientID", clientID)
+	s := newSession(conn, p.version, true, clientIP, l.conf.MaxInflight, l.router, l.writer, sessionLogger)
+	l.lock.Lock()
+	l.sessions[id] = s
+	l.lock.Unlock()
+	if err = s.write((&connackPacket{code: codeSuccess, properties: props.buf}).encode(p.version)); err != nil {
+		return nil, 0, err
+	}
+	sessionLogger.Debugf("mqtt client connected, version:%d, keepAlive:%d", p.version, p.keepAlive)
+	return s, time.Duration(p.keepAlive) * time.Second, nil
+}
+
+// read reads the packets after the connect packet, the connection is closed if no packet is received in one and a
+// half times the keep alive.
+func (l *listener) read(s *session, reader *bufio.Reader, keepAlive time.Duration) error {
+	for {
+		var deadline time.Time
+		if keepAlive > 0 {
+			deadline = time.Now().Add(keepAlive * 3 / 2)
+		}
+		if err := s.conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		header, body, err := readPacket(reader, l.conf.MaxPacketSize)
+		if err != nil {
+			if err == errPacketTooLarge {
+				s.closeWithCode(codePacketTooLarge)
+			} else if err == errMalformedPacket {
+				s.closeWithCode(codeMalformedPacket)
+			}
+			return err
+		}
+		packetType := header >> 4
+		if !fixedHeaderFlagsValid(packetType, header&0x0f) {
+			s.closeWithCode(codeMalformedPacket)
+			return errMalformedPacket
+		}
+		switch packetType {
+		case packetPublish:
+			p, err := decodePublish(s.version, header, body)
+			if err != nil {
+				s.closeWithCode(codeMalformedPacket)
+				return err
+			}
+			if err = s.handlePublish(p); err != nil {
+				if err == errQoSNotSupported {
+					s.closeWithCode(codeQoSNotSupported)
+				} else {
+					s.closeWithCode(codeUnspecifiedError)
+				}
+				return err
+			}
+		case packetPingreq:
+			if err = s.write(newPacket(packetPingresp<<4, nil)); err != nil {
+				return err
+			}
+		case packetSubscribe:
+			// the listener only receives messages, all the subscriptions fail
+			packetID, n, err := decodeSubscribe(s.version, body)
+			if err != nil {
+				s.closeWithCode(codeMalformedPacket)
+				return err
+			}
+			codes := make([]byte, n)
+			for i := range codes {
+				codes[i] = codeUnspecifiedError
+			}
+			if err = s.write(encodeSuback(s.version, packetID, codes)); err != nil {
+				return err
+			}
+		case packetUnsubscribe:
+			packetID, n, err := decodeUnsubscribe(s.version, body)
+			if err != nil {
+				s.closeWithCode(codeMalformedPacket)
+				return err
+			}
+			if err = s.write(encodeUnsuback(s.version, packetID, n)); err != nil {
+				return err
+			}
+		case packetDisconnect:
+			return nil
+		default:
+			s.closeWithCode(codeProtocolError)
+			return fmt.Errorf("unexpected %s packet", packetName(packetType))
+		}
+	}
+}
+
+func (l *listener) stop() error {
+	close(l.done)
+	err := l.ln.Close()
+	l.lock.Lock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+	// the sessions are closed to wake up the reads waiting for the inflight messages
+	for _, s := range l.sessions {
+		s.close()
+	}
+	l.lock.Unlock()
+	l.wg.Wait()
+	return err
+}
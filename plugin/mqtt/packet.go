@@ -0,0 +1,575 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// control packet types
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetPubrec      byte = 5
+	packetPubrel      byte = 6
+	packetPubcomp     byte = 7
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+	packetAuth        byte = 15
+)
+
+// protocol levels
+const (
+	version31  byte = 3
+	version311 byte = 4
+	version5   byte = 5
+)
+
+// connect return codes of 3.1.1 and reason codes of 5 used by taosAdapter
+const (
+	codeSuccess                     byte = 0x00
+	codeUnacceptableVersion         byte = 0x01
+	codeIdentifierRejected          byte = 0x02
+	codeNoMatchingSubscribers       byte = 0x10
+	codeNoSubscriptionExisted       byte = 0x11
+	codeUnspecifiedError            byte = 0x80
+	codeMalformedPacket             byte = 0x81
+	codeProtocolError               byte = 0x82
+	codeImplementationSpecificError byte = 0x83
+	codePacketTooLarge              byte = 0x95
+	codePayloadFormatInvalid        byte = 0x99
+	codeQoSNotSupported             byte = 0x9b
+)
+
+// properties of 5 used by taosAdapter
+const (
+	propSessionExpiryInterval     byte = 0x11
+	propAssignedClientIdentifier  byte = 0x12
+	propReceiveMaximum            byte = 0x21
+	propMaximumQoS                byte = 0x24
+	propMaximumPacketSize         byte = 0x27
+	propWildcardSubscription      byte = 0x28
+	propSubscriptionIdentifiers   byte = 0x29
+	propSharedSubscriptionSupport byte = 0x2a
+)
+
+const (
+	maxRemainingLength = 268435455
+	minPacketSize      = 1024
+)
+
+var (
+	errMalformedPacket = errors.New("malformed mqtt packet")
+	errPacketTooLarge  = errors.New("mqtt packet too large")
+)
+
+// readPacket reads a control packet, it returns the first byte of the fixed header and the bytes after the fixed
+// header.
+func readPacket(r *bufio.Reader, maxSize int) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := 0
+	multiplier := 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errMalformedPacket
+		}
+		multiplier *= 128
+	}
+	if 1+varintSize(length)+length > maxSize {
+		return 0, nil, errPacketTooLarge
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func varintSize(v int) int {
+	n := 1
+	for v >= 128 {
+		v /= 128
+		n++
+	}
+	return n
+}
+
+func appendVarint(b []byte, v int) []byte {
+	for {
+		c := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+// newPacket returns the packet of the first byte of the fixed header and the variable header and payload.
+func newPacket(header byte, body []byte) []byte {
+	b := make([]byte, 0, 1+varintSize(len(body))+len(body))
+	b = append(b, header)
+	b = appendVarint(b, len(body))
+	return append(b, body...)
+}
+
+// decoder reads the fields of a packet, the first error is kept and the reads after it return zero values.
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf)-d.off < n {
+		d.err = errMalformedPacket
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.read(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.read(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) varint() int {
+	v := 0
+	multiplier := 1
+	for i := 0; i < 4; i++ {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		v += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return v
+		}
+		multiplier *= 128
+	}
+	d.err = errMalformedPacket
+	return 0
+}
+
+func (d *decoder) binary() []byte {
+	return d.read(int(d.uint16()))
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+// skipProperties skips the properties of 5, taosAdapter uses none of the properties sent by the peer.
+func (d *decoder) skipProperties() {
+	d.read(d.varint())
+}
+
+func (d *decoder) remaining() []byte {
+	return d.read(len(d.buf) - d.off)
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) byte(v byte) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) binary(v []byte) {
+	e.uint16(uint16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) string(v string) {
+	e.uint16(uint16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// properties appends the properties of 5 with the length prefix.
+func (e *encoder) properties(props []byte) {
+	e.buf = appendVarint(e.buf, len(props))
+	e.buf = append(e.buf, props...)
+}
+
+type connectPacket struct {
+	version     byte
+	cleanStart  bool
+	keepAlive   uint16
+	clientID    string
+	username    string
+	password    []byte
+	hasUsername bool
+	hasPassword bool
+	// sessionExpiry is the session expiry interval property of 5
+	sessionExpiry uint32
+	// receiveMaximum is the receive maximum property of 5
+	receiveMaximum uint16
+	// maximumPacketSize is the maximum packet size property of 5
+	maximumPacketSize uint32
+}
+
+// errUnacceptableVersion is returned by decodeConnect with the packet whose version is read.
+var errUnacceptableVersion = errors.New("unacceptable mqtt protocol version")
+
+func decodeConnect(body []byte) (*connectPacket, error) {
+	d := &decoder{buf: body}
+	name := d.string()
+	p := &connectPacket{version: d.byte()}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if (name != "MQTT" || (p.version != version311 && p.version != version5)) && (name != "MQIsdp" || p.version != version31) {
+		return p, errUnacceptableVersion
+	}
+	flags := d.byte()
+	if flags&0x01 != 0 {
+		return nil, errMalformedPacket
+	}
+	p.cleanStart = flags&0x02 != 0
+	p.hasUsername = flags&0x80 != 0
+	p.hasPassword = flags&0x40 != 0
+	p.keepAlive = d.uint16()
+	if p.version == version5 {
+		d.skipProperties()
+	}
+	p.clientID = d.string()
+	if flags&0x04 != 0 {
+		if p.version == version5 {
+			d.skipProperties()
+		}
+		d.string()
+		d.binary()
+	}
+	if p.hasUsername {
+		p.username = d.string()
+	}
+	if p.hasPassword {
+		p.password = d.binary()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return p, nil
+}
+
+func (p *connectPacket) encode() []byte {
+	e := &encoder{}
+	e.string("MQTT")
+	e.byte(p.version)
+	var flags byte
+	if p.cleanStart {
+		flags |= 0x02
+	}
+	if p.hasUsername {
+		flags |= 0x80
+	}
+	if p.hasPassword {
+		flags |= 0x40
+	}
+	e.byte(flags)
+	e.uint16(p.keepAlive)
+	if p.version == version5 {
+		props := &encoder{}
+		if p.sessionExpiry > 0 {
+			props.byte(propSessionExpiryInterval)
+			props.uint32(p.sessionExpiry)
+		}
+		if p.receiveMaximum > 0 {
+			props.byte(propReceiveMaximum)
+			props.uint16(p.receiveMaximum)
+		}
+		if p.maximumPacketSize > 0 {
+			props.byte(propMaximumPacketSize)
+			props.uint32(p.maximumPacketSize)
+		}
+		e.properties(props.buf)
+	}
+	e.string(p.clientID)
+	if p.hasUsername {
+		e.string(p.username)
+	}
+	if p.hasPassword {
+		e.binary(p.password)
+	}
+	return newPacket(packetConnect<<4, e.buf)
+}
+
+type connackPacket struct {
+	sessionPresent bool
+	code           byte
+	// properties is the encoded properties of 5 without the length prefix
+	properties []byte
+}
+
+func (p *connackPacket) encode(version byte) []byte {
+	e := &encoder{}
+	if p.sessionPresent {
+		e.byte(1)
+	} else {
+		e.byte(0)
+	}
+	e.byte(p.code)
+	if version == version5 {
+		e.properties(p.properties)
+	}
+	return newPacket(packetConnack<<4, e.buf)
+}
+
+func decodeConnack(version byte, body []byte) (*connackPacket, error) {
+	d := &decoder{buf: body}
+	p := &connackPacket{sessionPresent: d.byte()&0x01 != 0, code: d.byte()}
+	if version == version5 && len(body) > 2 {
+		d.skipProperties()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return p, nil
+}
+
+type publishPacket struct {
+	topic    string
+	qos      byte
+	dup      bool
+	retain   bool
+	packetID uint16
+	payload  []byte
+}
+
+func decodePublish(version byte, header byte, body []byte) (*publishPacket, error) {
+	p := &publishPacket{
+		qos:    (header >> 1) & 0x03,
+		dup:    header&0x08 != 0,
+		retain: header&0x01 != 0,
+	}
+	if p.qos == 3 {
+		return nil, errMalformedPacket
+	}
+	d := &decoder{buf: body}
+	p.topic = d.string()
+	if p.qos > 0 {
+		p.packetID = d.uint16()
+	}
+	if version == version5 {
+		d.skipProperties()
+	}
+	p.payload = d.remaining()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(p.topic) == 0 || !validTopic(p.topic) {
+		return nil, errMalformedPacket
+	}
+	return p, nil
+}
+
+// encodePuback returns the puback packet, the reason code is omitted if it is success or the version is before 5.
+func encodePuback(version byte, packetID uint16, code byte) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 && code != codeSuccess {
+		e.byte(code)
+	}
+	return newPacket(packetPuback<<4, e.buf)
+}
+
+// decodeSubscribe returns the packet id and the count of the topic filters.
+func decodeSubscribe(version byte, body []byte) (uint16, int, error) {
+	d := &decoder{buf: body}
+	packetID := d.uint16()
+	if version == version5 {
+		d.skipProperties()
+	}
+	n := 0
+	for d.err == nil && d.off < len(d.buf) {
+		d.string()
+		d.byte()
+		n++
+	}
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+	if n == 0 {
+		return 0, 0, errMalformedPacket
+	}
+	return packetID, n, nil
+}
+
+func encodeSubscribe(version byte, packetID uint16, filters []string, qos []byte) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 {
+		e.properties(nil)
+	}
+	for i, filter := range filters {
+		e.string(filter)
+		e.byte(qos[i])
+	}
+	return newPacket(packetSubscribe<<4|0x02, e.buf)
+}
+
+func encodeSuback(version byte, packetID uint16, codes []byte) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 {
+		e.properties(nil)
+	}
+	e.buf = append(e.buf, codes...)
+	return newPacket(packetSuback<<4, e.buf)
+}
+
+// decodeSuback returns the packet id and the return codes.
+func decodeSuback(version byte, body []byte) (uint16, []byte, error) {
+	d := &decoder{buf: body}
+	packetID := d.uint16()
+	if version == version5 {
+		d.skipProperties()
+	}
+	codes := d.remaining()
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	return packetID, codes, nil
+}
+
+// decodeUnsubscribe returns the packet id and the count of the topic filters.
+func decodeUnsubscribe(version byte, body []byte) (uint16, int, error) {
+	d := &decoder{buf: body}
+	packetID := d.uint16()
+	if version == version5 {
+		d.skipProperties()
+	}
+	n := 0
+	for d.err == nil && d.off < len(d.buf) {
+		d.string()
+		n++
+	}
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+	if n == 0 {
+		return 0, 0, errMalformedPacket
+	}
+	return packetID, n, nil
+}
+
+func encodeUnsuback(version byte, packetID uint16, n int) []byte {
+	e := &encoder{}
+	e.uint16(packetID)
+	if version == version5 {
+		e.properties(nil)
+		for i := 0; i < n; i++ {
+			e.byte(codeNoSubscriptionExisted)
+		}
+	}
+	return newPacket(packetUnsuback<<4, e.buf)
+}
+
+// encodeDisconnect returns the disconnect packet, the reason code is only sent by 5.
+func encodeDisconnect(version byte, code byte) []byte {
+	if version == version5 && code != codeSuccess {
+		return newPacket(packetDisconnect<<4, []byte{code})
+	}
+	return newPacket(packetDisconnect<<4, nil)
+}
+
+func fixedHeaderFlagsValid(packetType byte, flags byte) bool {
+	switch packetType {
+	case packetPublish:
+		return true
+	case packetPubrel, packetSubscribe, packetUnsubscribe:
+		return flags == 0x02
+	default:
+		return flags == 0
+	}
+}
+
+func packetName(packetType byte) string {
+	switch packetType {
+	case packetConnect:
+		return "CONNECT"
+	case packetConnack:
+		return "CONNACK"
+	case packetPublish:
+		return "PUBLISH"
+	case packetPuback:
+		return "PUBACK"
+	case packetPubrec:
+		return "PUBREC"
+	case packetPubrel:
+		return "PUBREL"
+	case packetPubcomp:
+		return "PUBCOMP"
+	case packetSubscribe:
+		return "SUBSCRIBE"
+	case packetSuback:
+		return "SUBACK"
+	case packetUnsubscribe:
+		return "UNSUBSCRIBE"
+	case packetUnsuback:
+		return "UNSUBACK"
+	case packetPingreq:
+		return "PINGREQ"
+	case packetPingresp:
+		return "PINGRESP"
+	case packetDisconnect:
+		return "DISCONNECT"
+	case packetAuth:
+		return "AUTH"
+	}
+	return fmt.Sprintf("packet type %d", packetType)
+}
@@ -0,0 +1,252 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/tidwall/gjson"
+)
+
+var errInvalidJSON = errors.New("invalid json payload")
+
+// parser converts the payload of a message to the data written with the data of other messages of the same route,
+// it returns nil if the payload has no data.
+type parser interface {
+	parse(topic string, payload []byte) ([]byte, error)
+}
+
+func newParser(conf *RouteConfig) (parser, error) {
+	switch conf.Format {
+	case FormatInflux:
+		return influxParser{}, nil
+	case FormatOpentsdbJSON:
+		return opentsdbJSONParser{}, nil
+	case FormatJSON:
+		return newJSONParser(conf), nil
+	}
+	return nil, fmt.Errorf("unknown mqtt payload format %s", conf.Format)
+}
+
+// separator returns the separator between the data of the messages in a batch.
+func separator(format string) []byte {
+	if format == FormatOpentsdbJSON {
+		return []byte{','}
+	}
+	return []byte{'\n'}
+}
+
+// influxParser passes the lines of the influxdb line protocol through.
+type influxParser struct{}
+
+func (influxParser) parse(_ string, payload []byte) ([]byte, error) {
+	data := bytes.TrimSpace(payload)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// opentsdbJSONParser returns the data points of the opentsdb json payload joined by commas, the batch is written as
+// a json array.
+type opentsdbJSONParser struct{}
+
+func (opentsdbJSONParser) parse(_ string, payload []byte) ([]byte, error) {
+	if !gjson.ValidBytes(payload) {
+		return nil, errInvalidJSON
+	}
+	result := gjson.ParseBytes(payload)
+	if result.IsObject() {
+		return []byte(result.Raw), nil
+	}
+	if !result.IsArray() {
+		return nil, errors.New("opentsdb json payload should be an object or an array")
+	}
+	var data []byte
+	var err error
+	result.ForEach(func(_, point gjson.Result) bool {
+		if !point.IsObject() {
+			err = errors.New("opentsdb json data point should be an object")
+			return false
+		}
+		if len(data) > 0 {
+			data = append(data, ',')
+		}
+		data = append(data, point.Raw...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// jsonParser maps the fields of json objects to the tags and columns of a super table, the rows are converted to the
+// influxdb line protocol of nanosecond precision.
+type jsonParser struct {
+	conf       *RouteConfig
+	tagNames   []string
+	topicTags  []string
+	fieldNames []string
+}
+
+func newJSONParser(conf *RouteConfig) *jsonParser {
+	return &jsonParser{
+		conf:       conf,
+		tagNames:   sortedKeys(conf.Tags),
+		topicTags:  sortedIntKeys(conf.TopicTags),
+		fieldNames: sortedKeys(conf.Columns),
+	}
+}
+
+func (p *jsonParser) parse(topic string, payload []byte) ([]byte, error) {
+	if !gjson.ValidBytes(payload) {
+		return nil, errInvalidJSON
+	}
+	var rows gjson.Result
+	if len(p.conf.Rows) > 0 {
+		rows = gjson.GetBytes(payload, p.conf.Rows)
+	} else {
+		rows = gjson.ParseBytes(payload)
+	}
+	var levels []string
+	if len(p.topicTags) > 0 {
+		levels = strings.Split(topic, "/")
+	}
+	var metrics []telegraf.Metric
+	var err error
+	handle := func(row gjson.Result) bool {
+		var m telegraf.Metric
+		m, err = p.metric(levels, row)
+		if err != nil {
+			return false
+		}
+		if m != nil {
+			metrics = append(metrics, m)
+		}
+		return true
+	}
+	if rows.IsArray() {
+		rows.ForEach(func(_, row gjson.Result) bool {
+			return handle(row)
+		})
+	} else if rows.Exists() {
+		handle(rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	data, err := influx.NewSerializer().SerializeBatch(metrics)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(data), nil
+}
+
+// metric returns the metric of the row, it returns nil if no column is found in the row.
+func (p *jsonParser) metric(levels []string, row gjson.Result) (telegraf.Metric, error) {
+	if !row.IsObject() {
+		return nil, errors.New("json row should be an object")
+	}
+	// the fields are added in the order of the names, the fields of a map are in random order
+	var fields []*telegraf.Field
+	for _, name := range p.fieldNames {
+		value := row.Get(p.conf.Columns[name])
+		var v interface{}
+		switch value.Type {
+		case gjson.Number:
+			v = value.Float()
+		case gjson.String:
+			v = value.Str
+		case gjson.True, gjson.False:
+			v = value.Bool()
+		case gjson.JSON:
+			v = value.Raw
+		default:
+			continue
+		}
+		fields = append(fields, &telegraf.Field{Key: name, Value: v})
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(p.tagNames)+len(p.topicTags))
+	for _, name := range p.tagNames {
+		value := row.Get(p.conf.Tags[name])
+		if value.Exists() && value.Type != gjson.Null {
+			tags[name] = value.String()
+		}
+	}
+	for _, name := range p.topicTags {
+		index := p.conf.TopicTags[name]
+		if index >= 0 && index < len(levels) && len(levels[index]) > 0 {
+			tags[name] = levels[index]
+		}
+	}
+	ts, err := p.timestamp(row)
+	if err != nil {
+		return nil, err
+	}
+	m := metric.New(p.conf.STable, tags, nil, ts)
+	for _, field := range fields {
+		m.AddField(field.Key, field.Value)
+	}
+	return m, nil
+}
+
+// timestamp returns the timestamp of the row, a number is the unix timestamp of the timestampPrecision and a string
+// is of RFC3339 format. The current time is used if the timestamp path is not configured.
+func (p *jsonParser) timestamp(row gjson.Result) (time.Time, error) {
+	if len(p.conf.Timestamp) == 0 {
+		return time.Now(), nil
+	}
+	value := row.Get(p.conf.Timestamp)
+	switch value.Type {
+	case gjson.Number:
+		v := value.Int()
+		switch p.conf.TimestampPrecision {
+		case "s":
+			return time.Unix(v, 0), nil
+		case "us":
+			return time.Unix(0, v*int64(time.Microsecond)), nil
+		case "ns":
+			return time.Unix(0, v), nil
+		default:
+			return time.Unix(0, v*int64(time.Millisecond)), nil
+		}
+	case gjson.String:
+		ts, err := time.Parse(time.RFC3339Nano, value.Str)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %s", value.Str)
+		}
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("timestamp %s not found", p.conf.Timestamp)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedIntKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
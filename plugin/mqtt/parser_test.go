@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxParser(t *testing.T) {
+	data, err := influxParser{}.parse("t", []byte("m,t1=a v=1 1\nm,t1=b v=2 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "m,t1=a v=1 1\nm,t1=b v=2 2", string(data))
+	data, err = influxParser{}.parse("t", []byte(" \n"))
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestOpentsdbJSONParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		data    string
+		wantErr bool
+	}{
+		{
+			name:    "object",
+			payload: `{"metric":"sys.cpu","timestamp":1,"value":1,"tags":{"host":"a"}}`,
+			data:    `{"metric":"sys.cpu","timestamp":1,"value":1,"tags":{"host":"a"}}`,
+		},
+		{
+			name:    "array",
+			payload: ` [{"metric":"m","timestamp":1,"value":1,"tags":{"t":"a"}}, {"metric":"m","timestamp":2,"value":2,"tags":{"t":"a"}}] `,
+			data:    `{"metric":"m","timestamp":1,"value":1,"tags":{"t":"a"}},{"metric":"m","timestamp":2,"value":2,"tags":{"t":"a"}}`,
+		},
+		{
+			name:    "empty array",
+			payload: `[]`,
+		},
+		{
+			name:    "invalid json",
+			payload: `{"metric":`,
+			wantErr: true,
+		},
+		{
+			name:    "not object",
+			payload: `[1]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := opentsdbJSONParser{}.parse("t", []byte(tt.payload))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.data, string(data))
+		})
+	}
+}
+
+func TestJSONParser(t *testing.T) {
+	conf := &RouteConfig{
+		Topic:              "sensors/+/data",
+		DB:                 "iot",
+		Format:             FormatJSON,
+		STable:             "meters",
+		Timestamp:          "ts",
+		TimestampPrecision: "ms",
+		Rows:               "rows",
+		Tags:               map[string]string{"location": "site.name"},
+		TopicTags:          map[string]int{"device": 1},
+		Columns:            map[string]string{"current": "values.current", "status": "status", "on": "on"},
+	}
+	p := newJSONParser(conf)
+	data, err := p.parse("sensors/d1001/data", []byte(`{"site":{"name":"beijing"},"rows":[
+{"ts":1700000000000,"values":{"current":10.5},"status":"ok","on":true},
+{"ts":"2023-11-14T22:13:21Z","values":{"current":11},"on":false},
+{"ts":1700000002000,"values":{}}
+]}`))
+	require.NoError(t, err)
+	// the tags paths are relative to the rows, the third row has no column
+	assert.Equal(t, "meters,device=d1001 current=10.5,on=true,status=\"ok\" 1700000000000000000\n"+
+		"meters,device=d1001 current=11,on=false 1700000001000000000", string(data))
+
+	conf.Rows = ""
+	conf.Tags = map[string]string{"location": "site"}
+	conf.TimestampPrecision = "s"
+	p = newJSONParser(conf)
+	data, err = p.parse("sensors/d1002/data", []byte(`{"site":"shanghai","ts":1700000000,"values":{"current":1}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "meters,device=d1002,location=shanghai current=1 1700000000000000000", string(data))
+
+	_, err = p.parse("sensors/d1002/data", []byte(`{"values":{"current":1}}`))
+	assert.Error(t, err)
+	_, err = p.parse("sensors/d1002/data", []byte(`{"ts":"yesterday","values":{"current":1}}`))
+	assert.Error(t, err)
+	_, err = p.parse("sensors/d1002/data", []byte(`[1]`))
+	assert.Error(t, err)
+	_, err = p.parse("sensors/d1002/data", []byte(`{`))
+	assert.Equal(t, errInvalidJSON, err)
+}
@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"net"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
+	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/joinerror"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "mqtt")
+
+// Plugin writes the messages published by the mqtt clients or subscribed from an external broker, the topics are
+// mapped to the databases and payload formats by the routes.
+type Plugin struct {
+	conf     Config
+	router   *router
+	writer   *writer
+	listener *listener
+	client   *client
+	spool    *spool.Spool
+}
+
+func (p *Plugin) Init(_ gin.IRouter) error {
+	if err := p.conf.setValue(); err != nil {
+		return err
+	}
+	if !p.conf.Enable {
+		logger.Info("mqtt disabled")
+		return nil
+	}
+	if err := p.conf.check(); err != nil {
+		return err
+	}
+	var err error
+	p.router, err = newRouter(p.conf.Routes)
+	return err
+}
+
+func (p *Plugin) Start() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	var err error
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			format, precision, data, err := decodeSpoolData(r.Data)
+			if err != nil {
+				return err
+			}
+			return p.insert(r.ClientIP, r.DB, format, precision, data)
+		})
+	}
+	p.writer = newWriter(&p.conf, p.spool, p.insert)
+	p.writer.start()
+	if p.conf.Mode == ModeClient {
+		p.client = newClient(&p.conf, p.router, p.writer)
+		p.client.start()
+		return nil
+	}
+	p.listener = newListener(&p.conf, p.router, p.writer)
+	return p.listener.start(p.conf.Port)
+}
+
+func (p *Plugin) Stop() error {
+	if !p.conf.Enable || p.writer == nil {
+		return nil
+	}
+	var errs []error
+	if p.client != nil {
+		p.client.stop()
+	}
+	if p.listener != nil && p.listener.ln != nil {
+		if err := p.listener.stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// write the cached messages after all connections are closed
+	p.writer.stop()
+	if p.spool != nil {
+		if err := p.spool.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return joinerror.Join(errs...)
+	}
+	return nil
+}
+
+func (p *Plugin) String() string {
+	return "mqtt"
+}
+
+func (p *Plugin) Version() string {
+	return "v1"
+}
+
+func (p *Plugin) insert(clientIP net.IP, db, format, precision string, data []byte) error {
+	taosConn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, clientIP)
+	if err != nil {
+		logger.WithError(err).Error("connect server error")
+		return err
+	}
+	defer func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}()
+	isDebug := log.IsDebug()
+	start := log.GetLogNow(isDebug)
+	reqID := generator.GetReqID()
+	execLogger := logger.WithField(config.ReqIDKey, reqID)
+	execLogger.Debugf("insert %s, data:%s, db:%s, ttl:%d", format, data, db, p.conf.TTL)
+	if format == FormatOpentsdbJSON {
+		err = inserter.InsertOpentsdbJson(taosConn.TaosConnection, data, db, p.conf.TTL, uint64(reqID), "", execLogger)
+	} else {
+		err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, db, precision, p.conf.TTL, uint64(reqID), "", execLogger)
+	}
+	execLogger.Debugf("insert %s finish, cost:%s", format, log.GetLogDuration(isDebug, start))
+	if err != nil {
+		execLogger.WithError(err).Errorf("insert %s error, data:%s", format, data)
+		return err
+	}
+	return nil
+}
+
+func init() {
+	plugin.Register(&Plugin{})
+}
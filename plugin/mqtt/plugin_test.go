@@ -0,0 +1,425 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+)
+
+type insertCall struct {
+	db        string
+	format    string
+	precision string
+	data      string
+}
+
+type fakeInserter struct {
+	lock  sync.Mutex
+	calls []insertCall
+	err   error
+	// invalid fails the data containing it with a data error
+	invalid string
+}
+
+func (f *fakeInserter) insert(_ net.IP, db, format, precision string, data []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, insertCall{db: db, format: format, precision: precision, data: string(data)})
+	if len(f.invalid) > 0 && strings.Contains(string(data), f.invalid) {
+		return tErrors.NewError(0x3002, "Invalid data format")
+	}
+	return f.err
+}
+
+func (f *fakeInserter) getCalls() []insertCall {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]insertCall{}, f.calls...)
+}
+
+func testConfig(mode string, batchSize int, flushInterval time.Duration) *Config {
+	return &Config{
+		Enable:            true,
+		Mode:              mode,
+		MaxConnections:    10,
+		MaxInflight:       10,
+		MaxPacketSize:     1 << 20,
+		ClientID:          "taosadapter",
+		ProtocolVersion:   5,
+		KeepAlive:         time.Second,
+		ReconnectInterval: 10 * time.Millisecond,
+		Worker:            1,
+		BatchSize:         batchSize,
+		FlushInterval:     flushInterval,
+		Routes: []*RouteConfig{
+			{Topic: "influx/#", DB: "db1", QoS: 1},
+			{Topic: "opentsdb/+", DB: "db2", Format: FormatOpentsdbJSON},
+			{Topic: "sensors/+/data", DB: "db3", Format: FormatJSON, STable: "meters", TopicTags: map[string]int{"device": 1}, Timestamp: "ts", Columns: map[string]string{"current": "current"}},
+		},
+	}
+}
+
+func startListener(t *testing.T, conf *Config, inserter *fakeInserter) string {
+	conf.Port = 1883
+	require.NoError(t, conf.check())
+	r, err := newRouter(conf.Routes)
+	require.NoError(t, err)
+	w := newWriter(conf, nil, inserter.insert)
+	w.start()
+	l := newListener(conf, r, w)
+	require.NoError(t, l.start(0))
+	t.Cleanup(func() {
+		assert.NoError(t, l.stop())
+		w.stop()
+	})
+	return l.ln.Addr().String()
+}
+
+type testClient struct {
+	t       *testing.T
+	conn    net.Conn
+	reader  *bufio.Reader
+	version byte
+}
+
+func dial(t *testing.T, address string, version byte) *testClient {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	c := &testClient{t: t, conn: conn, reader: bufio.NewReader(conn), version: version}
+	c.write((&connectPacket{version: version, cleanStart: true, keepAlive: 10, clientID: "c1"}).encode())
+	header, body := c.read()
+	require.Equal(t, packetConnack, header>>4)
+	connack, err := decodeConnack(version, body)
+	require.NoError(t, err)
+	require.Equal(t, codeSuccess, connack.code)
+	return c
+}
+
+func (c *testClient) write(b []byte) {
+	_, err := c.conn.Write(b)
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) read() (byte, []byte) {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	header, body, err := readPacket(c.reader, maxRemainingLength)
+	require.NoError(c.t, err)
+	return header, body
+}
+
+// noPacket asserts that no packet is received in a short time.
+func (c *testClient) noPacket() {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err := c.reader.Peek(1)
+	var netErr net.Error
+	require.True(c.t, errors.As(err, &netErr) && netErr.Timeout(), "unexpected packet or error %v", err)
+}
+
+func (c *testClient) publish(topic string, qos byte, packetID uint16, payload string) {
+	e := &encoder{}
+	e.string(topic)
+	if qos > 0 {
+		e.uint16(packetID)
+	}
+	if c.version == version5 {
+		e.properties(nil)
+	}
+	e.buf = append(e.buf, payload...)
+	c.write(newPacket(packetPublish<<4|qos<<1, e.buf))
+}
+
+// puback returns the packet id and the reason code of a puback packet.
+func (c *testClient) puback() (uint16, byte) {
+	header, body := c.read()
+	require.Equal(c.t, packetPuback, header>>4)
+	d := &decoder{buf: body}
+	packetID := d.uint16()
+	code := codeSuccess
+	if len(body) > 2 {
+		code = d.byte()
+	}
+	return packetID, code
+}
+
+func TestListenerQoS1(t *testing.T) {
+	for _, version := range []byte{version311, version5} {
+		inserter := &fakeInserter{}
+		address := startListener(t, testConfig(ModeListener, 3, 0), inserter)
+		c := dial(t, address, version)
+		c.publish("influx/a", 1, 1, "m v=1 1")
+		c.publish("influx/b", 0, 0, "m v=2 2\n")
+		c.noPacket()
+		assert.Empty(t, inserter.getCalls())
+		c.publish("influx/c", 1, 2, "m v=3 3")
+		for _, id := range []uint16{1, 2} {
+			packetID, code := c.puback()
+			assert.Equal(t, id, packetID)
+			assert.Equal(t, codeSuccess, code)
+		}
+		assert.Equal(t, []insertCall{{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1\nm v=2 2\nm v=3 3"}}, inserter.getCalls())
+	}
+}
+
+func TestListenerAckOrder(t *testing.T) {
+	inserter := &fakeInserter{}
+	address := startListener(t, testConfig(ModeListener, 100, 50*time.Millisecond), inserter)
+	c := dial(t, address, version5)
+	c.publish("influx/a", 1, 1, "m v=1 1")
+	// the messages not routed or not parsed are acknowledged after the messages before them
+	c.publish("unknown", 1, 2, "m v=1 1")
+	c.publish("sensors/d1/data", 1, 3, "{")
+	c.publish("opentsdb/a", 1, 4, `[{"metric":"m","timestamp":1,"value":1,"tags":{"t":"a"}},{"metric":"m","timestamp":2,"value":2,"tags":{"t":"a"}}]`)
+	c.publish("opentsdb/a", 1, 5, `{"metric":"m","timestamp":3,"value":3,"tags":{"t":"a"}}`)
+	c.publish("sensors/d1/data", 1, 6, `{"ts":1700000000000,"current":1.5}`)
+	codes := []byte{codeSuccess, codeNoMatchingSubscribers, codePayloadFormatInvalid, codeSuccess, codeSuccess, codeSuccess}
+	for i, code := range codes {
+		packetID, reason := c.puback()
+		assert.Equal(t, uint16(i+1), packetID)
+		assert.Equal(t, code, reason)
+	}
+	calls := inserter.getCalls()
+	require.Len(t, calls, 3)
+	byDB := make(map[string]insertCall, len(calls))
+	for _, call := range calls {
+		byDB[call.db] = call
+	}
+	assert.Equal(t, insertCall{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1"}, byDB["db1"])
+	assert.Equal(t, insertCall{db: "db2", format: FormatOpentsdbJSON, data: `[{"metric":"m","timestamp":1,"value":1,"tags":{"t":"a"}},{"metric":"m","timestamp":2,"value":2,"tags":{"t":"a"}},{"metric":"m","timestamp":3,"value":3,"tags":{"t":"a"}}]`}, byDB["db2"])
+	assert.Equal(t, insertCall{db: "db3", format: FormatJSON, precision: "ns", data: "meters,device=d1 current=1.5 1700000000000000000"}, byDB["db3"])
+}
+
+func TestListenerInsertError(t *testing.T) {
+	for _, version := range []byte{version311, version5} {
+		inserter := &fakeInserter{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+		address := startListener(t, testConfig(ModeListener, 1, 0), inserter)
+		c := dial(t, address, version)
+		c.publish("influx/a", 1, 1, "m v=1 1")
+		// the message is not acknowledged and the connection is closed
+		if version == version5 {
+			header, body := c.read()
+			assert.Equal(t, packetDisconnect, header>>4)
+			assert.Equal(t, []byte{codeUnspecifiedError}, body)
+		}
+		require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err := readPacket(c.reader, maxRemainingLength)
+		assert.Error(t, err)
+		assert.Len(t, inserter.getCalls(), 1)
+	}
+}
+
+func TestListenerDataError(t *testing.T) {
+	inserter := &fakeInserter{invalid: "bad"}
+	address := startListener(t, testConfig(ModeListener, 3, 0), inserter)
+	c := dial(t, address, version5)
+	c.publish("influx/a", 1, 1, "m v=1 1")
+	c.publish("influx/a", 1, 2, "m v=bad 2")
+	c.publish("influx/a", 1, 3, "m v=3 3")
+	// only the rejected message gets the error, the connection is kept
+	codes := []byte{codeSuccess, codeImplementationSpecificError, codeSuccess}
+	for i, code := range codes {
+		packetID, reason := c.puback()
+		assert.Equal(t, uint16(i+1), packetID)
+		assert.Equal(t, code, reason)
+	}
+	assert.Equal(t, []insertCall{
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1\nm v=bad 2\nm v=3 3"},
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1"},
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=bad 2"},
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=3 3"},
+	}, inserter.getCalls())
+	c.publish("influx/a", 1, 4, "m v=4 4")
+	c.publish("influx/a", 1, 5, "m v=5 5")
+	c.publish("influx/a", 1, 6, "m v=6 6")
+	for i := 4; i <= 6; i++ {
+		packetID, reason := c.puback()
+		assert.Equal(t, uint16(i), packetID)
+		assert.Equal(t, codeSuccess, reason)
+	}
+}
+
+func TestSessionStalledConnection(t *testing.T) {
+	server, peer := net.Pipe()
+	defer func() {
+		_ = peer.Close()
+	}()
+	s := newSession(server, version5, true, localhost, 10, nil, nil, logger)
+	defer s.close()
+	go s.sendAcks()
+	acks := make([]*pendingAck, 3)
+	for i := range acks {
+		s.inflight <- struct{}{}
+		acks[i] = &pendingAck{packetID: uint16(i + 1), code: codeSuccess}
+		s.acks = append(s.acks, acks[i])
+	}
+	// the peer does not read, completing the messages must not wait for the connection
+	done := make(chan struct{})
+	go func() {
+		for _, ack := range acks {
+			s.complete(ack, nil)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("complete blocked by the connection")
+	}
+	reader := bufio.NewReader(peer)
+	for i := 1; i <= 3; i++ {
+		header, body, err := readPacket(reader, maxRemainingLength)
+		require.NoError(t, err)
+		assert.Equal(t, packetPuback, header>>4)
+		assert.Equal(t, uint16(i), (&decoder{buf: body}).uint16())
+	}
+	require.Eventually(t, func() bool { return len(s.inflight) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestListenerPackets(t *testing.T) {
+	inserter := &fakeInserter{}
+	address := startListener(t, testConfig(ModeListener, 1, 0), inserter)
+	for _, version := range []byte{version311, version5} {
+		c := dial(t, address, version)
+		c.write(newPacket(packetPingreq<<4, nil))
+		header, _ := c.read()
+		assert.Equal(t, packetPingresp, header>>4)
+
+		c.write(encodeSubscribe(version, 3, []string{"a/+", "b"}, []byte{1, 0}))
+		header, body := c.read()
+		require.Equal(t, packetSuback, header>>4)
+		packetID, codes, err := decodeSuback(version, body)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(3), packetID)
+		assert.Equal(t, []byte{codeUnspecifiedError, codeUnspecifiedError}, codes)
+
+		c.publish("influx/a", 2, 4, "m v=1 1")
+		if version == version5 {
+			header, body = c.read()
+			assert.Equal(t, packetDisconnect, header>>4)
+			assert.Equal(t, []byte{codeQoSNotSupported}, body)
+		}
+		require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = readPacket(c.reader, maxRemainingLength)
+		assert.Error(t, err)
+	}
+	assert.Empty(t, inserter.getCalls())
+}
+
+func TestListenerConnect(t *testing.T) {
+	address := startListener(t, testConfig(ModeListener, 1, 0), &fakeInserter{})
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	_, err = conn.Write((&connectPacket{version: 6, clientID: "c1"}).encode())
+	require.NoError(t, err)
+	header, body, err := readPacket(reader, maxRemainingLength)
+	require.NoError(t, err)
+	assert.Equal(t, packetConnack, header>>4)
+	assert.Equal(t, []byte{0, codeUnacceptableVersion}, body)
+
+	conn, err = net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader = bufio.NewReader(conn)
+	_, err = conn.Write((&connectPacket{version: version5, cleanStart: true}).encode())
+	require.NoError(t, err)
+	header, body, err = readPacket(reader, maxRemainingLength)
+	require.NoError(t, err)
+	assert.Equal(t, packetConnack, header>>4)
+	// the client id is assigned
+	assert.Contains(t, string(body), "taosadapter-")
+}
+
+func TestClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = ln.Close()
+	}()
+	conf := testConfig(ModeClient, 1, 0)
+	conf.Broker = "tcp://" + ln.Addr().String()
+	conf.BrokerUser = "user"
+	conf.BrokerPassword = "password"
+	require.NoError(t, conf.check())
+	r, err := newRouter(conf.Routes)
+	require.NoError(t, err)
+	inserter := &fakeInserter{}
+	w := newWriter(conf, nil, inserter.insert)
+	w.start()
+	c := newClient(conf, r, w)
+	c.start()
+	defer func() {
+		c.stop()
+		w.stop()
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := ln.Accept()
+		require.NoError(t, err)
+		broker := &testClient{t: t, conn: conn, reader: bufio.NewReader(conn), version: version5}
+		header, body := broker.read()
+		require.Equal(t, packetConnect, header>>4)
+		connect, err := decodeConnect(body)
+		require.NoError(t, err)
+		assert.Equal(t, "taosadapter", connect.clientID)
+		assert.Equal(t, "user", connect.username)
+		assert.Equal(t, "password", string(connect.password))
+		assert.False(t, connect.cleanStart)
+		assert.Equal(t, uint16(1), connect.keepAlive)
+		broker.write((&connackPacket{code: codeSuccess}).encode(version5))
+
+		header, body = broker.read()
+		require.Equal(t, packetSubscribe, header>>4)
+		packetID, n, err := decodeSubscribe(version5, body)
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		assert.True(t, strings.Contains(string(body), "sensors/+/data"))
+		broker.write(encodeSuback(version5, packetID, []byte{1, 0, 0x87}))
+
+		broker.publish("influx/a", 1, 7, "m v=1 1")
+		for {
+			header, body = broker.read()
+			if header>>4 != packetPingreq {
+				break
+			}
+		}
+		require.Equal(t, packetPuback, header>>4)
+		assert.Equal(t, []byte{0, 7}, body)
+		// the client reconnects after the connection is closed
+		_ = conn.Close()
+	}
+	assert.Equal(t, []insertCall{
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1"},
+		{db: "db1", format: FormatInflux, precision: "ns", data: "m v=1 1"},
+	}, inserter.getCalls())
+}
+
+func TestSpoolData(t *testing.T) {
+	format, precision, data, err := decodeSpoolData(encodeSpoolData(FormatInflux, "ms", []byte("m v=1 1\nm v=2 2")))
+	require.NoError(t, err)
+	assert.Equal(t, FormatInflux, format)
+	assert.Equal(t, "ms", precision)
+	assert.Equal(t, "m v=1 1\nm v=2 2", string(data))
+	format, precision, data, err = decodeSpoolData(encodeSpoolData(FormatOpentsdbJSON, "", []byte("[]")))
+	require.NoError(t, err)
+	assert.Equal(t, FormatOpentsdbJSON, format)
+	assert.Equal(t, "", precision)
+	assert.Equal(t, "[]", string(data))
+	_, _, _, err = decodeSpoolData([]byte("influx"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package mqtt
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/monitor"
+)
+
+const writeTimeout = 10 * time.Second
+
+var (
+	errSessionClosed   = errors.New("mqtt session closed")
+	errQoSNotSupported = errors.New("mqtt qos 2 not supported")
+	errPaused          = errors.New("write paused")
+)
+
+// pendingAck is a qos 1 message waiting for the write of its data.
+type pendingAck struct {
+	packetID  uint16
+	code      byte
+	completed bool
+	err       error
+}
+
+// session handles the publish packets received by a connection, it is shared by the listener and the client. The
+// data of a qos 1 message is acknowledged after it is written, and the acknowledgements are sent in the order the
+// messages are received. The connection is closed if a write fails so that the sender publishes the unacknowledged
+// messages again. The acknowledgements are queued by the writer and sent by sendAcks, so a slow connection never
+// blocks the writer.
+type session struct {
+	conn     net.Conn
+	version  byte
+	server   bool
+	clientIP net.IP
+	router   *router
+	writer   *writer
+	logger   *logrus.Entry
+
+	writeLock sync.Mutex
+	inflight  chan struct{}
+	ackLock   sync.Mutex
+	acks      []*pendingAck
+	failed    bool
+	// ackPackets are the encoded acknowledgements not sent yet, ackCount is the number of the completed messages,
+	// their inflight slots are released after the acknowledgements are sent
+	ackPackets []byte
+	ackCount   int
+	ackReady   chan struct{}
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+func newSession(conn net.Conn, version byte, server bool, clientIP net.IP, maxInflight int, router *router, writer *writer, logger *logrus.Entry) *session {
+	return &session{
+		conn:     conn,
+		version:  version,
+		server:   server,
+		clientIP: clientIP,
+		router:   router,
+		writer:   writer,
+		logger:   logger,
+		inflight: make(chan struct{}, maxInflight),
+		ackReady: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (s *session) write(b []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// handlePublish routes the message and sends its data to the writer, it blocks while the unacknowledged messages
+// reach the max inflight.
+func (s *session) handlePublish(p *publishPacket) error {
+	if p.qos == 2 {
+		return errQoSNotSupported
+	}
+	var data []byte
+	code := codeSuccess
+	rt := s.router.match(p.topic)
+	if rt == nil {
+		s.logger.Debugf("no route of topic %s", p.topic)
+		code = codeNoMatchingSubscribers
+	} else if !monitor.AllPaused() {
+		var err error
+		data, err = rt.parser.parse(p.topic, p.payload)
+		if err != nil {
+			s.logger.WithError(err).Errorf("parse %s payload of topic %s error, payload:%s", rt.conf.Format, p.topic, p.payload)
+			code = codePayloadFormatInvalid
+			data = nil
+		}
+	} else if p.qos == 1 {
+		return errPaused
+	}
+	if p.qos == 0 {
+		if data != nil {
+			s.writer.add(&message{route: rt, clientIP: s.clientIP, data: data})
+		}
+		return nil
+	}
+	select {
+	case s.inflight <- struct{}{}:
+	case <-s.closed:
+		return errSessionClosed
+	}
+	ack := &pendingAck{packetID: p.packetID, code: code}
+	s.ackLock.Lock()
+	s.acks = append(s.acks, ack)
+	s.ackLock.Unlock()
+	if data == nil {
+		s.complete(ack, nil)
+		return nil
+	}
+	s.writer.add(&message{route: rt, clientIP: s.clientIP, data: data, done: func(err error) {
+		if err != nil && !tool.IsConnectionError(err) {
+			// the message is rejected by TDengine and fails again when it is redelivered, so it is dropped
+			s.logger.WithError(err).Errorf("write message of topic %s error, drop message, data:%s", p.topic, data)
+			ack.code = codeImplementationSpecificError
+			err = nil
+		}
+		s.complete(ack, err)
+	}})
+	return nil
+}
+
+// complete marks the message written and queues the acknowledgements of the written messages in order.
+func (s *session) complete(ack *pendingAck, err error) {
+	s.ackLock.Lock()
+	ack.completed = true
+	ack.err = err
+	queued := false
+	for len(s.acks) > 0 && s.acks[0].completed {
+		head := s.acks[0]
+		s.acks[0] = nil
+		s.acks = s.acks[1:]
+		s.ackCount += 1
+		queued = true
+		if head.err != nil {
+			s.failed = true
+		}
+		if !s.failed {
+			s.ackPackets = append(s.ackPackets, encodePuback(s.version, head.packetID, head.code)...)
+		}
+	}
+	s.ackLock.Unlock()
+	if queued {
+		select {
+		case s.ackReady <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sendAcks sends the queued acknowledgements until the session is closed, the connection is closed after a failed
+// write.
+func (s *session) sendAcks() {
+	for {
+		select {
+		case <-s.ackReady:
+		case <-s.closed:
+			return
+		}
+		s.ackLock.Lock()
+		packets, count, failed := s.ackPackets, s.ackCount, s.failed
+		s.ackPackets, s.ackCount = nil, 0
+		s.ackLock.Unlock()
+		if len(packets) > 0 {
+			if err := s.write(packets); err != nil {
+				s.logger.WithError(err).Debug("write puback error")
+			}
+		}
+		for i := 0; i < count; i++ {
+			<-s.inflight
+		}
+		if failed {
+			s.closeWithCode(codeUnspecifiedError)
+			return
+		}
+	}
+}
+
+// closeWithCode closes the connection, the listener sends the disconnect packet with the reason code to the clients
+// of 5 before closing.
+func (s *session) closeWithCode(code byte) {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		if s.server && s.version == version5 && code != codeSuccess {
+			_ = s.write(encodeDisconnect(s.version, code))
+		}
+		_ = s.conn.Close()
+	})
+}
+
+func (s *session) close() {
+	s.closeWithCode(codeSuccess)
+}
@@ -0,0 +1,100 @@
+package mqtt
+
+import (
+	"strings"
+)
+
+const sharePrefix = "$share/"
+
+// validTopic reports whether the topic name of a publish packet is valid, the topic name has no wildcards.
+func validTopic(topic string) bool {
+	return !strings.ContainsAny(topic, "+#\x00")
+}
+
+// validFilter reports whether the topic filter is valid, "+" matches a level and "#" matches the remaining levels.
+func validFilter(filter string) bool {
+	filter = trimShare(filter)
+	if len(filter) == 0 || strings.ContainsRune(filter, 0) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level == "#" {
+			if i != len(levels)-1 {
+				return false
+			}
+			continue
+		}
+		if level != "+" && strings.ContainsAny(level, "+#") {
+			return false
+		}
+	}
+	return true
+}
+
+// trimShare returns the topic filter of a shared subscription "$share/{group}/{filter}", other filters are returned
+// as is.
+func trimShare(filter string) string {
+	if !strings.HasPrefix(filter, sharePrefix) {
+		return filter
+	}
+	rest := filter[len(sharePrefix):]
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return ""
+	}
+	return rest[i+1:]
+}
+
+// matchTopic reports whether the topic name matches the topic filter, the topics starting with "$" are not matched
+// by the wildcards at the first level.
+func matchTopic(filter, topic string) bool {
+	filter = trimShare(filter)
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			// "a/#" also matches "a"
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// route is a configured route with the parser of its payload format.
+type route struct {
+	conf   *RouteConfig
+	parser parser
+}
+
+// router returns the first route whose topic filter matches the topic.
+type router struct {
+	routes []*route
+}
+
+func newRouter(routes []*RouteConfig) (*router, error) {
+	r := &router{routes: make([]*route, 0, len(routes))}
+	for _, conf := range routes {
+		p, err := newParser(conf)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, &route{conf: conf, parser: p})
+	}
+	return r, nil
+}
+
+func (r *router) match(topic string) *route {
+	for _, rt := range r.routes {
+		if matchTopic(rt.conf.Topic, topic) {
+			return rt
+		}
+	}
+	return nil
+}
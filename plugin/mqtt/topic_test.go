@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{filter: "a/b", topic: "a/b", match: true},
+		{filter: "a/b", topic: "a/c", match: false},
+		{filter: "a/b", topic: "a/b/c", match: false},
+		{filter: "a/+", topic: "a/b", match: true},
+		{filter: "a/+", topic: "a/b/c", match: false},
+		{filter: "a/+/c", topic: "a/b/c", match: true},
+		{filter: "a/+", topic: "a/", match: true},
+		{filter: "a/#", topic: "a", match: true},
+		{filter: "a/#", topic: "a/b/c", match: true},
+		{filter: "#", topic: "a/b", match: true},
+		{filter: "#", topic: "$SYS/a", match: false},
+		{filter: "+/a", topic: "$SYS/a", match: false},
+		{filter: "$SYS/#", topic: "$SYS/a", match: true},
+		{filter: "$share/g1/a/+", topic: "a/b", match: true},
+		{filter: "$share/g1/a/+", topic: "b/b", match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.match, matchTopic(tt.filter, tt.topic))
+		})
+	}
+}
+
+func TestValidFilter(t *testing.T) {
+	for _, filter := range []string{"a", "a/b", "+", "#", "a/+/b", "a/#", "+/+", "$share/g/a/#"} {
+		assert.True(t, validFilter(filter), filter)
+	}
+	for _, filter := range []string{"", "a/#/b", "a+", "a/b#", "$share/g", "$share/g/"} {
+		assert.False(t, validFilter(filter), filter)
+	}
+	assert.True(t, validTopic("a/b"))
+	assert.False(t, validTopic("a/+"))
+	assert.False(t, validTopic("a/#"))
+}
@@ -0,0 +1,189 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
+)
+
+// message is the parsed data of a published message, done is called with the result of the write if it is not nil.
+type message struct {
+	route    *route
+	clientIP net.IP
+	data     []byte
+	done     func(err error)
+}
+
+type batchKey struct {
+	route    *route
+	clientIP string
+}
+
+// pendingBatch is the messages of a route from a client ip, the batch is written by the connection of the client ip
+// since the connection is checked against the whitelist of the client ip.
+type pendingBatch struct {
+	route    *route
+	clientIP net.IP
+	messages []*message
+}
+
+// insertFunc writes the data of the format to the database.
+type insertFunc func(clientIP net.IP, db, format, precision string, data []byte) error
+
+// writer writes the messages in batches by the workers, a batch is written when it has batchSize messages or at the
+// flush interval.
+type writer struct {
+	conf     *Config
+	spool    *spool.Spool
+	insert   insertFunc
+	messages chan *message
+	wg       sync.WaitGroup
+}
+
+func newWriter(conf *Config, s *spool.Spool, insert insertFunc) *writer {
+	return &writer{
+		conf:     conf,
+		spool:    s,
+		insert:   insert,
+		messages: make(chan *message, 2*conf.Worker),
+	}
+}
+
+func (w *writer) start() {
+	w.wg.Add(w.conf.Worker)
+	for i := 0; i < w.conf.Worker; i++ {
+		go w.work()
+	}
+}
+
+func (w *writer) add(m *message) {
+	w.messages <- m
+}
+
+// stop writes the cached messages, the messages must not be added after stop.
+func (w *writer) stop() {
+	close(w.messages)
+	w.wg.Wait()
+}
+
+func (w *writer) work() {
+	defer w.wg.Done()
+	batches := make(map[batchKey]*pendingBatch)
+	interval := w.conf.FlushInterval
+	if interval <= 0 {
+		interval = math.MaxInt64
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	flushAll := func() {
+		for key, b := range batches {
+			w.flush(b)
+			delete(batches, key)
+		}
+	}
+	for {
+		select {
+		case m, ok := <-w.messages:
+			if !ok {
+				flushAll()
+				return
+			}
+			key := batchKey{route: m.route, clientIP: m.clientIP.String()}
+			b := batches[key]
+			if b == nil {
+				b = &pendingBatch{route: m.route, clientIP: m.clientIP}
+				batches[key] = b
+			}
+			b.messages = append(b.messages, m)
+			if len(b.messages) >= w.conf.BatchSize {
+				w.flush(b)
+				delete(batches, key)
+			}
+		case <-ticker.C:
+			flushAll()
+		}
+	}
+}
+
+// flush writes the batch. If the batch fails for a reason other than the connection, the messages are written one by
+// one so that only the failed messages get the error.
+func (w *writer) flush(b *pendingBatch) {
+	err := w.write(b.route.conf, b.clientIP, b.messages)
+	if err == nil || len(b.messages) == 1 || tool.IsConnectionError(err) {
+		for _, m := range b.messages {
+			if m.done != nil {
+				m.done(err)
+			}
+		}
+		return
+	}
+	logger.WithError(err).Debugf("write batch of %d messages error, write the messages one by one", len(b.messages))
+	for i, m := range b.messages {
+		err = w.write(b.route.conf, b.clientIP, b.messages[i:i+1])
+		if m.done != nil {
+			m.done(err)
+		}
+	}
+}
+
+// write writes the data of the messages, the data is spooled if the write fails with a retryable error and the spool
+// is enabled. The messages are treated as written if they are spooled.
+func (w *writer) write(conf *RouteConfig, clientIP net.IP, messages []*message) error {
+	var data []byte
+	precision := conf.Precision
+	switch conf.Format {
+	case FormatOpentsdbJSON:
+		data = append(data, '[')
+		precision = ""
+	case FormatJSON:
+		precision = "ns"
+	}
+	for i, m := range messages {
+		if i > 0 {
+			data = append(data, separator(conf.Format)...)
+		}
+		data = append(data, m.data...)
+	}
+	if conf.Format == FormatOpentsdbJSON {
+		data = append(data, ']')
+	}
+	err := w.insert(clientIP, conf.DB, conf.Format, precision, data)
+	if err != nil && w.spool != nil && spool.Retryable(err) {
+		appendErr := w.spool.Append(&spool.Record{DB: conf.DB, ClientIP: clientIP, Data: encodeSpoolData(conf.Format, precision, data)})
+		if appendErr != nil {
+			logger.WithError(appendErr).Errorf("append spool record error, db:%s, data:%s", conf.DB, data)
+		} else {
+			err = nil
+		}
+	}
+	return err
+}
+
+// encodeSpoolData prefixes the data with the format and precision line since the routes of a spool record may be
+// changed before it is replayed.
+func encodeSpoolData(format, precision string, data []byte) []byte {
+	b := make([]byte, 0, len(format)+len(precision)+2+len(data))
+	b = append(b, format...)
+	b = append(b, ' ')
+	b = append(b, precision...)
+	b = append(b, '\n')
+	return append(b, data...)
+}
+
+func decodeSpoolData(b []byte) (string, string, []byte, error) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return "", "", nil, errors.New("invalid mqtt spool record")
+	}
+	j := bytes.IndexByte(b[:i], ' ')
+	if j < 0 {
+		return "", "", nil, errors.New("invalid mqtt spool record")
+	}
+	return string(b[:j]), string(b[j+1 : i]), b[i+1:], nil
+}
@@ -1,6 +1,8 @@
 package nodeexporter
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -24,9 +26,44 @@ type Config struct {
 	InsecureSkipVerify    bool
 	GatherDuration        time.Duration
 	TTL                   int
+	// Jobs are the scrape jobs, the urls and the http options above are ignored when jobs are set
+	Jobs []*JobConfig
 }
 
-func (c *Config) setValue() {
+// JobConfig is a scrape job, the targets are static or discovered from files in the Prometheus file_sd format.
+type JobConfig struct {
+	Name                  string
+	Targets               []string
+	Files                 []string
+	RefreshInterval       time.Duration
+	Scheme                string
+	MetricsPath           string
+	Labels                map[string]string
+	GatherDuration        time.Duration
+	ResponseTimeout       time.Duration
+	HttpUsername          string
+	HttpPassword          string
+	HttpBearerTokenString string
+	CaCertFile            string
+	CertFile              string
+	KeyFile               string
+	InsecureSkipVerify    *bool
+	RelabelConfigs        []*RelabelConfig
+	MetricRelabelConfigs  []*RelabelConfig
+}
+
+// RelabelConfig is a relabel rule with the same meaning as the Prometheus relabel_config.
+type RelabelConfig struct {
+	SourceLabels []string
+	Separator    *string
+	Regex        *string
+	TargetLabel  string
+	Replacement  *string
+	Action       string
+	Modulus      uint64
+}
+
+func (c *Config) setValue() error {
 	c.Enable = viper.GetBool("node_exporter.enable")
 	c.DB = viper.GetString("node_exporter.db")
 	c.User = viper.GetString("node_exporter.user")
@@ -42,6 +79,59 @@ func (c *Config) setValue() {
 	c.InsecureSkipVerify = viper.GetBool("node_exporter.insecureSkipVerify")
 	c.GatherDuration = viper.GetDuration("node_exporter.gatherDuration")
 	c.TTL = viper.GetInt("node_exporter.ttl")
+	c.Jobs = nil
+	return viper.UnmarshalKey("node_exporter.jobs", &c.Jobs)
+}
+
+func (c *Config) check() error {
+	names := make(map[string]struct{}, len(c.Jobs))
+	for i, job := range c.Jobs {
+		if job == nil || len(job.Name) == 0 {
+			return fmt.Errorf("node_exporter.jobs[%d] name required", i)
+		}
+		if _, exists := names[job.Name]; exists {
+			return fmt.Errorf("duplicate node_exporter job %s", job.Name)
+		}
+		names[job.Name] = struct{}{}
+		if len(job.Targets) == 0 && len(job.Files) == 0 {
+			return fmt.Errorf("node_exporter job %s requires targets or files", job.Name)
+		}
+		if job.GatherDuration == 0 {
+			job.GatherDuration = c.GatherDuration
+		}
+		if job.ResponseTimeout == 0 {
+			job.ResponseTimeout = c.ResponseTimeout
+		}
+		if job.GatherDuration <= 0 || job.ResponseTimeout <= 0 {
+			return fmt.Errorf("node_exporter job %s gatherDuration and responseTimeout should be positive", job.Name)
+		}
+		if job.RefreshInterval <= 0 {
+			job.RefreshInterval = 5 * time.Minute
+		}
+		if len(job.Scheme) == 0 {
+			job.Scheme = "http"
+		}
+		if job.Scheme != "http" && job.Scheme != "https" {
+			return fmt.Errorf("node_exporter job %s invalid scheme %s", job.Name, job.Scheme)
+		}
+		if len(job.MetricsPath) == 0 {
+			job.MetricsPath = "/metrics"
+		}
+		if job.InsecureSkipVerify == nil {
+			insecureSkipVerify := c.InsecureSkipVerify
+			job.InsecureSkipVerify = &insecureSkipVerify
+		}
+		if _, err := newRelabelRules(job.RelabelConfigs); err != nil {
+			return fmt.Errorf("node_exporter job %s relabelConfigs: %s", job.Name, err)
+		}
+		if _, err := newRelabelRules(job.MetricRelabelConfigs); err != nil {
+			return fmt.Errorf("node_exporter job %s metricRelabelConfigs: %s", job.Name, err)
+		}
+	}
+	if len(c.Jobs) == 0 && c.GatherDuration <= 0 {
+		return errors.New("node_exporter.gatherDuration should be positive")
+	}
+	return nil
 }
 
 func init() {
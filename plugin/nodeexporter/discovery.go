@@ -0,0 +1,121 @@
+package nodeexporter
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// targetGroup is a group of targets with the same labels, the format of the Prometheus file_sd files.
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// readTargetGroups reads a targets file in json or yaml, json is parsed as yaml.
+func readTargetGroups(path string) ([]*targetGroup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*targetGroup
+	err = yaml.Unmarshal(data, &groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// refresh reads the files matching the patterns and rebuilds the targets, a file that can not be read keeps
+// the targets read last time.
+func (j *job) refresh() {
+	fileGroups := make(map[string][]*targetGroup, len(j.fileGroups))
+	for _, pattern := range j.conf.Files {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.WithError(err).Errorf("job %s invalid file pattern %s", j.name, pattern)
+			continue
+		}
+		for _, file := range files {
+			groups, err := readTargetGroups(file)
+			if err != nil {
+				logger.WithError(err).Errorf("job %s read targets file %s error", j.name, file)
+				groups = j.fileGroups[file]
+			}
+			fileGroups[file] = groups
+		}
+	}
+	files := make([]string, 0, len(fileGroups))
+	for file := range fileGroups {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	groups := make([]*targetGroup, 0, len(files)+1)
+	if len(j.conf.Targets) != 0 {
+		groups = append(groups, &targetGroup{Targets: j.conf.Targets})
+	}
+	for _, file := range files {
+		groups = append(groups, fileGroups[file]...)
+	}
+	targets := j.buildTargets(groups)
+	j.lock.Lock()
+	j.fileGroups = fileGroups
+	j.targets = targets
+	j.lock.Unlock()
+	logger.Debugf("job %s refresh %d targets", j.name, len(targets))
+}
+
+// watch refreshes the targets when the targets files change and every refresh interval until the exit channel
+// is closed, the directories are watched so that files replaced by rename are noticed.
+func (j *job) watch(exit <-chan struct{}) {
+	if len(j.conf.Files) == 0 {
+		return
+	}
+	var events chan fsnotify.Event
+	var errs chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.WithError(err).Errorf("job %s create file watcher error, refresh every %s", j.name, j.conf.RefreshInterval)
+	} else {
+		defer func() {
+			_ = watcher.Close()
+		}()
+		for _, pattern := range j.conf.Files {
+			dir := filepath.Dir(pattern)
+			if err = watcher.Add(dir); err != nil {
+				logger.WithError(err).Errorf("job %s watch directory %s error", j.name, dir)
+			}
+		}
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+	ticker := time.NewTicker(j.conf.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-events:
+			if j.matchFile(event.Name) {
+				j.refresh()
+			}
+		case err = <-errs:
+			logger.WithError(err).Errorf("job %s file watcher error", j.name)
+		case <-ticker.C:
+			j.refresh()
+		case <-exit:
+			return
+		}
+	}
+}
+
+func (j *job) matchFile(name string) bool {
+	for _, pattern := range j.conf.Files {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package nodeexporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	tmetric "github.com/influxdata/telegraf/metric"
+)
+
+const (
+	labelJob         = "job"
+	labelInstance    = "instance"
+	labelAddress     = "__address__"
+	labelScheme      = "__scheme__"
+	labelMetricsPath = "__metrics_path__"
+	labelName        = "__name__"
+	// labels starting with the reserved prefix are removed after relabeling
+	reservedPrefix = "__"
+)
+
+type Req struct {
+	client *http.Client
+	url    string
+	tags   map[string]string
+}
+
+// job scrapes a group of targets with the same interval, http options and relabel rules.
+type job struct {
+	name         string
+	conf         *JobConfig
+	interval     time.Duration
+	client       *http.Client
+	authToken    string
+	relabelRules []*relabelRule
+	metricRules  []*relabelRule
+	lock         sync.RWMutex
+	targets      []*Req
+	fileGroups   map[string][]*targetGroup
+}
+
+// newLegacyJob creates the job of node_exporter.urls, the targets are full urls and tagged with the url.
+func newLegacyJob(c *Config) (*job, error) {
+	client, tlsCfg, err := newHTTPClient(c.CaCertFile, c.CertFile, c.KeyFile, c.InsecureSkipVerify, c.ResponseTimeout)
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		name:      "node_exporter",
+		interval:  c.GatherDuration,
+		client:    client,
+		authToken: authToken(c.HttpBearerTokenString, c.HttpUsername, c.HttpPassword),
+	}
+	for _, u := range c.URLs {
+		URL, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		if URL.Scheme == "unix" {
+			path := URL.Query().Get("path")
+			if path == "" {
+				path = "/metrics"
+			}
+			socket := URL.Path
+			uClient := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig:   tlsCfg,
+					DisableKeepAlives: true,
+					DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						var d net.Dialer
+						return d.DialContext(ctx, "unix", socket)
+					},
+				},
+				Timeout: c.ResponseTimeout,
+			}
+			j.targets = append(j.targets, &Req{
+				client: uClient,
+				url:    "http://localhost" + path,
+				tags:   map[string]string{"url": u},
+			})
+		} else {
+			if URL.Path == "" {
+				URL.Path = "/metrics"
+			}
+			j.targets = append(j.targets, &Req{
+				client: client,
+				url:    URL.String(),
+				tags:   map[string]string{"url": u},
+			})
+		}
+	}
+	return j, nil
+}
+
+// newJob creates a job from the scrape config, the defaults are filled by Config.check.
+func newJob(c *JobConfig) (*job, error) {
+	client, _, err := newHTTPClient(c.CaCertFile, c.CertFile, c.KeyFile, *c.InsecureSkipVerify, c.ResponseTimeout)
+	if err != nil {
+		return nil, err
+	}
+	j := &job{
+		name:       c.Name,
+		conf:       c,
+		interval:   c.GatherDuration,
+		client:     client,
+		authToken:  authToken(c.HttpBearerTokenString, c.HttpUsername, c.HttpPassword),
+		fileGroups: map[string][]*targetGroup{},
+	}
+	if j.relabelRules, err = newRelabelRules(c.RelabelConfigs); err != nil {
+		return nil, err
+	}
+	if j.metricRules, err = newRelabelRules(c.MetricRelabelConfigs); err != nil {
+		return nil, err
+	}
+	j.refresh()
+	return j, nil
+}
+
+func newHTTPClient(caCertFile, certFile, keyFile string, insecureSkipVerify bool, timeout time.Duration) (*http.Client, *tls.Config, error) {
+	certPool := x509.NewCertPool()
+	if len(caCertFile) != 0 {
+		caCert, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		certPool.AppendCertsFromPEM(caCert)
+	}
+	var certificates []tls.Certificate
+	if len(certFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		certificates = append(certificates, cert)
+	}
+	tlsCfg := &tls.Config{
+		RootCAs:            certPool,
+		ClientAuth:         tls.NoClientCert,
+		ClientCAs:          nil,
+		InsecureSkipVerify: insecureSkipVerify,
+		Certificates:       certificates,
+	}
+	c := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsCfg,
+			DisableKeepAlives: true,
+		},
+		Timeout: timeout,
+	}
+	return c, tlsCfg, nil
+}
+
+func authToken(bearerToken, username, password string) string {
+	if len(bearerToken) != 0 {
+		return "Bearer " + bearerToken
+	}
+	if len(username) != 0 {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+	return ""
+}
+
+// buildTargets relabels the target groups like Prometheus, the address, scheme and metrics path labels build the
+// url and the labels without the reserved prefix are the tags, the instance label defaults to the address.
+func (j *job) buildTargets(groups []*targetGroup) []*Req {
+	var targets []*Req
+	for _, group := range groups {
+		for _, address := range group.Targets {
+			labels := map[string]string{
+				labelJob:         j.name,
+				labelAddress:     address,
+				labelScheme:      j.conf.Scheme,
+				labelMetricsPath: j.conf.MetricsPath,
+			}
+			for k, v := range j.conf.Labels {
+				labels[k] = v
+			}
+			for k, v := range group.Labels {
+				labels[k] = v
+			}
+			if !relabel(labels, j.relabelRules) {
+				continue
+			}
+			address = labels[labelAddress]
+			if len(address) == 0 {
+				logger.Warnf("job %s drop target without address, labels: %v", j.name, labels)
+				continue
+			}
+			if _, exists := labels[labelInstance]; !exists {
+				labels[labelInstance] = address
+			}
+			u := url.URL{Scheme: labels[labelScheme], Host: address, Path: labels[labelMetricsPath]}
+			tags := make(map[string]string, len(labels))
+			for k, v := range labels {
+				if !strings.HasPrefix(k, reservedPrefix) {
+					tags[k] = v
+				}
+			}
+			targets = append(targets, &Req{client: j.client, url: u.String(), tags: tags})
+		}
+	}
+	return targets
+}
+
+func (j *job) getTargets() []*Req {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.targets
+}
+
+// run scrapes the targets every interval until the exit channel is closed.
+func (j *job) run(exit <-chan struct{}, scrape func(j *job)) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			scrape(j)
+		case <-exit:
+			return
+		}
+	}
+}
+
+// scrape requests the target and returns the metrics with the target tags and the metric relabel rules applied,
+// with the up and scrape_duration_seconds series of the target.
+func (j *job) scrape(req *Req) ([]telegraf.Metric, error) {
+	start := time.Now()
+	metrics, err := j.request(req)
+	duration := time.Since(start)
+	up := float64(1)
+	if err != nil {
+		up = 0
+		metrics = nil
+	}
+	result := make([]telegraf.Metric, 0, len(metrics)+2)
+	for _, metric := range metrics {
+		m := j.applyTags(metric, req.tags)
+		if m != nil {
+			result = append(result, m)
+		}
+	}
+	result = append(result,
+		tmetric.New("up", copyTags(req.tags), map[string]interface{}{"value": up}, start, telegraf.Gauge),
+		tmetric.New("scrape_duration_seconds", copyTags(req.tags), map[string]interface{}{"value": duration.Seconds()}, start, telegraf.Gauge),
+	)
+	return result, err
+}
+
+func (j *job) request(req *Req) ([]telegraf.Metric, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, req.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create new request '%s': %s", req.url, err)
+	}
+	if len(j.authToken) != 0 {
+		httpReq.Header.Set("Authorization", j.authToken)
+	}
+	resp, err := req.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP status %s", req.url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %s", err)
+	}
+	metrics, err := Parse(body, resp.Header, false)
+	if err != nil {
+		return nil, fmt.Errorf("error pase body: %s", err)
+	}
+	return metrics, nil
+}
+
+// applyTags adds the target tags to the metric and applies the metric relabel rules, it returns nil if the metric
+// is dropped.
+func (j *job) applyTags(metric telegraf.Metric, tags map[string]string) telegraf.Metric {
+	labels := metric.Tags()
+	for k, v := range tags {
+		labels[k] = v
+	}
+	name := metric.Name()
+	if len(j.metricRules) != 0 {
+		labels[labelName] = name
+		if !relabel(labels, j.metricRules) {
+			return nil
+		}
+		name = labels[labelName]
+		for k := range labels {
+			if strings.HasPrefix(k, reservedPrefix) {
+				delete(labels, k)
+			}
+		}
+		if len(name) == 0 {
+			return nil
+		}
+	}
+	return tmetric.New(name, labels, metric.Fields(), metric.Time(), metric.Type())
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
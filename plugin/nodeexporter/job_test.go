@@ -0,0 +1,220 @@
+package nodeexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigJobs(t *testing.T) {
+	viper.Set("node_exporter.jobs", []map[string]interface{}{
+		{
+			"name":           "node",
+			"targets":        []string{"localhost:9100"},
+			"gatherDuration": "15s",
+			"labels":         map[string]interface{}{"env": "prod"},
+			"relabelConfigs": []map[string]interface{}{
+				{"sourceLabels": []string{"__address__"}, "regex": "(.*):.*", "targetLabel": "host"},
+			},
+		},
+	})
+	defer viper.Set("node_exporter.jobs", nil)
+	var c Config
+	require.NoError(t, c.setValue())
+	require.NoError(t, c.check())
+	require.Len(t, c.Jobs, 1)
+	job := c.Jobs[0]
+	assert.Equal(t, "node", job.Name)
+	assert.Equal(t, 15*time.Second, job.GatherDuration)
+	assert.Equal(t, c.ResponseTimeout, job.ResponseTimeout)
+	assert.Equal(t, "http", job.Scheme)
+	assert.Equal(t, "/metrics", job.MetricsPath)
+	assert.Equal(t, c.InsecureSkipVerify, *job.InsecureSkipVerify)
+	assert.Equal(t, map[string]string{"env": "prod"}, job.Labels)
+	require.Len(t, job.RelabelConfigs, 1)
+	assert.Equal(t, "(.*):.*", *job.RelabelConfigs[0].Regex)
+
+	for _, jobs := range [][]*JobConfig{
+		{{Targets: []string{"a:1"}}},
+		{{Name: "a"}},
+		{{Name: "a", Targets: []string{"a:1"}}, {Name: "a", Targets: []string{"a:1"}}},
+		{{Name: "a", Targets: []string{"a:1"}, Scheme: "ftp"}},
+		{{Name: "a", Targets: []string{"a:1"}, RelabelConfigs: []*RelabelConfig{{Action: "unknown"}}}},
+	} {
+		c = Config{GatherDuration: time.Second, ResponseTimeout: time.Second, Jobs: jobs}
+		assert.Error(t, c.check())
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(`[{"targets":["web01:9100","web02:9100"],"labels":{"env":"prod"}}]`), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "b.yml"), []byte("- targets:\n  - db01:9100\n  labels:\n    env: test\n"), 0644)
+	require.NoError(t, err)
+	insecureSkipVerify := true
+	c := &JobConfig{
+		Name:               "node",
+		Targets:            []string{"localhost:9100"},
+		Files:              []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")},
+		RefreshInterval:    time.Minute,
+		Scheme:             "https",
+		MetricsPath:        "/metrics",
+		GatherDuration:     time.Second,
+		ResponseTimeout:    time.Second,
+		InsecureSkipVerify: &insecureSkipVerify,
+		Labels:             map[string]string{"dc": "dc1"},
+		RelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"env"}, Regex: stringPtr("test"), Action: "drop"},
+			{SourceLabels: []string{"__address__"}, Regex: stringPtr("([^:]+):.*"), TargetLabel: "instance"},
+		},
+	}
+	j, err := newJob(c)
+	require.NoError(t, err)
+	targets := j.getTargets()
+	require.Len(t, targets, 3)
+	assert.Equal(t, "https://localhost:9100/metrics", targets[0].url)
+	assert.Equal(t, map[string]string{"job": "node", "instance": "localhost", "dc": "dc1"}, targets[0].tags)
+	assert.Equal(t, "https://web01:9100/metrics", targets[1].url)
+	assert.Equal(t, map[string]string{"job": "node", "instance": "web01", "dc": "dc1", "env": "prod"}, targets[1].tags)
+	assert.Equal(t, "https://web02:9100/metrics", targets[2].url)
+
+	// an invalid file keeps the targets read last time
+	err = os.WriteFile(filepath.Join(dir, "a.json"), []byte(`[{"targets":`), 0644)
+	require.NoError(t, err)
+	j.refresh()
+	assert.Len(t, j.getTargets(), 3)
+
+	err = os.WriteFile(filepath.Join(dir, "b.yml"), []byte("- targets: [db02:9100]\n"), 0644)
+	require.NoError(t, err)
+	j.refresh()
+	targets = j.getTargets()
+	require.Len(t, targets, 4)
+	assert.Equal(t, "https://db02:9100/metrics", targets[3].url)
+
+	err = os.Remove(filepath.Join(dir, "a.json"))
+	require.NoError(t, err)
+	j.refresh()
+	assert.Len(t, j.getTargets(), 2)
+}
+
+func TestFileDiscoveryWatch(t *testing.T) {
+	dir := t.TempDir()
+	insecureSkipVerify := true
+	j, err := newJob(&JobConfig{
+		Name:               "node",
+		Files:              []string{filepath.Join(dir, "*.json")},
+		RefreshInterval:    time.Hour,
+		Scheme:             "http",
+		MetricsPath:        "/metrics",
+		GatherDuration:     time.Second,
+		ResponseTimeout:    time.Second,
+		InsecureSkipVerify: &insecureSkipVerify,
+	})
+	require.NoError(t, err)
+	assert.Len(t, j.getTargets(), 0)
+	exit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		j.watch(exit)
+		close(done)
+	}()
+	defer func() {
+		close(exit)
+		<-done
+	}()
+	// wait for the watcher
+	time.Sleep(time.Millisecond * 100)
+	err = os.WriteFile(filepath.Join(dir, "a.json"), []byte(`[{"targets":["web01:9100"]}]`), 0644)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(j.getTargets()) == 1
+	}, time.Second*5, time.Millisecond*50)
+}
+
+func TestScrape(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		user, password, _ := r.BasicAuth()
+		if user != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(s))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	insecureSkipVerify := true
+	c := &JobConfig{
+		Name:               "node",
+		Targets:            []string{u.Host},
+		Scheme:             "http",
+		MetricsPath:        "/metrics",
+		GatherDuration:     time.Second,
+		ResponseTimeout:    time.Second,
+		InsecureSkipVerify: &insecureSkipVerify,
+		HttpUsername:       "user",
+		HttpPassword:       "pass",
+		MetricRelabelConfigs: []*RelabelConfig{
+			{SourceLabels: []string{"__name__"}, Regex: stringPtr("go_gc_.*"), Action: "drop"},
+			{SourceLabels: []string{"__name__"}, Regex: stringPtr("test_(.*)"), TargetLabel: "__name__", Replacement: stringPtr("renamed_$1")},
+		},
+	}
+	j, err := newJob(c)
+	require.NoError(t, err)
+	targets := j.getTargets()
+	require.Len(t, targets, 1)
+	metrics, err := j.scrape(targets[0])
+	require.NoError(t, err)
+	byName := make(map[string]telegraf.Metric, len(metrics))
+	for _, m := range metrics {
+		byName[m.Name()] = m
+	}
+	assert.Len(t, metrics, 4)
+	assert.NotContains(t, byName, "go_gc_duration_seconds")
+	require.Contains(t, byName, "renamed_metric")
+	assert.Equal(t, map[string]string{"job": "node", "instance": u.Host, "label": "value"}, byName["renamed_metric"].Tags())
+	require.Contains(t, byName, "go_goroutines")
+	require.Contains(t, byName, "up")
+	assert.Equal(t, float64(1), byName["up"].Fields()["value"])
+	assert.Equal(t, map[string]string{"job": "node", "instance": u.Host}, byName["up"].Tags())
+	require.Contains(t, byName, "scrape_duration_seconds")
+
+	c.HttpPassword = "wrong"
+	j, err = newJob(c)
+	require.NoError(t, err)
+	metrics, err = j.scrape(j.getTargets()[0])
+	assert.Error(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "up", metrics[0].Name())
+	assert.Equal(t, float64(0), metrics[0].Fields()["value"])
+	assert.Equal(t, "scrape_duration_seconds", metrics[1].Name())
+}
+
+func TestLegacyJob(t *testing.T) {
+	j, err := newLegacyJob(&Config{
+		URLs:            []string{"http://localhost:9100", "unix:///run/node_exporter.sock?path=/node"},
+		GatherDuration:  time.Second,
+		ResponseTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	targets := j.getTargets()
+	require.Len(t, targets, 2)
+	assert.Equal(t, "http://localhost:9100/metrics", targets[0].url)
+	assert.Equal(t, map[string]string{"url": "http://localhost:9100"}, targets[0].tags)
+	assert.Equal(t, "http://localhost/node", targets[1].url)
+	assert.NotEqual(t, j.client, targets[1].client)
+}
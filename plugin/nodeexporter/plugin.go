@@ -1,27 +1,18 @@
 package nodeexporter
 
 import (
-	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/base64"
 	"fmt"
-	"io"
 	"net"
-	"net/http"
-	"net/url"
-	"os"
-	"time"
-	"unsafe"
+	"sync"
 
 	"github.com/gin-gonic/gin"
-	tmetric "github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
 	"github.com/taosdata/taosadapter/v3/db/commonpool"
 	"github.com/taosdata/taosadapter/v3/driver/common"
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
 	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
 	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
 	"github.com/taosdata/taosadapter/v3/tools/generator"
 )
@@ -30,49 +21,58 @@ var logger = log.GetLogger("PLG").WithField("mod", "NodeExporter")
 
 type NodeExporter struct {
 	conf     Config
-	request  []*Req
+	jobs     []*job
 	exitChan chan struct{}
-}
-type Req struct {
-	req    *http.Request
-	client *http.Client
-	url    string
+	wg       sync.WaitGroup
+	spool    *spool.Spool
 }
 
 func (p *NodeExporter) Init(_ gin.IRouter) error {
-	p.conf.setValue()
+	err := p.conf.setValue()
+	if err != nil {
+		return err
+	}
 	if !p.conf.Enable {
 		logger.Info("node_exporter disabled")
 		return nil
 	}
-	err := p.prepareUrls()
+	err = p.conf.check()
 	if err != nil {
 		return err
 	}
-	return nil
+	return p.prepareJobs()
 }
 
 func (p *NodeExporter) Start() error {
 	if !p.conf.Enable {
 		return nil
 	}
+	var err error
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			return p.insertLines(r.DB, r.Data)
+		})
+	}
 	p.exitChan = make(chan struct{})
-	ticker := time.NewTicker(p.conf.GatherDuration)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				if monitor.AllPaused() {
-					continue
-				}
-				p.Gather()
-			case <-p.exitChan:
-				ticker.Stop()
-				ticker = nil
-				return
-			}
+	for _, j := range p.jobs {
+		j := j
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			j.run(p.exitChan, p.gatherJob)
+		}()
+		if j.conf != nil {
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				j.watch(p.exitChan)
+			}()
 		}
-	}()
+	}
 	return nil
 }
 
@@ -82,6 +82,10 @@ func (p *NodeExporter) Stop() error {
 	}
 	if p.exitChan != nil {
 		close(p.exitChan)
+		p.wg.Wait()
+	}
+	if p.spool != nil {
+		return p.spool.Close()
 	}
 	return nil
 }
@@ -94,164 +98,85 @@ func (p *NodeExporter) Version() string {
 	return "v1"
 }
 
-func (p *NodeExporter) prepareUrls() error {
-	authToken := ""
-	if len(p.conf.HttpBearerTokenString) != 0 {
-		authToken = "Bearer " + p.conf.HttpBearerTokenString
-	} else if len(p.conf.HttpUsername) != 0 {
-		auth := p.conf.HttpUsername + ":" + p.conf.HttpPassword
-		authToken = "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
-	}
-	certPool := x509.NewCertPool()
-	if len(p.conf.CaCertFile) != 0 {
-		caCert, err := os.ReadFile(p.conf.CaCertFile)
+// prepareJobs creates the scrape jobs, node_exporter.urls is used as one job when no jobs are configured.
+func (p *NodeExporter) prepareJobs() error {
+	p.jobs = nil
+	if len(p.conf.Jobs) == 0 {
+		j, err := newLegacyJob(&p.conf)
 		if err != nil {
 			return err
 		}
-		certPool.AppendCertsFromPEM(caCert)
+		p.jobs = append(p.jobs, j)
+		return nil
 	}
-	var certificates []tls.Certificate
-	if len(p.conf.CertFile) != 0 {
-		cert, err := tls.LoadX509KeyPair(p.conf.CertFile, p.conf.KeyFile)
+	for _, c := range p.conf.Jobs {
+		j, err := newJob(c)
 		if err != nil {
-			return err
+			return fmt.Errorf("node_exporter job %s: %s", c.Name, err)
 		}
-		certificates = append(certificates, cert)
+		p.jobs = append(p.jobs, j)
 	}
+	return nil
+}
+
+var localhost = net.IPv4(127, 0, 0, 1)
 
-	tlsCfg := &tls.Config{
-		RootCAs:            certPool,
-		ClientAuth:         tls.NoClientCert,
-		ClientCAs:          nil,
-		InsecureSkipVerify: p.conf.InsecureSkipVerify,
-		Certificates:       certificates,
+// Gather scrapes the targets of all jobs once.
+func (p *NodeExporter) Gather() {
+	for _, j := range p.jobs {
+		p.gatherJob(j)
 	}
-	c := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig:   tlsCfg,
-			DisableKeepAlives: true,
-		},
-		Timeout: p.conf.ResponseTimeout,
+}
+
+// gatherJob scrapes the targets of the job concurrently and writes the metrics of each target.
+func (p *NodeExporter) gatherJob(j *job) {
+	if monitor.AllPaused() {
+		return
 	}
-	for _, u := range p.conf.URLs {
-		URL, err := url.Parse(u)
-		if err != nil {
-			return err
-		}
-		var req *http.Request
-		if URL.Scheme == "unix" {
-			path := URL.Query().Get("path")
-			if path == "" {
-				path = "/metrics"
-			}
-			addr := "http://localhost" + path
-			req, err = http.NewRequest("GET", addr, nil)
-			req.RemoteAddr = "127.0.0.1:33333"
+	targets := j.getTargets()
+	var wg sync.WaitGroup
+	wg.Add(len(targets))
+	for _, req := range targets {
+		go func(req *Req) {
+			defer wg.Done()
+			metrics, err := j.scrape(req)
 			if err != nil {
-				return fmt.Errorf("unable to create new request '%s': %s", addr, err)
-			}
-
-			uClient := &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig:   tlsCfg,
-					DisableKeepAlives: true,
-					DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-						c, err := net.Dial("unix", URL.Path)
-						return c, err
-					},
-				},
-				Timeout: p.conf.ResponseTimeout,
-			}
-			if len(authToken) != 0 {
-				req.Header.Set("Authorization", authToken)
+				logger.WithError(err).Errorf("gather job %s url %s", j.name, req.url)
 			}
-			p.request = append(p.request, &Req{
-				req:    req,
-				client: uClient,
-				url:    u,
-			})
-		} else {
-			if URL.Path == "" {
-				URL.Path = "/metrics"
-			}
-			req, err = http.NewRequest(http.MethodGet, URL.String(), nil)
-			req.RemoteAddr = "127.0.0.1:33333"
+			data, err := influx.NewSerializer().SerializeBatch(metrics)
 			if err != nil {
-				return fmt.Errorf("unable to create new request '%s': %s", URL.String(), err)
+				logger.WithError(err).Errorln("serialize metrics")
+				return
 			}
-			if len(authToken) != 0 {
-				req.Header.Set("Authorization", authToken)
+			err = p.insertLines(p.conf.DB, data)
+			if err != nil {
+				logger.WithError(err).Errorln("gather")
+				p.spool.AppendFailed(&spool.Record{DB: p.conf.DB, Data: data}, err)
 			}
-			p.request = append(p.request, &Req{
-				req:    req,
-				client: c,
-				url:    u,
-			})
-		}
+		}(req)
 	}
-	return nil
+	wg.Wait()
 }
 
-var localhost = net.IPv4(127, 0, 0, 1)
-
-func (p *NodeExporter) Gather() {
+func (p *NodeExporter) insertLines(db string, data []byte) error {
 	conn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, localhost)
 	if err != nil {
 		logger.WithError(err).Errorln("commonpool.GetConnection error")
-		return
+		return err
 	}
 	defer func() {
-		err = conn.Put()
-		if err != nil {
-			logger.WithError(err).Errorln("conn.Put error")
+		putErr := conn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("conn.Put error")
 		}
 	}()
-	for _, req := range p.request {
-		err := p.requestSingle(conn.TaosConnection, req)
-		if err != nil {
-			logger.WithError(err).Errorln("gather")
-		}
-	}
-}
-
-func (p *NodeExporter) requestSingle(conn unsafe.Pointer, req *Req) error {
-	resp, err := req.client.Do(req.req)
+	reqID := generator.GetReqID()
+	execLogger := logger.WithField(common.ReqIDKey, reqID)
+	err = inserter.InsertInfluxdb(conn.TaosConnection, data, db, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
 	if err != nil {
+		logger.WithError(err).Error("insert influxdb error", string(data))
 		return err
 	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s returned HTTP status %s", req.req.URL, resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading body: %s", err)
-	}
-	metrics, err := Parse(body, resp.Header, false)
-	if err != nil {
-		return fmt.Errorf("error pase body: %s", err)
-	}
-	serializer := influx.NewSerializer()
-	for _, metric := range metrics {
-		metric.AddTag("url", req.url)
-		tags := metric.Tags()
-		m := tmetric.New(metric.Name(), tags, metric.Fields(), metric.Time(), metric.Type())
-		data, err := serializer.Serialize(m)
-		if err != nil {
-			return err
-		}
-		reqID := generator.GetReqID()
-		execLogger := logger.WithField(common.ReqIDKey, reqID)
-		err = inserter.InsertInfluxdb(conn, data, p.conf.DB, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
-		if err != nil {
-			logger.WithError(err).Error("insert influxdb error", string(data))
-			return err
-		}
-	}
 	return nil
 }
 
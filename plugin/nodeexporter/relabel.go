@@ -0,0 +1,146 @@
+package nodeexporter
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	relabelReplace   = "replace"
+	relabelKeep      = "keep"
+	relabelDrop      = "drop"
+	relabelHashMod   = "hashmod"
+	relabelLabelMap  = "labelmap"
+	relabelLabelDrop = "labeldrop"
+	relabelLabelKeep = "labelkeep"
+)
+
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+	modulus      uint64
+}
+
+// newRelabelRules compiles the relabel configs, the defaults are the same as Prometheus.
+func newRelabelRules(configs []*RelabelConfig) ([]*relabelRule, error) {
+	rules := make([]*relabelRule, 0, len(configs))
+	for i, c := range configs {
+		if c == nil {
+			return nil, fmt.Errorf("rule %d is empty", i)
+		}
+		rule := &relabelRule{
+			sourceLabels: c.SourceLabels,
+			separator:    ";",
+			targetLabel:  c.TargetLabel,
+			replacement:  "$1",
+			action:       strings.ToLower(c.Action),
+			modulus:      c.Modulus,
+		}
+		if c.Separator != nil {
+			rule.separator = *c.Separator
+		}
+		if c.Replacement != nil {
+			rule.replacement = *c.Replacement
+		}
+		if len(rule.action) == 0 {
+			rule.action = relabelReplace
+		}
+		regex := "(.*)"
+		if c.Regex != nil {
+			regex = *c.Regex
+		}
+		var err error
+		rule.regex, err = regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("rule %d invalid regex %s: %s", i, regex, err)
+		}
+		switch rule.action {
+		case relabelReplace:
+			if len(rule.targetLabel) == 0 {
+				return nil, fmt.Errorf("rule %d targetLabel required by action replace", i)
+			}
+		case relabelHashMod:
+			if len(rule.targetLabel) == 0 {
+				return nil, fmt.Errorf("rule %d targetLabel required by action hashmod", i)
+			}
+			if rule.modulus == 0 {
+				return nil, fmt.Errorf("rule %d modulus required by action hashmod", i)
+			}
+		case relabelKeep, relabelDrop, relabelLabelMap, relabelLabelDrop, relabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("rule %d unknown action %s", i, c.Action)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// relabel applies the rules to the labels in place, it returns false if the labels are dropped.
+func relabel(labels map[string]string, rules []*relabelRule) bool {
+	for _, rule := range rules {
+		values := make([]string, len(rule.sourceLabels))
+		for i, name := range rule.sourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, rule.separator)
+		switch rule.action {
+		case relabelReplace:
+			indexes := rule.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(rule.regex.ExpandString(nil, rule.targetLabel, value, indexes))
+			if len(target) == 0 {
+				continue
+			}
+			result := string(rule.regex.ExpandString(nil, rule.replacement, value, indexes))
+			if len(result) == 0 {
+				delete(labels, target)
+				continue
+			}
+			labels[target] = result
+		case relabelKeep:
+			if !rule.regex.MatchString(value) {
+				return false
+			}
+		case relabelDrop:
+			if rule.regex.MatchString(value) {
+				return false
+			}
+		case relabelHashMod:
+			sum := md5.Sum([]byte(value))
+			labels[rule.targetLabel] = strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%rule.modulus, 10)
+		case relabelLabelMap:
+			mapped := make(map[string]string)
+			for name, v := range labels {
+				if rule.regex.MatchString(name) {
+					mapped[rule.regex.ReplaceAllString(name, rule.replacement)] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		case relabelLabelDrop:
+			for name := range labels {
+				if rule.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		case relabelLabelKeep:
+			for name := range labels {
+				if !rule.regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package nodeexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestRelabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []*RelabelConfig
+		labels  map[string]string
+		keep    bool
+		want    map[string]string
+	}{
+		{
+			name: "replace",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"__address__"},
+				Regex:        stringPtr("([^:]+):\\d+"),
+				TargetLabel:  "host",
+			}},
+			labels: map[string]string{"__address__": "web01:9100"},
+			keep:   true,
+			want:   map[string]string{"__address__": "web01:9100", "host": "web01"},
+		},
+		{
+			name: "replace join",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"a", "b"},
+				Separator:    stringPtr("-"),
+				TargetLabel:  "c",
+				Replacement:  stringPtr("x_$1"),
+			}},
+			labels: map[string]string{"a": "1", "b": "2"},
+			keep:   true,
+			want:   map[string]string{"a": "1", "b": "2", "c": "x_1-2"},
+		},
+		{
+			name: "replace empty removes label",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"a"},
+				TargetLabel:  "b",
+				Replacement:  stringPtr(""),
+			}},
+			labels: map[string]string{"a": "1", "b": "2"},
+			keep:   true,
+			want:   map[string]string{"a": "1"},
+		},
+		{
+			name: "replace not matched",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"a"},
+				Regex:        stringPtr("2"),
+				TargetLabel:  "b",
+			}},
+			labels: map[string]string{"a": "1"},
+			keep:   true,
+			want:   map[string]string{"a": "1"},
+		},
+		{
+			name: "keep",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"env"},
+				Regex:        stringPtr("prod"),
+				Action:       "keep",
+			}},
+			labels: map[string]string{"env": "dev"},
+			keep:   false,
+		},
+		{
+			name: "drop",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"env"},
+				Regex:        stringPtr("dev|test"),
+				Action:       "drop",
+			}},
+			labels: map[string]string{"env": "prod"},
+			keep:   true,
+			want:   map[string]string{"env": "prod"},
+		},
+		{
+			name: "hashmod",
+			configs: []*RelabelConfig{{
+				SourceLabels: []string{"a"},
+				TargetLabel:  "shard",
+				Modulus:      1,
+				Action:       "hashmod",
+			}},
+			labels: map[string]string{"a": "1"},
+			keep:   true,
+			want:   map[string]string{"a": "1", "shard": "0"},
+		},
+		{
+			name: "labelmap",
+			configs: []*RelabelConfig{{
+				Regex:  stringPtr("__meta_(.+)"),
+				Action: "labelmap",
+			}},
+			labels: map[string]string{"__meta_zone": "a"},
+			keep:   true,
+			want:   map[string]string{"__meta_zone": "a", "zone": "a"},
+		},
+		{
+			name: "labeldrop and labelkeep",
+			configs: []*RelabelConfig{
+				{Regex: stringPtr("tmp_.*"), Action: "labeldrop"},
+				{Regex: stringPtr("a|tmp_b|c"), Action: "labelkeep"},
+			},
+			labels: map[string]string{"a": "1", "tmp_b": "2", "d": "3"},
+			keep:   true,
+			want:   map[string]string{"a": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newRelabelRules(tt.configs)
+			require.NoError(t, err)
+			keep := relabel(tt.labels, rules)
+			assert.Equal(t, tt.keep, keep)
+			if keep {
+				assert.Equal(t, tt.want, tt.labels)
+			}
+		})
+	}
+}
+
+func TestNewRelabelRulesError(t *testing.T) {
+	for _, configs := range [][]*RelabelConfig{
+		{{Action: "unknown"}},
+		{{Regex: stringPtr("(")}},
+		{{SourceLabels: []string{"a"}}},
+		{{TargetLabel: "a", Action: "hashmod"}},
+	} {
+		_, err := newRelabelRules(configs)
+		assert.Error(t, err)
+	}
+}
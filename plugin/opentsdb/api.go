@@ -0,0 +1,328 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"github.com/taosdata/taosadapter/v3/tools/web"
+)
+
+// defaultSuggestMax is the default max results of suggest, the same as opentsdb
+const defaultSuggestMax = 25
+
+type tsdbErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+type tsdbError struct {
+	Error tsdbErrorDetail `json:"error"`
+}
+
+// tsdbErrorResponse responds the error in the opentsdb format.
+func tsdbErrorResponse(c *gin.Context, code int, err error) {
+	c.JSON(code, &tsdbError{Error: tsdbErrorDetail{Code: code, Message: err.Error()}})
+}
+
+// filterTypes are the descriptions of the supported filters for /api/config/filters
+var filterTypes = map[string]map[string]string{
+	"literal_or": {
+		"examples":    "host=literal_or(web01),  host=literal_or(web01|web02|web03)  {\"type\":\"literal_or\",\"tagk\":\"host\",\"filter\":\"web01|web02|web03\",\"groupBy\":false}",
+		"description": "Accepts one or more exact values and matches if the series contains any of them. Multiple values can be included and must be separated by the | (pipe) character. The filter is case sensitive and will not allow characters that TSDB does not allow at write time.",
+	},
+	"iliteral_or": {
+		"examples":    "host=iliteral_or(web01),  host=iliteral_or(web01|web02|web03)  {\"type\":\"iliteral_or\",\"tagk\":\"host\",\"filter\":\"web01|web02|web03\",\"groupBy\":false}",
+		"description": "Accepts one or more exact values and matches if the series contains any of them. Multiple values can be included and must be separated by the | (pipe) character. The filter is case insensitive and will not allow characters that TSDB does not allow at write time.",
+	},
+	"not_literal_or": {
+		"examples":    "host=not_literal_or(web01),  host=not_literal_or(web01|web02|web03)  {\"type\":\"not_literal_or\",\"tagk\":\"host\",\"filter\":\"web01|web02|web03\",\"groupBy\":false}",
+		"description": "Accepts one or more exact values and matches if the series does NOT contain any of them. Multiple values can be included and must be separated by the | (pipe) character. The filter is case sensitive and will not allow characters that TSDB does not allow at write time.",
+	},
+	"not_iliteral_or": {
+		"examples":    "host=not_iliteral_or(web01),  host=not_iliteral_or(web01|web02|web03)  {\"type\":\"not_iliteral_or\",\"tagk\":\"host\",\"filter\":\"web01|web02|web03\",\"groupBy\":false}",
+		"description": "Accepts one or more exact values and matches if the series does NOT contain any of them. Multiple values can be included and must be separated by the | (pipe) character. The filter is case insensitive and will not allow characters that TSDB does not allow at write time.",
+	},
+	"wildcard": {
+		"examples":    "host=wildcard(web*),  host=wildcard(web*.tsdb.net)  {\"type\":\"wildcard\",\"tagk\":\"host\",\"filter\":\"web*.tsdb.net\",\"groupBy\":false}",
+		"description": "Performs pre, post and in-fix glob matching of values. The globs are case sensitive and multiple wildcards can be used. The wildcard character is the * (asterisk). At least one wildcard must be present in the filter value. A wildcard by itself can be used as well to match on any value for the tag key.",
+	},
+	"iwildcard": {
+		"examples":    "host=iwildcard(web*),  host=iwildcard(web*.tsdb.net)  {\"type\":\"iwildcard\",\"tagk\":\"host\",\"filter\":\"web*.tsdb.net\",\"groupBy\":false}",
+		"description": "Performs pre, post and in-fix glob matching of values. The globs are case insensitive and multiple wildcards can be used. The wildcard character is the * (asterisk). Case insensitivity is achieved by dropping all values to lower case. At least one wildcard must be present in the filter value. A wildcard by itself can be used as well to match on any value for the tag key.",
+	},
+	"regexp": {
+		"examples":    "host=regexp(.*)  {\"type\":\"regexp\",\"tagk\":\"host\",\"filter\":\".*\",\"groupBy\":false}",
+		"description": "Provides full, POSIX compliant regular expression using the TDengine match operator.",
+	},
+}
+
+// withExecutor gets a connection of the request and selects the database.
+func (p *Plugin) withExecutor(c *gin.Context, logger *logrus.Entry, reqID uint64, fn func(executor queryExecutor)) {
+	isDebug := log.IsDebug()
+	user, password, err := plugin.GetAuth(c)
+	if err != nil {
+		logger.Errorf("get auth error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusUnauthorized, err)
+		return
+	}
+	s := log.GetLogNow(isDebug)
+	taosConn, err := commonpool.GetConnection(user, password, iptool.GetRealIP(c.Request))
+	logger.Debugf("get connection finish, cost:%s", log.GetLogDuration(isDebug, s))
+	if err != nil {
+		logger.Errorf("connect server error, err:%s", err)
+		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+			tsdbErrorResponse(c, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
+			tsdbErrorResponse(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		tsdbErrorResponse(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer func() {
+		logger.Tracef("put connection")
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}()
+	db := c.Param("db")
+	code := syncinterface.TaosSelectDB(taosConn.TaosConnection, db, logger, isDebug)
+	if code != 0 {
+		err = tErrors.NewError(code, wrapper.TaosErrorStr(nil))
+		logger.Errorf("select db error, db:%s, err:%s", db, err)
+		web.SetTaosErrorCode(c, code&0xffff)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	fn(&tool.QueryExecutor{TaosConn: taosConn.TaosConnection, Logger: logger, IsDebug: isDebug, ReqID: int64(reqID)})
+}
+
+func newRequestLogger(c *gin.Context) (*logrus.Entry, uint64) {
+	reqID := uint64(generator.GetReqID())
+	c.Set(config.ReqIDKey, reqID)
+	return logger.WithField(config.ReqIDKey, reqID), reqID
+}
+
+// @Tags opentsdb
+// @Summary opentsdb query
+// @Description opentsdb query http://opentsdb.net/docs/build/html/api_http/query/index.html
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "basic authorization"
+// @Param start query string false "the start time of get request, such as 1h-ago"
+// @Param end query string false "the end time of get request, default is now"
+// @Param m query string false "the sub query of get request, such as sum:1m-avg:sys.cpu.user{host=*}"
+// @Success 200 {array} queryResult
+// @Failure 400 {object} tsdbError
+// @Failure 401 {object} tsdbError
+// @Failure 500 {object} tsdbError
+// @Router /opentsdb/v1/tsdb/:db/api/query [post]
+func (p *Plugin) query(c *gin.Context) {
+	logger, reqID := newRequestLogger(c)
+	isDebug := log.IsDebug()
+	body, err := c.GetRawData()
+	if err != nil {
+		logger.Errorf("get request body error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	logger.Debugf("request query:%s, body:%s", c.Request.URL.RawQuery, body)
+	req, err := parseQueryRequest(body, c.Request.URL.Query())
+	if err != nil {
+		logger.Errorf("parse query error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Queries) == 0 {
+		tsdbErrorResponse(c, http.StatusBadRequest, errors.New("missing sub queries"))
+		return
+	}
+	now := time.Now()
+	start, err := timeString(req.Start)
+	if err == nil && len(start) == 0 {
+		err = errors.New("missing start time")
+	}
+	var runner *queryRunner
+	if err == nil {
+		runner = &queryRunner{msResolution: req.MsResolution}
+		runner.start, err = parseTsdbTime(start, now)
+	}
+	if err == nil {
+		var end string
+		if end, err = timeString(req.End); err == nil {
+			runner.end, err = parseTsdbTime(end, now)
+		}
+	}
+	if err != nil {
+		logger.Errorf("parse time error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	if runner.end.Before(runner.start) {
+		tsdbErrorResponse(c, http.StatusBadRequest, errors.New("start time must be less than the end time"))
+		return
+	}
+	for _, sub := range req.Queries {
+		if !validAggregator(sub.Aggregator) {
+			tsdbErrorResponse(c, http.StatusBadRequest, errors.New("no such aggregator "+sub.Aggregator))
+			return
+		}
+		if _, err = translateSubQuery(sub, runner.start, runner.end); err != nil {
+			tsdbErrorResponse(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	p.withExecutor(c, logger, reqID, func(executor queryExecutor) {
+		runner.executor = executor
+		s := log.GetLogNow(isDebug)
+		results := make([]*queryResult, 0)
+		for _, sub := range req.Queries {
+			subResults, err := runner.run(sub)
+			if err != nil {
+				logger.Errorf("query error, metric:%s, err:%s", sub.Metric, err)
+				code := http.StatusInternalServerError
+				if taosError, is := err.(*tErrors.TaosError); is {
+					web.SetTaosErrorCode(c, int(taosError.Code))
+				} else {
+					code = http.StatusBadRequest
+				}
+				tsdbErrorResponse(c, code, err)
+				return
+			}
+			results = append(results, subResults...)
+		}
+		logger.Debugf("query finish, cost:%s", log.GetLogDuration(isDebug, s))
+		c.JSON(http.StatusOK, results)
+	})
+}
+
+type suggestRequest struct {
+	Type string `json:"type"`
+	Q    string `json:"q"`
+	Max  int    `json:"max"`
+}
+
+// translateSuggest returns the sql of the suggest request.
+func translateSuggest(db string, req *suggestRequest) (string, error) {
+	pattern := "'" + tools.EscapeString(wildcardPattern(req.Q)) + "%'"
+	where := " where db_name = '" + tools.EscapeString(db) + "'"
+	limit := " limit " + strconv.Itoa(req.Max)
+	switch req.Type {
+	case "metrics":
+		return "select stable_name from information_schema.ins_stables" + where +
+			" and stable_name like " + pattern + " order by stable_name" + limit, nil
+	case "tagk":
+		return "select distinct tag_name from information_schema.ins_tags" + where +
+			" and tag_name like " + pattern + " order by tag_name" + limit, nil
+	case "tagv":
+		return "select distinct tag_value from information_schema.ins_tags" + where +
+			" and tag_value like " + pattern + " order by tag_value" + limit, nil
+	}
+	return "", errors.New("invalid 'type' parameter:" + req.Type)
+}
+
+// @Tags opentsdb
+// @Summary opentsdb suggest
+// @Description opentsdb suggest http://opentsdb.net/docs/build/html/api_http/suggest.html
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "basic authorization"
+// @Param type query string true "metrics, tagk or tagv"
+// @Param q query string false "the prefix"
+// @Param max query int false "the max results, default is 25"
+// @Success 200 {array} string
+// @Failure 400 {object} tsdbError
+// @Failure 401 {object} tsdbError
+// @Failure 500 {object} tsdbError
+// @Router /opentsdb/v1/tsdb/:db/api/suggest [get]
+func (p *Plugin) suggest(c *gin.Context) {
+	logger, reqID := newRequestLogger(c)
+	body, err := c.GetRawData()
+	if err != nil {
+		logger.Errorf("get request body error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	req := &suggestRequest{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, req)
+	} else {
+		req.Type = c.Query("type")
+		req.Q = c.Query("q")
+		if max := c.Query("max"); len(max) > 0 {
+			req.Max, err = strconv.Atoi(max)
+		}
+	}
+	if err != nil {
+		logger.Errorf("parse suggest error, err:%s", err)
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	if req.Max <= 0 {
+		req.Max = defaultSuggestMax
+	}
+	sql, err := translateSuggest(c.Param("db"), req)
+	if err != nil {
+		tsdbErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	p.withExecutor(c, logger, reqID, func(executor queryExecutor) {
+		_, rows, err := executor.Query(sql)
+		if err != nil {
+			logger.Errorf("suggest error, err:%s", err)
+			if taosError, is := err.(*tErrors.TaosError); is {
+				web.SetTaosErrorCode(c, int(taosError.Code))
+			}
+			tsdbErrorResponse(c, http.StatusInternalServerError, err)
+			return
+		}
+		result := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if len(row) > 0 && row[0] != nil {
+				result = append(result, toString(row[0]))
+			}
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
+
+// @Tags opentsdb
+// @Summary opentsdb aggregators
+// @Description the supported aggregators
+// @Produce json
+// @Success 200 {array} string
+// @Router /opentsdb/v1/tsdb/:db/api/aggregators [get]
+func (p *Plugin) aggregators(c *gin.Context) {
+	c.JSON(http.StatusOK, aggregators)
+}
+
+// @Tags opentsdb
+// @Summary opentsdb filters
+// @Description the supported filters
+// @Produce json
+// @Success 200 {object} map[string]map[string]string
+// @Router /opentsdb/v1/tsdb/:db/api/config/filters [get]
+func (p *Plugin) filters(c *gin.Context) {
+	c.JSON(http.StatusOK, filterTypes)
+}
@@ -55,6 +55,20 @@ func (p *Plugin) Init(r gin.IRouter) error {
 	})
 	r.POST("put/json/:db", plugin.Auth(p.errorResponse), p.insertJson)
 	r.POST("put/telnet/:db", plugin.Auth(p.errorResponse), p.insertTelnet)
+	api := r.Group("tsdb/:db/api")
+	api.Use(func(c *gin.Context) {
+		if monitor.QueryPaused() {
+			c.Header("Retry-After", "120")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, "query memory exceeds threshold")
+			return
+		}
+	}, plugin.Auth(tsdbErrorResponse))
+	api.GET("query", p.query)
+	api.POST("query", p.query)
+	api.GET("suggest", p.suggest)
+	api.POST("suggest", p.suggest)
+	api.GET("aggregators", p.aggregators)
+	api.GET("config/filters", p.filters)
 	return nil
 }
 
@@ -75,9 +89,12 @@ func (p *Plugin) Stop() error {
 // @Accept json
 // @Produce json
 // @Param Authorization header string false "basic authorization"
+// @Param summary query string false "return the summary"
+// @Param details query string false "return the summary and the failed datapoints"
 // @Success 204 {string} string "no content"
+// @Success 200 {object} putDetails "summary"
 // @Failure 401 {object} message "unauthorized"
-// @Failure 400 {string} string "badRequest"
+// @Failure 400 {object} putDetails "one or more datapoints failed"
 // @Failure 500 {string} string "internal server error"
 // @Router /opentsdb/v1/put/json/:db [post]
 func (p *Plugin) insertJson(c *gin.Context) {
@@ -113,6 +130,12 @@ func (p *Plugin) insertJson(c *gin.Context) {
 		return
 	}
 	logger.Debugf("request data:%s", data)
+	datapoints, err := splitDatapoints(data)
+	if err != nil {
+		logger.Errorf("parse json payload error, err:%s", err)
+		p.errorResponse(c, http.StatusBadRequest, err)
+		return
+	}
 	user, password, err := plugin.GetAuth(c)
 	if err != nil {
 		logger.Errorf("get auth error, err:%s", err)
@@ -164,19 +187,54 @@ func (p *Plugin) insertJson(c *gin.Context) {
 	}
 	s = log.GetLogNow(isDebug)
 	logger.Debugf("insert json payload, data:%s, db:%s, ttl:%d, table_name_key:%s", data, db, ttl, tableNameKey)
-	err = inserter.InsertOpentsdbJson(taosConn.TaosConnection, data, db, ttl, reqID, tableNameKey, logger)
+	summary, err := putDatapoints(datapoints, func(data []byte) error {
+		err := inserter.InsertOpentsdbJson(taosConn.TaosConnection, data, db, ttl, reqID, tableNameKey, logger)
+		if err != nil {
+			logger.Errorf("insert json payload error, err:%s, data:%s", err, data)
+		}
+		return err
+	})
 	logger.Debugf("insert json payload finish, cost:%s", log.GetLogDuration(isDebug, s))
 	if err != nil {
-		logger.Errorf("insert json payload error, err:%s, data:%s", err, data)
 		taosError, is := err.(*tErrors.TaosError)
 		if is {
 			web.SetTaosErrorCode(c, int(taosError.Code))
 		}
-		p.errorResponse(c, http.StatusInternalServerError, err)
+		p.errorResponse(c, putErrorStatus(err), err)
 		return
 	}
-	logger.Tracef("insert json payload success")
-	p.successResponse(c)
+	logger.Tracef("insert json payload finish, success:%d, failed:%d", summary.Success, summary.Failed)
+	p.putResponse(c, summary)
+}
+
+// putResponse responds the same as opentsdb /api/put, the summary is returned with ?summary or ?details and the
+// failed datapoints are returned with ?details.
+func (p *Plugin) putResponse(c *gin.Context, summary *putSummary) {
+	_, withSummary := c.GetQuery("summary")
+	_, withDetails := c.GetQuery("details")
+	code := http.StatusOK
+	if summary.Failed > 0 {
+		code = http.StatusBadRequest
+	}
+	switch {
+	case withDetails:
+		details := &putDetails{Errors: summary.Errors, Failed: summary.Failed, Success: summary.Success}
+		if details.Errors == nil {
+			details.Errors = []*putError{}
+		}
+		c.JSON(code, details)
+	case withSummary:
+		summary.Errors = nil
+		c.JSON(code, summary)
+	case summary.Failed > 0:
+		c.JSON(code, &tsdbError{Error: tsdbErrorDetail{
+			Code:    code,
+			Message: "One or more data points had errors",
+			Details: "Please see the TSD logs or append \"details\" to the put request",
+		}})
+	default:
+		p.successResponse(c)
+	}
 }
 
 // @Tags opentsdb
@@ -2,6 +2,7 @@ package opentsdb
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -83,6 +84,22 @@ func TestOpentsdb(t *testing.T) {
 		err = exec(conn, "drop database if exists test_plugin_opentsdb_http_json")
 		assert.NoError(t, err)
 	}()
+	w = httptest.NewRecorder()
+	reader = strings.NewReader(fmt.Sprintf(`[
+    {"metric": "sys.cpu.idle", "timestamp": %d, "value": 1, "tags": {"host": "web01"}},
+    {"metric": "sys.cpu.idle", "timestamp": %d, "value": "abc", "tags": {"host": "web01"}}
+]`, time.Now().Unix(), time.Now().Unix()))
+	req, _ = http.NewRequest("POST", "/put/json/test_plugin_opentsdb_http_json?details", reader)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	var details putDetails
+	err = json.Unmarshal(w.Body.Bytes(), &details)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, details.Success)
+	assert.Equal(t, 1, details.Failed)
+	assert.Equal(t, msgInvalidValue, details.Errors[0].Error)
 	defer func() {
 		err = exec(conn, "drop database if exists test_plugin_opentsdb_http_telnet")
 		assert.NoError(t, err)
@@ -109,6 +126,38 @@ func TestOpentsdb(t *testing.T) {
 	if values[0][0].(int32) != 1000 {
 		t.Fatal("ttl miss")
 	}
+
+	w = httptest.NewRecorder()
+	reader = strings.NewReader(`{"start":"1h-ago","queries":[{"aggregator":"sum","metric":"sys.cpu.nice","tags":{"host":"*"}}]}`)
+	req, _ = http.NewRequest("POST", "/tsdb/test_plugin_opentsdb_http_json/api/query", reader)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var results []*queryResult
+	err = json.Unmarshal(w.Body.Bytes(), &results)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, map[string]string{"host": "web01"}, results[0].Tags)
+	assert.Equal(t, []string{"dc"}, results[0].AggregateTags)
+	for _, v := range results[0].Dps {
+		assert.Equal(t, float64(number), v)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/tsdb/test_plugin_opentsdb_http_json/api/suggest?type=metrics&q=sys", nil)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `["sys_cpu_nice"]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/tsdb/test_plugin_opentsdb_http_json/api/query?start=1h-ago&m=sum:not_exist", nil)
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
 }
 
 func exec(conn unsafe.Pointer, sql string) error {
@@ -0,0 +1,197 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+)
+
+// the datapoint errors, the same as opentsdb
+const (
+	msgEmptyMetric    = "Metric name was empty"
+	msgInvalidTime    = "Invalid timestamp"
+	msgEmptyValue     = "Empty value"
+	msgInvalidValue   = "Unable to parse value to a number"
+	msgMissingTags    = "Missing tags"
+	msgEmptyTag       = "Tag key or value was empty"
+	msgInvalidElement = "Unable to parse the datapoint"
+)
+
+type putDatapoint struct {
+	Metric    string                 `json:"metric"`
+	Timestamp json.Number            `json:"timestamp"`
+	Value     interface{}            `json:"value"`
+	Tags      map[string]interface{} `json:"tags"`
+}
+
+type putError struct {
+	Datapoint json.RawMessage `json:"datapoint"`
+	Error     string          `json:"error"`
+}
+
+type putSummary struct {
+	Errors  []*putError `json:"errors,omitempty"`
+	Failed  int         `json:"failed"`
+	Success int         `json:"success"`
+}
+
+// putDetails is the response of ?details, the errors are always returned
+type putDetails struct {
+	Errors  []*putError `json:"errors"`
+	Failed  int         `json:"failed"`
+	Success int         `json:"success"`
+}
+
+// splitDatapoints splits the body of a single datapoint or an array of datapoints.
+func splitDatapoints(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		return []json.RawMessage{data}, nil
+	}
+	var datapoints []json.RawMessage
+	if err := json.Unmarshal(data, &datapoints); err != nil {
+		return nil, err
+	}
+	return datapoints, nil
+}
+
+// validateDatapoint checks the datapoint the same as opentsdb before writing, it returns the error message of an
+// invalid datapoint.
+func validateDatapoint(raw json.RawMessage) string {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var dp putDatapoint
+	if err := decoder.Decode(&dp); err != nil {
+		return msgInvalidElement
+	}
+	if len(strings.TrimSpace(dp.Metric)) == 0 {
+		return msgEmptyMetric
+	}
+	if ts, err := dp.Timestamp.Int64(); err != nil || ts <= 0 {
+		return msgInvalidTime
+	}
+	switch v := dp.Value.(type) {
+	case nil:
+		return msgEmptyValue
+	case json.Number:
+	case string:
+		if len(v) == 0 {
+			return msgEmptyValue
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return msgInvalidValue
+		}
+	default:
+		return msgInvalidValue
+	}
+	if len(dp.Tags) == 0 {
+		return msgMissingTags
+	}
+	for k, v := range dp.Tags {
+		value, ok := v.(string)
+		if len(k) == 0 || !ok || len(value) == 0 {
+			return msgEmptyTag
+		}
+	}
+	return ""
+}
+
+func joinDatapoints(datapoints []json.RawMessage) []byte {
+	b := &bytes.Buffer{}
+	b.WriteByte('[')
+	for i, dp := range datapoints {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(dp)
+	}
+	b.WriteByte(']')
+	return b.Bytes()
+}
+
+// putDatapoints validates the datapoints and writes the valid ones. If the batch fails for a reason other than the
+// connection, the datapoints are written one by one to find the failed ones. An error is returned when the write fails
+// because of the connection.
+func putDatapoints(datapoints []json.RawMessage, insert func(data []byte) error) (*putSummary, error) {
+	summary := &putSummary{}
+	valid := make([]json.RawMessage, 0, len(datapoints))
+	for _, dp := range datapoints {
+		if msg := validateDatapoint(dp); len(msg) > 0 {
+			summary.Errors = append(summary.Errors, &putError{Datapoint: dp, Error: msg})
+			continue
+		}
+		valid = append(valid, dp)
+	}
+	if len(valid) == 0 {
+		summary.Failed = len(summary.Errors)
+		return summary, nil
+	}
+	err := insert(joinDatapoints(valid))
+	switch {
+	case err == nil:
+		summary.Success = len(valid)
+	case !isDatapointError(err):
+		return nil, err
+	case len(valid) == 1:
+		summary.Errors = append(summary.Errors, &putError{Datapoint: valid[0], Error: err.Error()})
+	default:
+		for _, dp := range valid {
+			if err = insert(dp); err != nil {
+				if !isDatapointError(err) {
+					return nil, err
+				}
+				summary.Errors = append(summary.Errors, &putError{Datapoint: dp, Error: err.Error()})
+				continue
+			}
+			summary.Success += 1
+		}
+	}
+	summary.Failed = len(summary.Errors)
+	return summary, nil
+}
+
+// isDatapointError reports whether the error is caused by the data of the datapoints, such as a syntax error or a value
+// out of range. The batch is then written datapoint by datapoint to find the failed ones, other errors apply to the
+// whole request.
+func isDatapointError(err error) bool {
+	var taosError *tErrors.TaosError
+	if !errors.As(err, &taosError) {
+		return false
+	}
+	switch taosError.Code {
+	case httperror.TSDB_CODE_TSC_SQL_SYNTAX_ERROR,
+		httperror.TSDB_CODE_TSC_LINE_SYNTAX_ERROR,
+		httperror.TSDB_CODE_PAR_SYNTAX_ERROR,
+		httperror.TSDB_CODE_TDB_TIMESTAMP_OUT_OF_RANGE,
+		httperror.TSDB_CODE_TSC_VALUE_OUT_OF_RANGE:
+		return true
+	}
+	// schemaless errors
+	return taosError.Code >= 0x3000 && taosError.Code <= 0x30ff
+}
+
+// putErrorStatus returns the http status of an error that fails the whole put request.
+func putErrorStatus(err error) int {
+	if tool.IsConnectionError(err) {
+		return http.StatusServiceUnavailable
+	}
+	var taosError *tErrors.TaosError
+	if errors.As(err, &taosError) {
+		switch taosError.Code {
+		case httperror.TSDB_CODE_MND_DB_NOT_EXIST:
+			return http.StatusBadRequest
+		case httperror.TSDB_CODE_MND_AUTH_FAILURE:
+			return http.StatusUnauthorized
+		case httperror.TSDB_CODE_MND_NO_RIGHTS, httperror.TSDB_CODE_PAR_PERMISSION_DENIED:
+			return http.StatusForbidden
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,156 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+)
+
+func TestValidateDatapoint(t *testing.T) {
+	for raw, expect := range map[string]string{
+		`{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}}`:        "",
+		`{"metric":"m","timestamp":1356998400123,"value":"1.5","tags":{"host":"a"}}`: "",
+		`{"metric":"","timestamp":1356998400,"value":1,"tags":{"host":"a"}}`:         msgEmptyMetric,
+		`{"metric":"m","value":1,"tags":{"host":"a"}}`:                               msgInvalidTime,
+		`{"metric":"m","timestamp":1.5,"value":1,"tags":{"host":"a"}}`:               msgInvalidTime,
+		`{"metric":"m","timestamp":1356998400,"tags":{"host":"a"}}`:                  msgEmptyValue,
+		`{"metric":"m","timestamp":1356998400,"value":"abc","tags":{"host":"a"}}`:    msgInvalidValue,
+		`{"metric":"m","timestamp":1356998400,"value":true,"tags":{"host":"a"}}`:     msgInvalidValue,
+		`{"metric":"m","timestamp":1356998400,"value":1}`:                            msgMissingTags,
+		`{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":""}}`:         msgEmptyTag,
+		`{"metric":"m","timestamp":"now","value":1,"tags":{"host":"a"}}`:             msgInvalidElement,
+		`1`: msgInvalidElement,
+	} {
+		assert.Equal(t, expect, validateDatapoint(json.RawMessage(raw)), raw)
+	}
+}
+
+func TestPutDatapoints(t *testing.T) {
+	datapoints, err := splitDatapoints([]byte(`[
+		{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}},
+		{"metric":"m","timestamp":1356998400,"value":"x","tags":{"host":"a"}},
+		{"metric":"bad","timestamp":1356998400,"value":1,"tags":{"host":"a"}},
+		{"metric":"m","timestamp":1,"value":1,"tags":{"host":"a"}}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, datapoints, 4)
+	var inserted []string
+	insert := func(data []byte) error {
+		if strings.Contains(string(data), `"bad"`) {
+			return tErrors.NewError(0x3002, "Invalid data format")
+		}
+		if strings.Contains(string(data), `"timestamp":1,`) {
+			return tErrors.NewError(httperror.TSDB_CODE_TDB_TIMESTAMP_OUT_OF_RANGE, "Timestamp data out of range")
+		}
+		inserted = append(inserted, string(data))
+		return nil
+	}
+	summary, err := putDatapoints(datapoints, insert)
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Success)
+	assert.Equal(t, 3, summary.Failed)
+	assert.Equal(t, msgInvalidValue, summary.Errors[0].Error)
+	assert.Contains(t, summary.Errors[1].Error, "Invalid data format")
+	assert.Contains(t, summary.Errors[2].Error, "Timestamp data out of range")
+	assert.Equal(t, []string{`{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}}`}, inserted)
+
+	datapoints, err = splitDatapoints([]byte(` {"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}}`))
+	require.NoError(t, err)
+	inserted = nil
+	summary, err = putDatapoints(datapoints, insert)
+	require.NoError(t, err)
+	assert.Equal(t, &putSummary{Success: 1}, summary)
+	assert.Equal(t, []string{`[{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}}]`}, inserted)
+
+	_, err = putDatapoints(datapoints, func(data []byte) error {
+		return tErrors.NewError(httperror.TSDB_CODE_TSC_DISCONNECTED, "Disconnected from server")
+	})
+	assert.Error(t, err)
+
+	_, err = putDatapoints(datapoints, func(data []byte) error {
+		return errors.New("unknown error")
+	})
+	assert.Error(t, err)
+
+	// an error of the whole request is returned after one insert
+	datapoints, err = splitDatapoints([]byte(`[
+		{"metric":"m","timestamp":1356998400,"value":1,"tags":{"host":"a"}},
+		{"metric":"m","timestamp":1356998401,"value":1,"tags":{"host":"a"}}
+	]`))
+	require.NoError(t, err)
+	inserts := 0
+	_, err = putDatapoints(datapoints, func(data []byte) error {
+		inserts += 1
+		return tErrors.NewError(httperror.TSDB_CODE_MND_DB_NOT_EXIST, "Database not exist")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, inserts)
+	assert.Equal(t, http.StatusBadRequest, putErrorStatus(err))
+
+	_, err = splitDatapoints([]byte(`abc`))
+	assert.Error(t, err)
+}
+
+func TestPutErrorStatus(t *testing.T) {
+	for code, status := range map[int]int{
+		httperror.TSDB_CODE_MND_DB_NOT_EXIST:      http.StatusBadRequest,
+		httperror.TSDB_CODE_MND_AUTH_FAILURE:      http.StatusUnauthorized,
+		httperror.TSDB_CODE_PAR_PERMISSION_DENIED: http.StatusForbidden,
+		httperror.TSDB_CODE_TSC_DISCONNECTED:      http.StatusServiceUnavailable,
+		0x0001:                                    http.StatusInternalServerError,
+	} {
+		assert.Equal(t, status, putErrorStatus(tErrors.NewError(code, "error")), code)
+	}
+	assert.Equal(t, http.StatusInternalServerError, putErrorStatus(errors.New("unknown error")))
+}
+
+func TestPutResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := &Plugin{}
+	newSummary := func() *putSummary {
+		return &putSummary{Success: 1, Failed: 1, Errors: []*putError{{Datapoint: json.RawMessage(`{"metric":""}`), Error: msgEmptyMetric}}}
+	}
+	tests := []struct {
+		query   string
+		summary *putSummary
+		code    int
+		body    string
+	}{
+		{query: "", summary: &putSummary{Success: 2}, code: http.StatusNoContent},
+		{query: "summary", summary: &putSummary{Success: 2}, code: http.StatusOK, body: `{"failed":0,"success":2}`},
+		{query: "details", summary: &putSummary{Success: 2}, code: http.StatusOK, body: `{"errors":[],"failed":0,"success":2}`},
+		{query: "summary", summary: newSummary(), code: http.StatusBadRequest, body: `{"failed":1,"success":1}`},
+		{
+			query:   "details",
+			summary: newSummary(),
+			code:    http.StatusBadRequest,
+			body:    `{"errors":[{"datapoint":{"metric":""},"error":"Metric name was empty"}],"failed":1,"success":1}`,
+		},
+		{
+			query:   "",
+			summary: newSummary(),
+			code:    http.StatusBadRequest,
+			body:    `{"error":{"code":400,"message":"One or more data points had errors","details":"Please see the TSD logs or append \"details\" to the put request"}}`,
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/put/json/test?"+tt.query, nil)
+		p.putResponse(c, tt.summary)
+		c.Writer.WriteHeaderNow()
+		assert.Equal(t, tt.code, w.Code, tt.query)
+		if len(tt.body) > 0 {
+			assert.JSONEq(t, tt.body, w.Body.String(), tt.query)
+		}
+	}
+}
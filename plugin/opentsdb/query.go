@@ -0,0 +1,787 @@
+package opentsdb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/tools"
+)
+
+// the columns of the supertables created by schemaless opentsdb protocol
+const (
+	timeColumn  = "_ts"
+	valueColumn = "_value"
+)
+
+// queryExecutor executes the translated sql, timestamp values are time.Time. Tests use a stub.
+type queryExecutor interface {
+	Query(sql string) (columns []string, rows [][]driver.Value, err error)
+}
+
+// isTableNotExist reports whether the error is table does not exist
+func isTableNotExist(err error) bool {
+	taosError, is := err.(*tErrors.TaosError)
+	return is && (taosError.Code == 0x2603 || taosError.Code == 0x2662)
+}
+
+type tsdbFilter struct {
+	Type    string `json:"type"`
+	Tagk    string `json:"tagk"`
+	Filter  string `json:"filter"`
+	GroupBy bool   `json:"groupBy"`
+}
+
+type rateOptions struct {
+	Counter    bool    `json:"counter"`
+	CounterMax float64 `json:"counterMax"`
+	ResetValue float64 `json:"resetValue"`
+	DropResets bool    `json:"dropResets"`
+}
+
+type subQuery struct {
+	Aggregator  string            `json:"aggregator"`
+	Metric      string            `json:"metric"`
+	Rate        bool              `json:"rate"`
+	RateOptions *rateOptions      `json:"rateOptions"`
+	Downsample  string            `json:"downsample"`
+	Tags        map[string]string `json:"tags"`
+	Filters     []*tsdbFilter     `json:"filters"`
+}
+
+type queryRequest struct {
+	Start        interface{} `json:"start"`
+	End          interface{} `json:"end"`
+	Queries      []*subQuery `json:"queries"`
+	MsResolution bool        `json:"msResolution"`
+}
+
+type queryResult struct {
+	Metric        string                 `json:"metric"`
+	Tags          map[string]string      `json:"tags"`
+	AggregateTags []string               `json:"aggregateTags"`
+	Dps           map[string]interface{} `json:"dps"`
+}
+
+// aggregators are the supported aggregators, the percentiles are p50, p75, p90, p95, p99 and p999
+var aggregators = []string{
+	"avg", "count", "dev", "first", "last", "max", "median", "mimmax", "mimmin", "min", "none",
+	"p50", "p75", "p90", "p95", "p99", "p999", "sum", "zimsum",
+}
+
+// downsampleFunctions maps the downsample functions to TDengine functions
+var downsampleFunctions = map[string]string{
+	"avg":    "avg",
+	"sum":    "sum",
+	"zimsum": "sum",
+	"min":    "min",
+	"mimmin": "min",
+	"max":    "max",
+	"mimmax": "max",
+	"count":  "count",
+	"first":  "first",
+	"last":   "last",
+	"dev":    "stddev",
+}
+
+var tsdbUnitDurations = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"n":  30 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// splitTsdbDuration returns the number and the unit of an opentsdb duration such as 1m.
+func splitTsdbDuration(s string) (int64, string, error) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid duration %s", s)
+	}
+	if _, ok := tsdbUnitDurations[s[i:]]; !ok {
+		return 0, "", fmt.Errorf("invalid duration %s", s)
+	}
+	return n, s[i:], nil
+}
+
+// parseTsdbTime parses an absolute or relative (1h-ago) opentsdb time.
+func parseTsdbTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 || s == "now" {
+		return now, nil
+	}
+	if strings.HasSuffix(s, "-ago") {
+		n, unit, err := splitTsdbDuration(s[:len(s)-4])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-time.Duration(n) * tsdbUnitDurations[unit]), nil
+	}
+	if ts, err := strconv.ParseFloat(s, 64); err == nil {
+		// 10 digits or less are seconds, otherwise milliseconds
+		if index := strings.IndexByte(s, '.'); index > 10 || (index < 0 && len(s) > 10) {
+			return time.Unix(0, int64(ts)*int64(time.Millisecond)), nil
+		}
+		return time.Unix(0, int64(ts*1e9)).Truncate(time.Millisecond), nil
+	}
+	for _, layout := range []string{"2006/01/02-15:04:05", "2006/01/02-15:04", "2006/01/02 15:04:05", "2006/01/02"} {
+		if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s", s)
+}
+
+// timeString returns the string of a json time, numbers are unix timestamps.
+func timeString(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	}
+	return "", errors.New("invalid time")
+}
+
+type downsample struct {
+	// interval is the TDengine interval, empty means 0all
+	interval string
+	function string
+	fill     string
+}
+
+// parseDownsample parses the downsample spec interval-function[-fill] such as 1m-avg.
+func parseDownsample(s string) (*downsample, error) {
+	items := strings.Split(s, "-")
+	if len(items) < 2 || len(items) > 3 {
+		return nil, fmt.Errorf("invalid downsample %s", s)
+	}
+	d := &downsample{}
+	if !strings.HasPrefix(items[0], "0all") {
+		n, unit, err := splitTsdbDuration(items[0])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid downsample %s", s)
+		}
+		if unit == "ms" {
+			unit = "a"
+		}
+		d.interval = strconv.FormatInt(n, 10) + unit
+	}
+	function := items[1]
+	switch {
+	case function == "median":
+		d.function = "apercentile(" + valueColumn + ", 50)"
+	case len(function) > 1 && function[0] == 'p':
+		p, err := strconv.Atoi(function[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid downsample function %s", function)
+		}
+		d.function = "apercentile(" + valueColumn + ", " + percentileString(p) + ")"
+	default:
+		f, ok := downsampleFunctions[function]
+		if !ok {
+			return nil, fmt.Errorf("invalid downsample function %s", function)
+		}
+		d.function = f + "(" + valueColumn + ")"
+	}
+	if len(items) == 3 {
+		switch items[2] {
+		case "none":
+		case "nan", "null":
+			d.fill = " fill(null)"
+		case "zero":
+			d.fill = " fill(value,0)"
+		default:
+			return nil, fmt.Errorf("invalid fill policy %s", items[2])
+		}
+	}
+	return d, nil
+}
+
+// percentileString returns the percentile of p50, p999 and so on.
+func percentileString(p int) string {
+	if p >= 100 {
+		return strconv.FormatFloat(float64(p)/10, 'f', -1, 64)
+	}
+	return strconv.Itoa(p)
+}
+
+func percentileValue(function string) (float64, bool) {
+	if function == "median" {
+		return 50, true
+	}
+	if len(function) < 2 || function[0] != 'p' {
+		return 0, false
+	}
+	p, err := strconv.Atoi(function[1:])
+	if err != nil {
+		return 0, false
+	}
+	v, _ := strconv.ParseFloat(percentileString(p), 64)
+	return v, v > 0 && v < 100
+}
+
+// stableName returns the quoted supertable of the metric, schemaless replaces the dots of the metric with underscores.
+func stableName(metric string) (string, error) {
+	return tools.QuoteIdentifier(strings.ReplaceAll(metric, ".", "_"))
+}
+
+// wildcardPattern converts an opentsdb wildcard to a like pattern.
+func wildcardPattern(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	s = strings.ReplaceAll(s, "_", `\_`)
+	return strings.ReplaceAll(s, "*", "%")
+}
+
+func literals(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + tools.EscapeString(v) + "'"
+	}
+	return strings.Join(quoted, ",")
+}
+
+// filterCondition translates a filter to a sql condition.
+func filterCondition(f *tsdbFilter) (string, error) {
+	tag, err := tools.QuoteIdentifier(f.Tagk)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(f.Type) {
+	case "literal_or":
+		return tag + " in (" + literals(strings.Split(f.Filter, "|")) + ")", nil
+	case "iliteral_or":
+		return "lower(" + tag + ") in (" + literals(strings.Split(strings.ToLower(f.Filter), "|")) + ")", nil
+	case "not_literal_or":
+		return tag + " not in (" + literals(strings.Split(f.Filter, "|")) + ")", nil
+	case "not_iliteral_or":
+		return "lower(" + tag + ") not in (" + literals(strings.Split(strings.ToLower(f.Filter), "|")) + ")", nil
+	case "wildcard":
+		if f.Filter == "*" {
+			return tag + " is not null", nil
+		}
+		return tag + " like '" + tools.EscapeString(wildcardPattern(f.Filter)) + "'", nil
+	case "iwildcard":
+		if f.Filter == "*" {
+			return tag + " is not null", nil
+		}
+		return "lower(" + tag + ") like '" + tools.EscapeString(wildcardPattern(strings.ToLower(f.Filter))) + "'", nil
+	case "regexp":
+		return tag + " match '" + tools.EscapeString(f.Filter) + "'", nil
+	}
+	return "", fmt.Errorf("unsupported filter type %s", f.Type)
+}
+
+// tagFilters converts the tags of a sub query to filters, the same as opentsdb 2.2, all of them are grouped by.
+func tagFilters(tags map[string]string) []*tsdbFilter {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	filters := make([]*tsdbFilter, 0, len(keys))
+	for _, k := range keys {
+		v := tags[k]
+		filterType := "literal_or"
+		if strings.Contains(v, "*") {
+			filterType = "wildcard"
+		}
+		filters = append(filters, &tsdbFilter{Type: filterType, Tagk: k, Filter: v, GroupBy: true})
+	}
+	return filters
+}
+
+// queryPlan is the sql of a sub query, each row is time, value, tbname and the group by tags.
+type queryPlan struct {
+	sql       string
+	groupTags []string
+	// constTags are the tags with a single literal value
+	constTags map[string]string
+	// timeless is true for the 0all downsample, the time of the rows is the start
+	timeless bool
+}
+
+// translateSubQuery translates a sub query to sql over the supertable of the metric.
+func translateSubQuery(sub *subQuery, start, end time.Time) (*queryPlan, error) {
+	if len(sub.Metric) == 0 {
+		return nil, errors.New("missing metric")
+	}
+	stable, err := stableName(sub.Metric)
+	if err != nil {
+		return nil, err
+	}
+	plan := &queryPlan{constTags: map[string]string{}}
+	conditions := []string{
+		timeColumn + " >= '" + start.UTC().Format(time.RFC3339Nano) + "'",
+		timeColumn + " <= '" + end.UTC().Format(time.RFC3339Nano) + "'",
+	}
+	grouped := map[string]bool{}
+	for _, f := range append(tagFilters(sub.Tags), sub.Filters...) {
+		condition, err := filterCondition(f)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		if f.GroupBy && !grouped[f.Tagk] {
+			grouped[f.Tagk] = true
+			plan.groupTags = append(plan.groupTags, f.Tagk)
+		}
+		if strings.EqualFold(f.Type, "literal_or") && !strings.Contains(f.Filter, "|") {
+			plan.constTags[f.Tagk] = f.Filter
+		}
+	}
+	tags := ""
+	for _, tag := range plan.groupTags {
+		quoted, _ := tools.QuoteIdentifier(tag)
+		tags += "," + quoted
+	}
+	where := " from " + stable + " where " + strings.Join(conditions, " and ")
+	if len(sub.Downsample) == 0 {
+		plan.sql = "select " + timeColumn + "," + valueColumn + ",tbname" + tags + where
+		return plan, nil
+	}
+	d, err := parseDownsample(sub.Downsample)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.interval) == 0 {
+		plan.timeless = true
+		plan.sql = "select " + d.function + ",tbname" + tags + where + " partition by tbname" + tags
+		return plan, nil
+	}
+	plan.sql = "select _wstart," + d.function + ",tbname" + tags + where + " partition by tbname" + tags +
+		" interval(" + d.interval + ")" + d.fill
+	return plan, nil
+}
+
+type point struct {
+	ts    int64
+	value *float64
+}
+
+type series struct {
+	tbname string
+	tags   []string
+	points []*point
+}
+
+func toFloat(v driver.Value) *float64 {
+	var f float64
+	switch value := v.(type) {
+	case float64:
+		f = value
+	case float32:
+		f = float64(value)
+	case int64:
+		f = float64(value)
+	case int32:
+		f = float64(value)
+	case int16:
+		f = float64(value)
+	case int8:
+		f = float64(value)
+	case uint64:
+		f = float64(value)
+	case uint32:
+		f = float64(value)
+	case uint16:
+		f = float64(value)
+	case uint8:
+		f = float64(value)
+	case bool:
+		if value {
+			f = 1
+		}
+	default:
+		return nil
+	}
+	return &f
+}
+
+func toString(v driver.Value) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	}
+	return ""
+}
+
+// rate returns the per second rate of the consecutive points.
+func rate(points []*point, options *rateOptions) []*point {
+	if options == nil {
+		options = &rateOptions{}
+	}
+	counterMax := options.CounterMax
+	if counterMax <= 0 {
+		counterMax = math.MaxInt64
+	}
+	result := make([]*point, 0, len(points))
+	var prev *point
+	for _, p := range points {
+		if p.value == nil {
+			continue
+		}
+		if prev == nil || p.ts == prev.ts {
+			prev = p
+			continue
+		}
+		delta := *p.value - *prev.value
+		if options.Counter && delta < 0 {
+			if options.DropResets {
+				prev = p
+				continue
+			}
+			delta = counterMax - *prev.value + *p.value
+		}
+		r := delta / (float64(p.ts-prev.ts) / 1000)
+		if options.Counter && options.ResetValue > 0 && r > options.ResetValue {
+			r = 0
+		}
+		result = append(result, &point{ts: p.ts, value: &r})
+		prev = p
+	}
+	return result
+}
+
+// aggregate aggregates the values of the same timestamp.
+func aggregate(aggregator string, values []float64) float64 {
+	switch aggregator {
+	case "sum", "zimsum":
+		sum := float64(0)
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case "min", "mimmin":
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	case "max", "mimmax":
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	case "avg":
+		return aggregate("sum", values) / float64(len(values))
+	case "count":
+		return float64(len(values))
+	case "dev":
+		avg := aggregate("avg", values)
+		sum := float64(0)
+		for _, v := range values {
+			sum += (v - avg) * (v - avg)
+		}
+		return math.Sqrt(sum / float64(len(values)))
+	case "first":
+		return values[0]
+	case "last":
+		return values[len(values)-1]
+	}
+	p, _ := percentileValue(aggregator)
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+func validAggregator(aggregator string) bool {
+	for _, a := range aggregators {
+		if a == aggregator {
+			return true
+		}
+	}
+	return false
+}
+
+// queryRunner runs the sub queries of a request.
+type queryRunner struct {
+	executor     queryExecutor
+	start        time.Time
+	end          time.Time
+	msResolution bool
+}
+
+// tagKeys returns the tag keys of the metric.
+func (r *queryRunner) tagKeys(stable string) ([]string, error) {
+	_, rows, err := r.executor.Query("describe " + stable)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	// field type length note
+	for _, row := range rows {
+		if len(row) >= 4 && toString(row[3]) == "TAG" {
+			keys = append(keys, toString(row[0]))
+		}
+	}
+	return keys, nil
+}
+
+func (r *queryRunner) run(sub *subQuery) ([]*queryResult, error) {
+	if !validAggregator(sub.Aggregator) {
+		return nil, fmt.Errorf("no such aggregator %s", sub.Aggregator)
+	}
+	plan, err := translateSubQuery(sub, r.start, r.end)
+	if err != nil {
+		return nil, err
+	}
+	stable, _ := stableName(sub.Metric)
+	tagKeys, err := r.tagKeys(stable)
+	if err != nil {
+		if isTableNotExist(err) {
+			return nil, fmt.Errorf("no such name for 'metrics': '%s'", sub.Metric)
+		}
+		return nil, err
+	}
+	_, rows, err := r.executor.Query(plan.sql)
+	if err != nil {
+		return nil, err
+	}
+	allSeries := map[string]*series{}
+	var tbnames []string
+	columns := 2
+	if plan.timeless {
+		columns = 1
+	}
+	for _, row := range rows {
+		if len(row) < columns+1+len(plan.groupTags) {
+			continue
+		}
+		p := &point{ts: r.start.UnixNano() / 1e6}
+		if !plan.timeless {
+			ts, ok := row[0].(time.Time)
+			if !ok {
+				continue
+			}
+			p.ts = ts.UnixNano() / 1e6
+		}
+		p.value = toFloat(row[columns-1])
+		tbname := toString(row[columns])
+		s, exist := allSeries[tbname]
+		if !exist {
+			s = &series{tbname: tbname}
+			for _, v := range row[columns+1 : columns+1+len(plan.groupTags)] {
+				s.tags = append(s.tags, toString(v))
+			}
+			allSeries[tbname] = s
+			tbnames = append(tbnames, tbname)
+		}
+		s.points = append(s.points, p)
+	}
+	sort.Strings(tbnames)
+	groups := map[string][]*series{}
+	var groupKeys []string
+	for _, tbname := range tbnames {
+		s := allSeries[tbname]
+		sort.SliceStable(s.points, func(i, j int) bool {
+			return s.points[i].ts < s.points[j].ts
+		})
+		if sub.Rate {
+			s.points = rate(s.points, sub.RateOptions)
+		}
+		key := strings.Join(s.tags, "\x00")
+		if sub.Aggregator == "none" {
+			key += "\x00" + tbname
+		}
+		if _, exist := groups[key]; !exist {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	sort.Strings(groupKeys)
+	results := make([]*queryResult, 0, len(groupKeys))
+	for _, key := range groupKeys {
+		group := groups[key]
+		result := &queryResult{Metric: sub.Metric, Tags: map[string]string{}, AggregateTags: []string{}, Dps: map[string]interface{}{}}
+		for k, v := range plan.constTags {
+			result.Tags[k] = v
+		}
+		for i, tag := range plan.groupTags {
+			result.Tags[tag] = group[0].tags[i]
+		}
+		for _, k := range tagKeys {
+			if _, exist := result.Tags[k]; !exist {
+				result.AggregateTags = append(result.AggregateTags, k)
+			}
+		}
+		values := map[int64][]float64{}
+		var timestamps []int64
+		for _, s := range group {
+			for _, p := range s.points {
+				v, exist := values[p.ts]
+				if !exist {
+					timestamps = append(timestamps, p.ts)
+				}
+				if p.value != nil {
+					v = append(v, *p.value)
+				}
+				values[p.ts] = v
+			}
+		}
+		for _, ts := range timestamps {
+			key := strconv.FormatInt(ts/1000, 10)
+			if r.msResolution {
+				key = strconv.FormatInt(ts, 10)
+			}
+			if len(values[ts]) == 0 {
+				result.Dps[key] = nil
+				continue
+			}
+			aggregator := sub.Aggregator
+			if aggregator == "none" {
+				aggregator = "first"
+			}
+			result.Dps[key] = aggregate(aggregator, values[ts])
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// parseMetricQuery parses the m parameter aggregator:[rate[{counter[,max[,reset]]}]:][downsample:]metric[{tags}][{filters}].
+func parseMetricQuery(m string) (*subQuery, error) {
+	sub := &subQuery{}
+	// the braces of the rate options are not filters
+	from := 0
+	if index := strings.Index(m, ":rate{"); index >= 0 {
+		if end := strings.IndexByte(m[index:], '}'); end >= 0 {
+			from = index + end
+		}
+	}
+	braces := strings.IndexByte(m[from:], '{')
+	head, filters := m, ""
+	if braces >= 0 {
+		head, filters = m[:from+braces], m[from+braces:]
+	}
+	items := strings.Split(head, ":")
+	if len(items) < 2 {
+		return nil, fmt.Errorf("invalid m parameter %s", m)
+	}
+	sub.Aggregator = items[0]
+	sub.Metric = items[len(items)-1]
+	for _, item := range items[1 : len(items)-1] {
+		switch {
+		case strings.HasPrefix(item, "rate"):
+			sub.Rate = true
+			options := strings.TrimPrefix(item, "rate")
+			if len(options) == 0 {
+				continue
+			}
+			if !strings.HasPrefix(options, "{") || !strings.HasSuffix(options, "}") {
+				return nil, fmt.Errorf("invalid rate options %s", item)
+			}
+			sub.RateOptions = &rateOptions{}
+			for i, option := range strings.Split(options[1:len(options)-1], ",") {
+				var err error
+				switch i {
+				case 0:
+					sub.RateOptions.Counter = option == "counter"
+				case 1:
+					if len(option) > 0 {
+						sub.RateOptions.CounterMax, err = strconv.ParseFloat(option, 64)
+					}
+				case 2:
+					if len(option) > 0 {
+						sub.RateOptions.ResetValue, err = strconv.ParseFloat(option, 64)
+					}
+				}
+				if err != nil {
+					return nil, fmt.Errorf("invalid rate options %s", item)
+				}
+			}
+		case strings.Contains(item, "-"):
+			sub.Downsample = item
+		}
+	}
+	for i := 0; len(filters) > 0; i++ {
+		end := strings.IndexByte(filters, '}')
+		if filters[0] != '{' || end < 0 || i > 1 {
+			return nil, fmt.Errorf("invalid m parameter %s", m)
+		}
+		for _, item := range strings.Split(filters[1:end], ",") {
+			if len(item) == 0 {
+				continue
+			}
+			f, err := parseFilter(item, i == 0)
+			if err != nil {
+				return nil, err
+			}
+			sub.Filters = append(sub.Filters, f)
+		}
+		filters = filters[end+1:]
+	}
+	return sub, nil
+}
+
+// parseFilter parses tagk=value or tagk=type(filter).
+func parseFilter(s string, groupBy bool) (*tsdbFilter, error) {
+	index := strings.IndexByte(s, '=')
+	if index <= 0 {
+		return nil, fmt.Errorf("invalid filter %s", s)
+	}
+	f := &tsdbFilter{Tagk: s[:index], Filter: s[index+1:], GroupBy: groupBy}
+	if open := strings.IndexByte(f.Filter, '('); open > 0 && strings.HasSuffix(f.Filter, ")") {
+		f.Type = f.Filter[:open]
+		f.Filter = f.Filter[open+1 : len(f.Filter)-1]
+		return f, nil
+	}
+	f.Type = "literal_or"
+	if strings.Contains(f.Filter, "*") {
+		f.Type = "wildcard"
+	}
+	return f, nil
+}
+
+// parseQueryRequest parses the json body of post or the parameters of get.
+func parseQueryRequest(body []byte, query map[string][]string) (*queryRequest, error) {
+	req := &queryRequest{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	if start := query["start"]; len(start) > 0 {
+		req.Start = start[0]
+	}
+	if end := query["end"]; len(end) > 0 {
+		req.End = end[0]
+	}
+	_, req.MsResolution = query["ms"]
+	if v := query["msResolution"]; len(v) > 0 {
+		req.MsResolution = v[0] != "false"
+	}
+	for _, m := range query["m"] {
+		sub, err := parseMetricQuery(m)
+		if err != nil {
+			return nil, err
+		}
+		req.Queries = append(req.Queries, sub)
+	}
+	return req, nil
+}
@@ -0,0 +1,232 @@
+package opentsdb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubExecutor struct {
+	results map[string][][]driver.Value
+	sqls    []string
+}
+
+func (e *stubExecutor) Query(sql string) ([]string, [][]driver.Value, error) {
+	e.sqls = append(e.sqls, sql)
+	for prefix, rows := range e.results {
+		if strings.HasPrefix(sql, prefix) {
+			return nil, rows, nil
+		}
+	}
+	return nil, nil, errors.New("unexpected sql " + sql)
+}
+
+func TestParseTsdbTime(t *testing.T) {
+	now := time.Unix(3600, 0)
+	for s, expect := range map[string]int64{
+		"":                 3600000,
+		"now":              3600000,
+		"1h-ago":           0,
+		"30m-ago":          1800000,
+		"1356998400":       1356998400000,
+		"1356998400123":    1356998400123,
+		"1356998400.5":     1356998400500,
+		"500ms-ago":        3599500,
+		"2013/01/01":       time.Date(2013, 1, 1, 0, 0, 0, 0, time.Local).UnixNano() / 1e6,
+		"2013/01/01-12:30": time.Date(2013, 1, 1, 12, 30, 0, 0, time.Local).UnixNano() / 1e6,
+	} {
+		ts, err := parseTsdbTime(s, now)
+		require.NoError(t, err, s)
+		assert.Equal(t, expect, ts.UnixNano()/1e6, s)
+	}
+	for _, s := range []string{"1x-ago", "abc", "h-ago"} {
+		_, err := parseTsdbTime(s, now)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseMetricQuery(t *testing.T) {
+	sub, err := parseMetricQuery("sum:rate{counter,100,10}:1m-avg-zero:sys.cpu.user{host=*,dc=literal_or(lga|sjc)}{env=prod}")
+	require.NoError(t, err)
+	assert.Equal(t, &subQuery{
+		Aggregator:  "sum",
+		Metric:      "sys.cpu.user",
+		Rate:        true,
+		RateOptions: &rateOptions{Counter: true, CounterMax: 100, ResetValue: 10},
+		Downsample:  "1m-avg-zero",
+		Filters: []*tsdbFilter{
+			{Type: "wildcard", Tagk: "host", Filter: "*", GroupBy: true},
+			{Type: "literal_or", Tagk: "dc", Filter: "lga|sjc", GroupBy: true},
+			{Type: "literal_or", Tagk: "env", Filter: "prod"},
+		},
+	}, sub)
+
+	for _, m := range []string{"sys.cpu.user", "sum:rate{x:m", "sum:m{host}", "sum:m{a=b}{c=d}{e=f}"} {
+		_, err = parseMetricQuery(m)
+		assert.Error(t, err, m)
+	}
+
+	req, err := parseQueryRequest(nil, url.Values{"start": {"1h-ago"}, "m": {"avg:m"}, "ms": {""}})
+	require.NoError(t, err)
+	assert.Equal(t, "1h-ago", req.Start)
+	assert.True(t, req.MsResolution)
+	assert.Len(t, req.Queries, 1)
+
+	req, err = parseQueryRequest([]byte(`{"start":1356998400,"queries":[{"aggregator":"sum","metric":"m"}]}`), nil)
+	require.NoError(t, err)
+	start, err := timeString(req.Start)
+	require.NoError(t, err)
+	assert.Equal(t, "1356998400", start)
+}
+
+func TestTranslateSubQuery(t *testing.T) {
+	start := time.Unix(0, 0)
+	end := time.Unix(3600, 0)
+	tests := []struct {
+		sub       *subQuery
+		sql       string
+		groupTags []string
+	}{
+		{
+			sub: &subQuery{Aggregator: "sum", Metric: "sys.cpu.user", Tags: map[string]string{"host": "*", "dc": "lga"}},
+			sql: "select _ts,_value,tbname,`dc`,`host` from `sys_cpu_user` where _ts >= '1970-01-01T00:00:00Z' and _ts <= '1970-01-01T01:00:00Z'" +
+				" and `dc` in ('lga') and `host` is not null",
+			groupTags: []string{"dc", "host"},
+		},
+		{
+			sub: &subQuery{Aggregator: "avg", Metric: "m", Downsample: "1m-avg-zero", Filters: []*tsdbFilter{
+				{Type: "wildcard", Tagk: "host", Filter: "web_*"},
+				{Type: "iliteral_or", Tagk: "dc", Filter: "LGA|sjc", GroupBy: true},
+				{Type: "not_literal_or", Tagk: "env", Filter: "it's"},
+				{Type: "regexp", Tagk: "rack", Filter: "^r[0-9]$"},
+			}},
+			sql: "select _wstart,avg(_value),tbname,`dc` from `m` where _ts >= '1970-01-01T00:00:00Z' and _ts <= '1970-01-01T01:00:00Z'" +
+				" and `host` like 'web\\\\_%' and lower(`dc`) in ('lga','sjc') and `env` not in ('it\\'s') and `rack` match '^r[0-9]$'" +
+				" partition by tbname,`dc` interval(1m) fill(value,0)",
+			groupTags: []string{"dc"},
+		},
+		{
+			sub: &subQuery{Aggregator: "max", Metric: "m", Downsample: "0all-p95"},
+			sql: "select apercentile(_value, 95),tbname from `m` where _ts >= '1970-01-01T00:00:00Z' and _ts <= '1970-01-01T01:00:00Z' partition by tbname",
+		},
+		{
+			sub: &subQuery{Aggregator: "max", Metric: "m", Downsample: "500ms-p999-null"},
+			sql: "select _wstart,apercentile(_value, 99.9),tbname from `m` where _ts >= '1970-01-01T00:00:00Z' and _ts <= '1970-01-01T01:00:00Z' partition by tbname interval(500a) fill(null)",
+		},
+	}
+	for _, tt := range tests {
+		plan, err := translateSubQuery(tt.sub, start, end)
+		require.NoError(t, err)
+		assert.Equal(t, tt.sql, plan.sql)
+		assert.Equal(t, tt.groupTags, plan.groupTags)
+	}
+
+	for _, sub := range []*subQuery{
+		{Aggregator: "sum"},
+		{Aggregator: "sum", Metric: "m", Downsample: "1m"},
+		{Aggregator: "sum", Metric: "m", Downsample: "1m-foo"},
+		{Aggregator: "sum", Metric: "m", Downsample: "1x-avg"},
+		{Aggregator: "sum", Metric: "m", Downsample: "1m-avg-linear"},
+		{Aggregator: "sum", Metric: "m", Filters: []*tsdbFilter{{Type: "unknown", Tagk: "a", Filter: "b"}}},
+	} {
+		_, err := translateSubQuery(sub, start, end)
+		assert.Error(t, err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	value := func(v float64) *float64 {
+		return &v
+	}
+	points := []*point{{ts: 0, value: value(10)}, {ts: 10000, value: value(30)}, {ts: 20000, value: value(5)}, {ts: 30000, value: nil}, {ts: 40000, value: value(25)}}
+	rates := func(points []*point) []float64 {
+		var result []float64
+		for _, p := range points {
+			result = append(result, *p.value)
+		}
+		return result
+	}
+	assert.Equal(t, []float64{2, -2.5, 1}, rates(rate(points, nil)))
+	assert.Equal(t, []float64{2, 7.5, 1}, rates(rate(points, &rateOptions{Counter: true, CounterMax: 100})))
+	assert.Equal(t, []float64{2, 0, 1}, rates(rate(points, &rateOptions{Counter: true, CounterMax: 100, ResetValue: 5})))
+	assert.Equal(t, []float64{2, 1}, rates(rate(points, &rateOptions{Counter: true, DropResets: true})))
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{4, 1, 3, 2}
+	for aggregator, expect := range map[string]float64{
+		"sum":    10,
+		"zimsum": 10,
+		"min":    1,
+		"mimmax": 4,
+		"avg":    2.5,
+		"count":  4,
+		"first":  4,
+		"last":   2,
+		"median": 2,
+		"p75":    3,
+		"p999":   4,
+	} {
+		assert.Equal(t, expect, aggregate(aggregator, values), aggregator)
+	}
+	assert.InDelta(t, 1.118, aggregate("dev", values), 0.001)
+}
+
+func TestQueryRunner(t *testing.T) {
+	executor := &stubExecutor{results: map[string][][]driver.Value{
+		"describe": {
+			{"_ts", "TIMESTAMP", int32(8), ""},
+			{"_value", "DOUBLE", int32(8), ""},
+			{"dc", "NCHAR(8)", int32(8), "TAG"},
+			{"host", "NCHAR(8)", int32(8), "TAG"},
+		},
+		"select _wstart": {
+			{time.Unix(0, 0), 1.0, "t1", "lga"},
+			{time.Unix(60, 0), 2.0, "t1", "lga"},
+			{time.Unix(0, 0), 3.0, "t2", "lga"},
+			{time.Unix(60, 0), nil, "t2", "lga"},
+			{time.Unix(0, 0), 10.0, "t3", "sjc"},
+		},
+	}}
+	runner := &queryRunner{executor: executor, start: time.Unix(0, 0), end: time.Unix(3600, 0)}
+	results, err := runner.run(&subQuery{Aggregator: "sum", Metric: "m", Downsample: "1m-avg", Tags: map[string]string{"dc": "*"}})
+	require.NoError(t, err)
+	b, err := json.Marshal(results)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"metric":"m","tags":{"dc":"lga"},"aggregateTags":["host"],"dps":{"0":4,"60":2}},
+		{"metric":"m","tags":{"dc":"sjc"},"aggregateTags":["host"],"dps":{"0":10}}
+	]`, string(b))
+
+	runner.msResolution = true
+	results, err = runner.run(&subQuery{Aggregator: "none", Metric: "m", Downsample: "1m-avg", Filters: []*tsdbFilter{{Type: "literal_or", Tagk: "dc", Filter: "lga", GroupBy: true}}})
+	require.NoError(t, err)
+	b, err = json.Marshal(results)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"metric":"m","tags":{"dc":"lga"},"aggregateTags":["host"],"dps":{"0":1,"60000":2}},
+		{"metric":"m","tags":{"dc":"lga"},"aggregateTags":["host"],"dps":{"0":3,"60000":null}},
+		{"metric":"m","tags":{"dc":"sjc"},"aggregateTags":["host"],"dps":{"0":10}}
+	]`, string(b))
+
+	_, err = runner.run(&subQuery{Aggregator: "foo", Metric: "m"})
+	assert.Error(t, err)
+}
+
+func TestTranslateSuggest(t *testing.T) {
+	sql, err := translateSuggest("test", &suggestRequest{Type: "metrics", Q: "sys_", Max: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "select stable_name from information_schema.ins_stables where db_name = 'test' and stable_name like 'sys\\\\_%' order by stable_name limit 10", sql)
+	sql, err = translateSuggest("test", &suggestRequest{Type: "tagv", Max: 25})
+	require.NoError(t, err)
+	assert.Equal(t, "select distinct tag_value from information_schema.ins_tags where db_name = 'test' and tag_value like '%' order by tag_value limit 25", sql)
+	_, err = translateSuggest("test", &suggestRequest{Type: "foo"})
+	assert.Error(t, err)
+}
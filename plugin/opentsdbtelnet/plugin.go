@@ -7,6 +7,7 @@ import (
 	"io"
 	"math"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +18,7 @@ import (
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
 	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
 	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
 	"github.com/taosdata/taosadapter/v3/tools/generator"
 	"github.com/taosdata/taosadapter/v3/tools/joinerror"
@@ -30,6 +32,7 @@ type Plugin struct {
 	done         chan struct{}
 	wg           sync.WaitGroup
 	TCPListeners []*TCPListener
+	spool        *spool.Spool
 }
 
 type TCPListener struct {
@@ -159,7 +162,9 @@ func (c *Connection) handle() {
 				flushInterval = math.MaxInt64
 			}
 			ticker := time.NewTicker(flushInterval)
+			c.l.wg.Add(1)
 			go func() {
+				defer c.l.wg.Done()
 				for {
 					select {
 					case <-c.exit:
@@ -180,6 +185,10 @@ func (c *Connection) handle() {
 						return
 					case <-c.l.done:
 						ticker.Stop()
+						if len(cache) > 0 {
+							c.l.plugin.handleData(c, cache, ip)
+							cache = cache[:0]
+						}
 						return
 					case <-ticker.C:
 						if len(cache) > 0 {
@@ -270,10 +279,20 @@ func (p *Plugin) Start() error {
 	if !p.conf.Enable {
 		return nil
 	}
+	var err error
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			return p.insertLines(r.ClientIP, r.DB, strings.Split(string(r.Data), "\n"))
+		})
+	}
 	p.TCPListeners = make([]*TCPListener, len(p.conf.PortList))
 	p.done = make(chan struct{})
 	for i := 0; i < len(p.conf.PortList); i++ {
-		err := p.tcp(p.conf.PortList[i], i)
+		err = p.tcp(p.conf.PortList[i], i)
 		if err != nil {
 			return err
 		}
@@ -296,6 +315,12 @@ func (p *Plugin) Stop() error {
 		}
 	}
 	p.wg.Wait()
+	if p.spool != nil {
+		err := p.spool.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if len(errs) > 0 {
 		return joinerror.Join(errs...)
 	}
@@ -339,13 +364,19 @@ func (p *Plugin) tcp(port int, index int) error {
 }
 
 func (p *Plugin) handleData(connection *Connection, line []string, clientIP net.IP) {
+	err := p.insertLines(clientIP, connection.db, line)
+	if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+		connection.close()
+		return
+	}
+	p.spool.AppendFailed(&spool.Record{DB: connection.db, ClientIP: clientIP, Data: []byte(strings.Join(line, "\n"))}, err)
+}
+
+func (p *Plugin) insertLines(clientIP net.IP, db string, line []string) error {
 	taosConn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, clientIP)
 	if err != nil {
 		logger.WithError(err).Error("connect server error")
-		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
-			connection.close()
-		}
-		return
+		return err
 	}
 	defer func() {
 		putErr := taosConn.Put()
@@ -358,11 +389,12 @@ func (p *Plugin) handleData(connection *Connection, line []string, clientIP net.
 	reqID := generator.GetReqID()
 	logger := logger.WithField(config.ReqIDKey, reqID)
 	logger.Debugf("insert telnet payload, lines:%s", line)
-	err = inserter.InsertOpentsdbTelnetBatch(taosConn.TaosConnection, line, connection.db, p.conf.TTL, uint64(reqID), "", logger)
+	err = inserter.InsertOpentsdbTelnetBatch(taosConn.TaosConnection, line, db, p.conf.TTL, uint64(reqID), "", logger)
 	if err != nil {
 		logger.WithError(err).Errorln("insert telnet payload error :", line)
 	}
 	logger.Debug("insert telnet payload cost:", log.GetLogDuration(isDebug, start))
+	return err
 }
 
 func init() {
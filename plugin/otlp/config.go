@@ -0,0 +1,72 @@
+package otlp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type Config struct {
+	Enable bool
+	// DB is the database written by gRPC requests and by HTTP requests without the db query parameter
+	DB string
+	// GRPCPort is the port of the OTLP gRPC receiver, 0 means disabled
+	GRPCPort int
+	TTL      int
+	// LogsTable and TracesTable are the supertables of the logs and the spans
+	LogsTable   string
+	TracesTable string
+}
+
+func (c *Config) setValue() {
+	c.Enable = viper.GetBool("otlp.enable")
+	c.DB = viper.GetString("otlp.db")
+	c.GRPCPort = viper.GetInt("otlp.grpcPort")
+	c.TTL = viper.GetInt("otlp.ttl")
+	c.LogsTable = viper.GetString("otlp.logsTable")
+	c.TracesTable = viper.GetString("otlp.tracesTable")
+}
+
+func (c *Config) check() error {
+	if len(c.DB) == 0 {
+		return errors.New("otlp.db required")
+	}
+	if c.GRPCPort < 0 || c.GRPCPort > 65535 {
+		return fmt.Errorf("invalid otlp.grpcPort %d, should be between 0 and 65535", c.GRPCPort)
+	}
+	if len(c.LogsTable) == 0 || sanitize(c.LogsTable) != c.LogsTable {
+		return fmt.Errorf("invalid otlp.logsTable %s, should only contain letters, digits and underscores", c.LogsTable)
+	}
+	if len(c.TracesTable) == 0 || sanitize(c.TracesTable) != c.TracesTable {
+		return fmt.Errorf("invalid otlp.tracesTable %s, should only contain letters, digits and underscores", c.TracesTable)
+	}
+	return nil
+}
+
+func init() {
+	_ = viper.BindEnv("otlp.enable", "TAOS_ADAPTER_OTLP_ENABLE")
+	pflag.Bool("otlp.enable", false, `enable OpenTelemetry OTLP receiver. Env "TAOS_ADAPTER_OTLP_ENABLE"`)
+	viper.SetDefault("otlp.enable", false)
+
+	_ = viper.BindEnv("otlp.db", "TAOS_ADAPTER_OTLP_DB")
+	pflag.String("otlp.db", "otlp", `otlp db name, used by gRPC and by HTTP requests without the db parameter. Env "TAOS_ADAPTER_OTLP_DB"`)
+	viper.SetDefault("otlp.db", "otlp")
+
+	_ = viper.BindEnv("otlp.grpcPort", "TAOS_ADAPTER_OTLP_GRPC_PORT")
+	pflag.Int("otlp.grpcPort", 0, `otlp gRPC receiver port, 0 means disabled. Env "TAOS_ADAPTER_OTLP_GRPC_PORT"`)
+	viper.SetDefault("otlp.grpcPort", 0)
+
+	_ = viper.BindEnv("otlp.ttl", "TAOS_ADAPTER_OTLP_TTL")
+	pflag.Int("otlp.ttl", 0, `otlp data ttl. Env "TAOS_ADAPTER_OTLP_TTL"`)
+	viper.SetDefault("otlp.ttl", 0)
+
+	_ = viper.BindEnv("otlp.logsTable", "TAOS_ADAPTER_OTLP_LOGS_TABLE")
+	pflag.String("otlp.logsTable", "otel_logs", `otlp logs supertable name. Env "TAOS_ADAPTER_OTLP_LOGS_TABLE"`)
+	viper.SetDefault("otlp.logsTable", "otel_logs")
+
+	_ = viper.BindEnv("otlp.tracesTable", "TAOS_ADAPTER_OTLP_TRACES_TABLE")
+	pflag.String("otlp.tracesTable", "otel_traces", `otlp traces supertable name. Env "TAOS_ADAPTER_OTLP_TRACES_TABLE"`)
+	viper.SetDefault("otlp.tracesTable", "otel_traces")
+}
@@ -0,0 +1,58 @@
+package otlp
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+var logColumns = []column{
+	{name: "ts", typ: "timestamp"},
+	{name: "observed_ts", typ: "timestamp"},
+	{name: "severity_number", typ: "int"},
+	{name: "severity_text", typ: "varchar", length: 32},
+	{name: "body", typ: "varchar", length: 16384},
+	{name: "trace_id", typ: "varchar", length: 32},
+	{name: "span_id", typ: "varchar", length: 16},
+	{name: "flags", typ: "int unsigned"},
+	{name: "attributes", typ: "varchar", length: 8192},
+	{name: "scope_name", typ: "varchar", length: 256},
+	{name: "scope_version", typ: "varchar", length: 64},
+}
+
+// convertLogs groups the log records into the child tables of the logs supertable, the timestamp is the time of
+// the event, or the observed time without it.
+func convertLogs(ld plog.Logs, stable string, now time.Time) *tableBuilder {
+	b := newTableBuilder(stable, logColumns)
+	rls := ld.ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		rl := rls.At(i)
+		table := b.table(rl.Resource())
+		sls := rl.ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			sl := sls.At(j)
+			records := sl.LogRecords()
+			for k := 0; k < records.Len(); k++ {
+				record := records.At(k)
+				ts := record.Timestamp()
+				if ts == 0 {
+					ts = record.ObservedTimestamp()
+				}
+				b.appendRow(table,
+					timestamp(ts, now),
+					nullTimestamp(record.ObservedTimestamp()),
+					int32(record.SeverityNumber()),
+					record.SeverityText(),
+					record.Body().AsString(),
+					record.TraceID().HexString(),
+					record.SpanID().HexString(),
+					record.Flags(),
+					marshalAttributes(record.Attributes()),
+					sl.Scope().Name(),
+					sl.Scope().Version(),
+				)
+			}
+		}
+	}
+	return b
+}
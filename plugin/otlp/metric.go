@@ -0,0 +1,271 @@
+package otlp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+const (
+	scopeNameTag    = "otel_scope_name"
+	scopeVersionTag = "otel_scope_version"
+)
+
+// convertMetrics converts the OTLP metrics to telegraf metrics, each metric is written to the supertable of its
+// sanitized name with the resource attributes, the scope name and version and the datapoint attributes as tags.
+//
+//   - gauge and sum: field `value`
+//   - histogram: fields `count`, `sum`, `min` and `max`, and one row of `<name>_bucket` with tag `le` and the
+//     cumulative count in field `value` for each bucket
+//   - exponential histogram: fields `count`, `sum`, `min`, `max`, `scale` and `zero_count`, and one row of
+//     `<name>_bucket` with tags `sign` and `index` and fields `count`, `lower` and `upper` for each bucket
+//   - summary: fields `count` and `sum`, and one row of `<name>_quantile` with tag `quantile` and field `value`
+//     for each quantile
+//
+// Datapoints flagged with no recorded value are skipped, datapoints without timestamp use now.
+func convertMetrics(md pmetric.Metrics, now time.Time) []telegraf.Metric {
+	var result []telegraf.Metric
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		resourceTags := map[string]string{}
+		addAttributes(resourceTags, rm.Resource().Attributes())
+		sms := rm.ScopeMetrics()
+		for j := 0; j < sms.Len(); j++ {
+			sm := sms.At(j)
+			scopeTags := copyTags(resourceTags)
+			if name := sm.Scope().Name(); len(name) > 0 {
+				scopeTags[scopeNameTag] = name
+			}
+			if version := sm.Scope().Version(); len(version) > 0 {
+				scopeTags[scopeVersionTag] = version
+			}
+			ms := sm.Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				result = appendMetric(result, ms.At(k), scopeTags, now)
+			}
+		}
+	}
+	return result
+}
+
+func appendMetric(result []telegraf.Metric, m pmetric.Metric, scopeTags map[string]string, now time.Time) []telegraf.Metric {
+	name := sanitize(m.Name())
+	if len(name) == 0 {
+		return result
+	}
+	switch m.DataType() {
+	case pmetric.MetricDataTypeGauge:
+		result = appendNumberDataPoints(result, name, m.Gauge().DataPoints(), scopeTags, telegraf.Gauge, now)
+	case pmetric.MetricDataTypeSum:
+		valueType := telegraf.Gauge
+		if m.Sum().IsMonotonic() {
+			valueType = telegraf.Counter
+		}
+		result = appendNumberDataPoints(result, name, m.Sum().DataPoints(), scopeTags, valueType, now)
+	case pmetric.MetricDataTypeHistogram:
+		dps := m.Histogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			if dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue) {
+				continue
+			}
+			tags := pointTags(scopeTags, dp.Attributes())
+			ts := timestamp(dp.Timestamp(), now)
+			fields := map[string]interface{}{"count": toInt64(dp.Count())}
+			if dp.HasSum() {
+				fields["sum"] = dp.Sum()
+			}
+			if dp.HasMin() {
+				fields["min"] = dp.Min()
+			}
+			if dp.HasMax() {
+				fields["max"] = dp.Max()
+			}
+			result = append(result, metric.New(name, tags, fields, ts, telegraf.Histogram))
+			bounds := dp.ExplicitBounds()
+			counts := dp.BucketCounts()
+			var cumulative uint64
+			for b := 0; b < counts.Len(); b++ {
+				cumulative += counts.At(b)
+				le := "+Inf"
+				if b < bounds.Len() {
+					le = formatFloat(bounds.At(b))
+				}
+				bucketTags := copyTags(tags)
+				bucketTags["le"] = le
+				result = append(result, metric.New(name+"_bucket", bucketTags, map[string]interface{}{"value": toInt64(cumulative)}, ts, telegraf.Histogram))
+			}
+		}
+	case pmetric.MetricDataTypeExponentialHistogram:
+		dps := m.ExponentialHistogram().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			if dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue) {
+				continue
+			}
+			tags := pointTags(scopeTags, dp.Attributes())
+			ts := timestamp(dp.Timestamp(), now)
+			fields := map[string]interface{}{
+				"count":      toInt64(dp.Count()),
+				"scale":      int64(dp.Scale()),
+				"zero_count": toInt64(dp.ZeroCount()),
+			}
+			if dp.HasSum() {
+				fields["sum"] = dp.Sum()
+			}
+			if dp.HasMin() {
+				fields["min"] = dp.Min()
+			}
+			if dp.HasMax() {
+				fields["max"] = dp.Max()
+			}
+			result = append(result, metric.New(name, tags, fields, ts, telegraf.Histogram))
+			result = appendExponentialBuckets(result, name+"_bucket", "negative", dp.Negative(), dp.Scale(), tags, ts)
+			result = appendExponentialBuckets(result, name+"_bucket", "positive", dp.Positive(), dp.Scale(), tags, ts)
+		}
+	case pmetric.MetricDataTypeSummary:
+		dps := m.Summary().DataPoints()
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			if dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue) {
+				continue
+			}
+			tags := pointTags(scopeTags, dp.Attributes())
+			ts := timestamp(dp.Timestamp(), now)
+			result = append(result, metric.New(name, tags, map[string]interface{}{
+				"count": toInt64(dp.Count()),
+				"sum":   dp.Sum(),
+			}, ts, telegraf.Summary))
+			qs := dp.QuantileValues()
+			for q := 0; q < qs.Len(); q++ {
+				quantileTags := copyTags(tags)
+				quantileTags["quantile"] = formatFloat(qs.At(q).Quantile())
+				result = append(result, metric.New(name+"_quantile", quantileTags, map[string]interface{}{"value": qs.At(q).Value()}, ts, telegraf.Summary))
+			}
+		}
+	}
+	return result
+}
+
+func appendNumberDataPoints(result []telegraf.Metric, name string, dps pmetric.NumberDataPointSlice, scopeTags map[string]string, valueType telegraf.ValueType, now time.Time) []telegraf.Metric {
+	for i := 0; i < dps.Len(); i++ {
+		dp := dps.At(i)
+		if dp.Flags().HasFlag(pmetric.MetricDataPointFlagNoRecordedValue) {
+			continue
+		}
+		var value float64
+		switch dp.ValueType() {
+		case pmetric.NumberDataPointValueTypeDouble:
+			value = dp.DoubleVal()
+		case pmetric.NumberDataPointValueTypeInt:
+			value = float64(dp.IntVal())
+		default:
+			continue
+		}
+		result = append(result, metric.New(name, pointTags(scopeTags, dp.Attributes()), map[string]interface{}{"value": value}, timestamp(dp.Timestamp(), now), valueType))
+	}
+	return result
+}
+
+// appendExponentialBuckets appends the buckets of one side of the exponential histogram, the bucket with index i
+// covers (base^i, base^(i+1)] on the positive side and [-base^(i+1), -base^i) on the negative side,
+// where base = 2^(2^-scale).
+func appendExponentialBuckets(result []telegraf.Metric, name, sign string, buckets pmetric.Buckets, scale int32, tags map[string]string, ts time.Time) []telegraf.Metric {
+	counts := buckets.BucketCounts()
+	factor := math.Exp2(-float64(scale))
+	for i := 0; i < counts.Len(); i++ {
+		index := int64(buckets.Offset()) + int64(i)
+		lower := math.Exp2(float64(index) * factor)
+		upper := math.Exp2(float64(index+1) * factor)
+		if sign == "negative" {
+			lower, upper = -upper, -lower
+		}
+		bucketTags := copyTags(tags)
+		bucketTags["sign"] = sign
+		bucketTags["index"] = strconv.FormatInt(index, 10)
+		result = append(result, metric.New(name, bucketTags, map[string]interface{}{
+			"count": toInt64(counts.At(i)),
+			"lower": lower,
+			"upper": upper,
+		}, ts, telegraf.Histogram))
+	}
+	return result
+}
+
+func pointTags(scopeTags map[string]string, attributes pcommon.Map) map[string]string {
+	tags := copyTags(scopeTags)
+	addAttributes(tags, attributes)
+	return tags
+}
+
+func addAttributes(tags map[string]string, attributes pcommon.Map) {
+	attributes.Range(func(k string, v pcommon.Value) bool {
+		key := sanitize(k)
+		value := v.AsString()
+		if len(key) > 0 && len(value) > 0 {
+			tags[key] = value
+		}
+		return true
+	})
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
+
+func timestamp(ts pcommon.Timestamp, now time.Time) time.Time {
+	if ts == 0 {
+		return now
+	}
+	return ts.AsTime()
+}
+
+func toInt64(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(v, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sanitize replaces the characters not allowed in table and column names, such as the dots of the OpenTelemetry
+// semantic conventions, with underscores.
+func sanitize(name string) string {
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+			b.WriteByte(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func newMetrics() (pmetric.Metrics, pmetric.MetricSlice) {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().InsertString("service.name", "checkout")
+	rm.Resource().Attributes().InsertInt("pid", 100)
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName("io.opentelemetry.runtime")
+	sm.Scope().SetVersion("1.0.0")
+	return md, sm.Metrics()
+}
+
+func TestConvertNumber(t *testing.T) {
+	md, ms := newMetrics()
+	ts := time.Unix(1700000000, 0)
+	now := time.Unix(1800000000, 0)
+
+	gauge := ms.AppendEmpty()
+	gauge.SetName("process.cpu.utilization")
+	gauge.SetDataType(pmetric.MetricDataTypeGauge)
+	dp := gauge.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	dp.SetDoubleVal(0.5)
+	dp.Attributes().InsertString("state", "user")
+	dp = gauge.Gauge().DataPoints().AppendEmpty()
+	dp.SetDoubleVal(1)
+	dp.SetFlags(pmetric.NewMetricDataPointFlags(pmetric.MetricDataPointFlagNoRecordedValue))
+
+	sum := ms.AppendEmpty()
+	sum.SetName("http.server.requests")
+	sum.SetDataType(pmetric.MetricDataTypeSum)
+	sum.Sum().SetIsMonotonic(true)
+	dp = sum.Sum().DataPoints().AppendEmpty()
+	dp.SetIntVal(42)
+
+	metrics := convertMetrics(md, now)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "process_cpu_utilization", metrics[0].Name())
+	assert.Equal(t, map[string]string{
+		"service_name":       "checkout",
+		"pid":                "100",
+		"otel_scope_name":    "io.opentelemetry.runtime",
+		"otel_scope_version": "1.0.0",
+		"state":              "user",
+	}, metrics[0].Tags())
+	assert.Equal(t, map[string]interface{}{"value": 0.5}, metrics[0].Fields())
+	assert.Equal(t, ts.UnixNano(), metrics[0].Time().UnixNano())
+	assert.Equal(t, telegraf.Gauge, metrics[0].Type())
+
+	assert.Equal(t, "http_server_requests", metrics[1].Name())
+	assert.Equal(t, map[string]interface{}{"value": float64(42)}, metrics[1].Fields())
+	assert.Equal(t, now, metrics[1].Time())
+	assert.Equal(t, telegraf.Counter, metrics[1].Type())
+	_, exist := metrics[1].Tags()["state"]
+	assert.False(t, exist)
+}
+
+func TestConvertHistogram(t *testing.T) {
+	md, ms := newMetrics()
+	m := ms.AppendEmpty()
+	m.SetName("http.server.duration")
+	m.SetDataType(pmetric.MetricDataTypeHistogram)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.SetCount(6)
+	dp.SetSum(12.5)
+	dp.SetMin(0.1)
+	dp.SetExplicitBounds(pcommon.NewImmutableFloat64Slice([]float64{1, 5}))
+	dp.SetBucketCounts(pcommon.NewImmutableUInt64Slice([]uint64{1, 2, 3}))
+
+	metrics := convertMetrics(md, time.Now())
+	require.Len(t, metrics, 4)
+	assert.Equal(t, "http_server_duration", metrics[0].Name())
+	assert.Equal(t, map[string]interface{}{"count": int64(6), "sum": 12.5, "min": 0.1}, metrics[0].Fields())
+	var les []string
+	var values []interface{}
+	for _, metric := range metrics[1:] {
+		assert.Equal(t, "http_server_duration_bucket", metric.Name())
+		assert.Equal(t, "checkout", metric.Tags()["service_name"])
+		les = append(les, metric.Tags()["le"])
+		values = append(values, metric.Fields()["value"])
+	}
+	assert.Equal(t, []string{"1", "5", "+Inf"}, les)
+	assert.Equal(t, []interface{}{int64(1), int64(3), int64(6)}, values)
+}
+
+func TestConvertExponentialHistogram(t *testing.T) {
+	md, ms := newMetrics()
+	m := ms.AppendEmpty()
+	m.SetName("latency")
+	m.SetDataType(pmetric.MetricDataTypeExponentialHistogram)
+	dp := m.ExponentialHistogram().DataPoints().AppendEmpty()
+	dp.SetCount(4)
+	dp.SetSum(3)
+	dp.SetScale(1)
+	dp.SetZeroCount(1)
+	dp.Positive().SetOffset(1)
+	dp.Positive().SetBucketCounts(pcommon.NewImmutableUInt64Slice([]uint64{2}))
+	dp.Negative().SetOffset(0)
+	dp.Negative().SetBucketCounts(pcommon.NewImmutableUInt64Slice([]uint64{1}))
+
+	metrics := convertMetrics(md, time.Now())
+	require.Len(t, metrics, 3)
+	assert.Equal(t, map[string]interface{}{
+		"count":      int64(4),
+		"sum":        float64(3),
+		"scale":      int64(1),
+		"zero_count": int64(1),
+	}, metrics[0].Fields())
+
+	assert.Equal(t, "latency_bucket", metrics[1].Name())
+	assert.Equal(t, "negative", metrics[1].Tags()["sign"])
+	assert.Equal(t, "0", metrics[1].Tags()["index"])
+	assert.Equal(t, int64(1), metrics[1].Fields()["count"])
+	assert.InDelta(t, -1.4142, metrics[1].Fields()["lower"], 0.0001)
+	assert.InDelta(t, -1, metrics[1].Fields()["upper"], 0.0001)
+
+	assert.Equal(t, "positive", metrics[2].Tags()["sign"])
+	assert.Equal(t, "1", metrics[2].Tags()["index"])
+	assert.Equal(t, int64(2), metrics[2].Fields()["count"])
+	assert.InDelta(t, 1.4142, metrics[2].Fields()["lower"], 0.0001)
+	assert.InDelta(t, 2, metrics[2].Fields()["upper"], 0.0001)
+}
+
+func TestConvertSummary(t *testing.T) {
+	md, ms := newMetrics()
+	m := ms.AppendEmpty()
+	m.SetName("rpc.duration")
+	m.SetDataType(pmetric.MetricDataTypeSummary)
+	dp := m.Summary().DataPoints().AppendEmpty()
+	dp.SetCount(10)
+	dp.SetSum(20)
+	q := dp.QuantileValues().AppendEmpty()
+	q.SetQuantile(0.99)
+	q.SetValue(5)
+
+	metrics := convertMetrics(md, time.Now())
+	require.Len(t, metrics, 2)
+	assert.Equal(t, map[string]interface{}{"count": int64(10), "sum": float64(20)}, metrics[0].Fields())
+	assert.Equal(t, "rpc_duration_quantile", metrics[1].Name())
+	assert.Equal(t, "0.99", metrics[1].Tags()["quantile"])
+	assert.Equal(t, map[string]interface{}{"value": float64(5)}, metrics[1].Fields())
+}
+
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "http_server_duration", sanitize("http.server.duration"))
+	assert.Equal(t, "_9xx", sanitize("9xx"))
+	assert.Equal(t, "a_b_c", sanitize("a-b/c"))
+	assert.Equal(t, "", sanitize(""))
+}
@@ -0,0 +1,402 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/monitor"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "otlp")
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+type Plugin struct {
+	conf       Config
+	grpcServer *grpc.Server
+	grpcDone   chan struct{}
+}
+
+func (p *Plugin) Init(r gin.IRouter) error {
+	p.conf.setValue()
+	if !p.conf.Enable {
+		logger.Info("otlp disabled")
+		return nil
+	}
+	if err := p.conf.check(); err != nil {
+		return err
+	}
+	r.Use(func(c *gin.Context) {
+		if monitor.AllPaused() {
+			c.Header("Retry-After", "120")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, "memory exceeds threshold")
+			return
+		}
+	})
+	r.Use(plugin.Auth(func(c *gin.Context, code int, err error) {
+		c.String(code, err.Error())
+	}))
+	r.POST("metrics", p.metrics)
+	r.POST("logs", p.logs)
+	r.POST("traces", p.traces)
+	return nil
+}
+
+func (p *Plugin) Start() error {
+	if !p.conf.Enable || p.conf.GRPCPort == 0 {
+		return nil
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", p.conf.GRPCPort))
+	if err != nil {
+		return err
+	}
+	p.grpcServer = grpc.NewServer()
+	pmetricotlp.RegisterServer(p.grpcServer, &metricsServer{p: p})
+	plogotlp.RegisterServer(p.grpcServer, &logsServer{p: p})
+	ptraceotlp.RegisterServer(p.grpcServer, &tracesServer{p: p})
+	p.grpcDone = make(chan struct{})
+	go func() {
+		defer close(p.grpcDone)
+		if err := p.grpcServer.Serve(ln); err != nil {
+			logger.WithError(err).Error("otlp grpc server error")
+		}
+	}()
+	logger.Infof("otlp grpc server listening on %s", ln.Addr())
+	return nil
+}
+
+func (p *Plugin) Stop() error {
+	if p.grpcServer == nil {
+		return nil
+	}
+	p.grpcServer.GracefulStop()
+	<-p.grpcDone
+	p.grpcServer = nil
+	return nil
+}
+
+func (p *Plugin) String() string {
+	return "otlp"
+}
+
+func (p *Plugin) Version() string {
+	return "v1"
+}
+
+// @Tags otlp
+// @Summary otlp metrics
+// @Description receive OpenTelemetry ExportMetricsServiceRequest in protobuf or json
+// @Accept application/x-protobuf,json
+// @Produce application/x-protobuf,json
+// @Param Authorization header string true "basic authorization"
+// @Param db query string false "the database to write data to, default is otlp.db"
+// @Success 200 {string} string "ExportMetricsServiceResponse"
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 500 {string} string "internal error"
+// @Router /otlp/v1/metrics [post]
+func (p *Plugin) metrics(c *gin.Context) {
+	req := pmetricotlp.NewRequest()
+	p.export(c, req, pmetricotlp.NewResponse(), func(user, password string, clientIP net.IP, db string) (int, error) {
+		return p.writeMetrics(user, password, clientIP, db, req.Metrics())
+	})
+}
+
+// @Tags otlp
+// @Summary otlp logs
+// @Description receive OpenTelemetry ExportLogsServiceRequest in protobuf or json
+// @Accept application/x-protobuf,json
+// @Produce application/x-protobuf,json
+// @Param Authorization header string true "basic authorization"
+// @Param db query string false "the database to write data to, default is otlp.db"
+// @Success 200 {string} string "ExportLogsServiceResponse"
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 500 {string} string "internal error"
+// @Router /otlp/v1/logs [post]
+func (p *Plugin) logs(c *gin.Context) {
+	req := plogotlp.NewRequest()
+	p.export(c, req, plogotlp.NewResponse(), func(user, password string, clientIP net.IP, db string) (int, error) {
+		return p.writeLogs(user, password, clientIP, db, req.Logs())
+	})
+}
+
+// @Tags otlp
+// @Summary otlp traces
+// @Description receive OpenTelemetry ExportTraceServiceRequest in protobuf or json
+// @Accept application/x-protobuf,json
+// @Produce application/x-protobuf,json
+// @Param Authorization header string true "basic authorization"
+// @Param db query string false "the database to write data to, default is otlp.db"
+// @Success 200 {string} string "ExportTraceServiceResponse"
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 500 {string} string "internal error"
+// @Router /otlp/v1/traces [post]
+func (p *Plugin) traces(c *gin.Context) {
+	req := ptraceotlp.NewRequest()
+	p.export(c, req, ptraceotlp.NewResponse(), func(user, password string, clientIP net.IP, db string) (int, error) {
+		return p.writeTraces(user, password, clientIP, db, req.Traces())
+	})
+}
+
+type exportRequest interface {
+	UnmarshalProto(data []byte) error
+	UnmarshalJSON(data []byte) error
+}
+
+type exportResponse interface {
+	MarshalProto() ([]byte, error)
+	MarshalJSON() ([]byte, error)
+}
+
+// export decodes the request body into req, calls write and responds resp in the encoding of the request.
+func (p *Plugin) export(c *gin.Context, req exportRequest, resp exportResponse, write func(user, password string, clientIP net.IP, db string) (int, error)) {
+	user, password, err := plugin.GetAuth(c)
+	if err != nil {
+		c.String(http.StatusUnauthorized, err.Error())
+		return
+	}
+	contentType := c.ContentType()
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		c.String(http.StatusUnsupportedMediaType, "unsupported content type %s", contentType)
+		return
+	}
+	db := c.Query("db")
+	if len(db) == 0 {
+		db = p.conf.DB
+	}
+	var body io.Reader = c.Request.Body
+	// the gzip middleware removes the header after decompressing
+	if c.GetHeader("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		defer func() {
+			_ = gr.Close()
+		}()
+		body = gr
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if contentType == contentTypeJSON {
+		err = req.UnmarshalJSON(data)
+	} else {
+		err = req.UnmarshalProto(data)
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	code, err := write(user, password, iptool.GetRealIP(c.Request), db)
+	if err != nil {
+		c.String(code, err.Error())
+		return
+	}
+	if contentType == contentTypeJSON {
+		data, err = resp.MarshalJSON()
+	} else {
+		data, err = resp.MarshalProto()
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func (p *Plugin) writeMetrics(user, password string, clientIP net.IP, db string, md pmetric.Metrics) (int, error) {
+	metrics := convertMetrics(md, time.Now())
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+	data, err := influx.NewSerializer().SerializeBatch(metrics)
+	if err != nil {
+		logger.WithError(err).Error("serialize otlp metrics error")
+		return http.StatusBadRequest, err
+	}
+	return p.execute(user, password, clientIP, func(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64) error {
+		logger.Debugf("insert line,req_id:0x%x,data: %s", reqID, string(data))
+		return inserter.InsertInfluxdb(taosConn, data, db, "ns", p.conf.TTL, uint64(reqID), "", logger)
+	})
+}
+
+func (p *Plugin) writeLogs(user, password string, clientIP net.IP, db string, ld plog.Logs) (int, error) {
+	if ld.LogRecordCount() == 0 {
+		return 0, nil
+	}
+	b := convertLogs(ld, p.conf.LogsTable, time.Now())
+	return p.execute(user, password, clientIP, func(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64) error {
+		return b.write(taosConn, logger, isDebug, reqID, db, p.conf.TTL)
+	})
+}
+
+func (p *Plugin) writeTraces(user, password string, clientIP net.IP, db string, td ptrace.Traces) (int, error) {
+	if td.SpanCount() == 0 {
+		return 0, nil
+	}
+	b := convertTraces(td, p.conf.TracesTable, time.Now())
+	return p.execute(user, password, clientIP, func(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64) error {
+		return b.write(taosConn, logger, isDebug, reqID, db, p.conf.TTL)
+	})
+}
+
+// execute calls fn with the connection of the user, it returns the http status code on error.
+func (p *Plugin) execute(user, password string, clientIP net.IP, fn func(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64) error) (int, error) {
+	taosConn, err := commonpool.GetConnection(user, password, clientIP)
+	if err != nil {
+		logger.WithError(err).Error("connect server error")
+		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+			return http.StatusForbidden, err
+		}
+		if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
+			return http.StatusServiceUnavailable, err
+		}
+		return http.StatusUnauthorized, err
+	}
+	defer func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}()
+	isDebug := log.IsDebug()
+	start := log.GetLogNow(isDebug)
+	reqID := generator.GetReqID()
+	execLogger := logger.WithField(config.ReqIDKey, reqID)
+	err = fn(taosConn.TaosConnection, execLogger, isDebug, reqID)
+	execLogger.Debugf("otlp write finish cost:%s", log.GetLogDuration(isDebug, start))
+	if err != nil {
+		execLogger.WithError(err).Error("otlp write error")
+		if taosError, is := err.(*tErrors.TaosError); is && taosError.Code >= 0x3000 && taosError.Code <= 0x30ff {
+			return http.StatusBadRequest, err
+		}
+		if errors.Is(err, errPrecision) {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// grpcExport calls write with the user and password of the basic authorization metadata, which is required, and the
+// database of the db metadata or otlp.db.
+func (p *Plugin) grpcExport(ctx context.Context, write func(user, password string, clientIP net.IP, db string) (int, error)) error {
+	if monitor.AllPaused() {
+		return status.Error(codes.Unavailable, "memory exceeds threshold")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) == 0 {
+		return status.Error(codes.Unauthenticated, "authorization required")
+	}
+	authorization := strings.TrimSpace(auth[0])
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return status.Error(codes.Unauthenticated, "only basic authorization is supported")
+	}
+	user, password, err := tools.DecodeBasic(authorization[6:])
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	db := p.conf.DB
+	if dbs := md.Get("db"); len(dbs) > 0 && len(dbs[0]) > 0 {
+		db = dbs[0]
+	}
+	clientIP := net.IPv4(127, 0, 0, 1)
+	if pr, exist := peer.FromContext(ctx); exist {
+		if addr, is := pr.Addr.(*net.TCPAddr); is {
+			clientIP = addr.IP
+		}
+	}
+	code, err := write(user, password, clientIP, db)
+	if err != nil {
+		grpcCode, exist := grpcCodes[code]
+		if !exist {
+			grpcCode = codes.Internal
+		}
+		return status.Error(grpcCode, err.Error())
+	}
+	return nil
+}
+
+type metricsServer struct {
+	p *Plugin
+}
+
+func (s *metricsServer) Export(ctx context.Context, req pmetricotlp.Request) (pmetricotlp.Response, error) {
+	return pmetricotlp.NewResponse(), s.p.grpcExport(ctx, func(user, password string, clientIP net.IP, db string) (int, error) {
+		return s.p.writeMetrics(user, password, clientIP, db, req.Metrics())
+	})
+}
+
+type logsServer struct {
+	p *Plugin
+}
+
+func (s *logsServer) Export(ctx context.Context, req plogotlp.Request) (plogotlp.Response, error) {
+	return plogotlp.NewResponse(), s.p.grpcExport(ctx, func(user, password string, clientIP net.IP, db string) (int, error) {
+		return s.p.writeLogs(user, password, clientIP, db, req.Logs())
+	})
+}
+
+type tracesServer struct {
+	p *Plugin
+}
+
+func (s *tracesServer) Export(ctx context.Context, req ptraceotlp.Request) (ptraceotlp.Response, error) {
+	return ptraceotlp.NewResponse(), s.p.grpcExport(ctx, func(user, password string, clientIP net.IP, db string) (int, error) {
+		return s.p.writeTraces(user, password, clientIP, db, req.Traces())
+	})
+}
+
+func init() {
+	plugin.Register(&Plugin{})
+}
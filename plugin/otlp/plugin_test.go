@@ -0,0 +1,245 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	"github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBadRequest(t *testing.T) {
+	viper.Set("otlp.enable", true)
+	defer viper.Set("otlp.enable", false)
+	p := &Plugin{}
+	router := gin.New()
+	require.NoError(t, p.Init(router))
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        []byte
+		code        int
+	}{
+		{name: "content type", contentType: "text/plain", body: []byte("a"), code: http.StatusUnsupportedMediaType},
+		{name: "protobuf", contentType: contentTypeProtobuf, body: []byte{0xff, 0xff}, code: http.StatusBadRequest},
+		{name: "json", contentType: contentTypeJSON, body: []byte("{"), code: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/metrics", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.SetBasicAuth("root", "taosdata")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+}
+
+func TestGRPCUnauthenticated(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+	p := &Plugin{conf: Config{Enable: true, DB: "otlp", GRPCPort: port}}
+	require.NoError(t, p.Start())
+	defer func() {
+		assert.NoError(t, p.Stop())
+	}()
+	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%d", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// no authorization
+	_, err = pmetricotlp.NewClient(conn).Export(metadata.AppendToOutgoingContext(ctx, "db", "test"), pmetricotlp.NewRequest())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = pmetricotlp.NewClient(conn).Export(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token"), pmetricotlp.NewRequest())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestPlugin(t *testing.T) {
+	//nolint:staticcheck
+	rand.Seed(time.Now().UnixNano())
+	config.Init()
+	log.ConfigLog()
+	db.PrepareConnection()
+	viper.Set("otlp.enable", true)
+	conn, err := wrapper.TaosConnect("", "root", "taosdata", "", 0)
+	require.NoError(t, err)
+	defer wrapper.TaosClose(conn)
+	err = exec(conn, "create database if not exists test_plugin_otlp precision 'ns'")
+	require.NoError(t, err)
+	defer func() {
+		err = exec(conn, "drop database if exists test_plugin_otlp")
+		assert.NoError(t, err)
+	}()
+	err = exec(conn, "create database if not exists test_plugin_otlp_ms precision 'ms'")
+	require.NoError(t, err)
+	defer func() {
+		err = exec(conn, "drop database if exists test_plugin_otlp_ms")
+		assert.NoError(t, err)
+	}()
+	p := &Plugin{}
+	router := gin.New()
+	require.NoError(t, p.Init(router))
+	require.NoError(t, p.Start())
+	defer func() {
+		assert.NoError(t, p.Stop())
+	}()
+
+	number := rand.Float64()
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().InsertString("service.name", "checkout")
+	m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("process.cpu.utilization")
+	m.SetDataType(pmetric.MetricDataTypeGauge)
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	dp.SetDoubleVal(number)
+	data, err := pmetricotlp.NewRequestFromMetrics(md).MarshalProto()
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/metrics?db=test_plugin_otlp", bytes.NewReader(data))
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, contentTypeProtobuf, w.Header().Get("Content-Type"))
+
+	values, err := query(conn, "select last(`value`), last(`service_name`) from test_plugin_otlp.`process_cpu_utilization`")
+	require.NoError(t, err)
+	assert.Equal(t, number, values[0][0])
+	assert.Equal(t, "checkout", values[0][1])
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().InsertString("service.name", "checkout")
+	record := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	record.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	record.SetSeverityText("ERROR")
+	record.Body().SetStringVal("payment failed")
+	data, err = plogotlp.NewRequestFromLogs(ld).MarshalJSON()
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/logs?db=test_plugin_otlp", bytes.NewReader(data))
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	values, err = query(conn, "select `severity_text`, `body`, `service_name` from test_plugin_otlp.`otel_logs`")
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.Equal(t, []driver.Value{"ERROR", "payment failed", "checkout"}, values[0])
+
+	// logs are not written into a database without nanosecond precision
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/logs?db=test_plugin_otlp_ms", bytes.NewReader(data))
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	values, err = query(conn, "select * from test_plugin_otlp_ms.`otel_logs`")
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InsertString("service.name", "checkout")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(pcommon.NewTraceID([16]byte{1}))
+	span.SetSpanID(pcommon.NewSpanID([8]byte{2}))
+	span.SetName("GET /cart")
+	start := time.Now()
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(time.Millisecond)))
+	data, err = ptraceotlp.NewRequestFromTraces(td).MarshalProto()
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/traces?db=test_plugin_otlp", bytes.NewReader(data))
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	values, err = query(conn, "select `name`, `duration`, `span_id` from test_plugin_otlp.`otel_traces`")
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.Equal(t, []driver.Value{"GET /cart", int64(time.Millisecond), "0200000000000000"}, values[0])
+}
+
+func exec(conn unsafe.Pointer, sql string) error {
+	res := wrapper.TaosQuery(conn, sql)
+	defer wrapper.TaosFreeResult(res)
+	code := wrapper.TaosError(res)
+	if code != 0 {
+		errStr := wrapper.TaosErrorStr(res)
+		return errors.NewError(code, errStr)
+	}
+	return nil
+}
+
+func query(conn unsafe.Pointer, sql string) ([][]driver.Value, error) {
+	res := wrapper.TaosQuery(conn, sql)
+	defer wrapper.TaosFreeResult(res)
+	code := wrapper.TaosError(res)
+	if code != 0 {
+		errStr := wrapper.TaosErrorStr(res)
+		return nil, errors.NewError(code, errStr)
+	}
+	fileCount := wrapper.TaosNumFields(res)
+	rh, err := wrapper.ReadColumn(res, fileCount)
+	if err != nil {
+		return nil, err
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	var result [][]driver.Value
+	for {
+		columns, errCode, block := wrapper.TaosFetchRawBlock(res)
+		if errCode != 0 {
+			errStr := wrapper.TaosErrorStr(res)
+			return nil, errors.NewError(errCode, errStr)
+		}
+		if columns == 0 {
+			break
+		}
+		r := parser.ReadBlock(block, columns, rh.ColTypes, precision)
+		result = append(result, r...)
+	}
+	return result, nil
+}
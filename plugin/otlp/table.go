@@ -0,0 +1,199 @@
+package otlp
+
+import (
+	"crypto/md5"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+var jsonI = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// errPrecision is returned when logs or traces are written into a database without nanosecond precision, the rows of a
+// resource that share the timestamp in a coarser precision would overwrite each other.
+var errPrecision = errors.New("logs and traces require a database with precision 'ns'")
+
+const (
+	serviceNameKey    = "service.name"
+	serviceNameLength = 256
+	resourceLength    = 4096
+)
+
+type column struct {
+	name string
+	typ  string
+	// length is the length of varchar columns, longer strings are truncated
+	length int
+}
+
+func (c column) definition() string {
+	if c.length > 0 {
+		return fmt.Sprintf("`%s` %s(%d)", c.name, c.typ, c.length)
+	}
+	return fmt.Sprintf("`%s` %s", c.name, c.typ)
+}
+
+// tableBuilder groups the rows of a supertable by child table, each resource is a child table with the tags
+// service_name and resource_attributes, the name is the md5 of the supertable and the tags.
+type tableBuilder struct {
+	stable  string
+	columns []column
+	tables  map[string]*stmt.TaosStmt2BindData
+	result  []*stmt.TaosStmt2BindData
+}
+
+func newTableBuilder(stable string, columns []column) *tableBuilder {
+	return &tableBuilder{
+		stable:  stable,
+		columns: columns,
+		tables:  map[string]*stmt.TaosStmt2BindData{},
+	}
+}
+
+func (b *tableBuilder) table(resource pcommon.Resource) *stmt.TaosStmt2BindData {
+	var service string
+	if v, exist := resource.Attributes().Get(serviceNameKey); exist {
+		service = v.AsString()
+	}
+	attributes := marshalAttributes(resource.Attributes())
+	name := fmt.Sprintf("t_%x", md5.Sum([]byte(b.stable+"\x00"+service+"\x00"+attributes)))
+	table, exist := b.tables[name]
+	if !exist {
+		table = &stmt.TaosStmt2BindData{
+			TableName: name,
+			Tags:      []driver.Value{nullString(service, serviceNameLength), nullString(attributes, resourceLength)},
+			Cols:      make([][]driver.Value, len(b.columns)),
+		}
+		b.tables[name] = table
+		b.result = append(b.result, table)
+	}
+	return table
+}
+
+// appendRow appends the values in the order of the columns, empty strings are stored as null.
+func (b *tableBuilder) appendRow(table *stmt.TaosStmt2BindData, values ...driver.Value) {
+	for i, v := range values {
+		if s, is := v.(string); is {
+			v = nullString(s, b.columns[i].length)
+		}
+		table.Cols[i] = append(table.Cols[i], v)
+	}
+}
+
+func (b *tableBuilder) createStableSql() string {
+	var sql strings.Builder
+	sql.WriteString("create stable if not exists `")
+	sql.WriteString(b.stable)
+	sql.WriteString("` (")
+	for i, c := range b.columns {
+		if i > 0 {
+			sql.WriteByte(',')
+		}
+		sql.WriteString(c.definition())
+	}
+	sql.WriteString(fmt.Sprintf(") tags (`service_name` varchar(%d),`resource_attributes` varchar(%d))", serviceNameLength, resourceLength))
+	return sql.String()
+}
+
+func (b *tableBuilder) insertSql(ttl int) string {
+	var sql strings.Builder
+	sql.WriteString("insert into ? using `")
+	sql.WriteString(b.stable)
+	sql.WriteString("` tags(?,?)")
+	if ttl > 0 {
+		sql.WriteString(" ttl ")
+		sql.WriteString(strconv.Itoa(ttl))
+	}
+	sql.WriteString(" values(")
+	for i := range b.columns {
+		if i > 0 {
+			sql.WriteByte(',')
+		}
+		sql.WriteByte('?')
+	}
+	sql.WriteByte(')')
+	return sql.String()
+}
+
+// write inserts the rows through stmt2, the supertable is created when it does not exist. The database is created with
+// nanosecond precision when it does not exist, a database with another precision is refused.
+func (b *tableBuilder) write(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, db string, ttl int) error {
+	if len(b.result) == 0 {
+		return nil
+	}
+	err := tool.SchemalessSelectDB(taosConn, logger, isDebug, db, reqID)
+	if err != nil {
+		return err
+	}
+	sql := b.insertSql(ttl)
+	generate := func(precision int) ([]*stmt.TaosStmt2BindData, error) {
+		if precision != common.PrecisionNanoSecond {
+			return nil, errPrecision
+		}
+		return b.result, nil
+	}
+	err = tool.Stmt2Insert(taosConn, logger, isDebug, reqID, sql, generate)
+	if tErr, is := err.(*tErrors.TaosError); is && tool.IsTableNotExist(tErr.Code) {
+		logger.WithError(err).Infof("stable %s not exist, create it and retry", b.stable)
+		err = async.GlobalAsync.TaosExecWithoutResult(taosConn, logger, isDebug, b.createStableSql(), reqID)
+		if err != nil {
+			return err
+		}
+		return tool.Stmt2Insert(taosConn, logger, isDebug, reqID, sql, generate)
+	}
+	return err
+}
+
+// marshalAttributes returns the attributes in json with sorted keys, or an empty string without attributes.
+func marshalAttributes(attributes pcommon.Map) string {
+	if attributes.Len() == 0 {
+		return ""
+	}
+	return marshalJSON(attributes.AsRaw())
+}
+
+func marshalJSON(v interface{}) string {
+	b, err := jsonI.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// nullString returns nil for the empty string, and truncates the string to length bytes at a rune boundary.
+func nullString(s string, length int) driver.Value {
+	if len(s) == 0 {
+		return nil
+	}
+	if length > 0 && len(s) > length {
+		s = s[:length]
+		for len(s) > 0 {
+			r, size := utf8.DecodeLastRuneInString(s)
+			if r != utf8.RuneError || size != 1 {
+				break
+			}
+			s = s[:len(s)-1]
+		}
+	}
+	return s
+}
+
+func nullTimestamp(ts pcommon.Timestamp) driver.Value {
+	if ts == 0 {
+		return nil
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,128 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestConvertLogs(t *testing.T) {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().InsertString("service.name", "checkout")
+	rl.Resource().Attributes().InsertString("host.name", "web01")
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName("logger")
+	ts := time.Unix(1700000000, 123)
+	observed := time.Unix(1700000001, 0)
+	record := sl.LogRecords().AppendEmpty()
+	record.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	record.SetObservedTimestamp(pcommon.NewTimestampFromTime(observed))
+	record.SetSeverityNumber(plog.SeverityNumberERROR)
+	record.SetSeverityText("ERROR")
+	record.Body().SetStringVal("payment failed")
+	record.SetTraceID(pcommon.NewTraceID([16]byte{1}))
+	record.Attributes().InsertInt("code", 500)
+	record = sl.LogRecords().AppendEmpty()
+	record.SetObservedTimestamp(pcommon.NewTimestampFromTime(observed))
+
+	b := convertLogs(ld, "otel_logs", time.Now())
+	require.Len(t, b.result, 1)
+	table := b.result[0]
+	assert.Regexp(t, "^t_[0-9a-f]{32}$", table.TableName)
+	assert.Equal(t, "checkout", table.Tags[0])
+	assert.Equal(t, `{"host.name":"web01","service.name":"checkout"}`, table.Tags[1])
+	require.Len(t, table.Cols, len(logColumns))
+	assert.Equal(t, ts.UnixNano(), table.Cols[0][0].(time.Time).UnixNano())
+	assert.Equal(t, observed.UnixNano(), table.Cols[1][0].(time.Time).UnixNano())
+	// the record without timestamp uses the observed timestamp
+	assert.Equal(t, observed.UnixNano(), table.Cols[0][1].(time.Time).UnixNano())
+	assert.Equal(t, int32(plog.SeverityNumberERROR), table.Cols[2][0])
+	assert.Equal(t, "ERROR", table.Cols[3][0])
+	assert.Equal(t, "payment failed", table.Cols[4][0])
+	assert.Equal(t, "01000000000000000000000000000000", table.Cols[5][0])
+	assert.Nil(t, table.Cols[6][0])
+	assert.Equal(t, uint32(0), table.Cols[7][0])
+	assert.Equal(t, `{"code":500}`, table.Cols[8][0])
+	assert.Equal(t, "logger", table.Cols[9][0])
+	assert.Nil(t, table.Cols[10][0])
+	assert.Nil(t, table.Cols[4][1])
+	assert.Nil(t, table.Cols[8][1])
+
+	other := convertLogs(ld, "other_logs", time.Now())
+	assert.NotEqual(t, table.TableName, other.result[0].TableName)
+}
+
+func TestConvertTraces(t *testing.T) {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InsertString("service.name", "checkout")
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("tracer")
+	ss.Scope().SetVersion("1.0")
+	start := time.Unix(1700000000, 0)
+	span := ss.Spans().AppendEmpty()
+	span.SetTraceID(pcommon.NewTraceID([16]byte{0xab}))
+	span.SetSpanID(pcommon.NewSpanID([8]byte{0xcd}))
+	span.SetName("GET /cart")
+	span.SetKind(ptrace.SpanKindServer)
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(time.Millisecond * 15)))
+	span.Status().SetCode(ptrace.StatusCodeError)
+	span.Status().SetMessage("timeout")
+	span.Attributes().InsertString("http.method", "GET")
+	event := span.Events().AppendEmpty()
+	event.SetTimestamp(pcommon.NewTimestampFromTime(start))
+	event.SetName("retry")
+	link := span.Links().AppendEmpty()
+	link.SetTraceID(pcommon.NewTraceID([16]byte{0x01}))
+	link.SetSpanID(pcommon.NewSpanID([8]byte{0x02}))
+
+	b := convertTraces(td, "otel_traces", time.Now())
+	require.Len(t, b.result, 1)
+	table := b.result[0]
+	require.Len(t, table.Cols, len(traceColumns))
+	row := make([]interface{}, len(table.Cols))
+	for i := range table.Cols {
+		row[i] = table.Cols[i][0]
+	}
+	assert.Equal(t, start.UnixNano(), row[0].(time.Time).UnixNano())
+	assert.Equal(t, int64(15*time.Millisecond), row[2])
+	assert.Equal(t, "ab000000000000000000000000000000", row[3])
+	assert.Equal(t, "cd00000000000000", row[4])
+	assert.Nil(t, row[5])
+	assert.Nil(t, row[6])
+	assert.Equal(t, "GET /cart", row[7])
+	assert.Equal(t, "SPAN_KIND_SERVER", row[8])
+	assert.Equal(t, "STATUS_CODE_ERROR", row[9])
+	assert.Equal(t, "timeout", row[10])
+	assert.Equal(t, `{"http.method":"GET"}`, row[11])
+	assert.Equal(t, `[{"time":"`+start.UTC().Format(time.RFC3339Nano)+`","name":"retry"}]`, row[12])
+	assert.Equal(t, `[{"trace_id":"01000000000000000000000000000000","span_id":"0200000000000000"}]`, row[13])
+	assert.Equal(t, "tracer", row[14])
+	assert.Equal(t, "1.0", row[15])
+}
+
+func TestTableSql(t *testing.T) {
+	b := newTableBuilder("otel_logs", []column{
+		{name: "ts", typ: "timestamp"},
+		{name: "body", typ: "varchar", length: 16},
+	})
+	assert.Equal(t, "create stable if not exists `otel_logs` (`ts` timestamp,`body` varchar(16)) tags (`service_name` varchar(256),`resource_attributes` varchar(4096))", b.createStableSql())
+	assert.Equal(t, "insert into ? using `otel_logs` tags(?,?) values(?,?)", b.insertSql(0))
+	assert.Equal(t, "insert into ? using `otel_logs` tags(?,?) ttl 10 values(?,?)", b.insertSql(10))
+}
+
+func TestNullString(t *testing.T) {
+	assert.Nil(t, nullString("", 10))
+	assert.Equal(t, "abc", nullString("abc", 0))
+	assert.Equal(t, "ab", nullString("abc", 2))
+	// the rune of 3 bytes is not split
+	assert.Equal(t, "a", nullString("a中", 3))
+	assert.Equal(t, "a中", nullString("a中", 4))
+}
@@ -0,0 +1,114 @@
+package otlp
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var traceColumns = []column{
+	{name: "ts", typ: "timestamp"},
+	{name: "end_ts", typ: "timestamp"},
+	{name: "duration", typ: "bigint"},
+	{name: "trace_id", typ: "varchar", length: 32},
+	{name: "span_id", typ: "varchar", length: 16},
+	{name: "parent_span_id", typ: "varchar", length: 16},
+	{name: "trace_state", typ: "varchar", length: 256},
+	{name: "name", typ: "varchar", length: 1024},
+	{name: "kind", typ: "varchar", length: 32},
+	{name: "status_code", typ: "varchar", length: 32},
+	{name: "status_message", typ: "varchar", length: 1024},
+	{name: "attributes", typ: "varchar", length: 8192},
+	{name: "events", typ: "varchar", length: 8192},
+	{name: "links", typ: "varchar", length: 4096},
+	{name: "scope_name", typ: "varchar", length: 256},
+	{name: "scope_version", typ: "varchar", length: 64},
+}
+
+type spanEvent struct {
+	Time       time.Time              `json:"time"`
+	Name       string                 `json:"name"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type spanLink struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	TraceState string                 `json:"trace_state,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// convertTraces groups the spans into the child tables of the traces supertable, the timestamp is the start time
+// of the span and the duration is in nanoseconds, the events and links are stored in json.
+func convertTraces(td ptrace.Traces, stable string, now time.Time) *tableBuilder {
+	b := newTableBuilder(stable, traceColumns)
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		table := b.table(rs.Resource())
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			ss := sss.At(j)
+			spans := ss.Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				var duration interface{}
+				if span.StartTimestamp() != 0 && span.EndTimestamp() >= span.StartTimestamp() {
+					duration = int64(span.EndTimestamp() - span.StartTimestamp())
+				}
+				b.appendRow(table,
+					timestamp(span.StartTimestamp(), now),
+					nullTimestamp(span.EndTimestamp()),
+					duration,
+					span.TraceID().HexString(),
+					span.SpanID().HexString(),
+					span.ParentSpanID().HexString(),
+					string(span.TraceState()),
+					span.Name(),
+					span.Kind().String(),
+					span.Status().Code().String(),
+					span.Status().Message(),
+					marshalAttributes(span.Attributes()),
+					marshalEvents(span.Events()),
+					marshalLinks(span.Links()),
+					ss.Scope().Name(),
+					ss.Scope().Version(),
+				)
+			}
+		}
+	}
+	return b
+}
+
+func marshalEvents(events ptrace.SpanEventSlice) string {
+	if events.Len() == 0 {
+		return ""
+	}
+	result := make([]spanEvent, events.Len())
+	for i := 0; i < events.Len(); i++ {
+		event := events.At(i)
+		result[i] = spanEvent{
+			Time:       event.Timestamp().AsTime(),
+			Name:       event.Name(),
+			Attributes: event.Attributes().AsRaw(),
+		}
+	}
+	return marshalJSON(result)
+}
+
+func marshalLinks(links ptrace.SpanLinkSlice) string {
+	if links.Len() == 0 {
+		return ""
+	}
+	result := make([]spanLink, links.Len())
+	for i := 0; i < links.Len(); i++ {
+		link := links.At(i)
+		result[i] = spanLink{
+			TraceID:    link.TraceID().HexString(),
+			SpanID:     link.SpanID().HexString(),
+			TraceState: string(link.TraceState()),
+			Attributes: link.Attributes().AsRaw(),
+		}
+	}
+	return marshalJSON(result)
+}
@@ -0,0 +1,665 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/iptool"
+	"github.com/taosdata/taosadapter/v3/tools/web"
+)
+
+const (
+	// maxPointsPerSeries is the same limit as the prometheus query_range api
+	maxPointsPerSeries = 11000
+	// seriesFunc is the select hint of the series, labels and label values api, only labels are read
+	seriesFunc = "series"
+)
+
+const (
+	errorBadData   = "bad_data"
+	errorExecution = "execution"
+	errorTimeout   = "timeout"
+	errorCanceled  = "canceled"
+	errorInternal  = "internal"
+)
+
+// QueryExecutor reads the timeseries of the query api. The plugin executes the queries on TDengine, tests use a stub.
+type QueryExecutor interface {
+	// Select returns the timeseries matching the query with their samples in the time range.
+	Select(query *prompb.Query) ([]*prompb.TimeSeries, error)
+	// Series returns the timeseries matching the query without samples.
+	Series(query *prompb.Query) ([]*prompb.TimeSeries, error)
+}
+
+// taosExecutor executes the queries with the connection of the request, the database has been selected.
+type taosExecutor struct {
+	taosConn unsafe.Pointer
+	logger   *logrus.Entry
+	isDebug  bool
+	reqID    int64
+	conf     *Config
+	limiter  *readLimiter
+}
+
+func (e *taosExecutor) Select(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	return readTimeseries(e.taosConn, e.logger, e.isDebug, e.reqID, query, e.conf, e.limiter, false)
+}
+
+func (e *taosExecutor) Series(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	return readTimeseries(e.taosConn, e.logger, e.isDebug, e.reqID, query, e.conf, e.limiter, true)
+}
+
+// executorQueryable adapts a QueryExecutor to the storage of the promql engine.
+type executorQueryable struct {
+	executor QueryExecutor
+}
+
+func (q *executorQueryable) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &executorQuerier{executor: q.executor, mint: mint, maxt: maxt}, nil
+}
+
+type executorQuerier struct {
+	executor QueryExecutor
+	mint     int64
+	maxt     int64
+}
+
+func (q *executorQuerier) Select(_ bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	query := &prompb.Query{StartTimestampMs: q.mint, EndTimestampMs: q.maxt}
+	if hints != nil {
+		query.StartTimestampMs = hints.Start
+		query.EndTimestampMs = hints.End
+	}
+	for _, matcher := range matchers {
+		m, err := toLabelMatcher(matcher)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		query.Matchers = append(query.Matchers, m)
+	}
+	var timeseries []*prompb.TimeSeries
+	var err error
+	if hints != nil && hints.Func == seriesFunc {
+		timeseries, err = q.executor.Series(query)
+	} else {
+		timeseries, err = q.executor.Select(query)
+	}
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	return newListSeriesSet(timeseries)
+}
+
+func (q *executorQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	set := q.Select(false, &storage.SelectHints{Start: q.mint, End: q.maxt, Func: seriesFunc}, matchers...)
+	values := map[string]struct{}{}
+	for set.Next() {
+		if value := set.At().Labels().Get(name); len(value) > 0 {
+			values[value] = struct{}{}
+		}
+	}
+	return sortedKeys(values), nil, set.Err()
+}
+
+func (q *executorQuerier) LabelNames() ([]string, storage.Warnings, error) {
+	set := q.Select(false, &storage.SelectHints{Start: q.mint, End: q.maxt, Func: seriesFunc})
+	names := map[string]struct{}{}
+	for set.Next() {
+		for _, label := range set.At().Labels() {
+			names[label.Name] = struct{}{}
+		}
+	}
+	return sortedKeys(names), nil, set.Err()
+}
+
+func (q *executorQuerier) Close() error {
+	return nil
+}
+
+func toLabelMatcher(matcher *labels.Matcher) (*prompb.LabelMatcher, error) {
+	m := &prompb.LabelMatcher{Name: matcher.Name, Value: matcher.Value}
+	switch matcher.Type {
+	case labels.MatchEqual:
+		m.Type = prompb.LabelMatcher_EQ
+	case labels.MatchNotEqual:
+		m.Type = prompb.LabelMatcher_NEQ
+	case labels.MatchRegexp:
+		m.Type = prompb.LabelMatcher_RE
+	case labels.MatchNotRegexp:
+		m.Type = prompb.LabelMatcher_NRE
+	default:
+		return nil, errors.New("not support match type")
+	}
+	return m, nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// listSeriesSet is a sorted series set of the timeseries returned by the executor.
+type listSeriesSet struct {
+	series []storage.Series
+	index  int
+}
+
+func newListSeriesSet(timeseries []*prompb.TimeSeries) *listSeriesSet {
+	series := make([]storage.Series, len(timeseries))
+	for i, ts := range timeseries {
+		lset := make(labels.Labels, len(ts.Labels))
+		for j, label := range ts.Labels {
+			lset[j] = labels.Label{Name: label.Name, Value: label.Value}
+		}
+		sort.Sort(lset)
+		series[i] = &listSeries{labels: lset, samples: ts.Samples}
+	}
+	sort.Slice(series, func(a, b int) bool {
+		return labels.Compare(series[a].Labels(), series[b].Labels()) < 0
+	})
+	return &listSeriesSet{series: series, index: -1}
+}
+
+func (s *listSeriesSet) Next() bool {
+	s.index += 1
+	return s.index < len(s.series)
+}
+
+func (s *listSeriesSet) At() storage.Series {
+	return s.series[s.index]
+}
+
+func (s *listSeriesSet) Err() error {
+	return nil
+}
+
+func (s *listSeriesSet) Warnings() storage.Warnings {
+	return nil
+}
+
+type listSeries struct {
+	labels  labels.Labels
+	samples []prompb.Sample
+}
+
+func (s *listSeries) Labels() labels.Labels {
+	return s.labels
+}
+
+func (s *listSeries) Iterator() chunkenc.Iterator {
+	return storage.NewListSeriesIterator(samples(s.samples))
+}
+
+// samples implements storage.Samples on the samples of a timeseries, the samples are in time order.
+type samples []prompb.Sample
+
+func (s samples) Get(i int) tsdbutil.Sample {
+	return sample(s[i])
+}
+
+func (s samples) Len() int {
+	return len(s)
+}
+
+type sample prompb.Sample
+
+func (s sample) T() int64 {
+	return s.Timestamp
+}
+
+func (s sample) V() float64 {
+	return s.Value
+}
+
+type apiResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Warnings  []string    `json:"warnings,omitempty"`
+}
+
+type queryData struct {
+	ResultType parser.ValueType `json:"resultType"`
+	Result     parser.Value     `json:"result"`
+}
+
+// queryAPI is a subset of the prometheus http api evaluated by the promql engine.
+type queryAPI struct {
+	engine *promql.Engine
+	// executor returns the executor of the request and a function to release it, it writes the error response and
+	// returns false if the executor is not available.
+	executor func(c *gin.Context) (QueryExecutor, func(), bool)
+	now      func() time.Time
+}
+
+func newQueryAPI(conf *Config, executor func(c *gin.Context) (QueryExecutor, func(), bool)) *queryAPI {
+	maxSamples := conf.ReadMaxSamples
+	if maxSamples == 0 {
+		maxSamples = math.MaxInt32
+	}
+	engine := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: maxSamples,
+		Timeout:    2 * time.Minute,
+		NoStepSubqueryIntervalFn: func(int64) int64 {
+			return time.Minute.Milliseconds()
+		},
+		EnableAtModifier: true,
+	})
+	return &queryAPI{engine: engine, executor: executor, now: time.Now}
+}
+
+func (api *queryAPI) register(r gin.IRouter) {
+	r.GET("query", api.query)
+	r.POST("query", api.query)
+	r.GET("query_range", api.queryRange)
+	r.POST("query_range", api.queryRange)
+	r.GET("series", api.series)
+	r.POST("series", api.series)
+	r.GET("labels", api.labelNames)
+	r.POST("labels", api.labelNames)
+	r.GET("label/:name/values", api.labelValues)
+}
+
+func apiSuccess(c *gin.Context, data interface{}, warnings storage.Warnings) {
+	resp := apiResponse{Status: "success", Data: data}
+	for _, warning := range warnings {
+		resp.Warnings = append(resp.Warnings, warning.Error())
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func apiError(c *gin.Context, errorType string, err error) {
+	code := http.StatusInternalServerError
+	switch errorType {
+	case errorBadData:
+		code = http.StatusBadRequest
+	case errorExecution:
+		code = http.StatusUnprocessableEntity
+	case errorTimeout:
+		code = http.StatusServiceUnavailable
+	case errorCanceled:
+		code = 499
+	}
+	var taosError *tErrors.TaosError
+	if errors.As(err, &taosError) {
+		web.SetTaosErrorCode(c, int(taosError.Code))
+	}
+	c.AbortWithStatusJSON(code, apiResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+// queryError returns the error type of a promql query error.
+func queryError(err error) string {
+	switch err.(type) {
+	case promql.ErrQueryCanceled:
+		return errorCanceled
+	case promql.ErrQueryTimeout:
+		return errorTimeout
+	case promql.ErrStorage:
+		return errorInternal
+	}
+	return errorExecution
+}
+
+func (api *queryAPI) query(c *gin.Context) {
+	ts, err := parseTimeParam(c, "time", api.now())
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	executor, release, ok := api.executor(c)
+	if !ok {
+		return
+	}
+	defer release()
+	q, err := api.engine.NewInstantQuery(&executorQueryable{executor: executor}, c.Request.FormValue("query"), ts)
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	api.execute(c, q)
+}
+
+func (api *queryAPI) queryRange(c *gin.Context) {
+	start, err := parseTime(c.Request.FormValue("start"))
+	if err != nil {
+		apiError(c, errorBadData, fmt.Errorf("invalid parameter \"start\": %w", err))
+		return
+	}
+	end, err := parseTime(c.Request.FormValue("end"))
+	if err != nil {
+		apiError(c, errorBadData, fmt.Errorf("invalid parameter \"end\": %w", err))
+		return
+	}
+	if end.Before(start) {
+		apiError(c, errorBadData, errors.New("end timestamp must not be before start time"))
+		return
+	}
+	step, err := parseDuration(c.Request.FormValue("step"))
+	if err != nil {
+		apiError(c, errorBadData, fmt.Errorf("invalid parameter \"step\": %w", err))
+		return
+	}
+	if step <= 0 {
+		apiError(c, errorBadData, errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer"))
+		return
+	}
+	if end.Sub(start)/step > maxPointsPerSeries {
+		apiError(c, errorBadData, errors.New("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)"))
+		return
+	}
+	executor, release, ok := api.executor(c)
+	if !ok {
+		return
+	}
+	defer release()
+	q, err := api.engine.NewRangeQuery(&executorQueryable{executor: executor}, c.Request.FormValue("query"), start, end, step)
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	api.execute(c, q)
+}
+
+func (api *queryAPI) execute(c *gin.Context, q promql.Query) {
+	defer q.Close()
+	result := q.Exec(c.Request.Context())
+	if result.Err != nil {
+		apiError(c, queryError(result.Err), result.Err)
+		return
+	}
+	value := result.Value
+	// an empty result is an empty array instead of null
+	switch v := value.(type) {
+	case promql.Vector:
+		if v == nil {
+			value = promql.Vector{}
+		}
+	case promql.Matrix:
+		if v == nil {
+			value = promql.Matrix{}
+		}
+	}
+	apiSuccess(c, &queryData{ResultType: value.Type(), Result: value}, result.Warnings)
+}
+
+// seriesRange returns the time range of the series, labels and label values api, the default is from the epoch to now.
+func (api *queryAPI) seriesRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := api.now()
+	start, err := parseTimeParam(c, "start", time.Unix(0, 0))
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return start, now, false
+	}
+	end, err := parseTimeParam(c, "end", now)
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return start, end, false
+	}
+	if end.Before(start) {
+		apiError(c, errorBadData, errors.New("end timestamp must not be before start time"))
+		return start, end, false
+	}
+	return start, end, true
+}
+
+func parseMatchers(values []string) ([][]*labels.Matcher, error) {
+	result := make([][]*labels.Matcher, 0, len(values))
+	for _, s := range values {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, matchers)
+	}
+	return result, nil
+}
+
+// selectSeries returns the label sets of the series matching any of the match[] selectors.
+func (api *queryAPI) selectSeries(c *gin.Context, matcherSets [][]*labels.Matcher, start, end time.Time) ([]labels.Labels, bool) {
+	executor, release, ok := api.executor(c)
+	if !ok {
+		return nil, false
+	}
+	defer release()
+	querier := &executorQuerier{executor: executor, mint: timestamp(start), maxt: timestamp(end)}
+	hints := &storage.SelectHints{Start: querier.mint, End: querier.maxt, Func: seriesFunc}
+	exist := map[string]struct{}{}
+	result := []labels.Labels{}
+	for _, matchers := range matcherSets {
+		set := querier.Select(false, hints, matchers...)
+		for set.Next() {
+			lset := set.At().Labels()
+			key := lset.String()
+			if _, ok := exist[key]; ok {
+				continue
+			}
+			exist[key] = struct{}{}
+			result = append(result, lset)
+		}
+		if err := set.Err(); err != nil {
+			apiError(c, errorInternal, err)
+			return nil, false
+		}
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return labels.Compare(result[a], result[b]) < 0
+	})
+	return result, true
+}
+
+func (api *queryAPI) series(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	if len(c.Request.Form["match[]"]) == 0 {
+		apiError(c, errorBadData, errors.New("no match[] parameter provided"))
+		return
+	}
+	matcherSets, err := parseMatchers(c.Request.Form["match[]"])
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	start, end, ok := api.seriesRange(c)
+	if !ok {
+		return
+	}
+	result, ok := api.selectSeries(c, matcherSets, start, end)
+	if !ok {
+		return
+	}
+	apiSuccess(c, result, nil)
+}
+
+func (api *queryAPI) labelNames(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	matcherSets, err := parseMatchers(c.Request.Form["match[]"])
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	start, end, ok := api.seriesRange(c)
+	if !ok {
+		return
+	}
+	if len(matcherSets) == 0 {
+		// all the timeseries
+		matcherSets = [][]*labels.Matcher{nil}
+	}
+	result, ok := api.selectSeries(c, matcherSets, start, end)
+	if !ok {
+		return
+	}
+	names := map[string]struct{}{}
+	for _, lset := range result {
+		for _, label := range lset {
+			names[label.Name] = struct{}{}
+		}
+	}
+	apiSuccess(c, sortedKeys(names), nil)
+}
+
+func (api *queryAPI) labelValues(c *gin.Context) {
+	name := c.Param("name")
+	if !model.LabelNameRE.MatchString(name) {
+		apiError(c, errorBadData, fmt.Errorf("invalid label name: %q", name))
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	matcherSets, err := parseMatchers(c.Request.Form["match[]"])
+	if err != nil {
+		apiError(c, errorBadData, err)
+		return
+	}
+	start, end, ok := api.seriesRange(c)
+	if !ok {
+		return
+	}
+	if len(matcherSets) == 0 {
+		matcherSets = [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchNotEqual, name, "")}}
+	}
+	result, ok := api.selectSeries(c, matcherSets, start, end)
+	if !ok {
+		return
+	}
+	values := map[string]struct{}{}
+	for _, lset := range result {
+		if value := lset.Get(name); len(value) > 0 {
+			values[value] = struct{}{}
+		}
+	}
+	apiSuccess(c, sortedKeys(values), nil)
+}
+
+func parseTimeParam(c *gin.Context, name string, defaultValue time.Time) (time.Time, error) {
+	value := c.Request.FormValue(name)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	result, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid parameter %q: %w", name, err)
+	}
+	return result, nil
+}
+
+// parseTime parses a unix timestamp in seconds with optional decimal places or a RFC3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration parses a duration in seconds with optional decimal places or a prometheus duration like 5m.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		ts := d * float64(time.Second)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration. It overflows int64", s)
+		}
+		return time.Duration(ts), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
+
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// taosExecutor returns the executor on the connection of the request, the database is the db param.
+func (p *Plugin) taosExecutor(c *gin.Context) (QueryExecutor, func(), bool) {
+	user, password, err := plugin.GetAuth(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, apiResponse{Status: "error", ErrorType: errorBadData, Error: err.Error()})
+		return nil, nil, false
+	}
+	taosConn, err := commonpool.GetConnection(user, password, iptool.GetRealIP(c.Request))
+	if err != nil {
+		logger.WithError(err).Error("connect server error")
+		code := http.StatusUnauthorized
+		if errors.Is(err, commonpool.ErrWhitelistForbidden) {
+			code = http.StatusForbidden
+		} else if errors.Is(err, connectpool.ErrTimeout) || errors.Is(err, connectpool.ErrMaxWait) {
+			code = http.StatusServiceUnavailable
+		}
+		c.AbortWithStatusJSON(code, apiResponse{Status: "error", ErrorType: errorInternal, Error: err.Error()})
+		return nil, nil, false
+	}
+	release := func() {
+		putErr := taosConn.Put()
+		if putErr != nil {
+			logger.WithError(putErr).Errorln("connect pool put error")
+		}
+	}
+	isDebug := log.IsDebug()
+	reqID := generator.GetReqID()
+	reqLogger := logger.WithField(config.ReqIDKey, reqID)
+	db := c.Param("db")
+	reqLogger.Tracef("select db %s", db)
+	code := syncinterface.TaosSelectDB(taosConn.TaosConnection, db, reqLogger, isDebug)
+	if code != 0 {
+		release()
+		apiError(c, errorExecution, tErrors.NewError(code, wrapper.TaosErrorStr(nil)))
+		return nil, nil, false
+	}
+	conf, err := databaseConfig(taosConn.TaosConnection, reqLogger, isDebug, reqID, db, &p.conf)
+	if err != nil {
+		release()
+		apiError(c, errorExecution, err)
+		return nil, nil, false
+	}
+	return &taosExecutor{
+		taosConn: taosConn.TaosConnection,
+		logger:   reqLogger,
+		isDebug:  isDebug,
+		reqID:    reqID,
+		conf:     conf,
+		limiter:  newReadLimiter(conf),
+	}, release, true
+}
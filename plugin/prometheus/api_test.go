@@ -0,0 +1,272 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubExecutor struct {
+	timeseries []*prompb.TimeSeries
+	selects    int
+	series     int
+}
+
+func (e *stubExecutor) match(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	var result []*prompb.TimeSeries
+	for _, ts := range e.timeseries {
+		lset := labels.Labels{}
+		for _, label := range ts.Labels {
+			lset = append(lset, labels.Label{Name: label.Name, Value: label.Value})
+		}
+		matched := true
+		for _, m := range query.Matchers {
+			matcher, err := labels.NewMatcher(labels.MatchType(m.Type), m.Name, m.Value)
+			if err != nil {
+				return nil, err
+			}
+			if !matcher.Matches(lset.Get(m.Name)) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		series := &prompb.TimeSeries{Labels: ts.Labels}
+		for _, s := range ts.Samples {
+			if s.Timestamp >= query.StartTimestampMs && s.Timestamp <= query.EndTimestampMs {
+				series.Samples = append(series.Samples, s)
+			}
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+func (e *stubExecutor) Select(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	e.selects += 1
+	return e.match(query)
+}
+
+func (e *stubExecutor) Series(query *prompb.Query) ([]*prompb.TimeSeries, error) {
+	e.series += 1
+	result, err := e.match(query)
+	for _, ts := range result {
+		ts.Samples = nil
+	}
+	return result, err
+}
+
+// counterSeries returns a series increasing by 60 each minute from 0 to 10 minutes
+func counterSeries(lset map[string]string, factor float64) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{}
+	for name, value := range lset {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: name, Value: value})
+	}
+	for i := 0; i <= 10; i++ {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i) * 60000, Value: float64(i*60) * factor})
+	}
+	return ts
+}
+
+func newTestQueryAPI(executor QueryExecutor) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	api := newQueryAPI(&Config{}, func(c *gin.Context) (QueryExecutor, func(), bool) {
+		return executor, func() {}, true
+	})
+	api.now = func() time.Time {
+		return time.Unix(600, 0)
+	}
+	router := gin.New()
+	api.register(router.Group("promql/:db/api/v1"))
+	return router
+}
+
+type testAPIResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+func doAPIRequest(t *testing.T, router *gin.Engine, method string, path string, values url.Values) (int, *testAPIResponse) {
+	var req *http.Request
+	if method == http.MethodGet {
+		req = httptest.NewRequest(method, "/promql/test/api/v1/"+path+"?"+values.Encode(), nil)
+	} else {
+		req = httptest.NewRequest(method, "/promql/test/api/v1/"+path, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp testAPIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return w.Code, &resp
+}
+
+func TestQueryAPIQuery(t *testing.T) {
+	executor := &stubExecutor{timeseries: []*prompb.TimeSeries{
+		counterSeries(map[string]string{"__name__": "http_requests_total", "job": "api", "instance": "a"}, 1),
+		counterSeries(map[string]string{"__name__": "http_requests_total", "job": "api", "instance": "b"}, 2),
+		counterSeries(map[string]string{"__name__": "http_requests_total", "job": "web", "instance": "c"}, 4),
+	}}
+	router := newTestQueryAPI(executor)
+
+	code, resp := doAPIRequest(t, router, http.MethodGet, "query", url.Values{
+		"query": {"sort(sum by (job) (rate(http_requests_total[5m])))"},
+		"time":  {"600"},
+	})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.Equal(t, "success", resp.Status)
+	assert.JSONEq(t, `{"resultType":"vector","result":[
+		{"metric":{"job":"api"},"value":[600,"3"]},
+		{"metric":{"job":"web"},"value":[600,"4"]}
+	]}`, string(resp.Data))
+	assert.Equal(t, 1, executor.selects)
+
+	code, resp = doAPIRequest(t, router, http.MethodPost, "query", url.Values{
+		"query": {`avg_over_time(http_requests_total{instance="a"}[2m])`},
+		"time":  {"1970-01-01T00:10:00Z"},
+	})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `{"resultType":"vector","result":[
+		{"metric":{"instance":"a","job":"api"},"value":[600,"540"]}
+	]}`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query", url.Values{"query": {"1 + 1"}})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `{"resultType":"scalar","result":[600,"2"]}`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query", url.Values{"query": {"not_exist"}})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `{"resultType":"vector","result":[]}`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query", url.Values{"query": {"sum("}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "error", resp.Status)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query", url.Values{"query": {"up"}, "time": {"now"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+}
+
+func TestQueryAPIQueryRange(t *testing.T) {
+	executor := &stubExecutor{timeseries: []*prompb.TimeSeries{
+		counterSeries(map[string]string{"__name__": "http_requests_total", "job": "api"}, 1),
+	}}
+	router := newTestQueryAPI(executor)
+	code, resp := doAPIRequest(t, router, http.MethodGet, "query_range", url.Values{
+		"query": {"rate(http_requests_total[2m])"},
+		"start": {"300"},
+		"end":   {"420"},
+		"step":  {"1m"},
+	})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `{"resultType":"matrix","result":[
+		{"metric":{"job":"api"},"values":[[300,"1"],[360,"1"],[420,"1"]]}
+	]}`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query_range", url.Values{
+		"query": {"http_requests_total"},
+		"start": {"420"},
+		"end":   {"300"},
+		"step":  {"60"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "query_range", url.Values{
+		"query": {"http_requests_total"},
+		"start": {"0"},
+		"end":   {"600"},
+		"step":  {"0"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+
+	code, _ = doAPIRequest(t, router, http.MethodGet, "query_range", url.Values{
+		"query": {"http_requests_total"},
+		"start": {"0"},
+		"end":   {"600000"},
+		"step":  {"0.001"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestQueryAPISeriesAndLabels(t *testing.T) {
+	executor := &stubExecutor{timeseries: []*prompb.TimeSeries{
+		counterSeries(map[string]string{"__name__": "up", "job": "node", "instance": "a"}, 1),
+		counterSeries(map[string]string{"__name__": "up", "job": "prometheus", "instance": "b"}, 1),
+		counterSeries(map[string]string{"__name__": "node_load1", "job": "node", "instance": "a", "mode": "x"}, 1),
+	}}
+	router := newTestQueryAPI(executor)
+
+	code, resp := doAPIRequest(t, router, http.MethodGet, "series", url.Values{"match[]": {`up{job="node"}`, "node_load1"}})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `[
+		{"__name__":"node_load1","instance":"a","job":"node","mode":"x"},
+		{"__name__":"up","instance":"a","job":"node"}
+	]`, string(resp.Data))
+	assert.Equal(t, 0, executor.selects)
+	assert.Equal(t, 2, executor.series)
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "series", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "labels", nil)
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `["__name__","instance","job","mode"]`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodPost, "labels", url.Values{"match[]": {"up"}})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `["__name__","instance","job"]`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "label/job/values", nil)
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `["node","prometheus"]`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "label/__name__/values", url.Values{"match[]": {`{job="node"}`}})
+	require.Equal(t, http.StatusOK, code, resp.Error)
+	assert.JSONEq(t, `["node_load1","up"]`, string(resp.Data))
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "label/mode/values", url.Values{"start": {"700"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+
+	code, resp = doAPIRequest(t, router, http.MethodGet, "label/a-b/values", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadData, resp.ErrorType)
+}
+
+func TestParseTimeAndDuration(t *testing.T) {
+	ts, err := parseTime("1639979902.123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1639979902123), timestamp(ts))
+	ts, err = parseTime("2021-12-20T05:58:22.5Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1639979902500), timestamp(ts))
+	_, err = parseTime("abc")
+	assert.Error(t, err)
+
+	d, err := parseDuration("15")
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Second, d)
+	d, err = parseDuration("1m30s")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, d)
+	_, err = parseDuration("1x")
+	assert.Error(t, err)
+}
@@ -1,20 +1,88 @@
 package prometheus
 
 import (
+	"fmt"
+
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+const (
+	// SchemaLegacy stores all metrics in the `metrics` supertable with labels in a json tag
+	SchemaLegacy = "legacy"
+	// SchemaMetric stores each metric in its own supertable with one tag for each label
+	SchemaMetric = "metric"
+)
+
+const (
+	TagTypeVarchar = "varchar"
+	TagTypeNchar   = "nchar"
+)
+
 type Config struct {
-	Enable bool
+	Enable    bool
+	Schema    string
+	TagType   string
+	TagLength int
+	// ReadMaxSamples and ReadMaxSeries limit each remote_read request, 0 means no limit
+	ReadMaxSamples int
+	ReadMaxSeries  int
 }
 
 func (c *Config) setValue() {
 	c.Enable = viper.GetBool("prometheus.enable")
+	c.Schema = viper.GetString("prometheus.schema")
+	c.TagType = viper.GetString("prometheus.tagType")
+	c.TagLength = viper.GetInt("prometheus.tagLength")
+	c.ReadMaxSamples = viper.GetInt("prometheus.readMaxSamples")
+	c.ReadMaxSeries = viper.GetInt("prometheus.readMaxSeries")
+}
+
+func (c *Config) check() error {
+	switch c.Schema {
+	case SchemaLegacy, SchemaMetric:
+	default:
+		return fmt.Errorf("invalid prometheus.schema %s, should be %s or %s", c.Schema, SchemaLegacy, SchemaMetric)
+	}
+	switch c.TagType {
+	case TagTypeVarchar, TagTypeNchar:
+	default:
+		return fmt.Errorf("invalid prometheus.tagType %s, should be %s or %s", c.TagType, TagTypeVarchar, TagTypeNchar)
+	}
+	if c.TagLength <= 0 {
+		return fmt.Errorf("invalid prometheus.tagLength %d, should be greater than 0", c.TagLength)
+	}
+	if c.ReadMaxSamples < 0 {
+		return fmt.Errorf("invalid prometheus.readMaxSamples %d, should not be negative", c.ReadMaxSamples)
+	}
+	if c.ReadMaxSeries < 0 {
+		return fmt.Errorf("invalid prometheus.readMaxSeries %d, should not be negative", c.ReadMaxSeries)
+	}
+	return nil
 }
 
 func init() {
 	_ = viper.BindEnv("prometheus.enable", "TAOS_ADAPTER_PROMETHEUS_ENABLE")
 	pflag.Bool("prometheus.enable", true, `enable prometheus. Env "TAOS_ADAPTER_PROMETHEUS_ENABLE"`)
 	viper.SetDefault("prometheus.enable", true)
+
+	_ = viper.BindEnv("prometheus.schema", "TAOS_ADAPTER_PROMETHEUS_SCHEMA")
+	pflag.String("prometheus.schema", SchemaLegacy, `prometheus storage schema, legacy: all metrics in one supertable with json labels, metric: one supertable for each metric with labels as tags, databases with the legacy supertable keep the legacy schema. Env "TAOS_ADAPTER_PROMETHEUS_SCHEMA"`)
+	viper.SetDefault("prometheus.schema", SchemaLegacy)
+
+	_ = viper.BindEnv("prometheus.tagType", "TAOS_ADAPTER_PROMETHEUS_TAG_TYPE")
+	pflag.String("prometheus.tagType", TagTypeVarchar, `label tag type in metric schema, varchar or nchar. Env "TAOS_ADAPTER_PROMETHEUS_TAG_TYPE"`)
+	viper.SetDefault("prometheus.tagType", TagTypeVarchar)
+
+	_ = viper.BindEnv("prometheus.tagLength", "TAOS_ADAPTER_PROMETHEUS_TAG_LENGTH")
+	pflag.Int("prometheus.tagLength", 256, `label tag length in metric schema. Env "TAOS_ADAPTER_PROMETHEUS_TAG_LENGTH"`)
+	viper.SetDefault("prometheus.tagLength", 256)
+
+	_ = viper.BindEnv("prometheus.readMaxSamples", "TAOS_ADAPTER_PROMETHEUS_READ_MAX_SAMPLES")
+	pflag.Int("prometheus.readMaxSamples", 50000000, `max samples returned by one remote_read request, 0 means no limit. Env "TAOS_ADAPTER_PROMETHEUS_READ_MAX_SAMPLES"`)
+	viper.SetDefault("prometheus.readMaxSamples", 50000000)
+
+	_ = viper.BindEnv("prometheus.readMaxSeries", "TAOS_ADAPTER_PROMETHEUS_READ_MAX_SERIES")
+	pflag.Int("prometheus.readMaxSeries", 0, `max series returned by one remote_read request, 0 means no limit. Env "TAOS_ADAPTER_PROMETHEUS_READ_MAX_SERIES"`)
+	viper.SetDefault("prometheus.readMaxSeries", 0)
 }
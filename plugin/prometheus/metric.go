@@ -0,0 +1,453 @@
+package prometheus
+
+import (
+	"crypto/md5"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/log"
+	prompbWrite "github.com/taosdata/taosadapter/v3/plugin/prometheus/proto/write"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/bytesutil"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+	"github.com/taosdata/taosadapter/v3/tools/pool"
+)
+
+const metricNameLabel = "__name__"
+
+var ErrNoMetricName = errors.New("metric schema requires an equal matcher on __name__")
+
+// metricGroup is the timeseries of one metric with the same label names, they are written with one statement.
+type metricGroup struct {
+	metric     string
+	tags       []string
+	timeseries []prompbWrite.TimeSeries
+}
+
+// groupByMetric groups the timeseries by metric name and label names, the labels of each timeseries are sorted.
+func groupByMetric(timeseries []prompbWrite.TimeSeries) ([]*metricGroup, error) {
+	groups := make(map[string]*metricGroup)
+	result := make([]*metricGroup, 0)
+	var key strings.Builder
+	for i := 0; i < len(timeseries); i++ {
+		sort.Sort(timeseries[i].Labels)
+		metric := ""
+		key.Reset()
+		for _, label := range timeseries[i].Labels {
+			if bytesutil.ToUnsafeString(label.Name) == metricNameLabel {
+				metric = string(label.Value)
+				continue
+			}
+			key.WriteByte(',')
+			key.Write(label.Name)
+		}
+		if len(metric) == 0 {
+			return nil, errors.New("metric name label __name__ is required")
+		}
+		groupKey := metric + key.String()
+		group, exist := groups[groupKey]
+		if !exist {
+			group = &metricGroup{metric: metric}
+			for _, label := range timeseries[i].Labels {
+				if bytesutil.ToUnsafeString(label.Name) != metricNameLabel {
+					group.tags = append(group.tags, string(label.Name))
+				}
+			}
+			if len(group.tags) == 0 {
+				// a supertable needs at least one tag, a timeseries without labels keeps the metric name as tag
+				group.tags = []string{metricNameLabel}
+			}
+			groups[groupKey] = group
+			result = append(result, group)
+		}
+		group.timeseries = append(group.timeseries, timeseries[i])
+	}
+	return result, nil
+}
+
+func generateMetricWriteStmtSql(metric string, tags []string, ttl int) (string, error) {
+	b := pool.BytesPoolGet()
+	defer pool.BytesPoolPut(b)
+	stable, err := tools.QuoteIdentifier(metric)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString("insert into ? using ")
+	b.WriteString(stable)
+	b.WriteString(" (")
+	for i, tag := range tags {
+		name, err := tools.QuoteIdentifier(tag)
+		if err != nil {
+			return "", err
+		}
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+	}
+	b.WriteString(") tags(")
+	for i := range tags {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('?')
+	}
+	b.WriteString(")")
+	if ttl > 0 {
+		b.WriteString(" ttl ")
+		b.WriteString(strconv.Itoa(ttl))
+	}
+	b.WriteString(" values(?,?)")
+	return b.String(), nil
+}
+
+func tagDefinition(tag string, conf *Config) string {
+	return fmt.Sprintf("`%s` %s(%d)", tag, conf.TagType, conf.TagLength)
+}
+
+func generateCreateMetricStableSql(metric string, tags []string, conf *Config) string {
+	definitions := make([]string, len(tags))
+	for i, tag := range tags {
+		definitions[i] = tagDefinition(tag, conf)
+	}
+	return fmt.Sprintf("create stable if not exists `%s` (ts timestamp,v double) tags (%s)", metric, strings.Join(definitions, ","))
+}
+
+// generateMetricWriteParams groups the samples of a metric group by child table. The child table name is the same as the
+// legacy schema, and the tag values are in the order of group.tags.
+func generateMetricWriteParams(group *metricGroup, precision int) []*stmt.TaosStmt2BindData {
+	tmp := pool.BytesPoolGet()
+	defer pool.BytesPoolPut(tmp)
+	tables := make(map[string]*stmt.TaosStmt2BindData, len(group.timeseries))
+	bindData := make([]*stmt.TaosStmt2BindData, 0, len(group.timeseries))
+	for i := 0; i < len(group.timeseries); i++ {
+		labels := group.timeseries[i].Labels
+		labelCount := len(labels)
+		tmp.Reset()
+		for labelIndex := 0; labelIndex < labelCount; labelIndex++ {
+			tmp.Write(labels[labelIndex].Name)
+			tmp.WriteByte('=')
+			tmp.Write(labels[labelIndex].Value)
+			if labelIndex != labelCount-1 {
+				tmp.WriteByte(',')
+			}
+		}
+		tableName := fmt.Sprintf("t_%x", md5.Sum(tmp.Bytes()))
+		table, exist := tables[tableName]
+		if !exist {
+			tags := make([]driver.Value, 0, len(group.tags))
+			for _, label := range labels {
+				if bytesutil.ToUnsafeString(label.Name) != metricNameLabel || group.tags[0] == metricNameLabel {
+					tags = append(tags, string(label.Value))
+				}
+			}
+			table = &stmt.TaosStmt2BindData{
+				TableName: tableName,
+				Tags:      tags,
+				Cols: [][]driver.Value{
+					make([]driver.Value, 0, len(group.timeseries[i].Samples)),
+					make([]driver.Value, 0, len(group.timeseries[i].Samples)),
+				},
+			}
+			tables[tableName] = table
+			bindData = append(bindData, table)
+		}
+		for _, sample := range group.timeseries[i].Samples {
+			table.Cols[0] = append(table.Cols[0], msToPrecision(sample.Timestamp, precision))
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				table.Cols[1] = append(table.Cols[1], nil)
+			} else {
+				table.Cols[1] = append(table.Cols[1], sample.Value)
+			}
+		}
+	}
+	return bindData
+}
+
+func processMetricWrite(taosConn unsafe.Pointer, req *prompbWrite.WriteRequest, db string, ttl int, conf *Config) error {
+	reqID := generator.GetReqID()
+	logger := logger.WithField(config.ReqIDKey, reqID)
+	isDebug := log.IsDebug()
+	start := time.Now()
+	err := tool.SchemalessSelectDB(taosConn, logger, isDebug, db, 0)
+	if err != nil {
+		return err
+	}
+	logger.Debug("processMetricWrite SchemalessSelectDB cost:", time.Since(start))
+	groups, err := groupByMetric(req.Timeseries)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		err = writeMetricGroup(taosConn, logger, isDebug, reqID, group, ttl, conf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMetricGroup(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, group *metricGroup, ttl int, conf *Config) error {
+	sql, err := generateMetricWriteStmtSql(group.metric, group.tags, ttl)
+	if err != nil {
+		return err
+	}
+	generate := func(precision int) ([]*stmt.TaosStmt2BindData, error) {
+		return generateMetricWriteParams(group, precision), nil
+	}
+	err = tool.Stmt2Insert(taosConn, logger, isDebug, reqID, sql, generate)
+	if err == nil {
+		return nil
+	}
+	tErr, is := err.(*tErrors.TaosError)
+	if !is {
+		return err
+	}
+	logger.WithError(err).Errorf("write metric %s error, sync schema and retry", group.metric)
+	if tool.IsTableNotExist(tErr.Code) {
+		err = async.GlobalAsync.TaosExecWithoutResult(taosConn, logger, isDebug, generateCreateMetricStableSql(group.metric, group.tags, conf), reqID)
+		if err != nil {
+			return err
+		}
+	} else {
+		added, syncErr := addMissingTags(taosConn, logger, isDebug, reqID, group, conf)
+		if syncErr != nil {
+			logger.WithError(syncErr).Errorf("sync metric %s schema error", group.metric)
+			return err
+		}
+		if !added {
+			return err
+		}
+	}
+	// retry
+	return tool.Stmt2Insert(taosConn, logger, isDebug, reqID, sql, generate)
+}
+
+// addMissingTags adds the labels that are not tags of the supertable, it returns false if no tag is added.
+func addMissingTags(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, group *metricGroup, conf *Config) (bool, error) {
+	tags, err := describeMetricTags(taosConn, logger, isDebug, reqID, group.metric)
+	if err != nil {
+		return false, err
+	}
+	added := false
+	for _, tag := range group.tags {
+		if _, exist := tags[tag]; exist {
+			continue
+		}
+		err = async.GlobalAsync.TaosExecWithoutResult(taosConn, logger, isDebug, fmt.Sprintf("alter stable `%s` add tag %s", group.metric, tagDefinition(tag, conf)), reqID)
+		if err != nil {
+			return added, err
+		}
+		added = true
+	}
+	return added, nil
+}
+
+// describeMetricTags returns the tag names of the metric supertable.
+func describeMetricTags(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, metric string) (map[string]struct{}, error) {
+	stable, err := tools.QuoteIdentifier(metric)
+	if err != nil {
+		return nil, err
+	}
+	data, err := async.GlobalAsync.TaosExec(taosConn, logger, isDebug, "describe "+stable, func(ts int64, precision int) driver.Value {
+		return ts
+	}, reqID)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]struct{})
+	// field type length note
+	for _, row := range data.Data {
+		if len(row) < 4 {
+			continue
+		}
+		name, _ := row[0].(string)
+		note, _ := row[3].(string)
+		if note == "TAG" {
+			tags[name] = struct{}{}
+		}
+	}
+	return tags, nil
+}
+
+// matchEmpty reports whether a label that does not exist (empty value in prometheus) satisfies the matcher.
+func matchEmpty(matcher *prompb.LabelMatcher) (bool, error) {
+	switch matcher.Type {
+	case prompb.LabelMatcher_EQ:
+		return matcher.Value == "", nil
+	case prompb.LabelMatcher_NEQ:
+		return matcher.Value != "", nil
+	case prompb.LabelMatcher_RE, prompb.LabelMatcher_NRE:
+		re, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString("") == (matcher.Type == prompb.LabelMatcher_RE), nil
+	default:
+		return false, errors.New("not support match type")
+	}
+}
+
+// metricName returns the value of the equal matcher on __name__.
+func metricName(query *prompb.Query) (string, error) {
+	for _, matcher := range query.GetMatchers() {
+		if matcher.GetName() == metricNameLabel && matcher.Type == prompb.LabelMatcher_EQ && len(matcher.GetValue()) > 0 {
+			return matcher.GetValue(), nil
+		}
+	}
+	return "", ErrNoMetricName
+}
+
+// generateMetricReadSql translates the matchers to tag predicates on the metric supertable, tags is the tag names of the
+// supertable. It returns an empty sql if the query can not match any timeseries.
+func generateMetricReadSql(query *prompb.Query, metric string, tags map[string]struct{}) (string, error) {
+	return generateMetricSql("*,tbname", query, metric, tags, "")
+}
+
+// generateMetricSeriesSql returns the last sample of each timeseries matching the query, the columns are ts, v, tags
+// and tbname like generateMetricReadSql.
+func generateMetricSeriesSql(query *prompb.Query, metric string, tags map[string]struct{}) (string, error) {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	selection := make([]string, 0, len(names)+3)
+	selection = append(selection, "last(ts)", "last(v)")
+	for _, name := range names {
+		column, err := tools.QuoteIdentifier(name)
+		if err != nil {
+			return "", err
+		}
+		selection = append(selection, column)
+	}
+	selection = append(selection, "tbname")
+	return generateMetricSql(strings.Join(selection, ","), query, metric, tags, " partition by tbname")
+}
+
+func generateMetricSql(selection string, query *prompb.Query, metric string, tags map[string]struct{}, suffix string) (string, error) {
+	stable, err := tools.QuoteIdentifier(metric)
+	if err != nil {
+		return "", err
+	}
+	b := pool.BytesPoolGet()
+	defer pool.BytesPoolPut(b)
+	b.WriteString("select ")
+	b.WriteString(selection)
+	b.WriteString(" from ")
+	b.WriteString(stable)
+	b.WriteString(" where ts >= '")
+	b.WriteString(ms2Time(query.GetStartTimestampMs()))
+	b.WriteString("' and ts <= '")
+	b.WriteString(ms2Time(query.GetEndTimestampMs()))
+	b.WriteByte('\'')
+	for _, matcher := range query.GetMatchers() {
+		name := matcher.GetName()
+		if name == metricNameLabel {
+			// the metric name is the supertable name
+			ok, err := matchMetricName(matcher, metric)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", nil
+			}
+			continue
+		}
+		if _, exist := tags[name]; !exist {
+			ok, err := matchEmpty(matcher)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", nil
+			}
+			continue
+		}
+		column, err := tools.QuoteIdentifier(name)
+		if err != nil {
+			return "", err
+		}
+		value := tools.EscapeString(matcher.GetValue())
+		emptyMatched, err := matchEmpty(matcher)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(" and (")
+		b.WriteString(column)
+		switch matcher.Type {
+		case prompb.LabelMatcher_EQ:
+			b.WriteString(" = '")
+		case prompb.LabelMatcher_NEQ:
+			b.WriteString(" != '")
+		case prompb.LabelMatcher_RE:
+			b.WriteString(" match '")
+		case prompb.LabelMatcher_NRE:
+			b.WriteString(" nmatch '")
+		}
+		b.WriteString(value)
+		b.WriteByte('\'')
+		if emptyMatched {
+			// a null tag is an empty label
+			b.WriteString(" or ")
+			b.WriteString(column)
+			b.WriteString(" is null")
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(suffix)
+	return b.String(), nil
+}
+
+func matchMetricName(matcher *prompb.LabelMatcher, metric string) (bool, error) {
+	switch matcher.Type {
+	case prompb.LabelMatcher_EQ:
+		return metric == matcher.Value, nil
+	case prompb.LabelMatcher_NEQ:
+		return metric != matcher.Value, nil
+	case prompb.LabelMatcher_RE, prompb.LabelMatcher_NRE:
+		re, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(metric) == (matcher.Type == prompb.LabelMatcher_RE), nil
+	default:
+		return false, errors.New("not support match type")
+	}
+}
+
+// metricLabelParser returns the labels of a `select *,tbname` row on the metric supertable, columns are ts, v, tags and tbname.
+func metricLabelParser(metric string) labelParser {
+	return func(columns []string, row []driver.Value) ([]prompb.Label, error) {
+		labels := []prompb.Label{{Name: metricNameLabel, Value: metric}}
+		for j := 2; j < len(columns)-1; j++ {
+			if row[j] == nil || columns[j] == metricNameLabel {
+				continue
+			}
+			value, ok := row[j].(string)
+			if !ok || len(value) == 0 {
+				continue
+			}
+			labels = append(labels, prompb.Label{Name: columns[j], Value: value})
+		}
+		sort.Slice(labels, func(a, b int) bool {
+			return labels[a].Name < labels[b].Name
+		})
+		return labels, nil
+	}
+}
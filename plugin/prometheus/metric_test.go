@@ -0,0 +1,176 @@
+package prometheus
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
+	prompbWrite "github.com/taosdata/taosadapter/v3/plugin/prometheus/proto/write"
+)
+
+func newTimeSeries(labels map[string]string, samples ...prompbWrite.Sample) prompbWrite.TimeSeries {
+	ts := prompbWrite.TimeSeries{Samples: samples}
+	for k, v := range labels {
+		ts.Labels = append(ts.Labels, prompbWrite.Label{Name: []byte(k), Value: []byte(v)})
+	}
+	return ts
+}
+
+func TestConfigCheck(t *testing.T) {
+	conf := Config{Schema: SchemaMetric, TagType: TagTypeNchar, TagLength: 64}
+	assert.NoError(t, conf.check())
+	conf.Schema = "wrong"
+	assert.Error(t, conf.check())
+	conf.Schema = SchemaLegacy
+	conf.TagType = "json"
+	assert.Error(t, conf.check())
+	conf.TagType = TagTypeVarchar
+	conf.TagLength = 0
+	assert.Error(t, conf.check())
+}
+
+func TestGroupByMetric(t *testing.T) {
+	timeseries := []prompbWrite.TimeSeries{
+		newTimeSeries(map[string]string{"__name__": "up", "job": "node", "instance": "a"}, prompbWrite.Sample{Value: 1, Timestamp: 1}),
+		newTimeSeries(map[string]string{"__name__": "cpu", "job": "node"}, prompbWrite.Sample{Value: 2, Timestamp: 1}),
+		newTimeSeries(map[string]string{"__name__": "up", "instance": "b", "job": "node"}, prompbWrite.Sample{Value: 3, Timestamp: 1}),
+		newTimeSeries(map[string]string{"__name__": "up"}, prompbWrite.Sample{Value: 4, Timestamp: 1}),
+	}
+	groups, err := groupByMetric(timeseries)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(groups))
+	assert.Equal(t, "up", groups[0].metric)
+	assert.Equal(t, []string{"instance", "job"}, groups[0].tags)
+	assert.Equal(t, 2, len(groups[0].timeseries))
+	assert.Equal(t, "cpu", groups[1].metric)
+	assert.Equal(t, []string{"job"}, groups[1].tags)
+	assert.Equal(t, "up", groups[2].metric)
+	assert.Equal(t, []string{"__name__"}, groups[2].tags)
+
+	_, err = groupByMetric([]prompbWrite.TimeSeries{newTimeSeries(map[string]string{"job": "node"})})
+	assert.Error(t, err)
+}
+
+func TestGenerateMetricWriteStmtSql(t *testing.T) {
+	sql, err := generateMetricWriteStmtSql("node_cpu_seconds_total", []string{"cpu", "instance"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "insert into ? using `node_cpu_seconds_total` (`cpu`,`instance`) tags(?,?) values(?,?)", sql)
+	sql, err = generateMetricWriteStmtSql("up", []string{"job"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "insert into ? using `up` (`job`) tags(?) ttl 10 values(?,?)", sql)
+	_, err = generateMetricWriteStmtSql("up", []string{"a`b"}, 0)
+	assert.Error(t, err)
+
+	conf := &Config{TagType: TagTypeVarchar, TagLength: 128}
+	assert.Equal(t, "create stable if not exists `up` (ts timestamp,v double) tags (`instance` varchar(128),`job` varchar(128))", generateCreateMetricStableSql("up", []string{"instance", "job"}, conf))
+}
+
+func TestGenerateMetricWriteParams(t *testing.T) {
+	timeseries := []prompbWrite.TimeSeries{
+		newTimeSeries(map[string]string{"__name__": "up", "job": "node", "instance": "a"},
+			prompbWrite.Sample{Value: 1, Timestamp: 1639979902000},
+		),
+		newTimeSeries(map[string]string{"__name__": "up", "job": "node", "instance": "a"},
+			prompbWrite.Sample{Value: math.NaN(), Timestamp: 1639979903000},
+		),
+		newTimeSeries(map[string]string{"__name__": "up"},
+			prompbWrite.Sample{Value: 2, Timestamp: 1639979902000},
+		),
+	}
+	groups, err := groupByMetric(timeseries)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(groups))
+	assert.Equal(t, []*stmt.TaosStmt2BindData{
+		{
+			// same table name as legacy schema
+			TableName: "t_56fe68fa9f1d474dc2b5e5d8b3be3a60",
+			Tags:      []driver.Value{"a", "node"},
+			Cols: [][]driver.Value{
+				{int64(1639979902000000), int64(1639979903000000)},
+				{float64(1), nil},
+			},
+		},
+	}, generateMetricWriteParams(groups[0], common.PrecisionMicroSecond))
+	assert.Equal(t, []*stmt.TaosStmt2BindData{
+		{
+			TableName: "t_065f768e5aa52eef6beb846c383271c2",
+			Tags:      []driver.Value{"up"},
+			Cols: [][]driver.Value{
+				{int64(1639979902000)},
+				{float64(2)},
+			},
+		},
+	}, generateMetricWriteParams(groups[1], common.PrecisionMilliSecond))
+}
+
+func TestMatchEmpty(t *testing.T) {
+	tests := []struct {
+		matcher *prompb.LabelMatcher
+		want    bool
+	}{
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Value: ""}, want: true},
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Value: "a"}, want: false},
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Value: "a"}, want: true},
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Value: "a.*"}, want: false},
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Value: ".*"}, want: true},
+		{matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Value: "a.*"}, want: true},
+	}
+	for _, tt := range tests {
+		got, err := matchEmpty(tt.matcher)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.matcher.String())
+	}
+	_, err := matchEmpty(&prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Value: "("})
+	assert.Error(t, err)
+}
+
+func TestGenerateMetricReadSql(t *testing.T) {
+	tags := map[string]struct{}{"job": {}, "instance": {}, "mode": {}}
+	query := &prompb.Query{
+		StartTimestampMs: 1639979902000,
+		EndTimestampMs:   1639979903000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "node_cpu_seconds_total"},
+			{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "node"},
+			{Type: prompb.LabelMatcher_NEQ, Name: "instance", Value: "a'b"},
+			{Type: prompb.LabelMatcher_RE, Name: "mode", Value: "idle|user"},
+			{Type: prompb.LabelMatcher_NRE, Name: "not_exist", Value: "x"},
+		},
+	}
+	metric, err := metricName(query)
+	require.NoError(t, err)
+	assert.Equal(t, "node_cpu_seconds_total", metric)
+	sql, err := generateMetricReadSql(query, metric, tags)
+	require.NoError(t, err)
+	assert.Equal(t, "select *,tbname from `node_cpu_seconds_total` where ts >= '2021-12-20T05:58:22Z' and ts <= '2021-12-20T05:58:23Z' and (`job` = 'node') and (`instance` != 'a\\'b' or `instance` is null) and (`mode` match 'idle|user')", sql)
+
+	// label that is not a tag never matches a non-empty value
+	query.Matchers = append(query.Matchers, &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "not_exist", Value: "x"})
+	sql, err = generateMetricReadSql(query, metric, tags)
+	require.NoError(t, err)
+	assert.Equal(t, "", sql)
+
+	query.Matchers = query.Matchers[:2]
+	sql, err = generateMetricSeriesSql(query, metric, tags)
+	require.NoError(t, err)
+	assert.Equal(t, "select last(ts),last(v),`instance`,`job`,`mode`,tbname from `node_cpu_seconds_total` where ts >= '2021-12-20T05:58:22Z' and ts <= '2021-12-20T05:58:23Z' and (`job` = 'node') partition by tbname", sql)
+
+	_, err = metricName(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "up"}}})
+	assert.ErrorIs(t, err, ErrNoMetricName)
+}
+
+func TestMetricLabelParser(t *testing.T) {
+	columns := []string{"ts", "v", "job", "instance", "__name__", "tbname"}
+	parse := metricLabelParser("up")
+	labels, err := parse(columns, []driver.Value{int64(1), float64(1), "node", "a", nil, "t_1"})
+	require.NoError(t, err)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a"}, {Name: "job", Value: "node"}}, labels)
+	labels, err = parse(columns, []driver.Value{int64(1), float64(1), nil, nil, "up", "t_2"})
+	require.NoError(t, err)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}}, labels)
+}
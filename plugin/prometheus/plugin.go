@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+	"unsafe"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogo/protobuf/proto"
@@ -17,6 +18,7 @@ import (
 	"github.com/taosdata/taosadapter/v3/plugin"
 	prompbWrite "github.com/taosdata/taosadapter/v3/plugin/prometheus/proto/write"
 	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
 	"github.com/taosdata/taosadapter/v3/tools/iptool"
 	"github.com/taosdata/taosadapter/v3/tools/pool"
 	"github.com/taosdata/taosadapter/v3/tools/web"
@@ -27,6 +29,7 @@ var bufferPool pool.ByteBufferPool
 
 type Plugin struct {
 	conf Config
+	api  *queryAPI
 }
 
 func (p *Plugin) Init(r gin.IRouter) error {
@@ -35,6 +38,9 @@ func (p *Plugin) Init(r gin.IRouter) error {
 		logger.Info("opentsdb_telnet disabled")
 		return nil
 	}
+	if err := p.conf.check(); err != nil {
+		return err
+	}
 	r.Use(plugin.Auth(func(c *gin.Context, code int, err error) {
 		_ = c.AbortWithError(code, err)
 	}))
@@ -52,6 +58,16 @@ func (p *Plugin) Init(r gin.IRouter) error {
 			return
 		}
 	}, p.Write)
+	p.api = newQueryAPI(&p.conf, p.taosExecutor)
+	apiGroup := r.Group("promql/:db/api/v1")
+	apiGroup.Use(func(c *gin.Context) {
+		if monitor.QueryPaused() {
+			c.Header("Retry-After", "120")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, "query memory exceeds threshold")
+			return
+		}
+	})
+	p.api.register(apiGroup)
 	return nil
 }
 
@@ -120,7 +136,11 @@ func (p *Plugin) Read(c *gin.Context) {
 			logger.WithError(putErr).Errorln("connect pool put error")
 		}
 	}()
-	resp, err := processRead(taosConn.TaosConnection, &req, db)
+	if negotiateResponseType(req.AcceptedResponseTypes) == prompb.ReadRequest_STREAMED_XOR_CHUNKS {
+		p.streamedRead(c, taosConn.TaosConnection, &req, db)
+		return
+	}
+	resp, err := processRead(taosConn.TaosConnection, &req, db, &p.conf)
 	if err != nil {
 		taosError, is := err.(*tErrors.TaosError)
 		if is {
@@ -143,6 +163,38 @@ func (p *Plugin) Read(c *gin.Context) {
 	c.Data(http.StatusAccepted, "application/x-protobuf", compressed)
 }
 
+// negotiateResponseType returns the first accepted response type, SAMPLES if none is given.
+func negotiateResponseType(accepted []prompb.ReadRequest_ResponseType) prompb.ReadRequest_ResponseType {
+	for _, t := range accepted {
+		switch t {
+		case prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES:
+			return t
+		}
+	}
+	return prompb.ReadRequest_SAMPLES
+}
+
+func (p *Plugin) streamedRead(c *gin.Context, taosConn unsafe.Pointer, req *prompb.ReadRequest, db string) {
+	c.Header("Content-Type", StreamedContentType)
+	flusher, _ := c.Writer.(http.Flusher)
+	w := &chunkedWriter{writer: c.Writer, flusher: flusher}
+	err := processStreamedRead(taosConn, req, db, &p.conf, w)
+	if err != nil {
+		logger.WithError(err).Error("streamed read error")
+		taosError, is := err.(*tErrors.TaosError)
+		if is {
+			web.SetTaosErrorCode(c, int(taosError.Code))
+		}
+		// the same as prometheus, the error message breaks the stream if frames have been written
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if w.frames == 0 {
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+}
+
 func (p *Plugin) Write(c *gin.Context) {
 	db := c.Param("db")
 	ttl := c.Query("ttl")
@@ -211,7 +263,14 @@ func (p *Plugin) Write(c *gin.Context) {
 			logger.WithError(putErr).Errorln("connect pool put error")
 		}
 	}()
-	err = processWrite(taosConn.TaosConnection, req, db, ttlI)
+	conf, err := databaseConfig(taosConn.TaosConnection, logger, log.IsDebug(), generator.GetReqID(), db, &p.conf)
+	if err == nil {
+		if conf.Schema == SchemaMetric {
+			err = processMetricWrite(taosConn.TaosConnection, req, db, ttlI, conf)
+		} else {
+			err = processWrite(taosConn.TaosConnection, req, db, ttlI)
+		}
+	}
 	if err != nil {
 		taosError, is := err.(*tErrors.TaosError)
 		if is {
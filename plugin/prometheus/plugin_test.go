@@ -437,7 +437,7 @@ func TestPrometheusWithLimit(t *testing.T) {
 		Queries: []*prompb.Query{
 			{
 				StartTimestampMs: now,
-				EndTimestampMs:   now,
+				EndTimestampMs:   now + 1,
 				Matchers: []*prompb.LabelMatcher{
 					{
 						Type:  prompb.LabelMatcher_EQ,
@@ -448,15 +448,22 @@ func TestPrometheusWithLimit(t *testing.T) {
 			},
 		},
 	}
-	config.Conf.RestfulRowLimit = 1
 	rdata, err := proto.Marshal(&rReq)
 	assert.NoError(t, err)
-	w = httptest.NewRecorder()
-	compressedR := snappy.Encode(nil, rdata)
-	req, _ = http.NewRequest("POST", "/remote_read/test_plugin_prometheus", bytes.NewBuffer(compressedR))
-	req.RemoteAddr = "127.0.0.1:33333"
-	req.SetBasicAuth("root", "taosdata")
-	router.ServeHTTP(w, req)
+	doRead := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/remote_read/test_plugin_prometheus", bytes.NewBuffer(snappy.Encode(nil, rdata)))
+		req.RemoteAddr = "127.0.0.1:33333"
+		req.SetBasicAuth("root", "taosdata")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// restful row limit does not truncate series
+	config.Conf.RestfulRowLimit = 1
+	defer func() {
+		config.Conf.RestfulRowLimit = -1
+	}()
+	w = doRead()
 	assert.Equal(t, 202, w.Code)
 	buf, err := snappy.Decode(nil, w.Body.Bytes())
 	assert.NoError(t, err)
@@ -472,8 +479,162 @@ func TestPrometheusWithLimit(t *testing.T) {
 	assert.Equal(t, "testLimitK", labels[0].GetName())
 	assert.Equal(t, "testLimitV", labels[0].GetValue())
 	samples := series[0].GetSamples()
-	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, 2, len(samples))
 	assert.Equal(t, number, samples[0].GetValue())
 	assert.Equal(t, now, samples[0].GetTimestamp())
+
+	// exceeding the sample limit returns an error
+	p.conf.ReadMaxSamples = 1
+	w = doRead()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "exceeded sample limit")
+	p.conf.ReadMaxSamples = 0
+	p.conf.ReadMaxSeries = 1
+	w = doRead()
+	assert.Equal(t, 202, w.Code)
+}
+
+func TestPrometheusMetricSchema(t *testing.T) {
 	config.Conf.RestfulRowLimit = -1
+	viper.Set("prometheus.schema", SchemaMetric)
+	defer viper.Set("prometheus.schema", SchemaLegacy)
+	p := Plugin{}
+	router := gin.Default()
+	err := p.Init(router)
+	assert.NoError(t, err)
+	number := rand.Float64()
+	now := time.Now().UnixNano() / 1e6
+	doRequest := func(url string, m proto.Message) *httptest.ResponseRecorder {
+		data, err := proto.Marshal(m)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(snappy.Encode(nil, data)))
+		req.RemoteAddr = "127.0.0.1:33333"
+		req.SetBasicAuth("root", "taosdata")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	wReq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric_schema"}, {Name: "job", Value: "node"}},
+				Samples: []prompb.Sample{{Value: number, Timestamp: now}},
+			},
+		},
+	}
+	w := doRequest("/remote_write/test_plugin_prometheus", wReq)
+	assert.Equal(t, 202, w.Code)
+	// new label is added as tag
+	wReq.Timeseries[0].Labels = append(wReq.Timeseries[0].Labels, prompb.Label{Name: "instance", Value: "a"})
+	wReq.Timeseries[0].Samples[0].Timestamp = now + 1
+	w = doRequest("/remote_write/test_plugin_prometheus", wReq)
+	assert.Equal(t, 202, w.Code)
+
+	rReq := &prompb.ReadRequest{
+		Queries: []*prompb.Query{
+			{
+				StartTimestampMs: now,
+				EndTimestampMs:   now + 1,
+				Matchers: []*prompb.LabelMatcher{
+					{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "test_metric_schema"},
+					{Type: prompb.LabelMatcher_EQ, Name: "instance", Value: "a"},
+				},
+			},
+		},
+	}
+	w = doRequest("/remote_read/test_plugin_prometheus", rReq)
+	assert.Equal(t, 202, w.Code)
+	buf, err := snappy.Decode(nil, w.Body.Bytes())
+	assert.NoError(t, err)
+	var rr prompb.ReadResponse
+	err = proto.Unmarshal(buf, &rr)
+	assert.NoError(t, err)
+	result := rr.GetResults()
+	assert.Equal(t, 1, len(result))
+	series := result[0].GetTimeseries()
+	assert.Equal(t, 1, len(series))
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "test_metric_schema"}, {Name: "instance", Value: "a"}, {Name: "job", Value: "node"}}, series[0].GetLabels())
+	assert.Equal(t, []prompb.Sample{{Value: number, Timestamp: now + 1}}, series[0].GetSamples())
+}
+
+func TestPrometheusMetricSchemaNewDB(t *testing.T) {
+	viper.Set("prometheus.schema", SchemaMetric)
+	defer viper.Set("prometheus.schema", SchemaLegacy)
+	conn, err := wrapper.TaosConnect("", "root", "taosdata", "", 0)
+	assert.NoError(t, err)
+	defer wrapper.TaosClose(conn)
+	r := wrapper.TaosQuery(conn, "drop database if exists test_plugin_prometheus_new")
+	wrapper.TaosFreeResult(r)
+	defer func() {
+		r := wrapper.TaosQuery(conn, "drop database if exists test_plugin_prometheus_new")
+		wrapper.TaosFreeResult(r)
+	}()
+	p := Plugin{}
+	router := gin.Default()
+	err = p.Init(router)
+	assert.NoError(t, err)
+	wReq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric_new_db"}, {Name: "job", Value: "node"}},
+				Samples: []prompb.Sample{{Value: rand.Float64(), Timestamp: time.Now().UnixNano() / 1e6}},
+			},
+		},
+	}
+	data, err := proto.Marshal(wReq)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/remote_write/test_plugin_prometheus_new", bytes.NewBuffer(snappy.Encode(nil, data)))
+	req.RemoteAddr = "127.0.0.1:33333"
+	req.SetBasicAuth("root", "taosdata")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 202, w.Code, w.Body.String())
+	r = wrapper.TaosQuery(conn, "select * from test_plugin_prometheus_new.`test_metric_new_db`")
+	defer wrapper.TaosFreeResult(r)
+	assert.Equal(t, 0, wrapper.TaosError(r), wrapper.TaosErrorStr(r))
+}
+
+func TestPrometheusStreamedRead(t *testing.T) {
+	p := Plugin{}
+	router := gin.Default()
+	err := p.Init(router)
+	assert.NoError(t, err)
+	now := time.Now().UnixNano() / 1e6
+	doRequest := func(url string, m proto.Message) *httptest.ResponseRecorder {
+		data, err := proto.Marshal(m)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(snappy.Encode(nil, data)))
+		req.RemoteAddr = "127.0.0.1:33333"
+		req.SetBasicAuth("root", "taosdata")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	wReq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "testStreamK", Value: "testStreamV"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: now}, {Value: 2, Timestamp: now + 1}},
+			},
+		},
+	}
+	w := doRequest("/remote_write/test_plugin_prometheus", wReq)
+	assert.Equal(t, 202, w.Code)
+	rReq := &prompb.ReadRequest{
+		Queries: []*prompb.Query{
+			{
+				StartTimestampMs: now,
+				EndTimestampMs:   now + 1,
+				Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "testStreamK", Value: "testStreamV"}},
+			},
+		},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	}
+	w = doRequest("/remote_read/test_plugin_prometheus", rReq)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, StreamedContentType, w.Header().Get("Content-Type"))
+	frames := readFrames(t, w.Body.Bytes())
+	assert.Equal(t, 1, len(frames))
+	assert.Equal(t, []prompb.Label{{Name: "testStreamK", Value: "testStreamV"}}, frames[0].ChunkedSeries[0].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 1, Timestamp: now}, {Value: 2, Timestamp: now + 1}}, chunkSamples(t, frames[0].ChunkedSeries[0].Chunks))
 }
@@ -1,27 +1,28 @@
 package prometheus
 
 import (
+	"database/sql/driver"
+	"math"
+	"strconv"
 	"testing"
 
 	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
 	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/stmt"
 	prompbWrite "github.com/taosdata/taosadapter/v3/plugin/prometheus/proto/write"
-	"github.com/taosdata/taosadapter/v3/tools/pool"
 )
 
-// @author: xftan
-// @date: 2021/12/20 14:46
-// @description: test generate remote_write insert sql
-func Test_generateWriteSql(t *testing.T) {
-	config.Conf.RestfulRowLimit = -1
+func Test_generateWriteParams(t *testing.T) {
 	type args struct {
 		timeseries []prompbWrite.TimeSeries
-		ttl        int
+		precision  int
 	}
 	tests := []struct {
 		name string
 		args args
-		want string
+		want []*stmt.TaosStmt2BindData
 	}{
 		{
 			name: "general",
@@ -49,11 +50,21 @@ func Test_generateWriteSql(t *testing.T) {
 						},
 					},
 				},
+				precision: common.PrecisionMilliSecond,
+			},
+			want: []*stmt.TaosStmt2BindData{
+				{
+					TableName: "t_38afbaaeb3ee3f52623389a3af60f647",
+					Tags:      []driver.Value{`{"k1":"v1","k2":"v2"}`},
+					Cols: [][]driver.Value{
+						{int64(1639979902000), int64(1639979903000)},
+						{123.456, 456.789},
+					},
+				},
 			},
-			want: `insert into t_38afbaaeb3ee3f52623389a3af60f647 using metrics tags('{"k1":"v1","k2":"v2"}') values('2021-12-20T05:58:22Z',123.456) ('2021-12-20T05:58:23Z',456.789) `,
 		},
 		{
-			name: "escape",
+			name: "quote",
 			args: args{
 				timeseries: []prompbWrite.TimeSeries{
 					{
@@ -64,25 +75,32 @@ func Test_generateWriteSql(t *testing.T) {
 							},
 							{
 								Name:  []byte("k'1"),
-								Value: []byte("v'1"),
+								Value: []byte(`v\'1`),
 							},
 						},
 						Samples: []prompbWrite.Sample{
 							{
 								Value:     123.456,
 								Timestamp: 1639979902000,
-							}, {
-								Value:     456.789,
-								Timestamp: 1639979903000,
 							},
 						},
 					},
 				},
+				precision: common.PrecisionMilliSecond,
+			},
+			want: []*stmt.TaosStmt2BindData{
+				{
+					TableName: "t_501a56995967095ece5e7d39189eb265",
+					Tags:      []driver.Value{`{"k'1":"v\\'1","k'2":"v'2"}`},
+					Cols: [][]driver.Value{
+						{int64(1639979902000)},
+						{123.456},
+					},
+				},
 			},
-			want: `insert into t_98e95338dc63e470540a87386c1fea3f using metrics tags('{"k\'1":"v\'1","k\'2":"v\'2"}') values('2021-12-20T05:58:22Z',123.456) ('2021-12-20T05:58:23Z',456.789) `,
 		},
 		{
-			name: "prometheus",
+			name: "group by table",
 			args: args{
 				timeseries: []prompbWrite.TimeSeries{
 					{
@@ -110,93 +128,115 @@ func Test_generateWriteSql(t *testing.T) {
 						Labels: []prompbWrite.Label{
 							{
 								Name:  []byte("__name__"),
-								Value: []byte("prometheus_tsdb_compaction_duration_seconds_sum"),
+								Value: []byte("up"),
 							},
+						},
+						Samples: []prompbWrite.Sample{
 							{
-								Name:  []byte("instance"),
-								Value: []byte("localhost:9090"),
+								Value:     math.NaN(),
+								Timestamp: 1655859635940,
 							},
+						},
+					}, {
+						Labels: []prompbWrite.Label{
 							{
 								Name:  []byte("job"),
 								Value: []byte("prometheus"),
 							},
-						},
-						Samples: []prompbWrite.Sample{
 							{
-								Value:     0,
-								Timestamp: 1655859650940,
+								Name:  []byte("instance"),
+								Value: []byte("localhost:9090"),
 							},
-						},
-					},
-				},
-			},
-			want: `insert into t_3897c17b8513dad48cf4354bf8cb3e13 using metrics tags('{"__name__":"prometheus_tsdb_compaction_duration_seconds_sum","instance":"localhost:9090","job":"prometheus"}') values('2022-06-22T01:00:35.94Z',0) t_3897c17b8513dad48cf4354bf8cb3e13 using metrics tags('{"__name__":"prometheus_tsdb_compaction_duration_seconds_sum","instance":"localhost:9090","job":"prometheus"}') values('2022-06-22T01:00:50.94Z',0) `,
-		},
-		{
-			name: "escapeBackslash",
-			args: args{
-				timeseries: []prompbWrite.TimeSeries{
-					{
-						Labels: []prompbWrite.Label{
 							{
-								Name:  []byte(`key`),
-								Value: []byte(`k\'v`),
+								Name:  []byte("__name__"),
+								Value: []byte("prometheus_tsdb_compaction_duration_seconds_sum"),
 							},
 						},
 						Samples: []prompbWrite.Sample{
 							{
-								Value:     123.456,
-								Timestamp: 1639979902000,
-							}, {
-								Value:     456.789,
-								Timestamp: 1639979903000,
+								Value:     math.Inf(1),
+								Timestamp: 1655859650940,
 							},
 						},
 					},
 				},
+				precision: common.PrecisionMicroSecond,
 			},
-			want: `insert into t_376843ecdb3abb76454247aaf9bbe7b8 using metrics tags('{"key":"k\\\\\'v"}') values('2021-12-20T05:58:22Z',123.456) ('2021-12-20T05:58:23Z',456.789) `,
-		},
-		{
-			name: "escapeBackslashWithTTL",
-			args: args{
-				timeseries: []prompbWrite.TimeSeries{
-					{
-						Labels: []prompbWrite.Label{
-							{
-								Name:  []byte(`key`),
-								Value: []byte(`k\'v`),
-							},
-						},
-						Samples: []prompbWrite.Sample{
-							{
-								Value:     123.456,
-								Timestamp: 1639979902000,
-							}, {
-								Value:     456.789,
-								Timestamp: 1639979903000,
-							},
-						},
+			want: []*stmt.TaosStmt2BindData{
+				{
+					TableName: "t_3897c17b8513dad48cf4354bf8cb3e13",
+					Tags:      []driver.Value{`{"__name__":"prometheus_tsdb_compaction_duration_seconds_sum","instance":"localhost:9090","job":"prometheus"}`},
+					Cols: [][]driver.Value{
+						{int64(1655859635940000), int64(1655859650940000)},
+						{float64(0), nil},
+					},
+				},
+				{
+					TableName: "t_065f768e5aa52eef6beb846c383271c2",
+					Tags:      []driver.Value{`{"__name__":"up"}`},
+					Cols: [][]driver.Value{
+						{int64(1655859635940000)},
+						{nil},
 					},
 				},
-				ttl: 12,
 			},
-			want: `insert into t_376843ecdb3abb76454247aaf9bbe7b8 using metrics tags('{"key":"k\\\\\'v"}') ttl 12 values('2021-12-20T05:58:22Z',123.456) ('2021-12-20T05:58:23Z',456.789) `,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			bp := pool.BytesPoolGet()
-			defer pool.BytesPoolPut(bp)
-			generateWriteSql(tt.args.timeseries, bp, tt.args.ttl)
-			got := bp.String()
-			if got != tt.want {
-				t.Errorf("generateWriteSql() got = %v, want %v", got, tt.want)
-			}
+			got := generateWriteParams(tt.args.timeseries, tt.args.precision)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
 
+func Test_generateWriteStmtSql(t *testing.T) {
+	assert.Equal(t, "insert into ? using metrics tags(?) values(?,?)", generateWriteStmtSql(0))
+	assert.Equal(t, "insert into ? using metrics tags(?) ttl 12 values(?,?)", generateWriteStmtSql(12))
+}
+
+func Test_msToPrecision(t *testing.T) {
+	assert.Equal(t, int64(1639979902000), msToPrecision(1639979902000, common.PrecisionMilliSecond))
+	assert.Equal(t, int64(1639979902000000), msToPrecision(1639979902000, common.PrecisionMicroSecond))
+	assert.Equal(t, int64(1639979902000000000), msToPrecision(1639979902000, common.PrecisionNanoSecond))
+}
+
+func generateBenchmarkTimeseries(series, samples int) []prompbWrite.TimeSeries {
+	timeseries := make([]prompbWrite.TimeSeries, series)
+	for i := 0; i < series; i++ {
+		timeseries[i].Labels = []prompbWrite.Label{
+			{Name: []byte("__name__"), Value: []byte("node_cpu_seconds_total")},
+			{Name: []byte("instance"), Value: []byte("localhost:9100")},
+			{Name: []byte("job"), Value: []byte("node")},
+			{Name: []byte("cpu"), Value: []byte(strconv.Itoa(i))},
+		}
+		timeseries[i].Samples = make([]prompbWrite.Sample, samples)
+		for j := 0; j < samples; j++ {
+			timeseries[i].Samples[j] = prompbWrite.Sample{Value: float64(i*samples + j), Timestamp: 1639979902000 + int64(j)}
+		}
+	}
+	return timeseries
+}
+
+func BenchmarkGenerateWriteParams(b *testing.B) {
+	timeseries := generateBenchmarkTimeseries(1000, 10)
+	fields := []*stmt.Stmt2AllField{
+		{FieldType: common.TSDB_DATA_TYPE_BINARY, BindType: stmt.TAOS_FIELD_TBNAME},
+		{FieldType: common.TSDB_DATA_TYPE_JSON, BindType: stmt.TAOS_FIELD_TAG},
+		{FieldType: common.TSDB_DATA_TYPE_TIMESTAMP, Precision: common.PrecisionMilliSecond, BindType: stmt.TAOS_FIELD_COL},
+		{FieldType: common.TSDB_DATA_TYPE_DOUBLE, BindType: stmt.TAOS_FIELD_COL},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bindData := generateWriteParams(timeseries, common.PrecisionMilliSecond)
+		_, err := stmt.MarshalStmt2Binary(bindData, true, fields)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // @author: xftan
 // @date: 2021/12/20 14:46
 // @description: test generate remote_read query sql
@@ -264,65 +304,14 @@ func Test_generateReadSql(t *testing.T) {
 	}
 }
 
-// @author: xftan
-// @date: 2022/1/18 17:57
-// @description: test generate remote_read query sql with row limit
-func Test_generateReadSqlWithLimit(t *testing.T) {
-	type args struct {
-		query *prompb.Query
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    string
-		wantErr bool
-	}{
-		{
-			name: "general",
-			args: args{
-				query: &prompb.Query{
-					StartTimestampMs: 1639979902000,
-					EndTimestampMs:   1639979903000,
-					Matchers: []*prompb.LabelMatcher{
-						{
-							Type:  prompb.LabelMatcher_EQ,
-							Name:  "__name__",
-							Value: "point1",
-						},
-						{
-							Type:  prompb.LabelMatcher_NEQ,
-							Name:  "type",
-							Value: "info",
-						},
-						{
-							Type:  prompb.LabelMatcher_RE,
-							Name:  "server",
-							Value: "server-1$",
-						},
-						{
-							Type:  prompb.LabelMatcher_NRE,
-							Name:  "group",
-							Value: "group1.*",
-						},
-					},
-				},
-			},
-			want:    "select metrics.*,tbname from metrics where ts >= '2021-12-20T05:58:22Z' and ts <= '2021-12-20T05:58:23Z' and labels->'__name__' = 'point1' and labels->'type' != 'info' and labels->'server' match 'server-1$' and labels->'group' nmatch 'group1.*' limit 2",
-			wantErr: false,
+func Test_generateSeriesSql(t *testing.T) {
+	sql, err := generateSeriesSql(&prompb.Query{
+		StartTimestampMs: 1639979902000,
+		EndTimestampMs:   1639979903000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
 		},
-	}
-	for _, tt := range tests {
-		config.Conf.RestfulRowLimit = 2
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := generateReadSql(tt.args.query)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("generateReadSql() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("generateReadSql() got = %v, want %v", got, tt.want)
-			}
-		})
-		config.Conf.RestfulRowLimit = -1
-	}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "select last(ts),last(v),labels,tbname from metrics where ts >= '2021-12-20T05:58:22Z' and ts <= '2021-12-20T05:58:23Z' and labels->'__name__' = 'up' partition by tbname", sql)
 }
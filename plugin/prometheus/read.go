@@ -0,0 +1,434 @@
+package prometheus
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/config"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/syncinterface"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/driver/wrapper"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/tools/generator"
+)
+
+const (
+	// maxSamplesInChunk is the same as the prometheus tsdb
+	maxSamplesInChunk = 120
+	// maxBytesInFrame is the size a ChunkedReadResponse frame is flushed at
+	maxBytesInFrame = 1024 * 1024
+)
+
+// StreamedContentType is the content type of STREAMED_XOR_CHUNKS response
+const StreamedContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// labelParser returns the labels of a row, it is called once for each child table.
+type labelParser func(columns []string, row []driver.Value) ([]prompb.Label, error)
+
+// readLimiter counts the samples and series of one remote_read request.
+type readLimiter struct {
+	maxSamples int
+	maxSeries  int
+	samples    int
+	series     int
+}
+
+func newReadLimiter(conf *Config) *readLimiter {
+	return &readLimiter{maxSamples: conf.ReadMaxSamples, maxSeries: conf.ReadMaxSeries}
+}
+
+func (l *readLimiter) addSeries() error {
+	l.series += 1
+	if l.maxSeries > 0 && l.series > l.maxSeries {
+		return fmt.Errorf("exceeded series limit %d", l.maxSeries)
+	}
+	return nil
+}
+
+func (l *readLimiter) addSample() error {
+	l.samples += 1
+	if l.maxSamples > 0 && l.samples > l.maxSamples {
+		return fmt.Errorf("exceeded sample limit %d", l.maxSamples)
+	}
+	return nil
+}
+
+func legacyLabelParser(_ []string, row []driver.Value) ([]prompb.Label, error) {
+	data, ok := row[2].([]byte)
+	if !ok {
+		return nil, nil
+	}
+	var tags map[string]string
+	err := json.Unmarshal(data, &tags)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]prompb.Label, 0, len(tags))
+	for name, value := range tags {
+		labels = append(labels, prompb.Label{Name: name, Value: value})
+	}
+	sort.Slice(labels, func(a, b int) bool {
+		return labels[a].Name < labels[b].Name
+	})
+	return labels, nil
+}
+
+// prepareReadQuery returns the sql and label parser of a query, an empty sql means the query matches nothing. If series is
+// true the sql returns only the last sample of each timeseries.
+func prepareReadQuery(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, query *prompb.Query, conf *Config, series bool) (string, labelParser, error) {
+	if conf.Schema != SchemaMetric {
+		if series {
+			sql, err := generateSeriesSql(query)
+			return sql, legacyLabelParser, err
+		}
+		sql, err := generateReadSql(query)
+		return sql, legacyLabelParser, err
+	}
+	metric, err := metricName(query)
+	if err != nil {
+		return "", nil, err
+	}
+	tags, err := describeMetricTags(taosConn, logger, isDebug, reqID, metric)
+	if err != nil {
+		if tErr, is := err.(*tErrors.TaosError); is && tool.IsTableNotExist(tErr.Code) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	var sql string
+	if series {
+		sql, err = generateMetricSeriesSql(query, metric, tags)
+	} else {
+		sql, err = generateMetricReadSql(query, metric, tags)
+	}
+	return sql, metricLabelParser(metric), err
+}
+
+func timestampToMs(ts int64, precision int) driver.Value {
+	switch precision {
+	case common.PrecisionMilliSecond:
+		return ts
+	case common.PrecisionMicroSecond:
+		return ts / 1e3
+	case common.PrecisionNanoSecond:
+		return ts / 1e6
+	default:
+		return 0
+	}
+}
+
+// queryRows executes the sql and fetches the result block by block. The columns are ts, v, labels and tbname, labels
+// of each child table are parsed once and cached by tbname.
+func queryRows(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, sql string, parse labelParser, cache map[string][]prompb.Label, onRow func(tbName string, labels []prompb.Label, ts int64, value float64) error) error {
+	handler := async.GlobalAsync.HandlerPool.Get()
+	defer async.GlobalAsync.HandlerPool.Put(handler)
+	logger.Tracef("execute sql: %s", sql)
+	result := async.GlobalAsync.TaosQuery(taosConn, logger, isDebug, sql, handler, reqID)
+	res := result.Res
+	defer func() {
+		if res != nil {
+			async.FreeResultAsync(res, logger, isDebug)
+		}
+	}()
+	code := wrapper.TaosError(res)
+	if code != httperror.SUCCESS {
+		errStr := wrapper.TaosErrorStr(res)
+		logger.Errorf("query error, code:%d, msg:%s, sql:%s", code, errStr, sql)
+		return tErrors.NewError(code, errStr)
+	}
+	fieldsCount := wrapper.TaosNumFields(res)
+	rowsHeader, err := wrapper.ReadColumn(res, fieldsCount)
+	if err != nil {
+		return err
+	}
+	if fieldsCount < 4 {
+		return fmt.Errorf("unexpected column count %d", fieldsCount)
+	}
+	precision := wrapper.TaosResultPrecision(res)
+	tbNameIndex := fieldsCount - 1
+	for {
+		s := log.GetLogNow(isDebug)
+		result = async.GlobalAsync.TaosFetchRawBlockA(res, logger, isDebug, handler)
+		logger.Debugf("fetch raw block, n:%d, cost:%s", result.N, log.GetLogDuration(isDebug, s))
+		if result.N == 0 {
+			return nil
+		}
+		if result.N < 0 {
+			errStr := wrapper.TaosErrorStr(result.Res)
+			logger.Errorf("fetch raw block error, code:%d, msg:%s", result.N&0xffff, errStr)
+			return tErrors.NewError(result.N&0xffff, errStr)
+		}
+		res = result.Res
+		block := wrapper.TaosGetRawBlock(res)
+		rows := parser.ReadBlockWithTimeFormat(block, result.N, rowsHeader.ColTypes, precision, timestampToMs)
+		for _, row := range rows {
+			if row[0] == nil || row[1] == nil || row[tbNameIndex] == nil {
+				continue
+			}
+			tbName := row[tbNameIndex].(string)
+			labels, exist := cache[tbName]
+			if !exist {
+				labels, err = parse(rowsHeader.ColNames, row)
+				if err != nil {
+					return err
+				}
+				cache[tbName] = labels
+			}
+			err = onRow(tbName, labels, row[0].(int64), row[1].(float64))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func processRead(taosConn unsafe.Pointer, req *prompb.ReadRequest, db string, conf *Config) (*prompb.ReadResponse, error) {
+	isDebug := log.IsDebug()
+	reqID := generator.GetReqID()
+	logger := logger.WithField(config.ReqIDKey, reqID)
+	logger.Tracef("select db %s", db)
+	code := syncinterface.TaosSelectDB(taosConn, db, logger, isDebug)
+	if code != 0 {
+		return nil, tErrors.NewError(code, wrapper.TaosErrorStr(nil))
+	}
+	conf, err := databaseConfig(taosConn, logger, isDebug, reqID, db, conf)
+	if err != nil {
+		return nil, err
+	}
+	limiter := newReadLimiter(conf)
+	resp := &prompb.ReadResponse{Results: make([]*prompb.QueryResult, len(req.Queries))}
+	for i, query := range req.Queries {
+		timeseries, err := readTimeseries(taosConn, logger, isDebug, reqID, query, conf, limiter, false)
+		if err != nil {
+			return nil, err
+		}
+		resp.Results[i] = &prompb.QueryResult{Timeseries: timeseries}
+	}
+	return resp, nil
+}
+
+// readTimeseries returns the timeseries matching the query, if series is true the timeseries have no samples.
+func readTimeseries(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, query *prompb.Query, conf *Config, limiter *readLimiter, series bool) ([]*prompb.TimeSeries, error) {
+	start := log.GetLogNow(isDebug)
+	sql, parse, err := prepareReadQuery(taosConn, logger, isDebug, reqID, query, conf, series)
+	logger.Debug("read prepare query cost:", log.GetLogDuration(isDebug, start))
+	if err != nil {
+		return nil, err
+	}
+	if len(sql) == 0 {
+		return nil, nil
+	}
+	start = time.Now()
+	var result []*prompb.TimeSeries
+	group := map[string]*prompb.TimeSeries{}
+	cache := map[string][]prompb.Label{}
+	err = queryRows(taosConn, logger, isDebug, reqID, sql, parse, cache, func(tbName string, labels []prompb.Label, ts int64, value float64) error {
+		timeSeries, exist := group[tbName]
+		if !exist {
+			if err := limiter.addSeries(); err != nil {
+				return err
+			}
+			timeSeries = &prompb.TimeSeries{Labels: labels}
+			group[tbName] = timeSeries
+			result = append(result, timeSeries)
+		}
+		if series {
+			return nil
+		}
+		if err := limiter.addSample(); err != nil {
+			return err
+		}
+		timeSeries.Samples = append(timeSeries.Samples, prompb.Sample{Value: value, Timestamp: ts})
+		return nil
+	})
+	logger.Debug("read query cost:", time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// chunkedWriter writes delimited frames in the format of the prometheus remote read streaming:
+// uvarint length, big-endian crc32 castagnoli checksum and the data.
+type chunkedWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+	frames  int
+}
+
+func (w *chunkedWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	var buf [binary.MaxVarintLen64 + 4]byte
+	n := binary.PutUvarint(buf[:], uint64(len(b)))
+	binary.BigEndian.PutUint32(buf[n:], crc32.Checksum(b, castagnoliTable))
+	if _, err := w.writer.Write(buf[:n+4]); err != nil {
+		return 0, err
+	}
+	written, err := w.writer.Write(b)
+	if err != nil {
+		return written, err
+	}
+	w.frames += 1
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return written, nil
+}
+
+// seriesChunker encodes the samples of one series at a time into xor chunks and writes them as ChunkedReadResponse frames.
+type seriesChunker struct {
+	writer     io.Writer
+	queryIndex int64
+	tbName     string
+	labels     []prompb.Label
+	chunks     []prompb.Chunk
+	frameBytes int
+	chunk      *chunkenc.XORChunk
+	appender   chunkenc.Appender
+	minTime    int64
+	maxTime    int64
+}
+
+func (c *seriesChunker) add(tbName string, labels []prompb.Label, ts int64, value float64) (newSeries bool, err error) {
+	if c.labels == nil || tbName != c.tbName {
+		if err = c.flush(); err != nil {
+			return false, err
+		}
+		c.tbName = tbName
+		c.labels = labels
+		newSeries = true
+	}
+	if c.chunk != nil && (c.chunk.NumSamples() >= maxSamplesInChunk || ts < c.maxTime) {
+		// samples in a chunk are in time order, chunks may overlap
+		c.cutChunk()
+		if c.frameBytes >= maxBytesInFrame {
+			if err = c.writeFrame(); err != nil {
+				return newSeries, err
+			}
+		}
+	}
+	if c.chunk == nil {
+		c.chunk = chunkenc.NewXORChunk()
+		c.appender, err = c.chunk.Appender()
+		if err != nil {
+			return newSeries, err
+		}
+		c.minTime = ts
+	}
+	c.appender.Append(ts, value)
+	c.maxTime = ts
+	return newSeries, nil
+}
+
+func (c *seriesChunker) cutChunk() {
+	if c.chunk == nil {
+		return
+	}
+	data := c.chunk.Bytes()
+	c.chunks = append(c.chunks, prompb.Chunk{
+		MinTimeMs: c.minTime,
+		MaxTimeMs: c.maxTime,
+		Type:      prompb.Chunk_XOR,
+		Data:      data,
+	})
+	c.frameBytes += len(data)
+	c.chunk = nil
+	c.appender = nil
+}
+
+func (c *seriesChunker) writeFrame() error {
+	if len(c.chunks) == 0 {
+		return nil
+	}
+	resp := &prompb.ChunkedReadResponse{
+		ChunkedSeries: []*prompb.ChunkedSeries{{Labels: c.labels, Chunks: c.chunks}},
+		QueryIndex:    c.queryIndex,
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		return err
+	}
+	c.chunks = nil
+	c.frameBytes = 0
+	_, err = c.writer.Write(data)
+	return err
+}
+
+// flush writes the current series.
+func (c *seriesChunker) flush() error {
+	c.cutChunk()
+	return c.writeFrame()
+}
+
+// processStreamedRead writes the STREAMED_XOR_CHUNKS response, the result is fetched block by block and each series is
+// written once all its samples are encoded.
+func processStreamedRead(taosConn unsafe.Pointer, req *prompb.ReadRequest, db string, conf *Config, w io.Writer) error {
+	isDebug := log.IsDebug()
+	reqID := generator.GetReqID()
+	logger := logger.WithField(config.ReqIDKey, reqID)
+	logger.Tracef("select db %s", db)
+	code := syncinterface.TaosSelectDB(taosConn, db, logger, isDebug)
+	if code != 0 {
+		return tErrors.NewError(code, wrapper.TaosErrorStr(nil))
+	}
+	conf, err := databaseConfig(taosConn, logger, isDebug, reqID, db, conf)
+	if err != nil {
+		return err
+	}
+	limiter := newReadLimiter(conf)
+	for i, query := range req.Queries {
+		sql, parse, err := prepareReadQuery(taosConn, logger, isDebug, reqID, query, conf, false)
+		if err != nil {
+			return err
+		}
+		if len(sql) == 0 {
+			continue
+		}
+		// rows of each child table are returned together
+		sql += " partition by tbname"
+		start := time.Now()
+		chunker := &seriesChunker{writer: w, queryIndex: int64(i)}
+		cache := map[string][]prompb.Label{}
+		err = queryRows(taosConn, logger, isDebug, reqID, sql, parse, cache, func(tbName string, labels []prompb.Label, ts int64, value float64) error {
+			if err := limiter.addSample(); err != nil {
+				return err
+			}
+			newSeries, err := chunker.add(tbName, labels, ts, value)
+			if err != nil {
+				return err
+			}
+			if newSeries {
+				return limiter.addSeries()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = chunker.flush(); err != nil {
+			return err
+		}
+		logger.Debug("processStreamedRead query cost:", time.Since(start))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLimiter(t *testing.T) {
+	limiter := newReadLimiter(&Config{ReadMaxSamples: 2, ReadMaxSeries: 1})
+	assert.NoError(t, limiter.addSeries())
+	assert.Error(t, limiter.addSeries())
+	assert.NoError(t, limiter.addSample())
+	assert.NoError(t, limiter.addSample())
+	assert.EqualError(t, limiter.addSample(), "exceeded sample limit 2")
+
+	limiter = newReadLimiter(&Config{})
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, limiter.addSeries())
+		assert.NoError(t, limiter.addSample())
+	}
+}
+
+func TestLegacyLabelParser(t *testing.T) {
+	labels, err := legacyLabelParser(nil, []driver.Value{int64(1), float64(1), []byte(`{"job":"node","__name__":"up"}`), "t_1"})
+	require.NoError(t, err)
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "node"}}, labels)
+	_, err = legacyLabelParser(nil, []driver.Value{int64(1), float64(1), []byte(`{`), "t_1"})
+	assert.Error(t, err)
+}
+
+func TestNegotiateResponseType(t *testing.T) {
+	assert.Equal(t, prompb.ReadRequest_SAMPLES, negotiateResponseType(nil))
+	assert.Equal(t, prompb.ReadRequest_STREAMED_XOR_CHUNKS, negotiateResponseType([]prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES}))
+	assert.Equal(t, prompb.ReadRequest_SAMPLES, negotiateResponseType([]prompb.ReadRequest_ResponseType{prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS}))
+}
+
+func readFrames(t *testing.T, data []byte) []*prompb.ChunkedReadResponse {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var result []*prompb.ChunkedReadResponse
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		var checksum uint32
+		require.NoError(t, binary.Read(reader, binary.BigEndian, &checksum))
+		frame := make([]byte, size)
+		_, err = io.ReadFull(reader, frame)
+		require.NoError(t, err)
+		require.Equal(t, crc32.Checksum(frame, castagnoliTable), checksum)
+		resp := &prompb.ChunkedReadResponse{}
+		require.NoError(t, resp.Unmarshal(frame))
+		result = append(result, resp)
+	}
+}
+
+func chunkSamples(t *testing.T, chunks []prompb.Chunk) []prompb.Sample {
+	var samples []prompb.Sample
+	for _, chunk := range chunks {
+		c, err := chunkenc.FromData(chunkenc.EncXOR, chunk.Data)
+		require.NoError(t, err)
+		it := c.Iterator(nil)
+		for it.Next() {
+			ts, v := it.At()
+			assert.True(t, ts >= chunk.MinTimeMs && ts <= chunk.MaxTimeMs)
+			samples = append(samples, prompb.Sample{Timestamp: ts, Value: v})
+		}
+		require.NoError(t, it.Err())
+	}
+	return samples
+}
+
+func TestSeriesChunker(t *testing.T) {
+	var buf bytes.Buffer
+	w := &chunkedWriter{writer: &buf}
+	chunker := &seriesChunker{writer: w, queryIndex: 1}
+	labels1 := []prompb.Label{{Name: "k", Value: "1"}}
+	labels2 := []prompb.Label{{Name: "k", Value: "2"}}
+	var want1 []prompb.Sample
+	for i := 0; i < 250; i++ {
+		newSeries, err := chunker.add("t_1", labels1, int64(i), float64(i))
+		require.NoError(t, err)
+		assert.Equal(t, i == 0, newSeries)
+		want1 = append(want1, prompb.Sample{Timestamp: int64(i), Value: float64(i)})
+	}
+	// out of order sample starts a new chunk
+	newSeries, err := chunker.add("t_2", labels2, 10, 1)
+	require.NoError(t, err)
+	assert.True(t, newSeries)
+	_, err = chunker.add("t_2", labels2, 5, 2)
+	require.NoError(t, err)
+	require.NoError(t, chunker.flush())
+	require.NoError(t, chunker.flush())
+	assert.Equal(t, 2, w.frames)
+
+	frames := readFrames(t, buf.Bytes())
+	require.Equal(t, 2, len(frames))
+	assert.Equal(t, int64(1), frames[0].QueryIndex)
+	require.Equal(t, 1, len(frames[0].ChunkedSeries))
+	assert.Equal(t, labels1, frames[0].ChunkedSeries[0].Labels)
+	assert.Equal(t, 3, len(frames[0].ChunkedSeries[0].Chunks))
+	assert.Equal(t, want1, chunkSamples(t, frames[0].ChunkedSeries[0].Chunks))
+	assert.Equal(t, labels2, frames[1].ChunkedSeries[0].Labels)
+	assert.Equal(t, 2, len(frames[1].ChunkedSeries[0].Chunks))
+	assert.Equal(t, []prompb.Sample{{Timestamp: 10, Value: 1}, {Timestamp: 5, Value: 2}}, chunkSamples(t, frames[1].ChunkedSeries[0].Chunks))
+}
@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"database/sql/driver"
+	"time"
+	"unsafe"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/async"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/tools"
+)
+
+// schemaCache caches the storage schema of each database, the schema of a database only changes when it is recreated.
+var schemaCache = cache.New(10*time.Minute, 20*time.Minute)
+
+// databaseConfig returns the config with the storage schema of the database. A database that already has the legacy
+// metrics supertable keeps the legacy schema, other databases use the configured schema.
+func databaseConfig(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, db string, conf *Config) (*Config, error) {
+	if conf.Schema == SchemaLegacy {
+		return conf, nil
+	}
+	schema, exist := schemaCache.Get(db)
+	if !exist {
+		legacy, dbExist, err := hasLegacyStable(taosConn, logger, isDebug, reqID, db)
+		if err != nil {
+			return nil, err
+		}
+		schema = conf.Schema
+		if legacy {
+			schema = SchemaLegacy
+		}
+		// a database that does not exist yet is created by the write, it is checked again by the next request
+		if dbExist {
+			schemaCache.SetDefault(db, schema)
+		}
+	}
+	if schema == conf.Schema {
+		return conf, nil
+	}
+	dbConf := *conf
+	dbConf.Schema = schema.(string)
+	return &dbConf, nil
+}
+
+// hasLegacyStable reports whether the database has the legacy metrics supertable and whether the database exists.
+func hasLegacyStable(taosConn unsafe.Pointer, logger *logrus.Entry, isDebug bool, reqID int64, db string) (legacy bool, dbExist bool, err error) {
+	name, err := tools.QuoteIdentifier(db)
+	if err != nil {
+		return false, false, err
+	}
+	data, err := async.GlobalAsync.TaosExec(taosConn, logger, isDebug, "describe "+name+".`metrics`", func(ts int64, precision int) driver.Value {
+		return ts
+	}, reqID)
+	if err != nil {
+		if tErr, is := err.(*tErrors.TaosError); is {
+			if tErr.Code == httperror.TSDB_CODE_MND_DB_NOT_EXIST {
+				return false, false, nil
+			}
+			if tool.IsTableNotExist(tErr.Code) {
+				return false, true, nil
+			}
+		}
+		return false, false, err
+	}
+	return isLegacyStable(data.Data), true, nil
+}
+
+// isLegacyStable reports whether the describe result is the legacy metrics supertable, a metric named metrics in the
+// metric schema has no json labels tag.
+func isLegacyStable(rows [][]driver.Value) bool {
+	// field type length note
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		name, _ := row[0].(string)
+		fieldType, _ := row[1].(string)
+		note, _ := row[3].(string)
+		if name == "labels" && fieldType == "JSON" && note == "TAG" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLegacyStable(t *testing.T) {
+	legacy := [][]driver.Value{
+		{"ts", "TIMESTAMP", int32(8), ""},
+		{"v", "DOUBLE", int32(8), ""},
+		{"labels", "JSON", int32(4095), "TAG"},
+	}
+	assert.True(t, isLegacyStable(legacy))
+	// a metric named metrics in the metric schema
+	metric := [][]driver.Value{
+		{"ts", "TIMESTAMP", int32(8), ""},
+		{"v", "DOUBLE", int32(8), ""},
+		{"labels", "VARCHAR", int32(256), "TAG"},
+		{"job", "VARCHAR", int32(256), "TAG"},
+	}
+	assert.False(t, isLegacyStable(metric))
+	assert.False(t, isLegacyStable(nil))
+}
+
+func TestDatabaseConfig(t *testing.T) {
+	conf := &Config{Schema: SchemaLegacy}
+	dbConf, err := databaseConfig(nil, logger, false, 0, "test_schema_legacy", conf)
+	assert.NoError(t, err)
+	assert.Same(t, conf, dbConf)
+
+	conf = &Config{Schema: SchemaMetric, TagType: TagTypeNchar, TagLength: 64}
+	schemaCache.SetDefault("test_schema_old", SchemaLegacy)
+	schemaCache.SetDefault("test_schema_new", SchemaMetric)
+	defer schemaCache.Delete("test_schema_old")
+	defer schemaCache.Delete("test_schema_new")
+	dbConf, err = databaseConfig(nil, logger, false, 0, "test_schema_old", conf)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Schema: SchemaLegacy, TagType: TagTypeNchar, TagLength: 64}, *dbConf)
+	assert.Equal(t, SchemaMetric, conf.Schema)
+	dbConf, err = databaseConfig(nil, logger, false, 0, "test_schema_new", conf)
+	assert.NoError(t, err)
+	assert.Same(t, conf, dbConf)
+}
@@ -0,0 +1,65 @@
+package spool
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/taosdata/taosadapter/v3/version"
+)
+
+type Config struct {
+	Enable         bool
+	Path           string
+	SegmentSize    int64
+	MaxSize        int64
+	MaxAge         time.Duration
+	ReplayInterval time.Duration
+}
+
+func (c *Config) setValue() {
+	c.Enable = viper.GetBool("spool.enable")
+	c.Path = viper.GetString("spool.path")
+	c.SegmentSize = int64(viper.GetSizeInBytes("spool.segmentSize"))
+	c.MaxSize = int64(viper.GetSizeInBytes("spool.maxSize"))
+	c.MaxAge = viper.GetDuration("spool.maxAge")
+	c.ReplayInterval = viper.GetDuration("spool.replayInterval")
+	if c.ReplayInterval <= 0 {
+		c.ReplayInterval = time.Second * 5
+	}
+}
+
+func init() {
+	_ = viper.BindEnv("spool.enable", "TAOS_ADAPTER_SPOOL_ENABLE")
+	pflag.Bool("spool.enable", false, `enable spooling the data of collectd, statsd, opentsdb_telnet, node_exporter and graphite to disk when TDengine is unavailable. Env "TAOS_ADAPTER_SPOOL_ENABLE"`)
+	viper.SetDefault("spool.enable", false)
+
+	var defaultPath string
+	switch runtime.GOOS {
+	case "windows":
+		defaultPath = fmt.Sprintf("C:\\%s\\spool", version.CUS_NAME)
+	default:
+		defaultPath = fmt.Sprintf("/var/lib/%s/%sadapter/spool", version.CUS_PROMPT, version.CUS_PROMPT)
+	}
+	_ = viper.BindEnv("spool.path", "TAOS_ADAPTER_SPOOL_PATH")
+	pflag.String("spool.path", defaultPath, `spool path, each plugin uses a sub directory. Env "TAOS_ADAPTER_SPOOL_PATH"`)
+	viper.SetDefault("spool.path", defaultPath)
+
+	_ = viper.BindEnv("spool.segmentSize", "TAOS_ADAPTER_SPOOL_SEGMENT_SIZE")
+	pflag.String("spool.segmentSize", "64MB", `spool segment file size (KB MB GB). Env "TAOS_ADAPTER_SPOOL_SEGMENT_SIZE"`)
+	viper.SetDefault("spool.segmentSize", "64MB")
+
+	_ = viper.BindEnv("spool.maxSize", "TAOS_ADAPTER_SPOOL_MAX_SIZE")
+	pflag.String("spool.maxSize", "1GB", `spool max size of each plugin (KB MB GB), the oldest segments are dropped when exceeded. Env "TAOS_ADAPTER_SPOOL_MAX_SIZE"`)
+	viper.SetDefault("spool.maxSize", "1GB")
+
+	_ = viper.BindEnv("spool.maxAge", "TAOS_ADAPTER_SPOOL_MAX_AGE")
+	pflag.Duration("spool.maxAge", time.Hour*24, `spool max age (0s means not valid), the older segments are dropped. Env "TAOS_ADAPTER_SPOOL_MAX_AGE"`)
+	viper.SetDefault("spool.maxAge", time.Hour*24)
+
+	_ = viper.BindEnv("spool.replayInterval", "TAOS_ADAPTER_SPOOL_REPLAY_INTERVAL")
+	pflag.Duration("spool.replayInterval", time.Second*5, `spool replay interval. Env "TAOS_ADAPTER_SPOOL_REPLAY_INTERVAL"`)
+	viper.SetDefault("spool.replayInterval", time.Second*5)
+}
@@ -0,0 +1,580 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/taosdata/taosadapter/v3/db/tool"
+	"github.com/taosdata/taosadapter/v3/log"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "spool")
+
+var (
+	depthBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "spool_depth_bytes",
+			Help:      "Bytes of the records in the spool waiting for replay",
+		},
+		[]string{"plugin"},
+	)
+	depthRecords = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "spool_depth_records",
+			Help:      "Number of the records in the spool waiting for replay",
+		},
+		[]string{"plugin"},
+	)
+	replayLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "spool_replay_lag_seconds",
+			Help:      "Age of the oldest record in the spool waiting for replay",
+		},
+		[]string{"plugin"},
+	)
+	replayedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "spool_replayed_records_total",
+			Help:      "Number of the records replayed from the spool",
+		},
+		[]string{"plugin"},
+	)
+	droppedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "taosadapter",
+			Subsystem: "plugin",
+			Name:      "spool_dropped_records_total",
+			Help:      "Number of the records dropped from the spool because of the size or age limit or a data error",
+		},
+		[]string{"plugin"},
+	)
+)
+
+const (
+	segmentExt     = ".seg"
+	checkpointFile = "checkpoint"
+	headerSize     = 8
+)
+
+var errCorrupted = errors.New("corrupted record")
+
+// Record is a payload spooled by a plugin.
+type Record struct {
+	DB       string
+	ClientIP net.IP
+	Data     []byte
+	// Time is the time the record is appended
+	Time time.Time
+}
+
+type segment struct {
+	id      uint64
+	path    string
+	size    int64
+	records int
+	modTime time.Time
+}
+
+// Spool is a FIFO of records stored in segment files. Records are appended to the last segment, and replayed from
+// the first one. A segment is removed after all its records are replayed, the replay position is saved in the
+// checkpoint file so the replayed records are not replayed again after restart.
+type Spool struct {
+	name      string
+	dir       string
+	conf      *Config
+	retryable func(err error) bool
+
+	lock       sync.Mutex
+	segments   []*segment
+	active     *os.File
+	readOffset int64
+
+	replayLock sync.Mutex
+	reader     *os.File
+	readerID   uint64
+	checkpoint *os.File
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	wg        sync.WaitGroup
+
+	depthBytes   prometheus.Gauge
+	depthRecords prometheus.Gauge
+	replayLag    prometheus.Gauge
+	replayed     prometheus.Counter
+	dropped      prometheus.Counter
+}
+
+// New returns the spool of the plugin, or nil if the spool is disabled.
+func New(name string) (*Spool, error) {
+	conf := &Config{}
+	conf.setValue()
+	if !conf.Enable {
+		return nil, nil
+	}
+	return Open(name, filepath.Join(conf.Path, name), conf)
+}
+
+// Open opens the spool in dir, a new segment is created to append records.
+func Open(name string, dir string, conf *Config) (*Spool, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		name:         name,
+		dir:          dir,
+		conf:         conf,
+		retryable:    Retryable,
+		closeChan:    make(chan struct{}),
+		depthBytes:   depthBytes.WithLabelValues(name),
+		depthRecords: depthRecords.WithLabelValues(name),
+		replayLag:    replayLag.WithLabelValues(name),
+		replayed:     replayedTotal.WithLabelValues(name),
+		dropped:      droppedTotal.WithLabelValues(name),
+	}
+	if err = s.load(); err != nil {
+		return nil, err
+	}
+	var nextID uint64 = 1
+	if len(s.segments) > 0 {
+		nextID = s.segments[len(s.segments)-1].id + 1
+	}
+	if err = s.newSegment(nextID); err != nil {
+		return nil, err
+	}
+	s.checkpoint, err = os.OpenFile(filepath.Join(dir, checkpointFile), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		_ = s.closeActive()
+		return nil, err
+	}
+	s.updateDepth()
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, &segment{id: id, path: filepath.Join(s.dir, entry.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+	checkpointID, checkpointOffset := s.readCheckpoint()
+	for len(s.segments) > 0 && s.segments[0].id < checkpointID {
+		s.removeFirst()
+	}
+	if len(s.segments) > 0 && s.segments[0].id == checkpointID {
+		s.readOffset = checkpointOffset
+	}
+	for i, seg := range s.segments {
+		offset := int64(0)
+		if i == 0 {
+			offset = s.readOffset
+		}
+		records, size, err := countRecords(seg.path, offset)
+		if err != nil {
+			logger.WithError(err).Warnf("segment %s is truncated at %d", seg.path, size)
+		}
+		seg.records = records
+		seg.size = size
+	}
+	return nil
+}
+
+func (s *Spool) readCheckpoint() (uint64, int64) {
+	b, err := os.ReadFile(filepath.Join(s.dir, checkpointFile))
+	if err != nil {
+		return 0, 0
+	}
+	var id uint64
+	var offset int64
+	if _, err = fmt.Sscanf(string(b), "%d %d", &id, &offset); err != nil {
+		logger.WithError(err).Warn("invalid spool checkpoint")
+		return 0, 0
+	}
+	return id, offset
+}
+
+// writeCheckpoint overwrites the checkpoint in place, the fixed width keeps the file size unchanged.
+func (s *Spool) writeCheckpoint(id uint64, offset int64) error {
+	_, err := s.checkpoint.WriteAt([]byte(fmt.Sprintf("%020d %020d\n", id, offset)), 0)
+	return err
+}
+
+// countRecords counts the records of the segment from offset, it returns the size of the valid records.
+func countRecords(path string, offset int64) (int, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, offset, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, offset, err
+	}
+	records := 0
+	for {
+		_, n, err := readRecord(f)
+		if err == io.EOF {
+			return records, offset, nil
+		}
+		if err != nil {
+			return records, offset, err
+		}
+		records += 1
+		offset += n
+	}
+}
+
+func encodeRecord(r *Record) []byte {
+	b := make([]byte, headerSize+8+1+len(r.ClientIP)+2+len(r.DB)+len(r.Data))
+	body := b[headerSize:]
+	binary.LittleEndian.PutUint64(body, uint64(r.Time.UnixNano()))
+	body[8] = byte(len(r.ClientIP))
+	copy(body[9:], r.ClientIP)
+	binary.LittleEndian.PutUint16(body[9+len(r.ClientIP):], uint16(len(r.DB)))
+	copy(body[11+len(r.ClientIP):], r.DB)
+	copy(body[11+len(r.ClientIP)+len(r.DB):], r.Data)
+	binary.LittleEndian.PutUint32(b, uint32(len(body)))
+	binary.LittleEndian.PutUint32(b[4:], crc32.ChecksumIEEE(body))
+	return b
+}
+
+// readRecord reads a record and returns the bytes read, io.EOF is returned at the end of the segment.
+func readRecord(reader io.Reader) (*Record, int64, error) {
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(reader, header)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, int64(n), errCorrupted
+	}
+	size := headerSize + int64(binary.LittleEndian.Uint32(header))
+	body := make([]byte, size-headerSize)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return nil, 0, errCorrupted
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, 0, errCorrupted
+	}
+	r := &Record{}
+	if len(body) < 11 {
+		return nil, 0, errCorrupted
+	}
+	r.Time = time.Unix(0, int64(binary.LittleEndian.Uint64(body)))
+	body = body[8:]
+	ipLen := int(body[0])
+	if len(body) < 1+ipLen+2 {
+		return nil, 0, errCorrupted
+	}
+	if ipLen > 0 {
+		r.ClientIP = net.IP(body[1 : 1+ipLen])
+	}
+	body = body[1+ipLen:]
+	dbLen := int(binary.LittleEndian.Uint16(body))
+	if len(body) < 2+dbLen {
+		return nil, 0, errCorrupted
+	}
+	r.DB = string(body[2 : 2+dbLen])
+	r.Data = body[2+dbLen:]
+	return r, size, nil
+}
+
+func (s *Spool) newSegment(id uint64) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.active = f
+	s.segments = append(s.segments, &segment{id: id, path: path, modTime: time.Now()})
+	return nil
+}
+
+func (s *Spool) closeActive() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Sync()
+	closeErr := s.active.Close()
+	s.active = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (s *Spool) rotate() error {
+	if err := s.closeActive(); err != nil {
+		return err
+	}
+	return s.newSegment(s.segments[len(s.segments)-1].id + 1)
+}
+
+// removeFirst removes the first segment, the records not replayed are dropped.
+func (s *Spool) removeFirst() {
+	seg := s.segments[0]
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).Errorf("remove spool segment %s error", seg.path)
+	}
+	s.segments = s.segments[1:]
+	s.readOffset = 0
+}
+
+// enforceLimits drops the oldest segments when the spool exceeds the max size or the max age.
+func (s *Spool) enforceLimits() {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	total -= s.readOffset
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		tooLarge := s.conf.MaxSize > 0 && total > s.conf.MaxSize
+		tooOld := s.conf.MaxAge > 0 && time.Since(seg.modTime) > s.conf.MaxAge
+		if !tooLarge && !tooOld {
+			break
+		}
+		if seg.records > 0 {
+			logger.Warnf("drop %d records of spool segment %s", seg.records, seg.path)
+			s.dropped.Add(float64(seg.records))
+		}
+		total -= seg.size - s.readOffset
+		s.removeFirst()
+	}
+}
+
+func (s *Spool) updateDepth() {
+	var size int64
+	var records int
+	for _, seg := range s.segments {
+		size += seg.size
+		records += seg.records
+	}
+	s.depthBytes.Set(float64(size - s.readOffset))
+	s.depthRecords.Set(float64(records))
+	if records == 0 {
+		s.replayLag.Set(0)
+	}
+}
+
+// Append appends the record to the spool. The record is written to the page cache, the segment is synced to disk
+// when it is rotated or the spool is closed.
+func (s *Spool) Append(r *Record) error {
+	r.Time = time.Now()
+	b := encodeRecord(r)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.active == nil {
+		return errors.New("spool closed")
+	}
+	last := s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+int64(len(b)) > s.conf.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		last = s.segments[len(s.segments)-1]
+	}
+	if _, err := s.active.Write(b); err != nil {
+		return err
+	}
+	last.size += int64(len(b))
+	last.records += 1
+	last.modTime = r.Time
+	s.enforceLimits()
+	s.updateDepth()
+	return nil
+}
+
+// AppendFailed appends the record whose write failed with err if err is retryable. It does nothing if s is nil, so
+// the plugins can call it whether the spool is enabled or not.
+func (s *Spool) AppendFailed(r *Record, err error) {
+	if s == nil || err == nil || !s.retryable(err) {
+		return
+	}
+	if appendErr := s.Append(r); appendErr != nil {
+		logger.WithError(appendErr).Errorf("append spool record error, db:%s, data:%s", r.DB, r.Data)
+	}
+}
+
+// next returns the next record to replay and the segment and offset after it.
+func (s *Spool) next() (*Record, uint64, int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.enforceLimits()
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if seg.records == 0 {
+			if len(s.segments) == 1 {
+				return nil, 0, 0, io.EOF
+			}
+			s.removeFirst()
+			continue
+		}
+		if s.reader == nil || s.readerID != seg.id {
+			if err := s.openReader(seg); err != nil {
+				return nil, 0, 0, err
+			}
+		}
+		if _, err := s.reader.Seek(s.readOffset, io.SeekStart); err != nil {
+			return nil, 0, 0, err
+		}
+		r, n, err := readRecord(s.reader)
+		if err != nil {
+			logger.WithError(err).Errorf("read spool segment %s at %d error, drop %d records", seg.path, s.readOffset, seg.records)
+			s.dropped.Add(float64(seg.records))
+			seg.records = 0
+			if len(s.segments) == 1 {
+				if err = s.rotate(); err != nil {
+					return nil, 0, 0, err
+				}
+			}
+			continue
+		}
+		return r, seg.id, s.readOffset + n, nil
+	}
+	return nil, 0, 0, io.EOF
+}
+
+func (s *Spool) openReader(seg *segment) error {
+	if s.reader != nil {
+		_ = s.reader.Close()
+		s.reader = nil
+	}
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	s.reader = f
+	s.readerID = seg.id
+	return nil
+}
+
+// advance moves the replay position after the replayed record.
+func (s *Spool) advance(id uint64, offset int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.segments) == 0 || s.segments[0].id != id {
+		// the segment was dropped during the replay
+		return
+	}
+	s.segments[0].records -= 1
+	s.readOffset = offset
+	if err := s.writeCheckpoint(id, offset); err != nil {
+		logger.WithError(err).Error("write spool checkpoint error")
+	}
+	s.updateDepth()
+}
+
+// Replay inserts the spooled records in order until the spool is empty. It stops at the first retryable error and
+// returns it, the record will be replayed next time. A record that fails with other errors is dropped.
+func (s *Spool) Replay(insert func(r *Record) error) error {
+	s.replayLock.Lock()
+	defer s.replayLock.Unlock()
+	for {
+		r, id, offset, err := s.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.replayLag.Set(time.Since(r.Time).Seconds())
+		err = insert(r)
+		if err != nil {
+			if s.retryable(err) {
+				return err
+			}
+			logger.WithError(err).Errorf("replay spool record error, drop record, db:%s, data:%s", r.DB, r.Data)
+			s.dropped.Inc()
+		} else {
+			s.replayed.Inc()
+		}
+		s.advance(id, offset)
+	}
+}
+
+// Start replays the spool every replay interval until the spool is closed.
+func (s *Spool) Start(insert func(r *Record) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.conf.ReplayInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Replay(insert); err != nil {
+					logger.WithError(err).Debug("replay spool error")
+				}
+			case <-s.closeChan:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the replay and syncs the spool to disk.
+func (s *Spool) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+	})
+	s.wg.Wait()
+	s.replayLock.Lock()
+	defer s.replayLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.reader != nil {
+		_ = s.reader.Close()
+		s.reader = nil
+	}
+	if s.checkpoint != nil {
+		_ = s.checkpoint.Close()
+		s.checkpoint = nil
+	}
+	return s.closeActive()
+}
+
+// Retryable reports whether the data should be spooled after the write error. Only the connection errors are
+// retried, the data of other errors fails again on replay.
+func Retryable(err error) bool {
+	return tool.IsConnectionError(err)
+}
@@ -0,0 +1,218 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/commonpool"
+	tErrors "github.com/taosdata/taosadapter/v3/driver/errors"
+	"github.com/taosdata/taosadapter/v3/httperror"
+	"github.com/taosdata/taosadapter/v3/tools/connectpool"
+)
+
+var errConnectionRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+type fakeInserter struct {
+	records []string
+	err     error
+}
+
+func (f *fakeInserter) insert(r *Record) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.records = append(f.records, fmt.Sprintf("%s %s %s", r.DB, r.ClientIP, r.Data))
+	return nil
+}
+
+func newConfig() *Config {
+	return &Config{SegmentSize: 1024, MaxSize: 1024 * 1024, MaxAge: time.Hour, ReplayInterval: time.Millisecond}
+}
+
+func appendRecords(t *testing.T, s *Spool, db string, from, to int) {
+	for i := from; i < to; i++ {
+		err := s.Append(&Record{DB: db, ClientIP: net.IPv4(127, 0, 0, 1), Data: []byte(fmt.Sprintf("m value=%d", i))})
+		require.NoError(t, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test_replay", dir, newConfig())
+	require.NoError(t, err)
+	appendRecords(t, s, "db1", 0, 100)
+	assert.Equal(t, float64(100), testutil.ToFloat64(s.depthRecords))
+
+	inserter := &fakeInserter{err: errConnectionRefused}
+	err = s.Replay(inserter.insert)
+	assert.Error(t, err)
+	assert.Equal(t, float64(100), testutil.ToFloat64(s.depthRecords))
+
+	inserter.err = nil
+	err = s.Replay(inserter.insert)
+	require.NoError(t, err)
+	require.Len(t, inserter.records, 100)
+	for i, r := range inserter.records {
+		assert.Equal(t, fmt.Sprintf("db1 127.0.0.1 m value=%d", i), r)
+	}
+	assert.Equal(t, float64(0), testutil.ToFloat64(s.depthRecords))
+	assert.Equal(t, float64(0), testutil.ToFloat64(s.depthBytes))
+	assert.Equal(t, float64(100), testutil.ToFloat64(s.replayed))
+	require.NoError(t, s.Close())
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	assert.Len(t, segments, 1)
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test_reopen", dir, newConfig())
+	require.NoError(t, err)
+	appendRecords(t, s, "db", 0, 50)
+	replayed := 0
+	err = s.Replay(func(r *Record) error {
+		if replayed == 10 {
+			return errConnectionRefused
+		}
+		replayed += 1
+		return nil
+	})
+	assert.Error(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = Open("test_reopen", dir, newConfig())
+	require.NoError(t, err)
+	assert.Equal(t, float64(40), testutil.ToFloat64(s.depthRecords))
+	appendRecords(t, s, "db", 50, 60)
+	inserter := &fakeInserter{}
+	require.NoError(t, s.Replay(inserter.insert))
+	require.Len(t, inserter.records, 50)
+	assert.Equal(t, "db 127.0.0.1 m value=10", inserter.records[0])
+	assert.Equal(t, "db 127.0.0.1 m value=59", inserter.records[49])
+	require.NoError(t, s.Close())
+}
+
+func TestTruncatedSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open("test_truncated", dir, newConfig())
+	require.NoError(t, err)
+	appendRecords(t, s, "db", 0, 3)
+	require.NoError(t, s.Close())
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	info, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(segments[0], info.Size()-3))
+
+	s, err = Open("test_truncated", dir, newConfig())
+	require.NoError(t, err)
+	inserter := &fakeInserter{}
+	require.NoError(t, s.Replay(inserter.insert))
+	assert.Equal(t, []string{"db 127.0.0.1 m value=0", "db 127.0.0.1 m value=1"}, inserter.records)
+	require.NoError(t, s.Close())
+}
+
+func TestLimits(t *testing.T) {
+	conf := newConfig()
+	conf.MaxSize = 2048
+	s, err := Open("test_limits", t.TempDir(), conf)
+	require.NoError(t, err)
+	appendRecords(t, s, "db", 0, 200)
+	assert.LessOrEqual(t, testutil.ToFloat64(s.depthBytes), float64(2048+1024))
+	dropped := testutil.ToFloat64(s.dropped)
+	assert.Greater(t, dropped, float64(0))
+	inserter := &fakeInserter{}
+	require.NoError(t, s.Replay(inserter.insert))
+	assert.Equal(t, float64(200), dropped+float64(len(inserter.records)))
+	assert.Equal(t, "db 127.0.0.1 m value=199", inserter.records[len(inserter.records)-1])
+	require.NoError(t, s.Close())
+
+	conf = newConfig()
+	conf.MaxAge = time.Millisecond
+	s, err = Open("test_limits_age", t.TempDir(), conf)
+	require.NoError(t, err)
+	appendRecords(t, s, "db", 0, 100)
+	time.Sleep(time.Millisecond * 10)
+	appendRecords(t, s, "db", 100, 101)
+	inserter = &fakeInserter{}
+	require.NoError(t, s.Replay(inserter.insert))
+	assert.Less(t, len(inserter.records), 101)
+	assert.Equal(t, "db 127.0.0.1 m value=100", inserter.records[len(inserter.records)-1])
+	require.NoError(t, s.Close())
+}
+
+func TestDataError(t *testing.T) {
+	s, err := Open("test_data_error", t.TempDir(), newConfig())
+	require.NoError(t, err)
+	appendRecords(t, s, "db", 0, 3)
+	var records []string
+	err = s.Replay(func(r *Record) error {
+		if string(r.Data) == "m value=1" {
+			return tErrors.NewError(0x3002, "Invalid data format")
+		}
+		records = append(records, string(r.Data))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m value=0", "m value=2"}, records)
+	assert.Equal(t, float64(1), testutil.ToFloat64(s.dropped))
+	require.NoError(t, s.Close())
+}
+
+func TestStart(t *testing.T) {
+	s, err := Open("test_start", t.TempDir(), newConfig())
+	require.NoError(t, err)
+	done := make(chan struct{})
+	s.Start(func(r *Record) error {
+		close(done)
+		return nil
+	})
+	appendRecords(t, s, "db", 0, 1)
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("record not replayed")
+	}
+	require.NoError(t, s.Close())
+	assert.Error(t, s.Append(&Record{DB: "db"}))
+}
+
+func TestPermanentError(t *testing.T) {
+	s, err := Open("test_permanent_error", t.TempDir(), newConfig())
+	require.NoError(t, err)
+	appendRecords(t, s, "db_not_exist", 0, 1)
+	appendRecords(t, s, "db", 1, 3)
+	inserter := &fakeInserter{}
+	err = s.Replay(func(r *Record) error {
+		if r.DB == "db_not_exist" {
+			return tErrors.NewError(httperror.TSDB_CODE_MND_DB_NOT_EXIST, "Database not exist")
+		}
+		return inserter.insert(r)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db 127.0.0.1 m value=1", "db 127.0.0.1 m value=2"}, inserter.records)
+	assert.Equal(t, float64(1), testutil.ToFloat64(s.dropped))
+	assert.Equal(t, float64(0), testutil.ToFloat64(s.depthRecords))
+	require.NoError(t, s.Close())
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(errConnectionRefused))
+	assert.True(t, Retryable(connectpool.ErrTimeout))
+	assert.True(t, Retryable(tErrors.NewError(httperror.RPC_NETWORK_UNAVAIL, "Unable to establish connection")))
+	assert.True(t, Retryable(tErrors.NewError(httperror.TSDB_CODE_TSC_DISCONNECTED, "Disconnected from server")))
+	assert.False(t, Retryable(tErrors.NewError(0x3002, "Invalid data format")))
+	assert.False(t, Retryable(tErrors.NewError(httperror.TSDB_CODE_MND_DB_NOT_EXIST, "Database not exist")))
+	assert.False(t, Retryable(errors.New("invalid record")))
+	assert.False(t, Retryable(commonpool.ErrWhitelistForbidden))
+}
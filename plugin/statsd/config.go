@@ -24,6 +24,8 @@ type Config struct {
 	DeleteGauges           bool
 	DeleteSets             bool
 	DeleteTimings          bool
+	BatchSize              int
+	FlushInterval          time.Duration
 	TTL                    int
 }
 
@@ -44,6 +46,11 @@ func (c *Config) setValue() {
 	c.DeleteSets = viper.GetBool("statsd.deleteSets")
 	c.DeleteTimings = viper.GetBool("statsd.deleteTimings")
 	c.TTL = viper.GetInt("statsd.ttl")
+	c.BatchSize = viper.GetInt("statsd.batchSize")
+	c.FlushInterval = viper.GetDuration("statsd.flushInterval")
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
 }
 
 func init() {
@@ -110,4 +117,12 @@ func init() {
 	_ = viper.BindEnv("statsd.ttl", "TAOS_ADAPTER_STATSD_TTL")
 	pflag.Int("statsd.ttl", 0, `statsd data ttl. Env "TAOS_ADAPTER_STATSD_TTL"`)
 	viper.SetDefault("statsd.ttl", 0)
+
+	_ = viper.BindEnv("statsd.batchSize", "TAOS_ADAPTER_STATSD_BATCH_SIZE")
+	pflag.Int("statsd.batchSize", 1, `statsd batch size. Env "TAOS_ADAPTER_STATSD_BATCH_SIZE"`)
+	viper.SetDefault("statsd.batchSize", 1)
+
+	_ = viper.BindEnv("statsd.flushInterval", "TAOS_ADAPTER_STATSD_FLUSH_INTERVAL")
+	pflag.Duration("statsd.flushInterval", time.Duration(0), `statsd flush interval (0s means not valid) . Env "TAOS_ADAPTER_STATSD_FLUSH_INTERVAL"`)
+	viper.SetDefault("statsd.flushInterval", time.Duration(0))
 }
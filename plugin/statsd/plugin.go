@@ -3,6 +3,7 @@ package statsd
 import (
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,8 @@ import (
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
 	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/plugin/batch"
+	"github.com/taosdata/taosadapter/v3/plugin/spool"
 	"github.com/taosdata/taosadapter/v3/schemaless/inserter"
 	"github.com/taosdata/taosadapter/v3/tools/generator"
 )
@@ -26,7 +29,10 @@ type Plugin struct {
 	ac         telegraf.Accumulator
 	input      *Statsd
 	closeChan  chan struct{}
+	gatherDone chan struct{}
 	metricChan chan telegraf.Metric
+	workerWG   sync.WaitGroup
+	spool      *spool.Spool
 }
 
 func (p *Plugin) Init(_ gin.IRouter) error {
@@ -42,20 +48,22 @@ func (p *Plugin) Start() error {
 	if !p.conf.Enable {
 		return nil
 	}
+	var err error
+	p.spool, err = spool.New(p.String())
+	if err != nil {
+		return err
+	}
+	if p.spool != nil {
+		p.spool.Start(func(r *spool.Record) error {
+			return p.insertLines(r.DB, r.Data)
+		})
+	}
 	p.closeChan = make(chan struct{})
+	p.gatherDone = make(chan struct{})
 	p.metricChan = make(chan telegraf.Metric, 2*p.conf.Worker)
+	p.workerWG.Add(p.conf.Worker)
 	for i := 0; i < p.conf.Worker; i++ {
-		go func() {
-			serializer := influx.NewSerializer()
-			for {
-				select {
-				case metric := <-p.metricChan:
-					p.HandleMetrics(serializer, metric)
-				case <-p.closeChan:
-					return
-				}
-			}
-		}()
+		go p.work()
 	}
 	p.input = &Statsd{
 		User:                   p.conf.User,
@@ -72,12 +80,13 @@ func (p *Plugin) Start() error {
 		Log:                    logger,
 	}
 	p.ac = agent.NewAccumulator(&MetricMaker{logger: logger}, p.metricChan)
-	err := p.input.Start(p.ac)
+	err = p.input.Start(p.ac)
 	if err != nil {
 		return err
 	}
 	ticker := time.NewTicker(p.conf.GatherInterval)
 	go func() {
+		defer close(p.gatherDone)
 		for {
 			select {
 			case <-ticker.C:
@@ -105,6 +114,13 @@ func (p *Plugin) Stop() error {
 	}
 	p.input.Stop()
 	close(p.closeChan)
+	// flush the cached metrics after the gather goroutine exits
+	<-p.gatherDone
+	close(p.metricChan)
+	p.workerWG.Wait()
+	if p.spool != nil {
+		return p.spool.Close()
+	}
 	return nil
 }
 
@@ -116,18 +132,46 @@ func (p *Plugin) Version() string {
 	return "v1"
 }
 
+func (p *Plugin) work() {
+	defer p.workerWG.Done()
+	serializer := influx.NewSerializer()
+	batcher := batch.NewBatcher(p.String(), p.conf.BatchSize, p.conf.FlushInterval, func(metrics []telegraf.Metric) error {
+		return p.HandleMetrics(serializer, metrics)
+	})
+	ticker := batcher.NewTicker()
+	defer ticker.Stop()
+	for {
+		select {
+		case metric, ok := <-p.metricChan:
+			if !ok {
+				batcher.Flush()
+				return
+			}
+			batcher.Add(metric)
+		case <-ticker.C:
+			batcher.Flush()
+		}
+	}
+}
+
 var localhost = net.IPv4(127, 0, 0, 1)
 
-func (p *Plugin) HandleMetrics(serializer *influx.Serializer, metric telegraf.Metric) {
-	data, err := serializer.Serialize(metric)
+func (p *Plugin) HandleMetrics(serializer *influx.Serializer, metrics []telegraf.Metric) error {
+	data, err := serializer.SerializeBatch(metrics)
 	if err != nil {
 		logger.WithError(err).Error("serialize statsd error")
-		return
+		return err
 	}
+	err = p.insertLines(p.conf.DB, data)
+	p.spool.AppendFailed(&spool.Record{DB: p.conf.DB, Data: data}, err)
+	return err
+}
+
+func (p *Plugin) insertLines(db string, data []byte) error {
 	taosConn, err := commonpool.GetConnection(p.conf.User, p.conf.Password, localhost)
 	if err != nil {
 		logger.WithError(err).Errorln("connect server error")
-		return
+		return err
 	}
 	defer func() {
 		putErr := taosConn.Put()
@@ -140,12 +184,13 @@ func (p *Plugin) HandleMetrics(serializer *influx.Serializer, metric telegraf.Me
 	reqID := generator.GetReqID()
 	execLogger := logger.WithField(config.ReqIDKey, reqID)
 	execLogger.Debugf("insert line,req_id:0x%x,data: %s", reqID, string(data))
-	err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, p.conf.DB, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
+	err = inserter.InsertInfluxdb(taosConn.TaosConnection, data, db, "ns", p.conf.TTL, uint64(reqID), "", execLogger)
 	execLogger.Debugf("insert line finish cost:%s", log.GetLogDuration(isDebug, start))
 	if err != nil {
 		execLogger.WithError(err).Errorln("insert lines error", string(data))
-		return
+		return err
 	}
+	return nil
 }
 
 type MetricMaker struct {
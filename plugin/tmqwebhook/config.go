@@ -0,0 +1,111 @@
+package tmqwebhook
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+)
+
+type Config struct {
+	Enable   bool
+	User     string
+	Password string
+	// Consumers are the webhook consumers, each one subscribes a topic and posts the rows to an url
+	Consumers []*ConsumerConfig
+}
+
+// ConsumerConfig is a consumer that posts the rows of a topic to an url in batches.
+type ConsumerConfig struct {
+	Name             string
+	Topic            string
+	GroupID          string
+	ClientID         string
+	OffsetReset      string
+	URL              string
+	Headers          map[string]string
+	Secret           string
+	BatchSize        int
+	FlushInterval    time.Duration
+	Timeout          time.Duration
+	MaxRetries       int
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
+
+func (c *Config) setValue() error {
+	c.Enable = viper.GetBool("tmq_webhook.enable")
+	c.User = viper.GetString("tmq_webhook.user")
+	c.Password = viper.GetString("tmq_webhook.password")
+	c.Consumers = nil
+	return viper.UnmarshalKey("tmq_webhook.consumers", &c.Consumers)
+}
+
+func (c *Config) check() error {
+	names := make(map[string]struct{}, len(c.Consumers))
+	for i, consumer := range c.Consumers {
+		if consumer == nil || len(consumer.Name) == 0 {
+			return fmt.Errorf("tmq_webhook.consumers[%d] name required", i)
+		}
+		if _, exists := names[consumer.Name]; exists {
+			return fmt.Errorf("duplicate tmq_webhook consumer %s", consumer.Name)
+		}
+		names[consumer.Name] = struct{}{}
+		if len(consumer.Topic) == 0 {
+			return fmt.Errorf("tmq_webhook consumer %s topic required", consumer.Name)
+		}
+		u, err := url.Parse(consumer.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("tmq_webhook consumer %s invalid url %s", consumer.Name, consumer.URL)
+		}
+		if len(consumer.GroupID) == 0 {
+			consumer.GroupID = "tmq_webhook_" + consumer.Name
+		}
+		switch consumer.OffsetReset {
+		case "":
+			consumer.OffsetReset = "earliest"
+		case "earliest", "latest", "none":
+		default:
+			return fmt.Errorf("tmq_webhook consumer %s invalid offsetReset %s", consumer.Name, consumer.OffsetReset)
+		}
+		if consumer.BatchSize <= 0 {
+			consumer.BatchSize = 100
+		}
+		if consumer.FlushInterval <= 0 {
+			consumer.FlushInterval = time.Second
+		}
+		if consumer.Timeout <= 0 {
+			consumer.Timeout = 10 * time.Second
+		}
+		if consumer.MaxRetries < 0 {
+			return fmt.Errorf("tmq_webhook consumer %s maxRetries should not be negative", consumer.Name)
+		}
+		if consumer.RetryInterval <= 0 {
+			consumer.RetryInterval = time.Second
+		}
+		if consumer.MaxRetryInterval <= 0 {
+			consumer.MaxRetryInterval = time.Minute
+		}
+		if consumer.MaxRetryInterval < consumer.RetryInterval {
+			consumer.MaxRetryInterval = consumer.RetryInterval
+		}
+	}
+	return nil
+}
+
+func init() {
+	_ = viper.BindEnv("tmq_webhook.enable", "TAOS_ADAPTER_TMQ_WEBHOOK_ENABLE")
+	pflag.Bool("tmq_webhook.enable", false, `enable tmq_webhook. Env "TAOS_ADAPTER_TMQ_WEBHOOK_ENABLE"`)
+	viper.SetDefault("tmq_webhook.enable", false)
+
+	_ = viper.BindEnv("tmq_webhook.user", "TAOS_ADAPTER_TMQ_WEBHOOK_USER")
+	pflag.String("tmq_webhook.user", common.DefaultUser, `tmq_webhook user. Env "TAOS_ADAPTER_TMQ_WEBHOOK_USER"`)
+	viper.SetDefault("tmq_webhook.user", common.DefaultUser)
+
+	_ = viper.BindEnv("tmq_webhook.password", "TAOS_ADAPTER_TMQ_WEBHOOK_PASSWORD")
+	pflag.String("tmq_webhook.password", common.DefaultPassword, `tmq_webhook password. Env "TAOS_ADAPTER_TMQ_WEBHOOK_PASSWORD"`)
+	viper.SetDefault("tmq_webhook.password", common.DefaultPassword)
+}
@@ -0,0 +1,80 @@
+package tmqwebhook
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/taosdata/taosadapter/v3/log"
+	"github.com/taosdata/taosadapter/v3/plugin"
+)
+
+var logger = log.GetLogger("PLG").WithField("mod", "tmq_webhook")
+
+type Plugin struct {
+	conf    Config
+	workers []*worker
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func (p *Plugin) Init(_ gin.IRouter) error {
+	err := p.conf.setValue()
+	if err != nil {
+		return err
+	}
+	if !p.conf.Enable {
+		logger.Info("tmq_webhook disabled")
+		return nil
+	}
+	err = p.conf.check()
+	if err != nil {
+		return err
+	}
+	p.workers = make([]*worker, 0, len(p.conf.Consumers))
+	for _, c := range p.conf.Consumers {
+		p.workers = append(p.workers, newWorker(c, p.conf.User, p.conf.Password))
+	}
+	return nil
+}
+
+func (p *Plugin) Start() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	for _, w := range p.workers {
+		w := w
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			w.run(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop cancels the requests in flight and closes the consumers, the rows not delivered are not committed.
+func (p *Plugin) Stop() error {
+	if !p.conf.Enable {
+		return nil
+	}
+	if p.cancel != nil {
+		p.cancel()
+		p.wg.Wait()
+	}
+	return nil
+}
+
+func (p *Plugin) String() string {
+	return "tmq_webhook"
+}
+
+func (p *Plugin) Version() string {
+	return "v1"
+}
+
+func init() {
+	plugin.Register(&Plugin{})
+}
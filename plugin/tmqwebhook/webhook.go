@@ -0,0 +1,249 @@
+package tmqwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+const (
+	SignatureHeader = "X-Taos-Signature"
+	// pollBlockingTime bounds each poll so that stop is noticed.
+	pollBlockingTime = 500 * time.Millisecond
+)
+
+var localhost = net.IPv4(127, 0, 0, 1)
+
+type tmqConsumer interface {
+	Poll(blockingTime time.Duration, location *time.Location) (*tmqconsumer.Message, error)
+	Commit() error
+	Close()
+}
+
+var newConsumer = func(conf *tmqconsumer.Config, logger *logrus.Entry) (tmqConsumer, error) {
+	consumer, err := tmqconsumer.New(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// worker runs a consumer, the rows polled are posted to the url in batches and the offsets are committed after
+// the url responds with 2xx.
+type worker struct {
+	conf    *ConsumerConfig
+	tmqConf *tmqconsumer.Config
+	client  *http.Client
+	logger  *logrus.Entry
+	builder *jsonbuilder.Stream
+}
+
+func newWorker(c *ConsumerConfig, user, password string) *worker {
+	return &worker{
+		conf: c,
+		tmqConf: &tmqconsumer.Config{
+			User:        user,
+			Password:    password,
+			GroupID:     c.GroupID,
+			ClientID:    c.ClientID,
+			Topics:      []string{c.Topic},
+			OffsetReset: c.OffsetReset,
+			IP:          localhost,
+			App:         "tmq_webhook",
+		},
+		client: &http.Client{Timeout: c.Timeout},
+		logger: logger.WithField("consumer", c.Name),
+	}
+}
+
+// run consumes until the context is done, the consumer is created again after an error. The rows of an
+// unfinished batch are not committed so they are polled again by the next consumer of the group.
+func (w *worker) run(ctx context.Context) {
+	w.builder = jsonbuilder.BorrowStream(nil)
+	defer jsonbuilder.ReturnStream(w.builder)
+	backoff := w.conf.RetryInterval
+	for {
+		consumer, err := newConsumer(w.tmqConf, w.logger)
+		if err != nil {
+			w.logger.WithError(err).Errorf("create tmq consumer error, retry after %s", backoff)
+		} else {
+			backoff = w.conf.RetryInterval
+			err = w.consume(ctx, consumer)
+			consumer.Close()
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.WithError(err).Errorf("tmq consumer error, retry after %s", backoff)
+		}
+		if !sleep(ctx, backoff) {
+			return
+		}
+		backoff = w.nextBackoff(backoff)
+	}
+}
+
+func (w *worker) consume(ctx context.Context, consumer tmqConsumer) error {
+	for {
+		payload, rows, err := w.collect(ctx, consumer)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if rows == 0 {
+			continue
+		}
+		if !w.deliver(ctx, payload, rows) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		if err = consumer.Commit(); err != nil {
+			return fmt.Errorf("commit error: %s", err)
+		}
+		w.logger.Debugf("delivered %d rows", rows)
+	}
+}
+
+// collect polls until batchSize rows are read or flushInterval passed since the first row, a message is never
+// split so a batch may have more than batchSize rows.
+func (w *worker) collect(ctx context.Context, consumer tmqConsumer) ([]byte, int, error) {
+	w.builder.SetBuffer(w.builder.Buffer()[:0])
+	w.builder.WriteObjectStart()
+	w.builder.WriteObjectField("consumer")
+	w.builder.WriteString(w.conf.Name)
+	w.builder.WriteMore()
+	w.builder.WriteObjectField("topic")
+	w.builder.WriteString(w.conf.Topic)
+	w.builder.WriteMore()
+	w.builder.WriteObjectField("rows")
+	w.builder.WriteArrayStart()
+	rows := 0
+	var deadline time.Time
+	for rows < w.conf.BatchSize {
+		if ctx.Err() != nil {
+			return nil, 0, nil
+		}
+		blockingTime := pollBlockingTime
+		if rows > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				break
+			}
+			if remaining < blockingTime {
+				blockingTime = remaining
+			}
+		}
+		message, err := consumer.Poll(blockingTime, time.UTC)
+		if err != nil {
+			return nil, 0, err
+		}
+		if message == nil {
+			continue
+		}
+		for _, block := range message.Blocks {
+			for _, row := range block.Rows {
+				if rows > 0 {
+					w.builder.WriteMore()
+				}
+				tmqconsumer.WriteRow(w.builder, message, block.TableName, row)
+				rows++
+			}
+		}
+		if rows > 0 && deadline.IsZero() {
+			deadline = time.Now().Add(w.conf.FlushInterval)
+		}
+	}
+	w.builder.WriteArrayEnd()
+	w.builder.WriteObjectEnd()
+	return w.builder.Buffer(), rows, nil
+}
+
+// deliver posts the batch until the url responds with 2xx, it returns false if the context is done or the batch
+// is dropped after maxRetries retries.
+func (w *worker) deliver(ctx context.Context, payload []byte, rows int) bool {
+	backoff := w.conf.RetryInterval
+	for retries := 0; ; retries++ {
+		err := w.post(ctx, payload)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if w.conf.MaxRetries > 0 && retries >= w.conf.MaxRetries {
+			w.logger.WithError(err).Errorf("drop %d rows after %d retries", rows, retries)
+			return false
+		}
+		w.logger.WithError(err).Warnf("post %d rows error, retry after %s", rows, backoff)
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		backoff = w.nextBackoff(backoff)
+	}
+}
+
+func (w *worker) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	if len(w.conf.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign(w.conf.Secret, payload))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned HTTP status %s", w.conf.URL, resp.Status)
+	}
+	return nil
+}
+
+func (w *worker) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > w.conf.MaxRetryInterval {
+		backoff = w.conf.MaxRetryInterval
+	}
+	return backoff
+}
+
+// Sign returns the signature header value of the body, the hex encoded HMAC-SHA256 with the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,228 @@
+package tmqwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/db/asynctmq/tmqconsumer"
+)
+
+type fakeConsumer struct {
+	lock     sync.Mutex
+	messages []*tmqconsumer.Message
+	commits  int32
+	closed   int32
+}
+
+func (c *fakeConsumer) Poll(blockingTime time.Duration, _ *time.Location) (*tmqconsumer.Message, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.messages) == 0 {
+		time.Sleep(blockingTime)
+		return nil, nil
+	}
+	message := c.messages[0]
+	c.messages = c.messages[1:]
+	return message, nil
+}
+
+func (c *fakeConsumer) Commit() error {
+	atomic.AddInt32(&c.commits, 1)
+	return nil
+}
+
+func (c *fakeConsumer) Close() {
+	atomic.AddInt32(&c.closed, 1)
+}
+
+func testMessage(offset int64, rows ...string) *tmqconsumer.Message {
+	block := &tmqconsumer.Block{TableName: "t1"}
+	for _, row := range rows {
+		block.Rows = append(block.Rows, []byte(row))
+	}
+	return &tmqconsumer.Message{Topic: "topic1", Database: "db1", VgroupID: 2, Offset: offset, Blocks: []*tmqconsumer.Block{block}}
+}
+
+type payload struct {
+	Consumer string `json:"consumer"`
+	Topic    string `json:"topic"`
+	Rows     []struct {
+		VgroupID  int32                  `json:"vgroup_id"`
+		Offset    int64                  `json:"offset"`
+		TableName string                 `json:"table_name"`
+		Data      map[string]interface{} `json:"data"`
+	} `json:"rows"`
+}
+
+func TestConfigConsumers(t *testing.T) {
+	viper.Set("tmq_webhook.consumers", []map[string]interface{}{
+		{
+			"name":          "alerts",
+			"topic":         "topic1",
+			"url":           "http://localhost:8080/hook",
+			"headers":       map[string]interface{}{"Authorization": "Bearer token"},
+			"flushInterval": "2s",
+		},
+	})
+	defer viper.Set("tmq_webhook.consumers", nil)
+	var c Config
+	require.NoError(t, c.setValue())
+	require.NoError(t, c.check())
+	require.Len(t, c.Consumers, 1)
+	consumer := c.Consumers[0]
+	assert.Equal(t, "tmq_webhook_alerts", consumer.GroupID)
+	assert.Equal(t, "earliest", consumer.OffsetReset)
+	assert.Equal(t, 100, consumer.BatchSize)
+	assert.Equal(t, 2*time.Second, consumer.FlushInterval)
+	assert.Equal(t, 10*time.Second, consumer.Timeout)
+	assert.Equal(t, time.Second, consumer.RetryInterval)
+	assert.Equal(t, time.Minute, consumer.MaxRetryInterval)
+	assert.Equal(t, "Bearer token", consumer.Headers["Authorization"])
+
+	for _, consumers := range [][]*ConsumerConfig{
+		{{Topic: "t", URL: "http://localhost"}},
+		{{Name: "a", URL: "http://localhost"}},
+		{{Name: "a", Topic: "t"}},
+		{{Name: "a", Topic: "t", URL: "ftp://localhost"}},
+		{{Name: "a", Topic: "t", URL: "http://localhost", OffsetReset: "wrong"}},
+		{{Name: "a", Topic: "t", URL: "http://localhost", MaxRetries: -1}},
+		{{Name: "a", Topic: "t", URL: "http://localhost"}, {Name: "a", Topic: "t", URL: "http://localhost"}},
+	} {
+		c = Config{Consumers: consumers}
+		assert.Error(t, c.check())
+	}
+}
+
+func TestWorker(t *testing.T) {
+	var requests int32
+	bodies := make(chan []byte, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("secret", body) || r.Header.Get("X-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the first request fails to test the retry
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	consumer := &fakeConsumer{messages: []*tmqconsumer.Message{
+		testMessage(1, `{"ts":"2024-01-01T00:00:00Z","v":1}`, `{"ts":"2024-01-01T00:00:01Z","v":2}`),
+		testMessage(2, `{"ts":"2024-01-01T00:00:02Z","v":3}`),
+	}}
+	newConsumer = func(conf *tmqconsumer.Config, logger *logrus.Entry) (tmqConsumer, error) {
+		return consumer, nil
+	}
+	c := &ConsumerConfig{
+		Name:             "alerts",
+		Topic:            "topic1",
+		URL:              ts.URL,
+		Headers:          map[string]string{"X-Token": "token"},
+		Secret:           "secret",
+		BatchSize:        2,
+		FlushInterval:    time.Second,
+		Timeout:          time.Second,
+		RetryInterval:    time.Millisecond * 10,
+		MaxRetryInterval: time.Millisecond * 100,
+	}
+	w := newWorker(c, "root", "taosdata")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(done)
+	}()
+
+	var p payload
+	select {
+	case body := <-bodies:
+		require.NoError(t, json.Unmarshal(body, &p))
+	case <-time.After(5 * time.Second):
+		t.Fatal("first batch not delivered")
+	}
+	assert.Equal(t, "alerts", p.Consumer)
+	assert.Equal(t, "topic1", p.Topic)
+	require.Len(t, p.Rows, 2)
+	assert.Equal(t, int32(2), p.Rows[0].VgroupID)
+	assert.Equal(t, int64(1), p.Rows[0].Offset)
+	assert.Equal(t, "t1", p.Rows[0].TableName)
+	assert.Equal(t, float64(2), p.Rows[1].Data["v"])
+
+	select {
+	case body := <-bodies:
+		require.NoError(t, json.Unmarshal(body, &p))
+	case <-time.After(5 * time.Second):
+		t.Fatal("second batch not delivered")
+	}
+	require.Len(t, p.Rows, 1)
+	assert.Equal(t, int64(2), p.Rows[0].Offset)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&consumer.commits) == 2
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&consumer.closed))
+}
+
+func TestWorkerDrop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	w := newWorker(&ConsumerConfig{
+		Name:             "alerts",
+		Topic:            "topic1",
+		URL:              ts.URL,
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: time.Millisecond,
+	}, "root", "taosdata")
+	assert.False(t, w.deliver(context.Background(), []byte(`{}`), 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.conf.MaxRetries = 0
+	assert.False(t, w.deliver(ctx, []byte(`{}`), 1))
+}
+
+func TestWorkerReconnect(t *testing.T) {
+	var creates int32
+	newConsumer = func(conf *tmqconsumer.Config, logger *logrus.Entry) (tmqConsumer, error) {
+		atomic.AddInt32(&creates, 1)
+		return nil, errors.New("connect error")
+	}
+	w := newWorker(&ConsumerConfig{
+		Name:             "alerts",
+		Topic:            "topic1",
+		URL:              "http://localhost",
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: time.Millisecond * 10,
+	}, "root", "taosdata")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	w.run(ctx)
+	assert.Greater(t, atomic.LoadInt32(&creates), int32(1))
+}
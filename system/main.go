@@ -2,6 +2,7 @@ package system
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"sort"
@@ -21,6 +22,7 @@ import (
 	"github.com/taosdata/taosadapter/v3/log"
 	"github.com/taosdata/taosadapter/v3/monitor"
 	"github.com/taosdata/taosadapter/v3/plugin"
+	"github.com/taosdata/taosadapter/v3/tools/certloader"
 	"github.com/taosdata/taosadapter/v3/version"
 )
 
@@ -106,6 +108,8 @@ type program struct {
 	router          *gin.Engine
 	server          *http.Server
 	startHttpServer func(server *http.Server)
+	certLoader      *certloader.Loader
+	cancelWatch     context.CancelFunc
 }
 
 func newProgram(router *gin.Engine, startHttpServer func(server *http.Server)) *program {
@@ -113,7 +117,18 @@ func newProgram(router *gin.Engine, startHttpServer func(server *http.Server)) *
 		Addr:    ":" + strconv.Itoa(config.Conf.Port),
 		Handler: router,
 	}
-	return &program{router: router, server: server, startHttpServer: startHttpServer}
+	prg := &program{router: router, server: server, startHttpServer: startHttpServer}
+	if config.Conf.SSL.Enable {
+		loader, err := certloader.NewLoader(config.Conf.SSL.CertFile, config.Conf.SSL.KeyFile, config.Conf.SSL.ClientCAFile)
+		if err != nil {
+			logger.Fatalf("load ssl certificate error, err:%s", err)
+		}
+		server.TLSConfig = loader.TLSConfig()
+		// disable HTTP/2, websocket upgrade is only supported over HTTP/1.1
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		prg.certLoader = loader
+	}
+	return prg
 }
 
 func (p *program) Start(s service.Service) error {
@@ -123,13 +138,23 @@ func (p *program) Start(s service.Service) error {
 		logger.Info("Running under service manager.")
 	}
 	monitor.StartMonitor()
-	logger.Printf("server on: %d", config.Conf.Port)
+	if p.certLoader != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancelWatch = cancel
+		go watchCertificate(ctx, p.certLoader, config.Conf.SSL.ReloadInterval)
+		logger.Printf("server on: %d, ssl enabled", config.Conf.Port)
+	} else {
+		logger.Printf("server on: %d", config.Conf.Port)
+	}
 	go p.startHttpServer(p.server)
 	return nil
 }
 
 func (p *program) Stop(s service.Service) error {
 	logger.Println("Shutdown WebServer ...")
+	if p.cancelWatch != nil {
+		p.cancelWatch()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	go func() {
@@ -139,6 +164,8 @@ func (p *program) Stop(s service.Service) error {
 	}()
 	logger.Println("Stop Plugins ...")
 	plugin.StopWithCtx(ctx)
+	logger.Println("Close Controllers ...")
+	controller.Close()
 	logger.Println("Server exiting")
 	ctxLog, cancelLog := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelLog()
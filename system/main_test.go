@@ -19,7 +19,12 @@ func TestStart(t *testing.T) {
 			if err != nil {
 				logger.Fatalf("listen: %s", err)
 			}
-			if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
 				logger.Fatalf("listen: %s", err)
 			}
 		})
@@ -2,10 +2,15 @@ package system
 
 import (
 	_ "github.com/taosdata/taosadapter/v3/plugin/collectd"       // import collectd plugin
+	_ "github.com/taosdata/taosadapter/v3/plugin/graphite"       // import graphite plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/influxdb"       // import influxdb plugin
+	_ "github.com/taosdata/taosadapter/v3/plugin/kafka"          // import kafka plugin
+	_ "github.com/taosdata/taosadapter/v3/plugin/mqtt"           // import mqtt plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/nodeexporter"   // import nodeexporter plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/opentsdb"       // import opentsdb plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/opentsdbtelnet" // import opentsdbtelnet plugin
+	_ "github.com/taosdata/taosadapter/v3/plugin/otlp"           // import otlp plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/prometheus"     // import prometheus plugin
 	_ "github.com/taosdata/taosadapter/v3/plugin/statsd"         // import statsd plugin
+	_ "github.com/taosdata/taosadapter/v3/plugin/tmqwebhook"     // import tmqwebhook plugin
 )
@@ -0,0 +1,46 @@
+package system
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/taosdata/taosadapter/v3/tools/certloader"
+)
+
+// watchCertificate reloads the server certificate when the files change or SIGHUP is received.
+func watchCertificate(ctx context.Context, loader *certloader.Loader, interval time.Duration) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			logger.Info("received SIGHUP, reload ssl certificate")
+			reloadCertificate(loader)
+		case <-tick:
+			if loader.Changed() {
+				logger.Info("ssl certificate changed, reload ssl certificate")
+				reloadCertificate(loader)
+			}
+		}
+	}
+}
+
+func reloadCertificate(loader *certloader.Loader) {
+	if err := loader.Reload(); err != nil {
+		logger.Errorf("reload ssl certificate error, keep the previous certificate, err:%s", err)
+		return
+	}
+	logger.Info("ssl certificate reloaded")
+}
@@ -0,0 +1,130 @@
+package certloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Loader keeps the server certificate (and optional client CA pool) in memory and
+// allows them to be replaced at runtime without restarting the listener.
+type Loader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func NewLoader(certFile, keyFile, clientCAFile string) (*Loader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("ssl cert file and key file must be set")
+	}
+	l := &Loader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads the certificate files from disk. The previous certificate is kept if loading fails.
+func (l *Loader) Reload() error {
+	modTimes, err := l.currentModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("load x509 key pair error: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if l.clientCAFile != "" {
+		caData, err := os.ReadFile(l.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client ca file error: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caData) {
+			return fmt.Errorf("no valid certificate found in client ca file: %s", l.clientCAFile)
+		}
+	}
+	l.lock.Lock()
+	l.cert = &cert
+	l.clientCAs = clientCAs
+	l.modTimes = modTimes
+	l.lock.Unlock()
+	return nil
+}
+
+// Changed reports whether any of the certificate files has been modified since the last successful load.
+func (l *Loader) Changed() bool {
+	modTimes, err := l.currentModTimes()
+	if err != nil {
+		return false
+	}
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(l.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Loader) currentModTimes() (map[string]time.Time, error) {
+	files := []string{l.certFile, l.keyFile}
+	if l.clientCAFile != "" {
+		files = append(files, l.clientCAFile)
+	}
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (l *Loader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.cert, nil
+}
+
+// TLSConfig returns a tls config that always serves the latest loaded certificate.
+// HTTP/2 is not negotiated because websocket upgrades require HTTP/1.1.
+func (l *Loader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			l.lock.RLock()
+			defer l.lock.RUnlock()
+			conf := &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     []string{"http/1.1"},
+				GetCertificate: l.GetCertificate,
+			}
+			if l.clientCAs != nil {
+				conf.ClientCAs = l.clientCAs
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+		GetCertificate: l.GetCertificate,
+	}
+}
@@ -0,0 +1,161 @@
+package certloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func generateCert(t *testing.T, commonName string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeCert(t *testing.T, dir string, c *testCert) (string, string) {
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func TestNewLoader(t *testing.T) {
+	_, err := NewLoader("", "", "")
+	assert.Error(t, err)
+	dir := t.TempDir()
+	_, err = NewLoader(filepath.Join(dir, "not_exist.crt"), filepath.Join(dir, "not_exist.key"), "")
+	assert.Error(t, err)
+	certFile, keyFile := writeCert(t, dir, generateCert(t, "server", true, nil))
+	loader, err := NewLoader(certFile, keyFile, "")
+	require.NoError(t, err)
+	cert, err := loader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, cert)
+	assert.False(t, loader.Changed())
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	first := generateCert(t, "first", true, nil)
+	certFile, keyFile := writeCert(t, dir, first)
+	loader, err := NewLoader(certFile, keyFile, "")
+	require.NoError(t, err)
+
+	second := generateCert(t, "second", true, nil)
+	writeCert(t, dir, second)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	assert.True(t, loader.Changed())
+	require.NoError(t, loader.Reload())
+	assert.False(t, loader.Changed())
+	cert, err := loader.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+
+	// broken key keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.Error(t, loader.Reload())
+	cert, err = loader.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "second", leaf.Subject.CommonName)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := generateCert(t, "ca", true, nil)
+	server := generateCert(t, "server", false, ca)
+	client := generateCert(t, "client", false, ca)
+	certFile, keyFile := writeCert(t, dir, server)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0600))
+	loader, err := NewLoader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		TLSConfig: loader.TLSConfig(),
+	}
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+	defer func() {
+		_ = srv.Close()
+	}()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+	url := "https://" + ln.Addr().String()
+
+	noCertClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	_, err = noCertClient.Get(url)
+	assert.Error(t, err)
+
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	require.NoError(t, err)
+	certClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      rootCAs,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	resp, err := certClient.Get(url)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+}
@@ -41,6 +41,25 @@ func ItemIsNull(pHeader unsafe.Pointer, row int) bool {
 	return BMIsNull(c, row)
 }
 
+// RawBlockColumnPointers fills the header (null bitmap or var offsets) and data start pointers of every column in the
+// raw block.
+func RawBlockColumnPointers(block unsafe.Pointer, blockSize int, colTypes []uint8, pHeaderList, pStartList []unsafe.Pointer) {
+	fieldsCount := len(colTypes)
+	nullBitMapOffset := uintptr(BitmapLen(blockSize))
+	lengthOffset := parser.RawBlockGetColumnLengthOffset(fieldsCount)
+	tmpPHeader := tools.AddPointer(block, parser.RawBlockGetColDataOffset(fieldsCount))
+	for column := 0; column < fieldsCount; column++ {
+		colLength := *((*int32)(tools.AddPointer(block, lengthOffset+uintptr(column)*parser.Int32Size)))
+		pHeaderList[column] = tmpPHeader
+		if IsVarDataType(colTypes[column]) {
+			pStartList[column] = tools.AddPointer(tmpPHeader, uintptr(4*blockSize))
+		} else {
+			pStartList[column] = tools.AddPointer(tmpPHeader, nullBitMapOffset)
+		}
+		tmpPHeader = tools.AddPointer(pStartList[column], uintptr(colLength))
+	}
+}
+
 func WriteRawJsonBool(builder *jsonbuilder.Stream, pStart unsafe.Pointer, row int) {
 	if (*((*byte)(tools.AddPointer(pStart, uintptr(row)*1)))) != 0 {
 		builder.WriteTrue()
@@ -258,3 +258,45 @@ func TestJsonWriteRawBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestRawBlockColumnPointers(t *testing.T) {
+	// 2 rows, int column and binary column
+	raw := []byte{
+		0x01, 0x00, 0x00, 0x00,
+		0x46, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x80,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+
+		0x04, 0x04, 0x00, 0x00, 0x00,
+		0x08, 0x16, 0x00, 0x00, 0x00,
+
+		0x08, 0x00, 0x00, 0x00,
+		0x07, 0x00, 0x00, 0x00,
+
+		0x00,
+		0x01, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+
+		0x00, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff,
+		0x05, 0x00, 0x74, 0x65, 0x73, 0x74, 0x31,
+	}
+	block := unsafe.Pointer(&raw[0])
+	colTypes := []uint8{common.TSDB_DATA_TYPE_INT, common.TSDB_DATA_TYPE_BINARY}
+	pHeaderList := make([]unsafe.Pointer, 2)
+	pStartList := make([]unsafe.Pointer, 2)
+	RawBlockColumnPointers(block, 2, colTypes, pHeaderList, pStartList)
+	dataOffset := parser.RawBlockGetColDataOffset(2)
+	assert.Equal(t, tools.AddPointer(block, dataOffset), pHeaderList[0])
+	assert.Equal(t, tools.AddPointer(block, dataOffset+1), pStartList[0])
+	assert.Equal(t, tools.AddPointer(block, dataOffset+9), pHeaderList[1])
+	assert.Equal(t, tools.AddPointer(block, dataOffset+17), pStartList[1])
+	assert.Equal(t, int32(2), *(*int32)(tools.AddPointer(pStartList[0], parser.Int32Size)))
+	assert.False(t, ItemIsNull(pHeaderList[0], 1))
+	builder := jsonbuilder.BorrowStream(nil)
+	defer jsonbuilder.ReturnStream(builder)
+	WriteRawJsonBinary(builder, pHeaderList[1], pStartList[1], 0)
+	assert.Equal(t, `"test1"`, string(builder.Buffer()))
+}
@@ -0,0 +1,164 @@
+package exporter
+
+import (
+	"io"
+	"math"
+	"time"
+	"unsafe"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+)
+
+// arrowExporter writes an Arrow IPC stream, every raw block becomes one record batch.
+type arrowExporter struct {
+	writer      *ipc.Writer
+	builder     *array.RecordBuilder
+	columns     []Column
+	colTypes    []uint8
+	pHeaderList []unsafe.Pointer
+	pStartList  []unsafe.Pointer
+}
+
+func arrowType(colType uint8, precision int, location *time.Location) arrow.DataType {
+	switch colType {
+	case common.TSDB_DATA_TYPE_BOOL:
+		return arrow.FixedWidthTypes.Boolean
+	case common.TSDB_DATA_TYPE_TINYINT:
+		return arrow.PrimitiveTypes.Int8
+	case common.TSDB_DATA_TYPE_SMALLINT:
+		return arrow.PrimitiveTypes.Int16
+	case common.TSDB_DATA_TYPE_INT:
+		return arrow.PrimitiveTypes.Int32
+	case common.TSDB_DATA_TYPE_BIGINT:
+		return arrow.PrimitiveTypes.Int64
+	case common.TSDB_DATA_TYPE_UTINYINT:
+		return arrow.PrimitiveTypes.Uint8
+	case common.TSDB_DATA_TYPE_USMALLINT:
+		return arrow.PrimitiveTypes.Uint16
+	case common.TSDB_DATA_TYPE_UINT:
+		return arrow.PrimitiveTypes.Uint32
+	case common.TSDB_DATA_TYPE_UBIGINT:
+		return arrow.PrimitiveTypes.Uint64
+	case common.TSDB_DATA_TYPE_FLOAT:
+		return arrow.PrimitiveTypes.Float32
+	case common.TSDB_DATA_TYPE_DOUBLE:
+		return arrow.PrimitiveTypes.Float64
+	case common.TSDB_DATA_TYPE_TIMESTAMP:
+		unit := arrow.Millisecond
+		switch precision {
+		case common.PrecisionMicroSecond:
+			unit = arrow.Microsecond
+		case common.PrecisionNanoSecond:
+			unit = arrow.Nanosecond
+		}
+		return &arrow.TimestampType{Unit: unit, TimeZone: location.String()}
+	case common.TSDB_DATA_TYPE_VARBINARY, common.TSDB_DATA_TYPE_GEOMETRY:
+		return arrow.BinaryTypes.Binary
+	default:
+		// binary, nchar and json
+		return arrow.BinaryTypes.String
+	}
+}
+
+func newArrowExporter(w io.Writer, columns []Column, precision int, location *time.Location) (*arrowExporter, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = arrow.Field{
+			Name:     column.Name,
+			Type:     arrowType(column.Type, precision, location),
+			Nullable: true,
+		}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	return &arrowExporter{
+		writer:      ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator)),
+		builder:     array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		columns:     columns,
+		colTypes:    columnTypes(columns),
+		pHeaderList: make([]unsafe.Pointer, len(columns)),
+		pStartList:  make([]unsafe.Pointer, len(columns)),
+	}, nil
+}
+
+func (e *arrowExporter) ContentType() string {
+	return ContentTypeArrow
+}
+
+// WriteHeader is a no-op, the ipc writer sends the schema message together with the first record batch.
+func (e *arrowExporter) WriteHeader() error {
+	return nil
+}
+
+func (e *arrowExporter) WriteBlock(block unsafe.Pointer, blockSize int, rows int) error {
+	ctools.RawBlockColumnPointers(block, blockSize, e.colTypes, e.pHeaderList, e.pStartList)
+	e.builder.Reserve(rows)
+	for column := range e.columns {
+		e.appendColumn(column, rows)
+	}
+	record := e.builder.NewRecord()
+	defer record.Release()
+	return e.writer.Write(record)
+}
+
+func (e *arrowExporter) appendColumn(column int, rows int) {
+	colType := e.columns[column].Type
+	pHeader := e.pHeaderList[column]
+	pStart := e.pStartList[column]
+	fieldBuilder := e.builder.Field(column)
+	for row := 0; row < rows; row++ {
+		if isNull(colType, pHeader, row) {
+			fieldBuilder.AppendNull()
+			continue
+		}
+		switch colType {
+		case common.TSDB_DATA_TYPE_BOOL:
+			fieldBuilder.(*array.BooleanBuilder).Append(*((*byte)(tools.AddPointer(pStart, uintptr(row)))) != 0)
+		case common.TSDB_DATA_TYPE_TINYINT:
+			fieldBuilder.(*array.Int8Builder).Append(*((*int8)(tools.AddPointer(pStart, uintptr(row)*parser.Int8Size))))
+		case common.TSDB_DATA_TYPE_SMALLINT:
+			fieldBuilder.(*array.Int16Builder).Append(*((*int16)(tools.AddPointer(pStart, uintptr(row)*parser.Int16Size))))
+		case common.TSDB_DATA_TYPE_INT:
+			fieldBuilder.(*array.Int32Builder).Append(*((*int32)(tools.AddPointer(pStart, uintptr(row)*parser.Int32Size))))
+		case common.TSDB_DATA_TYPE_BIGINT:
+			fieldBuilder.(*array.Int64Builder).Append(*((*int64)(tools.AddPointer(pStart, uintptr(row)*parser.Int64Size))))
+		case common.TSDB_DATA_TYPE_UTINYINT:
+			fieldBuilder.(*array.Uint8Builder).Append(*((*uint8)(tools.AddPointer(pStart, uintptr(row)*parser.UInt8Size))))
+		case common.TSDB_DATA_TYPE_USMALLINT:
+			fieldBuilder.(*array.Uint16Builder).Append(*((*uint16)(tools.AddPointer(pStart, uintptr(row)*parser.UInt16Size))))
+		case common.TSDB_DATA_TYPE_UINT:
+			fieldBuilder.(*array.Uint32Builder).Append(*((*uint32)(tools.AddPointer(pStart, uintptr(row)*parser.UInt32Size))))
+		case common.TSDB_DATA_TYPE_UBIGINT:
+			fieldBuilder.(*array.Uint64Builder).Append(*((*uint64)(tools.AddPointer(pStart, uintptr(row)*parser.UInt64Size))))
+		case common.TSDB_DATA_TYPE_FLOAT:
+			fieldBuilder.(*array.Float32Builder).Append(math.Float32frombits(*((*uint32)(tools.AddPointer(pStart, uintptr(row)*parser.Float32Size)))))
+		case common.TSDB_DATA_TYPE_DOUBLE:
+			fieldBuilder.(*array.Float64Builder).Append(math.Float64frombits(*((*uint64)(tools.AddPointer(pStart, uintptr(row)*parser.Float64Size)))))
+		case common.TSDB_DATA_TYPE_TIMESTAMP:
+			fieldBuilder.(*array.TimestampBuilder).Append(arrow.Timestamp(*((*int64)(tools.AddPointer(pStart, uintptr(row)*parser.Int64Size)))))
+		case common.TSDB_DATA_TYPE_VARBINARY, common.TSDB_DATA_TYPE_GEOMETRY:
+			fieldBuilder.(*array.BinaryBuilder).Append(varData(pHeader, pStart, row))
+		case common.TSDB_DATA_TYPE_NCHAR:
+			fieldBuilder.(*array.StringBuilder).Append(ncharString(pHeader, pStart, row))
+		default:
+			fieldBuilder.(*array.StringBuilder).Append(string(varData(pHeader, pStart, row)))
+		}
+	}
+}
+
+func (e *arrowExporter) Close() error {
+	return e.writer.Close()
+}
+
+func (e *arrowExporter) Release() {
+	if e.builder != nil {
+		e.builder.Release()
+		e.builder = nil
+	}
+}
@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/parser"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+)
+
+// csvExporter writes a header line with column names followed by one line per row, NULL is written as an empty field.
+type csvExporter struct {
+	writer      *csv.Writer
+	columns     []Column
+	colTypes    []uint8
+	precision   int
+	location    *time.Location
+	layout      string
+	record      []string
+	pHeaderList []unsafe.Pointer
+	pStartList  []unsafe.Pointer
+}
+
+func newCSVExporter(w io.Writer, columns []Column, precision int, location *time.Location) *csvExporter {
+	return &csvExporter{
+		writer:      csv.NewWriter(w),
+		columns:     columns,
+		colTypes:    columnTypes(columns),
+		precision:   precision,
+		location:    location,
+		layout:      timeLayout(precision),
+		record:      make([]string, len(columns)),
+		pHeaderList: make([]unsafe.Pointer, len(columns)),
+		pStartList:  make([]unsafe.Pointer, len(columns)),
+	}
+}
+
+func (e *csvExporter) ContentType() string {
+	return ContentTypeCSV
+}
+
+func (e *csvExporter) WriteHeader() error {
+	for i, column := range e.columns {
+		e.record[i] = column.Name
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvExporter) WriteBlock(block unsafe.Pointer, blockSize int, rows int) error {
+	ctools.RawBlockColumnPointers(block, blockSize, e.colTypes, e.pHeaderList, e.pStartList)
+	for row := 0; row < rows; row++ {
+		for column := range e.columns {
+			e.record[column] = e.formatValue(column, row)
+		}
+		if err := e.writer.Write(e.record); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExporter) formatValue(column int, row int) string {
+	colType := e.columns[column].Type
+	pHeader := e.pHeaderList[column]
+	pStart := e.pStartList[column]
+	if isNull(colType, pHeader, row) {
+		return ""
+	}
+	switch colType {
+	case common.TSDB_DATA_TYPE_BOOL:
+		return strconv.FormatBool(*((*byte)(tools.AddPointer(pStart, uintptr(row)))) != 0)
+	case common.TSDB_DATA_TYPE_TINYINT:
+		return strconv.FormatInt(int64(*((*int8)(tools.AddPointer(pStart, uintptr(row)*parser.Int8Size)))), 10)
+	case common.TSDB_DATA_TYPE_SMALLINT:
+		return strconv.FormatInt(int64(*((*int16)(tools.AddPointer(pStart, uintptr(row)*parser.Int16Size)))), 10)
+	case common.TSDB_DATA_TYPE_INT:
+		return strconv.FormatInt(int64(*((*int32)(tools.AddPointer(pStart, uintptr(row)*parser.Int32Size)))), 10)
+	case common.TSDB_DATA_TYPE_BIGINT:
+		return strconv.FormatInt(*((*int64)(tools.AddPointer(pStart, uintptr(row)*parser.Int64Size))), 10)
+	case common.TSDB_DATA_TYPE_UTINYINT:
+		return strconv.FormatUint(uint64(*((*uint8)(tools.AddPointer(pStart, uintptr(row)*parser.UInt8Size)))), 10)
+	case common.TSDB_DATA_TYPE_USMALLINT:
+		return strconv.FormatUint(uint64(*((*uint16)(tools.AddPointer(pStart, uintptr(row)*parser.UInt16Size)))), 10)
+	case common.TSDB_DATA_TYPE_UINT:
+		return strconv.FormatUint(uint64(*((*uint32)(tools.AddPointer(pStart, uintptr(row)*parser.UInt32Size)))), 10)
+	case common.TSDB_DATA_TYPE_UBIGINT:
+		return strconv.FormatUint(*((*uint64)(tools.AddPointer(pStart, uintptr(row)*parser.UInt64Size))), 10)
+	case common.TSDB_DATA_TYPE_FLOAT:
+		v := math.Float32frombits(*((*uint32)(tools.AddPointer(pStart, uintptr(row)*parser.Float32Size))))
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case common.TSDB_DATA_TYPE_DOUBLE:
+		v := math.Float64frombits(*((*uint64)(tools.AddPointer(pStart, uintptr(row)*parser.Float64Size))))
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case common.TSDB_DATA_TYPE_TIMESTAMP:
+		ts := *((*int64)(tools.AddPointer(pStart, uintptr(row)*parser.Int64Size)))
+		return timestampToTime(ts, e.precision, e.location).Format(e.layout)
+	case common.TSDB_DATA_TYPE_BINARY, common.TSDB_DATA_TYPE_JSON:
+		return string(varData(pHeader, pStart, row))
+	case common.TSDB_DATA_TYPE_NCHAR:
+		return ncharString(pHeader, pStart, row)
+	case common.TSDB_DATA_TYPE_VARBINARY, common.TSDB_DATA_TYPE_GEOMETRY:
+		return hex.EncodeToString(varData(pHeader, pStart, row))
+	}
+	return ""
+}
+
+func (e *csvExporter) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExporter) Release() {
+}
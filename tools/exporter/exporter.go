@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/tools"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/layout"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatArrow  = "arrow"
+)
+
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeArrow  = "application/vnd.apache.arrow.stream"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+var contentTypeFormat = map[string]string{
+	ContentTypeJSON:                FormatJSON,
+	ContentTypeCSV:                 FormatCSV,
+	ContentTypeNDJSON:              FormatNDJSON,
+	"application/ndjson":           FormatNDJSON,
+	"application/jsonlines":        FormatNDJSON,
+	ContentTypeArrow:               FormatArrow,
+	"application/vnd.apache.arrow": FormatArrow,
+}
+
+// Negotiate returns the output format. The format query parameter takes precedence over the Accept header,
+// an Accept header without any supported media type falls back to json.
+func Negotiate(format string, accept string) (string, error) {
+	if format != "" {
+		switch strings.ToLower(format) {
+		case FormatJSON:
+			return FormatJSON, nil
+		case FormatCSV:
+			return FormatCSV, nil
+		case FormatNDJSON, "jsonl":
+			return FormatNDJSON, nil
+		case FormatArrow:
+			return FormatArrow, nil
+		default:
+			return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+		}
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if f, ok := contentTypeFormat[mediaType]; ok {
+			return f, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+type Column struct {
+	Name   string
+	Type   uint8
+	Length int64
+}
+
+// Exporter writes query result blocks in a non-JSON format.
+type Exporter interface {
+	ContentType() string
+	// WriteHeader writes the schema or header line before any block.
+	WriteHeader() error
+	// WriteBlock writes the first rows of a raw block, rows must not be greater than blockSize.
+	WriteBlock(block unsafe.Pointer, blockSize int, rows int) error
+	// Close flushes buffered data and writes the end of stream.
+	Close() error
+	// Release frees the buffers of the exporter, it must be called whether Close is called or not.
+	Release()
+}
+
+func New(format string, w io.Writer, columns []Column, precision int, location *time.Location, logger *logrus.Entry) (Exporter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVExporter(w, columns, precision, location), nil
+	case FormatNDJSON:
+		return newNDJSONExporter(w, columns, precision, location, logger), nil
+	case FormatArrow:
+		return newArrowExporter(w, columns, precision, location)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// columnTypes returns the type of every column, in the order of the raw block.
+func columnTypes(columns []Column) []uint8 {
+	colTypes := make([]uint8, len(columns))
+	for i, column := range columns {
+		colTypes[i] = column.Type
+	}
+	return colTypes
+}
+
+func isNull(colType uint8, pHeader unsafe.Pointer, row int) bool {
+	if ctools.IsVarDataType(colType) {
+		return *((*int32)(tools.AddPointer(pHeader, uintptr(row*4)))) == -1
+	}
+	return ctools.ItemIsNull(pHeader, row)
+}
+
+// varData returns the bytes of a var data column without copy, the caller must not keep the slice.
+func varData(pHeader, pStart unsafe.Pointer, row int) []byte {
+	offset := *((*int32)(tools.AddPointer(pHeader, uintptr(row*4))))
+	currentRow := tools.AddPointer(pStart, uintptr(offset))
+	clen := *((*uint16)(currentRow))
+	if clen == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice((*byte)(tools.AddPointer(currentRow, 2)), int(clen))
+}
+
+func ncharString(pHeader, pStart unsafe.Pointer, row int) string {
+	b := varData(pHeader, pStart, row)
+	runes := make([]rune, len(b)/4)
+	for i := range runes {
+		runes[i] = *((*rune)(unsafe.Pointer(&b[i*4])))
+	}
+	return string(runes)
+}
+
+func timestampToTime(ts int64, precision int, location *time.Location) time.Time {
+	return common.TimestampConvertToTime(ts, precision).In(location)
+}
+
+func timeLayout(precision int) string {
+	switch precision {
+	case common.PrecisionMicroSecond:
+		return layout.LayoutMicroSecond
+	case common.PrecisionNanoSecond:
+		return layout.LayoutNanoSecond
+	default:
+		return layout.LayoutMillSecond
+	}
+}
@@ -0,0 +1,196 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taosdata/taosadapter/v3/driver/common"
+	"github.com/taosdata/taosadapter/v3/driver/common/param"
+	"github.com/taosdata/taosadapter/v3/driver/common/serializer"
+)
+
+var testColumns = []Column{
+	{Name: "ts", Type: common.TSDB_DATA_TYPE_TIMESTAMP, Length: 8},
+	{Name: "v1", Type: common.TSDB_DATA_TYPE_BOOL, Length: 1},
+	{Name: "v2", Type: common.TSDB_DATA_TYPE_INT, Length: 4},
+	{Name: "v3", Type: common.TSDB_DATA_TYPE_DOUBLE, Length: 8},
+	{Name: "v4", Type: common.TSDB_DATA_TYPE_BINARY, Length: 20},
+	{Name: "v5", Type: common.TSDB_DATA_TYPE_NCHAR, Length: 20},
+	{Name: "v6", Type: common.TSDB_DATA_TYPE_UBIGINT, Length: 8},
+	{Name: "v7", Type: common.TSDB_DATA_TYPE_VARBINARY, Length: 20},
+}
+
+func testBlock(t *testing.T) []byte {
+	ts := time.Unix(1700000000, 0)
+	params := []*param.Param{
+		param.NewParam(3).AddTimestamp(ts, common.PrecisionMilliSecond).AddTimestamp(ts.Add(time.Second), common.PrecisionMilliSecond).AddTimestamp(ts.Add(2*time.Second), common.PrecisionMilliSecond),
+		param.NewParam(3).AddBool(true).AddNull().AddBool(false),
+		param.NewParam(3).AddInt(1).AddInt(-2).AddNull(),
+		param.NewParam(3).AddDouble(1.5).AddNull().AddDouble(-2.25),
+		param.NewParam(3).AddBinary([]byte("a,b")).AddNull().AddBinary([]byte("c\"d")),
+		param.NewParam(3).AddNchar("中文").AddNchar("").AddNull(),
+		param.NewParam(3).AddUBigint(18446744073709551615).AddUBigint(0).AddNull(),
+		param.NewParam(3).AddVarBinary([]byte{0x01, 0xab}).AddNull().AddVarBinary([]byte{}),
+	}
+	colTypes := param.NewColumnType(8).AddTimestamp().AddBool().AddInt().AddDouble().AddBinary(20).AddNchar(20).AddUBigint().AddVarBinary(20)
+	block, err := serializer.SerializeRawBlock(params, colTypes)
+	require.NoError(t, err)
+	return block
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+		err    bool
+	}{
+		{name: "default", want: FormatJSON},
+		{name: "format csv", format: "CSV", accept: ContentTypeArrow, want: FormatCSV},
+		{name: "format jsonl", format: "jsonl", want: FormatNDJSON},
+		{name: "format unknown", format: "xml", err: true},
+		{name: "accept arrow", accept: "application/vnd.apache.arrow.stream", want: FormatArrow},
+		{name: "accept list", accept: "text/html, text/csv;q=0.9", want: FormatCSV},
+		{name: "accept ndjson", accept: "application/x-ndjson", want: FormatNDJSON},
+		{name: "accept any", accept: "*/*", want: FormatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(tt.format, tt.accept)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrUnsupportedFormat)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCSV(t *testing.T) {
+	block := testBlock(t)
+	var buf bytes.Buffer
+	e, err := New(FormatCSV, &buf, testColumns, common.PrecisionMilliSecond, time.UTC, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeCSV, e.ContentType())
+	require.NoError(t, e.WriteHeader())
+	require.NoError(t, e.WriteBlock(unsafe.Pointer(&block[0]), 3, 2))
+	require.NoError(t, e.Close())
+	e.Release()
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ts", "v1", "v2", "v3", "v4", "v5", "v6", "v7"},
+		{"2023-11-14T22:13:20.000Z", "true", "1", "1.5", "a,b", "中文", "18446744073709551615", "01ab"},
+		{"2023-11-14T22:13:21.000Z", "", "-2", "", "", "", "0", ""},
+	}, records)
+}
+
+func TestNDJSON(t *testing.T) {
+	block := testBlock(t)
+	var buf bytes.Buffer
+	e, err := New(FormatNDJSON, &buf, testColumns, common.PrecisionMilliSecond, time.UTC, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeNDJSON, e.ContentType())
+	require.NoError(t, e.WriteHeader())
+	require.NoError(t, e.WriteBlock(unsafe.Pointer(&block[0]), 3, 3))
+	require.NoError(t, e.Close())
+	e.Release()
+	scanner := bufio.NewScanner(&buf)
+	var rows []map[string]interface{}
+	for scanner.Scan() {
+		var row map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		rows = append(rows, row)
+	}
+	require.Equal(t, 3, len(rows))
+	assert.Equal(t, "2023-11-14T22:13:20.000Z", rows[0]["ts"])
+	assert.Equal(t, true, rows[0]["v1"])
+	assert.Equal(t, float64(1), rows[0]["v2"])
+	assert.Equal(t, "a,b", rows[0]["v4"])
+	assert.Equal(t, "中文", rows[0]["v5"])
+	assert.Nil(t, rows[1]["v1"])
+	assert.Equal(t, "c\"d", rows[2]["v4"])
+	assert.Nil(t, rows[2]["v5"])
+}
+
+func TestArrow(t *testing.T) {
+	block := testBlock(t)
+	var buf bytes.Buffer
+	e, err := New(FormatArrow, &buf, testColumns, common.PrecisionMilliSecond, time.UTC, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeArrow, e.ContentType())
+	require.NoError(t, e.WriteHeader())
+	require.NoError(t, e.WriteBlock(unsafe.Pointer(&block[0]), 3, 3))
+	require.NoError(t, e.WriteBlock(unsafe.Pointer(&block[0]), 3, 1))
+	require.NoError(t, e.Close())
+	e.Release()
+
+	reader, err := ipc.NewReader(&buf)
+	require.NoError(t, err)
+	defer reader.Release()
+	schema := reader.Schema()
+	require.Equal(t, 8, len(schema.Fields()))
+	assert.Equal(t, &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}, schema.Field(0).Type)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(5).Type)
+	assert.Equal(t, arrow.BinaryTypes.Binary, schema.Field(7).Type)
+	require.True(t, reader.Next())
+	record := reader.Record()
+	assert.Equal(t, int64(3), record.NumRows())
+	assert.Equal(t, arrow.Timestamp(1700000000000), record.Column(0).(*array.Timestamp).Value(0))
+	assert.True(t, record.Column(1).(*array.Boolean).Value(0))
+	assert.True(t, record.Column(1).IsNull(1))
+	assert.Equal(t, int32(-2), record.Column(2).(*array.Int32).Value(1))
+	assert.True(t, record.Column(2).IsNull(2))
+	assert.Equal(t, -2.25, record.Column(3).(*array.Float64).Value(2))
+	assert.Equal(t, "c\"d", record.Column(4).(*array.String).Value(2))
+	assert.Equal(t, "中文", record.Column(5).(*array.String).Value(0))
+	assert.Equal(t, uint64(18446744073709551615), record.Column(6).(*array.Uint64).Value(0))
+	assert.Equal(t, []byte{0x01, 0xab}, record.Column(7).(*array.Binary).Value(0))
+	require.True(t, reader.Next())
+	assert.Equal(t, int64(1), reader.Record().NumRows())
+	assert.False(t, reader.Next())
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestReleaseAfterWriteError(t *testing.T) {
+	block := testBlock(t)
+	for _, format := range []string{FormatCSV, FormatNDJSON, FormatArrow} {
+		t.Run(format, func(t *testing.T) {
+			e, err := New(format, errWriter{}, testColumns, common.PrecisionMilliSecond, time.UTC, logrus.NewEntry(logrus.New()))
+			require.NoError(t, err)
+			require.NoError(t, e.WriteHeader())
+			err = e.WriteBlock(unsafe.Pointer(&block[0]), 3, 3)
+			if format != FormatCSV {
+				// csv buffers the rows until close
+				assert.Error(t, err)
+			}
+			e.Release()
+			assert.NotPanics(t, e.Release)
+			switch exporter := e.(type) {
+			case *ndjsonExporter:
+				assert.Nil(t, exporter.builder)
+			case *arrowExporter:
+				assert.Nil(t, exporter.builder)
+			}
+		})
+	}
+}
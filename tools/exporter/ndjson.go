@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"io"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"github.com/taosdata/taosadapter/v3/tools/ctools"
+	"github.com/taosdata/taosadapter/v3/tools/jsonbuilder"
+)
+
+// ndjsonExporter writes one JSON object per line, keyed by column name, values are encoded the same as /rest/sql.
+type ndjsonExporter struct {
+	builder     *jsonbuilder.Stream
+	columns     []Column
+	colTypes    []uint8
+	precision   int
+	location    *time.Location
+	logger      *logrus.Entry
+	timeBuffer  []byte
+	pHeaderList []unsafe.Pointer
+	pStartList  []unsafe.Pointer
+}
+
+func newNDJSONExporter(w io.Writer, columns []Column, precision int, location *time.Location, logger *logrus.Entry) *ndjsonExporter {
+	return &ndjsonExporter{
+		builder:     jsonbuilder.BorrowStream(w),
+		columns:     columns,
+		colTypes:    columnTypes(columns),
+		precision:   precision,
+		location:    location,
+		logger:      logger,
+		timeBuffer:  make([]byte, 0, 30),
+		pHeaderList: make([]unsafe.Pointer, len(columns)),
+		pStartList:  make([]unsafe.Pointer, len(columns)),
+	}
+}
+
+func (e *ndjsonExporter) ContentType() string {
+	return ContentTypeNDJSON
+}
+
+func (e *ndjsonExporter) WriteHeader() error {
+	return nil
+}
+
+func (e *ndjsonExporter) WriteBlock(block unsafe.Pointer, blockSize int, rows int) error {
+	ctools.RawBlockColumnPointers(block, blockSize, e.colTypes, e.pHeaderList, e.pStartList)
+	for row := 0; row < rows; row++ {
+		e.builder.WriteObjectStart()
+		for column := range e.columns {
+			e.builder.WriteObjectField(e.columns[column].Name)
+			ctools.JsonWriteRawBlock(e.builder, e.columns[column].Type, e.pHeaderList[column], e.pStartList[column], row, e.precision, e.location, e.timeBuffer, e.logger)
+			if column != len(e.columns)-1 {
+				e.builder.WriteMore()
+			}
+		}
+		e.builder.WriteObjectEnd()
+		e.builder.AddByte('\n')
+		if e.builder.Buffered() > 16352 {
+			if err := e.builder.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return e.builder.Flush()
+}
+
+func (e *ndjsonExporter) Close() error {
+	return e.builder.Flush()
+}
+
+func (e *ndjsonExporter) Release() {
+	if e.builder != nil {
+		jsonbuilder.ReturnStream(e.builder)
+		e.builder = nil
+	}
+}
@@ -0,0 +1,19 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuoteIdentifier returns the name quoted with backticks, a name containing a backtick is invalid.
+func QuoteIdentifier(name string) (string, error) {
+	if strings.IndexByte(name, '`') >= 0 {
+		return "", fmt.Errorf("invalid identifier %s", name)
+	}
+	return "`" + name + "`", nil
+}
+
+// EscapeString escapes the backslashes and single quotes of a string literal.
+func EscapeString(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `'`, `\'`)
+}
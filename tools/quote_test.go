@@ -0,0 +1,21 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	name, err := QuoteIdentifier("cpu.usage")
+	assert.NoError(t, err)
+	assert.Equal(t, "`cpu.usage`", name)
+	_, err = QuoteIdentifier("a`b")
+	assert.Error(t, err)
+}
+
+func TestEscapeString(t *testing.T) {
+	assert.Equal(t, `it\'s`, EscapeString(`it's`))
+	assert.Equal(t, `a\\\'b`, EscapeString(`a\'b`))
+	assert.Equal(t, "abc", EscapeString("abc"))
+}